@@ -0,0 +1,57 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"errors"
+
+	"github.com/loadimpact/k6/core"
+)
+
+// The states of an agent.
+const (
+	AgentStateIdle     = "idle"     // No test was loaded yet
+	AgentStateLoaded   = "loaded"   // A test was loaded and can be started
+	AgentStateRunning  = "running"  // The test is running
+	AgentStateFinished = "finished" // The test is over, another one can be loaded
+)
+
+// The errors of agents when they're told to do something that their state doesn't allow.
+var (
+	ErrAgentBusy     = errors.New("a test is running, it has to finish or be stopped first")
+	ErrAgentNotReady = errors.New("no test was loaded since the last one was started")
+)
+
+// Agent is a k6 instance in the remote-control mode of `k6 agent`: it starts idle and runs the
+// tests that it's sent through the API, one at a time.
+type Agent interface {
+	// Load prepares the test in the given archive, replacing a loaded test that wasn't started.
+	// It returns ErrAgentBusy if a test is running.
+	Load(archive []byte) error
+
+	// Start starts the loaded test in the background. It returns ErrAgentNotReady if there's
+	// no loaded test.
+	Start() error
+
+	// State returns the state of the agent, the engine of its current test (nil if it's idle),
+	// and the error that the last finished test ended with, if any.
+	State() (state string, engine *core.Engine, err error)
+}
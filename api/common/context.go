@@ -28,12 +28,29 @@ import (
 
 type ContextKey int
 
-const ctxKeyEngine = ContextKey(1)
+const (
+	ctxKeyEngine = ContextKey(1)
+	ctxKeyAgent  = ContextKey(2)
+)
 
 func WithEngine(ctx context.Context, engine *core.Engine) context.Context {
 	return context.WithValue(ctx, ctxKeyEngine, engine)
 }
 
+// GetEngine returns the engine of the test that the API controls, or nil if there's none, which
+// can only happen in the remote-control mode, before the agent is sent a test.
 func GetEngine(ctx context.Context) *core.Engine {
-	return ctx.Value(ctxKeyEngine).(*core.Engine)
+	engine, _ := ctx.Value(ctxKeyEngine).(*core.Engine)
+	return engine
+}
+
+// WithAgent attaches the agent of the remote-control mode to the context.
+func WithAgent(ctx context.Context, agent Agent) context.Context {
+	return context.WithValue(ctx, ctxKeyAgent, agent)
+}
+
+// GetAgent returns the agent of the remote-control mode, or nil if k6 isn't running in it.
+func GetAgent(ctx context.Context) Agent {
+	agent, _ := ctx.Value(ctxKeyAgent).(Agent)
+	return agent
 }
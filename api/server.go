@@ -21,8 +21,11 @@
 package api
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/loadimpact/k6/api/common"
 	"github.com/loadimpact/k6/api/v1"
@@ -51,6 +54,56 @@ func ListenAndServe(addr string, engine *core.Engine) error {
 	return http.ListenAndServe(addr, n)
 }
 
+// ListenAndServeFunc is like ListenAndServe, for engines that change over time, like the ones of
+// the tests that `k6 run` runs one after the other. The function returns nil between tests.
+func ListenAndServeFunc(addr string, engine func() *core.Engine) error {
+	mux := NewHandler()
+
+	n := negroni.New()
+	n.Use(negroni.NewRecovery())
+	n.UseFunc(WithEngineFunc(engine))
+	n.UseFunc(NewLogger(log.StandardLogger()))
+	n.UseHandler(mux)
+
+	return http.ListenAndServe(addr, n)
+}
+
+// ListenAndServeAgent serves the API of the remote-control mode, where the engine is the one of
+// the test that the agent was sent last, if any. Unless the token is empty, every request has to
+// have it as a bearer token.
+func ListenAndServeAgent(addr string, agent common.Agent, token string) error {
+	mux := NewHandler()
+
+	n := negroni.New()
+	n.Use(negroni.NewRecovery())
+	n.UseFunc(WithBearerToken(token))
+	n.UseFunc(WithAgent(agent))
+	n.UseFunc(NewLogger(log.StandardLogger()))
+	n.UseHandler(mux)
+
+	return http.ListenAndServe(addr, n)
+}
+
+// WithBearerToken rejects the requests whose Authorization header doesn't have the token as a
+// bearer token. It lets all requests through if the token is empty.
+func WithBearerToken(token string) negroni.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			data, _ := json.Marshal(v1.ErrorResponse{Errors: []v1.Error{{
+				Status: strconv.Itoa(http.StatusUnauthorized),
+				Title:  "Unauthorized",
+				Detail: "the request needs the token of the agent in an 'Authorization: Bearer' header",
+			}}})
+			rw.WriteHeader(http.StatusUnauthorized)
+			_, _ = rw.Write(data)
+			return
+		}
+		next(rw, r)
+	})
+}
+
 func NewLogger(l *log.Logger) negroni.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		next(rw, r)
@@ -67,6 +120,27 @@ func WithEngine(engine *core.Engine) negroni.HandlerFunc {
 	})
 }
 
+// WithEngineFunc attaches the engine that the function returns at the time, if any, to every request.
+func WithEngineFunc(engine func() *core.Engine) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if e := engine(); e != nil {
+			r = r.WithContext(common.WithEngine(r.Context(), e))
+		}
+		next(rw, r)
+	})
+}
+
+// WithAgent attaches the agent, and the engine of its current test, to every request.
+func WithAgent(agent common.Agent) negroni.HandlerFunc {
+	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ctx := common.WithAgent(r.Context(), agent)
+		if _, engine, _ := agent.State(); engine != nil {
+			ctx = common.WithEngine(ctx, engine)
+		}
+		next(rw, r.WithContext(ctx))
+	})
+}
+
 func HandlePing() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Add("Content-Type", "text/plain; charset=utf-8")
@@ -85,6 +85,59 @@ func TestWithEngine(t *testing.T) {
 	})
 }
 
+func TestWithEngineFunc(t *testing.T) {
+	engine, err := core.NewEngine(nil, lib.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var current *core.Engine
+	handler := WithEngineFunc(func() *core.Engine { return current })
+	for _, e := range []*core.Engine{nil, engine} {
+		current = e
+		called := false
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com/", nil)
+		handler(rw, r, func(rw http.ResponseWriter, r *http.Request) {
+			called = true
+			assert.Equal(t, e, common.GetEngine(r.Context()))
+		})
+		assert.True(t, called)
+	}
+}
+
+func TestWithBearerToken(t *testing.T) {
+	testdata := map[string]struct {
+		token, header string
+		allowed       bool
+	}{
+		"no token":     {"", "", true},
+		"valid":        {"s3cret", "Bearer s3cret", true},
+		"missing":      {"s3cret", "", false},
+		"wrong":        {"s3cret", "Bearer s3cre", false},
+		"wrong scheme": {"s3cret", "Basic s3cret", false},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			rw := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://example.com/v1/agent", nil)
+			if data.header != "" {
+				r.Header.Set("Authorization", data.header)
+			}
+			WithBearerToken(data.token)(rw, r, func(rw http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+			assert.Equal(t, data.allowed, called)
+			if !data.allowed {
+				assert.Equal(t, http.StatusUnauthorized, rw.Result().StatusCode)
+				assert.Equal(t, "Bearer", rw.Result().Header.Get("WWW-Authenticate"))
+				assert.Contains(t, rw.Body.String(), "the request needs the token of the agent")
+			}
+		})
+	}
+}
+
 func TestPing(t *testing.T) {
 	mux := NewHandler()
 
@@ -0,0 +1,57 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"github.com/loadimpact/k6/api/common"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Agent is the state of k6 in the remote-control mode.
+type Agent struct {
+	// One of the common.AgentState* constants.
+	State string `json:"state" yaml:"state"`
+
+	// The error that the last finished test ended with, if any.
+	Error null.String `json:"error" yaml:"error"`
+}
+
+// NewAgent returns the current state of the agent.
+func NewAgent(agent common.Agent) Agent {
+	state, _, err := agent.State()
+	a := Agent{State: state}
+	if err != nil {
+		a.Error = null.StringFrom(err.Error())
+	}
+	return a
+}
+
+func (a Agent) GetName() string {
+	return "agent"
+}
+
+func (a Agent) GetID() string {
+	return "default"
+}
+
+func (a Agent) SetID(id string) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/loadimpact/k6/api/common"
+	"github.com/manyminds/api2go/jsonapi"
+)
+
+// getAgent returns the agent of the remote-control mode, or fails the request if k6 isn't
+// running in it.
+func getAgent(rw http.ResponseWriter, r *http.Request) common.Agent {
+	agent := common.GetAgent(r.Context())
+	if agent == nil {
+		apiError(rw, "Not an agent", "k6 isn't running in the remote-control mode, see `k6 agent`", http.StatusNotFound)
+	}
+	return agent
+}
+
+func writeAgent(rw http.ResponseWriter, agent common.Agent) {
+	data, err := jsonapi.Marshal(NewAgent(agent))
+	if err != nil {
+		apiError(rw, "Encoding error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(data)
+}
+
+// agentError responds with the error of the agent, which is a conflict if the state of the agent
+// doesn't allow what it was told to do.
+func agentError(rw http.ResponseWriter, title string, err error) {
+	status := http.StatusBadRequest
+	if err == common.ErrAgentBusy || err == common.ErrAgentNotReady {
+		status = http.StatusConflict
+	}
+	apiError(rw, title, err.Error(), status)
+}
+
+func HandleGetAgent(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	agent := getAgent(rw, r)
+	if agent == nil {
+		return
+	}
+	writeAgent(rw, agent)
+}
+
+// The largest archive that the agent accepts, in bytes.
+var maxAgentArchiveSize int64 = 256 << 20
+
+// HandleLoadAgentArchive loads the test in the archive in the request body, as written by
+// `k6 archive`.
+func HandleLoadAgentArchive(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	agent := getAgent(rw, r)
+	if agent == nil {
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxAgentArchiveSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		if int64(len(body)) >= maxAgentArchiveSize {
+			status = http.StatusRequestEntityTooLarge
+		}
+		apiError(rw, "Couldn't read request", err.Error(), status)
+		return
+	}
+	if err := agent.Load(body); err != nil {
+		agentError(rw, "Couldn't load the archive", err)
+		return
+	}
+	writeAgent(rw, agent)
+}
+
+func HandleStartAgent(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	agent := getAgent(rw, r)
+	if agent == nil {
+		return
+	}
+	if err := agent.Start(); err != nil {
+		agentError(rw, "Couldn't start the test", err)
+		return
+	}
+	writeAgent(rw, agent)
+}
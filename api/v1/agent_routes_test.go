@@ -0,0 +1,163 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+type fakeAgent struct {
+	state   string
+	engine  *core.Engine
+	err     error
+	archive []byte
+}
+
+func (a *fakeAgent) Load(archive []byte) error {
+	if a.state == common.AgentStateRunning {
+		return common.ErrAgentBusy
+	}
+	if len(archive) == 0 {
+		return errors.New("empty archive")
+	}
+	a.archive = archive
+	a.state = common.AgentStateLoaded
+	return nil
+}
+
+func (a *fakeAgent) Start() error {
+	if a.state != common.AgentStateLoaded {
+		return common.ErrAgentNotReady
+	}
+	a.state = common.AgentStateRunning
+	return nil
+}
+
+func (a *fakeAgent) State() (string, *core.Engine, error) {
+	return a.state, a.engine, a.err
+}
+
+func newRequestWithAgent(agent common.Agent, method, target string, body []byte) *http.Request {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	ctx := common.WithAgent(r.Context(), agent)
+	if _, engine, _ := agent.State(); engine != nil {
+		ctx = common.WithEngine(ctx, engine)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestGetAgent(t *testing.T) {
+	t.Run("not an agent", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, httptest.NewRequest("GET", "/v1/agent", nil))
+		assert.Equal(t, http.StatusNotFound, rw.Result().StatusCode)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		agent := &fakeAgent{state: common.AgentStateFinished, err: errors.New("some thresholds have failed")}
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, "GET", "/v1/agent", nil))
+		require.Equal(t, http.StatusOK, rw.Result().StatusCode)
+
+		var a Agent
+		require.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &a))
+		assert.Equal(t, Agent{
+			State: common.AgentStateFinished,
+			Error: null.StringFrom("some thresholds have failed"),
+		}, a)
+	})
+}
+
+func TestAgentLoadAndStart(t *testing.T) {
+	agent := &fakeAgent{state: common.AgentStateIdle}
+	do := func(method, target string, body []byte) (int, Agent) {
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, method, target, body))
+		var a Agent
+		if rw.Result().StatusCode == http.StatusOK {
+			require.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &a))
+		}
+		return rw.Result().StatusCode, a
+	}
+
+	status, _ := do("POST", "/v1/agent/start", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do("POST", "/v1/agent/archive", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, a := do("POST", "/v1/agent/archive", []byte("archive"))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, common.AgentStateLoaded, a.State)
+	assert.Equal(t, []byte("archive"), agent.archive)
+
+	status, a = do("POST", "/v1/agent/start", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, common.AgentStateRunning, a.State)
+
+	status, _ = do("POST", "/v1/agent/archive", []byte("another"))
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, []byte("archive"), agent.archive)
+}
+
+func TestAgentLoadTooLarge(t *testing.T) {
+	defer func(size int64) { maxAgentArchiveSize = size }(maxAgentArchiveSize)
+	maxAgentArchiveSize = 10
+
+	agent := &fakeAgent{state: common.AgentStateIdle}
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, "POST", "/v1/agent/archive", bytes.Repeat([]byte("a"), 11)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Result().StatusCode)
+	assert.Equal(t, common.AgentStateIdle, agent.state)
+	assert.Nil(t, agent.archive)
+
+	rw = httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, "POST", "/v1/agent/archive", bytes.Repeat([]byte("a"), 10)))
+	assert.Equal(t, http.StatusOK, rw.Result().StatusCode)
+}
+
+func TestAgentEngineRoutes(t *testing.T) {
+	agent := &fakeAgent{state: common.AgentStateIdle}
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, "GET", "/v1/status", nil))
+	assert.Equal(t, http.StatusConflict, rw.Result().StatusCode)
+	body, _ := ioutil.ReadAll(rw.Body)
+	assert.Contains(t, string(body), "the agent wasn't sent a test yet")
+
+	engine, err := core.NewEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	agent.state, agent.engine = common.AgentStateLoaded, engine
+	rw = httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithAgent(agent, "GET", "/v1/status", nil))
+	assert.Equal(t, http.StatusOK, rw.Result().StatusCode)
+}
@@ -0,0 +1,54 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"github.com/loadimpact/k6/lib"
+)
+
+// Host is the live connection and request counts of a target host.
+type Host struct {
+	Host string `json:"-" yaml:"host"`
+
+	OpenConnections  int64 `json:"open-connections" yaml:"open-connections"`
+	InFlightRequests int64 `json:"inflight-requests" yaml:"inflight-requests"`
+	Requests         int64 `json:"requests" yaml:"requests"`
+	Errors           int64 `json:"errors" yaml:"errors"`
+}
+
+func NewHost(s lib.HostStatsSnapshot) Host {
+	return Host{
+		Host:             s.Host,
+		OpenConnections:  s.OpenConnections,
+		InFlightRequests: s.InFlightRequests,
+		Requests:         s.Requests,
+		Errors:           s.Errors,
+	}
+}
+
+func (h Host) GetID() string {
+	return h.Host
+}
+
+func (h *Host) SetID(id string) error {
+	h.Host = id
+	return nil
+}
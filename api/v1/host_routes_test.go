@@ -0,0 +1,88 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hostStatsRunner struct {
+	lib.MiniRunner
+	hostStats *lib.HostStats
+}
+
+func (r hostStatsRunner) GetHostStats() *lib.HostStats {
+	return r.hostStats
+}
+
+func TestGetHosts(t *testing.T) {
+	hostStats := lib.NewHostStats()
+	atomic.AddInt64(&hostStats.Host("example.com:443").OpenConnections, 2)
+	atomic.AddInt64(&hostStats.Host("example.com:443").Requests, 10)
+	atomic.AddInt64(&hostStats.Host("api.example.com:80").Errors, 3)
+
+	engine, err := core.NewEngine(local.New(&hostStatsRunner{hostStats: hostStats}), lib.Options{})
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/hosts", nil))
+	res := rw.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	t.Run("document", func(t *testing.T) {
+		var doc jsonapi.Document
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &doc))
+		if assert.Len(t, doc.Data.DataArray, 2) {
+			assert.Equal(t, "hosts", doc.Data.DataArray[0].Type)
+		}
+	})
+
+	t.Run("hosts", func(t *testing.T) {
+		var hosts []Host
+		assert.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &hosts))
+		assert.Equal(t, []Host{
+			{Host: "api.example.com:80", Errors: 3},
+			{Host: "example.com:443", OpenConnections: 2, Requests: 10},
+		}, hosts)
+	})
+
+	t.Run("no host stats", func(t *testing.T) {
+		engine, err := core.NewEngine(nil, lib.Options{})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/hosts", nil))
+		var hosts []Host
+		assert.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &hosts))
+		assert.Empty(t, hosts)
+	})
+}
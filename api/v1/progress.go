@@ -0,0 +1,76 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Progress is a readonly view of core.Progress.
+type Progress struct {
+	Running bool `json:"running" yaml:"running"`
+	Paused  bool `json:"paused" yaml:"paused"`
+
+	Fraction null.Float         `json:"fraction" yaml:"fraction"`
+	Time     types.Duration     `json:"time" yaml:"time"`
+	EndTime  types.NullDuration `json:"end-time" yaml:"end-time"`
+	ETA      types.NullDuration `json:"eta" yaml:"eta"`
+
+	Iterations          int64    `json:"iterations" yaml:"iterations"`
+	EndIterations       null.Int `json:"end-iterations" yaml:"end-iterations"`
+	IterationsPerSecond float64  `json:"iterations-per-second" yaml:"iterations-per-second"`
+
+	Stage  int   `json:"stage" yaml:"stage"`
+	VUs    int64 `json:"vus" yaml:"vus"`
+	VUsMax int64 `json:"vus-max" yaml:"vus-max"`
+}
+
+func NewProgress(engine *core.Engine) Progress {
+	p := engine.GetProgress()
+	return Progress{
+		Running:             p.Running,
+		Paused:              p.Paused,
+		Fraction:            p.Fraction,
+		Time:                types.Duration(p.Time),
+		EndTime:             p.EndTime,
+		ETA:                 p.ETA,
+		Iterations:          p.Iterations,
+		EndIterations:       p.EndIterations,
+		IterationsPerSecond: p.IterationsPerSecond,
+		Stage:               p.Stage,
+		VUs:                 p.VUs,
+		VUsMax:              p.VUsMax,
+	}
+}
+
+func (p Progress) GetName() string {
+	return "progress"
+}
+
+func (p Progress) GetID() string {
+	return "default"
+}
+
+func (p Progress) SetID(id string) error {
+	return nil
+}
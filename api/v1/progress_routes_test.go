@@ -0,0 +1,67 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProgress(t *testing.T) {
+	engine, err := core.NewEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	engine.Executor.SetEndTime(types.NullDurationFrom(10 * time.Second))
+
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/progress", nil))
+	res := rw.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	t.Run("document", func(t *testing.T) {
+		var doc jsonapi.Document
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &doc))
+		if !assert.NotNil(t, doc.Data.DataObject) {
+			return
+		}
+		assert.Equal(t, "progress", doc.Data.DataObject.Type)
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		var progress Progress
+		assert.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &progress))
+		assert.False(t, progress.Running)
+		assert.True(t, progress.Fraction.Valid)
+		assert.Equal(t, 0.0, progress.Fraction.Float64)
+		assert.Equal(t, types.NullDurationFrom(10*time.Second), progress.EndTime)
+		assert.Equal(t, types.NullDurationFrom(10*time.Second), progress.ETA)
+		assert.Equal(t, -1, progress.Stage)
+	})
+}
@@ -24,25 +24,46 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/loadimpact/k6/api/common"
 )
 
 func NewHandler() http.Handler {
 	router := httprouter.New()
 
-	router.GET("/v1/status", HandleGetStatus)
-	router.PATCH("/v1/status", HandlePatchStatus)
+	router.GET("/v1/status", requireEngine(HandleGetStatus))
+	router.PATCH("/v1/status", requireEngine(HandlePatchStatus))
 
-	router.GET("/v1/metrics", HandleGetMetrics)
-	router.GET("/v1/metrics/:id", HandleGetMetric)
+	router.GET("/v1/progress", requireEngine(HandleGetProgress))
 
-	router.GET("/v1/groups", HandleGetGroups)
-	router.GET("/v1/groups/:id", HandleGetGroup)
+	router.GET("/v1/metrics", requireEngine(HandleGetMetrics))
+	router.GET("/v1/metrics/:id", requireEngine(HandleGetMetric))
 
-	router.POST("/v1/setup", HandleRunSetup)
-	router.PUT("/v1/setup", HandleSetSetupData)
-	router.GET("/v1/setup", HandleGetSetupData)
+	router.GET("/v1/hosts", requireEngine(HandleGetHosts))
 
-	router.POST("/v1/teardown", HandleRunTeardown)
+	router.GET("/v1/groups", requireEngine(HandleGetGroups))
+	router.GET("/v1/groups/:id", requireEngine(HandleGetGroup))
+
+	router.POST("/v1/setup", requireEngine(HandleRunSetup))
+	router.PUT("/v1/setup", requireEngine(HandleSetSetupData))
+	router.GET("/v1/setup", requireEngine(HandleGetSetupData))
+
+	router.POST("/v1/teardown", requireEngine(HandleRunTeardown))
+
+	router.GET("/v1/agent", HandleGetAgent)
+	router.POST("/v1/agent/archive", HandleLoadAgentArchive)
+	router.POST("/v1/agent/start", HandleStartAgent)
 
 	return router
 }
+
+// requireEngine makes the route fail if there's no test to control yet, which can only happen
+// in the remote-control mode.
+func requireEngine(handle httprouter.Handle) httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if common.GetEngine(r.Context()) == nil {
+			apiError(rw, "No test", "the agent wasn't sent a test yet", http.StatusConflict)
+			return
+		}
+		handle(rw, r, p)
+	}
+}
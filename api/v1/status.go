@@ -30,6 +30,9 @@ type Status struct {
 	VUs    null.Int  `json:"vus" yaml:"vus"`
 	VUsMax null.Int  `json:"vus-max" yaml:"vus-max"`
 
+	// Setting this to true aborts the test, though teardown() is still executed.
+	Stopped null.Bool `json:"stopped" yaml:"stopped"`
+
 	// Readonly.
 	Running bool `json:"running" yaml:"running"`
 	Tainted bool `json:"tainted" yaml:"tainted"`
@@ -40,6 +43,7 @@ func NewStatus(engine *core.Engine) Status {
 		Paused:  null.BoolFrom(engine.Executor.IsPaused()),
 		VUs:     null.IntFrom(engine.Executor.GetVUs()),
 		VUsMax:  null.IntFrom(engine.Executor.GetVUsMax()),
+		Stopped: null.BoolFrom(engine.IsStopped()),
 		Running: engine.Executor.IsRunning(),
 		Tainted: engine.IsTainted(),
 	}
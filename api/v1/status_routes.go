@@ -56,6 +56,15 @@ func HandlePatchStatus(rw http.ResponseWriter, r *http.Request, p httprouter.Par
 		return
 	}
 
+	if status.Stopped.Valid {
+		if !status.Stopped.Bool && engine.IsStopped() {
+			apiError(rw, "Couldn't resume", "a stopped test can't be resumed", http.StatusBadRequest)
+			return
+		}
+		if status.Stopped.Bool {
+			engine.Stop()
+		}
+	}
 	if status.VUsMax.Valid {
 		if err := engine.Executor.SetVUsMax(status.VUsMax.Int64); err != nil {
 			apiError(rw, "Couldn't change cap", err.Error(), http.StatusBadRequest)
@@ -58,6 +58,7 @@ func TestGetStatus(t *testing.T) {
 		assert.True(t, status.Paused.Valid)
 		assert.True(t, status.VUs.Valid)
 		assert.True(t, status.VUsMax.Valid)
+		assert.Equal(t, null.BoolFrom(false), status.Stopped)
 		assert.False(t, status.Tainted)
 	})
 }
@@ -72,6 +73,8 @@ func TestPatchStatus(t *testing.T) {
 		"max vus":      {200, Status{VUsMax: null.IntFrom(10)}},
 		"too many vus": {400, Status{VUs: null.IntFrom(10), VUsMax: null.IntFrom(0)}},
 		"vus":          {200, Status{VUs: null.IntFrom(10), VUsMax: null.IntFrom(10)}},
+		"stopped":      {200, Status{Stopped: null.BoolFrom(true)}},
+		"not stopped":  {200, Status{Stopped: null.BoolFrom(false)}},
 	}
 
 	for name, indata := range testdata {
@@ -105,6 +108,21 @@ func TestPatchStatus(t *testing.T) {
 			if indata.Status.VUsMax.Valid {
 				assert.Equal(t, indata.Status.VUsMax, status.VUsMax)
 			}
+			if indata.Status.Stopped.Valid {
+				assert.Equal(t, indata.Status.Stopped, status.Stopped)
+			}
 		})
 	}
+
+	t.Run("resume stopped", func(t *testing.T) {
+		engine, err := core.NewEngine(nil, lib.Options{})
+		assert.NoError(t, err)
+		engine.Stop()
+
+		body, err := jsonapi.Marshal(Status{Stopped: null.BoolFrom(false)})
+		assert.NoError(t, err)
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "PATCH", "/v1/status", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rw.Result().StatusCode)
+	})
 }
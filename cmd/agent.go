@@ -0,0 +1,295 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/loadimpact/k6/api"
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/ui"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// agentCmd represents the agent command.
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Wait for tests to run, sent through the REST API",
+	Long: `Wait for tests to run, sent through the REST API.
+
+This starts k6 idle, with only its REST API, so it can be provisioned ahead of time (e.g. as a
+container) and be sent the tests to run on demand:
+
+  POST /v1/agent/archive  loads the test in the archive in the request body (see k6 archive)
+  POST /v1/agent/start    starts the loaded test
+  GET  /v1/agent          returns whether the agent is idle, loaded, running or finished
+
+While a test runs, the rest of the API controls it, as for k6 run. The options given to this
+command apply to every test, on top of the ones in the archives.
+
+Since whoever can reach the API can run any script, the agent only listens on loopback
+addresses, unless it's given a token with --token or K6_AGENT_TOKEN. Every request then has to
+have it in an "Authorization: Bearer <token>" header.`,
+	Example: `
+  # Wait for tests on all interfaces.
+  K6_AGENT_TOKEN=s3cret k6 agent -a 0.0.0.0:6565 -o influxdb=http://1.2.3.4:8086/k6
+
+  # Send a test to the agent and start it.
+  k6 archive -O test.tar script.js
+  curl -H "Authorization: Bearer s3cret" --data-binary @test.tar http://agent:6565/v1/agent/archive
+  curl -H "Authorization: Bearer s3cret" -X POST http://agent:6565/v1/agent/start`[1:],
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cliConf, err := getConfig(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		runtimeOptions, err := getRuntimeOptions(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		token, err := cmd.Flags().GetString("token")
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			token = os.Getenv("K6_AGENT_TOKEN")
+		}
+		if token == "" && !isLoopbackAddress(address) {
+			return errors.Errorf(
+				"the agent would accept tests from anyone that can reach %s, give it a --token or listen on a loopback address",
+				address)
+		}
+		agent := newAgent(afero.NewOsFs(), cliConf, runtimeOptions)
+
+		errC := make(chan error, 1)
+		go func() { errC <- api.ListenAndServeAgent(address, agent, token) }()
+		log.WithField("address", address).Info("Waiting for tests")
+
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigC)
+
+		select {
+		case err := <-errC:
+			return err
+		case sig := <-sigC:
+			log.WithField("sig", sig).Debug("Exiting in response to signal")
+			agent.stop()
+			return nil
+		}
+	},
+}
+
+// isLoopbackAddress returns whether the host of the address is localhost or a loopback IP.
+// An empty host, which is every interface, isn't.
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// agent runs the tests that it's sent through the API, one at a time, see agentCmd.
+type agent struct {
+	fs      afero.Fs
+	cliConf Config
+	rtOpts  lib.RuntimeOptions
+
+	mu     sync.Mutex
+	state  string
+	engine *core.Engine
+	conf   Config
+	err    error
+	done   chan struct{} // Closed when the running test is over
+}
+
+var _ common.Agent = &agent{}
+
+func newAgent(fs afero.Fs, cliConf Config, rtOpts lib.RuntimeOptions) *agent {
+	return &agent{fs: fs, cliConf: cliConf, rtOpts: rtOpts, state: common.AgentStateIdle}
+}
+
+// Load prepares the test in the archive the same way `k6 run` does, with the options of the
+// agent on top of the ones in the archive.
+func (a *agent) Load(data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == common.AgentStateRunning {
+		return common.ErrAgentBusy
+	}
+	if a.state == common.AgentStateLoaded {
+		// The outputs of the test that was loaded but never started are still open.
+		discardCollectors(a.engine.Collectors)
+		a.state, a.engine = common.AgentStateIdle, nil
+		log.Info("Test unloaded")
+	}
+
+	src := &lib.SourceData{Filename: "archive.tar", Data: data}
+	r, err := newRunner(src, typeArchive, a.fs, a.rtOpts)
+	if err != nil {
+		return err
+	}
+	conf, err := getConsolidatedConfig(a.fs, a.cliConf, r)
+	if err != nil {
+		return err
+	}
+	conf = finalizeRunConfig(conf)
+	if err := validateConfig(conf); err != nil {
+		return err
+	}
+	conf.Options = conf.Options.WithInstanceTags()
+	if err := r.SetOptions(conf.Options); err != nil {
+		return err
+	}
+
+	executorName := lib.DefaultExecutorName
+	if conf.Executor.String != "" {
+		executorName = conf.Executor.String
+	}
+	ex, err := lib.NewExecutor(executorName, r)
+	if err != nil {
+		return err
+	}
+	engine, err := core.NewEngine(ex, conf.Options)
+	if err != nil {
+		return err
+	}
+	engine.NoThresholds = conf.NoThresholds.Bool
+	engine.NoSummary = conf.NoSummary.Bool
+	if err := addCollectors(engine, conf, src); err != nil {
+		return err
+	}
+
+	a.state, a.engine, a.conf, a.err = common.AgentStateLoaded, engine, conf, nil
+	log.Info("Test loaded")
+	return nil
+}
+
+// discardCollectors shuts down the outputs of a test that was never run, so they close their
+// files and connections, like they do at the end of a test.
+func discardCollectors(collectors []lib.Collector) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range collectors {
+		c.Run(ctx)
+	}
+}
+
+// Start runs the loaded test in the background, and prints its summary once it's over.
+func (a *agent) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == common.AgentStateRunning {
+		return common.ErrAgentBusy
+	}
+	if a.state != common.AgentStateLoaded {
+		return common.ErrAgentNotReady
+	}
+
+	engine, conf := a.engine, a.conf
+	a.state = common.AgentStateRunning
+	a.done = make(chan struct{})
+	go func() {
+		log.Info("Test started")
+		err := engine.Run(context.Background())
+		if err == nil && engine.IsTainted() {
+			err = errors.New("some thresholds have failed")
+		}
+		if !conf.NoSummary.Bool {
+			if len(conf.SummaryTrendStats) > 0 {
+				ui.UpdateTrendColumns(conf.SummaryTrendStats)
+			}
+			fprintf(stdout, "\n")
+			ui.Summarize(stdout, "", ui.SummaryData{
+				Opts:    conf.Options,
+				Root:    engine.Executor.GetRunner().GetDefaultGroup(),
+				Metrics: engine.Metrics,
+				Time:    engine.Executor.GetTime(),
+			})
+			fprintf(stdout, "\n")
+		}
+		if err != nil {
+			log.WithError(err).Warn("Test finished")
+		} else {
+			log.Info("Test finished")
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.state, a.err = common.AgentStateFinished, err
+		close(a.done)
+	}()
+	return nil
+}
+
+// State returns the state of the agent, the engine of its current test, and the error of the
+// last finished one.
+func (a *agent) State() (string, *core.Engine, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state, a.engine, a.err
+}
+
+// stop stops the running test, if there is one, and waits for it to be over.
+func (a *agent) stop() {
+	a.mu.Lock()
+	state, engine, done := a.state, a.engine, a.done
+	a.mu.Unlock()
+	if state != common.AgentStateRunning {
+		return
+	}
+	engine.Stop()
+	<-done
+}
+
+func agentCmdFlagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.SortFlags = false
+	flags.AddFlagSet(optionFlagSet())
+	flags.AddFlagSet(runtimeOptionFlagSet(false))
+	flags.AddFlagSet(configFlagSet())
+	flags.String("token", "", "require this bearer `token` in the requests to the API, defaults to K6_AGENT_TOKEN")
+	return flags
+}
+
+func init() {
+	RootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().SortFlags = false
+	agentCmd.Flags().AddFlagSet(agentCmdFlagSet())
+}
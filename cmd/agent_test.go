@@ -0,0 +1,162 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats/dummy"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func newTestArchive(t *testing.T, script string) []byte {
+	fs := afero.NewMemMapFs()
+	src := &lib.SourceData{Filename: "/script.js", Data: []byte(script)}
+	r, err := js.New(src, fs, lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.MakeArchive().Write(&buf))
+	return buf.Bytes()
+}
+
+func waitForAgent(t *testing.T, a *agent) {
+	select {
+	case <-a.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test didn't finish")
+	}
+}
+
+func TestAgent(t *testing.T) {
+	cliConf, err := getConfig(agentCmdFlagSet())
+	require.NoError(t, err)
+	cliConf.NoSummary = null.BoolFrom(true)
+	a := newAgent(afero.NewMemMapFs(), cliConf, lib.RuntimeOptions{})
+	state, engine, err := a.State()
+	assert.Equal(t, common.AgentStateIdle, state)
+	assert.Nil(t, engine)
+	assert.NoError(t, err)
+	assert.Equal(t, common.ErrAgentNotReady, a.Start())
+
+	assert.Error(t, a.Load([]byte("not an archive")))
+	state, _, _ = a.State()
+	assert.Equal(t, common.AgentStateIdle, state)
+
+	require.NoError(t, a.Load(newTestArchive(t, `
+		export let options = { iterations: 2, thresholds: { iterations: ["count>10"] } };
+		export default function() {};
+	`)))
+	state, engine, _ = a.State()
+	assert.Equal(t, common.AgentStateLoaded, state)
+	require.NotNil(t, engine)
+	assert.Equal(t, null.IntFrom(2), engine.Options.Iterations)
+
+	require.NoError(t, a.Start())
+	waitForAgent(t, a)
+	state, _, err = a.State()
+	assert.Equal(t, common.AgentStateFinished, state)
+	assert.EqualError(t, err, "some thresholds have failed")
+	assert.Equal(t, common.ErrAgentNotReady, a.Start())
+
+	t.Run("another test", func(t *testing.T) {
+		require.NoError(t, a.Load(newTestArchive(t, `
+			export let options = { iterations: 1 };
+			export default function() {};
+		`)))
+		state, _, err := a.State()
+		assert.Equal(t, common.AgentStateLoaded, state)
+		assert.NoError(t, err)
+
+		require.NoError(t, a.Start())
+		waitForAgent(t, a)
+		state, _, err = a.State()
+		assert.Equal(t, common.AgentStateFinished, state)
+		assert.NoError(t, err)
+	})
+}
+
+// A collector that records whether it was shut down.
+type shutdownCollector struct {
+	dummy.Collector
+	shutDown bool
+}
+
+func (c *shutdownCollector) Run(ctx context.Context) {
+	<-ctx.Done()
+	c.shutDown = true
+}
+
+func TestAgentReload(t *testing.T) {
+	cliConf, err := getConfig(agentCmdFlagSet())
+	require.NoError(t, err)
+	cliConf.NoSummary = null.BoolFrom(true)
+	a := newAgent(afero.NewMemMapFs(), cliConf, lib.RuntimeOptions{})
+	archive := newTestArchive(t, `export default function() {};`)
+
+	require.NoError(t, a.Load(archive))
+	_, first, _ := a.State()
+	collector := &shutdownCollector{}
+	first.Collectors = append(first.Collectors, collector)
+
+	require.NoError(t, a.Load(archive))
+	state, second, _ := a.State()
+	assert.Equal(t, common.AgentStateLoaded, state)
+	assert.True(t, first != second)
+	assert.True(t, collector.shutDown)
+
+	t.Run("failed", func(t *testing.T) {
+		collector := &shutdownCollector{}
+		second.Collectors = append(second.Collectors, collector)
+		assert.Error(t, a.Load([]byte("not an archive")))
+		state, engine, _ := a.State()
+		assert.Equal(t, common.AgentStateIdle, state)
+		assert.Nil(t, engine)
+		assert.True(t, collector.shutDown)
+	})
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	testdata := map[string]bool{
+		"localhost:6565": true,
+		"127.0.0.1:6565": true,
+		"127.1.2.3:6565": true,
+		"[::1]:6565":     true,
+		"0.0.0.0:6565":   false,
+		":6565":          false,
+		"10.0.0.1:6565":  false,
+		"[::]:6565":      false,
+		"example.com:80": false,
+		"localhost":      false,
+	}
+	for addr, loopback := range testdata {
+		assert.Equal(t, loopback, isLoopbackAddress(addr), addr)
+	}
+}
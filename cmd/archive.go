@@ -91,7 +91,7 @@ An archive is a fully self-contained test run, and can be executed identically e
 		if err != nil {
 			return err
 		}
-		return arc.Write(f)
+		return arc.WriteEncrypted(f, runtimeOptions.ArchiveKey)
 	},
 }
 
@@ -30,6 +30,7 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats/cloud"
 	"github.com/loadimpact/k6/stats/datadog"
+	"github.com/loadimpact/k6/stats/heatmap"
 	"github.com/loadimpact/k6/stats/influxdb"
 	jsonc "github.com/loadimpact/k6/stats/json"
 	"github.com/loadimpact/k6/stats/kafka"
@@ -46,6 +47,7 @@ const (
 	collectorCloud    = "cloud"
 	collectorStatsD   = "statsd"
 	collectorDatadog  = "datadog"
+	collectorHeatmap  = "heatmap"
 )
 
 func parseCollector(s string) (t, arg string) {
@@ -110,6 +112,12 @@ func newCollector(collectorName, arg string, src *lib.SourceData, conf Config) (
 				return nil, err
 			}
 			return datadog.New(config)
+		case collectorHeatmap:
+			config := heatmap.NewConfig().Apply(conf.Collectors.Heatmap)
+			if err := envconfig.Process("k6", &config); err != nil {
+				return nil, err
+			}
+			return heatmap.New(afero.NewOsFs(), arg, config)
 		default:
 			return nil, errors.Errorf("unknown output type: %s", collectorName)
 		}
@@ -23,20 +23,28 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"errors"
 
+	"github.com/ghodss/yaml"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/scheduler"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/cloud"
 	"github.com/loadimpact/k6/stats/datadog"
+	"github.com/loadimpact/k6/stats/heatmap"
 	"github.com/loadimpact/k6/stats/influxdb"
 	"github.com/loadimpact/k6/stats/kafka"
 	"github.com/loadimpact/k6/stats/statsd/common"
+	"github.com/loadimpact/k6/ui"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
@@ -52,6 +60,8 @@ func configFlagSet() *pflag.FlagSet {
 	flags.Bool("no-usage-report", false, "don't send anonymous stats to the developers")
 	flags.Bool("no-thresholds", false, "don't run thresholds")
 	flags.Bool("no-summary", false, "don't show the summary at the end of the test")
+	flags.Int64("live-top-n", 0, "show a live panel with the `N` slowest and most failing requests during the test")
+	flags.String("endpoints-export", "", "write the requests, error rate and latency percentiles per request name to this `file` at the end of the test, as CSV if it ends with .csv and as JSON otherwise")
 	return flags
 }
 
@@ -63,6 +73,9 @@ type Config struct {
 	NoUsageReport null.Bool `json:"noUsageReport" envconfig:"no_usage_report"`
 	NoThresholds  null.Bool `json:"noThresholds" envconfig:"no_thresholds"`
 	NoSummary     null.Bool `json:"noSummary" envconfig:"no_summary"`
+	LiveTopN      null.Int  `json:"liveTopN" envconfig:"live_top_n"`
+
+	EndpointsExport null.String `json:"endpointsExport" envconfig:"endpoints_export"`
 
 	Collectors struct {
 		InfluxDB influxdb.Config `json:"influxdb"`
@@ -70,6 +83,7 @@ type Config struct {
 		Cloud    cloud.Config    `json:"cloud"`
 		StatsD   common.Config   `json:"statsd"`
 		Datadog  datadog.Config  `json:"datadog"`
+		Heatmap  heatmap.Config  `json:"heatmap"`
 	} `json:"collectors"`
 }
 
@@ -90,11 +104,18 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.NoSummary.Valid {
 		c.NoSummary = cfg.NoSummary
 	}
+	if cfg.LiveTopN.Valid {
+		c.LiveTopN = cfg.LiveTopN
+	}
+	if cfg.EndpointsExport.Valid {
+		c.EndpointsExport = cfg.EndpointsExport
+	}
 	c.Collectors.InfluxDB = c.Collectors.InfluxDB.Apply(cfg.Collectors.InfluxDB)
 	c.Collectors.Cloud = c.Collectors.Cloud.Apply(cfg.Collectors.Cloud)
 	c.Collectors.Kafka = c.Collectors.Kafka.Apply(cfg.Collectors.Kafka)
 	c.Collectors.StatsD = c.Collectors.StatsD.Apply(cfg.Collectors.StatsD)
 	c.Collectors.Datadog = c.Collectors.Datadog.Apply(cfg.Collectors.Datadog)
+	c.Collectors.Heatmap = c.Collectors.Heatmap.Apply(cfg.Collectors.Heatmap)
 	return c
 }
 
@@ -115,6 +136,9 @@ func getConfig(flags *pflag.FlagSet) (Config, error) {
 		NoUsageReport: getNullBool(flags, "no-usage-report"),
 		NoThresholds:  getNullBool(flags, "no-thresholds"),
 		NoSummary:     getNullBool(flags, "no-summary"),
+		LiveTopN:      getNullInt64(flags, "live-top-n"),
+
+		EndpointsExport: getNullString(flags, "endpoints-export"),
 	}, nil
 }
 
@@ -145,18 +169,46 @@ func readDiskConfig(fs afero.Fs) (Config, string, error) {
 	if err != nil {
 		return Config{}, realConfigFilePath, err
 	}
+	if data, err = configFileToJSON(realConfigFilePath, data); err != nil {
+		return Config{}, realConfigFilePath, err
+	}
 	var conf Config
 	err = json.Unmarshal(data, &conf)
 	return conf, realConfigFilePath, err
 }
 
-// Serializes the configuration to a JSON file and writes it in the supplied
-// location on the supplied filesystem
+// Converts the contents of a config file to JSON, based on the file extension: .yaml and .yml
+// files are parsed as YAML and everything else as JSON. Since YAML is converted to JSON first,
+// both config formats use the same (JSON) option names.
+func configFileToJSON(path string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.YAMLToJSON(data)
+	case ".toml":
+		return nil, errTOMLConfig
+	default:
+		return data, nil
+	}
+}
+
+// TOML config files are rejected, instead of failing with a confusing JSON syntax error
+var errTOMLConfig = errors.New("TOML config files aren't supported, please use a JSON or YAML config file")
+
+// Serializes the configuration to a JSON (or YAML, depending on the file extension) file and
+// writes it in the supplied location on the supplied filesystem
 func writeDiskConfig(fs afero.Fs, configPath string, conf Config) error {
 	data, err := json.MarshalIndent(conf, "", "  ")
 	if err != nil {
 		return err
 	}
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+	case ".toml":
+		return errTOMLConfig
+	}
 
 	if err := fs.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
@@ -173,12 +225,117 @@ func readEnvConfig() (conf Config, err error) {
 		envconfig.Process("k6", &conf.Collectors.Cloud),
 		envconfig.Process("k6", &conf.Collectors.InfluxDB),
 		envconfig.Process("k6", &conf.Collectors.Kafka),
+		envconfig.Process("k6_statsd", &conf.Collectors.StatsD),
+		envconfig.Process("k6_datadog", &conf.Collectors.Datadog),
+		envconfig.Process("k6", &conf.Collectors.Heatmap),
 	} {
-		return conf, err
+		if err != nil {
+			return conf, err
+		}
+	}
+	for name, decode := range envOptionDecoders {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := decode(value, &conf.Options); err != nil {
+			return conf, fmt.Errorf("%s: %s", name, err)
+		}
 	}
 	return conf, nil
 }
 
+// The options that envconfig can't decode, and thus ignores, are read from these environment
+// variables instead. Values that are lists in JSON are comma-separated, except for the TLS
+// client certificates and the thresholds, which are only accepted as JSON, and the hosts, which
+// can be either.
+var envOptionDecoders = map[string]func(value string, opts *lib.Options) error{
+	"K6_TLS_CIPHER_SUITES": func(value string, opts *lib.Options) error {
+		data, err := json.Marshal(strings.Split(value, ","))
+		if err != nil {
+			return err
+		}
+		opts.TLSCipherSuites = &lib.TLSCipherSuites{}
+		return opts.TLSCipherSuites.UnmarshalJSON(data)
+	},
+	"K6_TLS_VERSION": func(value string, opts *lib.Options) error {
+		// Either a single version like "tls1.2", or a JSON object with min and max versions
+		data := []byte(value)
+		if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+			data, _ = json.Marshal(value)
+		}
+		opts.TLSVersion = &lib.TLSVersions{}
+		return opts.TLSVersion.UnmarshalJSON(data)
+	},
+	"K6_TLSAUTH": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.TLSAuth)
+	},
+	"K6_TLS_CA_CERTS": func(value string, opts *lib.Options) error {
+		// Either comma-separated paths to PEM files or JSON, like in the tlsCACerts option
+		if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			opts.TLSCACerts = &lib.TLSCACerts{}
+			return opts.TLSCACerts.UnmarshalJSON([]byte(value))
+		}
+		var err error
+		opts.TLSCACerts, err = lib.NewTLSCACerts(strings.Split(value, ","), true)
+		return err
+	},
+	"K6_TLS_HOSTS": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.TLSHosts)
+	},
+	"K6_HEALTH_CHECK": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.HealthCheck)
+	},
+	"K6_CONNECTION_POOLS": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.ConnectionPools)
+	},
+	"K6_RELABEL": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.Relabel)
+	},
+	"K6_THRESHOLDS": func(value string, opts *lib.Options) error {
+		return json.Unmarshal([]byte(value), &opts.Thresholds)
+	},
+	"K6_BLACKLIST_IPS": func(value string, opts *lib.Options) error {
+		opts.BlacklistIPs = []*net.IPNet{}
+		for _, s := range strings.Split(value, ",") {
+			_, ipnet, err := net.ParseCIDR(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			opts.BlacklistIPs = append(opts.BlacklistIPs, ipnet)
+		}
+		return nil
+	},
+	"K6_HOSTS": func(value string, opts *lib.Options) error {
+		// Either a JSON object, or `host=address` pairs, where a host can be repeated
+		if strings.HasPrefix(strings.TrimSpace(value), "{") {
+			return json.Unmarshal([]byte(value), &opts.Hosts)
+		}
+		opts.Hosts = make(map[string]types.HostAddresses)
+		for _, s := range strings.Split(value, ",") {
+			host, address := parseEnvKeyValue(strings.TrimSpace(s))
+			addr, err := types.ParseHostAddress(address)
+			if err != nil {
+				return err
+			}
+			opts.Hosts[host] = append(opts.Hosts[host], addr)
+		}
+		return nil
+	},
+	"K6_TAGS": func(value string, opts *lib.Options) error {
+		tags := make(map[string]string)
+		for _, s := range strings.Split(value, ",") {
+			name, value, err := parseTagNameValue(s)
+			if err != nil {
+				return err
+			}
+			tags[name] = value
+		}
+		opts.RunTags = stats.IntoSampleTags(&tags)
+		return nil
+	},
+}
+
 type executionConflictConfigError string
 
 func (e executionConflictConfigError) Error() string {
@@ -252,7 +409,8 @@ func buildExecutionConfig(conf Config) (Config, error) {
 	default:
 		if conf.Execution != nil { // If someone set this, regardless if its empty
 			//TODO: remove this warning in the next version
-			log.Warnf("The execution settings are not functional in this k6 release, they will be ignored")
+			log.Warnf("The execution settings are not fully functional in this k6 release, only the exec, env, "+
+				"rps and startTime settings of the \"%s\" scenario are used", lib.DefaultSchedulerName)
 		}
 
 		if len(conf.Execution) == 0 { // If unset or set to empty
@@ -275,7 +433,7 @@ func buildExecutionConfig(conf Config) (Config, error) {
 
 // Assemble the final consolidated configuration from all of the different sources:
 // - start with the CLI-provided options to get shadowed (non-Valid) defaults in there
-// - add the global file config options
+// - add the global file config options (JSON or YAML, see configFileToJSON())
 // - if supplied, add the Runner-provided options
 // - add the environment variables
 // - merge the user-supplied CLI flags back in on top, to give them the greatest priority
@@ -305,10 +463,36 @@ func getConsolidatedConfig(fs afero.Fs, cliConf Config, runner lib.Runner) (conf
 	return buildExecutionConfig(conf)
 }
 
-//TODO: remove ↓
-//nolint:unparam
+// validateConfig checks the whole consolidated configuration and returns all of the problems
+// with it at once, so they can be fixed in one go. Thresholds for metrics that look like typos
+// of built-in metrics are only warned about, since they could be custom metrics.
 func validateConfig(conf Config) error {
 	errList := conf.Validate()
+	// The trend stats are validated here, since the parsing of the stats is in the ui package
+	for _, stat := range conf.SummaryTrendStats {
+		if err := ui.VerifyTrendColumnStat(stat); err != nil {
+			errList = append(errList, fmt.Errorf("summary trend stat '%s': %s", stat, err))
+		}
+	}
+
+	thresholdNames := make([]string, 0, len(conf.Thresholds))
+	for name := range conf.Thresholds {
+		thresholdNames = append(thresholdNames, name)
+	}
+	sort.Strings(thresholdNames)
+	for _, name := range thresholdNames {
+		metricName := strings.TrimSpace(strings.SplitN(name, "{", 2)[0])
+		if _, _, err := stats.NewSubmetric(name); err != nil {
+			errList = append(errList, fmt.Errorf("threshold '%s': %s", name, err))
+		}
+		if suggestion := metrics.SuggestBuiltin(metricName); suggestion != "" {
+			log.Warnf(
+				"There's a threshold for the '%s' metric, which isn't a built-in metric, did you mean '%s'?",
+				metricName, suggestion,
+			)
+		}
+	}
+
 	if len(errList) == 0 {
 		return nil
 	}
@@ -317,9 +501,5 @@ func validateConfig(conf Config) error {
 	for _, err := range errList {
 		errMsgParts = append(errMsgParts, fmt.Sprintf("\t- %s", err.Error()))
 	}
-	errMsg := errors.New(strings.Join(errMsgParts, "\n"))
-
-	//TODO: actually return the error here instead of warning, so k6 aborts on config validation errors
-	log.Warn(errMsg)
-	return nil
+	return errors.New(strings.Join(errMsgParts, "\n"))
 }
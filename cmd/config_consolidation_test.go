@@ -300,6 +300,27 @@ func getConfigConsolidationTestCases() []configConsolidationTestCase {
 		{opts{fs: defaultConfig(`{"iterations": 77, "vus": 7}`)}, exp{}, verifySharedIters(I(7), I(77))},
 		{opts{fs: defaultConfig(`wrong-json`)}, exp{consolidationError: true}, nil},
 		{opts{fs: getFS(nil), cli: []string{"--config", "/my/config.file"}}, exp{consolidationError: true}, nil},
+		// Test if YAML configs work as expected, and TOML ones are rejected
+		{
+			opts{
+				fs:  getFS([]file{{"/my/config.yaml", "vus: 9\nduration: 3m\n"}}),
+				cli: []string{"--config", "/my/config.yaml"},
+			}, exp{}, verifyConstLoopingVUs(I(9), 180*time.Second),
+		},
+		{
+			opts{
+				fs:  getFS([]file{{"/my/config.toml", "vus = 4\niterations = 44\n"}}),
+				cli: []string{"--config", "/my/config.toml"},
+			}, exp{consolidationError: true}, nil,
+		},
+		{
+			opts{
+				fs:  getFS([]file{{"/my/config.yml", "stages:\n  - {duration: 20s, target: 20}\nvus: 10\n"}}),
+				env: []string{"K6_DURATION=15s"},
+				cli: []string{"--config", "/my/config.yml", "--stage", ""},
+			},
+			exp{}, verifyConstLoopingVUs(I(10), 15*time.Second),
+		},
 
 		// Test combinations between options and levels
 		{
@@ -21,11 +21,19 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -115,6 +123,174 @@ func TestConfigEnv(t *testing.T) {
 	}
 }
 
+func TestConfigEnvOptions(t *testing.T) {
+	testdata := map[string]map[string]func(t *testing.T, c Config){
+		"K6_TLS_CIPHER_SUITES": {
+			"TLS_RSA_WITH_RC4_128_SHA,TLS_RSA_WITH_AES_128_GCM_SHA256": func(t *testing.T, c Config) {
+				assert.Equal(t, &lib.TLSCipherSuites{
+					tls.TLS_RSA_WITH_RC4_128_SHA, tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+				}, c.TLSCipherSuites)
+			},
+		},
+		"K6_TLS_VERSION": {
+			"tls1.2": func(t *testing.T, c Config) {
+				assert.Equal(t, &lib.TLSVersions{Min: tls.VersionTLS12, Max: tls.VersionTLS12}, c.TLSVersion)
+			},
+			`{"min": "tls1.1", "max": "tls1.2"}`: func(t *testing.T, c Config) {
+				assert.Equal(t, &lib.TLSVersions{Min: tls.VersionTLS11, Max: tls.VersionTLS12}, c.TLSVersion)
+			},
+		},
+		"K6_TLS_CA_CERTS": {
+			`{"certs": [], "system": false}`: func(t *testing.T, c Config) {
+				require.NotNil(t, c.TLSCACerts)
+				assert.Empty(t, c.TLSCACerts.Certs)
+				assert.Equal(t, null.BoolFrom(false), c.TLSCACerts.System)
+			},
+		},
+		"K6_TLS_HOSTS": {
+			`[{"domains": ["*.example.com"], "tlsVersion": "tls1.0"}]`: func(t *testing.T, c Config) {
+				require.Len(t, c.TLSHosts, 1)
+				assert.Equal(t, []string{"*.example.com"}, c.TLSHosts[0].Domains)
+				assert.Equal(t, &lib.TLSVersions{Min: tls.VersionTLS10, Max: tls.VersionTLS10}, c.TLSHosts[0].TLSVersion)
+				assert.Nil(t, c.TLSHosts[0].TLSCipherSuites)
+			},
+		},
+		"K6_HEALTH_CHECK": {
+			`{"urls": ["http://localhost:8080/ready"], "timeout": "2m"}`: func(t *testing.T, c Config) {
+				assert.Equal(t, []string{"http://localhost:8080/ready"}, c.HealthCheck.URLs)
+				assert.Equal(t, 2*time.Minute, c.HealthCheck.GetTimeout())
+				assert.True(t, c.HealthCheck.Valid)
+			},
+		},
+		"K6_CONNECTION_POOLS": {
+			`{"direct": {"proxy": "", "noConnectionReuse": true}}`: func(t *testing.T, c Config) {
+				require.Contains(t, c.ConnectionPools, "direct")
+				assert.Equal(t, null.StringFrom(""), c.ConnectionPools["direct"].Proxy)
+				assert.Equal(t, null.BoolFrom(true), c.ConnectionPools["direct"].NoConnectionReuse)
+			},
+		},
+		"K6_RELABEL": {
+			`{"statsd": [{"action": "drop", "tag": "url"}]}`: func(t *testing.T, c Config) {
+				assert.Equal(t, []stats.RelabelRule{{Action: "drop", Tag: "url"}}, c.Relabel["statsd"])
+			},
+		},
+		"K6_THRESHOLDS": {
+			`{"http_req_duration": ["p(95)<500"]}`: func(t *testing.T, c Config) {
+				require.Contains(t, c.Thresholds, "http_req_duration")
+				assert.Len(t, c.Thresholds["http_req_duration"].Thresholds, 1)
+			},
+		},
+		"K6_BLACKLIST_IPS": {
+			"10.0.0.0/8, 192.168.0.0/16": func(t *testing.T, c Config) {
+				require.Len(t, c.BlacklistIPs, 2)
+				assert.Equal(t, "10.0.0.0/8", c.BlacklistIPs[0].String())
+				assert.Equal(t, "192.168.0.0/16", c.BlacklistIPs[1].String())
+			},
+		},
+		"K6_TAGS": {
+			"env=staging,team=qa": func(t *testing.T, c Config) {
+				assert.Equal(t, map[string]string{"env": "staging", "team": "qa"}, c.RunTags.CloneTags())
+			},
+		},
+		"K6_HOSTS": {
+			"a.example.com=10.0.0.1, b.example.com=10.0.0.2:8080,b.example.com=10.0.0.3": func(t *testing.T, c Config) {
+				assert.Equal(t, map[string]types.HostAddresses{
+					"a.example.com": {{IP: net.ParseIP("10.0.0.1")}},
+					"b.example.com": {{IP: net.ParseIP("10.0.0.2"), Port: 8080}, {IP: net.ParseIP("10.0.0.3")}},
+				}, c.Hosts)
+			},
+			`{"a.example.com": ["10.0.0.1", "10.0.0.2:81"]}`: func(t *testing.T, c Config) {
+				assert.Equal(t, map[string]types.HostAddresses{
+					"a.example.com": {{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("10.0.0.2"), Port: 81}},
+				}, c.Hosts)
+			},
+		},
+		"K6_LOCAL_IPS": {
+			"10.0.0.1-10.0.0.3,192.168.0.0/30": func(t *testing.T, c Config) {
+				assert.Equal(t, "10.0.0.1-10.0.0.3,192.168.0.0-192.168.0.3", c.LocalIPs.String())
+			},
+		},
+		"K6_DNS": {
+			"ttl=inf,policy=onlyIPv4": func(t *testing.T, c Config) {
+				assert.Equal(t, types.DNSConfig{
+					TTL:    null.StringFrom("inf"),
+					Policy: null.StringFrom(types.DNSOnlyIPv4),
+					Valid:  true,
+				}, c.DNS)
+			},
+		},
+		"K6_CHAOS": {
+			"fail=1%,delayBy=2s": func(t *testing.T, c Config) {
+				assert.Equal(t, types.ChaosConfig{
+					Fail:    null.FloatFrom(0.01),
+					DelayBy: types.NullDurationFrom(2 * time.Second),
+					Valid:   true,
+				}, c.Chaos)
+			},
+		},
+		"K6_SYSTEM_TAGS": {
+			"-url,+ip": func(t *testing.T, c Config) {
+				assert.False(t, c.SystemTags["url"])
+				assert.True(t, c.SystemTags["ip"])
+				assert.True(t, c.SystemTags["status"])
+			},
+		},
+		"K6_STATSD_NAMESPACE": {
+			"k6test.": func(t *testing.T, c Config) {
+				assert.Equal(t, null.StringFrom("k6test."), c.Collectors.StatsD.Namespace)
+			},
+		},
+		"K6_DATADOG_TAG_BLACKLIST": {
+			"vu,iter": func(t *testing.T, c Config) {
+				assert.Equal(t, lib.GetTagSet("vu", "iter"), c.Collectors.Datadog.TagBlacklist)
+			},
+		},
+	}
+	defer os.Clearenv()
+	for key, data := range testdata {
+		for value, fn := range data {
+			key, value, fn := key, value, fn
+			t.Run(key+"="+value, func(t *testing.T) {
+				os.Clearenv()
+				require.NoError(t, os.Setenv(key, value))
+				conf, err := readEnvConfig()
+				require.NoError(t, err)
+				fn(t, conf)
+			})
+		}
+	}
+
+	t.Run("Unset", func(t *testing.T) {
+		os.Clearenv()
+		conf, err := readEnvConfig()
+		require.NoError(t, err)
+		assert.Nil(t, conf.TLSVersion)
+		assert.Nil(t, conf.Thresholds)
+		assert.Nil(t, conf.RunTags)
+	})
+
+	for key, value := range map[string]string{
+		"K6_TLS_CIPHER_SUITES": "TLS_NOPE",
+		"K6_TLS_VERSION":       "tls0.1",
+		"K6_TLSAUTH":           `[{"domains": ["example.com"], "cert": "not a cert", "key": "k"}]`,
+		"K6_TLS_CA_CERTS":      "/nonexistent/ca.pem,/other/ca.pem",
+		"K6_TLS_HOSTS":         `[{"domains": ["example.com"], "tlsCipherSuites": ["TLS_NOPE"]}]`,
+		"K6_THRESHOLDS":        "http_req_duration:p(95)<500",
+		"K6_BLACKLIST_IPS":     "10.0.0.1",
+		"K6_TAGS":              "env",
+		"K6_HOSTS":             "a.example.com=example.com",
+		"K6_LOCAL_IPS":         "10.0.0.5-10.0.0.1",
+	} {
+		key, value := key, value
+		t.Run("Invalid "+key, func(t *testing.T) {
+			os.Clearenv()
+			require.NoError(t, os.Setenv(key, value))
+			_, err := readEnvConfig()
+			assert.Error(t, err)
+		})
+	}
+}
+
 func TestConfigApply(t *testing.T) {
 	t.Run("Linger", func(t *testing.T) {
 		conf := Config{}.Apply(Config{Linger: null.BoolFrom(true)})
@@ -132,3 +308,50 @@ func TestConfigApply(t *testing.T) {
 		assert.Equal(t, []string{"influxdb", "json"}, conf.Out)
 	})
 }
+
+func TestDiskConfigFormats(t *testing.T) {
+	defer func() { configFilePath = "" }()
+	conf := Config{Options: lib.Options{VUs: null.IntFrom(3)}, Out: []string{"json"}}
+
+	t.Run("YAML", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, writeDiskConfig(fs, "/k6.yaml", conf))
+		data, err := afero.ReadFile(fs, "/k6.yaml")
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "vus: 3\n")
+
+		configFilePath = "/k6.yaml"
+		readConf, _, err := readDiskConfig(fs)
+		require.NoError(t, err)
+		assert.Equal(t, conf.VUs, readConf.VUs)
+		assert.Equal(t, conf.Out, readConf.Out)
+	})
+	t.Run("TOML", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		assert.Equal(t, errTOMLConfig, writeDiskConfig(fs, "/k6.toml", conf))
+
+		require.NoError(t, afero.WriteFile(fs, "/k6.toml", []byte("vus = 3\nout = [\"json\"]\n"), 0644))
+		configFilePath = "/k6.toml"
+		_, _, err := readDiskConfig(fs)
+		assert.Equal(t, errTOMLConfig, err)
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	conf, err := getConsolidatedConfig(afero.NewMemMapFs(), Config{}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, validateConfig(conf))
+
+	conf.VUs = null.IntFrom(10)
+	conf.VUsMax = null.IntFrom(5)
+	conf.SetupTimeout = types.NullDurationFrom(-time.Second)
+	conf.SummaryTrendStats = []string{"avg", "p90"}
+	conf.Thresholds = map[string]stats.Thresholds{"http_req_duraton": {}, `http_reqs{status:~"5(.."}`: {}}
+	err = validateConfig(conf)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "\t- the setupTimeout option can't be negative, but is -1s")
+	assert.Contains(t, err.Error(), "\t- the number of VUs (10) can't be more than the max VUs (5)")
+	assert.Contains(t, err.Error(), "\t- summary trend stat 'p90': invalid stat, unknown format")
+	assert.Contains(t, err.Error(), "\t- threshold 'http_reqs{status:~\"5(..\"}': invalid regular expression for the tag 'status'")
+	assert.NotContains(t, err.Error(), "http_req_duraton")
+}
@@ -62,7 +62,7 @@ var inspectCmd = &cobra.Command{
 		var opts lib.Options
 		switch typ {
 		case typeArchive:
-			arc, err := lib.ReadArchive(bytes.NewBuffer(src.Data))
+			arc, err := lib.ReadEncryptedArchive(bytes.NewBuffer(src.Data), runtimeOptions.ArchiveKey)
 			if err != nil {
 				return err
 			}
@@ -23,6 +23,7 @@ package cmd
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,23 +51,50 @@ func optionFlagSet() *pflag.FlagSet {
 	flags.Int64P("iterations", "i", 0, "script total iteration limit (among all VUs)")
 	flags.StringSliceP("stage", "s", nil, "add a `stage`, as `[duration]:[target]`")
 	flags.BoolP("paused", "p", false, "start the test in a paused state")
+	flags.Duration("max-duration", 0, "wall-clock `limit` for the whole k6 run, including init, setup and teardown")
+	flags.Int64("vu-recycle-iterations", 0, "re-initialize each VU after this many iterations")
+	flags.Bool("vu-recycle-on-error", false, "re-initialize a VU after any failed iteration")
+	flags.Int64("vu-recycle-heap-limit", 0, "re-initialize all VUs when the heap of the k6 process exceeds this many `bytes`")
+	flags.String("executor", "", "use the registered `executor` with this name to schedule the VUs (default \"local\")")
+	flags.String("trace-file", "", "replay the iteration start times from this `file` with the \"trace\" executor")
 	flags.Int64("max-redirects", 10, "follow at most n redirects")
 	flags.Int64("batch", 20, "max parallel batch reqs")
 	flags.Int64("batch-per-host", 20, "max parallel batch reqs per host")
+	flags.Int64("seed", 0, "seed Math.random() in every VU, so that runs are reproducible")
 	flags.Int64("rps", 0, "limit requests per second")
 	flags.String("user-agent", fmt.Sprintf("k6/%s (https://k6.io/)", Version), "user agent for http requests")
 	flags.String("http-debug", "", "log all HTTP requests and responses. Excludes body by default. To include body use '--http-debug=full'")
 	flags.Lookup("http-debug").NoOptDefVal = "headers"
+	flags.StringSlice("redact-header", nil, "redact the values of the matching HTTP `header`s in the debug output, wildcards like 'X-*-Token' are supported")
+	flags.StringSlice("redact-cookie", nil, "redact the values of the matching `cookie`s in the debug output, wildcards like 'session*' are supported")
 	flags.Bool("insecure-skip-tls-verify", false, "skip verification of TLS certificates")
+	flags.StringSlice("tls-ca-cert", nil, "trust the CA certificates in these PEM `file`s, in addition to the system ones")
 	flags.Bool("no-connection-reuse", false, "disable keep-alive connections")
 	flags.Bool("no-vu-connection-reuse", false, "don't reuse connections between iterations")
+	flags.Bool("no-cookies-reset", false, "keep the cookies of every VU across iterations, instead of resetting them")
+	flags.Bool("host-metrics", false, "emit the open connections, in-flight requests and errors of every target host as metrics")
 	flags.Duration("min-iteration-duration", 0, "minimum amount of time k6 will take executing a single iteration")
 	flags.BoolP("throw", "w", false, "throw warnings (like failed http requests) as errors")
+	flags.Duration("final-flush-timeout", 0, "how long the outputs get to commit their remaining samples at the end of the test")
+	flags.StringSlice("collector-period", nil, "hand the metric samples to the outputs every `period`, or only to one output type, as '[output]=[period]'")
+	flags.StringSlice("aggregation-period", nil, "only hand aggregated samples for every `period` to the outputs, or only to one output type, as '[output]=[period]'")
 	flags.StringSlice("blacklist-ip", nil, "blacklist an `ip range` from being called")
-	flags.StringSlice("summary-trend-stats", nil, "define `stats` for trend metrics (response times), one or more as 'avg,p(95),...'")
-	flags.String("summary-time-unit", "", "define the time unit used to display the trend stats. Possible units are: 's', 'ms' and 'us'")
-	flags.StringSlice("system-tags", lib.DefaultSystemTagList, "only include these system tags in metrics")
+	flags.String("dns", "", "DNS settings as `ttl=5m,select=random,policy=preferIPv4`; ttl can be a duration, 0 or inf, select first, random or roundRobin, and policy preferIPv4, preferIPv6, onlyIPv4, onlyIPv6 or any")
+	flags.String("chaos", "", "inject client-side faults into a share of the HTTP requests, as `fail=1%,delay=5%,delayBy=500ms,truncate=1%`; failed requests aren't sent, delayed ones get their response later and truncated ones only half of its body")
+	flags.Duration("happy-eyeballs", 0, "race the connections to the IPv6 and IPv4 addresses of hosts, starting the next attempt after this `delay`")
+	flags.StringSlice("health-check", nil, "wait until a GET request to this `URL` responds with a status below 400 before starting the test; can be used more than once")
+	flags.String("health-check-exec", "", "wait until this exported `function` neither throws nor returns false before starting the test")
+	flags.Duration("health-check-timeout", lib.DefaultHealthCheckTimeout, "abort the test if the health check doesn't pass within this `duration`")
+	flags.StringSlice("block-hostnames", nil, "block a `hostname` or a wildcard like *.example.com from being called")
+	flags.String("local-ips", "", "spread the connections over local source `IPs`, like 10.0.0.1-10.0.0.20,10.0.1.0/24")
+	flags.AddFlagSet(summaryOptionFlagSet())
+	flags.StringSlice("system-tags", lib.DefaultSystemTagList, "only include these system tags in metrics, or add and remove tags from the defaults with +tag and -tag")
+	flags.String("region", "", "the `region` this instance runs in, added to all metrics as the region system tag")
+	flags.String("zone", "", "the `zone` this instance runs in, added to all metrics as the zone system tag")
+	flags.StringSlice("redact-tag", nil, "strip the matching `tag`s from all metrics before they reach the outputs, or hash their values with '[tag]=hash'; wildcards like '*token*' are supported")
 	flags.StringSlice("tag", nil, "add a `tag` to be applied to all samples, as `[name]=[value]`")
+	flags.StringSlice("variant", nil, "split the VUs between experiment `variant`s, as '[name]=[weight]', and tag all of their samples with the variant")
+	flags.String("variants-per", "", "assign the variants per 'vu' (default) or per 'iteration'")
 	flags.String("console-output", "", "redirects the console logging to the provided output file")
 	flags.Bool("discard-response-bodies", false, "Read but don't process or save HTTP response bodies")
 	return flags
@@ -79,16 +107,30 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		Duration:              getNullDuration(flags, "duration"),
 		Iterations:            getNullInt64(flags, "iterations"),
 		Paused:                getNullBool(flags, "paused"),
+		MaxDuration:           getNullDuration(flags, "max-duration"),
+		VURecycleIterations:   getNullInt64(flags, "vu-recycle-iterations"),
+		VURecycleOnError:      getNullBool(flags, "vu-recycle-on-error"),
+		VURecycleHeapLimit:    getNullInt64(flags, "vu-recycle-heap-limit"),
+		Executor:              getNullString(flags, "executor"),
+		TraceFile:             getNullString(flags, "trace-file"),
 		MaxRedirects:          getNullInt64(flags, "max-redirects"),
 		Batch:                 getNullInt64(flags, "batch"),
+		Seed:                  getNullInt64(flags, "seed"),
 		RPS:                   getNullInt64(flags, "rps"),
 		UserAgent:             getNullString(flags, "user-agent"),
 		HttpDebug:             getNullString(flags, "http-debug"),
 		InsecureSkipTLSVerify: getNullBool(flags, "insecure-skip-tls-verify"),
 		NoConnectionReuse:     getNullBool(flags, "no-connection-reuse"),
 		NoVUConnectionReuse:   getNullBool(flags, "no-vu-connection-reuse"),
+		NoCookiesReset:        getNullBool(flags, "no-cookies-reset"),
 		MinIterationDuration:  getNullDuration(flags, "min-iteration-duration"),
+		FinalFlushTimeout:     getNullDuration(flags, "final-flush-timeout"),
+		HappyEyeballs:         getNullDuration(flags, "happy-eyeballs"),
+		HostMetrics:           getNullBool(flags, "host-metrics"),
 		Throw:                 getNullBool(flags, "throw"),
+		Region:                getNullString(flags, "region"),
+		Zone:                  getNullString(flags, "zone"),
+		VariantsPer:           getNullString(flags, "variants-per"),
 		DiscardResponseBodies: getNullBool(flags, "discard-response-bodies"),
 		// Default values for options without CLI flags:
 		// TODO: find a saner and more dev-friendly and error-proof way to handle options
@@ -117,6 +159,55 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		}
 	}
 
+	if flags.Lookup("redact-header").Changed {
+		redactHeaders, err := flags.GetStringSlice("redact-header")
+		if err != nil {
+			return opts, err
+		}
+		opts.RedactHeaders = redactHeaders
+	}
+	if flags.Lookup("redact-cookie").Changed {
+		redactCookies, err := flags.GetStringSlice("redact-cookie")
+		if err != nil {
+			return opts, err
+		}
+		opts.RedactCookies = redactCookies
+	}
+
+	if flags.Lookup("redact-tag").Changed {
+		redactTags, err := flags.GetStringSlice("redact-tag")
+		if err != nil {
+			return opts, err
+		}
+		opts.RedactTags = make(map[string]string, len(redactTags))
+		for _, s := range redactTags {
+			name, action := s, stats.RedactStrip
+			if idx := strings.IndexRune(s, '='); idx != -1 {
+				name, action = s[:idx], s[idx+1:]
+			}
+			opts.RedactTags[name] = action
+		}
+	}
+
+	collectorPeriods, err := flags.GetStringSlice("collector-period")
+	if err != nil {
+		return opts, err
+	}
+	for _, s := range collectorPeriods {
+		if err := parseCollectorPeriod(s, &opts); err != nil {
+			return opts, errors.Wrap(err, "collector-period")
+		}
+	}
+	aggregationPeriods, err := flags.GetStringSlice("aggregation-period")
+	if err != nil {
+		return opts, err
+	}
+	for _, s := range aggregationPeriods {
+		if err := parseAggregationPeriod(s, &opts); err != nil {
+			return opts, errors.Wrap(err, "aggregation-period")
+		}
+	}
+
 	blacklistIPStrings, err := flags.GetStringSlice("blacklist-ip")
 	if err != nil {
 		return opts, err
@@ -129,34 +220,73 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		opts.BlacklistIPs = append(opts.BlacklistIPs, net)
 	}
 
-	trendStatStrings, err := flags.GetStringSlice("summary-trend-stats")
+	if flags.Changed("chaos") {
+		chaos, err := flags.GetString("chaos")
+		if err != nil {
+			return opts, err
+		}
+		if err := opts.Chaos.UnmarshalText([]byte(chaos)); err != nil {
+			return opts, errors.Wrap(err, "chaos")
+		}
+	}
+	if flags.Changed("dns") {
+		dns, err := flags.GetString("dns")
+		if err != nil {
+			return opts, err
+		}
+		if err := opts.DNS.UnmarshalText([]byte(dns)); err != nil {
+			return opts, errors.Wrap(err, "dns")
+		}
+	}
+
+	tlsCACerts, err := flags.GetStringSlice("tls-ca-cert")
 	if err != nil {
 		return opts, err
 	}
-	for _, s := range trendStatStrings {
-		if err := ui.VerifyTrendColumnStat(s); err != nil {
-			return opts, errors.Wrapf(err, "stat '%s'", s)
+	if len(tlsCACerts) > 0 {
+		if opts.TLSCACerts, err = lib.NewTLSCACerts(tlsCACerts, true); err != nil {
+			return opts, errors.Wrap(err, "tls-ca-cert")
 		}
+	}
 
-		opts.SummaryTrendStats = append(opts.SummaryTrendStats, s)
+	healthCheckURLs, err := flags.GetStringSlice("health-check")
+	if err != nil {
+		return opts, err
 	}
+	if len(healthCheckURLs) > 0 {
+		opts.HealthCheck.URLs = healthCheckURLs
+	}
+	opts.HealthCheck.Exec = getNullString(flags, "health-check-exec")
+	opts.HealthCheck.Timeout = getNullDuration(flags, "health-check-timeout")
+	opts.HealthCheck.Valid = len(healthCheckURLs) > 0 || opts.HealthCheck.Exec.Valid || opts.HealthCheck.Timeout.Valid
 
-	summaryTimeUnit, err := flags.GetString("summary-time-unit")
+	blockHostnames, err := flags.GetStringSlice("block-hostnames")
 	if err != nil {
 		return opts, err
 	}
-	if summaryTimeUnit != "" {
-		if summaryTimeUnit != "s" && summaryTimeUnit != "ms" && summaryTimeUnit != "us" {
-			return opts, errors.New("invalid summary time unit. Use: 's', 'ms' or 'us'")
+	if len(blockHostnames) > 0 {
+		opts.BlockHostnames = blockHostnames
+	}
+
+	if flags.Changed("local-ips") {
+		localIPs, err := flags.GetString("local-ips")
+		if err != nil {
+			return opts, err
+		}
+		if opts.LocalIPs, err = types.ParseIPPool(localIPs); err != nil {
+			return opts, errors.Wrap(err, "local-ips")
 		}
-		opts.SummaryTimeUnit = null.StringFrom(summaryTimeUnit)
+	}
+
+	if err := getSummaryOptions(flags, &opts); err != nil {
+		return opts, err
 	}
 
 	systemTagList, err := flags.GetStringSlice("system-tags")
 	if err != nil {
 		return opts, err
 	}
-	opts.SystemTags = lib.GetTagSet(systemTagList...)
+	opts.SystemTags = lib.ParseTagSet(systemTagList...)
 
 	runTags, err := flags.GetStringSlice("tag")
 	if err != nil {
@@ -175,6 +305,25 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		opts.RunTags = stats.IntoSampleTags(&parsedRunTags)
 	}
 
+	if flags.Changed("variant") {
+		variants, err := flags.GetStringSlice("variant")
+		if err != nil {
+			return opts, err
+		}
+		opts.Variants = make(map[string]float64, len(variants))
+		for _, s := range variants {
+			idx := strings.IndexRune(s, '=')
+			if idx < 1 {
+				return opts, errors.Errorf("the variant '%s' must be in the '[name]=[weight]' format", s)
+			}
+			weight, err := strconv.ParseFloat(s[idx+1:], 64)
+			if err != nil {
+				return opts, errors.Wrapf(err, "invalid weight of the variant '%s'", s[:idx])
+			}
+			opts.Variants[s[:idx]] = weight
+		}
+	}
+
 	redirectConFile, err := flags.GetString("console-output")
 	if err != nil {
 		return opts, err
@@ -187,6 +336,107 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 	return opts, nil
 }
 
+func summaryOptionFlagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", 0)
+	flags.SortFlags = false
+	flags.StringSlice("summary-trend-stats", nil, "define `stats` for trend metrics (response times), one or more as 'avg,p(95),...'")
+	flags.String("summary-time-unit", "", "define the time unit used to display the trend stats. Possible units are: 's', 'ms' and 'us'")
+	flags.Bool("summary-histogram", false, "show a histogram of the value distribution for trend metrics (response times)")
+	flags.String("summary-filter", "", "only summarize the samples with these `tags`, as 'name:value,...'")
+	flags.StringSlice("summary-compare", nil, "compare the metrics of two `scenarios` side by side in the summary, as 'a,b'")
+	flags.Int64("trend-precision", 0, "keep this many significant `digits` of the trend metric values, or all values exactly with 0 (default 3)")
+	flags.StringSlice("trend-sink", nil, "keep a t-digest of the values of all trend metrics with 'tdigest', or of the matching ones with '[metric]=tdigest'; wildcards like 'http_*' are supported")
+	return flags
+}
+
+// getSummaryOptions reads the end-of-test summary flags into opts.
+func getSummaryOptions(flags *pflag.FlagSet, opts *lib.Options) error {
+	opts.SummaryHistogram = getNullBool(flags, "summary-histogram")
+	opts.SummaryFilter = getNullString(flags, "summary-filter")
+	opts.TrendPrecision = getNullInt64(flags, "trend-precision")
+
+	trendStatStrings, err := flags.GetStringSlice("summary-trend-stats")
+	if err != nil {
+		return err
+	}
+	for _, s := range trendStatStrings {
+		if err := ui.VerifyTrendColumnStat(s); err != nil {
+			return errors.Wrapf(err, "stat '%s'", s)
+		}
+
+		opts.SummaryTrendStats = append(opts.SummaryTrendStats, s)
+	}
+
+	if flags.Changed("trend-sink") {
+		trendSinks, err := flags.GetStringSlice("trend-sink")
+		if err != nil {
+			return err
+		}
+		opts.TrendSinks = make(map[string]string, len(trendSinks))
+		for _, s := range trendSinks {
+			pattern, kind := "*", s
+			if idx := strings.IndexRune(s, '='); idx != -1 {
+				pattern, kind = s[:idx], s[idx+1:]
+			}
+			opts.TrendSinks[pattern] = kind
+		}
+	}
+
+	if flags.Changed("summary-compare") {
+		if opts.SummaryCompare, err = flags.GetStringSlice("summary-compare"); err != nil {
+			return err
+		}
+	}
+
+	summaryTimeUnit, err := flags.GetString("summary-time-unit")
+	if err != nil {
+		return err
+	}
+	if summaryTimeUnit != "" {
+		if summaryTimeUnit != "s" && summaryTimeUnit != "ms" && summaryTimeUnit != "us" {
+			return errors.New("invalid summary time unit. Use: 's', 'ms' or 'us'")
+		}
+		opts.SummaryTimeUnit = null.StringFrom(summaryTimeUnit)
+	}
+	return nil
+}
+
+// parseCollectorPeriod parses either a global collector period like "1s", or the period of a
+// single output type, like "json=1m".
+func parseCollectorPeriod(s string, opts *lib.Options) error {
+	return parseOutputPeriod(s, &opts.CollectorPeriod, &opts.CollectorPeriods)
+}
+
+// parseAggregationPeriod parses either a global aggregation period like "1s", or the period of
+// a single output type, like "influxdb=10s".
+func parseAggregationPeriod(s string, opts *lib.Options) error {
+	return parseOutputPeriod(s, &opts.AggregationPeriod, &opts.AggregationPeriods)
+}
+
+// parseOutputPeriod parses a period like "1s" into global, or one like "json=1m" into perOutput.
+func parseOutputPeriod(s string, global *types.NullDuration, perOutput *map[string]types.NullDuration) error {
+	idx := strings.IndexRune(s, '=')
+	var period types.NullDuration
+	if err := period.UnmarshalText([]byte(s[idx+1:])); err != nil {
+		return err
+	}
+	if !period.Valid {
+		return errors.Errorf("no period in '%s'", s)
+	}
+	if idx == -1 {
+		*global = period
+		return nil
+	}
+	if idx == 0 {
+		return errors.Errorf("no output type in '%s'", s)
+	}
+	if *perOutput == nil {
+		*perOutput = make(map[string]types.NullDuration)
+	}
+	(*perOutput)[s[:idx]] = period
+	return nil
+}
+
 func parseTagNameValue(nv string) (string, string, error) {
 	if nv == "" {
 		return "", "", ErrTagEmptyString
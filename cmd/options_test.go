@@ -22,8 +22,13 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func TestParseTagKeyValue(t *testing.T) {
@@ -82,3 +87,79 @@ func TestParseTagKeyValue(t *testing.T) {
 	}
 
 }
+
+func TestParseCollectorPeriod(t *testing.T) {
+	flags := optionFlagSet()
+	require.NoError(t, flags.Parse([]string{
+		"--collector-period", "2s", "--collector-period", "json=1m,influxdb=500ms",
+	}))
+	opts, err := getOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, types.NullDurationFrom(2*time.Second), opts.CollectorPeriod)
+	assert.Equal(t, map[string]types.NullDuration{
+		"json":     types.NullDurationFrom(time.Minute),
+		"influxdb": types.NullDurationFrom(500 * time.Millisecond),
+	}, opts.CollectorPeriods)
+
+	for _, s := range []string{"", "json=", "=1s", "json=blah"} {
+		assert.Error(t, parseCollectorPeriod(s, &opts), s)
+	}
+}
+
+func TestParseAggregationPeriod(t *testing.T) {
+	flags := optionFlagSet()
+	require.NoError(t, flags.Parse([]string{"--aggregation-period", "1s", "--aggregation-period", "json=10s"}))
+	opts, err := getOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, types.NullDurationFrom(time.Second), opts.AggregationPeriod)
+	assert.Equal(t, map[string]types.NullDuration{"json": types.NullDurationFrom(10 * time.Second)}, opts.AggregationPeriods)
+	assert.Empty(t, opts.CollectorPeriods)
+
+	assert.Error(t, parseAggregationPeriod("=1s", &opts))
+}
+
+func TestGetOptionsNoCookiesReset(t *testing.T) {
+	flags := optionFlagSet()
+	require.NoError(t, flags.Parse([]string{}))
+	opts, err := getOptions(flags)
+	require.NoError(t, err)
+	assert.False(t, opts.NoCookiesReset.Valid)
+
+	flags = optionFlagSet()
+	require.NoError(t, flags.Parse([]string{"--no-cookies-reset"}))
+	opts, err = getOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, null.BoolFrom(true), opts.NoCookiesReset)
+}
+
+func TestGetOptionsRedactTags(t *testing.T) {
+	flags := optionFlagSet()
+	require.NoError(t, flags.Parse([]string{"--redact-tag", "url=hash,*token*", "--redact-tag", "name"}))
+	opts, err := getOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"url": "hash", "*token*": "strip", "name": "strip"}, opts.RedactTags)
+}
+
+func TestGetSummaryOptionsTrendSinks(t *testing.T) {
+	flags := summaryOptionFlagSet()
+	require.NoError(t, flags.Parse([]string{"--trend-sink", "tdigest,my_trend=histogram"}))
+	var opts lib.Options
+	require.NoError(t, getSummaryOptions(flags, &opts))
+	assert.Equal(t, map[string]string{"*": "tdigest", "my_trend": "histogram"}, opts.TrendSinks)
+}
+
+func TestGetOptionsVariants(t *testing.T) {
+	flags := optionFlagSet()
+	require.NoError(t, flags.Parse([]string{"--variant", "control=3,new=1", "--variants-per", "iteration"}))
+	opts, err := getOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"control": 3, "new": 1}, opts.Variants)
+	assert.Equal(t, null.StringFrom("iteration"), opts.VariantsPer)
+
+	for _, variant := range []string{"control", "=1", "new=many"} {
+		flags = optionFlagSet()
+		require.NoError(t, flags.Parse([]string{"--variant", variant}))
+		_, err = getOptions(flags)
+		assert.Error(t, err, variant)
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	jsonc "github.com/loadimpact/k6/stats/json"
+	"github.com/loadimpact/k6/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/guregu/null.v3"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report [file]",
+	Short: "Print the end-of-test summary for a previous run",
+	Long: `Print the end-of-test summary for a previous run.
+
+  Reads the output of a test run with --out json=<file> (use "-" for stdin) and
+  regenerates the end-of-test summary from it, optionally only including samples
+  with certain tags or from a certain time range.`,
+	Example: `
+  # Summarize a previous run.
+  k6 report results.json
+
+  # Only include samples for a single URL, from the 30th second onwards.
+  k6 report --tag url=https://test.loadimpact.com/ --from 30s results.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := getReportFilter(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		var opts lib.Options
+		if err := getSummaryOptions(cmd.Flags(), &opts); err != nil {
+			return err
+		}
+		// All samples are at hand here, so the summary filter is applied directly to them,
+		// which unlike in k6 run also restricts the checks.
+		if opts.SummaryFilter.String != "" {
+			filter.Tags = mergeTags(filter.Tags, stats.ParseTagFilter(opts.SummaryFilter.String))
+			opts.SummaryFilter = null.String{}
+		}
+		if len(opts.SummaryTrendStats) > 0 {
+			ui.UpdateTrendColumns(opts.SummaryTrendStats)
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			r = f
+		}
+
+		data, err := loadReport(r, filter)
+		if err != nil {
+			return err
+		}
+		data.Opts = opts
+
+		fprintf(stdout, "\n")
+		ui.Summarize(stdout, "", data)
+		fprintf(stdout, "\n")
+		return nil
+	},
+}
+
+// reportFilter selects the samples that are included in a report.
+type reportFilter struct {
+	Tags     *stats.SampleTags
+	From, To reportBound
+}
+
+// reportBound is either an offset from the first sample in the output, or an absolute time.
+type reportBound struct {
+	Offset time.Duration
+	At     time.Time
+	Valid  bool
+}
+
+func parseReportBound(s string) (reportBound, error) {
+	if s == "" {
+		return reportBound{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return reportBound{Offset: d, Valid: true}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return reportBound{}, errors.Errorf("'%s' is neither a duration nor an RFC3339 timestamp", s)
+	}
+	return reportBound{At: t, Valid: true}, nil
+}
+
+func (b reportBound) resolve(start time.Time) time.Time {
+	if !b.At.IsZero() {
+		return b.At
+	}
+	return start.Add(b.Offset)
+}
+
+// Match returns whether a sample passes the filter, given the time of the first sample in the output.
+func (f reportFilter) Match(sample *stats.Sample, start time.Time) bool {
+	if !sample.Tags.Contains(f.Tags) {
+		return false
+	}
+	if f.From.Valid && sample.Time.Before(f.From.resolve(start)) {
+		return false
+	}
+	if f.To.Valid && sample.Time.After(f.To.resolve(start)) {
+		return false
+	}
+	return true
+}
+
+// loadReport aggregates the samples in a JSON output into the data needed for the summary.
+// Checks are rebuilt into a group tree from the "checks" metric's group and check tags.
+func loadReport(r io.Reader, filter reportFilter) (ui.SummaryData, error) {
+	root, err := lib.NewGroup("", nil)
+	if err != nil {
+		return ui.SummaryData{}, err
+	}
+	data := ui.SummaryData{Root: root, Metrics: make(map[string]*stats.Metric)}
+
+	var start, first, last time.Time
+	reader := jsonc.NewReader(r)
+	for {
+		sample, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return data, err
+		}
+		if start.IsZero() {
+			start = sample.Time
+		}
+		if !filter.Match(sample, start) {
+			continue
+		}
+
+		if first.IsZero() || sample.Time.Before(first) {
+			first = sample.Time
+		}
+		if sample.Time.After(last) {
+			last = sample.Time
+		}
+
+		m, ok := data.Metrics[sample.Metric.Name]
+		if !ok {
+			m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
+			data.Metrics[m.Name] = m
+		}
+		m.Sink.Add(*sample)
+
+		if m.Name == "checks" {
+			if err := addReportCheck(root, sample); err != nil {
+				return data, err
+			}
+		}
+	}
+	data.Time = last.Sub(first)
+	return data, nil
+}
+
+func addReportCheck(root *lib.Group, sample *stats.Sample) error {
+	name, ok := sample.Tags.Get("check")
+	if !ok {
+		return nil
+	}
+
+	group := root
+	if path, _ := sample.Tags.Get("group"); path != "" {
+		for _, part := range strings.Split(strings.TrimPrefix(path, lib.GroupSeparator), lib.GroupSeparator) {
+			g, err := group.Group(part)
+			if err != nil {
+				return err
+			}
+			group = g
+		}
+	}
+
+	check, err := group.Check(name)
+	if err != nil {
+		return err
+	}
+	if sample.Value != 0 {
+		atomic.AddInt64(&check.Passes, 1)
+	} else {
+		atomic.AddInt64(&check.Fails, 1)
+	}
+	return nil
+}
+
+func mergeTags(a, b *stats.SampleTags) *stats.SampleTags {
+	tags := a.CloneTags()
+	for k, v := range b.CloneTags() {
+		tags[k] = v
+	}
+	return stats.IntoSampleTags(&tags)
+}
+
+func reportCmdFlagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.SortFlags = false
+	flags.StringSlice("tag", nil, "only include samples with this `tag`, as `[name]=[value]`")
+	flags.String("from", "", "only include samples from this `time` on, as an offset from the start like '30s' or an RFC3339 timestamp")
+	flags.String("to", "", "only include samples up to this `time`, as an offset from the start like '2m' or an RFC3339 timestamp")
+	flags.AddFlagSet(summaryOptionFlagSet())
+	return flags
+}
+
+func getReportFilter(flags *pflag.FlagSet) (reportFilter, error) {
+	var filter reportFilter
+
+	tagStrings, err := flags.GetStringSlice("tag")
+	if err != nil {
+		return filter, err
+	}
+	if len(tagStrings) > 0 {
+		tags := make(map[string]string, len(tagStrings))
+		for i, s := range tagStrings {
+			name, value, err := parseTagNameValue(s)
+			if err != nil {
+				return filter, errors.Wrapf(err, "tag %d", i)
+			}
+			tags[name] = value
+		}
+		filter.Tags = stats.IntoSampleTags(&tags)
+	}
+
+	for name, bound := range map[string]*reportBound{"from": &filter.From, "to": &filter.To} {
+		s, err := flags.GetString(name)
+		if err != nil {
+			return filter, err
+		}
+		if *bound, err = parseReportBound(s); err != nil {
+			return filter, errors.Wrap(err, name)
+		}
+	}
+	return filter, nil
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().SortFlags = false
+	reportCmd.Flags().AddFlagSet(reportCmdFlagSet())
+}
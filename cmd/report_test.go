@@ -0,0 +1,126 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	jsonc "github.com/loadimpact/k6/stats/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeReportOutput(t *testing.T, samples ...stats.Sample) *bytes.Buffer {
+	var buf bytes.Buffer
+	seen := map[string]bool{}
+	for i := range samples {
+		if !seen[samples[i].Metric.Name] {
+			seen[samples[i].Metric.Name] = true
+			row, err := json.Marshal(jsonc.WrapMetric(samples[i].Metric))
+			require.NoError(t, err)
+			buf.Write(append(row, '\n'))
+		}
+		row, err := json.Marshal(jsonc.WrapSample(&samples[i]))
+		require.NoError(t, err)
+		buf.Write(append(row, '\n'))
+	}
+	return &buf
+}
+
+func TestReport(t *testing.T) {
+	reqs := stats.New("http_reqs", stats.Counter)
+	checks := stats.New("checks", stats.Rate)
+	start := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	tags := func(kv ...string) *stats.SampleTags {
+		m := map[string]string{}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = kv[i+1]
+		}
+		return stats.IntoSampleTags(&m)
+	}
+	output := func() *bytes.Buffer {
+		return writeReportOutput(t,
+			stats.Sample{Metric: reqs, Time: start, Value: 1, Tags: tags("status", "200")},
+			stats.Sample{Metric: reqs, Time: start.Add(10 * time.Second), Value: 1, Tags: tags("status", "500")},
+			stats.Sample{Metric: checks, Time: start.Add(20 * time.Second), Value: 1, Tags: tags("group", "::login::form", "check", "is ok")},
+			stats.Sample{Metric: checks, Time: start.Add(30 * time.Second), Value: 0, Tags: tags("group", "", "check", "is ok")},
+			stats.Sample{Metric: reqs, Time: start.Add(40 * time.Second), Value: 1, Tags: tags("status", "200")},
+		)
+	}
+
+	t.Run("All", func(t *testing.T) {
+		data, err := loadReport(output(), reportFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 40*time.Second, data.Time)
+		require.Contains(t, data.Metrics, "http_reqs")
+		assert.Equal(t, 3.0, data.Metrics["http_reqs"].Sink.(*stats.CounterSink).Value)
+
+		require.Contains(t, data.Root.Checks, "is ok")
+		assert.Equal(t, int64(1), data.Root.Checks["is ok"].Fails)
+		login := data.Root.Groups["login"]
+		require.NotNil(t, login)
+		form := login.Groups["form"]
+		require.NotNil(t, form)
+		assert.Equal(t, "::login::form", form.Path)
+		assert.Equal(t, int64(1), form.Checks["is ok"].Passes)
+	})
+	t.Run("Tags", func(t *testing.T) {
+		data, err := loadReport(output(), reportFilter{Tags: tags("status", "200")})
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, data.Metrics["http_reqs"].Sink.(*stats.CounterSink).Value)
+		assert.NotContains(t, data.Metrics, "checks")
+		assert.Empty(t, data.Root.Checks)
+	})
+	t.Run("TimeRange", func(t *testing.T) {
+		from, err := parseReportBound("5s")
+		require.NoError(t, err)
+		to, err := parseReportBound(start.Add(35 * time.Second).Format(time.RFC3339))
+		require.NoError(t, err)
+
+		data, err := loadReport(output(), reportFilter{From: from, To: to})
+		require.NoError(t, err)
+		assert.Equal(t, 20*time.Second, data.Time)
+		assert.Equal(t, 1.0, data.Metrics["http_reqs"].Sink.(*stats.CounterSink).Value)
+		assert.Equal(t, 0.5, data.Metrics["checks"].Sink.(*stats.RateSink).Format(0)["rate"])
+	})
+	t.Run("InvalidBound", func(t *testing.T) {
+		_, err := parseReportBound("yesterday")
+		assert.EqualError(t, err, "'yesterday' is neither a duration nor an RFC3339 timestamp")
+	})
+	t.Run("Flags", func(t *testing.T) {
+		flags := reportCmdFlagSet()
+		require.NoError(t, flags.Parse([]string{"--tag", "status=200", "--from", "1m", "--summary-time-unit", "ms"}))
+		filter, err := getReportFilter(flags)
+		require.NoError(t, err)
+		assert.True(t, filter.Tags.IsEqual(tags("status", "200")))
+		assert.Equal(t, reportBound{Offset: time.Minute, Valid: true}, filter.From)
+		assert.False(t, filter.To.Valid)
+
+		flags = reportCmdFlagSet()
+		require.NoError(t, flags.Parse([]string{"--to", "soon"}))
+		_, err = getReportFilter(flags)
+		assert.EqualError(t, err, "to: 'soon' is neither a duration nor an RFC3339 timestamp")
+	})
+}
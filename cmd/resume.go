@@ -32,12 +32,28 @@ import (
 
 // resumeCmd represents the resume command
 var resumeCmd = &cobra.Command{
-	Use:   "resume",
+	Use:   "resume [script]",
 	Short: "Resume a paused test",
 	Long: `Resume a paused test.
 
-  Use the global --address flag to specify the URL to the API server.`,
+  Use the global --address flag to specify the URL to the API server.
+
+  If a script is specified, a test that was previously terminated with SIGTERM
+  is instead continued from the state saved in the --snapshot file. All of the
+  flags of "k6 run" are supported in that case.`,
+	Example: `
+  # Resume a paused test.
+  k6 resume
+
+  # Continue a test from a snapshot saved by "k6 run --snapshot state.json script.js".
+  k6 resume --snapshot state.json script.js`[1:],
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			runFromSnapshot = true
+			return runCmd.RunE(cmd, args)
+		}
+
 		c, err := client.New(address)
 		if err != nil {
 			return err
@@ -55,4 +71,7 @@ var resumeCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(resumeCmd)
+
+	resumeCmd.Flags().SortFlags = false
+	resumeCmd.Flags().AddFlagSet(runCmdFlagSet())
 }
@@ -118,7 +118,7 @@ func rootCmdPersistentFlagSet() *pflag.FlagSet {
 	flags.StringVarP(&address, "address", "a", "localhost:6565", "address for the api server")
 
 	//TODO: Fix... This default value needed, so both CLI flags and environment variables work
-	flags.StringVarP(&configFilePath, "config", "c", configFilePath, "JSON config file")
+	flags.StringVarP(&configFilePath, "config", "c", configFilePath, "JSON or YAML config file, the format is determined by the file extension")
 	// And we also need to explicitly set the default value for the usage message here, so things
 	// like `K6_CONFIG="blah" k6 run -h` don't produce a weird usage message
 	flags.Lookup("config").DefValue = defaultConfigFilePath
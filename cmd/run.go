@@ -34,16 +34,19 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/loadimpact/k6/api"
 	"github.com/loadimpact/k6/core"
-	"github.com/loadimpact/k6/core/local"
+	_ "github.com/loadimpact/k6/core/local" // registers the default executor
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/loader"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/stats/topn"
 	"github.com/loadimpact/k6/ui"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -63,15 +66,30 @@ const (
 	genericTimeoutErrorCode     = 102
 	genericEngineErrorCode      = 103
 	invalidConfigErrorCode      = 104
+	maxDurationExceededErrCode  = 105
+	anomalyDetectedErrCode      = 106
 )
 
+// How often the live top-N panel is refreshed, i.e. how long each of its windows is.
+const liveTopNInterval = 5 * time.Second
+
 var (
 	//TODO: fix this, global variables are not very testable...
 	runType       = os.Getenv("K6_TYPE")
 	runNoSetup    = os.Getenv("K6_NO_SETUP") != ""
 	runNoTeardown = os.Getenv("K6_NO_TEARDOWN") != ""
+
+	// The test state is written to this file if k6 is terminated with SIGTERM
+	runSnapshotFile = os.Getenv("K6_SNAPSHOT")
+	// Set by `k6 resume`, so the test continues from the state saved in runSnapshotFile
+	runFromSnapshot = false
+
+	// A file with the scripts to run one after the other, besides the ones in the arguments
+	runManifest = os.Getenv("K6_MANIFEST")
 )
 
+const runArgsMsg = "arg should either be \"-\", if reading script from stdin, or a path to a script file"
+
 // runCmd represents the run command.
 var runCmd = &cobra.Command{
 	Use:   "run",
@@ -97,377 +115,533 @@ a commandline interface for interacting with it.`,
   k6 run -u 0 -s 10s:100 -s 60s -s 10s:0
 
   # Send metrics to an influxdb server
-  k6 run -o influxdb=http://1.2.3.4:8086/k6`[1:],
-	Args: exactArgsWithMsg(1, "arg should either be \"-\", if reading script from stdin, or a path to a script file"),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		//TODO: disable in quiet mode?
-		_, _ = BannerColor.Fprintf(stdout, "\n%s\n\n", Banner)
+  k6 run -o influxdb=http://1.2.3.4:8086/k6
 
-		initBar := ui.ProgressBar{
-			Width: 60,
-			Left:  func() string { return "    init" },
+  # Run several tests one after the other, with a combined report at the end.
+  k6 run login.js browse.js checkout.js
+  k6 run --manifest nightly.txt`[1:],
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && runManifest == "" {
+			return fmt.Errorf("requires at least 1 arg(s), received 0: %s", runArgsMsg)
 		}
-
-		// Create the Runner.
-		fprintf(stdout, "%s runner\r", initBar.String())
-		pwd, err := os.Getwd()
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filenames, err := getRunFilenames(afero.NewOsFs(), args, runManifest)
 		if err != nil {
 			return err
 		}
-		filename := args[0]
-		fs := afero.NewOsFs()
-		src, err := readSource(filename, pwd, fs, os.Stdin)
-		if err != nil {
-			return err
+		if runFromSnapshot && len(filenames) > 1 {
+			return errors.New("only a single test can be resumed from a snapshot")
 		}
 
-		runtimeOptions, err := getRuntimeOptions(cmd.Flags())
-		if err != nil {
-			return err
-		}
+		//TODO: disable in quiet mode?
+		_, _ = BannerColor.Fprintf(stdout, "\n%s\n\n", Banner)
 
-		r, err := newRunner(src, runType, fs, runtimeOptions)
-		if err != nil {
-			return err
-		}
+		// Trap Interrupts, SIGINTs and SIGTERMs.
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigC)
 
-		fprintf(stdout, "%s options\r", initBar.String())
+		// Create an API server, which controls whichever test is running at the time.
+		var currentEngine atomic.Value
+		currentEngine.Store((*core.Engine)(nil))
+		go func() {
+			err := api.ListenAndServeFunc(address, func() *core.Engine {
+				return currentEngine.Load().(*core.Engine)
+			})
+			if err != nil {
+				log.WithError(err).Warn("Error from API server")
+			}
+		}()
 
-		cliConf, err := getConfig(cmd.Flags())
-		if err != nil {
-			return err
-		}
-		conf, err := getConsolidatedConfig(fs, cliConf, r)
-		if err != nil {
-			return err
-		}
+		// Each test starts with the default summary columns, not the ones of the previous one.
+		trendColumns := ui.TrendColumns
+		var results []ui.SuiteResult
+		var firstErr error
+		var last *testRun
+		for i, filename := range filenames {
+			if len(filenames) > 1 {
+				fprintf(stdout, "  %s\n\n", ui.ValueColor.Sprintf("test %d/%d: %s", i+1, len(filenames), filename))
+			}
+			ui.TrendColumns = trendColumns
+
+			last = &testRun{
+				filename: filename,
+				sigC:     sigC,
+				onEngine: func(engine *core.Engine) { currentEngine.Store(engine) },
+			}
+			err := runTest(cmd, last)
+			currentEngine.Store((*core.Engine)(nil))
+			if len(filenames) == 1 {
+				if last.linger {
+					log.Info("Linger set; waiting for Ctrl+C...")
+					<-sigC
+				}
+				return err
+			}
 
-		// If -m/--max isn't specified, figure out the max that should be needed.
-		if !conf.VUsMax.Valid {
-			conf.VUsMax = null.NewInt(conf.VUs.Int64, conf.VUs.Valid)
-			for _, stage := range conf.Stages {
-				if stage.Target.Valid && stage.Target.Int64 > conf.VUsMax.Int64 {
-					conf.VUsMax = stage.Target
+			result := ui.SuiteResult{Name: filename, Err: err}
+			if last.engine != nil {
+				result.Metrics = last.engine.Metrics
+				result.Time = last.engine.Executor.GetTime()
+			}
+			results = append(results, result)
+			if err != nil {
+				log.WithError(err).WithField("script", filename).Error("Test failed")
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+			if last.interrupted {
+				if left := len(filenames) - i - 1; left > 0 {
+					log.Warnf("Interrupted, skipping the remaining %d tests", left)
 				}
+				break
 			}
 		}
 
-		// If -d/--duration, -i/--iterations and -s/--stage are all unset, run to one iteration.
-		if !conf.Duration.Valid && !conf.Iterations.Valid && len(conf.Stages) == 0 {
-			conf.Iterations = null.IntFrom(1)
-		}
+		fprintf(stdout, "\n")
+		ui.SummarizeSuite(stdout, results)
+		fprintf(stdout, "\n")
 
-		if conf.Iterations.Valid && conf.Iterations.Int64 < conf.VUsMax.Int64 {
-			log.Warnf(
-				"All iterations (%d in this test run) are shared between all VUs, so some of the %d VUs will not execute even a single iteration!",
-				conf.Iterations.Int64, conf.VUsMax.Int64,
-			)
+		if last.linger {
+			log.Info("Linger set; waiting for Ctrl+C...")
+			<-sigC
+		}
+		if firstErr != nil {
+			failed := 0
+			for _, result := range results {
+				if result.Err != nil {
+					failed++
+				}
+			}
+			err := errors.Errorf("%d of %d tests failed", failed, len(results))
+			if e, ok := firstErr.(ExitCode); ok {
+				return ExitCode{err, e.Code}
+			}
+			return err
 		}
+		return nil
+	},
+}
 
-		//TODO: move a bunch of the logic above to a config "constructor" and to the Validate() method
+// testRun is one of the tests that `k6 run` was given, see runTest().
+type testRun struct {
+	filename string
+	sigC     <-chan os.Signal
+	onEngine func(*core.Engine) // Called once the engine of the test is created
 
-		// If duration is explicitly set to 0, it means run forever.
-		//TODO: just... handle this differently, e.g. as a part of the manual executor
-		if conf.Duration.Valid && conf.Duration.Duration == 0 {
-			conf.Duration = types.NullDuration{}
-		}
+	// The outcome of the test, besides the error returned by runTest()
+	engine      *core.Engine
+	interrupted bool
+	linger      bool
+}
 
-		if cerr := validateConfig(conf); cerr != nil {
-			return ExitCode{cerr, invalidConfigErrorCode}
-		}
+// runTest runs one of the tests that `k6 run` was given, from start to end-of-test summary.
+func runTest(cmd *cobra.Command, run *testRun) error {
+	// Start enforcing the wall-clock cap as soon as possible, so it covers init as well.
+	// It's adjusted later, when the config from all of the other sources is consolidated.
+	deadline := newRunDeadline()
+	defer deadline.stop()
+	cliConf, err := getConfig(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	if cliConf.MaxDuration.Valid {
+		deadline.set(cliConf.MaxDuration, 0, nil)
+	} else if envConf, err := readEnvConfig(); err == nil {
+		deadline.set(envConf.MaxDuration, 0, nil)
+	}
 
-		// If summary trend stats are defined, update the UI to reflect them
-		if len(conf.SummaryTrendStats) > 0 {
-			ui.UpdateTrendColumns(conf.SummaryTrendStats)
-		}
+	initBar := ui.ProgressBar{
+		Width: 60,
+		Left:  func() string { return "    init" },
+	}
+
+	// Create the Runner.
+	fprintf(stdout, "%s runner\r", initBar.String())
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	filename := run.filename
+	fs := afero.NewOsFs()
+	src, err := readSource(filename, pwd, fs, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	runtimeOptions, err := getRuntimeOptions(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	r, err := newRunner(src, runType, fs, runtimeOptions)
+	if err != nil {
+		return err
+	}
+
+	fprintf(stdout, "%s options\r", initBar.String())
+
+	conf, err := getConsolidatedConfig(fs, cliConf, r)
+	if err != nil {
+		return err
+	}
+	deadline.set(conf.MaxDuration, 0, nil)
+
+	conf = finalizeRunConfig(conf)
+
+	if cerr := validateConfig(conf); cerr != nil {
+		return ExitCode{cerr, invalidConfigErrorCode}
+	}
+
+	// If summary trend stats are defined, update the UI to reflect them
+	if len(conf.SummaryTrendStats) > 0 {
+		ui.UpdateTrendColumns(conf.SummaryTrendStats)
+	}
+
+	// Tag all metrics with the region and zone of this instance, if they're set.
+	conf.Options = conf.Options.WithInstanceTags()
+
+	// Write options back to the runner too.
+	if err = r.SetOptions(conf.Options); err != nil {
+		return err
+	}
+
+	// Create an executor wrapping the runner; the local one, unless another one was registered and picked.
+	fprintf(stdout, "%s executor\r", initBar.String())
+	executorName := lib.DefaultExecutorName
+	if conf.Executor.String != "" {
+		executorName = conf.Executor.String
+	}
+	ex, err := lib.NewExecutor(executorName, r)
+	if err != nil {
+		return err
+	}
+	if runNoSetup {
+		ex.SetRunSetup(false)
+	}
+	if runNoTeardown {
+		ex.SetRunTeardown(false)
+	}
+
+	// Create an engine.
+	fprintf(stdout, "%s   engine\r", initBar.String())
+	engine, err := core.NewEngine(ex, conf.Options)
+	if err != nil {
+		return err
+	}
+
+	// Stop the test gracefully in time for teardown(), if the max duration is approaching.
+	deadline.set(conf.MaxDuration, time.Duration(conf.TeardownTimeout.Duration), func() {
+		engine.Executor.SetEndTime(types.NullDurationFrom(engine.Executor.GetTime()))
+	})
 
-		// Write options back to the runner too.
-		if err = r.SetOptions(conf.Options); err != nil {
+	// Configure the engine.
+	if conf.NoThresholds.Valid {
+		engine.NoThresholds = conf.NoThresholds.Bool
+	}
+	if conf.NoSummary.Valid {
+		engine.NoSummary = conf.NoSummary.Bool
+	}
+
+	// Continue a previously terminated test, if requested.
+	if runFromSnapshot {
+		snapshot, err := readSnapshotFile(fs, runSnapshotFile)
+		if err != nil {
 			return err
 		}
-
-		// Create a local executor wrapping the runner.
-		fprintf(stdout, "%s executor\r", initBar.String())
-		ex := local.New(r)
-		if runNoSetup {
-			ex.SetRunSetup(false)
+		if err := engine.Restore(snapshot); err != nil {
+			return err
 		}
-		if runNoTeardown {
-			ex.SetRunTeardown(false)
+	}
+
+	// Create a collector and assign it to the engine if requested.
+	fprintf(stdout, "%s   collector\r", initBar.String())
+	if err := addCollectors(engine, conf, src); err != nil {
+		return err
+	}
+
+	// Let the API server control this test.
+	run.engine = engine
+	run.onEngine(engine)
+
+	// Write the big banner.
+	{
+		out := "-"
+		link := ""
+		if engine.Collectors != nil {
+			for idx, collector := range engine.Collectors {
+				if out != "-" {
+					out = out + "; " + conf.Out[idx]
+				} else {
+					out = conf.Out[idx]
+				}
+
+				if l := collector.Link(); l != "" {
+					link = link + " (" + l + ")"
+				}
+			}
 		}
 
-		// Create an engine.
-		fprintf(stdout, "%s   engine\r", initBar.String())
-		engine, err := core.NewEngine(ex, conf.Options)
-		if err != nil {
-			return err
+		execution := ui.ValueColor.Sprint("local")
+		if location := instanceLocation(conf.Options); location != "" {
+			execution += ui.ExtraColor.Sprint(" (" + location + ")")
 		}
+		fprintf(stdout, "  execution: %s\n", execution)
+		fprintf(stdout, "     output: %s%s\n", ui.ValueColor.Sprint(out), ui.ExtraColor.Sprint(link))
+		fprintf(stdout, "     script: %s\n", ui.ValueColor.Sprint(filename))
+		fprintf(stdout, "\n")
 
-		// Configure the engine.
-		if conf.NoThresholds.Valid {
-			engine.NoThresholds = conf.NoThresholds.Bool
+		duration := ui.GrayColor.Sprint("-")
+		iterations := ui.GrayColor.Sprint("-")
+		if conf.Duration.Valid {
+			duration = ui.ValueColor.Sprint(conf.Duration.Duration)
 		}
-		if conf.NoSummary.Valid {
-			engine.NoSummary = conf.NoSummary.Bool
+		if conf.Iterations.Valid {
+			iterations = ui.ValueColor.Sprint(conf.Iterations.Int64)
 		}
+		vus := ui.ValueColor.Sprint(conf.VUs.Int64)
+		max := ui.ValueColor.Sprint(conf.VUsMax.Int64)
 
-		// Create a collector and assign it to the engine if requested.
-		fprintf(stdout, "%s   collector\r", initBar.String())
-		for _, out := range conf.Out {
-			t, arg := parseCollector(out)
-			collector, err := newCollector(t, arg, src, conf)
-			if err != nil {
-				return err
-			}
-			if err := collector.Init(); err != nil {
-				return err
-			}
-			engine.Collectors = append(engine.Collectors, collector)
+		leftWidth := ui.StrWidth(duration)
+		if l := ui.StrWidth(vus); l > leftWidth {
+			leftWidth = l
 		}
+		durationPad := strings.Repeat(" ", leftWidth-ui.StrWidth(duration))
+		vusPad := strings.Repeat(" ", leftWidth-ui.StrWidth(vus))
 
-		// Create an API server.
-		fprintf(stdout, "%s   server\r", initBar.String())
-		go func() {
-			if err := api.ListenAndServe(address, engine); err != nil {
-				log.WithError(err).Warn("Error from API server")
-			}
-		}()
+		fprintf(stdout, "    duration: %s,%s iterations: %s\n", duration, durationPad, iterations)
+		fprintf(stdout, "         vus: %s,%s max: %s\n", vus, vusPad, max)
+		fprintf(stdout, "\n")
+	}
 
-		// Write the big banner.
-		{
-			out := "-"
-			link := ""
-			if engine.Collectors != nil {
-				for idx, collector := range engine.Collectors {
-					if out != "-" {
-						out = out + "; " + conf.Out[idx]
-					} else {
-						out = conf.Out[idx]
-					}
-
-					if l := collector.Link(); l != "" {
-						link = link + " (" + l + ")"
-					}
-				}
-			}
+	// Keep track of the slowest and most failing requests for the live panel and of the totals
+	// per request name for the endpoints report, if requested.
+	var topN *topn.Collector
+	var topNC <-chan time.Time
+	liveTopN := conf.LiveTopN.Int64 > 0 && !quiet
+	if liveTopN || conf.EndpointsExport.String != "" {
+		topN = topn.New(conf.EndpointsExport.String != "")
+		engine.Collectors = append(engine.Collectors, topN)
+	}
+	if liveTopN {
+		topNTicker := time.NewTicker(liveTopNInterval)
+		defer topNTicker.Stop()
+		topNC = topNTicker.C
+	}
+	topNLines := 0
 
-			fprintf(stdout, "  execution: %s\n", ui.ValueColor.Sprint("local"))
-			fprintf(stdout, "     output: %s%s\n", ui.ValueColor.Sprint(out), ui.ExtraColor.Sprint(link))
-			fprintf(stdout, "     script: %s\n", ui.ValueColor.Sprint(filename))
-			fprintf(stdout, "\n")
+	// Run the engine with a cancellable context.
+	fprintf(stdout, "%s starting\r", initBar.String())
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error)
+	go func() { errC <- engine.Run(ctx) }()
 
-			duration := ui.GrayColor.Sprint("-")
-			iterations := ui.GrayColor.Sprint("-")
-			if conf.Duration.Valid {
-				duration = ui.ValueColor.Sprint(conf.Duration.Duration)
+	// If the user hasn't opted out: report usage.
+	if !conf.NoUsageReport.Bool {
+		go func() {
+			u := "http://k6reports.loadimpact.com/"
+			mime := "application/json"
+			var endTSeconds float64
+			if endT := engine.Executor.GetEndTime(); endT.Valid {
+				endTSeconds = time.Duration(endT.Duration).Seconds()
 			}
-			if conf.Iterations.Valid {
-				iterations = ui.ValueColor.Sprint(conf.Iterations.Int64)
+			var stagesEndTSeconds float64
+			if stagesEndT := lib.SumStages(engine.Executor.GetStages()); stagesEndT.Valid {
+				stagesEndTSeconds = time.Duration(stagesEndT.Duration).Seconds()
 			}
-			vus := ui.ValueColor.Sprint(conf.VUs.Int64)
-			max := ui.ValueColor.Sprint(conf.VUsMax.Int64)
-
-			leftWidth := ui.StrWidth(duration)
-			if l := ui.StrWidth(vus); l > leftWidth {
-				leftWidth = l
+			body, err := json.Marshal(map[string]interface{}{
+				"k6_version":  Version,
+				"vus_max":     engine.Executor.GetVUsMax(),
+				"iterations":  engine.Executor.GetEndIterations(),
+				"duration":    endTSeconds,
+				"st_duration": stagesEndTSeconds,
+				"goos":        runtime.GOOS,
+				"goarch":      runtime.GOARCH,
+			})
+			if err != nil {
+				panic(err) // This should never happen!!
 			}
-			durationPad := strings.Repeat(" ", leftWidth-ui.StrWidth(duration))
-			vusPad := strings.Repeat(" ", leftWidth-ui.StrWidth(vus))
-
-			fprintf(stdout, "    duration: %s,%s iterations: %s\n", duration, durationPad, iterations)
-			fprintf(stdout, "         vus: %s,%s max: %s\n", vus, vusPad, max)
-			fprintf(stdout, "\n")
-		}
-
-		// Run the engine with a cancellable context.
-		fprintf(stdout, "%s starting\r", initBar.String())
-		ctx, cancel := context.WithCancel(context.Background())
-		errC := make(chan error)
-		go func() { errC <- engine.Run(ctx) }()
+			_, _ = http.Post(u, mime, bytes.NewBuffer(body))
+		}()
+	}
 
-		// Trap Interrupts, SIGINTs and SIGTERMs.
-		sigC := make(chan os.Signal, 1)
-		signal.Notify(sigC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-		defer signal.Stop(sigC)
+	// Prepare a progress bar.
+	progress := ui.ProgressBar{
+		Width: 60,
+		Left: func() string {
+			if engine.Executor.IsPaused() {
+				return "  paused"
+			} else if engine.Executor.IsRunning() {
+				return " running"
+			} else {
+				return "    done"
+			}
+		},
+		Right: func() string {
+			p := engine.GetProgress()
+			if p.EndIterations.Valid {
+				return fmt.Sprintf("%d / %d", p.Iterations, p.EndIterations.Int64)
+			}
+			precision := 100 * time.Millisecond
+			if p.EndTime.Valid {
+				return fmt.Sprintf("%s / %s",
+					(p.Time/precision)*precision,
+					(time.Duration(p.EndTime.Duration)/precision)*precision,
+				)
+			}
+			return ((p.Time / precision) * precision).String()
+		},
+	}
 
-		// If the user hasn't opted out: report usage.
-		if !conf.NoUsageReport.Bool {
-			go func() {
-				u := "http://k6reports.loadimpact.com/"
-				mime := "application/json"
-				var endTSeconds float64
-				if endT := engine.Executor.GetEndTime(); endT.Valid {
-					endTSeconds = time.Duration(endT.Duration).Seconds()
-				}
-				var stagesEndTSeconds float64
-				if stagesEndT := lib.SumStages(engine.Executor.GetStages()); stagesEndT.Valid {
-					stagesEndTSeconds = time.Duration(stagesEndT.Duration).Seconds()
-				}
-				body, err := json.Marshal(map[string]interface{}{
-					"k6_version":  Version,
-					"vus_max":     engine.Executor.GetVUsMax(),
-					"iterations":  engine.Executor.GetEndIterations(),
-					"duration":    endTSeconds,
-					"st_duration": stagesEndTSeconds,
-					"goos":        runtime.GOOS,
-					"goarch":      runtime.GOARCH,
+	// Ticker for progress bar updates. Less frequent updates for non-TTYs, none if quiet.
+	updateFreq := 50 * time.Millisecond
+	if !stdoutTTY {
+		updateFreq = 1 * time.Second
+	}
+	ticker := time.NewTicker(updateFreq)
+	if quiet || conf.HttpDebug.Valid && conf.HttpDebug.String != "" {
+		ticker.Stop()
+	}
+	saveSnapshot := false
+mainLoop:
+	for {
+		select {
+		case <-ticker.C:
+			if quiet || !stdoutTTY {
+				l := log.WithFields(log.Fields{
+					"t": engine.Executor.GetTime(),
+					"i": engine.Executor.GetIterations(),
 				})
-				if err != nil {
-					panic(err) // This should never happen!!
+				fn := l.Info
+				if quiet {
+					fn = l.Debug
 				}
-				_, _ = http.Post(u, mime, bytes.NewBuffer(body))
-			}()
-		}
-
-		// Prepare a progress bar.
-		progress := ui.ProgressBar{
-			Width: 60,
-			Left: func() string {
 				if engine.Executor.IsPaused() {
-					return "  paused"
-				} else if engine.Executor.IsRunning() {
-					return " running"
+					fn("Paused")
 				} else {
-					return "    done"
-				}
-			},
-			Right: func() string {
-				if endIt := engine.Executor.GetEndIterations(); endIt.Valid {
-					return fmt.Sprintf("%d / %d", engine.Executor.GetIterations(), endIt.Int64)
-				}
-				precision := 100 * time.Millisecond
-				atT := engine.Executor.GetTime()
-				stagesEndT := lib.SumStages(engine.Executor.GetStages())
-				endT := engine.Executor.GetEndTime()
-				if !endT.Valid || (stagesEndT.Valid && endT.Duration > stagesEndT.Duration) {
-					endT = stagesEndT
-				}
-				if endT.Valid {
-					return fmt.Sprintf("%s / %s",
-						(atT/precision)*precision,
-						(time.Duration(endT.Duration)/precision)*precision,
-					)
-				}
-				return ((atT / precision) * precision).String()
-			},
-		}
-
-		// Ticker for progress bar updates. Less frequent updates for non-TTYs, none if quiet.
-		updateFreq := 50 * time.Millisecond
-		if !stdoutTTY {
-			updateFreq = 1 * time.Second
-		}
-		ticker := time.NewTicker(updateFreq)
-		if quiet || conf.HttpDebug.Valid && conf.HttpDebug.String != "" {
-			ticker.Stop()
-		}
-	mainLoop:
-		for {
-			select {
-			case <-ticker.C:
-				if quiet || !stdoutTTY {
-					l := log.WithFields(log.Fields{
-						"t": engine.Executor.GetTime(),
-						"i": engine.Executor.GetIterations(),
-					})
-					fn := l.Info
-					if quiet {
-						fn = l.Debug
-					}
-					if engine.Executor.IsPaused() {
-						fn("Paused")
-					} else {
-						fn("Running")
-					}
-					break
+					fn("Running")
 				}
+				break
+			}
 
-				var prog float64
-				if endIt := engine.Executor.GetEndIterations(); endIt.Valid {
-					prog = float64(engine.Executor.GetIterations()) / float64(endIt.Int64)
-				} else {
-					stagesEndT := lib.SumStages(engine.Executor.GetStages())
-					endT := engine.Executor.GetEndTime()
-					if !endT.Valid || (stagesEndT.Valid && endT.Duration > stagesEndT.Duration) {
-						endT = stagesEndT
-					}
-					if endT.Valid {
-						prog = float64(engine.Executor.GetTime()) / float64(endT.Duration)
-					}
-				}
-				progress.Progress = prog
-				fprintf(stdout, "%s\x1b[0K\r", progress.String())
-			case err := <-errC:
-				cancel()
-				if err == nil {
-					log.Debug("Engine terminated cleanly")
-					break mainLoop
-				}
+			progress.Progress = engine.GetProgress().Fraction.Float64
+			fprintf(stdout, "%s\x1b[0K\r", progress.String())
+		case <-topNC:
+			lines := ui.TopNPanel(topN.Rotate(), int(conf.LiveTopN.Int64), liveTopNInterval)
+			if !stdoutTTY {
+				fprintf(stdout, "%s\n", strings.Join(lines, "\n"))
+				break
+			}
+			// Redraw the panel in place, right above the progress bar.
+			cursor := "\r"
+			if topNLines > 0 {
+				cursor += fmt.Sprintf("\x1b[%dA", topNLines)
+			}
+			fprintf(stdout, "%s%s\x1b[0K\n", cursor, strings.Join(lines, "\x1b[0K\n"))
+			topNLines = len(lines)
+		case err := <-errC:
+			cancel()
+			if err == nil {
+				log.Debug("Engine terminated cleanly")
+				break mainLoop
+			}
 
-				switch e := errors.Cause(err).(type) {
-				case lib.TimeoutError:
-					switch string(e) {
-					case "setup":
-						log.WithError(err).Error("Setup timeout")
-						return ExitCode{errors.New("Setup timeout"), setupTimeoutErrorCode}
-					case "teardown":
-						log.WithError(err).Error("Teardown timeout")
-						return ExitCode{errors.New("Teardown timeout"), teardownTimeoutErrorCode}
-					default:
-						log.WithError(err).Error("Engine timeout")
-						return ExitCode{errors.New("Engine timeout"), genericTimeoutErrorCode}
-					}
+			switch e := errors.Cause(err).(type) {
+			case lib.TimeoutError:
+				switch string(e) {
+				case "setup":
+					log.WithError(err).Error("Setup timeout")
+					return ExitCode{errors.New("Setup timeout"), setupTimeoutErrorCode}
+				case "teardown":
+					log.WithError(err).Error("Teardown timeout")
+					return ExitCode{errors.New("Teardown timeout"), teardownTimeoutErrorCode}
 				default:
-					log.WithError(err).Error("Engine error")
-					return ExitCode{errors.New("Engine Error"), genericEngineErrorCode}
+					log.WithError(err).Error("Engine timeout")
+					return ExitCode{errors.New("Engine timeout"), genericTimeoutErrorCode}
 				}
-			case sig := <-sigC:
-				log.WithField("sig", sig).Debug("Exiting in response to signal")
-				cancel()
+			default:
+				log.WithError(err).Error("Engine error")
+				return ExitCode{errors.New("Engine Error"), genericEngineErrorCode}
 			}
-		}
-		if quiet || !stdoutTTY {
-			e := log.WithFields(log.Fields{
-				"t": engine.Executor.GetTime(),
-				"i": engine.Executor.GetIterations(),
-			})
-			fn := e.Info
-			if quiet {
-				fn = e.Debug
+		case sig := <-run.sigC:
+			log.WithField("sig", sig).Debug("Exiting in response to signal")
+			run.interrupted = true
+			if sig == syscall.SIGTERM && runSnapshotFile != "" {
+				saveSnapshot = true
 			}
-			fn("Test finished")
-		} else {
-			progress.Progress = 1
-			fprintf(stdout, "%s\x1b[0K\n", progress.String())
+			cancel()
 		}
+	}
+	if quiet || !stdoutTTY {
+		e := log.WithFields(log.Fields{
+			"t": engine.Executor.GetTime(),
+			"i": engine.Executor.GetIterations(),
+		})
+		fn := e.Info
+		if quiet {
+			fn = e.Debug
+		}
+		fn("Test finished")
+	} else {
+		progress.Progress = 1
+		fprintf(stdout, "%s\x1b[0K\n", progress.String())
+	}
 
-		// Warn if no iterations could be completed.
-		if engine.Executor.GetIterations() == 0 {
-			log.Warn("No data generated, because no script iterations finished, consider making the test duration longer")
+	if saveSnapshot {
+		if err := writeSnapshotFile(fs, runSnapshotFile, engine); err != nil {
+			return err
 		}
+		log.WithField("file", runSnapshotFile).Info("Test state saved, use `k6 resume` to continue the test")
+	}
 
-		// Print the end-of-test summary.
-		if !conf.NoSummary.Bool {
-			fprintf(stdout, "\n")
-			ui.Summarize(stdout, "", ui.SummaryData{
-				Opts:    conf.Options,
-				Root:    engine.Executor.GetRunner().GetDefaultGroup(),
-				Metrics: engine.Metrics,
-				Time:    engine.Executor.GetTime(),
-			})
-			fprintf(stdout, "\n")
-		}
+	// Warn if no iterations could be completed.
+	if engine.Executor.GetIterations() == 0 {
+		log.Warn("No data generated, because no script iterations finished, consider making the test duration longer")
+	}
 
-		if conf.Linger.Bool {
-			log.Info("Linger set; waiting for Ctrl+C...")
-			<-sigC
+	// Print the end-of-test summary.
+	if !conf.NoSummary.Bool {
+		fprintf(stdout, "\n")
+		ui.Summarize(stdout, "", ui.SummaryData{
+			Opts:    conf.Options,
+			Root:    engine.Executor.GetRunner().GetDefaultGroup(),
+			Metrics: engine.Metrics,
+			Time:    engine.Executor.GetTime(),
+		})
+		fprintf(stdout, "\n")
+	}
+	if filename := conf.EndpointsExport.String; filename != "" {
+		if err := writeEndpointsReport(fs, filename, topN.Report()); err != nil {
+			return err
 		}
+	}
+	if capacity, ok := engine.AdaptiveCapacity(); ok {
+		fprintf(stdout, "  adaptive load: %s holds up to %s requests per second\n\n",
+			ui.ValueColor.Sprint(conf.AdaptiveLoad.Threshold), ui.ValueColor.Sprintf("%.0f", capacity))
+	}
+	anomalies := engine.Anomalies()
+	for _, anomaly := range anomalies {
+		fprintf(stdout, "  %s %s\n", ui.FailColor.Sprint("anomaly:"), anomaly)
+	}
+	if len(anomalies) > 0 {
+		fprintf(stdout, "\n")
+	}
 
-		if engine.IsTainted() {
-			return ExitCode{errors.New("some thresholds have failed"), thresholdHaveFailedErroCode}
-		}
-		return nil
-	},
+	run.linger = conf.Linger.Bool
+
+	if deadline.hasStopped() {
+		return ExitCode{errors.New("max duration exceeded"), maxDurationExceededErrCode}
+	}
+	if engine.IsTainted() {
+		return ExitCode{errors.New("some thresholds have failed"), thresholdHaveFailedErroCode}
+	}
+	if len(anomalies) > 0 && conf.AnomalyDetection.AbortOnAnomaly.Bool {
+		return ExitCode{errors.New("the test was aborted because of an anomaly"), anomalyDetectedErrCode}
+	}
+	return nil
 }
 
 func runCmdFlagSet() *pflag.FlagSet {
@@ -491,6 +665,10 @@ func runCmdFlagSet() *pflag.FlagSet {
 	flags.Lookup("no-setup").DefValue = falseStr
 	flags.BoolVar(&runNoTeardown, "no-teardown", runNoTeardown, "don't run teardown()")
 	flags.Lookup("no-teardown").DefValue = falseStr
+	flags.StringVar(&runSnapshotFile, "snapshot", runSnapshotFile, "save the test state to this `file` when terminated by SIGTERM")
+	flags.Lookup("snapshot").DefValue = ""
+	flags.StringVar(&runManifest, "manifest", runManifest, "also run the scripts listed in this `file`, one per line")
+	flags.Lookup("manifest").DefValue = ""
 	return flags
 }
 
@@ -517,6 +695,45 @@ func readSource(src, pwd string, fs afero.Fs, stdin io.Reader) (*lib.SourceData,
 	return loader.Load(fs, pwd, src)
 }
 
+// getRunFilenames returns the scripts to run, the ones in the arguments followed by the ones in
+// the manifest, if there's one. Manifests list a script per line, relative to their directory,
+// and can have blank lines and # comments.
+func getRunFilenames(fs afero.Fs, args []string, manifest string) ([]string, error) {
+	filenames := append([]string{}, args...)
+	if manifest != "" {
+		data, err := afero.ReadFile(fs, manifest)
+		if err != nil {
+			return nil, err
+		}
+		listed := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if path := filepath.Join(filepath.Dir(manifest), line); !filepath.IsAbs(line) {
+				if ok, _ := afero.Exists(fs, path); ok {
+					line = path
+				}
+			}
+			filenames = append(filenames, line)
+			listed++
+		}
+		if listed == 0 {
+			return nil, errors.Errorf("the manifest %s doesn't list any scripts", manifest)
+		}
+	}
+
+	if len(filenames) > 1 {
+		for _, filename := range filenames {
+			if filename == "-" {
+				return nil, errors.New("the script can only be read from stdin if it's the only one")
+			}
+		}
+	}
+	return filenames, nil
+}
+
 // Creates a new runner.
 func newRunner(src *lib.SourceData, typ string, fs afero.Fs, rtOpts lib.RuntimeOptions) (lib.Runner, error) {
 	switch typ {
@@ -525,7 +742,7 @@ func newRunner(src *lib.SourceData, typ string, fs afero.Fs, rtOpts lib.RuntimeO
 	case typeJS:
 		return js.New(src, fs, rtOpts)
 	case typeArchive:
-		arc, err := lib.ReadArchive(bytes.NewReader(src.Data))
+		arc, err := lib.ReadEncryptedArchive(bytes.NewReader(src.Data), rtOpts.ArchiveKey)
 		if err != nil {
 			return nil, err
 		}
@@ -540,6 +757,188 @@ func newRunner(src *lib.SourceData, typ string, fs afero.Fs, rtOpts lib.RuntimeO
 	}
 }
 
+// finalizeRunConfig fills in the VUs and end conditions that a test needs but that weren't
+// configured, the same way for `k6 run` and the tests that `k6 agent` is sent.
+func finalizeRunConfig(conf Config) Config {
+	// If -m/--max isn't specified, figure out the max that should be needed.
+	if !conf.VUsMax.Valid {
+		conf.VUsMax = null.NewInt(conf.VUs.Int64, conf.VUs.Valid)
+		for _, stage := range conf.Stages {
+			if stage.Target.Valid && stage.Target.Int64 > conf.VUsMax.Int64 {
+				conf.VUsMax = stage.Target
+			}
+		}
+	}
+
+	// If -d/--duration, -i/--iterations and -s/--stage are all unset, run to one iteration.
+	if !conf.Duration.Valid && !conf.Iterations.Valid && len(conf.Stages) == 0 {
+		conf.Iterations = null.IntFrom(1)
+	}
+
+	if conf.Iterations.Valid && conf.Iterations.Int64 < conf.VUsMax.Int64 {
+		log.Warnf(
+			"All iterations (%d in this test run) are shared between all VUs, so some of the %d VUs will not execute even a single iteration!",
+			conf.Iterations.Int64, conf.VUsMax.Int64,
+		)
+	}
+
+	//TODO: move a bunch of the logic above to a config "constructor" and to the Validate() method
+
+	// If duration is explicitly set to 0, it means run forever.
+	//TODO: just... handle this differently, e.g. as a part of the manual executor
+	if conf.Duration.Valid && conf.Duration.Duration == 0 {
+		conf.Duration = types.NullDuration{}
+	}
+	return conf
+}
+
+// addCollectors creates the outputs of the test, and assigns them to the engine.
+func addCollectors(engine *core.Engine, conf Config, src *lib.SourceData) error {
+	for _, out := range conf.Out {
+		t, arg := parseCollector(out)
+		collector, err := newCollector(t, arg, src, conf)
+		if err != nil {
+			return err
+		}
+		if err := collector.Init(); err != nil {
+			return err
+		}
+		engine.Collectors = append(engine.Collectors, collector)
+		if period := conf.CollectorPeriods[t]; period.Valid {
+			engine.SetCollectorPeriod(collector, time.Duration(period.Duration))
+		}
+		aggregation := conf.AggregationPeriod
+		if period := conf.AggregationPeriods[t]; period.Valid {
+			aggregation = period
+		}
+		if aggregation.Valid {
+			engine.SetCollectorAggregation(collector, time.Duration(aggregation.Duration))
+		}
+		if rules := conf.Relabel[t]; len(rules) > 0 {
+			engine.SetCollectorRelabeling(collector, stats.NewRelabeler(rules))
+		}
+	}
+	return nil
+}
+
+// instanceLocation describes the region and zone of this instance, if they're set.
+func instanceLocation(opts lib.Options) string {
+	var parts []string
+	if opts.Region.String != "" {
+		parts = append(parts, "region "+opts.Region.String)
+	}
+	if opts.Zone.String != "" {
+		parts = append(parts, "zone "+opts.Zone.String)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runDeadline enforces the maxDuration wall-clock cap on the whole k6 process. Shortly before
+// it's reached, the test is gracefully stopped, so teardown() can still run and the results can
+// be reported. If k6 is still running when the cap is reached, it exits immediately with
+// maxDurationExceededErrCode, without waiting for anything, so it can never hang a CI pipeline.
+type runDeadline struct {
+	start     time.Time
+	timer     *time.Timer
+	stopTimer *time.Timer
+	stopped   int32
+}
+
+func newRunDeadline() *runDeadline {
+	return &runDeadline{start: time.Now()}
+}
+
+// set (re)arms the deadline, measuring the supplied duration from the start of the k6 process.
+// If a stop function is supplied, it's called gracePeriod before the deadline, or at its halfway
+// point, if that's later.
+func (d *runDeadline) set(maxDuration types.NullDuration, gracePeriod time.Duration, stop func()) {
+	d.stop()
+	if !maxDuration.Valid || maxDuration.Duration <= 0 {
+		return
+	}
+	remaining := time.Duration(maxDuration.Duration) - time.Since(d.start)
+	d.timer = time.AfterFunc(remaining, func() {
+		log.WithField("maxDuration", maxDuration.Duration).Error("Max duration exceeded, aborting k6")
+		os.Exit(maxDurationExceededErrCode)
+	})
+
+	if stop != nil {
+		stopAt := time.Duration(maxDuration.Duration) - gracePeriod
+		if half := time.Duration(maxDuration.Duration) / 2; stopAt < half {
+			stopAt = half
+		}
+		d.stopTimer = time.AfterFunc(stopAt-time.Since(d.start), func() {
+			log.WithField("maxDuration", maxDuration.Duration).Warn("Max duration reached, stopping the test")
+			atomic.StoreInt32(&d.stopped, 1)
+			stop()
+		})
+	}
+}
+
+// hasStopped returns whether the test was stopped because the deadline was approaching.
+func (d *runDeadline) hasStopped() bool {
+	return atomic.LoadInt32(&d.stopped) == 1
+}
+
+func (d *runDeadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.stopTimer != nil {
+		d.stopTimer.Stop()
+		d.stopTimer = nil
+	}
+}
+
+// Reads a previously saved engine snapshot from the supplied file.
+func readSnapshotFile(fs afero.Fs, filename string) (*core.Snapshot, error) {
+	if filename == "" {
+		return nil, errors.New("no snapshot file was specified, use the --snapshot flag")
+	}
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return core.ReadSnapshot(f)
+}
+
+// Saves a snapshot of the current engine state to the supplied file.
+func writeSnapshotFile(fs afero.Fs, filename string, engine *core.Engine) error {
+	snapshot, err := engine.Snapshot()
+	if err != nil {
+		return err
+	}
+	f, err := fs.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeEndpointsReport writes the endpoints report to filename, as CSV if it has a .csv
+// extension and as JSON otherwise.
+func writeEndpointsReport(fs afero.Fs, filename string, entries []topn.ReportEntry) error {
+	f, err := fs.Create(filename)
+	if err != nil {
+		return err
+	}
+	write := topn.WriteReportJSON
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		write = topn.WriteReportCSV
+	}
+	if err := write(f, entries); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func detectType(data []byte) string {
 	if _, err := tar.NewReader(bytes.NewReader(data)).Next(); err == nil {
 		return typeArchive
@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestRunDeadlineGracefulStop(t *testing.T) {
+	t.Parallel()
+	testdata := map[string]struct {
+		maxDuration, gracePeriod, expStop time.Duration
+	}{
+		"grace period":  {1 * time.Second, 200 * time.Millisecond, 800 * time.Millisecond},
+		"halfway point": {400 * time.Millisecond, 10 * time.Second, 200 * time.Millisecond},
+	}
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			d := newRunDeadline()
+			stopped := make(chan time.Duration, 1)
+			d.set(types.NullDurationFrom(data.maxDuration), data.gracePeriod, func() {
+				stopped <- time.Since(d.start)
+			})
+			select {
+			case at := <-stopped:
+				d.stop() // make sure the process isn't terminated
+				assert.InDelta(t, data.expStop, at, float64(100*time.Millisecond))
+				assert.True(t, d.hasStopped())
+			case <-time.After(data.expStop + time.Second):
+				d.stop()
+				t.Fatal("the test wasn't stopped in time")
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		d := newRunDeadline()
+		d.set(types.NullDuration{}, 0, func() { t.Error("unexpected stop") })
+		assert.Nil(t, d.timer)
+		assert.Nil(t, d.stopTimer)
+		assert.False(t, d.hasStopped())
+	})
+}
+
+func TestInstanceLocation(t *testing.T) {
+	assert.Equal(t, "", instanceLocation(lib.Options{}))
+	assert.Equal(t, "region eu-west", instanceLocation(lib.Options{Region: null.StringFrom("eu-west")}))
+	assert.Equal(t, "region eu-west, zone b", instanceLocation(lib.Options{
+		Region: null.StringFrom("eu-west"), Zone: null.StringFrom("b"),
+	}))
+}
+
+func TestGetRunFilenames(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/suite/a.js", []byte(""), 0644))
+	require.NoError(t, afero.WriteFile(fs, "/suite/nightly.txt", []byte(`
+# The nightly suite
+a.js
+  /abs/b.js
+
+https://example.com/c.js
+`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "/suite/empty.txt", []byte("# nothing\n"), 0644))
+
+	filenames, err := getRunFilenames(fs, []string{"x.js"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x.js"}, filenames)
+
+	filenames, err = getRunFilenames(fs, []string{"x.js"}, "/suite/nightly.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x.js", "/suite/a.js", "/abs/b.js", "https://example.com/c.js"}, filenames)
+
+	_, err = getRunFilenames(fs, nil, "/suite/empty.txt")
+	assert.EqualError(t, err, "the manifest /suite/empty.txt doesn't list any scripts")
+	_, err = getRunFilenames(fs, nil, "/suite/missing.txt")
+	assert.Error(t, err)
+	_, err = getRunFilenames(fs, []string{"-", "x.js"}, "")
+	assert.Error(t, err)
+}
@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 )
@@ -53,6 +54,11 @@ func runtimeOptionFlagSet(includeSysEnv bool) *pflag.FlagSet {
 	flags.SortFlags = false
 	flags.Bool("include-system-env-vars", includeSysEnv, "pass the real system environment variables to the runtime")
 	flags.StringSliceP("env", "e", nil, "add/override environment variable with `VAR=value`")
+	flags.StringSlice("secret", nil, "add an environment variable resolved at run time with `VAR=source:key`, e.g. DB_PASSWORD=file:/run/secrets/db (never saved in archives)")
+	flags.String("secret-source", "", "the default `source` of the secrets that scripts read with k6/secrets, e.g. env, file, vault or aws")
+	flags.String("archive-key", "", "a `source:key` secret with the hex or base64 encoded 256-bit key for encrypted archives, e.g. env:ARCHIVE_KEY")
+	flags.StringSlice("exec-allow", nil, "allow setup() and teardown() to run the `command` with the k6/exec module")
+	flags.String("artifacts-dir", "", "allow teardown() to write files in the `directory` with the k6/artifacts module")
 	return flags
 }
 
@@ -83,5 +89,50 @@ func getRuntimeOptions(flags *pflag.FlagSet) (lib.RuntimeOptions, error) {
 		}
 	}
 
+	secretVars, err := flags.GetStringSlice("secret")
+	if err != nil {
+		return opts, err
+	}
+	if len(secretVars) > 0 {
+		opts.Secrets = make(map[string]string, len(secretVars))
+		for _, kv := range secretVars {
+			k, spec := parseEnvKeyValue(kv)
+			if !userEnvVarName.MatchString(k) {
+				return opts, errors.Errorf("Invalid secret variable name '%s'", k)
+			}
+			value, err := secrets.Resolve(spec)
+			if err != nil {
+				return opts, err
+			}
+			opts.Secrets[k] = value
+		}
+	}
+
+	opts.SecretSource = getNullString(flags, "secret-source")
+
+	archiveKey, err := flags.GetString("archive-key")
+	if err != nil {
+		return opts, err
+	}
+	if archiveKey != "" {
+		value, err := secrets.Resolve(archiveKey)
+		if err != nil {
+			return opts, errors.Wrap(err, "archive-key")
+		}
+		if opts.ArchiveKey, err = lib.ParseArchiveKey(value); err != nil {
+			return opts, err
+		}
+	}
+
+	execAllow, err := flags.GetStringSlice("exec-allow")
+	if err != nil {
+		return opts, err
+	}
+	if len(execAllow) > 0 {
+		opts.ExecAllow = execAllow
+	}
+
+	opts.ArtifactsDir = getNullString(flags, "artifacts-dir")
+
 	return opts, nil
 }
@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"runtime"
@@ -29,9 +30,11 @@ import (
 	"testing"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
 )
 
 var envVars []string
@@ -256,3 +259,80 @@ func TestEnvVars(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretsAndArchiveKey(t *testing.T) {
+	require.NoError(t, os.Setenv("K6_TEST_DB_PASSWORD", "hunter2"))
+	require.NoError(t, os.Setenv("K6_TEST_ARCHIVE_KEY", strings.Repeat("ab", 32)))
+	defer func() {
+		_ = os.Unsetenv("K6_TEST_DB_PASSWORD")
+		_ = os.Unsetenv("K6_TEST_ARCHIVE_KEY")
+	}()
+
+	flags := runtimeOptionFlagSet(false)
+	require.NoError(t, flags.Parse([]string{
+		"--secret", "DB_PASSWORD=env:K6_TEST_DB_PASSWORD",
+		"--archive-key", "env:K6_TEST_ARCHIVE_KEY",
+	}))
+	rtOpts, err := getRuntimeOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DB_PASSWORD": "hunter2"}, rtOpts.Secrets)
+	assert.Len(t, rtOpts.ArchiveKey, 32)
+	assert.Nil(t, rtOpts.ExecAllow)
+
+	jsCode := `export default function() {
+		if (__ENV.DB_PASSWORD !== "hunter2") { throw new Error("Invalid DB_PASSWORD: " + __ENV.DB_PASSWORD); }
+	}`
+	runner, err := newRunner(
+		&lib.SourceData{Data: []byte(jsCode), Filename: "/script.js"},
+		typeJS, afero.NewMemMapFs(), rtOpts,
+	)
+	require.NoError(t, err)
+
+	archiveBuf := &bytes.Buffer{}
+	require.NoError(t, runner.MakeArchive().WriteEncrypted(archiveBuf, rtOpts.ArchiveKey))
+	assert.NotContains(t, archiveBuf.String(), "hunter2")
+	assert.NotContains(t, archiveBuf.String(), "DB_PASSWORD")
+
+	arcSrc := &lib.SourceData{Data: archiveBuf.Bytes(), Filename: "/script.tar"}
+	_, err = newRunner(arcSrc, typeArchive, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	assert.EqualError(t, err, "the archive is encrypted, an archive key is needed to read it")
+
+	arcRunner, err := newRunner(arcSrc, typeArchive, afero.NewMemMapFs(), rtOpts)
+	require.NoError(t, err)
+	vu, err := arcRunner.NewVU(make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	assert.NoError(t, vu.RunOnce(context.Background()))
+
+	t.Run("Invalid", func(t *testing.T) {
+		testdata := map[string][]string{
+			"unknown secret source 'nope'":                         {"--secret", "A=nope:b"},
+			"Invalid secret variable name '1A'":                    {"--secret", "1A=env:K6_TEST_DB_PASSWORD"},
+			"the archive key must be either hex or base64 encoded": {"--archive-key", "env:K6_TEST_DB_PASSWORD"},
+			"archive-key: invalid secret":                          {"--archive-key", "deadbeef"},
+		}
+		for msg, args := range testdata {
+			flags := runtimeOptionFlagSet(false)
+			require.NoError(t, flags.Parse(args))
+			_, err := getRuntimeOptions(flags)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), msg)
+			}
+		}
+	})
+}
+
+func TestExecAllow(t *testing.T) {
+	flags := runtimeOptionFlagSet(false)
+	require.NoError(t, flags.Parse([]string{"--exec-allow", "psql,./seed.sh", "--exec-allow", "make"}))
+	rtOpts, err := getRuntimeOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"psql", "./seed.sh", "make"}, rtOpts.ExecAllow)
+}
+
+func TestArtifactsDir(t *testing.T) {
+	flags := runtimeOptionFlagSet(false)
+	require.NoError(t, flags.Parse([]string{"--artifacts-dir", "results/"}))
+	rtOpts, err := getRuntimeOptions(flags)
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("results/"), rtOpts.ArtifactsDir)
+}
@@ -0,0 +1,201 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// adaptiveLoad searches for the maximum requests per second at which the threshold of the
+// adaptiveLoad option holds. Every window, the threshold is evaluated on the samples of that
+// window: the rate is doubled until the threshold fails once, and then bisected between the
+// highest passing and the lowest failing rate until they're within the precision of each other.
+type adaptiveLoad struct {
+	config     lib.AdaptiveLoadConfig
+	thresholds stats.Thresholds
+	limiter    *rate.Limiter
+
+	mu      sync.Mutex
+	sink    stats.Sink // The samples of the current window, nil until there are any
+	rate    float64
+	passing float64 // The highest rate that the threshold held at, or 0
+	failing float64 // The lowest rate that the threshold failed at, or 0
+
+	converged bool
+	capacity  float64
+}
+
+func newAdaptiveLoad(config lib.AdaptiveLoadConfig) (*adaptiveLoad, error) {
+	thresholds, err := stats.NewThresholds([]string{config.Threshold})
+	if err != nil {
+		return nil, err
+	}
+	start := config.GetStartRate()
+	return &adaptiveLoad{
+		config:     config,
+		thresholds: thresholds,
+		limiter:    rate.NewLimiter(rate.Limit(start), 1),
+		rate:       start,
+	}, nil
+}
+
+// getRate returns the rate that requests are currently limited to.
+func (a *adaptiveLoad) getRate() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rate
+}
+
+// getCapacity returns the discovered capacity, and whether the search is over.
+func (a *adaptiveLoad) getCapacity() (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.capacity, a.converged
+}
+
+// add adds the samples of the metric that the threshold is evaluated on to the current window.
+func (a *adaptiveLoad) add(sampleContainers []stats.SampleContainer) {
+	metric := a.config.GetMetric()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.converged {
+		return
+	}
+	for _, sc := range sampleContainers {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric.Name != metric {
+				continue
+			}
+			if a.sink == nil {
+				a.sink = stats.New(metric, sample.Metric.Type).Sink
+			}
+			a.sink.Add(sample)
+		}
+	}
+}
+
+func (a *adaptiveLoad) run(ctx context.Context, logger *log.Logger) {
+	window := a.config.GetWindow()
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if a.evaluate(window, logger) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluate evaluates the threshold on the samples of the window that just ended and moves on to
+// the next rate. It returns true once the search is over.
+func (a *adaptiveLoad) evaluate(window time.Duration, logger *log.Logger) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sink := a.sink
+	a.sink = nil
+	if sink == nil {
+		logger.WithField("rate", a.rate).Debug("Adaptive load: no samples in the last window")
+		return false
+	}
+	passed, err := a.thresholds.Run(sink, window)
+	if err != nil {
+		logger.WithError(err).Error("Adaptive load: couldn't evaluate the threshold")
+		return false
+	}
+
+	if passed {
+		a.passing = math.Max(a.passing, a.rate)
+	} else if a.failing == 0 || a.rate < a.failing {
+		a.failing = a.rate
+	}
+
+	maxRate := a.config.GetMaxRate()
+	switch {
+	case passed && maxRate > 0 && a.rate >= maxRate:
+		a.converge(maxRate)
+	case !passed && a.rate <= 1:
+		a.converge(0)
+	case a.failing == 0:
+		next := a.rate * 2
+		if maxRate > 0 {
+			next = math.Min(next, maxRate)
+		}
+		a.setRate(next)
+	case a.failing-a.passing <= a.config.GetPrecision()*a.failing:
+		a.converge(a.passing)
+	default:
+		a.setRate(math.Max((a.passing+a.failing)/2, 1))
+	}
+
+	logger.WithFields(log.Fields{
+		"threshold": a.config.Threshold,
+		"passed":    passed,
+		"rate":      a.rate,
+	}).Debug("Adaptive load: evaluated the threshold")
+	if a.converged {
+		logger.Infof(
+			"Adaptive load: '%s' holds up to %.0f requests per second", a.config.Threshold, a.capacity,
+		)
+	}
+	return a.converged
+}
+
+// converge ends the search and holds the load at the capacity, or at the minimal rate if the
+// threshold doesn't hold at any rate.
+func (a *adaptiveLoad) converge(capacity float64) {
+	a.converged = true
+	a.capacity = capacity
+	a.setRate(math.Max(capacity, 1))
+}
+
+func (a *adaptiveLoad) setRate(r float64) {
+	a.rate = r
+	a.limiter.SetLimit(rate.Limit(r))
+}
+
+// report logs the result of the search at the end of the test.
+func (a *adaptiveLoad) report(logger *log.Logger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.converged {
+		return
+	}
+	fields := log.Fields{"threshold": a.config.Threshold, "passing": a.passing}
+	if a.failing > 0 {
+		fields["failing"] = a.failing
+	}
+	logger.WithFields(fields).Warn("Adaptive load: the test ended before the capacity was found")
+}
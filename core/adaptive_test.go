@@ -0,0 +1,120 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// searchCapacity runs the adaptive load search against a system whose request duration in
+// milliseconds equals the request rate, until the search is over.
+func searchCapacity(t *testing.T, config lib.AdaptiveLoadConfig) (*adaptiveLoad, int) {
+	a, err := newAdaptiveLoad(config)
+	require.NoError(t, err)
+	logger, _ := logtest.NewNullLogger()
+
+	for windows := 1; windows <= 100; windows++ {
+		a.add([]stats.SampleContainer{stats.Sample{
+			Metric: metrics.HTTPReqDuration,
+			Value:  a.getRate(),
+		}})
+		if a.evaluate(time.Second, logger) {
+			return a, windows
+		}
+	}
+	t.Fatal("the search didn't converge")
+	return nil, 0
+}
+
+func TestAdaptiveLoad(t *testing.T) {
+	t.Run("capacity", func(t *testing.T) {
+		a, _ := searchCapacity(t, lib.AdaptiveLoadConfig{Threshold: "p(95)<300"})
+		capacity, ok := a.getCapacity()
+		assert.True(t, ok)
+		assert.True(t, capacity < 300 && capacity >= 300*(1-lib.DefaultAdaptivePrecision), "capacity: %f", capacity)
+		assert.Equal(t, capacity, a.getRate())
+		assert.Equal(t, capacity, float64(a.limiter.Limit()))
+	})
+	t.Run("precision", func(t *testing.T) {
+		_, coarse := searchCapacity(t, lib.AdaptiveLoadConfig{Threshold: "p(95)<300", Precision: null.FloatFrom(0.2)})
+		_, fine := searchCapacity(t, lib.AdaptiveLoadConfig{Threshold: "p(95)<300", Precision: null.FloatFrom(0.01)})
+		assert.True(t, coarse < fine, "%d windows aren't fewer than %d", coarse, fine)
+	})
+	t.Run("max rate", func(t *testing.T) {
+		a, _ := searchCapacity(t, lib.AdaptiveLoadConfig{Threshold: "p(95)<300", MaxRate: null.IntFrom(100)})
+		capacity, ok := a.getCapacity()
+		assert.True(t, ok)
+		assert.Equal(t, 100.0, capacity)
+	})
+	t.Run("never holds", func(t *testing.T) {
+		a, _ := searchCapacity(t, lib.AdaptiveLoadConfig{Threshold: "p(95)<1"})
+		capacity, ok := a.getCapacity()
+		assert.True(t, ok)
+		assert.Equal(t, 0.0, capacity)
+		assert.Equal(t, 1.0, a.getRate())
+	})
+	t.Run("no samples", func(t *testing.T) {
+		a, err := newAdaptiveLoad(lib.AdaptiveLoadConfig{Threshold: "p(95)<300"})
+		require.NoError(t, err)
+		logger, _ := logtest.NewNullLogger()
+
+		a.add([]stats.SampleContainer{stats.Sample{Metric: metrics.HTTPReqWaiting, Value: 1000}})
+		assert.False(t, a.evaluate(time.Second, logger))
+		assert.Equal(t, 10.0, a.getRate())
+	})
+	t.Run("engine", func(t *testing.T) {
+		opts := lib.Options{
+			VUs:          null.IntFrom(1),
+			VUsMax:       null.IntFrom(1),
+			Iterations:   null.IntFrom(1),
+			AdaptiveLoad: &lib.AdaptiveLoadConfig{Threshold: "p(95)<300", StartRate: null.IntFrom(20)},
+		}
+		var limiters int
+		e, err := newTestEngine(LF(func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			limiters = len(lib.GetRPSLimiters(ctx))
+			return nil
+		}), opts)
+		require.NoError(t, err)
+		logger, hook := logtest.NewNullLogger()
+		e.SetLogger(logger)
+
+		require.NoError(t, e.Run(context.Background()))
+		assert.Equal(t, 1, limiters)
+		require.Contains(t, e.Metrics, "adaptive_rate")
+		assert.Equal(t, 20.0, e.Metrics["adaptive_rate"].Sink.Format(0)["value"])
+
+		_, ok := e.AdaptiveCapacity()
+		assert.False(t, ok)
+		require.NotNil(t, hook.LastEntry())
+		assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	})
+}
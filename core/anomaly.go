@@ -0,0 +1,166 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// anomalyDetector watches the p(95) of http_req_duration and the rate of failed HTTP requests
+// (the ones with a status of 0 or 400 and above) over consecutive windows, and reports the ones
+// that degrade steadily, as configured by the anomalyDetection option.
+type anomalyDetector struct {
+	config lib.AnomalyDetectionConfig
+
+	mu        sync.Mutex
+	durations *stats.TrendSink // The samples of the current window
+	requests  int64
+	failed    int64
+
+	// The values of the last windows, oldest first.
+	latencies  []float64
+	errorRates []float64
+
+	anomalies []string
+}
+
+func newAnomalyDetector(config lib.AnomalyDetectionConfig) *anomalyDetector {
+	return &anomalyDetector{config: config, durations: &stats.TrendSink{}}
+}
+
+// getAnomalies returns the descriptions of all of the anomalies that were detected so far.
+func (d *anomalyDetector) getAnomalies() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.anomalies...)
+}
+
+func (d *anomalyDetector) add(sampleContainers []stats.SampleContainer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, sc := range sampleContainers {
+		for _, sample := range sc.GetSamples() {
+			switch sample.Metric.Name {
+			case metrics.HTTPReqDuration.Name:
+				d.durations.Add(sample)
+			case metrics.HTTPReqs.Name:
+				d.requests++
+				if status, ok := sample.Tags.Get("status"); ok {
+					if code, err := strconv.Atoi(status); err == nil && (code == 0 || code >= 400) {
+						d.failed++
+					}
+				}
+			}
+		}
+	}
+}
+
+// run detects anomalies every window, until ctx is done or, if the test is aborted on anomalies,
+// until the first one is detected and abort is called.
+func (d *anomalyDetector) run(ctx context.Context, logger *log.Logger, abort func()) {
+	ticker := time.NewTicker(d.config.GetWindow())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			anomalies := d.evaluate()
+			for _, anomaly := range anomalies {
+				logger.Warn("Anomaly detected: " + anomaly)
+			}
+			if len(anomalies) > 0 && d.config.AbortOnAnomaly.Bool {
+				logger.Warn("Aborting the test because of the detected anomalies")
+				abort()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluate ends the current window and returns the anomalies that it revealed. Windows without
+// any requests are skipped.
+func (d *anomalyDetector) evaluate() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	windows := d.config.GetWindows()
+	var anomalies []string
+	if d.durations.Count > 0 {
+		d.latencies = appendWindow(d.latencies, d.durations.P(0.95), windows)
+		if degrading(d.latencies, windows) && d.latencies[0] > 0 &&
+			d.latencies[windows-1]/d.latencies[0]-1 >= d.config.GetLatencyIncrease() {
+			anomalies = append(anomalies, fmt.Sprintf(
+				"the p(95) of %s rose for %d windows in a row, from %.2fms to %.2fms",
+				metrics.HTTPReqDuration.Name, windows, d.latencies[0], d.latencies[windows-1],
+			))
+			d.latencies = d.latencies[windows-1:]
+		}
+	}
+	if d.requests > 0 {
+		d.errorRates = appendWindow(d.errorRates, float64(d.failed)/float64(d.requests), windows)
+		if degrading(d.errorRates, windows) &&
+			d.errorRates[windows-1]-d.errorRates[0] >= d.config.GetErrorRateIncrease() {
+			anomalies = append(anomalies, fmt.Sprintf(
+				"the rate of failed HTTP requests rose for %d windows in a row, from %.2f%% to %.2f%%",
+				windows, d.errorRates[0]*100, d.errorRates[windows-1]*100,
+			))
+			d.errorRates = d.errorRates[windows-1:]
+		}
+	}
+
+	d.durations = &stats.TrendSink{}
+	d.requests, d.failed = 0, 0
+	d.anomalies = append(d.anomalies, anomalies...)
+	return anomalies
+}
+
+// appendWindow appends the value of a window, keeping only the values of the last windows.
+func appendWindow(values []float64, value float64, windows int) []float64 {
+	values = append(values, value)
+	if len(values) > windows {
+		values = values[len(values)-windows:]
+	}
+	return values
+}
+
+// degrading returns whether there are values for all of the windows and none of them is lower
+// than the one before it.
+func degrading(values []float64, windows int) bool {
+	if len(values) < windows {
+		return false
+	}
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return false
+		}
+	}
+	return true
+}
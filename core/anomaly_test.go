@@ -0,0 +1,117 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// addWindow adds the samples of a window with requests of the given duration, of which the
+// given number failed, and returns the anomalies that it revealed.
+func addWindow(d *anomalyDetector, duration float64, requests, failed int) []string {
+	var samples stats.Samples
+	for i := 0; i < requests; i++ {
+		status := "200"
+		if i < failed {
+			status = "503"
+		}
+		tags := stats.IntoSampleTags(&map[string]string{"status": status})
+		samples = append(samples,
+			stats.Sample{Metric: metrics.HTTPReqs, Value: 1, Tags: tags},
+			stats.Sample{Metric: metrics.HTTPReqDuration, Value: duration, Tags: tags},
+		)
+	}
+	d.add([]stats.SampleContainer{samples})
+	return d.evaluate()
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	t.Run("latency", func(t *testing.T) {
+		d := newAnomalyDetector(lib.AnomalyDetectionConfig{Windows: null.IntFrom(3)})
+		assert.Empty(t, addWindow(d, 100, 10, 0))
+		assert.Empty(t, addWindow(d, 110, 10, 0))
+		anomalies := addWindow(d, 130, 10, 0)
+		require.Len(t, anomalies, 1)
+		assert.Equal(t, "the p(95) of http_req_duration rose for 3 windows in a row, from 100.00ms to 130.00ms", anomalies[0])
+
+		// The degradation is only reported again once it went on for another 3 windows.
+		assert.Empty(t, addWindow(d, 140, 10, 0))
+		assert.Len(t, addWindow(d, 160, 10, 0), 1)
+		assert.Len(t, d.getAnomalies(), 2)
+	})
+	t.Run("latency not monotonic", func(t *testing.T) {
+		d := newAnomalyDetector(lib.AnomalyDetectionConfig{Windows: null.IntFrom(3)})
+		for _, duration := range []float64{100, 150, 120, 130, 140} {
+			assert.Len(t, addWindow(d, duration, 10, 0), 0)
+		}
+		assert.Equal(t, []float64{120, 130, 140}, d.latencies)
+	})
+	t.Run("latency below the increase", func(t *testing.T) {
+		d := newAnomalyDetector(lib.AnomalyDetectionConfig{Windows: null.IntFrom(3), LatencyIncrease: null.FloatFrom(0.5)})
+		for _, duration := range []float64{100, 110, 130, 140} {
+			assert.Empty(t, addWindow(d, duration, 10, 0))
+		}
+	})
+	t.Run("error rate", func(t *testing.T) {
+		d := newAnomalyDetector(lib.AnomalyDetectionConfig{Windows: null.IntFrom(3)})
+		assert.Empty(t, addWindow(d, 100, 100, 0))
+		assert.Empty(t, addWindow(d, 100, 100, 1))
+		assert.Empty(t, addWindow(d, 0, 0, 0))
+		anomalies := addWindow(d, 100, 100, 2)
+		require.Len(t, anomalies, 1)
+		assert.Equal(t, "the rate of failed HTTP requests rose for 3 windows in a row, from 0.00% to 2.00%", anomalies[0])
+	})
+	t.Run("abort", func(t *testing.T) {
+		opts := lib.Options{
+			VUs:    null.IntFrom(1),
+			VUsMax: null.IntFrom(1),
+			AnomalyDetection: &lib.AnomalyDetectionConfig{
+				Window:         types.NullDurationFrom(50 * time.Millisecond),
+				Windows:        null.IntFrom(2),
+				AbortOnAnomaly: null.BoolFrom(true),
+			},
+		}
+		duration := 100.0
+		e, err := newTestEngine(LF(func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			duration *= 2
+			out <- stats.Sample{Time: time.Now(), Metric: metrics.HTTPReqDuration, Value: duration}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}), opts)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		require.NoError(t, e.Run(ctx))
+		assert.NoError(t, ctx.Err())
+		assert.Len(t, e.Anomalies(), 1)
+	})
+}
@@ -22,6 +22,8 @@ package core
 
 import (
 	"context"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -29,7 +31,10 @@ import (
 	"github.com/loadimpact/k6/core/local"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/netext/httpext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/guregu/null.v3"
 )
@@ -66,8 +71,46 @@ type Engine struct {
 	thresholds map[string]stats.Thresholds
 	submetrics map[string][]*stats.Submetric
 
+	// The breakdown tags that this test needs submetrics for, and the "tag:value" suffixes of the
+	// breakdown submetrics that each metric already has.
+	breakdownTags       []string
+	breakdownSubmetrics map[string]map[string]bool
+
+	// Periods of the collectors that don't use the global collector period, and the buffers of
+	// samples for the collectors that are flushed less often than the samples are processed.
+	collectorPeriods map[lib.Collector]time.Duration
+	collectorBuffers map[lib.Collector]*collectorBuffer
+
+	// The aggregators of the collectors that only get aggregated samples.
+	collectorAggregators map[lib.Collector]*stats.Aggregator
+
+	// The relabelers of the collectors that get the samples with differently named tags.
+	collectorRelabelers map[lib.Collector]*stats.Relabeler
+
 	// Are thresholds tainted?
 	thresholdsTainted bool
+
+	// Strips or hashes the sensitive tags of all samples, if the redactTags option is set.
+	tagRedactor *stats.TagRedactor
+
+	// Searches for the capacity of the system under test, if the adaptiveLoad option is set.
+	adaptiveLoad *adaptiveLoad
+
+	// Detects a steady degradation of the latency or the error rate, if the anomalyDetection
+	// option is set.
+	anomalyDetector *anomalyDetector
+
+	// The errors of every host at the last emission of the host metrics.
+	hostErrors map[string]int64
+
+	// The metrics of the test by name, shared with the runner if it has its own, and the names
+	// that samples of a different type than the registered metric were dropped for.
+	registry        *stats.Registry
+	shadowedMetrics map[string]bool
+
+	// Closed when the test is stopped through Stop()
+	stopChan chan struct{}
+	stopOnce sync.Once
 }
 
 func NewEngine(ex lib.Executor, o lib.Options) (*Engine, error) {
@@ -80,9 +123,29 @@ func NewEngine(ex lib.Executor, o lib.Options) (*Engine, error) {
 		Options:  o,
 		Metrics:  make(map[string]*stats.Metric),
 		Samples:  make(chan stats.SampleContainer, o.MetricSamplesBufferSize.Int64),
+		stopChan: make(chan struct{}),
+
+		tagRedactor: stats.NewTagRedactor(o.RedactTags),
 	}
 	e.SetLogger(log.StandardLogger())
 
+	if runner, ok := ex.GetRunner().(lib.MetricRegistryRunner); ok {
+		e.registry = runner.GetMetricRegistry()
+	} else {
+		e.registry = metrics.NewRegistry()
+	}
+
+	if o.AdaptiveLoad != nil {
+		a, err := newAdaptiveLoad(*o.AdaptiveLoad)
+		if err != nil {
+			return nil, err
+		}
+		e.adaptiveLoad = a
+	}
+	if o.AnomalyDetection != nil {
+		e.anomalyDetector = newAnomalyDetector(*o.AnomalyDetection)
+	}
+
 	if err := ex.SetVUsMax(o.VUsMax.Int64); err != nil {
 		return nil, err
 	}
@@ -96,18 +159,157 @@ func NewEngine(ex lib.Executor, o lib.Options) (*Engine, error) {
 
 	e.thresholds = o.Thresholds
 	e.submetrics = make(map[string][]*stats.Submetric)
+	e.breakdownSubmetrics = make(map[string]map[string]bool)
 	for name := range e.thresholds {
 		if !strings.Contains(name, "{") {
 			continue
 		}
 
-		parent, sm := stats.NewSubmetric(name)
+		parent, sm, err := stats.NewSubmetric(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "threshold %s", name)
+		}
 		e.submetrics[parent] = append(e.submetrics[parent], sm)
 	}
+	e.breakdownTags = neededBreakdownTags(o, e.submetrics)
 
 	return e, nil
 }
 
+// SetCollectorPeriod makes the engine hand the collected samples to the given collector every
+// period, instead of at the global collector period.
+func (e *Engine) SetCollectorPeriod(c lib.Collector, period time.Duration) {
+	if e.collectorPeriods == nil {
+		e.collectorPeriods = make(map[lib.Collector]time.Duration)
+	}
+	e.collectorPeriods[c] = period
+}
+
+// SetCollectorAggregation makes the engine hand the given collector only aggregated samples, one per
+// series, i.e. per metric and tag set, and period, or a few for trends (see stats.Aggregator).
+func (e *Engine) SetCollectorAggregation(c lib.Collector, period time.Duration) {
+	if e.collectorAggregators == nil {
+		e.collectorAggregators = make(map[lib.Collector]*stats.Aggregator)
+	}
+	e.collectorAggregators[c] = stats.NewAggregator(period)
+}
+
+// SetCollectorRelabeling makes the engine apply the relabeling rules of the given relabeler to
+// the tags of the samples that the given collector gets, before they're aggregated.
+func (e *Engine) SetCollectorRelabeling(c lib.Collector, r *stats.Relabeler) {
+	if e.collectorRelabelers == nil {
+		e.collectorRelabelers = make(map[lib.Collector]*stats.Relabeler)
+	}
+	e.collectorRelabelers[c] = r
+}
+
+// Samples that are waiting to be handed to a collector with a longer period than the engine's.
+type collectorBuffer struct {
+	period    time.Duration
+	lastFlush time.Time
+	samples   []stats.SampleContainer
+}
+
+// collectPeriod returns the global collector period, i.e. how often the engine hands the
+// collected samples to the collectors that don't have their own period.
+func (e *Engine) collectPeriod() time.Duration {
+	if e.Options.CollectorPeriod.Valid {
+		return time.Duration(e.Options.CollectorPeriod.Duration)
+	}
+	return CollectRate
+}
+
+// initCollectorBuffers returns how often the collected samples should be processed, which is the
+// shortest of all collector periods, and sets up buffers for the collectors with longer ones.
+func (e *Engine) initCollectorBuffers(now time.Time) time.Duration {
+	periods := make(map[lib.Collector]time.Duration, len(e.Collectors))
+	tick := e.collectPeriod()
+	for _, c := range e.Collectors {
+		period, ok := e.collectorPeriods[c]
+		if !ok {
+			period = e.collectPeriod()
+		}
+		periods[c] = period
+		if period < tick {
+			tick = period
+		}
+	}
+
+	e.collectorBuffers = make(map[lib.Collector]*collectorBuffer)
+	for c, period := range periods {
+		if period > tick {
+			e.collectorBuffers[c] = &collectorBuffer{period: period, lastFlush: now}
+		}
+	}
+	return tick
+}
+
+// flushCollectorBuffers hands the buffered samples to the collectors whose period has elapsed,
+// or to all of them if force is set. Ticks can be a bit late, so each period is rounded to the
+// closest tick. The aggregated samples of the buckets that ended at least one aggregation period
+// ago are passed on first, since slower samples can still arrive until then, or those of all the
+// buckets if force is set.
+func (e *Engine) flushCollectorBuffers(now time.Time, tick time.Duration, force bool) {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	for c, agg := range e.collectorAggregators {
+		before := now.Add(-agg.Period)
+		if force {
+			before = time.Time{}
+		}
+		if samples := agg.Flush(before); len(samples) > 0 {
+			e.collect(c, samples)
+		}
+	}
+
+	for c, buf := range e.collectorBuffers {
+		if !force && now.Sub(buf.lastFlush) < buf.period-tick/2 {
+			continue
+		}
+		if len(buf.samples) > 0 {
+			c.Collect(buf.samples)
+		}
+		buf.samples = nil
+		buf.lastFlush = now
+	}
+}
+
+// finalFlushTimeout returns how long the collectors get to commit their remaining samples once
+// they've been shut down.
+func (e *Engine) finalFlushTimeout() time.Duration {
+	if e.Options.FinalFlushTimeout.Valid {
+		return time.Duration(e.Options.FinalFlushTimeout.Duration)
+	}
+	return ShutdownTimeout
+}
+
+// waitForCollectors waits for the collectors to finish their final flush, but no longer than the
+// final flush timeout. If it's exceeded, the samples that couldn't be committed are reported.
+func (e *Engine) waitForCollectors(wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timeout := e.finalFlushTimeout()
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	dropped := 0
+	for _, c := range e.Collectors {
+		if pc, ok := c.(lib.PendingCollector); ok {
+			dropped += pc.PendingSamples()
+		}
+	}
+	e.logger.WithFields(log.Fields{"timeout": timeout, "dropped": dropped}).Warn(
+		"The outputs didn't finish committing the metric samples in time, some of them may be missing")
+}
+
 func (e *Engine) setRunStatus(status lib.RunStatus) {
 	if len(e.Collectors) == 0 {
 		return
@@ -143,6 +345,7 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 	e.logger.WithFields(fields).Debug(" - end conditions (if any)")
 
+	collectTick := e.initCollectorBuffers(time.Now())
 	collectorwg := sync.WaitGroup{}
 	collectorctx, collectorcancel := context.WithCancel(context.Background())
 	if len(e.Collectors) > 0 {
@@ -166,12 +369,27 @@ func (e *Engine) Run(ctx context.Context) error {
 		subwg.Done()
 	}()
 
-	// Run thresholds.
-	if !e.NoThresholds {
+	// Run the anomaly detection.
+	if e.anomalyDetector != nil {
 		subwg.Add(1)
 		go func() {
-			e.runThresholds(subctx, subcancel)
-			e.logger.Debug("Engine: Thresholds terminated")
+			e.anomalyDetector.run(subctx, e.logger, func() {
+				e.setRunStatus(lib.RunStatusAbortedThreshold)
+				subcancel()
+			})
+			e.logger.Debug("Engine: Anomaly detection terminated")
+			subwg.Done()
+		}()
+	}
+
+	// Run the adaptive load search, which limits the requests of the executor.
+	execctx := subctx
+	if e.adaptiveLoad != nil {
+		execctx = lib.WithRPSLimiter(subctx, e.adaptiveLoad.limiter)
+		subwg.Add(1)
+		go func() {
+			e.adaptiveLoad.run(subctx, e.logger)
+			e.logger.Debug("Engine: Adaptive load terminated")
 			subwg.Done()
 		}()
 	}
@@ -180,7 +398,7 @@ func (e *Engine) Run(ctx context.Context) error {
 	errC := make(chan error)
 	subwg.Add(1)
 	go func() {
-		errC <- e.Executor.Run(subctx, e.Samples)
+		errC <- e.Executor.Run(execctx, e.Samples)
 		e.logger.Debug("Engine: Executor terminated")
 		subwg.Done()
 	}()
@@ -210,25 +428,51 @@ func (e *Engine) Run(ctx context.Context) error {
 
 		// Emit final metrics.
 		e.emitMetrics()
+		e.flushCollectorBuffers(time.Now(), collectTick, true)
 
-		// Process final thresholds.
+		// The final evaluation of all thresholds, against all of the samples, whether or not
+		// they were due.
 		if !e.NoThresholds {
 			e.processThresholds(nil)
 		}
 
+		if e.adaptiveLoad != nil {
+			e.adaptiveLoad.report(e.logger)
+		}
+
 		// Finally, shut down collector.
 		collectorcancel()
-		collectorwg.Wait()
+		e.waitForCollectors(&collectorwg)
 	}()
 
-	ticker := time.NewTicker(CollectRate)
+	// The thresholds are evaluated in this loop, in between the processing of the samples, so
+	// they always see all of the samples that were received before their tick, and never a
+	// partially processed batch. That way the abortOnFail decisions don't depend on how the
+	// ticks of the thresholds and the sample processing happen to interleave.
+	var thresholdsC <-chan time.Time
+	var thresholds thresholdsSchedule
+	if !e.NoThresholds {
+		thresholds.interval, thresholds.tick = e.thresholdsIntervals()
+		thresholdsTicker := time.NewTicker(thresholds.tick)
+		defer thresholdsTicker.Stop()
+		thresholdsC = thresholdsTicker.C
+	}
+
+	ticker := time.NewTicker(collectTick)
 	for {
 		select {
-		case <-ticker.C:
+		case now := <-ticker.C:
+			if len(sampleContainers) > 0 {
+				e.processSamples(sampleContainers)
+				sampleContainers = []stats.SampleContainer{}
+			}
+			e.flushCollectorBuffers(now, collectTick, false)
+		case <-thresholdsC:
 			if len(sampleContainers) > 0 {
 				e.processSamples(sampleContainers)
 				sampleContainers = []stats.SampleContainer{}
 			}
+			e.runDueThresholds(&thresholds, subcancel)
 		case sc := <-e.Samples:
 			sampleContainers = append(sampleContainers, sc)
 		case err := <-errC:
@@ -244,10 +488,49 @@ func (e *Engine) Run(ctx context.Context) error {
 			e.logger.Debug("run: context expired; exiting...")
 			e.setRunStatus(lib.RunStatusAbortedUser)
 			return nil
+		case <-e.stopChan:
+			e.logger.Debug("run: stopped by user; exiting...")
+			e.setRunStatus(lib.RunStatusAbortedUser)
+			return nil
 		}
 	}
 }
 
+// Stop aborts the test, the same way cancelling the context passed to Run() does. teardown()
+// is still executed, limited by its own timeout.
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+	})
+}
+
+// IsStopped returns whether Stop() was called.
+func (e *Engine) IsStopped() bool {
+	select {
+	case <-e.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// AdaptiveCapacity returns the maximum requests per second at which the threshold of the
+// adaptiveLoad option held, and whether the search for it is over.
+func (e *Engine) AdaptiveCapacity() (float64, bool) {
+	if e.adaptiveLoad == nil {
+		return 0, false
+	}
+	return e.adaptiveLoad.getCapacity()
+}
+
+// Anomalies returns the descriptions of the anomalies that the anomalyDetection option detected.
+func (e *Engine) Anomalies() []string {
+	if e.anomalyDetector == nil {
+		return nil
+	}
+	return e.anomalyDetector.getAnomalies()
+}
+
 func (e *Engine) IsTainted() bool {
 	return e.thresholdsTainted
 }
@@ -276,38 +559,109 @@ func (e *Engine) runMetricsEmission(ctx context.Context) {
 func (e *Engine) emitMetrics() {
 	t := time.Now()
 
-	e.processSamples([]stats.SampleContainer{stats.ConnectedSamples{
-		Samples: []stats.Sample{
-			{
-				Time:   t,
-				Metric: metrics.VUs,
-				Value:  float64(e.Executor.GetVUs()),
-				Tags:   e.Options.RunTags,
-			}, {
-				Time:   t,
-				Metric: metrics.VUsMax,
-				Value:  float64(e.Executor.GetVUsMax()),
-				Tags:   e.Options.RunTags,
-			},
+	samples := []stats.Sample{
+		{
+			Time:   t,
+			Metric: metrics.VUs,
+			Value:  float64(e.Executor.GetVUs()),
+			Tags:   e.Options.RunTags,
+		}, {
+			Time:   t,
+			Metric: metrics.VUsMax,
+			Value:  float64(e.Executor.GetVUsMax()),
+			Tags:   e.Options.RunTags,
 		},
-		Tags: e.Options.RunTags,
-		Time: t,
+	}
+	if e.adaptiveLoad != nil {
+		samples = append(samples, stats.Sample{
+			Time:   t,
+			Metric: metrics.AdaptiveRate,
+			Value:  e.adaptiveLoad.getRate(),
+			Tags:   e.Options.RunTags,
+		})
+	}
+	e.processSamples([]stats.SampleContainer{stats.ConnectedSamples{
+		Samples: samples,
+		Tags:    e.Options.RunTags,
+		Time:    t,
 	}})
+
+	if e.Options.HostMetrics.Bool {
+		e.emitHostMetrics(t)
+	}
 }
 
-func (e *Engine) runThresholds(ctx context.Context, abort func()) {
-	ticker := time.NewTicker(ThresholdsRate)
-	for {
-		select {
-		case <-ticker.C:
-			e.processThresholds(abort)
-		case <-ctx.Done():
-			return
+// emitHostMetrics emits the open connections and in-flight requests of every host, and the
+// errors since the last emission, tagged with the host.
+func (e *Engine) emitHostMetrics(t time.Time) {
+	runner, ok := e.Executor.GetRunner().(lib.HostStatsRunner)
+	if !ok {
+		return
+	}
+	if e.hostErrors == nil {
+		e.hostErrors = make(map[string]int64)
+	}
+
+	var containers []stats.SampleContainer
+	for _, host := range runner.GetHostStats().Snapshot() {
+		tags := e.Options.RunTags.CloneTags()
+		tags["host"] = host.Host
+		sampleTags := stats.IntoSampleTags(&tags)
+		samples := []stats.Sample{
+			{Time: t, Metric: metrics.HostOpenConnections, Value: float64(host.OpenConnections), Tags: sampleTags},
+			{Time: t, Metric: metrics.HostInFlightRequests, Value: float64(host.InFlightRequests), Tags: sampleTags},
+		}
+		if errors := host.Errors - e.hostErrors[host.Host]; errors > 0 {
+			samples = append(samples, stats.Sample{Time: t, Metric: metrics.HostErrors, Value: float64(errors), Tags: sampleTags})
+		}
+		e.hostErrors[host.Host] = host.Errors
+		containers = append(containers, stats.ConnectedSamples{Samples: samples, Tags: sampleTags, Time: t})
+	}
+	if len(containers) > 0 {
+		e.processSamples(containers)
+	}
+}
+
+// thresholdsSchedule keeps track of which thresholds are due at every tick of their evaluation.
+// They're scheduled on a count of ticks, rather than on the wall clock or the test time, so that
+// the ones with the same interval are always evaluated together.
+type thresholdsSchedule struct {
+	interval, tick, at time.Duration
+}
+
+// runDueThresholds advances the schedule by a tick and evaluates the thresholds that are due
+// then, against the samples that were processed so far.
+func (e *Engine) runDueThresholds(schedule *thresholdsSchedule, abort func()) {
+	schedule.at += schedule.tick
+	e.evaluateThresholds(abort, func(m *stats.Metric, t time.Duration) (bool, error) {
+		return m.Thresholds.RunDue(m.Sink, t, schedule.at, schedule.interval)
+	})
+}
+
+// thresholdsIntervals returns the default interval at which thresholds are evaluated, and the
+// shortest interval of all thresholds, at which the evaluation needs to tick.
+func (e *Engine) thresholdsIntervals() (interval, tick time.Duration) {
+	interval = ThresholdsRate
+	if e.Options.ThresholdsInterval.Valid {
+		interval = time.Duration(e.Options.ThresholdsInterval.Duration)
+	}
+	tick = interval
+	for _, ths := range e.thresholds {
+		if min := ths.MinInterval(tick); min < tick {
+			tick = min
 		}
 	}
+	return interval, tick
 }
 
+// processThresholds evaluates all of the thresholds, regardless of their intervals.
 func (e *Engine) processThresholds(abort func()) {
+	e.evaluateThresholds(abort, func(m *stats.Metric, t time.Duration) (bool, error) {
+		return m.Thresholds.Run(m.Sink, t)
+	})
+}
+
+func (e *Engine) evaluateThresholds(abort func(), run func(m *stats.Metric, t time.Duration) (bool, error)) {
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
 
@@ -315,14 +669,26 @@ func (e *Engine) processThresholds(abort func()) {
 	abortOnFail := false
 
 	e.thresholdsTainted = false
+	var sinks map[string]stats.Sink
 	for _, m := range e.Metrics {
 		if len(m.Thresholds.Thresholds) == 0 {
 			continue
 		}
 		m.Tainted = null.BoolFrom(false)
 
+		// Thresholds that combine several metrics need the values of all of them.
+		if m.Thresholds.ReferencesMetrics() {
+			if sinks == nil {
+				sinks = make(map[string]stats.Sink, len(e.Metrics))
+				for name, other := range e.Metrics {
+					sinks[name] = other.Sink
+				}
+			}
+			m.Thresholds.SetMetrics(sinks, t)
+		}
+
 		e.logger.WithField("m", m.Name).Debug("running thresholds")
-		succ, err := m.Thresholds.Run(m.Sink, t)
+		succ, err := run(m, t)
 		if err != nil {
 			e.logger.WithField("m", m.Name).WithError(err).Error("Threshold error")
 			continue
@@ -354,21 +720,43 @@ func (e *Engine) processSamplesForMetrics(sampleCointainers []stats.SampleContai
 
 		for _, sample := range samples {
 			m, ok := e.Metrics[sample.Metric.Name]
+			if !ok || m.Type != sample.Metric.Type || m.Contains != sample.Metric.Contains {
+				if err := e.registry.Register(sample.Metric); err != nil {
+					e.dropShadowedSample(sample, err)
+					continue
+				}
+			}
 			if !ok {
-				m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
+				m = e.newMetric(sample.Metric.Name, sample.Metric)
 				m.Thresholds = e.thresholds[m.Name]
 				m.Submetrics = e.submetrics[m.Name]
+				if filter := e.Options.SummaryFilter.String; filter != "" {
+					// The summary shows these instead of the parent metrics.
+					addSubmetric(m, filter, stats.ParseTagFilter(filter))
+				}
 				e.Metrics[m.Name] = m
 			}
 			m.Sink.Add(sample)
 
+			for _, tag := range e.breakdownTags {
+				if value, ok := sample.Tags.Get(tag); ok {
+					e.addBreakdownSubmetric(m, tag, value)
+				}
+			}
+			if m.Name == metrics.GroupDuration.Name {
+				// The summary shows the duration of every group next to its checks.
+				if value, ok := sample.Tags.Get("group"); ok {
+					e.addBreakdownSubmetric(m, "group", value)
+				}
+			}
+
 			for _, sm := range m.Submetrics {
-				if !sample.Tags.Contains(sm.Tags) {
+				if !sm.Match(sample.Tags) {
 					continue
 				}
 
 				if sm.Metric == nil {
-					sm.Metric = stats.New(sm.Name, sample.Metric.Type, sample.Metric.Contains)
+					sm.Metric = e.newMetric(sm.Name, sample.Metric)
 					sm.Metric.Sub = *sm
 					sm.Metric.Thresholds = e.thresholds[sm.Name]
 					e.Metrics[sm.Name] = sm.Metric
@@ -379,6 +767,126 @@ func (e *Engine) processSamplesForMetrics(sampleCointainers []stats.SampleContai
 	}
 }
 
+// dropShadowedSample warns, once per metric name, that the samples of a metric are dropped,
+// because another metric with the same name but a different type was registered first.
+func (e *Engine) dropShadowedSample(sample stats.Sample, err error) {
+	if e.shadowedMetrics == nil {
+		e.shadowedMetrics = make(map[string]bool)
+	}
+	if e.shadowedMetrics[sample.Metric.Name] {
+		return
+	}
+	e.shadowedMetrics[sample.Metric.Name] = true
+	e.logger.WithError(err).Warnf("Dropping the samples of the metric '%s'", sample.Metric.Name)
+}
+
+// newMetric creates a metric or a submetric of the parent metric for the summary and the
+// thresholds. Trend metrics keep only the configured precision of their values or a t-digest of
+// them, so long tests don't run out of memory.
+func (e *Engine) newMetric(name string, parent *stats.Metric) *stats.Metric {
+	m := stats.New(name, parent.Type, parent.Contains)
+	if parent.Type != stats.Trend {
+		return m
+	}
+	if trendSinkKind(e.Options.TrendSinks, parent.Name) == stats.TrendSinkTDigest {
+		m.Sink = stats.NewTDigestTrendSink(stats.DefaultTDigestCompression)
+		return m
+	}
+	precision := stats.DefaultTrendPrecision
+	if e.Options.TrendPrecision.Valid {
+		precision = int(e.Options.TrendPrecision.Int64)
+	}
+	m.Sink = stats.NewTrendSink(precision)
+	return m
+}
+
+// trendSinkKind returns how the values of the named trend metric are kept, according to the
+// trendSinks option. An exact name wins over the patterns, and of those the one that sorts first.
+func trendSinkKind(rules map[string]string, name string) string {
+	if kind, ok := rules[name]; ok {
+		return kind
+	}
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return rules[pattern]
+		}
+	}
+	return stats.TrendSinkHistogram
+}
+
+// breakdownTags are the tags that the summary shows a breakdown of all metrics by.
+var breakdownTags = []string{"scenario", "variant"}
+
+// neededBreakdownTags returns the breakdown tags that the submetrics are worth keeping for, since
+// every sample that's added to them costs as much as adding it to its metric. That's the case if
+// the test has more than one scenario or variant, or if the summary compares scenarios or a
+// threshold is scoped to one of them; otherwise the summary doesn't show the breakdown.
+func neededBreakdownTags(o lib.Options, submetrics map[string][]*stats.Submetric) []string {
+	needed := map[string]bool{
+		"scenario": len(o.Execution) > 1 || len(o.SummaryCompare) > 0,
+		"variant":  len(o.Variants) > 1,
+	}
+	for _, sms := range submetrics {
+		for _, sm := range sms {
+			for _, tag := range breakdownTags {
+				if _, ok := sm.Tags.Get(tag); ok {
+					needed[tag] = true
+				}
+			}
+			for _, matcher := range sm.Matchers {
+				if _, ok := needed[matcher.Key]; ok {
+					needed[matcher.Key] = true
+				}
+			}
+		}
+	}
+
+	var tags []string
+	for _, tag := range breakdownTags {
+		if needed[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// addBreakdownSubmetric makes sure that m has a submetric for the given value of a breakdown tag,
+// so the summary can show e.g. a per-scenario breakdown.
+func (e *Engine) addBreakdownSubmetric(m *stats.Metric, tag, value string) {
+	suffix := tag + ":" + value
+	seen := e.breakdownSubmetrics[m.Name]
+	if seen[suffix] {
+		return
+	}
+	if seen == nil {
+		seen = make(map[string]bool)
+		e.breakdownSubmetrics[m.Name] = seen
+	}
+	seen[suffix] = true
+
+	addSubmetric(m, suffix, stats.IntoSampleTags(&map[string]string{tag: value}))
+}
+
+// addSubmetric adds a submetric for the given tags to m, unless a threshold already set one up.
+func addSubmetric(m *stats.Metric, suffix string, tags *stats.SampleTags) {
+	for _, sm := range m.Submetrics {
+		if len(sm.Matchers) == 0 && sm.Tags.IsEqual(tags) {
+			return
+		}
+	}
+	m.Submetrics = append(m.Submetrics, &stats.Submetric{
+		Name:   m.Name + "{" + suffix + "}",
+		Parent: m.Name,
+		Suffix: suffix,
+		Tags:   tags,
+	})
+}
+
 func (e *Engine) processSamples(sampleCointainers []stats.SampleContainer) {
 	if len(sampleCointainers) == 0 {
 		return
@@ -388,6 +896,16 @@ func (e *Engine) processSamples(sampleCointainers []stats.SampleContainer) {
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
 
+	if e.tagRedactor != nil {
+		sampleCointainers = redactSampleContainers(e.tagRedactor, sampleCointainers)
+	}
+	if e.adaptiveLoad != nil {
+		e.adaptiveLoad.add(sampleCointainers)
+	}
+	if e.anomalyDetector != nil {
+		e.anomalyDetector.add(sampleCointainers)
+	}
+
 	// TODO: run this and the below code in goroutines?
 	if !(e.NoSummary && e.NoThresholds) {
 		e.processSamplesForMetrics(sampleCointainers)
@@ -395,7 +913,78 @@ func (e *Engine) processSamples(sampleCointainers []stats.SampleContainer) {
 
 	if len(e.Collectors) > 0 {
 		for _, collector := range e.Collectors {
-			collector.Collect(sampleCointainers)
+			containers := sampleCointainers
+			if r, ok := e.collectorRelabelers[collector]; ok {
+				containers = relabelSampleContainers(r, containers)
+			}
+			if agg, ok := e.collectorAggregators[collector]; ok {
+				agg.Add(containers)
+				continue
+			}
+			e.collect(collector, containers)
+		}
+	}
+}
+
+// collect hands the samples to the collector, or to its buffer if it has a longer period.
+func (e *Engine) collect(c lib.Collector, sampleContainers []stats.SampleContainer) {
+	if buf, ok := e.collectorBuffers[c]; ok {
+		buf.samples = append(buf.samples, sampleContainers...)
+		return
+	}
+	c.Collect(sampleContainers)
+}
+
+// redactSampleContainers returns copies of the sample containers with their tags redacted. The
+// containers that the outputs handle specially keep their types.
+func redactSampleContainers(r *stats.TagRedactor, sampleContainers []stats.SampleContainer) []stats.SampleContainer {
+	res := make([]stats.SampleContainer, len(sampleContainers))
+	for i, sc := range sampleContainers {
+		switch sc := sc.(type) {
+		case stats.Sample:
+			sc.Tags = r.Redact(sc.Tags)
+			res[i] = sc
+		case *httpext.Trail:
+			trail := *sc
+			trail.Tags, trail.Samples = r.RedactConnected(sc.Tags, sc.Samples)
+			res[i] = &trail
+		case *netext.NetTrail:
+			trail := *sc
+			trail.Tags, trail.Samples = r.RedactConnected(sc.Tags, sc.Samples)
+			res[i] = &trail
+		case stats.ConnectedSampleContainer:
+			tags, samples := r.RedactConnected(sc.GetTags(), sc.GetSamples())
+			res[i] = stats.ConnectedSamples{Samples: samples, Tags: tags, Time: sc.GetTime()}
+		default:
+			res[i] = stats.Samples(r.RedactSamples(sc.GetSamples()))
+		}
+	}
+	return res
+}
+
+// relabelSampleContainers returns copies of the sample containers with their tags relabeled. Like
+// with redactSampleContainers, the containers that the outputs handle specially keep their types.
+func relabelSampleContainers(r *stats.Relabeler, sampleContainers []stats.SampleContainer) []stats.SampleContainer {
+	res := make([]stats.SampleContainer, len(sampleContainers))
+	for i, sc := range sampleContainers {
+		switch sc := sc.(type) {
+		case stats.Sample:
+			sc.Tags = r.Relabel(sc.Tags)
+			res[i] = sc
+		case *httpext.Trail:
+			trail := *sc
+			trail.Tags, trail.Samples = r.RelabelConnected(sc.Tags, sc.Samples)
+			res[i] = &trail
+		case *netext.NetTrail:
+			trail := *sc
+			trail.Tags, trail.Samples = r.RelabelConnected(sc.Tags, sc.Samples)
+			res[i] = &trail
+		case stats.ConnectedSampleContainer:
+			tags, samples := r.RelabelConnected(sc.GetTags(), sc.GetSamples())
+			res[i] = stats.ConnectedSamples{Samples: samples, Tags: tags, Time: sc.GetTime()}
+		default:
+			res[i] = stats.Samples(r.RelabelSamples(sc.GetSamples()))
 		}
 	}
+	return res
 }
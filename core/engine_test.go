@@ -22,7 +22,9 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext/httpext"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
@@ -295,6 +298,42 @@ func TestEngineRun(t *testing.T) {
 	})
 }
 
+func TestEngineStop(t *testing.T) {
+	teardownMetric := stats.New("teardown_metric", stats.Counter)
+	e, err := newTestEngine(local.New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			<-ctx.Done()
+			return nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			out <- stats.Sample{Metric: teardownMetric, Time: time.Now(), Value: 1}
+			return ctx.Err()
+		},
+	}), lib.Options{
+		VUs:    null.IntFrom(1),
+		VUsMax: null.IntFrom(1),
+	})
+	require.NoError(t, err)
+
+	errC := make(chan error)
+	go func() { errC <- e.Run(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, e.IsStopped())
+	e.Stop()
+	e.Stop() // should be idempotent
+	assert.True(t, e.IsStopped())
+
+	select {
+	case err := <-errC:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the engine wasn't stopped")
+	}
+	if assert.Contains(t, e.Metrics, teardownMetric.Name) {
+		assert.Equal(t, 1.0, e.Metrics[teardownMetric.Name].Sink.(*stats.CounterSink).Value)
+	}
+}
+
 func TestEngineAtTime(t *testing.T) {
 	e, err := newTestEngine(nil, lib.Options{})
 	assert.NoError(t, err)
@@ -329,12 +368,42 @@ func TestEngineCollector(t *testing.T) {
 		sink := metric.Sink.(*stats.TrendSink)
 		if assert.NotNil(t, sink) {
 			numCollectorSamples := len(cSamples)
-			numEngineSamples := len(sink.Values)
+			numEngineSamples := int(sink.Count)
 			assert.Equal(t, numEngineSamples, numCollectorSamples)
 		}
 	}
 }
 
+func TestEngineCollectorPeriods(t *testing.T) {
+	e, err := newTestEngine(nil, lib.Options{CollectorPeriod: types.NullDurationFrom(1 * time.Second)})
+	require.NoError(t, err)
+	fast, slow, global := &dummy.Collector{}, &dummy.Collector{}, &dummy.Collector{}
+	e.Collectors = []lib.Collector{fast, slow, global}
+	e.SetCollectorPeriod(fast, 500*time.Millisecond)
+	e.SetCollectorPeriod(slow, 60*time.Second)
+
+	start := time.Now()
+	tick := e.initCollectorBuffers(start)
+	assert.Equal(t, 500*time.Millisecond, tick)
+	assert.Len(t, e.collectorBuffers, 2)
+
+	metric := stats.New("my_metric", stats.Gauge)
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1}})
+	assert.Len(t, fast.Samples, 1)
+	assert.Len(t, slow.Samples, 0)
+	assert.Len(t, global.Samples, 0)
+
+	e.flushCollectorBuffers(start.Add(tick), tick, false)
+	assert.Len(t, global.Samples, 0)
+	e.flushCollectorBuffers(start.Add(2*tick-time.Millisecond), tick, false)
+	assert.Len(t, global.Samples, 1)
+	assert.Len(t, slow.Samples, 0)
+
+	e.flushCollectorBuffers(start.Add(3*tick), tick, true)
+	assert.Len(t, global.Samples, 1)
+	assert.Len(t, slow.Samples, 1)
+}
+
 func TestEngine_processSamples(t *testing.T) {
 	metric := stats.New("my_metric", stats.Gauge)
 
@@ -371,64 +440,477 @@ func TestEngine_processSamples(t *testing.T) {
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric{a:1}"].Sink)
 	})
-}
+	t.Run("scenario", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{`value<2`})
+		assert.NoError(t, err)
 
-func TestEngine_runThresholds(t *testing.T) {
-	metric := stats.New("my_metric", stats.Gauge)
-	thresholds := make(map[string]stats.Thresholds, 1)
+		e, err := newTestEngine(nil, lib.Options{
+			Thresholds: map[string]stats.Thresholds{
+				"my_metric{scenario: checkout}": ths,
+			},
+		})
+		assert.NoError(t, err)
 
-	ths, err := stats.NewThresholds([]string{"1+1==3"})
-	assert.NoError(t, err)
+		for _, scenario := range []string{"browse", "checkout", "browse"} {
+			e.processSamples([]stats.SampleContainer{stats.Sample{
+				Metric: metric, Value: 1.25,
+				Tags: stats.IntoSampleTags(&map[string]string{"scenario": scenario}),
+			}})
+		}
 
-	t.Run("aborted", func(t *testing.T) {
-		ths.Thresholds[0].AbortOnFail = true
-		thresholds[metric.Name] = ths
-		e, err := newTestEngine(nil, lib.Options{Thresholds: thresholds})
+		assert.Len(t, e.Metrics["my_metric"].Submetrics, 2)
+		assert.Contains(t, e.Metrics, "my_metric{scenario:browse}")
+		assert.Contains(t, e.Metrics, "my_metric{scenario: checkout}")
+		assert.Equal(t, "my_metric", e.Metrics["my_metric{scenario:browse}"].Sub.Parent)
+		assert.Len(t, e.Metrics["my_metric{scenario: checkout}"].Thresholds.Thresholds, 1)
+	})
+	t.Run("variant", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{
+			Variants:       map[string]float64{"control": 1, "new": 1},
+			SummaryCompare: []string{"browse", "checkout"},
+		})
 		assert.NoError(t, err)
 
-		e.processSamples(
-			[]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1.25, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})}},
-		)
+		e.processSamples([]stats.SampleContainer{stats.Sample{
+			Metric: metric, Value: 1.25,
+			Tags: stats.IntoSampleTags(&map[string]string{"scenario": "browse", "variant": "new"}),
+		}})
 
-		ctx, cancel := context.WithCancel(context.Background())
-		aborted := false
+		assert.Len(t, e.Metrics["my_metric"].Submetrics, 2)
+		assert.Contains(t, e.Metrics, "my_metric{scenario:browse}")
+		assert.Contains(t, e.Metrics, "my_metric{variant:new}")
+	})
+	t.Run("single scenario and variant", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{Variants: map[string]float64{"new": 1}})
+		assert.NoError(t, err)
 
-		cancelFunc := func() {
-			cancel()
-			aborted = true
+		e.processSamples([]stats.SampleContainer{stats.Sample{
+			Metric: metric, Value: 1.25,
+			Tags: stats.IntoSampleTags(&map[string]string{"scenario": "default", "variant": "new"}),
+		}})
+
+		assert.Empty(t, e.Metrics["my_metric"].Submetrics, "a breakdown by a single value isn't shown")
+		assert.NotContains(t, e.Metrics, "my_metric{scenario:default}")
+		assert.NotContains(t, e.Metrics, "my_metric{variant:new}")
+	})
+	t.Run("group", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{})
+		assert.NoError(t, err)
+
+		for _, m := range []*stats.Metric{metrics.GroupDuration, metric} {
+			e.processSamples([]stats.SampleContainer{stats.Sample{
+				Metric: m, Value: 1.25,
+				Tags: stats.IntoSampleTags(&map[string]string{"group": "::login"}),
+			}})
 		}
 
-		e.runThresholds(ctx, cancelFunc)
+		assert.Contains(t, e.Metrics, "group_duration{group:::login}")
+		assert.Equal(t, "group_duration", e.Metrics["group_duration{group:::login}"].Sub.Parent)
+		assert.Empty(t, e.Metrics["my_metric"].Submetrics, "only the group durations are broken down by group")
+	})
+	t.Run("regexp", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{`value<2`})
+		assert.NoError(t, err)
 
-		assert.True(t, aborted)
+		name := `my_metric{status:~"5..", group:"::checkout"}`
+		e, err := newTestEngine(nil, lib.Options{
+			Thresholds: map[string]stats.Thresholds{name: ths},
+		})
+		assert.NoError(t, err)
+
+		for _, tags := range []map[string]string{
+			{"status": "200", "group": "::checkout"},
+			{"status": "503", "group": "::browse"},
+		} {
+			tags := tags
+			e.processSamples([]stats.SampleContainer{stats.Sample{
+				Metric: metric, Value: 1, Tags: stats.IntoSampleTags(&tags),
+			}})
+		}
+		assert.NotContains(t, e.Metrics, name)
+
+		e.processSamples([]stats.SampleContainer{stats.Sample{
+			Metric: metric, Value: 3,
+			Tags: stats.IntoSampleTags(&map[string]string{"status": "502", "group": "::checkout"}),
+		}})
+		require.Contains(t, e.Metrics, name)
+		assert.Equal(t, 3.0, e.Metrics[name].Sink.(*stats.GaugeSink).Value)
+		assert.Len(t, e.Metrics[name].Thresholds.Thresholds, 1)
 	})
+	t.Run("invalid regexp", func(t *testing.T) {
+		_, err := newTestEngine(nil, lib.Options{
+			Thresholds: map[string]stats.Thresholds{`my_metric{status:~"5(.."}`: {}},
+		})
+		assert.Error(t, err)
+	})
+	t.Run("summary filter", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{SummaryFilter: null.StringFrom("a:1")})
+		assert.NoError(t, err)
 
-	t.Run("canceled", func(t *testing.T) {
-		ths.Abort = false
-		thresholds[metric.Name] = ths
-		e, err := newTestEngine(nil, lib.Options{Thresholds: thresholds})
+		e.processSamples([]stats.SampleContainer{
+			stats.Sample{Metric: metric, Value: 1, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})},
+			stats.Sample{Metric: metric, Value: 2, Tags: stats.IntoSampleTags(&map[string]string{"a": "2"})},
+		})
+
+		require.Contains(t, e.Metrics, "my_metric{a:1}")
+		assert.Equal(t, "my_metric", e.Metrics["my_metric{a:1}"].Sub.Parent)
+		assert.Equal(t, 1.0, e.Metrics["my_metric{a:1}"].Sink.(*stats.GaugeSink).Max)
+		assert.Equal(t, 2.0, e.Metrics["my_metric"].Sink.(*stats.GaugeSink).Max)
+	})
+	t.Run("redact tags", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{RedactTags: map[string]string{"url": "strip", "token": "hash"}})
 		assert.NoError(t, err)
+		c := &dummy.Collector{}
+		e.Collectors = []lib.Collector{c}
 
-		e.processSamples(
-			[]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1.25, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})}},
-		)
+		tags := stats.IntoSampleTags(&map[string]string{"url": "http://example.com/?t=1", "token": "1", "a": "1"})
+		trail := &httpext.Trail{}
+		trail.SaveSamples(tags)
+		e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1, Tags: tags}, trail})
 
-		ctx, cancel := context.WithCancel(context.Background())
-		cancel()
+		require.Len(t, c.SampleContainers, 2)
+		redactedTrail, ok := c.SampleContainers[1].(*httpext.Trail)
+		require.True(t, ok)
+		assert.True(t, redactedTrail != trail)
+		assert.True(t, trail.Tags == tags, "the original trail shouldn't be modified")
+		for _, s := range c.Samples {
+			assert.Equal(t, map[string]string{"token": "6b86b273ff34fce1", "a": "1"}, s.Tags.CloneTags())
+			assert.True(t, s.Tags == c.Samples[0].Tags || s.Tags == redactedTrail.Tags)
+		}
+	})
+	t.Run("trend sinks", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{`p(95)<100`})
+		require.NoError(t, err)
+		e, err := newTestEngine(nil, lib.Options{
+			TrendSinks: map[string]string{"*": "tdigest", "my_exact_trend": "histogram"},
+			Thresholds: map[string]stats.Thresholds{"my_trend{a:1}": ths},
+		})
+		require.NoError(t, err)
 
-		done := make(chan struct{})
-		go func() {
-			defer close(done)
-			e.runThresholds(ctx, cancel)
-		}()
+		trend, exact := stats.New("my_trend", stats.Trend), stats.New("my_exact_trend", stats.Trend)
+		tags := stats.IntoSampleTags(&map[string]string{"a": "1"})
+		e.processSamples([]stats.SampleContainer{
+			stats.Sample{Metric: trend, Value: 1, Tags: tags}, stats.Sample{Metric: exact, Value: 1, Tags: tags},
+		})
 
-		select {
-		case <-done:
-			return
-		case <-time.After(1 * time.Second):
-			assert.Fail(t, "Test should have completed within a second")
+		assert.NotNil(t, e.Metrics["my_trend"].Sink.(*stats.TrendSink).Digest)
+		assert.NotNil(t, e.Metrics["my_trend{a:1}"].Sink.(*stats.TrendSink).Digest)
+		assert.Nil(t, e.Metrics["my_exact_trend"].Sink.(*stats.TrendSink).Digest)
+		assert.NotNil(t, e.Metrics["my_exact_trend"].Sink.(*stats.TrendSink).Histogram)
+	})
+	t.Run("shadowed", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{})
+		require.NoError(t, err)
+		hook := applyNullLogger(e)
+
+		counter, vus := stats.New("my_metric", stats.Counter), stats.New("vus", stats.Counter)
+		e.processSamples([]stats.SampleContainer{
+			stats.Sample{Metric: metric, Value: 1.25}, stats.Sample{Metric: counter, Value: 1},
+			stats.Sample{Metric: counter, Value: 2}, stats.Sample{Metric: vus, Value: 1},
+		})
+
+		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
+		assert.Equal(t, 1.25, e.Metrics["my_metric"].Sink.(*stats.GaugeSink).Value)
+		assert.NotContains(t, e.Metrics, "vus")
+		require.Len(t, hook.Entries, 2)
+		assert.Equal(t, log.WarnLevel, hook.Entries[0].Level)
+		assert.Equal(t, "Dropping the samples of the metric 'my_metric'", hook.Entries[0].Message)
+		assert.Equal(t, "Dropping the samples of the metric 'vus'", hook.Entries[1].Message)
+	})
+	t.Run("runner registry", func(t *testing.T) {
+		registry := stats.NewRegistry()
+		_, err := registry.NewMetric("my_metric", stats.Trend)
+		require.NoError(t, err)
+		e, err := newTestEngine(local.New(&registryRunner{registry: registry}), lib.Options{})
+		require.NoError(t, err)
+
+		e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1.25}})
+		assert.NotContains(t, e.Metrics, "my_metric")
+	})
+}
+
+func TestTrendSinkKind(t *testing.T) {
+	rules := map[string]string{"http_*": "tdigest", "*": "histogram", "http_req_duration": "histogram"}
+	assert.Equal(t, "histogram", trendSinkKind(nil, "http_req_duration"))
+	assert.Equal(t, "histogram", trendSinkKind(rules, "http_req_duration"))
+	assert.Equal(t, "histogram", trendSinkKind(rules, "iteration_duration"))
+	assert.Equal(t, "tdigest", trendSinkKind(map[string]string{"*": "tdigest"}, "http_req_duration"))
+	assert.Equal(t, "tdigest", trendSinkKind(map[string]string{"http_*": "tdigest", "i*": "histogram"}, "http_req_waiting"))
+}
+
+func TestEngineCollectorAggregation(t *testing.T) {
+	e, err := newTestEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	raw, aggregated := &dummy.Collector{}, &dummy.Collector{}
+	e.Collectors = []lib.Collector{raw, aggregated}
+	e.SetCollectorAggregation(aggregated, time.Second)
+	tick := e.initCollectorBuffers(time.Now())
+
+	start := time.Unix(1000, 0)
+	counter := stats.New("my_counter", stats.Counter)
+	for i := 0; i < 10; i++ {
+		e.processSamples([]stats.SampleContainer{
+			stats.Sample{Metric: counter, Value: 1, Time: start.Add(time.Duration(i) * 150 * time.Millisecond)},
+		})
+	}
+	assert.Len(t, raw.Samples, 10)
+	assert.Len(t, aggregated.Samples, 0)
+
+	// The first bucket is only flushed once samples can't be late for it anymore.
+	e.flushCollectorBuffers(start.Add(1500*time.Millisecond), tick, false)
+	assert.Len(t, aggregated.Samples, 0)
+	e.flushCollectorBuffers(start.Add(2*time.Second), tick, false)
+	require.Len(t, aggregated.Samples, 1)
+	assert.Equal(t, 7.0, aggregated.Samples[0].Value)
+	assert.Equal(t, start, aggregated.Samples[0].Time)
+
+	e.flushCollectorBuffers(start.Add(2*time.Second), tick, true)
+	require.Len(t, aggregated.Samples, 2)
+	assert.Equal(t, 3.0, aggregated.Samples[1].Value)
+	assert.Equal(t, map[string]string{"aggregation": "sum"}, aggregated.Samples[1].Tags.CloneTags())
+}
+
+func TestEngineCollectorRelabeling(t *testing.T) {
+	e, err := newTestEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	raw, relabeled := &dummy.Collector{}, &dummy.Collector{}
+	e.Collectors = []lib.Collector{raw, relabeled}
+	e.SetCollectorRelabeling(relabeled, stats.NewRelabeler([]stats.RelabelRule{
+		{Action: stats.RelabelRename, Tag: "status", To: "code"},
+		{Action: stats.RelabelDrop, Tag: "url"},
+	}))
+
+	counter := stats.New("my_counter", stats.Counter)
+	tags := stats.IntoSampleTags(&map[string]string{"status": "200", "url": "http://example.com/"})
+	e.processSamples([]stats.SampleContainer{
+		stats.Sample{Metric: counter, Value: 1, Tags: tags},
+		stats.ConnectedSamples{Samples: []stats.Sample{{Metric: counter, Value: 2, Tags: tags}}, Tags: tags},
+	})
+
+	require.Len(t, raw.Samples, 2)
+	require.Len(t, relabeled.Samples, 2)
+	for i := range raw.Samples {
+		assert.True(t, raw.Samples[i].Tags == tags)
+		assert.Equal(t, map[string]string{"code": "200"}, relabeled.Samples[i].Tags.CloneTags())
+	}
+}
+
+// stuckCollector never finishes its final flush.
+type stuckCollector struct {
+	dummy.Collector
+	pending int
+}
+
+func (c *stuckCollector) Run(ctx context.Context) {
+	<-ctx.Done()
+	select {}
+}
+
+func (c *stuckCollector) PendingSamples() int {
+	return c.pending
+}
+
+// A runner that has its own metric registry.
+type registryRunner struct {
+	lib.MiniRunner
+	registry *stats.Registry
+}
+
+func (r *registryRunner) GetMetricRegistry() *stats.Registry {
+	return r.registry
+}
+
+func TestEngineFinalFlushTimeout(t *testing.T) {
+	t.Run("Finished", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{
+			VUs:               null.IntFrom(1),
+			VUsMax:            null.IntFrom(1),
+			Iterations:        null.IntFrom(1),
+			FinalFlushTimeout: types.NullDurationFrom(time.Hour),
+		})
+		require.NoError(t, err)
+		hook := applyNullLogger(e)
+		e.Collectors = []lib.Collector{&dummy.Collector{}}
+		assert.NoError(t, e.Run(context.Background()))
+		for _, entry := range hook.Entries {
+			assert.NotEqual(t, log.WarnLevel, entry.Level, entry.Message)
 		}
 	})
+	t.Run("TimedOut", func(t *testing.T) {
+		e, err := newTestEngine(nil, lib.Options{
+			VUs:               null.IntFrom(1),
+			VUsMax:            null.IntFrom(1),
+			Iterations:        null.IntFrom(1),
+			FinalFlushTimeout: types.NullDurationFrom(100 * time.Millisecond),
+		})
+		require.NoError(t, err)
+		hook := applyNullLogger(e)
+		e.Collectors = []lib.Collector{&stuckCollector{pending: 3}, &stuckCollector{pending: 4}, &dummy.Collector{}}
+
+		start := time.Now()
+		assert.NoError(t, e.Run(context.Background()))
+		assert.True(t, time.Since(start) < ShutdownTimeout)
+
+		entry := hook.LastEntry()
+		require.NotNil(t, entry)
+		assert.Equal(t, log.WarnLevel, entry.Level)
+		assert.Equal(t, 7, entry.Data["dropped"])
+		assert.Equal(t, 100*time.Millisecond, entry.Data["timeout"])
+	})
+}
+
+type hostStatsRunner struct {
+	lib.MiniRunner
+	hostStats *lib.HostStats
+}
+
+func (r hostStatsRunner) GetHostStats() *lib.HostStats {
+	return r.hostStats
+}
+
+func TestEngine_emitMetrics(t *testing.T) {
+	e, err := newTestEngine(LF(nil), lib.Options{
+		VUs:     null.IntFrom(1),
+		VUsMax:  null.IntFrom(10),
+		RunTags: stats.IntoSampleTags(&map[string]string{"testid": "1"}),
+	})
+	require.NoError(t, err)
+	c := &dummy.Collector{}
+	e.Collectors = []lib.Collector{c}
+
+	e.emitMetrics()
+	require.NoError(t, e.Executor.SetVUs(3))
+	e.emitMetrics()
+
+	assert.Equal(t, 3.0, e.Metrics[metrics.VUs.Name].Sink.(*stats.GaugeSink).Value)
+	assert.Equal(t, 1.0, e.Metrics[metrics.VUs.Name].Sink.(*stats.GaugeSink).Min)
+	assert.Equal(t, 10.0, e.Metrics[metrics.VUsMax.Name].Sink.(*stats.GaugeSink).Value)
+
+	// The collectors get the gauges over time, tagged with the run tags.
+	var vus []float64
+	for _, sample := range c.Samples {
+		if sample.Metric == metrics.VUs {
+			vus = append(vus, sample.Value)
+			assert.Equal(t, map[string]string{"testid": "1"}, sample.Tags.CloneTags())
+		}
+	}
+	assert.Equal(t, []float64{1, 3}, vus)
+}
+
+func TestEngine_emitHostMetrics(t *testing.T) {
+	hostStats := lib.NewHostStats()
+	counters := hostStats.Host("example.com:443")
+	atomic.AddInt64(&counters.OpenConnections, 2)
+	atomic.AddInt64(&counters.InFlightRequests, 1)
+	atomic.AddInt64(&counters.Errors, 3)
+
+	e, err := newTestEngine(local.New(&hostStatsRunner{hostStats: hostStats}), lib.Options{
+		HostMetrics: null.BoolFrom(true),
+	})
+	require.NoError(t, err)
+
+	e.emitMetrics()
+	atomic.AddInt64(&counters.OpenConnections, -1)
+	e.emitMetrics()
+	atomic.AddInt64(&counters.Errors, 2)
+	e.emitMetrics()
+
+	assert.Equal(t, 1.0, e.Metrics[metrics.HostOpenConnections.Name].Sink.(*stats.GaugeSink).Value)
+	assert.Equal(t, 2.0, e.Metrics[metrics.HostOpenConnections.Name].Sink.(*stats.GaugeSink).Max)
+	assert.Equal(t, 1.0, e.Metrics[metrics.HostInFlightRequests.Name].Sink.(*stats.GaugeSink).Value)
+	assert.Equal(t, 5.0, e.Metrics[metrics.HostErrors.Name].Sink.(*stats.CounterSink).Value)
+
+	t.Run("disabled", func(t *testing.T) {
+		e, err := newTestEngine(local.New(&hostStatsRunner{hostStats: hostStats}), lib.Options{})
+		require.NoError(t, err)
+		e.emitMetrics()
+		assert.NotContains(t, e.Metrics, metrics.HostOpenConnections.Name)
+	})
+}
+
+func TestEngine_runDueThresholds(t *testing.T) {
+	metric := stats.New("my_metric", stats.Gauge)
+	var ths stats.Thresholds
+	require.NoError(t, json.Unmarshal([]byte(`["1+1==3", {"threshold": "value<2", "interval": "3s"}]`), &ths))
+	e, err := newTestEngine(nil, lib.Options{Thresholds: map[string]stats.Thresholds{metric.Name: ths}})
+	require.NoError(t, err)
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Value: 5}})
+
+	schedule := thresholdsSchedule{interval: 2 * time.Second, tick: time.Second}
+	var evaluated []bool
+	for i := 0; i < 6; i++ {
+		e.runDueThresholds(&schedule, nil)
+		evaluated = append(evaluated, ths.Thresholds[0].LastFailed, ths.Thresholds[1].LastFailed)
+		ths.Thresholds[0].LastFailed, ths.Thresholds[1].LastFailed = false, false
+	}
+	assert.Equal(t, 6*time.Second, schedule.at)
+	assert.Equal(t, []bool{
+		true, true,
+		false, false,
+		true, false,
+		false, true,
+		true, false,
+		false, false,
+	}, evaluated, "the default interval is 2s, the second threshold's is 3s")
+
+	t.Run("aborted", func(t *testing.T) {
+		ths.Thresholds[0].AbortOnFail = true
+		c := &dummy.Collector{}
+		e.Collectors = []lib.Collector{c}
+		aborted := false
+		e.runDueThresholds(&schedule, func() { aborted = true })
+		assert.True(t, aborted)
+		assert.Equal(t, lib.RunStatusAbortedThreshold, c.RunStatus)
+	})
+}
+
+func TestEngine_thresholdsIntervals(t *testing.T) {
+	e, err := newTestEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	interval, tick := e.thresholdsIntervals()
+	assert.Equal(t, ThresholdsRate, interval)
+	assert.Equal(t, ThresholdsRate, tick)
+
+	var ths stats.Thresholds
+	require.NoError(t, json.Unmarshal([]byte(`["1+1==2", {"threshold": "1+1==2", "interval": "500ms"}]`), &ths))
+	e, err = newTestEngine(nil, lib.Options{
+		Thresholds:         map[string]stats.Thresholds{"my_metric": ths},
+		ThresholdsInterval: types.NullDurationFrom(10 * time.Second),
+	})
+	require.NoError(t, err)
+	interval, tick = e.thresholdsIntervals()
+	assert.Equal(t, 10*time.Second, interval)
+	assert.Equal(t, 500*time.Millisecond, tick)
+}
+
+func TestEngineThresholdsSnapshot(t *testing.T) {
+	metric := stats.New("my_metric", stats.Gauge)
+	var ths stats.Thresholds
+	require.NoError(t, json.Unmarshal([]byte(`[{"threshold": "value<2", "abortOnFail": true, "interval": "50ms"}]`), &ths))
+
+	// The sample is sent right before the threshold's tick, and the collection period is
+	// much longer, so the threshold would miss it if it didn't process the pending samples.
+	e, err := newTestEngine(LF(func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		out <- stats.Sample{Metric: metric, Time: time.Now(), Value: 5}
+		<-ctx.Done()
+		return nil
+	}), lib.Options{
+		VUs:                null.IntFrom(1),
+		VUsMax:             null.IntFrom(1),
+		Duration:           types.NullDurationFrom(10 * time.Second),
+		Thresholds:         map[string]stats.Thresholds{metric.Name: ths},
+		ThresholdsInterval: types.NullDurationFrom(time.Hour),
+		CollectorPeriod:    types.NullDurationFrom(time.Hour),
+	})
+	require.NoError(t, err)
+	c := &dummy.Collector{}
+	e.Collectors = []lib.Collector{c}
+
+	start := time.Now()
+	require.NoError(t, e.Run(context.Background()))
+	assert.True(t, time.Since(start) < 5*time.Second, "the test should be aborted by the threshold")
+	assert.Equal(t, lib.RunStatusAbortedThreshold, c.RunStatus)
+	assert.True(t, e.IsTainted())
 }
 
 func TestEngine_processThresholds(t *testing.T) {
@@ -482,6 +964,43 @@ func TestEngine_processThresholds(t *testing.T) {
 	}
 }
 
+func TestEngineDelayAbortEval(t *testing.T) {
+	metric := stats.New("my_metric", stats.Gauge)
+	ths, err := stats.NewThresholds([]string{"1+1==3"})
+	require.NoError(t, err)
+	ths.Thresholds[0].AbortOnFail = true
+	ths.Thresholds[0].AbortGracePeriod = types.NullDurationFrom(time.Hour)
+
+	e, err := newTestEngine(nil, lib.Options{Thresholds: map[string]stats.Thresholds{metric.Name: ths}})
+	require.NoError(t, err)
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Value: 1}})
+
+	// The threshold fails, but the test can't be aborted before the delay has passed.
+	aborted := false
+	e.processThresholds(func() { aborted = true })
+	assert.True(t, e.IsTainted())
+	assert.False(t, aborted)
+}
+
+func TestEngineMultiMetricThresholds(t *testing.T) {
+	gauge := stats.New("my_gauge", stats.Gauge)
+	ths, err := stats.NewThresholds([]string{"rate > 0.5 && my_gauge.value > 1"})
+	require.NoError(t, err)
+
+	e, err := newTestEngine(nil, lib.Options{Thresholds: map[string]stats.Thresholds{metrics.Checks.Name: ths}})
+	require.NoError(t, err)
+	e.processSamples([]stats.SampleContainer{stats.Samples{
+		{Metric: metrics.Checks, Value: 1},
+		{Metric: gauge, Value: 2},
+	}})
+	e.processThresholds(nil)
+	assert.False(t, e.IsTainted())
+
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: gauge, Value: 0.5}})
+	e.processThresholds(nil)
+	assert.True(t, e.IsTainted())
+}
+
 func getMetricSum(collector *dummy.Collector, name string) (result float64) {
 	for _, sc := range collector.SampleContainers {
 		for _, s := range sc.GetSamples() {
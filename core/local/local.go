@@ -23,16 +23,20 @@ package local
 import (
 	"context"
 	"fmt"
+	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/scheduler"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -44,30 +48,161 @@ import (
 
 var _ lib.Executor = &Executor{}
 
+// How late iterations on an iteration schedule can start before a warning is logged.
+const maxScheduleLag = 100 * time.Millisecond
+
 type vuHandle struct {
 	sync.RWMutex
 	vu     lib.VU
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Execution tags for the next iteration, attached to ctx; only touched by run().
+	tags map[string]string
+
+	// The ID the VU was last configured with, kept when it's recycled.
+	id int64
+}
+
+// vuRecycler replaces VUs with freshly initialized ones, as configured by the
+// vuRecycleIterations, vuRecycleOnError and vuRecycleHeapLimit options, so any JS state they
+// have accumulated over a long test is discarded.
+type vuRecycler struct {
+	iterations int64
+	onError    bool
+	heapGen    *int64 // The executor's heap generation, see Executor.watchHeap(); nil if there's no heap limit.
+	newVU      func() (lib.VU, error)
+	out        chan<- stats.SampleContainer
+}
+
+func newVURecycler(
+	opts lib.Options, heapGen *int64, newVU func() (lib.VU, error), out chan<- stats.SampleContainer,
+) *vuRecycler {
+	if opts.VURecycleHeapLimit.Int64 <= 0 {
+		heapGen = nil
+	}
+	if opts.VURecycleIterations.Int64 <= 0 && !opts.VURecycleOnError.Bool && heapGen == nil {
+		return nil
+	}
+	return &vuRecycler{
+		iterations: opts.VURecycleIterations.Int64,
+		onError:    opts.VURecycleOnError.Bool,
+		heapGen:    heapGen,
+		newVU:      newVU,
+		out:        out,
+	}
 }
 
-func (h *vuHandle) run(logger *log.Logger, flow <-chan int64, iterDone chan<- struct{}) {
+// recycleReason returns why a VU should be recycled after its last iteration, or an empty string
+// if it shouldn't. seenHeapGen is the heap generation in which the VU was last (re)initialized.
+func (r *vuRecycler) recycleReason(iters int64, err error, seenHeapGen int64) string {
+	switch {
+	case r == nil:
+		return ""
+	case r.onError && err != nil:
+		return "error"
+	case r.iterations > 0 && iters >= r.iterations:
+		return "iterations"
+	case r.heapGen != nil && atomic.LoadInt64(r.heapGen) > seenHeapGen:
+		return "heap"
+	default:
+		return ""
+	}
+}
+
+func (r *vuRecycler) currentHeapGen() int64 {
+	if r == nil || r.heapGen == nil {
+		return 0
+	}
+	return atomic.LoadInt64(r.heapGen)
+}
+
+func (h *vuHandle) recycle(logger *log.Logger, recycler *vuRecycler, reason string) {
+	vu, err := recycler.newVU()
+	if err == nil {
+		err = vu.Reconfigure(h.id)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Couldn't recycle VU, reusing the old one")
+		return
+	}
+	logger.WithFields(log.Fields{"vu": h.id, "reason": reason}).Debug("Local: Recycled VU")
+
+	h.Lock()
+	old := h.vu
+	h.vu = vu
+	h.Unlock()
+	closeVU(logger, old)
+
+	recycler.out <- stats.Sample{
+		Time:   time.Now(),
+		Metric: metrics.VURecycles,
+		Value:  1,
+		Tags:   stats.IntoSampleTags(&map[string]string{"reason": reason}),
+	}
+}
+
+// closeVU releases what the modules have kept for a VU that's discarded, if it keeps anything.
+func closeVU(logger *log.Logger, vu lib.VU) {
+	if cvu, ok := vu.(lib.ClosableVU); ok {
+		if err := cvu.Close(); err != nil {
+			logger.WithError(err).Warn("Couldn't close a discarded VU")
+		}
+	}
+}
+
+// closeVUs closes all of the VUs once they have stopped running.
+func (e *Executor) closeVUs() {
+	e.vusLock.RLock()
+	defer e.vusLock.RUnlock()
+
+	for _, handle := range e.vus {
+		handle.RLock()
+		closeVU(e.Logger, handle.vu)
+		handle.RUnlock()
+	}
+}
+
+func (h *vuHandle) run(
+	logger *log.Logger, flow <-chan map[string]string, iterDone chan<- map[string]string, recycler *vuRecycler,
+	variant func() string,
+) {
 	h.RLock()
 	ctx := h.ctx
+	tags := h.tags
 	h.RUnlock()
 
+	var iters int64
+	var (
+		iterTags map[string]string
+		ok       bool
+	)
+	heapGen := recycler.currentHeapGen()
 	for {
 		select {
-		case _, ok := <-flow:
+		case iterTags, ok = <-flow:
 			if !ok {
 				return
 			}
+			if variant != nil {
+				iterTags = withVariant(iterTags, variant())
+			}
+			for k := range tags {
+				delete(tags, k)
+			}
+			for k, v := range iterTags {
+				tags[k] = v
+			}
 		case <-ctx.Done():
 			return
 		}
 
-		if h.vu != nil {
-			err := h.vu.RunOnce(ctx)
+		h.RLock()
+		vu := h.vu
+		h.RUnlock()
+
+		if vu != nil {
+			err := vu.RunOnce(ctx)
 			select {
 			case <-ctx.Done():
 			// Don't log errors or emit iterations metrics from cancelled iterations
@@ -79,14 +214,31 @@ func (h *vuHandle) run(logger *log.Logger, flow <-chan int64, iterDone chan<- st
 						logger.Error(err.Error())
 					}
 				}
-				iterDone <- struct{}{}
+				iterDone <- iterTags
+
+				iters++
+				if reason := recycler.recycleReason(iters, err, heapGen); reason != "" {
+					h.recycle(logger, recycler, reason)
+					iters = 0
+					heapGen = recycler.currentHeapGen()
+				}
 			}
 		} else {
-			iterDone <- struct{}{}
+			iterDone <- iterTags
 		}
 	}
 }
 
+// withVariant returns a copy of the execution tags of an iteration with the experiment variant.
+func withVariant(iterTags map[string]string, variant string) map[string]string {
+	tags := make(map[string]string, len(iterTags)+1)
+	for k, v := range iterTags {
+		tags[k] = v
+	}
+	tags["variant"] = variant
+	return tags
+}
+
 type Executor struct {
 	Runner lib.Runner
 	Logger *log.Logger
@@ -103,6 +255,8 @@ type Executor struct {
 	numVUsMax int64
 	nextVUID  int64
 
+	variantIters int64 // Iterations that were assigned a variant, if they are assigned per iteration.
+
 	iters     int64 // Completed iterations
 	partIters int64 // Partial, incomplete iterations
 	endIters  int64 // End test at this many iterations
@@ -115,6 +269,16 @@ type Executor struct {
 
 	stages []lib.Stage
 
+	// Tags for the iterations started right now, e.g. the current stage; only used by Run().
+	iterTags  map[string]string
+	iterStage int
+
+	// If set, iterations are only started at these offsets from the start of the test, and the
+	// test ends once all of them are done. See SetIterationSchedule().
+	schedule     []time.Duration
+	scheduleNext int
+	scheduleLate bool
+
 	// Lock for: ctx, flow, out
 	lock sync.RWMutex
 
@@ -124,11 +288,71 @@ type Executor struct {
 	// Output channel to which VUs send samples.
 	vuOut chan stats.SampleContainer
 
-	// Channel on which VUs sigal that iterations are completed
-	iterDone chan struct{}
+	// Channel on which VUs sigal that iterations are completed, with the execution tags that
+	// the iteration ran with.
+	iterDone chan map[string]string
 
 	// Flow control for VUs; iterations are run only after reading from this channel.
-	flow chan int64
+	// Each value is the set of execution tags that the iteration should be tagged with.
+	flow chan map[string]string
+
+	// Bumped whenever the VUs should be recycled because of the vuRecycleHeapLimit option; atomic.
+	heapGen int64
+}
+
+// How often the heap size is checked against the vuRecycleHeapLimit option, how long to wait
+// after recycling the VUs before they can be recycled again, and the function that returns the
+// size of the Go heap and the number of completed GC cycles; all of them are swapped in tests.
+var (
+	heapCheckInterval   = 1 * time.Second
+	heapRecycleInterval = 1 * time.Minute
+	readHeapStats       = func() (heapAlloc, numGC uint64) {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc, uint64(ms.NumGC)
+	}
+)
+
+// watchHeap bumps the heap generation whenever the Go heap of the whole process exceeds the limit,
+// which makes every VU recycle itself after its current iteration. goja can't measure the heap of
+// a single VU, so there's no telling which VU is leaking, and all of them are recycled.
+// Each new generation needs a GC cycle after the previous one, so that the memory of the
+// discarded VUs is reclaimed before the heap is checked against the limit again, and at least
+// heapRecycleInterval, so a limit that's too low doesn't keep the VUs stuck in their init code.
+func (e *Executor) watchHeap(ctx context.Context, limit int64) {
+	ticker := time.NewTicker(heapCheckInterval)
+	defer ticker.Stop()
+
+	var lastNumGC uint64
+	var lastRecycle time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if e.GetVUs() <= 0 {
+			continue
+		}
+		heapAlloc, numGC := readHeapStats()
+		if !lastRecycle.IsZero() && (numGC == lastNumGC || time.Since(lastRecycle) < heapRecycleInterval) {
+			continue
+		}
+		if int64(heapAlloc) > limit {
+			lastNumGC = numGC
+			lastRecycle = time.Now()
+			gen := atomic.AddInt64(&e.heapGen, 1)
+			e.Logger.WithFields(log.Fields{"heap": heapAlloc, "limit": limit, "generation": gen}).
+				Debug("Local: Heap limit exceeded, recycling the VUs")
+		}
+	}
+}
+
+func init() {
+	lib.RegisterExecutor(lib.DefaultExecutorName, func(r lib.Runner) (lib.Executor, error) {
+		return New(r), nil
+	})
 }
 
 func New(r lib.Runner) *Executor {
@@ -145,7 +369,7 @@ func New(r lib.Runner) *Executor {
 		endIters:    -1,
 		endTime:     -1,
 		vuOut:       make(chan stats.SampleContainer, bufferSize),
-		iterDone:    make(chan struct{}),
+		iterDone:    make(chan map[string]string),
 	}
 }
 
@@ -153,6 +377,36 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	e.runLock.Lock()
 	defer e.runLock.Unlock()
 
+	// The VUs don't run anything else once the test is over, so they're closed when all of them
+	// have stopped. Closing them doesn't stop them from running in a later Run() though.
+	defer e.closeVUs()
+
+	// The rps limiters are shared by all VUs, so that the limits are accurate regardless of
+	// their number. The global one also applies to setup() and teardown(), while the one of the
+	// scenario only applies to its iterations.
+	teardownCtx := context.Background()
+	var scenarioLimiter *rate.Limiter
+	var scenario scheduler.Config
+	if e.Runner != nil {
+		opts := e.Runner.GetOptions()
+		if rps := opts.RPS; rps.Valid && rps.Int64 > 0 {
+			limiter := rate.NewLimiter(rate.Limit(rps.Int64), 1)
+			parent = lib.WithRPSLimiter(parent, limiter)
+			teardownCtx = lib.WithRPSLimiter(teardownCtx, limiter)
+		}
+		if sched, ok := opts.Execution[lib.DefaultSchedulerName]; ok {
+			scenario = sched
+			if rps := sched.GetBaseConfig().RPS; rps.Valid && rps.Int64 > 0 {
+				scenarioLimiter = rate.NewLimiter(rate.Limit(rps.Int64), 1)
+			}
+		}
+	}
+
+	if runner, ok := e.Runner.(lib.HealthCheckRunner); ok {
+		if err := runner.HealthCheck(parent); err != nil {
+			return err
+		}
+	}
 	if e.Runner != nil && e.runSetup {
 		if err := e.Runner.Setup(parent, engineOut); err != nil {
 			return err
@@ -160,7 +414,13 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	}
 
 	ctx, cancel := context.WithCancel(parent)
-	vuFlow := make(chan int64)
+	if scenarioLimiter != nil {
+		ctx = lib.WithRPSLimiter(ctx, scenarioLimiter)
+	}
+	if scenario != nil {
+		ctx = lib.WithScenario(ctx, scenario)
+	}
+	vuFlow := make(chan map[string]string)
 	e.lock.Lock()
 	vuOut := e.vuOut
 	iterDone := e.iterDone
@@ -168,10 +428,22 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	e.flow = vuFlow
 	e.lock.Unlock()
 
+	if e.Runner != nil {
+		if limit := e.Runner.GetOptions().VURecycleHeapLimit.Int64; limit > 0 {
+			e.wg.Add(1)
+			go func() {
+				e.watchHeap(ctx, limit)
+				e.wg.Done()
+			}()
+		}
+	}
+
 	var cutoff time.Time
 	defer func() {
 		if e.Runner != nil && e.runTeardown {
-			err := e.Runner.Teardown(parent, engineOut)
+			// teardown() usually cleans up whatever setup() created, so it's executed even if the
+			// test was aborted, i.e. the parent context is done. It's limited by its own timeout.
+			err := e.Runner.Teardown(teardownCtx, engineOut)
 			if reterr == nil {
 				reterr = err
 			} else if err != nil {
@@ -221,32 +493,57 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 		}
 	}()
 
+	// The startTime of the scenario delays its workload, but not setup(). The clock of the
+	// executor only starts once the workload does, so the stages and the duration are relative
+	// to its start.
+	if scenario != nil {
+		if startTime := time.Duration(scenario.GetBaseConfig().StartTime.Duration); startTime > 0 {
+			e.Logger.WithField("startTime", startTime).Debug("Local: Delaying the start of the scenario")
+			timer := time.NewTimer(startTime)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				cutoff = time.Now()
+				return nil
+			}
+		}
+	}
+
 	startVUs := atomic.LoadInt64(&e.numVUs)
 	if err := e.scale(ctx, lib.Max(0, startVUs)); err != nil {
 		return err
 	}
 
+	e.updateIterTags(time.Duration(atomic.LoadInt64(&e.time)), true)
+
 	ticker := time.NewTicker(1 * time.Millisecond)
 	defer ticker.Stop()
 
+	// While paused, the clock and the stages are frozen and no new iterations are started, but
+	// iterations that are already running are allowed to finish and their samples are still
+	// passed on. On resume, the last tick is shifted by the time spent paused, so the schedule
+	// continues exactly where it left off.
 	lastTick := time.Now()
+	var pausedAt time.Time
+	e.scheduleNext = int(lib.Min(atomic.LoadInt64(&e.partIters), int64(len(e.schedule))))
+	if e.schedule != nil && atomic.LoadInt64(&e.iters) >= int64(len(e.schedule)) {
+		e.Logger.Debug("Local: No scheduled iterations left")
+		return nil
+	}
 	for {
-		// If the test is paused, sleep until either the pause or the test ends.
-		// Also shift the last tick to omit time spent paused, but not partial ticks.
 		e.pauseLock.RLock()
 		pause := e.pause
 		e.pauseLock.RUnlock()
-		if pause != nil {
+		if pause != nil && pausedAt.IsZero() {
 			e.Logger.Debug("Local: Pausing!")
-			leftovers := time.Since(lastTick)
-			select {
-			case <-pause:
-				e.Logger.Debug("Local: No longer paused")
-				lastTick = time.Now().Add(-leftovers)
-			case <-ctx.Done():
-				e.Logger.Debug("Local: Terminated while in paused state")
-				return nil
-			}
+			pausedAt = time.Now()
+		} else if pause == nil && !pausedAt.IsZero() {
+			// Checked here rather than when the pause channel is closed, because the select below
+			// may just as well pick up a sample or a finished iteration at the same time.
+			e.Logger.Debug("Local: No longer paused")
+			lastTick = lastTick.Add(time.Since(pausedAt))
+			pausedAt = time.Time{}
 		}
 
 		// Dumb hack: we don't wanna start any more iterations than the max, but we can't
@@ -258,16 +555,34 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 		if end >= 0 && partials >= end {
 			flow = nil
 		}
+		if e.schedule != nil && !e.iterationScheduled() {
+			flow = nil
+		}
+		ticks := ticker.C
+		if pause != nil {
+			flow = nil
+			ticks = nil
+		}
 
 		select {
-		case flow <- partials:
+		case <-pause:
+			// Reading from a nil channel blocks forever, so this only fires once we're resumed.
+			// The resume itself is handled at the top of the loop.
+		case flow <- e.iterTags:
 			// Start an iteration if there's a VU waiting. See also: the big comment block above.
 			atomic.AddInt64(&e.partIters, 1)
-		case t := <-ticker.C:
+			if e.schedule != nil {
+				e.iterationStarted()
+			}
+		case t := <-ticks:
 			// Every tick, increment the clock, see if we passed the end point, and process stages.
 			// If the test ends this way, set a cutoff point; any samples collected past the cutoff
-			// point are excluded.
+			// point are excluded. A tick left over from before a pause is older than the shifted
+			// last tick and is skipped.
 			d := t.Sub(lastTick)
+			if d <= 0 {
+				break
+			}
 			lastTick = t
 
 			end := time.Duration(atomic.LoadInt64(&e.endTime))
@@ -291,21 +606,18 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 						return err
 					}
 				}
+				e.updateIterTags(at, false)
 			}
 		case sampleContainer := <-vuOut:
 			engineOut <- sampleContainer
-		case <-iterDone:
+		case iterTags := <-iterDone:
 			// Every iteration ends with a write to iterDone. Check if we've hit the end point.
 			// If not, make sure to include an Iterations bump in the list!
-			var tags *stats.SampleTags
-			if e.Runner != nil {
-				tags = e.Runner.GetOptions().RunTags
-			}
 			engineOut <- stats.Sample{
 				Time:   time.Now(),
 				Metric: metrics.Iterations,
 				Value:  1,
-				Tags:   tags,
+				Tags:   e.iterationTags(iterTags),
 			}
 
 			end := atomic.LoadInt64(&e.endIters)
@@ -314,6 +626,10 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("Local: Hit iteration limit")
 				return nil
 			}
+			if e.schedule != nil && at >= int64(len(e.schedule)) {
+				e.Logger.WithField("at", at).Debug("Local: Ran out of scheduled iterations")
+				return nil
+			}
 		case <-ctx.Done():
 			// If the test is cancelled, just set the cutoff point to now and proceed down the same
 			// logic as if the time limit was hit.
@@ -324,6 +640,84 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	}
 }
 
+// iterationScheduled returns whether the next iteration on the schedule is due.
+func (e *Executor) iterationScheduled() bool {
+	return e.scheduleNext < len(e.schedule) &&
+		e.schedule[e.scheduleNext] <= time.Duration(atomic.LoadInt64(&e.time))
+}
+
+// iterationStarted moves on to the next iteration on the schedule, and warns once if iterations
+// start noticeably later than scheduled, most likely because there weren't enough free VUs.
+func (e *Executor) iterationStarted() {
+	if lag := time.Duration(atomic.LoadInt64(&e.time)) - e.schedule[e.scheduleNext]; lag > maxScheduleLag && !e.scheduleLate {
+		e.scheduleLate = true
+		e.Logger.WithField("lag", lag).Warn("Iterations are starting later than scheduled, consider increasing the number of VUs")
+	}
+	e.scheduleNext++
+}
+
+// iterationTags returns the tags of the iterations metric for an iteration that ran with the
+// given execution tags: the run tags, the execution tags, e.g. the scenario and the stage, and
+// the root group, like the iteration_duration metric of the iteration.
+func (e *Executor) iterationTags(iterTags map[string]string) *stats.SampleTags {
+	if e.Runner == nil {
+		return nil
+	}
+	opts := e.Runner.GetOptions()
+	if len(iterTags) == 0 && !opts.SystemTags["group"] {
+		return opts.RunTags
+	}
+	tags := opts.RunTags.CloneTags()
+	for k, v := range iterTags {
+		tags[k] = v
+	}
+	if opts.SystemTags["group"] {
+		tags["group"] = e.Runner.GetDefaultGroup().Path
+	}
+	return stats.IntoSampleTags(&tags)
+}
+
+// variantPicker returns a function that picks the experiment variant of every iteration of the
+// VU with the given ID, or nil if there are no variants.
+func (e *Executor) variantPicker(id int64) func() string {
+	if e.Runner == nil {
+		return nil
+	}
+	opts := e.Runner.GetOptions()
+	variants := lib.NewVariantAssigner(opts.Variants)
+	if variants == nil {
+		return nil
+	}
+	if opts.VariantsPer.String == lib.VariantsPerIteration {
+		return func() string { return variants.Assign(atomic.AddInt64(&e.variantIters, 1) - 1) }
+	}
+	variant := variants.Assign(id - 1)
+	return func() string { return variant }
+}
+
+// updateIterTags rebuilds the execution tags for newly started iterations, if the current stage
+// has changed (or if forced to). The maps are never modified after they're built, since VUs
+// may still be copying them.
+func (e *Executor) updateIterTags(at time.Duration, force bool) {
+	stage := StageIndex(e.stages, at)
+	if !force && stage == e.iterStage {
+		return
+	}
+	e.iterStage = stage
+
+	tags := map[string]string{}
+	if e.Runner != nil {
+		systemTags := e.Runner.GetOptions().SystemTags
+		if systemTags["scenario"] {
+			tags["scenario"] = lib.DefaultSchedulerName
+		}
+		if systemTags["stage"] && stage >= 0 {
+			tags["stage"] = strconv.Itoa(stage)
+		}
+	}
+	e.iterTags = tags
+}
+
 func (e *Executor) scale(ctx context.Context, num int64) error {
 	e.Logger.WithField("num", num).Debug("Local: Scaling...")
 
@@ -333,8 +727,16 @@ func (e *Executor) scale(ctx context.Context, num int64) error {
 	e.lock.RLock()
 	flow := e.flow
 	iterDone := e.iterDone
+	vuOut := e.vuOut
 	e.lock.RUnlock()
 
+	var recycler *vuRecycler
+	if e.Runner != nil {
+		recycler = newVURecycler(e.Runner.GetOptions(), &e.heapGen, func() (lib.VU, error) {
+			return e.Runner.NewVU(vuOut)
+		}, vuOut)
+	}
+
 	for i, handle := range e.vus {
 		handle := handle
 		handle.RLock()
@@ -344,20 +746,26 @@ func (e *Executor) scale(ctx context.Context, num int64) error {
 		if i < int(num) {
 			if cancel == nil {
 				vuctx, cancel := context.WithCancel(ctx)
+				tags := map[string]string{}
+				vuctx = lib.WithExecutionTags(vuctx, tags)
+				id := atomic.AddInt64(&e.nextVUID, 1)
 				handle.Lock()
 				handle.ctx = vuctx
+				handle.tags = tags
 				handle.cancel = cancel
+				handle.id = id
+				vu := handle.vu
 				handle.Unlock()
 
-				if handle.vu != nil {
-					if err := handle.vu.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
+				if vu != nil {
+					if err := vu.Reconfigure(id); err != nil {
 						return err
 					}
 				}
 
 				e.wg.Add(1)
 				go func() {
-					handle.run(e.Logger, flow, iterDone)
+					handle.run(e.Logger, flow, iterDone, recycler, e.variantPicker(id))
 					e.wg.Done()
 				}()
 			}
@@ -405,12 +813,27 @@ func (e *Executor) GetIterations() int64 {
 
 func (e *Executor) GetEndIterations() null.Int {
 	v := atomic.LoadInt64(&e.endIters)
+	if v < 0 && e.schedule != nil {
+		return null.IntFrom(int64(len(e.schedule)))
+	}
 	if v < 0 {
 		return null.Int{}
 	}
 	return null.IntFrom(v)
 }
 
+// SetIterationSchedule makes the executor start iterations only at the supplied offsets from the
+// start of the test, which must be sorted, instead of whenever a VU is free. The test ends once all
+// of the scheduled iterations are done, unless it hits the end time or iterations before that.
+// This has to be called before Run().
+func (e *Executor) SetIterationSchedule(offsets []time.Duration) {
+	e.Logger.WithField("iterations", len(offsets)).Debug("Local: Setting the iteration schedule")
+	e.schedule = offsets
+	if e.schedule == nil {
+		e.schedule = []time.Duration{}
+	}
+}
+
 func (e *Executor) SetEndIterations(i null.Int) {
 	if !i.Valid {
 		i.Int64 = -1
@@ -439,6 +862,16 @@ func (e *Executor) SetEndTime(t types.NullDuration) {
 	atomic.StoreInt64(&e.endTime, int64(t.Duration))
 }
 
+// RestoreProgress sets the elapsed time and the number of completed iterations the executor
+// should start from, so a test can be continued from a previously saved point. It should only
+// be called before the executor is started.
+func (e *Executor) RestoreProgress(t time.Duration, iterations int64) {
+	e.Logger.WithFields(log.Fields{"t": t, "i": iterations}).Debug("Local: Restoring progress")
+	atomic.StoreInt64(&e.time, int64(t))
+	atomic.StoreInt64(&e.iters, iterations)
+	atomic.StoreInt64(&e.partIters, iterations)
+}
+
 func (e *Executor) IsPaused() bool {
 	e.pauseLock.RLock()
 	defer e.pauseLock.RUnlock()
@@ -509,6 +942,11 @@ func (e *Executor) SetVUsMax(max int64) error {
 	}
 
 	if max < numVUsMax {
+		for _, handle := range e.vus[max:] {
+			handle.RLock()
+			closeVU(e.Logger, handle.vu)
+			handle.RUnlock()
+		}
 		e.vus = e.vus[:max]
 		atomic.StoreInt64(&e.numVUsMax, max)
 		return nil
@@ -521,25 +959,78 @@ func (e *Executor) SetVUsMax(max int64) error {
 	e.vusLock.Lock()
 	defer e.vusLock.Unlock()
 
-	vus := e.vus
-	for i := numVUsMax; i < max; i++ {
-		var handle vuHandle
-		if e.Runner != nil {
-			vu, err := e.Runner.NewVU(vuOut)
-			if err != nil {
-				return err
-			}
-			handle.vu = vu
+	handles := make([]*vuHandle, max-numVUsMax)
+	for i := range handles {
+		handles[i] = &vuHandle{}
+	}
+	if e.Runner != nil {
+		if err := e.initVUs(handles, vuOut); err != nil {
+			return err
 		}
-		vus = append(vus, &handle)
 	}
-	e.vus = vus
+	e.vus = append(e.vus, handles...)
 
 	atomic.StoreInt64(&e.numVUsMax, max)
 
 	return nil
 }
 
+// initVUs instantiates the VUs for the given handles. The JS runtimes can't be cloned, so every
+// VU has to run the init code on its own; to cut down on the startup time of big tests, that is
+// done concurrently, with one worker per available CPU.
+func (e *Executor) initVUs(handles []*vuHandle, vuOut chan<- stats.SampleContainer) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(handles) {
+		workers = len(handles)
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				vu, err := e.Runner.NewVU(vuOut)
+				if err != nil {
+					errs <- err
+					return
+				}
+				handles[i].vu = vu
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range handles {
+		select {
+		case indexes <- i:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if err != nil {
+		// The other workers may have created some VUs already; they'll never be used.
+		for _, handle := range handles {
+			if handle.vu != nil {
+				closeVU(e.Logger, handle.vu)
+				handle.vu = nil
+			}
+		}
+	}
+	return err
+}
+
 func (e *Executor) SetRunSetup(r bool) {
 	e.runSetup = r
 }
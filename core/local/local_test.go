@@ -22,8 +22,10 @@ package local
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -33,6 +35,7 @@ import (
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/scheduler"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/pkg/errors"
@@ -40,6 +43,7 @@ import (
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -62,6 +66,13 @@ func TestExecutorRun(t *testing.T) {
 	assert.NoError(t, <-err)
 }
 
+func TestExecutorRegistered(t *testing.T) {
+	assert.Contains(t, lib.GetExecutorNames(), lib.DefaultExecutorName)
+	ex, err := lib.NewExecutor(lib.DefaultExecutorName, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &Executor{}, ex)
+}
+
 func TestExecutorSetupTeardownRun(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
 		setupC := make(chan struct{})
@@ -85,6 +96,29 @@ func TestExecutorSetupTeardownRun(t *testing.T) {
 		<-teardownC
 		assert.NoError(t, <-err)
 	})
+	t.Run("Aborted", func(t *testing.T) {
+		teardownC := make(chan error, 1)
+		e := New(&lib.MiniRunner{
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				<-ctx.Done()
+				return nil
+			},
+			TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				teardownC <- ctx.Err()
+				return nil
+			},
+		})
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.NoError(t, e.SetVUs(1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err := make(chan error, 1)
+		go func() { err <- e.Run(ctx, make(chan stats.SampleContainer, 100)) }()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		assert.NoError(t, <-err)
+		assert.NoError(t, <-teardownC, "teardown() should get a usable context even after an abort")
+	})
 	t.Run("Setup Error", func(t *testing.T) {
 		e := New(&lib.MiniRunner{
 			SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
@@ -112,6 +146,23 @@ func TestExecutorSetupTeardownRun(t *testing.T) {
 			assert.EqualError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)), "teardown error")
 		})
 	})
+	t.Run("Health Check Error", func(t *testing.T) {
+		setupC := make(chan struct{}, 1)
+		e := New(&lib.MiniRunner{
+			HealthCheckFn: func(ctx context.Context) error {
+				return errors.New("not ready")
+			},
+			SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+				setupC <- struct{}{}
+				return nil, nil
+			},
+		})
+		e.SetEndIterations(null.IntFrom(1))
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.NoError(t, e.SetVUs(1))
+		assert.EqualError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)), "not ready")
+		assert.Len(t, setupC, 0, "setup() shouldn't run if the health check fails")
+	})
 	t.Run("Teardown Error", func(t *testing.T) {
 		e := New(&lib.MiniRunner{
 			SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
@@ -194,6 +245,359 @@ func TestExecutorStages(t *testing.T) {
 	}
 }
 
+func TestExecutorStageTags(t *testing.T) {
+	var lock sync.Mutex
+	seen := map[string]bool{}
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			tags := lib.GetExecutionTags(ctx)
+			lock.Lock()
+			seen[tags["scenario"]+"/"+tags["stage"]] = true
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		Options: lib.Options{
+			MetricSamplesBufferSize: null.IntFrom(500),
+			SystemTags:              lib.GetTagSet("scenario", "stage"),
+		},
+	})
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetStages([]lib.Stage{
+		{Duration: types.NullDurationFrom(500 * time.Millisecond)},
+		{Duration: types.NullDurationFrom(500 * time.Millisecond)},
+	})
+	assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 500)))
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, map[string]bool{"default/0": true, "default/1": true}, seen)
+}
+
+func TestExecutorIterationsTags(t *testing.T) {
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		Options: lib.Options{
+			MetricSamplesBufferSize: null.IntFrom(500),
+			SystemTags:              lib.GetTagSet("scenario", "stage", "group"),
+			RunTags:                 stats.IntoSampleTags(&map[string]string{"testid": "1"}),
+		},
+	})
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetStages([]lib.Stage{
+		{Duration: types.NullDurationFrom(300 * time.Millisecond)},
+		{Duration: types.NullDurationFrom(300 * time.Millisecond)},
+	})
+	samples := make(chan stats.SampleContainer, 500)
+	assert.NoError(t, e.Run(context.Background(), samples))
+	close(samples)
+
+	stages := map[string]bool{}
+	for sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if s.Metric != metrics.Iterations {
+				continue
+			}
+			tags := s.Tags.CloneTags()
+			stages[tags["stage"]] = true
+			delete(tags, "stage")
+			assert.Equal(t, map[string]string{"testid": "1", "scenario": "default", "group": ""}, tags)
+		}
+	}
+	assert.Equal(t, map[string]bool{"0": true, "1": true}, stages)
+}
+
+func TestExecutorVariants(t *testing.T) {
+	for _, per := range []string{lib.VariantsPerVU, lib.VariantsPerIteration} {
+		per := per
+		t.Run(per, func(t *testing.T) {
+			var lock sync.Mutex
+			// The variants that every VU ran, by the address of its execution tags.
+			seen := map[string]map[string]bool{}
+			e := New(&lib.MiniRunner{
+				Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+					tags := lib.GetExecutionTags(ctx)
+					vu := fmt.Sprintf("%p", tags)
+					lock.Lock()
+					if seen[vu] == nil {
+						seen[vu] = map[string]bool{}
+					}
+					seen[vu][tags["variant"]] = true
+					lock.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					return nil
+				},
+				Options: lib.Options{
+					MetricSamplesBufferSize: null.IntFrom(500),
+					Variants:                map[string]float64{"a": 1, "b": 1},
+					VariantsPer:             null.StringFrom(per),
+				},
+			})
+			assert.NoError(t, e.SetVUsMax(2))
+			assert.NoError(t, e.SetVUs(2))
+			e.SetEndTime(types.NullDurationFrom(300 * time.Millisecond))
+			samples := make(chan stats.SampleContainer, 500)
+			assert.NoError(t, e.Run(context.Background(), samples))
+			close(samples)
+
+			require.Len(t, seen, 2)
+			all := map[string]bool{}
+			for _, variants := range seen {
+				for variant := range variants {
+					all[variant] = true
+				}
+				if per == lib.VariantsPerVU {
+					assert.Len(t, variants, 1)
+				} else {
+					assert.Len(t, variants, 2)
+				}
+			}
+			assert.Equal(t, map[string]bool{"a": true, "b": true}, all)
+
+			for sc := range samples {
+				for _, s := range sc.GetSamples() {
+					if s.Metric == metrics.Iterations {
+						assert.Contains(t, []string{"a", "b"}, s.Tags.CloneTags()["variant"])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExecutorRPSLimiters(t *testing.T) {
+	var lock sync.Mutex
+	var setup, iterations, teardown [][]*rate.Limiter
+	var scenarios []scheduler.Config
+
+	sched := scheduler.NewConstantLoopingVUsConfig(lib.DefaultSchedulerName)
+	sched.RPS = null.IntFrom(5)
+	e := New(&lib.MiniRunner{
+		SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+			setup = append(setup, lib.GetRPSLimiters(ctx))
+			return nil, nil
+		},
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			lock.Lock()
+			iterations = append(iterations, lib.GetRPSLimiters(ctx))
+			scenarios = append(scenarios, lib.GetScenario(ctx))
+			lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			teardown = append(teardown, lib.GetRPSLimiters(ctx))
+			return nil
+		},
+		Options: lib.Options{
+			RPS:       null.IntFrom(20),
+			Execution: scheduler.ConfigMap{lib.DefaultSchedulerName: sched},
+		},
+	})
+	assert.NoError(t, e.SetVUsMax(2))
+	assert.NoError(t, e.SetVUs(2))
+	e.SetEndIterations(null.IntFrom(4))
+	assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+
+	require.Len(t, setup, 1)
+	require.Len(t, setup[0], 1)
+	global := setup[0][0]
+	assert.Equal(t, rate.Limit(20), global.Limit())
+	assert.Equal(t, [][]*rate.Limiter{{global}}, teardown)
+
+	require.True(t, len(iterations) >= 4)
+	scenario := iterations[0][1]
+	assert.Equal(t, rate.Limit(5), scenario.Limit())
+	for _, limiters := range iterations {
+		// All iterations of all VUs share the same limiters.
+		assert.Equal(t, []*rate.Limiter{global, scenario}, limiters)
+	}
+	for _, config := range scenarios {
+		assert.Equal(t, sched, config)
+	}
+}
+
+func TestExecutorStartTime(t *testing.T) {
+	sched := scheduler.NewConstantLoopingVUsConfig(lib.DefaultSchedulerName)
+	sched.StartTime = types.NullDurationFrom(200 * time.Millisecond)
+
+	var lock sync.Mutex
+	var setupAt, firstIterAt time.Time
+	e := New(&lib.MiniRunner{
+		SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+			setupAt = time.Now()
+			return nil, nil
+		},
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			lock.Lock()
+			if firstIterAt.IsZero() {
+				firstIterAt = time.Now()
+			}
+			lock.Unlock()
+			return nil
+		},
+		Options: lib.Options{Execution: scheduler.ConfigMap{lib.DefaultSchedulerName: sched}},
+	})
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetEndIterations(null.IntFrom(2))
+
+	start := time.Now()
+	assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+	assert.True(t, setupAt.Sub(start) < 100*time.Millisecond, "setup() was delayed")
+	assert.True(t, firstIterAt.Sub(start) >= 200*time.Millisecond, "the iterations weren't delayed")
+	assert.Equal(t, int64(2), e.GetIterations())
+
+	t.Run("Cancelled", func(t *testing.T) {
+		sched.StartTime = types.NullDurationFrom(time.Hour)
+		e := New(&lib.MiniRunner{Options: lib.Options{Execution: scheduler.ConfigMap{lib.DefaultSchedulerName: sched}}})
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.NoError(t, e.SetVUs(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, e.Run(ctx, make(chan stats.SampleContainer, 100)))
+		assert.Equal(t, int64(0), e.GetIterations())
+	})
+}
+
+// recyclingRunner counts how many VUs were initialized and how many of them were closed.
+type recyclingRunner struct {
+	*lib.MiniRunner
+	newVUs, closedVUs int64
+}
+
+func (r *recyclingRunner) NewVU(out chan<- stats.SampleContainer) (lib.VU, error) {
+	atomic.AddInt64(&r.newVUs, 1)
+	vu, err := r.MiniRunner.NewVU(out)
+	if err != nil {
+		return nil, err
+	}
+	return &closableVU{VU: vu, closed: &r.closedVUs}, nil
+}
+
+type closableVU struct {
+	lib.VU
+	closed *int64
+}
+
+func (vu *closableVU) Close() error {
+	atomic.AddInt64(vu.closed, 1)
+	return nil
+}
+
+func TestExecutorVURecycling(t *testing.T) {
+	testdata := map[string]struct {
+		opts   lib.Options
+		newVUs int64
+	}{
+		"Disabled":   {lib.Options{}, 1},
+		"Iterations": {lib.Options{VURecycleIterations: null.IntFrom(3)}, 4},
+		"OnError":    {lib.Options{VURecycleOnError: null.BoolFrom(true)}, 2},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			var iters int64
+			runner := &recyclingRunner{MiniRunner: &lib.MiniRunner{
+				Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+					if atomic.AddInt64(&iters, 1) == 2 {
+						return errors.New("oops")
+					}
+					return nil
+				},
+				Options: data.opts,
+			}}
+			e := New(runner)
+			l, _ := logtest.NewNullLogger()
+			e.SetLogger(l)
+			assert.NoError(t, e.SetVUsMax(1))
+			assert.NoError(t, e.SetVUs(1))
+			e.SetEndIterations(null.IntFrom(10))
+
+			assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+			assert.Equal(t, int64(10), e.GetIterations())
+			assert.Equal(t, data.newVUs, atomic.LoadInt64(&runner.newVUs))
+			// The recycled VUs are closed right away and the last one once the test is over
+			assert.Equal(t, data.newVUs, atomic.LoadInt64(&runner.closedVUs))
+		})
+	}
+}
+
+func TestExecutorSetVUsMaxClosesVUs(t *testing.T) {
+	runner := &recyclingRunner{MiniRunner: &lib.MiniRunner{}}
+	e := New(runner)
+	assert.NoError(t, e.SetVUsMax(3))
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&runner.newVUs))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&runner.closedVUs))
+}
+
+func TestExecutorVURecycleHeapLimit(t *testing.T) {
+	defer func(check, recycle time.Duration, read func() (uint64, uint64)) {
+		heapCheckInterval, heapRecycleInterval, readHeapStats = check, recycle, read
+	}(heapCheckInterval, heapRecycleInterval, readHeapStats)
+	heapCheckInterval = 5 * time.Millisecond
+
+	everyGC := func(n uint64) uint64 { return n }
+	testdata := map[string]struct {
+		limit    int64
+		interval time.Duration
+		numGC    func(n uint64) uint64
+		newVUs   func(t *testing.T, n int64)
+	}{
+		"Below":       {2000, 0, everyGC, func(t *testing.T, n int64) { assert.Equal(t, int64(1), n) }},
+		"NoGC":        {500, 0, func(uint64) uint64 { return 1 }, func(t *testing.T, n int64) { assert.Equal(t, int64(2), n) }},
+		"EveryGC":     {500, 0, everyGC, func(t *testing.T, n int64) { assert.True(t, n > 2) }},
+		"RateLimited": {500, time.Hour, everyGC, func(t *testing.T, n int64) { assert.Equal(t, int64(2), n) }},
+	}
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			heapRecycleInterval = data.interval
+			var reads uint64
+			readHeapStats = func() (uint64, uint64) {
+				return 1000, data.numGC(atomic.AddUint64(&reads, 1))
+			}
+
+			runner := &recyclingRunner{MiniRunner: &lib.MiniRunner{
+				Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+					time.Sleep(2 * time.Millisecond)
+					return nil
+				},
+				Options: lib.Options{VURecycleHeapLimit: null.IntFrom(data.limit)},
+			}}
+			e := New(runner)
+			l, _ := logtest.NewNullLogger()
+			e.SetLogger(l)
+			assert.NoError(t, e.SetVUsMax(1))
+			assert.NoError(t, e.SetVUs(1))
+			e.SetEndIterations(null.IntFrom(50))
+
+			samples := make(chan stats.SampleContainer, 100)
+			assert.NoError(t, e.Run(context.Background(), samples))
+			close(samples)
+			newVUs := atomic.LoadInt64(&runner.newVUs)
+			data.newVUs(t, newVUs)
+
+			var recycles int64
+			for sc := range samples {
+				for _, s := range sc.GetSamples() {
+					if s.Metric == metrics.VURecycles {
+						recycles++
+						reason, _ := s.Tags.Get("reason")
+						assert.Equal(t, "heap", reason)
+					}
+				}
+			}
+			assert.Equal(t, newVUs-1, recycles)
+		})
+	}
+}
+
 func TestExecutorEndTime(t *testing.T) {
 	e := New(&lib.MiniRunner{
 		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
@@ -261,6 +665,90 @@ func TestExecutorEndTime(t *testing.T) {
 	})
 }
 
+func TestExecutorPause(t *testing.T) {
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+		Options: lib.Options{MetricSamplesBufferSize: null.IntFrom(200)},
+	})
+	assert.NoError(t, e.SetVUsMax(2))
+	assert.NoError(t, e.SetVUs(2))
+	e.SetEndTime(types.NullDurationFrom(300 * time.Millisecond))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	errC := make(chan error, 1)
+	startTime := time.Now()
+	go func() { errC <- e.Run(context.Background(), samples) }()
+
+	time.Sleep(100 * time.Millisecond)
+	e.SetPaused(true)
+	time.Sleep(50 * time.Millisecond) // let the running iterations finish
+	pausedTime := e.GetTime()
+	pausedIters := e.GetIterations()
+	assert.True(t, pausedTime < 300*time.Millisecond, "clock ran out while pausing: %s", pausedTime)
+
+	time.Sleep(400 * time.Millisecond)
+	assert.Equal(t, pausedTime, e.GetTime(), "clock advanced while paused")
+	assert.Equal(t, pausedIters, e.GetIterations(), "iterations started while paused")
+	assert.True(t, e.IsRunning())
+
+	e.SetPaused(false)
+	assert.NoError(t, <-errC)
+	assert.True(t, e.GetIterations() > pausedIters)
+	assert.True(t, time.Since(startTime) >= 750*time.Millisecond, "the pause wasn't added to the duration")
+}
+
+func TestExecutorResumeWithSamples(t *testing.T) {
+	metric := &stats.Metric{Name: "test_metric"}
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			// A single long iteration keeps emitting samples, even while the test is paused
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case out <- stats.Sample{Metric: metric, Value: 1.0}:
+				}
+			}
+		},
+	})
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetEndTime(types.NullDurationFrom(2 * time.Second))
+
+	samples := make(chan stats.SampleContainer, 100)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-samples:
+			case <-done:
+				return
+			}
+		}
+	}()
+	errC := make(chan error, 1)
+	go func() { errC <- e.Run(context.Background(), samples) }()
+
+	// Without its own case winning the select, the resume must still shift the clock
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		e.SetPaused(true)
+		pausedTime := e.GetTime()
+		time.Sleep(50 * time.Millisecond)
+		e.SetPaused(false)
+		time.Sleep(5 * time.Millisecond)
+		assert.True(t, e.GetTime()-pausedTime < 40*time.Millisecond,
+			"the pause was added to the clock: %s -> %s", pausedTime, e.GetTime())
+		assert.True(t, e.IsRunning())
+	}
+	e.SetEndTime(types.NullDurationFrom(0))
+	assert.NoError(t, <-errC)
+}
+
 func TestExecutorEndIterations(t *testing.T) {
 	metric := &stats.Metric{Name: "test_metric"}
 
@@ -342,6 +830,42 @@ func TestExecutorSetVUsMax(t *testing.T) {
 
 		assert.EqualError(t, e.SetVUsMax(50), "can't lower vu cap (to 50) below vu count (100)")
 	})
+
+	t.Run("Init", func(t *testing.T) {
+		r := &initCountingRunner{failAt: -1}
+		e := New(r)
+		require.NoError(t, e.SetVUsMax(100))
+		assert.Equal(t, int64(100), atomic.LoadInt64(&r.count))
+		for i, handle := range e.vus {
+			assert.NotNil(t, handle.vu, "vu %d", i)
+		}
+
+		t.Run("Error", func(t *testing.T) {
+			r := &initCountingRunner{failAt: 30}
+			e := New(r)
+			assert.EqualError(t, e.SetVUsMax(100), "init error")
+			assert.Equal(t, int64(0), e.GetVUsMax())
+			assert.Empty(t, e.vus)
+			// Every VU that was created before the error has been released
+			assert.Equal(t, atomic.LoadInt64(&r.count)-1, atomic.LoadInt64(&r.closed))
+		})
+	})
+}
+
+type initCountingRunner struct {
+	lib.MiniRunner
+	count, failAt, closed int64
+}
+
+func (r *initCountingRunner) NewVU(out chan<- stats.SampleContainer) (lib.VU, error) {
+	if atomic.AddInt64(&r.count, 1) == r.failAt {
+		return nil, errors.New("init error")
+	}
+	vu, err := r.MiniRunner.NewVU(out)
+	if err != nil {
+		return nil, err
+	}
+	return &closableVU{VU: vu, closed: &r.closed}, nil
 }
 
 func TestExecutorSetVUs(t *testing.T) {
@@ -559,8 +1083,9 @@ func TestRealTimeAndSetupTeardownMetrics(t *testing.T) {
 			Value:  expValue,
 		}
 	}
-	getDummyTrail := func(group string) stats.SampleContainer {
-		return netext.NewDialer(net.Dialer{}).GetTrail(time.Now(), time.Now(), true, getTags("group", group))
+	getDummyTrail := func(group string, extraTags ...string) stats.SampleContainer {
+		return netext.NewDialer(net.Dialer{}).GetTrail(time.Now(), time.Now(), true,
+			getTags(append([]string{"group", group}, extraTags...)...))
 	}
 
 	// Initially give a long time (5s) for the executor to start
@@ -568,15 +1093,15 @@ func TestRealTimeAndSetupTeardownMetrics(t *testing.T) {
 	expectIn(900, 1100, getSample(2, testCounter, "group", "::setup", "place", "setupAfterSleep"))
 	expectIn(0, 100, getDummyTrail("::setup"))
 
-	expectIn(0, 100, getSample(5, testCounter, "group", "", "place", "defaultBeforeSleep"))
-	expectIn(900, 1100, getSample(6, testCounter, "group", "", "place", "defaultAfterSleep"))
-	expectIn(0, 100, getDummyTrail(""))
-	expectIn(0, 100, getSample(1, metrics.Iterations))
+	expectIn(0, 100, getSample(5, testCounter, "group", "", "place", "defaultBeforeSleep", "scenario", "default"))
+	expectIn(900, 1100, getSample(6, testCounter, "group", "", "place", "defaultAfterSleep", "scenario", "default"))
+	expectIn(0, 100, getDummyTrail("", "scenario", "default"))
+	expectIn(0, 100, getSample(1, metrics.Iterations, "group", "", "scenario", "default"))
 
-	expectIn(0, 100, getSample(5, testCounter, "group", "", "place", "defaultBeforeSleep"))
-	expectIn(900, 1100, getSample(6, testCounter, "group", "", "place", "defaultAfterSleep"))
-	expectIn(0, 100, getDummyTrail(""))
-	expectIn(0, 100, getSample(1, metrics.Iterations))
+	expectIn(0, 100, getSample(5, testCounter, "group", "", "place", "defaultBeforeSleep", "scenario", "default"))
+	expectIn(900, 1100, getSample(6, testCounter, "group", "", "place", "defaultAfterSleep", "scenario", "default"))
+	expectIn(0, 100, getDummyTrail("", "scenario", "default"))
+	expectIn(0, 100, getSample(1, metrics.Iterations, "group", "", "scenario", "default"))
 
 	expectIn(0, 1000, getSample(3, testCounter, "group", "::teardown", "place", "teardownBeforeSleep"))
 	expectIn(900, 1100, getSample(4, testCounter, "group", "::teardown", "place", "teardownAfterSleep"))
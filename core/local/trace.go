@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// TraceExecutorName is the name of the registered executor that replays a trace file: it starts
+// a single iteration at each of the offsets in the file set with the traceFile option.
+const TraceExecutorName = "trace"
+
+func init() {
+	lib.RegisterExecutor(TraceExecutorName, newTraceExecutor)
+}
+
+func newTraceExecutor(r lib.Runner) (lib.Executor, error) {
+	if r == nil || !r.GetOptions().TraceFile.Valid || r.GetOptions().TraceFile.String == "" {
+		return nil, errors.New("the trace executor needs a trace file, set with the traceFile option")
+	}
+	filename := r.GetOptions().TraceFile.String
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := ParseTrace(data)
+	if err != nil {
+		return nil, errors.Wrap(err, filename)
+	}
+	if len(offsets) == 0 {
+		return nil, errors.Errorf("%s: the trace is empty", filename)
+	}
+
+	e := New(r)
+	e.SetIterationSchedule(offsets)
+	return e, nil
+}
+
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseTrace parses a trace into sorted offsets from the start of the test. A trace is either a
+// HAR file, in which case the entries are replayed relative to the first one, or a text file with
+// one offset per line, given in seconds ("1.5") or as a duration ("1500ms"). Empty lines and
+// lines starting with # are ignored.
+func ParseTrace(data []byte) ([]time.Duration, error) {
+	var offsets []time.Duration
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var har harLog
+		if err := json.Unmarshal(trimmed, &har); err != nil {
+			return nil, errors.Wrap(err, "invalid HAR file")
+		}
+		for _, entry := range har.Log.Entries {
+			offsets = append(offsets, entry.StartedDateTime.Sub(har.Log.Entries[0].StartedDateTime))
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			offset, err := parseTraceOffset(text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+			offsets = append(offsets, offset)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	if len(offsets) > 0 && offsets[0] < 0 {
+		// Only possible with the HAR entries out of order; shift everything to the earliest one.
+		start := offsets[0]
+		for i := range offsets {
+			offsets[i] -= start
+		}
+	}
+	return offsets, nil
+}
+
+func parseTraceOffset(s string) (time.Duration, error) {
+	var d time.Duration
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		d = time.Duration(secs * float64(time.Second))
+	} else if d, err = time.ParseDuration(s); err != nil {
+		return 0, errors.Errorf("'%s' is neither a number of seconds nor a duration", s)
+	}
+	if d < 0 {
+		return 0, errors.Errorf("offset '%s' is negative", s)
+	}
+	return d, nil
+}
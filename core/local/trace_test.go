@@ -0,0 +1,143 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestParseTrace(t *testing.T) {
+	testdata := map[string]struct {
+		data    string
+		offsets []time.Duration
+		err     string
+	}{
+		"empty": {"", nil, ""},
+		"text": {
+			"# offsets\n0\n1.5\n\n  250ms \n2s\n",
+			[]time.Duration{0, 250 * time.Millisecond, 1500 * time.Millisecond, 2 * time.Second}, "",
+		},
+		"invalid":  {"1\nsoon\n", nil, "line 2: 'soon' is neither a number of seconds nor a duration"},
+		"negative": {"-1\n", nil, "line 1: offset '-1' is negative"},
+		"har": {
+			`{"log": {"entries": [
+				{"startedDateTime": "2019-01-01T10:00:01.000Z"},
+				{"startedDateTime": "2019-01-01T10:00:00.500Z"},
+				{"startedDateTime": "2019-01-01T10:00:03.000+00:00"}
+			]}}`,
+			[]time.Duration{0, 500 * time.Millisecond, 2500 * time.Millisecond}, "",
+		},
+		"invalid har": {`{"log": {"entries": 5}}`, nil, "invalid HAR file: json: "},
+	}
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			offsets, err := ParseTrace([]byte(data.data))
+			if data.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), data.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, data.offsets, offsets)
+		})
+	}
+}
+
+func TestExecutorIterationSchedule(t *testing.T) {
+	var mu sync.Mutex
+	var started []time.Time
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			mu.Lock()
+			started = append(started, time.Now())
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+		Options: lib.Options{MetricSamplesBufferSize: null.IntFrom(200)},
+	})
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	offsets := []time.Duration{0, 100 * time.Millisecond, 110 * time.Millisecond, 300 * time.Millisecond}
+	e.SetIterationSchedule(offsets)
+	assert.Equal(t, null.IntFrom(4), e.GetEndIterations())
+
+	l, hook := logtest.NewNullLogger()
+	e.SetLogger(l)
+
+	startTime := time.Now()
+	require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 200)))
+	assert.Equal(t, int64(4), e.GetIterations())
+	require.Len(t, started, 4)
+	for i, offset := range offsets {
+		assert.True(t, started[i].Sub(startTime) >= offset, "iteration %d started before %s", i, offset)
+	}
+	// The third iteration has to wait for the single VU, but not by enough to warn.
+	assert.True(t, started[2].Sub(started[1]) >= 20*time.Millisecond)
+	assert.Empty(t, hook.Entries)
+
+	t.Run("empty", func(t *testing.T) {
+		e := New(&lib.MiniRunner{Options: lib.Options{MetricSamplesBufferSize: null.IntFrom(200)}})
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.NoError(t, e.SetVUs(1))
+		e.SetIterationSchedule(nil)
+		require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 200)))
+		assert.Equal(t, int64(0), e.GetIterations())
+	})
+}
+
+func TestTraceExecutor(t *testing.T) {
+	_, err := lib.NewExecutor(TraceExecutorName, &lib.MiniRunner{})
+	assert.EqualError(t, err, "the trace executor needs a trace file, set with the traceFile option")
+
+	dir, err := ioutil.TempDir("", "k6-trace")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	filename := filepath.Join(dir, "trace.txt")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("0\n0.01\n"), 0644))
+	ex, err := lib.NewExecutor(TraceExecutorName, &lib.MiniRunner{
+		Options: lib.Options{TraceFile: null.StringFrom(filename)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, 10 * time.Millisecond}, ex.(*Executor).schedule)
+
+	empty := filepath.Join(dir, "empty.txt")
+	require.NoError(t, ioutil.WriteFile(empty, []byte("# nothing\n"), 0644))
+	_, err = lib.NewExecutor(TraceExecutorName, &lib.MiniRunner{
+		Options: lib.Options{TraceFile: null.StringFrom(empty)},
+	})
+	assert.EqualError(t, err, empty+": the trace is empty")
+}
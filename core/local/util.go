@@ -62,3 +62,20 @@ func ProcessStages(startVUs int64, stages []lib.Stage, t time.Duration) (null.In
 	}
 	return vus, false
 }
+
+// Returns the index of the stage that is running at the specified time, or -1 if there are no
+// stages or they've all ended.
+func StageIndex(stages []lib.Stage, t time.Duration) int {
+	var start time.Duration
+	for i, stage := range stages {
+		if !stage.Duration.Valid {
+			return i
+		}
+		end := start + time.Duration(stage.Duration.Duration)
+		if end >= t {
+			return i
+		}
+		start = end
+	}
+	return -1
+}
@@ -291,3 +291,18 @@ func TestProcessStages(t *testing.T) {
 		})
 	}
 }
+
+func TestStageIndex(t *testing.T) {
+	stages := []lib.Stage{
+		{Duration: types.NullDurationFrom(10 * time.Second)},
+		{Duration: types.NullDurationFrom(5 * time.Second), Target: null.IntFrom(10)},
+	}
+	assert.Equal(t, -1, StageIndex(nil, 0))
+	assert.Equal(t, 0, StageIndex(stages, 0))
+	assert.Equal(t, 0, StageIndex(stages, 10*time.Second))
+	assert.Equal(t, 1, StageIndex(stages, 11*time.Second))
+	assert.Equal(t, 1, StageIndex(stages, 15*time.Second))
+	assert.Equal(t, -1, StageIndex(stages, 16*time.Second))
+	assert.Equal(t, 1, StageIndex(append(stages, lib.Stage{}), 11*time.Second))
+	assert.Equal(t, 2, StageIndex(append(stages, lib.Stage{}), 24*time.Hour))
+}
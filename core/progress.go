@@ -0,0 +1,101 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Progress is a snapshot of how far along a test run is. Both the CLI progress bar and the
+// REST API use it, so that they always agree with each other.
+type Progress struct {
+	Running bool
+	Paused  bool
+
+	// How much of the test is done, between 0 and 1; only valid if its end is known.
+	Fraction null.Float
+
+	Time    time.Duration
+	EndTime types.NullDuration // The end of the stages or the duration, whichever is first
+
+	Iterations          int64
+	EndIterations       null.Int
+	IterationsPerSecond float64
+
+	// The index of the currently running stage, or -1 if there are none.
+	Stage int
+
+	VUs    int64
+	VUsMax int64
+
+	// The estimated remaining time, based on the end time or the iterations rate.
+	ETA types.NullDuration
+}
+
+// GetProgress returns the current progress of the test.
+func (e *Engine) GetProgress() Progress {
+	ex := e.Executor
+	p := Progress{
+		Running:       ex.IsRunning(),
+		Paused:        ex.IsPaused(),
+		Time:          ex.GetTime(),
+		Iterations:    ex.GetIterations(),
+		EndIterations: ex.GetEndIterations(),
+		Stage:         local.StageIndex(ex.GetStages(), ex.GetTime()),
+		VUs:           ex.GetVUs(),
+		VUsMax:        ex.GetVUsMax(),
+	}
+
+	p.EndTime = ex.GetEndTime()
+	stagesEnd := lib.SumStages(ex.GetStages())
+	if stagesEnd.Valid && (!p.EndTime.Valid || p.EndTime.Duration > stagesEnd.Duration) {
+		p.EndTime = stagesEnd
+	}
+
+	if p.Time > 0 {
+		p.IterationsPerSecond = float64(p.Iterations) / p.Time.Seconds()
+	}
+
+	switch {
+	case p.EndIterations.Valid && p.EndIterations.Int64 > 0:
+		p.Fraction = null.FloatFrom(float64(p.Iterations) / float64(p.EndIterations.Int64))
+		if p.IterationsPerSecond > 0 {
+			left := float64(p.EndIterations.Int64-p.Iterations) / p.IterationsPerSecond
+			p.ETA = types.NullDurationFrom(time.Duration(left * float64(time.Second)))
+		}
+	case p.EndTime.Valid && p.EndTime.Duration > 0:
+		p.Fraction = null.FloatFrom(float64(p.Time) / float64(p.EndTime.Duration))
+		p.ETA = types.NullDurationFrom(time.Duration(p.EndTime.Duration) - p.Time)
+	}
+
+	if p.Fraction.Valid && p.Fraction.Float64 > 1 {
+		p.Fraction.Float64 = 1
+	}
+	if p.ETA.Valid && p.ETA.Duration < 0 {
+		p.ETA.Duration = 0
+	}
+	return p
+}
@@ -0,0 +1,99 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+// progressExecutor reports a fixed state, as if the test has been running for a while.
+type progressExecutor struct {
+	*local.Executor
+	time    time.Duration
+	iters   int64
+	endIter null.Int
+	endTime types.NullDuration
+	stages  []lib.Stage
+}
+
+func (e progressExecutor) GetTime() time.Duration         { return e.time }
+func (e progressExecutor) GetIterations() int64           { return e.iters }
+func (e progressExecutor) GetEndIterations() null.Int     { return e.endIter }
+func (e progressExecutor) GetEndTime() types.NullDuration { return e.endTime }
+func (e progressExecutor) GetStages() []lib.Stage         { return e.stages }
+func (e progressExecutor) IsRunning() bool                { return true }
+
+func TestEngineGetProgress(t *testing.T) {
+	stages := []lib.Stage{
+		{Duration: types.NullDurationFrom(10 * time.Second)},
+		{Duration: types.NullDurationFrom(30 * time.Second)},
+	}
+	testdata := map[string]struct {
+		ex       progressExecutor
+		fraction null.Float
+		eta      types.NullDuration
+		stage    int
+	}{
+		"Unbounded": {
+			progressExecutor{time: 10 * time.Second, iters: 50},
+			null.Float{}, types.NullDuration{}, -1,
+		},
+		"Duration": {
+			progressExecutor{time: 10 * time.Second, endTime: types.NullDurationFrom(40 * time.Second)},
+			null.FloatFrom(0.25), types.NullDurationFrom(30 * time.Second), -1,
+		},
+		"Stages": {
+			progressExecutor{time: 20 * time.Second, endTime: types.NullDurationFrom(time.Minute), stages: stages},
+			null.FloatFrom(0.5), types.NullDurationFrom(20 * time.Second), 1,
+		},
+		"Iterations": {
+			progressExecutor{time: 10 * time.Second, iters: 50, endIter: null.IntFrom(200)},
+			null.FloatFrom(0.25), types.NullDurationFrom(30 * time.Second), -1,
+		},
+		"Overtime": {
+			progressExecutor{time: 50 * time.Second, endTime: types.NullDurationFrom(40 * time.Second)},
+			null.FloatFrom(1), types.NullDurationFrom(0), -1,
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			ex := data.ex
+			ex.Executor = local.New(nil)
+			e, err := newTestEngine(ex, lib.Options{})
+			require.NoError(t, err)
+
+			p := e.GetProgress()
+			assert.True(t, p.Running)
+			assert.Equal(t, data.fraction, p.Fraction)
+			assert.Equal(t, data.eta, p.ETA)
+			assert.Equal(t, data.stage, p.Stage)
+			assert.Equal(t, float64(ex.iters)/ex.time.Seconds(), p.IterationsPerSecond)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// A progressRestorer is an executor that can continue a test from a previously saved point.
+type progressRestorer interface {
+	RestoreProgress(t time.Duration, iterations int64)
+}
+
+// SnapshotMetric is the serializable state of a single metric and its sink.
+type SnapshotMetric struct {
+	Type     stats.MetricType `json:"type"`
+	Contains stats.ValueType  `json:"contains"`
+	Sink     json.RawMessage  `json:"sink"`
+}
+
+// Snapshot is a serializable representation of the execution state of an Engine. It can be
+// written to disk when a test is terminated and later used to continue the same test from
+// where it left off, e.g. for long soak tests on preemptible infrastructure.
+type Snapshot struct {
+	Time       types.Duration            `json:"time"`
+	Iterations int64                     `json:"iterations"`
+	VUs        int64                     `json:"vus"`
+	VUsMax     int64                     `json:"vusMax"`
+	Metrics    map[string]SnapshotMetric `json:"metrics"`
+}
+
+// ReadSnapshot reads a JSON-encoded snapshot from the supplied reader.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, errors.Wrap(err, "snapshot")
+	}
+	return &snapshot, nil
+}
+
+// Write serializes the snapshot as JSON to the supplied writer.
+func (s *Snapshot) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Snapshot captures the current execution state of the engine.
+func (e *Engine) Snapshot() (*Snapshot, error) {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	snapshot := &Snapshot{
+		Time:       types.Duration(e.Executor.GetTime()),
+		Iterations: e.Executor.GetIterations(),
+		VUs:        e.Executor.GetVUs(),
+		VUsMax:     e.Executor.GetVUsMax(),
+		Metrics:    make(map[string]SnapshotMetric, len(e.Metrics)),
+	}
+	for name, m := range e.Metrics {
+		m.Sink.Calc()
+		data, err := json.Marshal(m.Sink)
+		if err != nil {
+			return nil, errors.Wrapf(err, "metric %s", name)
+		}
+		snapshot.Metrics[name] = SnapshotMetric{Type: m.Type, Contains: m.Contains, Sink: data}
+	}
+	return snapshot, nil
+}
+
+// Restore sets the engine up to continue the test from the supplied snapshot. It has to be
+// called before Run(), since the executor can't change its clock once it has been started.
+func (e *Engine) Restore(snapshot *Snapshot) error {
+	if e.Executor.IsRunning() {
+		return errors.New("can't restore a snapshot while the test is running")
+	}
+	restorer, ok := e.Executor.(progressRestorer)
+	if !ok {
+		return errors.Errorf("the executor (%T) doesn't support restoring snapshots", e.Executor)
+	}
+
+	if err := e.Executor.SetVUsMax(snapshot.VUsMax); err != nil {
+		return err
+	}
+	if err := e.Executor.SetVUs(snapshot.VUs); err != nil {
+		return err
+	}
+	restorer.RestoreProgress(time.Duration(snapshot.Time), snapshot.Iterations)
+
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	for name, sm := range snapshot.Metrics {
+		sink, err := stats.UnmarshalSink(sm.Type, sm.Sink)
+		if err != nil {
+			return errors.Wrapf(err, "metric %s", name)
+		}
+		m := stats.New(name, sm.Type, sm.Contains)
+		m.Sink = sink
+		m.Thresholds = e.thresholds[name]
+		m.Submetrics = e.submetrics[name]
+		e.Metrics[name] = m
+	}
+
+	// Link the restored submetrics to their parents the same way processSamplesForMetrics() does
+	for _, submetrics := range e.submetrics {
+		for _, sm := range submetrics {
+			if m, ok := e.Metrics[sm.Name]; ok {
+				sm.Metric = m
+				sm.Metric.Sub = *sm
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestEngineSnapshotRestore(t *testing.T) {
+	testMetric := stats.New("test_metric", stats.Trend)
+	runner := func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		out <- stats.Sample{Metric: testMetric, Time: time.Now(), Value: 5}
+		return nil
+	}
+	thresholds := map[string]stats.Thresholds{"test_metric{a:1}": {}}
+	opts := lib.Options{
+		VUs:        null.IntFrom(2),
+		VUsMax:     null.IntFrom(2),
+		Iterations: null.IntFrom(10),
+		Thresholds: thresholds,
+	}
+
+	e, err := newTestEngine(LF(runner), opts)
+	require.NoError(t, err)
+	require.NoError(t, e.Run(context.Background()))
+	require.Equal(t, int64(10), e.Executor.GetIterations())
+
+	snapshot, err := e.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), snapshot.Iterations)
+	assert.Equal(t, int64(2), snapshot.VUs)
+	assert.Equal(t, int64(2), snapshot.VUsMax)
+	require.Contains(t, snapshot.Metrics, "test_metric")
+
+	var buf bytes.Buffer
+	require.NoError(t, snapshot.Write(&buf))
+	restoredSnapshot, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, restoredSnapshot)
+
+	opts.Iterations = null.IntFrom(15)
+	e2, err := newTestEngine(LF(runner), opts)
+	require.NoError(t, err)
+	require.NoError(t, e2.Restore(restoredSnapshot))
+	assert.Equal(t, time.Duration(snapshot.Time), e2.Executor.GetTime())
+	assert.Equal(t, int64(10), e2.Executor.GetIterations())
+	require.Contains(t, e2.Metrics, "test_metric")
+	assert.Len(t, e2.Metrics["test_metric"].Submetrics, 1)
+
+	require.NoError(t, e2.Run(context.Background()))
+	assert.Equal(t, int64(15), e2.Executor.GetIterations())
+	sink := e2.Metrics["test_metric"].Sink.(*stats.TrendSink)
+	assert.Equal(t, uint64(15), sink.Count)
+	assert.Equal(t, 5.0, sink.Avg)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ReadSnapshot(bytes.NewBufferString("{"))
+		assert.Error(t, err)
+
+		e, err := newTestEngine(nil, lib.Options{})
+		require.NoError(t, err)
+		err = e.Restore(&Snapshot{Metrics: map[string]SnapshotMetric{
+			"bad": {Type: stats.MetricType(-1), Sink: []byte("{}")},
+		}})
+		assert.Error(t, err)
+	})
+}
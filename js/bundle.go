@@ -23,6 +23,8 @@ package js
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"math/rand"
 	"os"
 
 	"github.com/dop251/goja"
@@ -30,7 +32,11 @@ import (
 	"github.com/loadimpact/k6/js/compiler"
 	jslib "github.com/loadimpact/k6/js/lib"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext/httpext"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/loader"
+	"github.com/loadimpact/k6/stats"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
@@ -46,6 +52,21 @@ type Bundle struct {
 	BaseInitContext *InitContext
 
 	Env map[string]string
+
+	// Secrets are exposed in __ENV together with Env, but they aren't saved in archives.
+	Secrets map[string]string
+
+	// SecretStore resolves the secrets requested with the k6/secrets module.
+	SecretStore *secrets.Store
+
+	// ExecAllow are the commands that setup() and teardown() may run with the k6/exec module.
+	ExecAllow []string
+
+	// ArtifactsDir is the directory that teardown() can write files to with k6/artifacts.
+	ArtifactsDir string
+
+	// Registry has the builtin metrics and the custom ones that the script declares.
+	Registry *stats.Registry
 }
 
 // A BundleInstance is a self-contained instance of a Bundle.
@@ -53,6 +74,10 @@ type BundleInstance struct {
 	Runtime *goja.Runtime
 	Context *context.Context
 	Default goja.Callable
+
+	// Decides which responses are expected ones, see lib.State.ResponseCallback. It can be
+	// changed with http.setResponseCallback(), both in the init context and in iterations.
+	ResponseCallback lib.ResponseCallback
 }
 
 // NewBundle creates a new bundle from a source file and a filesystem.
@@ -83,8 +108,13 @@ func NewBundle(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Bu
 		Program:         pgm,
 		BaseInitContext: NewInitContext(rt, compiler, new(context.Context), cachedFS, loader.Dir(src.Filename)),
 		Env:             rtOpts.Env,
+		Secrets:         rtOpts.Secrets,
+		SecretStore:     secrets.NewStore(rtOpts.SecretSource.String),
+		ExecAllow:       rtOpts.ExecAllow,
+		ArtifactsDir:    rtOpts.ArtifactsDir.String,
+		Registry:        metrics.NewRegistry(),
 	}
-	if err := bundle.instantiate(rt, bundle.BaseInitContext); err != nil {
+	if err := bundle.instantiate(rt, bundle.BaseInitContext, new(lib.ResponseCallback)); err != nil {
 		return nil, err
 	}
 
@@ -165,6 +195,11 @@ func NewBundleFromArchive(arc *lib.Archive, rtOpts lib.RuntimeOptions) (*Bundle,
 		Options:         arc.Options,
 		BaseInitContext: initctx,
 		Env:             env,
+		Secrets:         rtOpts.Secrets,
+		SecretStore:     secrets.NewStore(rtOpts.SecretSource.String),
+		ExecAllow:       rtOpts.ExecAllow,
+		ArtifactsDir:    rtOpts.ArtifactsDir.String,
+		Registry:        metrics.NewRegistry(),
 	}, nil
 }
 
@@ -205,7 +240,8 @@ func (b *Bundle) Instantiate() (bi *BundleInstance, instErr error) {
 	// runtime, but no state, to allow module-provided types to function within the init context.
 	rt := goja.New()
 	init := newBoundInitContext(b.BaseInitContext, ctxPtr, rt)
-	if err := b.instantiate(rt, init); err != nil {
+	responseCallback := lib.ResponseCallback(httpext.DefaultResponseCallback)
+	if err := b.instantiate(rt, init, &responseCallback); err != nil {
 		return nil, err
 	}
 
@@ -231,17 +267,18 @@ func (b *Bundle) Instantiate() (bi *BundleInstance, instErr error) {
 	})
 
 	return &BundleInstance{
-		Runtime: rt,
-		Context: ctxPtr,
-		Default: def,
+		Runtime:          rt,
+		Context:          ctxPtr,
+		Default:          def,
+		ResponseCallback: responseCallback,
 	}, instErr
 }
 
 // Instantiates the bundle into an existing runtime. Not public because it also messes with a bunch
 // of other things, will potentially thrash data and makes a mess in it if the operation fails.
-func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
+func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext, responseCallback *lib.ResponseCallback) error {
 	rt.SetFieldNameMapper(common.FieldNameMapper{})
-	rt.SetRandSource(common.NewRandSource())
+	rt.SetRandSource(b.newRandSource(0))
 
 	if _, err := rt.RunProgram(jslib.GetCoreJS()); err != nil {
 		return err
@@ -253,9 +290,11 @@ func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
 	_ = module.Set("exports", exports)
 	rt.Set("module", module)
 
-	rt.Set("__ENV", b.Env)
+	rt.Set("__ENV", b.runtimeEnv())
 
-	*init.ctxPtr = common.WithRuntime(context.Background(), rt)
+	ctx := secrets.WithStore(common.WithRuntime(context.Background(), rt), b.SecretStore)
+	ctx = lib.WithMetricRegistry(ctx, b.Registry)
+	*init.ctxPtr = lib.WithResponseCallback(ctx, responseCallback)
 	unbindInit := common.BindToGlobal(rt, common.Bind(rt, init, init.ctxPtr))
 	if _, err := rt.RunProgram(b.Program); err != nil {
 		return err
@@ -263,7 +302,56 @@ func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
 	unbindInit()
 	*init.ctxPtr = nil
 
-	rt.SetRandSource(common.NewRandSource())
+	rt.SetRandSource(b.newRandSource(0))
+
+	return nil
+}
+
+// runtimeEnv returns the environment variables for __ENV, with the secrets on top of them.
+func (b *Bundle) runtimeEnv() map[string]string {
+	if len(b.Secrets) == 0 {
+		return b.Env
+	}
+	env := make(map[string]string, len(b.Env)+len(b.Secrets))
+	for k, v := range b.Env {
+		env[k] = v
+	}
+	for k, v := range b.Secrets {
+		env[k] = v
+	}
+	return env
+}
+
+// newRandSource returns the source for Math.random() in a VU. With the seed option,
+// every VU gets a reproducible sequence, which is different for each VU ID.
+func (b *Bundle) newRandSource(vuID int64) goja.RandSource {
+	if b.Options.Seed.Valid {
+		return common.NewSeededRandSource(b.Options.Seed.Int64 + vuID)
+	}
+	return common.NewRandSource()
+}
 
+// chaosSeedSalt separates the sequence of newChaosRandSource from the one of Math.random().
+const chaosSeedSalt = 0x6368616f73
+
+// newChaosRandSource returns the source that picks the requests that faults are injected into in
+// a VU. It's derived from the seed option like newRandSource, but it's a different sequence, so
+// enabling the chaos option doesn't change what Math.random() returns.
+func (b *Bundle) newChaosRandSource(vuID int64) goja.RandSource {
+	if b.Options.Seed.Valid {
+		return common.NewSeededRandSource((b.Options.Seed.Int64 + vuID) ^ chaosSeedSalt)
+	}
+	return common.NewRandSource()
+}
+
+// idsSeedSalt separates the sequence of newIDsRand from the ones of the other random sources.
+const idsSeedSalt = 0x696473
+
+// newIDsRand returns the source of the random bits of the IDs that the k6/ids module generates in
+// a VU, see lib.State.IDsRand. Without the seed option it's nil, so the IDs stay unpredictable.
+func (b *Bundle) newIDsRand(vuID int64) io.Reader {
+	if b.Options.Seed.Valid {
+		return rand.New(rand.NewSource((b.Options.Seed.Int64 + vuID) ^ idsSeedSalt))
+	}
 	return nil
 }
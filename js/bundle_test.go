@@ -592,6 +592,50 @@ func TestBundleInstantiate(t *testing.T) {
 	})
 }
 
+func TestBundleSecrets(t *testing.T) {
+	require.NoError(t, os.Setenv("K6_TEST_BUNDLE_SECRET", "hunter2"))
+	defer func() { _ = os.Unsetenv("K6_TEST_BUNDLE_SECRET") }()
+	rtOpts := lib.RuntimeOptions{
+		Env:          map[string]string{"TEST_A": "1", "TEST_SECRET": "overridden"},
+		Secrets:      map[string]string{"TEST_SECRET": "s3cr3t"},
+		SecretSource: null.StringFrom("env"),
+	}
+
+	b1, err := NewBundle(
+		&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import secrets from "k6/secrets";
+				let initSecret = secrets.get("K6_TEST_BUNDLE_SECRET");
+				export default function() {
+					if (__ENV.TEST_A !== "1") { throw new Error("Invalid TEST_A: " + __ENV.TEST_A); }
+					if (__ENV.TEST_SECRET !== "s3cr3t") { throw new Error("Invalid TEST_SECRET: " + __ENV.TEST_SECRET); }
+					if (initSecret !== "hunter2") { throw new Error("Invalid init secret: " + initSecret); }
+				}
+			`),
+		},
+		afero.NewMemMapFs(), rtOpts,
+	)
+	require.NoError(t, err)
+
+	arc := b1.makeArchive()
+	assert.Equal(t, map[string]string{"TEST_A": "1", "TEST_SECRET": "overridden"}, arc.Env)
+
+	b2, err := NewBundleFromArchive(arc, lib.RuntimeOptions{Secrets: rtOpts.Secrets, SecretSource: rtOpts.SecretSource})
+	require.NoError(t, err)
+
+	bundles := map[string]*Bundle{"Source": b1, "Archive": b2}
+	for name, b := range bundles {
+		t.Run(name, func(t *testing.T) {
+			bi, err := b.Instantiate()
+			if assert.NoError(t, err) {
+				_, err := bi.Default(goja.Undefined())
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestBundleEnv(t *testing.T) {
 	rtOpts := lib.RuntimeOptions{Env: map[string]string{
 		"TEST_A": "1",
@@ -49,6 +49,10 @@ var (
 //nolint: gochecknoglobals
 var fieldNameExceptions = map[string]string{
 	"OCSP": "ocsp",
+
+	"UUIDv4": "uuidv4",
+	"UUIDv7": "uuidv7",
+	"ULID":   "ulid",
 }
 
 // FieldName Returns the JS name for an exported struct field. The name is snake_cased, with respect for
@@ -84,6 +88,10 @@ var methodNameExceptions = map[string]string{
 	"HTML": "html",
 	"URL":  "url",
 	"OCSP": "ocsp",
+
+	"UUIDv4": "uuidv4",
+	"UUIDv7": "uuidv7",
+	"ULID":   "ulid",
 }
 
 // MethodName Returns the JS name for an exported method. The first letter of the method's name is
@@ -40,3 +40,9 @@ func NewRandSource() goja.RandSource {
 	}
 	return rand.New(rand.NewSource(seed)).Float64
 }
+
+// NewSeededRandSource returns a RandSource with a fixed seed, so it always
+// produces the same sequence. It's NOT safe for concurrent use either.
+func NewSeededRandSource(seed int64) goja.RandSource {
+	return rand.New(rand.NewSource(seed)).Float64
+}
@@ -0,0 +1,75 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"github.com/dop251/goja"
+)
+
+// ParseTags reads the tags from a JS object into tags. Arrays are multi-value tags, e.g. the
+// feature flags that were active during a request, and are returned separately; all other
+// values are converted to strings.
+func ParseTags(rt *goja.Runtime, v goja.Value, tags map[string]string) (multi map[string][]string) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	obj := v.ToObject(rt)
+	if obj == nil {
+		return nil
+	}
+	for _, key := range obj.Keys() {
+		val := obj.Get(key)
+		items, ok := val.Export().([]interface{})
+		if !ok {
+			tags[key] = val.String()
+			delete(multi, key)
+			continue
+		}
+
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i] = rt.ToValue(item).String()
+		}
+		if multi == nil {
+			multi = make(map[string][]string)
+		}
+		multi[key] = values
+		delete(tags, key)
+	}
+	return multi
+}
+
+// ParseMetadata reads the sample metadata from a JS object, with all values converted to strings.
+// Nil is returned for null, undefined and empty objects.
+func ParseMetadata(rt *goja.Runtime, v goja.Value) map[string]string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	obj := v.ToObject(rt)
+	if obj == nil || len(obj.Keys()) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(obj.Keys()))
+	for _, key := range obj.Keys() {
+		metadata[key] = obj.Get(key).String()
+	}
+	return metadata
+}
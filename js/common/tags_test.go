@@ -0,0 +1,60 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	rt := goja.New()
+	for _, literal := range []string{`null`, `undefined`} {
+		v, err := RunString(rt, literal)
+		require.NoError(t, err)
+		tags := map[string]string{}
+		assert.Nil(t, ParseTags(rt, v, tags))
+		assert.Empty(t, tags)
+	}
+
+	v, err := RunString(rt, `({ tag: "value", num: 1, flags: ["a", 2, true], replaced: ["x"] })`)
+	require.NoError(t, err)
+	tags := map[string]string{"flags": "old", "other": "kept"}
+	multi := ParseTags(rt, v, tags)
+	assert.Equal(t, map[string]string{"tag": "value", "num": "1", "other": "kept"}, tags)
+	assert.Equal(t, map[string][]string{"flags": {"a", "2", "true"}, "replaced": {"x"}}, multi)
+}
+
+func TestParseMetadata(t *testing.T) {
+	rt := goja.New()
+	for _, literal := range []string{`null`, `undefined`, `({})`} {
+		v, err := RunString(rt, literal)
+		require.NoError(t, err)
+		assert.Nil(t, ParseMetadata(rt, v), literal)
+	}
+
+	v, err := RunString(rt, `({ trace_id: "abc", num: 1, list: ["a", 2] })`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"trace_id": "abc", "num": "1", "list": "a,2"}, ParseMetadata(rt, v))
+}
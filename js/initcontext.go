@@ -24,6 +24,7 @@ import (
 	"context"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
@@ -53,9 +54,11 @@ type InitContext struct {
 	fs  afero.Fs
 	pwd string
 
-	// Cache of loaded programs and files.
-	programs map[string]programWithSource
-	files    map[string][]byte
+	// Cache of loaded programs and files. The files are shared between all of the bound init
+	// contexts, which can be running concurrently, so access to them is guarded by filesLock.
+	programs  map[string]programWithSource
+	files     map[string][]byte
+	filesLock *sync.Mutex
 }
 
 // NewInitContext creates a new initcontext with the provided arguments
@@ -69,8 +72,9 @@ func NewInitContext(
 		fs:       fs,
 		pwd:      filepath.ToSlash(pwd),
 
-		programs: make(map[string]programWithSource),
-		files:    make(map[string][]byte),
+		programs:  make(map[string]programWithSource),
+		files:     make(map[string][]byte),
+		filesLock: &sync.Mutex{},
 	}
 }
 
@@ -93,8 +97,9 @@ func newBoundInitContext(base *InitContext, ctxPtr *context.Context, rt *goja.Ru
 		pwd:      base.pwd,
 		compiler: base.compiler,
 
-		programs: programs,
-		files:    base.files,
+		programs:  programs,
+		files:     base.files,
+		filesLock: base.filesLock,
 	}
 }
 
@@ -195,7 +200,9 @@ func (i *InitContext) Open(filename string, args ...string) (goja.Value, error)
 	}
 	filename = filepath.ToSlash(filename)
 
+	i.filesLock.Lock()
 	data, ok := i.files[filename]
+	i.filesLock.Unlock()
 	if !ok {
 		var (
 			err   error
@@ -212,7 +219,9 @@ func (i *InitContext) Open(filename string, args ...string) (goja.Value, error)
 		if err != nil {
 			return nil, err
 		}
+		i.filesLock.Lock()
 		i.files[filename] = data
+		i.filesLock.Unlock()
 	}
 
 	if len(args) > 0 && args[0] == "b" {
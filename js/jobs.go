@@ -0,0 +1,174 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// vuJob is a background job of the jobs option, as it's scheduled in a VU.
+type vuJob struct {
+	name   string
+	config lib.JobConfig
+	fn     goja.Callable
+	next   time.Time // Only used for jobs with the VU scope
+}
+
+// loadJobs resolves the exec functions of the background jobs, sorted by name, so the ones that
+// are due at the same time always run in the same order.
+func (u *VU) loadJobs() error {
+	u.jobsLoaded = true
+	names := make([]string, 0, len(u.Runner.Bundle.Options.Jobs))
+	for name := range u.Runner.Bundle.Options.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exports := u.Runtime.Get("exports").ToObject(u.Runtime)
+	for _, name := range names {
+		config := u.Runner.Bundle.Options.Jobs[name]
+		fn, ok := goja.AssertFunction(exports.Get(config.GetExec(name)))
+		if !ok {
+			return errors.Errorf("the exec function '%s' of the job '%s' isn't exported", config.GetExec(name), name)
+		}
+		u.jobs = append(u.jobs, &vuJob{name: name, config: config, fn: fn})
+	}
+	return nil
+}
+
+// claim returns whether the job is due at now, and if it is, schedules its next run. Jobs with
+// the test scope are scheduled in the runner, so only one VU runs them per interval.
+func (u *VU) claim(job *vuJob, now time.Time) bool {
+	if job.config.GetScope() != lib.JobScopeTest {
+		if now.Before(job.next) {
+			return false
+		}
+		job.next = now.Add(job.config.GetInterval())
+		return true
+	}
+
+	r := u.Runner
+	r.testJobsMu.Lock()
+	defer r.testJobsMu.Unlock()
+	if now.Before(r.testJobs[job.name]) {
+		return false
+	}
+	if r.testJobs == nil {
+		r.testJobs = make(map[string]time.Time)
+	}
+	r.testJobs[job.name] = now.Add(job.config.GetInterval())
+	return true
+}
+
+// nextJob returns when the next background job of the VU is due.
+func (u *VU) nextJob() time.Time {
+	var next time.Time
+	for _, job := range u.jobs {
+		due := job.next
+		if job.config.GetScope() == lib.JobScopeTest {
+			u.Runner.testJobsMu.Lock()
+			due = u.Runner.testJobs[job.name]
+			u.Runner.testJobsMu.Unlock()
+		}
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// runDueJobs runs the background jobs that are due. Errors of the jobs themselves are logged, so
+// a failing job doesn't fail the iteration; only an interruption by ctx is returned.
+func (u *VU) runDueJobs(ctx context.Context) error {
+	for _, job := range u.jobs {
+		if ctx.Err() != nil {
+			return errInterrupt
+		}
+		if !u.claim(job, time.Now()) {
+			continue
+		}
+		if err := u.runJob(ctx, job); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			u.Runner.Logger.WithError(err).WithField("job", job.name).Warn("Background job failed")
+		}
+	}
+	return nil
+}
+
+// runJob runs a background job with its own state, so the samples it emits are tagged with the
+// job and its tags, and restores the context of the iteration afterwards. The job uses the
+// cookies of the VU, not the ones of the iteration.
+func (u *VU) runJob(ctx context.Context, job *vuJob) error {
+	state := u.newState(ctx, u.Runner.defaultGroup, u.CookieJar)
+	if state.Tags == nil {
+		state.Tags = make(map[string]string, len(job.config.Tags)+1)
+	}
+	for k, v := range job.config.Tags {
+		state.Tags[k] = v
+	}
+	if state.Options.SystemTags["job"] {
+		state.Tags["job"] = job.name
+	}
+
+	iterationCtx := *u.Context
+	*u.Context = u.newContext(ctx, state)
+	defer func() { *u.Context = iterationCtx }()
+
+	_, err := job.fn(goja.Undefined())
+	return err
+}
+
+// sleepWithJobs is sleep() for VUs with background jobs: the jobs that are due while it sleeps
+// are run in between.
+func (u *VU) sleepWithJobs(ctx context.Context, d time.Duration) {
+	end := time.Now().Add(d)
+	for {
+		if err := u.runDueJobs(ctx); err != nil {
+			// The interruption was consumed by the job, the iteration has to be interrupted too.
+			u.Runtime.Interrupt(errInterrupt)
+			return
+		}
+
+		wait := time.Until(end)
+		if next := time.Until(u.nextJob()); next < wait {
+			wait = next
+		}
+		if wait <= 0 && !time.Now().Before(end) {
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
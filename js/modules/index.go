@@ -22,21 +22,41 @@ package modules
 
 import (
 	"github.com/loadimpact/k6/js/modules/k6"
+	"github.com/loadimpact/k6/js/modules/k6/artifacts"
+	"github.com/loadimpact/k6/js/modules/k6/avro"
+	"github.com/loadimpact/k6/js/modules/k6/circuitbreaker"
 	"github.com/loadimpact/k6/js/modules/k6/crypto"
+	"github.com/loadimpact/k6/js/modules/k6/date"
 	"github.com/loadimpact/k6/js/modules/k6/encoding"
+	"github.com/loadimpact/k6/js/modules/k6/exec"
 	"github.com/loadimpact/k6/js/modules/k6/html"
 	"github.com/loadimpact/k6/js/modules/k6/http"
+	"github.com/loadimpact/k6/js/modules/k6/ids"
 	"github.com/loadimpact/k6/js/modules/k6/metrics"
+	"github.com/loadimpact/k6/js/modules/k6/protobuf"
+	"github.com/loadimpact/k6/js/modules/k6/secrets"
+	"github.com/loadimpact/k6/js/modules/k6/signalr"
+	"github.com/loadimpact/k6/js/modules/k6/stomp"
 	"github.com/loadimpact/k6/js/modules/k6/ws"
 )
 
 // Index of module implementations.
 var Index = map[string]interface{}{
-	"k6":          k6.New(),
-	"k6/crypto":   crypto.New(),
-	"k6/encoding": encoding.New(),
-	"k6/http":     http.New(),
-	"k6/metrics":  metrics.New(),
-	"k6/html":     html.New(),
-	"k6/ws":       ws.New(),
+	"k6":                k6.New(),
+	"k6/artifacts":      artifacts.New(),
+	"k6/avro":           avro.New(),
+	"k6/circuitbreaker": circuitbreaker.New(),
+	"k6/crypto":         crypto.New(),
+	"k6/date":           date.New(),
+	"k6/encoding":       encoding.New(),
+	"k6/exec":           exec.New(),
+	"k6/http":           http.New(),
+	"k6/ids":            ids.New(),
+	"k6/metrics":        metrics.New(),
+	"k6/html":           html.New(),
+	"k6/protobuf":       protobuf.New(),
+	"k6/secrets":        secrets.New(),
+	"k6/signalr":        signalr.New(),
+	"k6/stomp":          stomp.New(),
+	"k6/ws":             ws.New(),
 }
@@ -0,0 +1,103 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package artifacts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// ErrWriteOutsideTeardown is returned when a file is written outside of teardown().
+var ErrWriteOutsideTeardown = errors.New("artifacts can only be written in teardown()")
+
+// Artifacts is the k6/artifacts module, which lets teardown() write result files, like a CSV of
+// the failed transactions, to the directory given with the --artifacts-dir flag.
+type Artifacts struct{}
+
+// New returns a new k6/artifacts module.
+func New() *Artifacts {
+	return &Artifacts{}
+}
+
+// Write writes data, a string or an array of bytes, to the file with the given name in the
+// artifacts directory, replacing it if it exists. It returns the path of the written file.
+func (*Artifacts) Write(ctx context.Context, name string, data interface{}) (string, error) {
+	return writeFile(ctx, name, data, os.O_TRUNC)
+}
+
+// Append is like Write, but adds data to the end of the file instead of replacing it.
+func (*Artifacts) Append(ctx context.Context, name string, data interface{}) (string, error) {
+	return writeFile(ctx, name, data, os.O_APPEND)
+}
+
+func writeFile(ctx context.Context, name string, data interface{}, flag int) (string, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return "", ErrWriteOutsideTeardown
+	}
+	if state.Stage != lib.StageTeardown {
+		return "", ErrWriteOutsideTeardown
+	}
+	if state.ArtifactsDir == "" {
+		return "", errors.New("no artifacts directory is configured, use the --artifacts-dir flag")
+	}
+
+	var b []byte
+	switch v := data.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case []interface{}:
+		b = make([]byte, len(v))
+		for i, x := range v {
+			n, ok := x.(int64)
+			if !ok || n < 0 || n > 255 {
+				return "", errors.Errorf("invalid byte at index %d of the '%s' artifact", i, name)
+			}
+			b[i] = byte(n)
+		}
+	default:
+		return "", errors.Errorf("unsupported data type %T for the '%s' artifact", data, name)
+	}
+
+	// Cleaning the name as an absolute path removes any "..", so that it can't escape the directory.
+	path := filepath.Join(state.ArtifactsDir, filepath.Clean(string(filepath.Separator)+name))
+	if path == filepath.Clean(state.ArtifactsDir) {
+		return "", errors.Errorf("invalid artifact name '%s'", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
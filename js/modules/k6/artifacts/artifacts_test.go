@@ -0,0 +1,107 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package artifacts
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k6-artifacts")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	teardown, err := root.Group("teardown")
+	require.NoError(t, err)
+	state := &lib.State{Group: teardown, Stage: lib.StageTeardown, ArtifactsDir: dir}
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("artifacts", common.Bind(rt, New(), &ctx))
+
+	t.Run("NoState", func(t *testing.T) {
+		_, err := common.RunString(rt, `artifacts.write("a.txt", "a")`)
+		assert.Contains(t, err.Error(), ErrWriteOutsideTeardown.Error())
+	})
+
+	ctx = lib.WithState(ctx, state)
+	t.Run("Write", func(t *testing.T) {
+		v, err := common.RunString(rt, `
+		artifacts.write("failed.csv", "old");
+		artifacts.write("failed.csv", "id,status\n");
+		artifacts.append("failed.csv", "1,500\n");
+		artifacts.write("sub/dir/bin", [0, 1, 255]);
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "sub", "dir", "bin"), v.Export())
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "failed.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, "id,status\n1,500\n", string(data))
+		data, err = ioutil.ReadFile(filepath.Join(dir, "sub", "dir", "bin"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 1, 255}, data)
+	})
+	t.Run("Escape", func(t *testing.T) {
+		v, err := common.RunString(rt, `artifacts.write("../../escaped.txt", "a")`)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "escaped.txt"), v.Export())
+
+		_, err = common.RunString(rt, `artifacts.write("..", "a")`)
+		assert.Contains(t, err.Error(), "invalid artifact name '..'")
+	})
+	t.Run("InvalidData", func(t *testing.T) {
+		_, err := common.RunString(rt, `artifacts.write("a.bin", [256])`)
+		assert.Contains(t, err.Error(), "invalid byte at index 0")
+		_, err = common.RunString(rt, `artifacts.write("a.bin", {})`)
+		assert.Contains(t, err.Error(), "unsupported data type")
+	})
+	t.Run("NoDir", func(t *testing.T) {
+		state.ArtifactsDir = ""
+		defer func() { state.ArtifactsDir = dir }()
+		_, err := common.RunString(rt, `artifacts.write("a.txt", "a")`)
+		assert.Contains(t, err.Error(), "use the --artifacts-dir flag")
+	})
+	t.Run("Setup", func(t *testing.T) {
+		state.Stage = lib.StageSetup
+		_, err := common.RunString(rt, `artifacts.write("a.txt", "a")`)
+		assert.Contains(t, err.Error(), ErrWriteOutsideTeardown.Error())
+	})
+	t.Run("Default", func(t *testing.T) {
+		// A group named like teardown() in an iteration doesn't count.
+		state.Stage = ""
+		_, err := common.RunString(rt, `artifacts.write("a.txt", "a")`)
+		assert.Contains(t, err.Error(), ErrWriteOutsideTeardown.Error())
+	})
+}
@@ -0,0 +1,42 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package avro
+
+import "context"
+
+// Avro encodes and decodes values in the Avro binary format, either with a
+// given schema, or with schemas from a Confluent-compatible schema registry.
+type Avro struct{}
+
+func New() *Avro {
+	return &Avro{}
+}
+
+// Parse parses a schema from its JSON representation.
+func (*Avro) Parse(schema string) (*Schema, error) {
+	return ParseSchema(schema)
+}
+
+// XRegistry creates a schema registry client. It can be created in the init
+// context, but schemas are only fetched once they're used by a VU.
+func (*Avro) XRegistry(ctx *context.Context, url string) (*Registry, error) {
+	return newRegistry(ctx, url)
+}
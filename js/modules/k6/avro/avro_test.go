@@ -0,0 +1,180 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package avro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+	"type": "record", "name": "User", "namespace": "com.example",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "name", "type": "string"},
+		{"name": "email", "type": ["null", "string"], "default": null},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "scores", "type": {"type": "map", "values": "int"}},
+		{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "BANNED"]}},
+		{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 2}},
+		{"name": "ratio", "type": "double", "default": 0.5},
+		{"name": "friend", "type": ["null", "User"], "default": null}
+	]
+}`
+
+func TestSchema(t *testing.T) {
+	t.Run("Primitives", func(t *testing.T) {
+		testdata := []struct {
+			schema string
+			value  interface{}
+			data   []byte
+		}{
+			{`"null"`, nil, []byte{}},
+			{`"boolean"`, true, []byte{1}},
+			{`"long"`, int64(0), []byte{0}},
+			{`"long"`, int64(-1), []byte{1}},
+			{`"long"`, int64(1), []byte{2}},
+			{`"long"`, int64(-64), []byte{0x7f}},
+			{`"long"`, int64(64), []byte{0x80, 0x01}},
+			{`{"type": "int", "logicalType": "date"}`, int64(2), []byte{4}},
+			{`"string"`, "foo", []byte{6, 'f', 'o', 'o'}},
+			{`"bytes"`, []byte{0xff}, []byte{2, 0xff}},
+			{`"float"`, 1.0, []byte{0, 0, 0x80, 0x3f}},
+			{`"double"`, 1.0, []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+			{`["null", "string"]`, "a", []byte{2, 2, 'a'}},
+			{`["null", "string"]`, nil, []byte{0}},
+		}
+		for _, data := range testdata {
+			schema, err := ParseSchema(data.schema)
+			require.NoError(t, err, data.schema)
+			encoded, err := schema.Encode(data.value)
+			require.NoError(t, err, data.schema)
+			assert.Equal(t, data.data, encoded, data.schema)
+			decoded, err := schema.Decode(encoded)
+			require.NoError(t, err, data.schema)
+			assert.Equal(t, data.value, decoded, data.schema)
+		}
+	})
+
+	t.Run("Record", func(t *testing.T) {
+		schema, err := ParseSchema(testSchema)
+		require.NoError(t, err)
+		data, err := schema.Encode(map[string]interface{}{
+			"id":     int64(1),
+			"name":   "ann",
+			"tags":   []interface{}{"a"},
+			"scores": map[string]interface{}{"x": int64(3)},
+			"status": "BANNED",
+			"hash":   []interface{}{int64(1), int64(2)},
+			"friend": map[string]interface{}{"com.example.User": map[string]interface{}{
+				"id": "2", "name": "bob", "email": "bob@example.com",
+				"tags": []interface{}{}, "scores": map[string]interface{}{}, "status": "ACTIVE", "hash": "ab",
+			}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{
+			2, 6, 'a', 'n', 'n', 0, 2, 2, 'a', 0, 2, 2, 'x', 6, 0, 2, 1, 2, 0, 0, 0, 0, 0, 0, 0xe0, 0x3f,
+			2, 4, 6, 'b', 'o', 'b', 2, 30, 'b', 'o', 'b', '@', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+			0, 0, 0, 'a', 'b', 0, 0, 0, 0, 0, 0, 0xe0, 0x3f, 0,
+		}, data)
+
+		decoded, err := schema.Decode(data)
+		require.NoError(t, err)
+		friend := decoded.(map[string]interface{})["friend"].(map[string]interface{})
+		assert.Equal(t, "bob@example.com", friend["email"])
+		assert.Equal(t, int64(2), friend["id"])
+		assert.Equal(t, []interface{}{"a"}, decoded.(map[string]interface{})["tags"])
+		assert.Equal(t, map[string]interface{}{"x": int64(3)}, decoded.(map[string]interface{})["scores"])
+		assert.Equal(t, "BANNED", decoded.(map[string]interface{})["status"])
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := ParseSchema(`"Missing"`)
+		assert.EqualError(t, err, "unknown Avro type 'Missing'")
+		schema, err := ParseSchema(testSchema)
+		require.NoError(t, err)
+		_, err = schema.Encode(map[string]interface{}{"id": int64(1)})
+		assert.EqualError(t, err, "com.example.User.name: missing value for a field without a default")
+		_, err = schema.Encode(map[string]interface{}{"id": 1.5})
+		assert.EqualError(t, err, "com.example.User.id: expected an integer, got 1.5")
+		_, err = schema.Decode([]byte{2, 8, 'a'})
+		assert.EqualError(t, err, "com.example.User.name: truncated Avro data")
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		switch r.URL.Path {
+		case "/subjects/users-value/versions/latest":
+			_, _ = w.Write([]byte(`{"subject": "users-value", "version": 3, "id": 7, "schema": "\"string\""}`))
+		case "/schemas/ids/8":
+			_, _ = w.Write([]byte(`{"schema": "\"long\""}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code": 40401, "message": "Subject not found."}`))
+		}
+	}))
+	defer srv.Close()
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("avro", common.Bind(rt, New(), &ctx))
+	rt.Set("url", srv.URL)
+
+	_, err := common.RunString(rt, `const registry = new avro.Registry(url);`)
+	require.NoError(t, err)
+	_, err = common.RunString(rt, `registry.encode("users-value", "hi")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrRegistryInInitContext.Error())
+
+	ctx = lib.WithState(ctx, &lib.State{Transport: http.DefaultTransport})
+	_, err = common.RunString(rt, `
+	for (let i = 0; i < 3; i++) {
+		let data = registry.encode("users-value", "hi");
+		if (data.length !== 8 || data[4] !== 7 || registry.decode(data) !== "hi") {
+			throw new Error("unexpected data: " + data);
+		}
+	}
+	if (registry.decode([0, 0, 0, 0, 8, 2]) !== 1) {
+		throw new Error("unexpected decoded value");
+	}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+
+	_, err = common.RunString(rt, `registry.encode("other", "hi")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "returned 404 Not Found for /subjects/other/versions/latest: Subject not found.")
+	_, err = common.RunString(rt, `registry.decode([1, 2])`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "data isn't in the schema registry wire format")
+}
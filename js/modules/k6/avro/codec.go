@@ -0,0 +1,460 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Encode serializes a value, as exported from JS, in the Avro binary format.
+func (s *Schema) Encode(value interface{}) ([]byte, error) {
+	return encode(make([]byte, 0, 64), s.root, value)
+}
+
+// Decode deserializes a value in the Avro binary format. Union values are
+// returned as the plain value of whichever branch was encoded.
+func (s *Schema) Decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.decode(s.root)
+	if err == nil && len(d.data) > 0 {
+		err = errors.Errorf("%d unexpected trailing bytes", len(d.data))
+	}
+	return v, err
+}
+
+func encodeLong(buf []byte, i int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], i)]...)
+}
+
+func encodeBytes(buf []byte, b []byte) []byte {
+	return append(encodeLong(buf, int64(len(b))), b...)
+}
+
+//nolint:gocyclo
+func encode(buf []byte, t *avroType, v interface{}) ([]byte, error) {
+	switch t.kind {
+	case "null":
+		if v != nil {
+			return nil, errors.Errorf("expected null, got %T", v)
+		}
+		return buf, nil
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.Errorf("expected a boolean, got %T", v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case "int", "long":
+		i, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return nil, errors.Errorf("%d overflows an int", i)
+		}
+		return encodeLong(buf, i), nil
+	case "float":
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		var tmp [4]byte
+		binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(float32(f)))
+		return append(buf, tmp[:]...), nil
+	case "double":
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+		return append(buf, tmp[:]...), nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("expected a string, got %T", v)
+		}
+		return encodeBytes(buf, []byte(s)), nil
+	case "bytes":
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return encodeBytes(buf, b), nil
+	case "fixed":
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != t.size {
+			return nil, errors.Errorf("expected %d bytes for %s, got %d", t.size, t.name, len(b))
+		}
+		return append(buf, b...), nil
+	case "enum":
+		s, _ := v.(string)
+		for i, sym := range t.symbols {
+			if sym == s {
+				return encodeLong(buf, int64(i)), nil
+			}
+		}
+		return nil, errors.Errorf("unknown %s symbol %v", t.name, v)
+	case "record":
+		return encodeRecord(buf, t, v)
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.Errorf("expected an array, got %T", v)
+		}
+		if len(items) > 0 {
+			buf = encodeLong(buf, int64(len(items)))
+		}
+		var err error
+		for i, item := range items {
+			if buf, err = encode(buf, t.items, item); err != nil {
+				return nil, errors.Wrapf(err, "index %d", i)
+			}
+		}
+		return encodeLong(buf, 0), nil
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("expected an object, got %T", v)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			buf = encodeLong(buf, int64(len(keys)))
+		}
+		var err error
+		for _, k := range keys {
+			buf = encodeBytes(buf, []byte(k))
+			if buf, err = encode(buf, t.values, m[k]); err != nil {
+				return nil, errors.Wrapf(err, "key %q", k)
+			}
+		}
+		return encodeLong(buf, 0), nil
+	case "union":
+		i, branchValue, err := pickBranch(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return encode(encodeLong(buf, int64(i)), t.branches[i], branchValue)
+	default:
+		return nil, errors.Errorf("unsupported Avro type %s", t.kind)
+	}
+}
+
+func encodeRecord(buf []byte, t *avroType, v interface{}) ([]byte, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("expected an object for %s, got %T", t.name, v)
+	}
+	var err error
+	for _, f := range t.fields {
+		value, ok := obj[f.name]
+		typ := f.typ
+		if !ok {
+			if !f.hasDefault {
+				return nil, errors.Errorf("%s.%s: missing value for a field without a default", t.name, f.name)
+			}
+			// The default value of a union field is always of its first branch
+			value = f.def
+			if typ.kind == "union" {
+				buf, typ = encodeLong(buf, 0), typ.branches[0]
+			}
+		}
+		if buf, err = encode(buf, typ, value); err != nil {
+			return nil, errors.Wrapf(err, "%s.%s", t.name, f.name)
+		}
+	}
+	return buf, nil
+}
+
+// pickBranch finds the union branch for a value. Values can be explicitly
+// wrapped as {"branchName": value}, like in Avro's JSON encoding, otherwise
+// the first branch whose type matches the JS value's type is used.
+func pickBranch(t *avroType, v interface{}) (int, interface{}, error) {
+	if obj, ok := v.(map[string]interface{}); ok && len(obj) == 1 {
+		for i, b := range t.branches {
+			name := b.kind
+			if b.name != "" {
+				name = b.name
+			}
+			if inner, ok := obj[name]; ok {
+				return i, inner, nil
+			}
+		}
+	}
+	for i, b := range t.branches {
+		if matches(b, v) {
+			return i, v, nil
+		}
+	}
+	return 0, nil, errors.Errorf("value of type %T doesn't match any union branch", v)
+}
+
+func matches(t *avroType, v interface{}) bool {
+	switch v.(type) {
+	case nil:
+		return t.kind == "null"
+	case bool:
+		return t.kind == "boolean"
+	case int64, int, json.Number:
+		return t.kind == "int" || t.kind == "long" || t.kind == "float" || t.kind == "double"
+	case float64:
+		return t.kind == "float" || t.kind == "double"
+	case string:
+		return t.kind == "string" || (t.kind == "enum" && t.hasSymbol(v.(string)))
+	case []byte:
+		return t.kind == "bytes" || (t.kind == "fixed" && len(v.([]byte)) == t.size)
+	case []interface{}:
+		return t.kind == "array"
+	case map[string]interface{}:
+		return t.kind == "record" || t.kind == "map"
+	default:
+		return false
+	}
+}
+
+func (t *avroType) hasSymbol(s string) bool {
+	for _, sym := range t.symbols {
+		if sym == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, errors.Errorf("expected an integer, got %v", n)
+		}
+		return int64(n), nil
+	case json.Number:
+		return n.Int64()
+	case string:
+		// JS numbers can't represent every long
+		i, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("expected an integer, got %q", n)
+		}
+		return i, nil
+	default:
+		return 0, errors.Errorf("expected an integer, got %T", v)
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case json.Number:
+		return n.Float64()
+	default:
+		return 0, errors.Errorf("expected a number, got %T", v)
+	}
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	case []interface{}:
+		out := make([]byte, len(b))
+		for i, item := range b {
+			n, err := toInt(item)
+			if err != nil || n < 0 || n > 255 {
+				return nil, errors.Errorf("index %d: expected a byte, got %v", i, item)
+			}
+			out[i] = byte(n)
+		}
+		return out, nil
+	default:
+		return nil, errors.Errorf("expected bytes, got %T", v)
+	}
+}
+
+type decoder struct {
+	data []byte
+}
+
+var errTruncated = errors.New("truncated Avro data")
+
+func (d *decoder) long() (int64, error) {
+	i, n := binary.Varint(d.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.data = d.data[n:]
+	return i, nil
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n < 0 || len(d.data) < n {
+		return nil, errTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+func (d *decoder) blob() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	return d.bytes(int(n))
+}
+
+// blockCount reads the item count of the next array or map block.
+func (d *decoder) blockCount() (int64, error) {
+	n, err := d.long()
+	if err != nil || n >= 0 {
+		return n, err
+	}
+	// A negative count is followed by the block's size in bytes
+	_, err = d.long()
+	return -n, err
+}
+
+//nolint:gocyclo
+func (d *decoder) decode(t *avroType) (interface{}, error) {
+	switch t.kind {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := d.bytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		return d.long()
+	case "float":
+		b, err := d.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := d.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "string":
+		b, err := d.blob()
+		return string(b), err
+	case "bytes":
+		b, err := d.blob()
+		return append([]byte{}, b...), err
+	case "fixed":
+		b, err := d.bytes(t.size)
+		return append([]byte{}, b...), err
+	case "enum":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(t.symbols)) {
+			return nil, errors.Errorf("invalid %s symbol index %d", t.name, i)
+		}
+		return t.symbols[i], nil
+	case "record":
+		obj := make(map[string]interface{}, len(t.fields))
+		for _, f := range t.fields {
+			v, err := d.decode(f.typ)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s.%s", t.name, f.name)
+			}
+			obj[f.name] = v
+		}
+		return obj, nil
+	case "array":
+		items := []interface{}{}
+		for {
+			n, err := d.blockCount()
+			if err != nil || n == 0 {
+				return items, err
+			}
+			for ; n > 0; n-- {
+				item, err := d.decode(t.items)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+		}
+	case "map":
+		m := map[string]interface{}{}
+		for {
+			n, err := d.blockCount()
+			if err != nil || n == 0 {
+				return m, err
+			}
+			for ; n > 0; n-- {
+				k, err := d.blob()
+				if err != nil {
+					return nil, err
+				}
+				if m[string(k)], err = d.decode(t.values); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case "union":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(t.branches)) {
+			return nil, errors.Errorf("invalid union branch index %d", i)
+		}
+		return d.decode(t.branches[i])
+	default:
+		return nil, errors.Errorf("unsupported Avro type %s", t.kind)
+	}
+}
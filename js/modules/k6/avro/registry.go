@@ -0,0 +1,176 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package avro
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// ErrRegistryInInitContext is returned when schemas are fetched in the init context.
+var ErrRegistryInInitContext = common.NewInitContextError("Fetching schemas from a registry in the init context is not supported")
+
+// The first byte of the Confluent wire format, followed by the big-endian
+// 32-bit schema ID and the Avro payload.
+const wireFormatMagic = 0
+
+// A Registry encodes and decodes values in the Confluent wire format, using
+// schemas fetched from a schema registry. Schemas are fetched once per VU,
+// on first use, and cached for the rest of the test.
+type Registry struct {
+	ctx *context.Context
+	url string
+
+	mutex     sync.Mutex
+	byID      map[int32]*Schema
+	bySubject map[string]int32
+}
+
+type registeredSchema struct {
+	ID     int32  `json:"id"`
+	Schema string `json:"schema"`
+}
+
+func newRegistry(ctxPtr *context.Context, registryURL string) (*Registry, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("invalid schema registry URL '%s'", registryURL)
+	}
+	return &Registry{
+		ctx:       ctxPtr,
+		url:       strings.TrimSuffix(registryURL, "/"),
+		byID:      make(map[int32]*Schema),
+		bySubject: make(map[string]int32),
+	}, nil
+}
+
+// Encode encodes a value with the latest schema version of the subject.
+func (r *Registry) Encode(subject string, value interface{}) ([]byte, error) {
+	id, schema, err := r.latest(subject)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 5, 64)
+	buf[0] = wireFormatMagic
+	binary.BigEndian.PutUint32(buf[1:], uint32(id))
+	return encode(buf, schema.root, value)
+}
+
+// Decode decodes a value with the schema whose ID it's framed with.
+func (r *Registry) Decode(data []byte) (interface{}, error) {
+	if len(data) < 5 || data[0] != wireFormatMagic {
+		return nil, errors.New("data isn't in the schema registry wire format")
+	}
+	schema, err := r.schema(int32(binary.BigEndian.Uint32(data[1:5])))
+	if err != nil {
+		return nil, err
+	}
+	return schema.Decode(data[5:])
+}
+
+func (r *Registry) latest(subject string) (int32, *Schema, error) {
+	r.mutex.Lock()
+	id, ok := r.bySubject[subject]
+	r.mutex.Unlock()
+	if ok {
+		schema, err := r.schema(id)
+		return id, schema, err
+	}
+
+	var res registeredSchema
+	if err := r.fetch("/subjects/"+url.PathEscape(subject)+"/versions/latest", &res); err != nil {
+		return 0, nil, err
+	}
+	schema, err := ParseSchema(res.Schema)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "schema %d", res.ID)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.bySubject[subject] = res.ID
+	r.byID[res.ID] = schema
+	return res.ID, schema, nil
+}
+
+func (r *Registry) schema(id int32) (*Schema, error) {
+	r.mutex.Lock()
+	schema, ok := r.byID[id]
+	r.mutex.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var res registeredSchema
+	if err := r.fetch(fmt.Sprintf("/schemas/ids/%d", id), &res); err != nil {
+		return nil, err
+	}
+	schema, err := ParseSchema(res.Schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "schema %d", id)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.byID[id] = schema
+	return schema, nil
+}
+
+// fetch makes a request to the registry with the VU's transport, so options
+// like hosts, TLS settings and blacklistIPs apply. Credentials can be given in
+// the registry URL; no metrics are emitted for these requests.
+func (r *Registry) fetch(path string, v interface{}) error {
+	state := lib.GetState(*r.ctx)
+	if state == nil {
+		return ErrRegistryInInitContext
+	}
+
+	req, err := http.NewRequest("GET", r.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(*r.ctx)
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	res, err := (&http.Client{Transport: state.Transport}).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "schema registry request failed")
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&apiErr)
+		return errors.Errorf("schema registry returned %s for %s: %s", res.Status, path, apiErr.Message)
+	}
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(v), "invalid schema registry response")
+}
@@ -0,0 +1,193 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package avro
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A Schema is a parsed Avro schema, as described in
+// https://avro.apache.org/docs/current/spec.html
+type Schema struct {
+	root *avroType
+}
+
+type avroType struct {
+	kind string // the primitive type name, or record, enum, array, map, fixed or union
+	name string // the full name of named types
+
+	fields   []*avroField // records
+	symbols  []string     // enums
+	items    *avroType    // arrays
+	values   *avroType    // maps
+	size     int          // fixed
+	branches []*avroType  // unions
+}
+
+type avroField struct {
+	name       string
+	typ        *avroType
+	def        interface{}
+	hasDefault bool
+}
+
+//nolint:gochecknoglobals
+var primitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// ParseSchema parses an Avro schema from its JSON representation.
+func ParseSchema(schemaJSON string) (*Schema, error) {
+	var raw interface{}
+	dec := json.NewDecoder(strings.NewReader(schemaJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "invalid Avro schema JSON")
+	}
+	p := schemaParser{named: make(map[string]*avroType)}
+	root, err := p.parse(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root}, nil
+}
+
+type schemaParser struct {
+	named map[string]*avroType
+}
+
+func (p *schemaParser) parse(raw interface{}, namespace string) (*avroType, error) {
+	switch s := raw.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return &avroType{kind: s}, nil
+		}
+		if t, ok := p.named[fullName(s, namespace)]; ok {
+			return t, nil
+		}
+		if t, ok := p.named[s]; ok {
+			return t, nil
+		}
+		return nil, errors.Errorf("unknown Avro type '%s'", s)
+	case []interface{}:
+		t := &avroType{kind: "union"}
+		for _, b := range s {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.kind == "union" {
+				return nil, errors.New("unions can't immediately contain other unions")
+			}
+			t.branches = append(t.branches, branch)
+		}
+		return t, nil
+	case map[string]interface{}:
+		return p.parseComplex(s, namespace)
+	default:
+		return nil, errors.Errorf("invalid Avro schema %v", raw)
+	}
+}
+
+func (p *schemaParser) parseComplex(s map[string]interface{}, namespace string) (*avroType, error) {
+	kind, _ := s["type"].(string)
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		name, _ := s["name"].(string)
+		if name == "" {
+			return nil, errors.Errorf("%s type without a name", kind)
+		}
+		if ns, ok := s["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		t := &avroType{kind: kind, name: fullName(name, namespace)}
+		if kind == "error" {
+			t.kind = "record"
+		}
+		if i := strings.LastIndex(t.name, "."); i >= 0 {
+			namespace = t.name[:i]
+		}
+		// Registered before the fields are parsed, so records can be recursive
+		p.named[t.name] = t
+		return t, p.parseNamed(t, s, namespace)
+	case "array":
+		items, err := p.parse(s["items"], namespace)
+		return &avroType{kind: kind, items: items}, err
+	case "map":
+		values, err := p.parse(s["values"], namespace)
+		return &avroType{kind: kind, values: values}, err
+	default:
+		// Includes primitive types with a logicalType, which are encoded as
+		// their underlying type
+		return p.parse(s["type"], namespace)
+	}
+}
+
+func (p *schemaParser) parseNamed(t *avroType, s map[string]interface{}, namespace string) error {
+	switch t.kind {
+	case "record":
+		fields, ok := s["fields"].([]interface{})
+		if !ok {
+			return errors.Errorf("record %s doesn't have fields", t.name)
+		}
+		for _, f := range fields {
+			rawField, _ := f.(map[string]interface{})
+			name, _ := rawField["name"].(string)
+			if name == "" {
+				return errors.Errorf("record %s has a field without a name", t.name)
+			}
+			typ, err := p.parse(rawField["type"], namespace)
+			if err != nil {
+				return errors.Wrapf(err, "%s.%s", t.name, name)
+			}
+			def, hasDefault := rawField["default"]
+			t.fields = append(t.fields, &avroField{name: name, typ: typ, def: def, hasDefault: hasDefault})
+		}
+	case "enum":
+		symbols, _ := s["symbols"].([]interface{})
+		for _, sym := range symbols {
+			name, ok := sym.(string)
+			if !ok {
+				return errors.Errorf("enum %s has an invalid symbol %v", t.name, sym)
+			}
+			t.symbols = append(t.symbols, name)
+		}
+	case "fixed":
+		rawSize, _ := s["size"].(json.Number)
+		size, err := rawSize.Int64()
+		if err != nil || size < 0 {
+			return errors.Errorf("fixed %s has an invalid size", t.name)
+		}
+		t.size = int(size)
+	}
+	return nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
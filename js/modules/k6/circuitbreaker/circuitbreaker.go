@@ -0,0 +1,279 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The states of a circuit breaker.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// breakers are shared between all VUs by their name, so they behave like the circuit breaker of
+// a single service that all of the VUs are requests to.
+var breakers = struct { //nolint:gochecknoglobals
+	sync.Mutex
+	m map[string]*breaker
+}{m: make(map[string]*breaker)}
+
+type config struct {
+	failureThreshold int64
+	resetTimeout     time.Duration
+	halfOpenRequests int64
+}
+
+// breaker is the state of a circuit breaker, which opens after failureThreshold consecutive
+// failures, rejects all calls for resetTimeout, and then lets halfOpenRequests probe calls
+// through. It closes again once all of the probes succeed, and opens again if any of them fails.
+type breaker struct {
+	config
+	mutex    sync.Mutex
+	state    string
+	failures int64
+	openedAt time.Time
+	probes   int64 // the probe calls that were let through in the half-open state
+	passed   int64 // the probe calls that succeeded
+}
+
+// allow reports whether a call can be made, and the state that the breaker changed to, if any.
+func (b *breaker) allow(now time.Time) (bool, string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.resetTimeout {
+			return false, ""
+		}
+		b.state, b.probes, b.passed = StateHalfOpen, 1, 0
+		return true, StateHalfOpen
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenRequests {
+			return false, ""
+		}
+		b.probes++
+		return true, ""
+	default:
+		return true, ""
+	}
+}
+
+// record records the result of a call, and returns the state that the breaker changed to, if any.
+func (b *breaker) record(success bool, now time.Time) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case StateHalfOpen:
+		if !success {
+			return b.open(now)
+		}
+		b.passed++
+		if b.passed >= b.halfOpenRequests {
+			b.state, b.failures = StateClosed, 0
+			return StateClosed
+		}
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return ""
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			return b.open(now)
+		}
+	}
+	// The results of the calls that were made before the breaker opened are ignored
+	return ""
+}
+
+func (b *breaker) open(now time.Time) string {
+	b.state, b.openedAt, b.probes, b.passed = StateOpen, now, 0, 0
+	return StateOpen
+}
+
+// CircuitBreaker is the JS interface of a circuit breaker.
+type CircuitBreaker struct {
+	name      string
+	breaker   *breaker
+	isSuccess goja.Callable
+}
+
+// CircuitBreakers is the k6/circuitbreaker module.
+type CircuitBreakers struct{}
+
+func New() *CircuitBreakers {
+	return &CircuitBreakers{}
+}
+
+// XCircuitBreaker creates the circuit breaker with the name, or returns the one that already
+// exists. The params of the first one are used for all of the circuit breakers with the name.
+func (*CircuitBreakers) XCircuitBreaker(ctxPtr *context.Context, name string, paramsV goja.Value) (interface{}, error) {
+	rt := common.GetRuntime(*ctxPtr)
+	if name == "" {
+		return nil, errors.New("the circuit breaker needs a name")
+	}
+
+	conf := config{failureThreshold: 5, resetTimeout: 30 * time.Second, halfOpenRequests: 1}
+	cb := &CircuitBreaker{name: name}
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			switch k {
+			case "failureThreshold":
+				conf.failureThreshold = v.ToInteger()
+			case "halfOpenRequests":
+				conf.halfOpenRequests = v.ToInteger()
+			case "resetTimeout":
+				d, err := parseDuration(v)
+				if err != nil {
+					return nil, err
+				}
+				conf.resetTimeout = d
+			case "isSuccess":
+				isSuccess, ok := goja.AssertFunction(v)
+				if !ok {
+					return nil, errors.New("the circuit breaker isSuccess param must be a function")
+				}
+				cb.isSuccess = isSuccess
+			default:
+				return nil, fmt.Errorf("unknown circuit breaker param '%s'", k)
+			}
+		}
+	}
+	if conf.failureThreshold < 1 || conf.halfOpenRequests < 1 {
+		return nil, errors.New("the circuit breaker failureThreshold and halfOpenRequests must be at least 1")
+	}
+	if conf.resetTimeout < 0 {
+		return nil, errors.New("the circuit breaker resetTimeout can't be negative")
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.m[name]
+	if !ok {
+		b = &breaker{config: conf, state: StateClosed}
+		breakers.m[name] = b
+	}
+	cb.breaker = b
+	return common.Bind(rt, cb, ctxPtr), nil
+}
+
+// parseDuration parses a number of milliseconds or a duration string like "10s".
+func parseDuration(v goja.Value) (time.Duration, error) {
+	if s, ok := v.Export().(string); ok {
+		return time.ParseDuration(s)
+	}
+	return time.Duration(v.ToFloat() * float64(time.Millisecond)), nil
+}
+
+// Call calls the function if the circuit is closed, or if it's a probe call in the half-open
+// state, and records whether it succeeded. Otherwise, it returns the result of the fallback
+// function, if there is one, or undefined. Calls that throw are failures, and so are responses
+// with a 5xx status if there's no isSuccess param.
+func (cb *CircuitBreaker) Call(ctx context.Context, fn goja.Callable, fallback ...goja.Value) (goja.Value, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("circuit breakers can't be called in the init context")
+	}
+	rt := common.GetRuntime(ctx)
+
+	allowed, changed := cb.breaker.allow(time.Now())
+	cb.emitStateChange(ctx, state, changed)
+	if !allowed {
+		cb.push(ctx, state, metrics.CircuitBreakerRejections, nil)
+		if len(fallback) > 0 {
+			if fallbackFn, ok := goja.AssertFunction(fallback[0]); ok {
+				return fallbackFn(goja.Undefined())
+			}
+		}
+		return goja.Undefined(), nil
+	}
+
+	result, err := fn(goja.Undefined())
+	success := err == nil
+	if success {
+		if success, err = cb.succeeded(rt, result); err != nil {
+			return nil, err
+		}
+	}
+	cb.emitStateChange(ctx, state, cb.breaker.record(success, time.Now()))
+	return result, err
+}
+
+func (cb *CircuitBreaker) succeeded(rt *goja.Runtime, result goja.Value) (bool, error) {
+	if cb.isSuccess != nil {
+		v, err := cb.isSuccess(goja.Undefined(), result)
+		if err != nil {
+			return false, err
+		}
+		return v.ToBoolean(), nil
+	}
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return true, nil
+	}
+	if obj, ok := result.(*goja.Object); ok {
+		if status := obj.Get("status"); status != nil && !goja.IsUndefined(status) {
+			return status.ToInteger() < 500, nil
+		}
+	}
+	return true, nil
+}
+
+// State returns the current state of the circuit breaker, "closed", "open" or "half-open".
+func (cb *CircuitBreaker) State() string {
+	cb.breaker.mutex.Lock()
+	defer cb.breaker.mutex.Unlock()
+	return cb.breaker.state
+}
+
+func (cb *CircuitBreaker) emitStateChange(ctx context.Context, state *lib.State, to string) {
+	if to != "" {
+		cb.push(ctx, state, metrics.CircuitBreakerStateChanges, map[string]string{"state": to})
+	}
+}
+
+func (cb *CircuitBreaker) push(ctx context.Context, state *lib.State, metric *stats.Metric, extraTags map[string]string) {
+	tags := state.CloneTags()
+	if state.Options.SystemTags["group"] {
+		tags["group"] = state.Group.Path
+	}
+	tags["breaker"] = cb.name
+	for k, v := range extraTags {
+		tags[k] = v
+	}
+	stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+		Time: time.Now(), Metric: metric, Value: 1, Tags: stats.IntoSampleTags(&tags),
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package circuitbreaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	b := &breaker{config: config{failureThreshold: 2, resetTimeout: time.Second, halfOpenRequests: 2}, state: StateClosed}
+	now := time.Now()
+
+	assert.Equal(t, "", b.record(false, now))
+	assert.Equal(t, "", b.record(true, now))
+	assert.Equal(t, "", b.record(false, now))
+	assert.Equal(t, StateOpen, b.record(false, now))
+
+	allowed, changed := b.allow(now.Add(999 * time.Millisecond))
+	assert.False(t, allowed)
+	assert.Equal(t, "", changed)
+
+	allowed, changed = b.allow(now.Add(time.Second))
+	assert.True(t, allowed)
+	assert.Equal(t, StateHalfOpen, changed)
+	allowed, _ = b.allow(now.Add(time.Second))
+	assert.True(t, allowed)
+	allowed, _ = b.allow(now.Add(time.Second))
+	assert.False(t, allowed, "only 2 probes should be let through")
+
+	assert.Equal(t, "", b.record(true, now.Add(time.Second)))
+	assert.Equal(t, StateOpen, b.record(false, now.Add(time.Second)))
+
+	now = now.Add(2 * time.Second)
+	_, changed = b.allow(now.Add(time.Second))
+	assert.Equal(t, StateHalfOpen, changed)
+	_, _ = b.allow(now.Add(time.Second))
+	assert.Equal(t, "", b.record(true, now))
+	assert.Equal(t, StateClosed, b.record(true, now))
+	assert.Equal(t, int64(0), b.failures)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("circuitbreaker", common.Bind(rt, New(), &ctx))
+
+	_, err := common.RunString(rt, `
+	let calls = 0;
+	let backend = function() { calls++; return { status: 503 }; };
+	let breaker = new circuitbreaker.CircuitBreaker("TestCircuitBreaker", { failureThreshold: 2, resetTimeout: "50ms" });
+	let healthy = new circuitbreaker.CircuitBreaker("TestCircuitBreaker-healthy", {
+		isSuccess: function(res) { return res === "ok"; },
+	});
+	`)
+	require.NoError(t, err)
+
+	t.Run("init context", func(t *testing.T) {
+		_, err := common.RunString(rt, `breaker.call(backend)`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "circuit breakers can't be called in the init context")
+	})
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	samples := make(chan stats.SampleContainer, 100)
+	state := &lib.State{Group: root, Options: lib.Options{SystemTags: lib.GetTagSet("group")}, Samples: samples}
+	ctx = lib.WithState(ctx, state)
+
+	_, err = common.RunString(rt, `
+	breaker.call(backend);
+	breaker.call(backend);
+	if (breaker.state() !== "open") { throw new Error("wrong state: " + breaker.state()); }
+	if (breaker.call(backend) !== undefined) { throw new Error("the call should've been rejected"); }
+	if (breaker.call(backend, function() { return "fallback"; }) !== "fallback") { throw new Error("no fallback"); }
+	if (calls !== 2) { throw new Error("wrong number of calls: " + calls); }
+
+	let sleepUntil = Date.now() + 60;
+	while (Date.now() < sleepUntil) {}
+	if (breaker.call(function() { return { status: 200 }; }).status !== 200) { throw new Error("the probe should've passed"); }
+	if (breaker.state() !== "closed") { throw new Error("wrong state: " + breaker.state()); }
+
+	try {
+		healthy.call(function() { throw new Error("boom"); });
+		throw new Error("the exception should've been rethrown");
+	} catch (e) {
+		if (e.message === "the exception should've been rethrown") { throw e; }
+	}
+	healthy.call(function() { return "not ok"; });
+	if (healthy.state() !== "closed") { throw new Error("wrong state: " + healthy.state()); }
+	`)
+	require.NoError(t, err)
+
+	var changes []string
+	rejections := 0
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, sample := range sc.GetSamples() {
+			switch sample.Metric {
+			case metrics.CircuitBreakerStateChanges:
+				name, _ := sample.Tags.Get("breaker")
+				to, _ := sample.Tags.Get("state")
+				changes = append(changes, name+":"+to)
+			case metrics.CircuitBreakerRejections:
+				rejections++
+			}
+		}
+	}
+	assert.Equal(t, []string{"TestCircuitBreaker:open", "TestCircuitBreaker:half-open", "TestCircuitBreaker:closed"}, changes)
+	assert.Equal(t, 2, rejections)
+
+	t.Run("invalid params", func(t *testing.T) {
+		_, err := common.RunString(rt, `new circuitbreaker.CircuitBreaker("x", { failureThreshold: 0 })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must be at least 1")
+
+		_, err = common.RunString(rt, `new circuitbreaker.CircuitBreaker("x", { timeout: 1 })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown circuit breaker param 'timeout'")
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package date
+
+import (
+	"context"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// newDateProgram returns a function that creates JS Date objects, which goja
+// doesn't allow from Go.
+var newDateProgram = goja.MustCompile("", `(function(ms) { return new Date(ms); })`, true) //nolint:gochecknoglobals
+
+// Date formats and parses dates and times, with named or custom layouts and
+// in any time zone, without having to bundle a JS library for it.
+type Date struct{}
+
+func New() *Date {
+	return &Date{}
+}
+
+// toTime converts a JS Date, a timestamp in milliseconds or an ISO 8601 string
+// to a time; undefined is the current time.
+func toTime(v goja.Value) (time.Time, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return time.Now(), nil
+	}
+	switch val := v.Export().(type) {
+	case time.Time:
+		return val, nil
+	case int64:
+		return time.Unix(0, val*int64(time.Millisecond)), nil
+	case float64:
+		return time.Unix(0, int64(val*float64(time.Millisecond))), nil
+	case string:
+		return time.Parse(time.RFC3339, val)
+	default:
+		return time.Time{}, errors.Errorf("invalid date %v", v)
+	}
+}
+
+// Format formats a date, by default with the ISO8601 layout and in UTC.
+func (*Date) Format(value goja.Value, layout, tz string) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	loc, err := location(tz)
+	if err != nil {
+		return "", err
+	}
+	if layout == "" {
+		layout = "ISO8601"
+	}
+	return format(t.In(loc), layout), nil
+}
+
+// Parse parses a date into a JS Date, by default with the ISO8601 layout.
+// Dates without an offset are in the given time zone, by default UTC.
+func (*Date) Parse(ctx context.Context, value, layout, tz string) (goja.Value, error) {
+	loc, err := location(tz)
+	if err != nil {
+		return nil, err
+	}
+	if layout == "" {
+		layout = "ISO8601"
+	}
+	t, err := parse(value, layout, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := common.GetRuntime(ctx)
+	newDateV, err := rt.RunProgram(newDateProgram)
+	if err != nil {
+		return nil, err
+	}
+	newDate, _ := goja.AssertFunction(newDateV)
+	return newDate(goja.Undefined(), rt.ToValue(t.UnixNano()/int64(time.Millisecond)))
+}
@@ -0,0 +1,140 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package date
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	tm := time.Date(2019, time.March, 4, 17, 5, 9, 123456789, time.UTC)
+	testdata := map[string]string{
+		"ISO8601":                      "2019-03-04T17:05:09.123Z",
+		"RFC1123":                      "Mon, 04 Mar 2019 17:05:09 UTC",
+		"HTTP":                         "Mon, 04 Mar 2019 17:05:09 GMT",
+		"YYYY-MM-DD HH:mm:ss.SSS":      "2019-03-04 17:05:09.123",
+		"YY/M/D h:m:s a":               "19/3/4 5:5:9 pm",
+		"dddd, MMMM D":                 "Monday, March 4",
+		"ddd MMM DD [at] hh A ZZ":      "Mon Mar 04 at 05 PM +0000",
+		"DDDD DDD d [day] X x":         "063 63 1 day 1551719109 1551719109123",
+		"[YYYY] YYYY[-]MM":             "YYYY 2019-03",
+		"YYYY-MM-DDTHH:mm:ssZ [unset]": "2019-03-04T17:05:09+00:00 unset",
+	}
+	for layout, expected := range testdata {
+		assert.Equal(t, expected, format(tm, layout), layout)
+	}
+}
+
+func TestParse(t *testing.T) {
+	berlin, err := location("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	testdata := []struct {
+		value, layout string
+		loc           *time.Location
+		expected      time.Time
+	}{
+		{"2019-03-04T17:05:09.123Z", "ISO8601", time.UTC, time.Date(2019, 3, 4, 17, 5, 9, 123000000, time.UTC)},
+		{"2019-03-04T17:05:09+02:00", "ISO8601", time.UTC, time.Date(2019, 3, 4, 15, 5, 9, 0, time.UTC)},
+		{"Mon, 04 Mar 2019 17:05:09 GMT", "HTTP", time.UTC, time.Date(2019, 3, 4, 17, 5, 9, 0, time.UTC)},
+		{"4/3/2019 5:05 PM", "D/M/YYYY h:mm A", berlin, time.Date(2019, 3, 4, 16, 5, 0, 0, time.UTC)},
+		{"2019-03-04 17:05:09.5 +0100", "YYYY-MM-DD HH:mm:ss.S ZZ", time.UTC, time.Date(2019, 3, 4, 16, 5, 9, 5e8, time.UTC)},
+		{"1551719109", "X", time.UTC, time.Date(2019, 3, 4, 17, 5, 9, 0, time.UTC)},
+		{"1551719109123", "x", time.UTC, time.Date(2019, 3, 4, 17, 5, 9, 123000000, time.UTC)},
+	}
+	for _, data := range testdata {
+		parsed, err := parse(data.value, data.layout, data.loc)
+		require.NoError(t, err, data.value)
+		assert.True(t, data.expected.Equal(parsed), "%s: %s", data.value, parsed)
+	}
+
+	_, err = parse("063", "DDDD", time.UTC)
+	assert.EqualError(t, err, "the 'DDDD' layout token can't be used for parsing")
+}
+
+func TestFormatParseRoundTrip(t *testing.T) {
+	tm := time.Date(2019, time.March, 4, 17, 5, 9, 0, time.UTC)
+	for _, layout := range []string{"YYYY-MM-DDTHH:mm:ssZ", "YYYY-MM-DD hh:mm:ss A ZZ", "ISO8601", "RFC1123Z"} {
+		for _, loc := range []*time.Location{time.UTC, time.FixedZone("+02:00", 2*3600)} {
+			formatted := format(tm.In(loc), layout)
+			parsed, err := parse(formatted, layout, time.Local)
+			require.NoError(t, err, formatted)
+			assert.True(t, tm.Equal(parsed), "%s: %s", formatted, parsed)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	loc, err := location("")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	loc, err = location("+05:30")
+	require.NoError(t, err)
+	_, offset := time.Date(2019, 1, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, 5*3600+30*60, offset)
+
+	loc, err = location("-0800")
+	require.NoError(t, err)
+	_, offset = time.Date(2019, 1, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, -8*3600, offset)
+
+	_, err = location("Nowhere/Special")
+	assert.EqualError(t, err, "unknown time zone 'Nowhere/Special'")
+	_, err = location("+25:00")
+	assert.EqualError(t, err, "invalid time zone offset '+25:00'")
+}
+
+func TestDateModule(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("date", common.Bind(rt, New(), &ctx))
+
+	_, err := common.RunString(rt, `
+	let d = date.parse("2019-03-04 17:05", "YYYY-MM-DD HH:mm", "+01:00");
+	if (!(d instanceof Date) || d.getTime() !== Date.UTC(2019, 2, 4, 16, 5)) {
+		throw new Error("unexpected date: " + d);
+	}
+	let formatted = date.format(d, "YYYY-MM-DD HH:mm Z", "-03:00");
+	if (formatted !== "2019-03-04 13:05 -03:00") {
+		throw new Error("unexpected formatted date: " + formatted);
+	}
+	if (date.format(d) !== "2019-03-04T16:05:00.000Z" || date.format(d.getTime()) !== date.format(d)) {
+		throw new Error("unexpected default format: " + date.format(d));
+	}
+	if (date.format(undefined, "YYYY") !== String(new Date().getUTCFullYear())) {
+		throw new Error("unexpected current date");
+	}`)
+	assert.NoError(t, err)
+
+	_, err = common.RunString(rt, `date.parse("nope")`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,240 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package date
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Predefined layouts, usable by name instead of a custom layout.
+var namedLayouts = map[string]string{ //nolint:gochecknoglobals
+	"ISO8601":     "2006-01-02T15:04:05.000Z07:00",
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"HTTP":        http.TimeFormat,
+}
+
+// Custom layout tokens, mostly compatible with moment.js. The longer tokens
+// have to come first, since the layouts are matched greedily.
+var layoutTokens = []string{ //nolint:gochecknoglobals
+	"YYYY", "YY", "MMMM", "MMM", "MM", "M", "DDDD", "DDD", "DD", "D", "dddd", "ddd", "d",
+	"HH", "H", "hh", "h", "mm", "m", "ss", "s", "SSS", "SS", "S", "A", "a", "ZZ", "Z", "z", "X", "x",
+}
+
+// Go's layout equivalents of the tokens, for parsing. The tokens that are formatted by Go use the
+// same layouts, so whatever they format can be parsed back.
+var goLayoutTokens = map[string]string{ //nolint:gochecknoglobals
+	"YYYY": "2006", "YY": "06", "MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"DD": "02", "D": "2", "dddd": "Monday", "ddd": "Mon", "HH": "15", "H": "15", "hh": "03", "h": "3",
+	"mm": "04", "m": "4", "ss": "05", "s": "5", "SSS": "000", "SS": "00", "S": "0",
+	"A": "PM", "a": "pm", "ZZ": "-0700", "Z": "-07:00", "z": "MST",
+}
+
+// tokenize splits a custom layout into tokens and literal text, which is
+// either anything that isn't a token, or text in [brackets].
+func tokenize(layout string) (tokens []string, literal []bool) {
+	for len(layout) > 0 {
+		if layout[0] == '[' {
+			if end := strings.IndexByte(layout, ']'); end > 0 {
+				tokens, literal = append(tokens, layout[1:end]), append(literal, true)
+				layout = layout[end+1:]
+				continue
+			}
+		}
+		token := layout[:1]
+		isLiteral := true
+		for _, t := range layoutTokens {
+			if strings.HasPrefix(layout, t) {
+				token, isLiteral = t, false
+				break
+			}
+		}
+		if isLiteral && len(literal) > 0 && literal[len(literal)-1] {
+			tokens[len(tokens)-1] += token
+		} else {
+			tokens, literal = append(tokens, token), append(literal, isLiteral)
+		}
+		layout = layout[len(token):]
+	}
+	return tokens, literal
+}
+
+func pad(i, width int) string {
+	s := strconv.Itoa(i)
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
+
+// format formats t with a named or a custom layout.
+func format(t time.Time, layout string) string {
+	if goLayout, ok := namedLayouts[layout]; ok {
+		if layout == "HTTP" {
+			t = t.UTC()
+		}
+		return t.Format(goLayout)
+	}
+
+	var sb strings.Builder
+	tokens, literal := tokenize(layout)
+	for i, token := range tokens {
+		if literal[i] {
+			sb.WriteString(token)
+			continue
+		}
+		sb.WriteString(formatToken(t, token))
+	}
+	return sb.String()
+}
+
+//nolint:gocyclo
+func formatToken(t time.Time, token string) string {
+	switch token {
+	case "YYYY":
+		return pad(t.Year(), 4)
+	case "YY":
+		return pad(t.Year()%100, 2)
+	case "MMMM":
+		return t.Month().String()
+	case "MMM":
+		return t.Month().String()[:3]
+	case "MM":
+		return pad(int(t.Month()), 2)
+	case "M":
+		return strconv.Itoa(int(t.Month()))
+	case "DDDD":
+		return pad(t.YearDay(), 3)
+	case "DDD":
+		return strconv.Itoa(t.YearDay())
+	case "DD":
+		return pad(t.Day(), 2)
+	case "D":
+		return strconv.Itoa(t.Day())
+	case "dddd":
+		return t.Weekday().String()
+	case "ddd":
+		return t.Weekday().String()[:3]
+	case "d":
+		return strconv.Itoa(int(t.Weekday()))
+	case "HH":
+		return pad(t.Hour(), 2)
+	case "H":
+		return strconv.Itoa(t.Hour())
+	case "hh", "h":
+		h := t.Hour() % 12
+		if h == 0 {
+			h = 12
+		}
+		return pad(h, len(token))
+	case "mm":
+		return pad(t.Minute(), 2)
+	case "m":
+		return strconv.Itoa(t.Minute())
+	case "ss":
+		return pad(t.Second(), 2)
+	case "s":
+		return strconv.Itoa(t.Second())
+	case "SSS", "SS", "S":
+		return pad(t.Nanosecond(), 9)[:len(token)]
+	case "A", "a", "ZZ", "Z", "z":
+		return t.Format(goLayoutTokens[token])
+	case "X":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "x":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return token
+}
+
+// parse parses value with a named or a custom layout. Values without an explicit
+// offset are interpreted as being in loc.
+func parse(value, layout string, loc *time.Location) (time.Time, error) {
+	if goLayout, ok := namedLayouts[layout]; ok {
+		if layout == "ISO8601" {
+			// Fractional seconds are optional when parsing with this layout
+			goLayout = time.RFC3339
+		}
+		return time.ParseInLocation(goLayout, value, loc)
+	}
+	switch layout {
+	case "X", "x":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Errorf("invalid timestamp '%s'", value)
+		}
+		if layout == "X" {
+			return time.Unix(i, 0).In(loc), nil
+		}
+		return time.Unix(0, i*int64(time.Millisecond)).In(loc), nil
+	}
+
+	var sb strings.Builder
+	tokens, literal := tokenize(layout)
+	for i, token := range tokens {
+		if literal[i] {
+			sb.WriteString(token)
+			continue
+		}
+		goToken, ok := goLayoutTokens[token]
+		if !ok {
+			return time.Time{}, errors.Errorf("the '%s' layout token can't be used for parsing", token)
+		}
+		sb.WriteString(goToken)
+	}
+	return time.ParseInLocation(sb.String(), value, loc)
+}
+
+// location returns the named IANA time zone, a fixed offset like "+02:00", or
+// UTC when tz is empty. "local" is the time zone of the machine running k6.
+func location(tz string) (*time.Location, error) {
+	switch strings.ToLower(tz) {
+	case "", "utc", "z":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+	if tz[0] == '+' || tz[0] == '-' {
+		t, err := time.Parse("-07:00", tz)
+		if err != nil {
+			if t, err = time.Parse("-0700", tz); err != nil {
+				return nil, errors.Errorf("invalid time zone offset '%s'", tz)
+			}
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(tz, offset), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.Errorf("unknown time zone '%s'", tz)
+	}
+	return loc, nil
+}
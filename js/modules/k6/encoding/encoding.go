@@ -23,8 +23,11 @@ package encoding
 import (
 	"context"
 	"encoding/base64"
+	"reflect"
 
+	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
+	"github.com/ugorji/go/codec"
 )
 
 type Encoding struct{}
@@ -71,3 +74,61 @@ func (e *Encoding) B64decode(ctx context.Context, input string, encoding string)
 
 	return string(output)
 }
+
+// Handles for the binary serialization formats; they're safe for concurrent
+// use once configured. Maps are always decoded with string keys, so they can
+// be used as JS objects, and map keys are sorted for reproducible output.
+var ( //nolint:gochecknoglobals
+	msgpackHandle = &codec.MsgpackHandle{RawToString: true, WriteExt: true}
+	cborHandle    = &codec.CborHandle{}
+)
+
+func init() {
+	for _, h := range []*codec.BasicHandle{&msgpackHandle.BasicHandle, &cborHandle.BasicHandle} {
+		h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+		h.SignedInteger = true
+		h.Canonical = true
+	}
+}
+
+func binaryEncode(ctx context.Context, h codec.Handle, input goja.Value) []byte {
+	var v interface{}
+	if input != nil {
+		v = input.Export()
+	}
+	var output []byte
+	if err := codec.NewEncoderBytes(&output, h).Encode(v); err != nil {
+		common.Throw(common.GetRuntime(ctx), err)
+	}
+	return output
+}
+
+func binaryDecode(ctx context.Context, h codec.Handle, input []byte) interface{} {
+	var output interface{}
+	if err := codec.NewDecoderBytes(input, h).Decode(&output); err != nil {
+		common.Throw(common.GetRuntime(ctx), err)
+	}
+	return output
+}
+
+// MsgpackEncode serializes any JS value as MessagePack. Strings are encoded
+// as str and binary data, like the responses of binary requests, as bin.
+func (e *Encoding) MsgpackEncode(ctx context.Context, input goja.Value) []byte {
+	return binaryEncode(ctx, msgpackHandle, input)
+}
+
+// MsgpackDecode deserializes MessagePack data into a JS value.
+func (e *Encoding) MsgpackDecode(ctx context.Context, input []byte) interface{} {
+	return binaryDecode(ctx, msgpackHandle, input)
+}
+
+// CborEncode serializes any JS value as CBOR. Strings are encoded as text
+// strings and binary data as byte strings.
+func (e *Encoding) CborEncode(ctx context.Context, input goja.Value) []byte {
+	return binaryEncode(ctx, cborHandle, input)
+}
+
+// CborDecode deserializes CBOR data into a JS value.
+func (e *Encoding) CborDecode(ctx context.Context, input []byte) interface{} {
+	return binaryDecode(ctx, cborHandle, input)
+}
@@ -150,4 +150,52 @@ func TestEncodingAlgorithms(t *testing.T) {
 			assert.NoError(t, err)
 		})
 	})
+	t.Run("MessagePack", func(t *testing.T) {
+		t.Run("Enc", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			const correct = [0x82, 0xa1, 0x61, 0x01, 0xa1, 0x62, 0x92, 0xc3, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0];
+			let encoded = encoding.msgpackEncode({ b: [true, 1.5], a: 1 });
+			if (encoded.length !== correct.length || !correct.every((b, i) => encoded[i] === b)) {
+				throw new Error("Encoding mismatch: " + encoded);
+			}`)
+			assert.NoError(t, err)
+		})
+		t.Run("RoundTrip", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			const correct = { name: "こんにちは", n: -3, list: [null, "x", { nested: 4.25 }] };
+			let decoded = encoding.msgpackDecode(encoding.msgpackEncode(correct));
+			if (JSON.stringify(decoded) !== JSON.stringify({ list: correct.list, n: -3, name: correct.name })) {
+				throw new Error("Decoding mismatch: " + JSON.stringify(decoded));
+			}`)
+			assert.NoError(t, err)
+		})
+		t.Run("InvalidDec", func(t *testing.T) {
+			_, err := common.RunString(rt, `encoding.msgpackDecode([0x92, 0x01])`)
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("CBOR", func(t *testing.T) {
+		t.Run("Enc", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			const correct = [0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x82, 0xf5, 0x63, 0x66, 0x6f, 0x6f];
+			let encoded = encoding.cborEncode({ b: [true, "foo"], a: 1 });
+			if (encoded.length !== correct.length || !correct.every((b, i) => encoded[i] === b)) {
+				throw new Error("Encoding mismatch: " + encoded);
+			}`)
+			assert.NoError(t, err)
+		})
+		t.Run("Dec", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let decoded = encoding.cborDecode([0xa2, 0x61, 0x61, 0x20, 0x61, 0x62, 0x42, 0x01, 0x02]);
+			if (decoded.a !== -1 || decoded.b.length !== 2 || decoded.b[1] !== 2) {
+				throw new Error("Decoding mismatch: " + JSON.stringify(decoded));
+			}`)
+			assert.NoError(t, err)
+		})
+		t.Run("InvalidDec", func(t *testing.T) {
+			_, err := common.RunString(rt, `encoding.cborDecode([0x82, 0x01])`)
+			assert.Error(t, err)
+		})
+	})
 }
@@ -0,0 +1,147 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrExecOutsideSetupTeardown is returned when a command is run outside of setup() and teardown().
+var ErrExecOutsideSetupTeardown = errors.New("external commands can only be run in setup() and teardown()")
+
+// Exec is the k6/exec module, which lets setup() and teardown() run the external commands that
+// were allowed with the --exec-allow flag, e.g. to seed a database before the test.
+type Exec struct{}
+
+// New returns a new k6/exec module.
+func New() *Exec {
+	return &Exec{}
+}
+
+// Result is the outcome of a command that was run.
+type Result struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Command runs the allowed command name with args and waits for it to finish. Its output is
+// returned and also logged, line by line. A non-zero exit code isn't an error, it's up to the
+// script to check it. The optional params can have a timeout in milliseconds, a working dir and
+// env, an object with environment variables that are added to the ones of k6.
+func (*Exec) Command(ctx context.Context, name string, args []string, params ...goja.Value) (*Result, error) {
+	state := lib.GetState(ctx)
+	if state == nil || !inSetupOrTeardown(state) {
+		return nil, ErrExecOutsideSetupTeardown
+	}
+	if !isAllowed(state.ExecAllow, name) {
+		return nil, errors.Errorf("the command '%s' isn't allowed, use the --exec-allow flag to allow it", name)
+	}
+
+	var (
+		timeout time.Duration
+		dir     string
+		env     []string
+	)
+	if len(params) > 0 && !goja.IsUndefined(params[0]) && !goja.IsNull(params[0]) {
+		rt := common.GetRuntime(ctx)
+		p := params[0].ToObject(rt)
+		for _, k := range p.Keys() {
+			v := p.Get(k)
+			switch k {
+			case "timeout":
+				timeout = time.Duration(v.ToFloat() * float64(time.Millisecond))
+			case "dir":
+				dir = v.String()
+			case "env":
+				envObj := v.ToObject(rt)
+				for _, key := range envObj.Keys() {
+					env = append(env, key+"="+envObj.Get(key).String())
+				}
+			}
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	logger := state.Logger.WithField("command", name)
+	logOutput(logger.WithField("stream", "stdout"), stdout.String())
+	logOutput(logger.WithField("stream", "stderr"), stderr.String())
+
+	res := &Result{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctxErr := ctx.Err(); ctxErr == context.DeadlineExceeded {
+		return res, errors.Errorf("the command '%s' timed out after %s", name, timeout)
+	}
+	if exitErr, ok := err.(*osexec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	if err != nil {
+		return res, errors.Wrapf(err, "couldn't run the command '%s'", name)
+	}
+	return res, nil
+}
+
+func inSetupOrTeardown(state *lib.State) bool {
+	return state.Stage == lib.StageSetup || state.Stage == lib.StageTeardown
+}
+
+func isAllowed(allowed []string, name string) bool {
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func logOutput(logger *log.Entry, output string) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		logger.Info(scanner.Text())
+	}
+}
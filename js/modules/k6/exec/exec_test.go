@@ -0,0 +1,105 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package exec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	setup, err := root.Group("setup")
+	require.NoError(t, err)
+	nested, err := setup.Group("seed")
+	require.NoError(t, err)
+
+	logger, hook := logtest.NewNullLogger()
+	state := &lib.State{Group: setup, Stage: lib.StageSetup, Logger: logger, ExecAllow: []string{"sh"}}
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("exec", common.Bind(rt, New(), &ctx))
+
+	t.Run("NoState", func(t *testing.T) {
+		_, err := common.RunString(rt, `exec.command("sh", ["-c", "true"])`)
+		assert.Contains(t, err.Error(), ErrExecOutsideSetupTeardown.Error())
+	})
+
+	ctx = lib.WithState(ctx, state)
+	t.Run("Output", func(t *testing.T) {
+		hook.Reset()
+		_, err := common.RunString(rt, `
+		let res = exec.command("sh", ["-c", "echo $GREETING; echo oops >&2; exit 3"], { env: { GREETING: "hi" } });
+		if (res.stdout !== "hi\n") { throw new Error("wrong stdout: " + res.stdout); }
+		if (res.stderr !== "oops\n") { throw new Error("wrong stderr: " + res.stderr); }
+		if (res.exit_code !== 3) { throw new Error("wrong exit code: " + res.exit_code); }
+		`)
+		require.NoError(t, err)
+		entries := hook.AllEntries()
+		require.Len(t, entries, 2)
+		assert.Equal(t, "hi", entries[0].Message)
+		assert.Equal(t, logrus.Fields{"command": "sh", "stream": "stdout"}, entries[0].Data)
+		assert.Equal(t, "oops", entries[1].Message)
+		assert.Equal(t, "stderr", entries[1].Data["stream"])
+	})
+	t.Run("Dir", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let res = exec.command("sh", ["-c", "pwd"], { dir: "/" });
+		if (res.stdout !== "/\n") { throw new Error("wrong dir: " + res.stdout); }
+		`)
+		require.NoError(t, err)
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		_, err := common.RunString(rt, `exec.command("sh", ["-c", "exec sleep 5"], { timeout: 50 })`)
+		assert.Contains(t, err.Error(), "the command 'sh' timed out after 50ms")
+	})
+	t.Run("NotAllowed", func(t *testing.T) {
+		_, err := common.RunString(rt, `exec.command("rm", ["-rf", "/tmp/nope"])`)
+		assert.Contains(t, err.Error(), "the command 'rm' isn't allowed")
+	})
+	t.Run("Nested", func(t *testing.T) {
+		state.Group = nested
+		_, err := common.RunString(rt, `exec.command("sh", ["-c", "true"])`)
+		assert.NoError(t, err)
+	})
+	t.Run("Teardown", func(t *testing.T) {
+		state.Stage = lib.StageTeardown
+		_, err := common.RunString(rt, `exec.command("sh", ["-c", "true"])`)
+		assert.NoError(t, err)
+	})
+	t.Run("Default", func(t *testing.T) {
+		// A group named like setup() in an iteration doesn't count.
+		state.Group, state.Stage = setup, ""
+		_, err := common.RunString(rt, `exec.command("sh", ["-c", "true"])`)
+		assert.Contains(t, err.Error(), ErrExecOutsideSetupTeardown.Error())
+	})
+}
@@ -0,0 +1,78 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"io"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/lib/netext/httpext"
+)
+
+// parseBodyStream returns the body stream of a request body that's either a function, which
+// returns the next chunk of the body with every call and null or undefined after the last one,
+// or an iterator like the ones of generators, which yields the chunks. The chunks can be strings
+// or ArrayBuffers. ok is false if the body is something else.
+func parseBodyStream(rt *goja.Runtime, v goja.Value) (stream httpext.BodyStream, ok bool) {
+	if fn, ok := goja.AssertFunction(v); ok {
+		return func() ([]byte, error) {
+			chunk, err := fn(goja.Undefined())
+			if err != nil {
+				return nil, err
+			}
+			if goja.IsUndefined(chunk) || goja.IsNull(chunk) {
+				return nil, io.EOF
+			}
+			return exportChunk(chunk), nil
+		}, true
+	}
+
+	obj, isObj := v.(*goja.Object)
+	if !isObj {
+		return nil, false
+	}
+	next, ok := goja.AssertFunction(obj.Get("next"))
+	if !ok {
+		return nil, false
+	}
+	return func() ([]byte, error) {
+		res, err := next(obj)
+		if err != nil {
+			return nil, err
+		}
+		resObj := res.ToObject(rt)
+		if done := resObj.Get("done"); done != nil && done.ToBoolean() {
+			return nil, io.EOF
+		}
+		chunk := resObj.Get("value")
+		if chunk == nil || goja.IsUndefined(chunk) || goja.IsNull(chunk) {
+			return nil, nil
+		}
+		return exportChunk(chunk), nil
+	}, true
+}
+
+func exportChunk(chunk goja.Value) []byte {
+	if data, ok := chunk.Export().([]byte); ok {
+		return data
+	}
+	return []byte(chunk.String())
+}
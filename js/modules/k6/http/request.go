@@ -38,6 +38,7 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/netext/httpext"
+	"github.com/pkg/errors"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -98,7 +99,11 @@ func (h *HTTP) Request(ctx context.Context, method string, url goja.Value, args
 	var params goja.Value
 
 	if len(args) > 0 {
-		body = args[0].Export()
+		if stream, ok := parseBodyStream(common.GetRuntime(ctx), args[0]); ok {
+			body = stream
+		} else {
+			body = args[0].Export()
+		}
 	}
 	if len(args) > 1 {
 		params = args[1]
@@ -116,6 +121,65 @@ func (h *HTTP) Request(ctx context.Context, method string, url goja.Value, args
 	return responseFromHttpext(resp), nil
 }
 
+// longPollTimeout is the default timeout of the LongPoll requests, longer than the usual one since
+// servers hold long-polling requests until they have new data.
+const longPollTimeout = 120 * time.Second
+
+// LongPoll makes long-polling GET requests to url in a loop and calls callback with every
+// response. The next request is made as soon as the callback returns, either to the same URL or
+// to the one the callback returned, until it returns false or the VU is stopped. The requests'
+// duration, waiting and receiving times are measured by the http_longpoll_* metrics instead of
+// the http_req_* ones. It returns the number of requests made.
+func (h *HTTP) LongPoll(ctx context.Context, url, params, callback goja.Value) (int, error) {
+	fn, ok := goja.AssertFunction(callback)
+	if !ok {
+		return 0, fmt.Errorf("the last argument of longPoll must be a callback function")
+	}
+	rt := common.GetRuntime(ctx)
+
+	polls := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return polls, nil
+		default:
+		}
+
+		u, err := ToURL(url)
+		if err != nil {
+			return polls, err
+		}
+		req, err := h.parseRequest(ctx, HTTP_METHOD_GET, u, nil, params)
+		if err != nil {
+			return polls, err
+		}
+		req.LongPoll = true
+		if params == nil || goja.IsUndefined(params) || goja.IsNull(params) ||
+			goja.IsUndefined(params.ToObject(rt).Get("timeout")) {
+			req.Timeout = longPollTimeout
+		}
+
+		resp, err := httpext.MakeRequest(ctx, req)
+		if err != nil {
+			return polls, err
+		}
+		polls++
+
+		ret, err := fn(goja.Undefined(), rt.ToValue(responseFromHttpext(resp)))
+		if err != nil {
+			return polls, err
+		}
+		switch v := ret.Export().(type) {
+		case bool:
+			if !v {
+				return polls, nil
+			}
+		case string:
+			url = ret
+		}
+	}
+}
+
 //TODO break this function up
 //nolint: gocyclo
 func (h *HTTP) parseRequest(
@@ -139,6 +203,8 @@ func (h *HTTP) parseRequest(
 		Redirects: state.Options.MaxRedirects,
 		Cookies:   make(map[string]*httpext.HTTPRequestCookie),
 		Tags:      make(map[string]string),
+
+		ResponseCallback: state.ResponseCallback,
 	}
 	if state.Options.DiscardResponseBodies.Bool {
 		result.ResponseType = httpext.ResponseTypeNone
@@ -230,6 +296,11 @@ func (h *HTTP) parseRequest(
 			result.Body = bytes.NewBufferString(data)
 		case []byte:
 			result.Body = bytes.NewBuffer(data)
+		case httpext.BodyStream:
+			result.BodyStream = data
+		case func(goja.FunctionCall) goja.Value:
+			// Only the bodies of batch requests are still functions here.
+			return nil, errors.New("streamed request bodies aren't supported in http.batch()")
 		default:
 			return nil, fmt.Errorf("unknown request body type %T", body)
 		}
@@ -301,6 +372,16 @@ func (h *HTTP) parseRequest(
 						result.Req.Header.Set(key, str)
 					}
 				}
+			case "trailers":
+				trailersV := params.Get(k)
+				if goja.IsUndefined(trailersV) || goja.IsNull(trailersV) {
+					continue
+				}
+				trailers := trailersV.ToObject(rt)
+				result.Req.Trailer = make(http.Header, len(trailers.Keys()))
+				for _, key := range trailers.Keys() {
+					result.Req.Trailer.Set(key, trailers.Get(key).String())
+				}
 			case "jar":
 				jarV := params.Get(k)
 				if goja.IsUndefined(jarV) || goja.IsNull(jarV) {
@@ -317,19 +398,41 @@ func (h *HTTP) parseRequest(
 				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
 					continue
 				}
-				tagObj := tagsV.ToObject(rt)
-				if tagObj == nil {
-					continue
+				result.MultiTags = common.ParseTags(rt, tagsV, result.Tags)
+			case "metadata":
+				result.Metadata = common.ParseMetadata(rt, params.Get(k))
+			case "signer":
+				signer, err := parseSigner(ctx, params.Get(k))
+				if err != nil {
+					return nil, err
 				}
-				for _, key := range tagObj.Keys() {
-					result.Tags[key] = tagObj.Get(key).String()
+				result.Signer = signer
+			case "responseCallback":
+				callback, err := parseResponseCallback(params.Get(k))
+				if err != nil {
+					return nil, err
 				}
+				result.ResponseCallback = callback
 			case "auth":
 				result.Auth = params.Get(k).String()
 			case "timeout":
 				result.Timeout = time.Duration(params.Get(k).ToFloat() * float64(time.Millisecond))
 			case "throw":
 				result.Throw = params.Get(k).ToBoolean()
+			case "longPoll":
+				result.LongPoll = params.Get(k).ToBoolean()
+			case "pool":
+				pool := params.Get(k).String()
+				if _, ok := state.Pools[pool]; !ok {
+					return nil, fmt.Errorf("unknown connection pool '%s', it must be one of the connectionPools option", pool)
+				}
+				result.Pool = pool
+				result.Tags["pool"] = pool
+			case "expectContinue":
+				// The transport only waits for the 100 Continue response if there's a body.
+				if params.Get(k).ToBoolean() {
+					result.Req.Header.Set("Expect", "100-continue")
+				}
 			case "responseType":
 				responseType, err := httpext.ResponseTypeString(params.Get(k).String())
 				if err != nil {
@@ -364,6 +467,13 @@ func (h *HTTP) Batch(ctx context.Context, reqsV goja.Value) (goja.Value, error)
 		if err != nil {
 			return nil, err
 		}
+		// JS signers can only be called from the VU's goroutine, so they sign the batch
+		// requests before they're sent concurrently.
+		if _, ok := parsedReq.Signer.(*jsRequestSigner); ok {
+			if err := parsedReq.Sign(); err != nil {
+				return nil, err
+			}
+		}
 		parsedReqs[key] = parsedReq
 	}
 
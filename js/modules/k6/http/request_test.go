@@ -38,13 +38,16 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext/httpext"
 	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/oxtoacart/bpool"
 	"github.com/sirupsen/logrus"
 	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -139,6 +142,360 @@ func newRuntime(
 	return tb, state, samples, rt, ctx
 }
 
+func TestRequestSigner(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	if _, err := httpext.GetRequestSigner("test-signer"); err != nil {
+		httpext.RegisterRequestSigner("test-signer", httpext.RequestSignerFunc(func(req *httpext.SignableRequest) error {
+			req.Header.Set("X-Signature", fmt.Sprintf("%s %s %d", req.Method, req.URL.Path, len(req.Body)))
+			return nil
+		}))
+	}
+
+	t.Run("Go", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let res = http.post("HTTPBIN_URL/post", "data", { signer: "test-signer" });
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.json().headers["X-Signature"] != "POST /post 4") {
+			throw new Error("wrong X-Signature: " + res.json().headers["X-Signature"]);
+		}
+		if (res.request.headers["X-Signature"][0] != "POST /post 4") {
+			throw new Error("wrong request headers: " + JSON.stringify(res.request.headers));
+		}
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("JS", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		function sign(req) {
+			req.headers["X-Signature"] = req.method + " " + req.url + " " + req.body;
+			req.url = req.url.replace("/anything", "/post");
+			req.method = "POST";
+			req.body = req.body + "-signed";
+		}
+		let res = http.put("HTTPBIN_URL/anything", "data", { signer: sign });
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.json().headers["X-Signature"] != "PUT HTTPBIN_URL/anything data") {
+			throw new Error("wrong X-Signature: " + res.json().headers["X-Signature"]);
+		}
+		if (res.json().data != "data-signed") { throw new Error("wrong body: " + res.json().data); }
+		if (res.request.method != "POST") { throw new Error("wrong request method: " + res.request.method); }
+
+		let batch = http.batch([
+			["POST", "HTTPBIN_URL/post", "a", { signer: sign }],
+			["POST", "HTTPBIN_URL/post", "bb", { signer: "test-signer" }],
+		]);
+		if (batch[0].json().data != "a-signed") { throw new Error("wrong batch body: " + batch[0].json().data); }
+		if (batch[1].json().headers["X-Signature"] != "POST /post 2") {
+			throw new Error("wrong batch X-Signature: " + batch[1].json().headers["X-Signature"]);
+		}
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`http.get("HTTPBIN_URL/get", { signer: "missing" });`))
+		assert.Contains(t, err.Error(), "unknown request signer 'missing'")
+
+		_, err = common.RunString(rt, sr(`http.get("HTTPBIN_URL/get", { signer: () => { throw new Error("no key"); } });`))
+		assert.Contains(t, err.Error(), "couldn't sign the request: Error: no key")
+	})
+}
+
+func TestRequestBodyStream(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	t.Run("Function", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let i = 0;
+		let res = http.post("HTTPBIN_URL/post", function() { return i < 3 ? "chunk" + (i++) + ";" : null; });
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.json().data != "chunk0;chunk1;chunk2;") { throw new Error("wrong body: " + res.json().data); }
+		if (i != 3) { throw new Error("wrong number of calls: " + i); }
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("Iterator", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let chunks = ["a", "", "bc"];
+		let iterator = { i: 0, next() { return this.i < chunks.length ? { value: chunks[this.i++] } : { done: true }; } };
+		let res = http.put("HTTPBIN_URL/put", iterator);
+		if (res.json().data != "abc") { throw new Error("wrong body: " + res.json().data); }
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		http.post("HTTPBIN_URL/post", () => { throw new Error("no more data"); });
+		`))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "no more data")
+		}
+
+		_, err = common.RunString(rt, sr(`
+		http.batch([["POST", "HTTPBIN_URL/post", () => null]]);
+		`))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "streamed request bodies aren't supported in http.batch()")
+		}
+
+		_, err = common.RunString(rt, sr(`
+		http.post("HTTPBIN_URL/post", () => null, { signer: () => {} });
+		`))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "streamed request bodies can't be signed")
+		}
+	})
+}
+
+func TestTrailers(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	tb.Mux.HandleFunc("/trailers", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Trailer", "Grpc-Status, X-Request-Trailer, X-Unsent")
+		_, _ = w.Write(body)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("X-Request-Trailer", r.Trailer.Get("X-Checksum"))
+	})
+
+	t.Run("Body", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let res = http.post("HTTPBIN_URL/trailers", "data", { trailers: { "X-Checksum": "abc" } });
+		if (res.body != "data") { throw new Error("wrong body: " + res.body); }
+		if (res.trailers["Grpc-Status"] != "0") { throw new Error("wrong trailers: " + JSON.stringify(res.trailers)); }
+		if (res.trailers["X-Request-Trailer"] != "abc") { throw new Error("wrong trailers: " + JSON.stringify(res.trailers)); }
+		if ("X-Unsent" in res.trailers) { throw new Error("unsent trailer: " + JSON.stringify(res.trailers)); }
+		if ("Grpc-Status" in res.headers) { throw new Error("trailer in the headers: " + JSON.stringify(res.headers)); }
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("NoBody", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let res = http.post("HTTPBIN_URL/trailers", null, { trailers: { "X-Checksum": "def" } });
+		if (res.trailers["X-Request-Trailer"] != "def") { throw new Error("wrong trailers: " + JSON.stringify(res.trailers)); }
+		`))
+		assert.NoError(t, err)
+	})
+	t.Run("None", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		let res = http.get("HTTPBIN_URL/get");
+		if (Object.keys(res.trailers).length != 0) { throw new Error("wrong trailers: " + JSON.stringify(res.trailers)); }
+		`))
+		assert.NoError(t, err)
+	})
+}
+
+func TestResponseCallback(t *testing.T) {
+	t.Parallel()
+	tb, state, samples, rt, ctx := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+	state.Options.Throw = null.BoolFrom(false)
+	state.ResponseCallback = httpext.DefaultResponseCallback
+
+	// Returns the expected_response tags and the http_req_failed values of the requests, or "-"
+	// for requests without them.
+	getResults := func() (expected []string, failed []float64) {
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sc.GetSamples() {
+				switch sample.Metric {
+				case metrics.HTTPReqs:
+					tag, ok := sample.Tags.Get("expected_response")
+					if !ok {
+						tag = "-"
+					}
+					expected = append(expected, tag)
+				case metrics.HTTPReqFailed:
+					failed = append(failed, sample.Value)
+				}
+			}
+		}
+		return expected, failed
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		http.get("HTTPBIN_URL/status/200");
+		http.get("HTTPBIN_URL/status/404");
+		http.get("HTTPBIN_URL/redirect/1");
+		`))
+		require.NoError(t, err)
+		expected, failed := getResults()
+		assert.Equal(t, []string{"true", "false", "true", "true"}, expected)
+		assert.Equal(t, []float64{0, 1, 0, 0}, failed)
+	})
+	t.Run("ExpectedStatuses", func(t *testing.T) {
+		defer func() { state.ResponseCallback = httpext.DefaultResponseCallback }()
+		_, err := common.RunString(rt, sr(`
+		http.setResponseCallback(http.expectedStatuses(404, { min: 200, max: 201 }));
+		http.get("HTTPBIN_URL/status/201");
+		http.get("HTTPBIN_URL/status/202");
+		http.get("HTTPBIN_URL/status/404");
+		`))
+		require.NoError(t, err)
+		expected, failed := getResults()
+		assert.Equal(t, []string{"true", "false", "true"}, expected)
+		assert.Equal(t, []float64{0, 1, 0}, failed)
+	})
+	t.Run("Params", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`
+		http.get("HTTPBIN_URL/status/404", { responseCallback: http.expectedStatuses(404) });
+		http.get("HTTPBIN_URL/status/404", { responseCallback: null });
+		http.batch([["GET", "HTTPBIN_URL/status/500", null, { responseCallback: http.expectedStatuses(500) }]]);
+		`))
+		require.NoError(t, err)
+		expected, failed := getResults()
+		assert.Equal(t, []string{"true", "-", "true"}, expected)
+		assert.Equal(t, []float64{0, 0}, failed)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		defer func() { state.ResponseCallback = httpext.DefaultResponseCallback }()
+		holder := lib.ResponseCallback(httpext.DefaultResponseCallback)
+		*ctx = lib.WithResponseCallback(*ctx, &holder)
+		_, err := common.RunString(rt, sr(`
+		http.setResponseCallback(null);
+		http.get("HTTPBIN_URL/status/404");
+		`))
+		require.NoError(t, err)
+		assert.Nil(t, holder)
+		expected, failed := getResults()
+		assert.Equal(t, []string{"-"}, expected)
+		assert.Empty(t, failed)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		for script, msg := range map[string]string{
+			`http.expectedStatuses()`:                                "no expected statuses were given",
+			`http.expectedStatuses(200, "a")`:                        "argument 2 is not a status or a range of statuses",
+			`http.expectedStatuses(200.5)`:                           "argument 1: 200.5 is not a valid status",
+			`http.expectedStatuses({ min: 200 })`:                    "argument 1: a range of statuses needs a numeric max",
+			`http.expectedStatuses({ min: 300, max: 200 })`:          "the min status 300 is bigger than the max status 200",
+			`http.setResponseCallback(() => true)`:                   "the response callback must be the result of http.expectedStatuses() or null",
+			`http.get("HTTPBIN_URL/get", { responseCallback: 200 })`: "the response callback must be the result of http.expectedStatuses() or null",
+		} {
+			_, err := common.RunString(rt, sr(script))
+			if assert.Error(t, err, script) {
+				assert.Contains(t, err.Error(), msg, script)
+			}
+		}
+	})
+}
+
+func TestChaos(t *testing.T) {
+	t.Parallel()
+	tb, state, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+	state.Options.Throw = null.BoolFrom(false)
+
+	// Returns the injected tags of the requests, or "-" for requests without them.
+	getInjected := func() (injected []string) {
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sc.GetSamples() {
+				if sample.Metric == metrics.HTTPReqs {
+					tag, ok := sample.Tags.Get("injected")
+					if !ok {
+						tag = "-"
+					}
+					injected = append(injected, tag)
+				}
+			}
+		}
+		return injected
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		state.Options.Chaos = types.ChaosConfig{Fail: null.FloatFrom(1), Valid: true}
+		_, err := common.RunString(rt, sr(`
+		let res = http.get("HTTPBIN_URL/get");
+		if (res.error_code != 1050) { throw new Error("wrong error_code: " + res.error_code); }
+		if (res.status != 0) { throw new Error("wrong status: " + res.status); }
+		`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{types.ChaosFail}, getInjected())
+	})
+	t.Run("Delay", func(t *testing.T) {
+		state.Options.Chaos = types.ChaosConfig{
+			Delay: null.FloatFrom(1), DelayBy: types.NullDurationFrom(200 * time.Millisecond), Valid: true,
+		}
+		_, err := common.RunString(rt, sr(`
+		let res = http.get("HTTPBIN_URL/get");
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.timings.receiving < 200) { throw new Error("not delayed: " + res.timings.receiving); }
+		`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{types.ChaosDelay}, getInjected())
+	})
+	t.Run("Truncate", func(t *testing.T) {
+		state.Options.Chaos = types.ChaosConfig{Truncate: null.FloatFrom(1), Valid: true}
+		_, err := common.RunString(rt, sr(`
+		let res = http.get("HTTPBIN_URL/bytes/1000", { responseType: "binary" });
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.body.length != 500) { throw new Error("wrong body length: " + res.body.length); }
+		`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{types.ChaosTruncate}, getInjected())
+	})
+	t.Run("Seeded", func(t *testing.T) {
+		defer func() { state.ChaosRand = nil }()
+		chaos := types.ChaosConfig{Fail: null.FloatFrom(0.5), Valid: true}
+		state.Options.Chaos = chaos
+		state.ChaosRand = common.NewSeededRandSource(42)
+		_, err := common.RunString(rt, sr(`for (let i = 0; i < 20; i++) { http.get("HTTPBIN_URL/get"); }`))
+		require.NoError(t, err)
+
+		// The faults are picked by the source of the VU, not the global math/rand
+		random := common.NewSeededRandSource(42)
+		var expected []string
+		for i := 0; i < 20; i++ {
+			if fault := chaos.Pick(random()); fault != "" {
+				expected = append(expected, fault)
+			} else {
+				expected = append(expected, "-")
+			}
+		}
+		assert.Equal(t, expected, getInjected())
+	})
+	t.Run("None", func(t *testing.T) {
+		state.Options.Chaos = types.ChaosConfig{}
+		_, err := common.RunString(rt, sr(`http.get("HTTPBIN_URL/get");`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"-"}, getInjected())
+	})
+}
+
+func TestConnectionPools(t *testing.T) {
+	t.Parallel()
+	tb, state, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+	state.Pools = map[string]http.RoundTripper{"direct": tb.HTTPTransport}
+
+	_, err := common.RunString(rt, sr(`
+	let res = http.get("HTTPBIN_URL/get", { pool: "direct" });
+	if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+	`))
+	require.NoError(t, err)
+	bufSamples := stats.GetBufferedSamples(samples)
+	require.NotEmpty(t, bufSamples)
+	pool, ok := bufSamples[0].GetSamples()[0].Tags.Get("pool")
+	assert.True(t, ok)
+	assert.Equal(t, "direct", pool)
+
+	_, err = common.RunString(rt, sr(`http.get("HTTPBIN_URL/get", { pool: "cdn" });`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown connection pool 'cdn', it must be one of the connectionPools option")
+	}
+}
+
 func TestRequestAndBatch(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip()
@@ -734,6 +1091,17 @@ func TestRequestAndBatch(t *testing.T) {
 			})
 		})
 
+		t.Run("expectContinue", func(t *testing.T) {
+			_, err := common.RunString(rt, sr(`
+			let res = http.post("HTTPBIN_URL/post", "data", { expectContinue: true });
+			if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+			if (res.json().data != "data") { throw new Error("wrong body: " + res.json().data); }
+			if (res.request.headers["Expect"][0] != "100-continue") { throw new Error("wrong Expect: " + res.request.headers["Expect"]); }
+			if (typeof res.timings.expect_continue != "number") { throw new Error("no expect_continue timing"); }
+			`))
+			assert.NoError(t, err)
+		})
+
 		t.Run("headers", func(t *testing.T) {
 			for _, literal := range []string{`null`, `undefined`} {
 				t.Run(literal, func(t *testing.T) {
@@ -800,6 +1168,43 @@ func TestRequestAndBatch(t *testing.T) {
 				}
 			})
 
+			t.Run("multi-value", func(t *testing.T) {
+				_, err := common.RunString(rt, sr(`
+				let res = http.request("GET", "HTTPBIN_URL/headers", null, { tags: { tag: "value", flags: ["b", "a"], method: ["x"] } });
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				`))
+				assert.NoError(t, err)
+				bufSamples := stats.GetBufferedSamples(samples)
+				assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/headers"), "", 200, "")
+				for _, sampleC := range bufSamples {
+					for _, sample := range sampleC.GetSamples() {
+						assert.Equal(t, map[string][]string{"flags": {"a", "b"}}, sample.Tags.CloneMultiTags())
+						tagValue, ok := sample.Tags.Get("tag")
+						assert.True(t, ok)
+						assert.Equal(t, "value", tagValue)
+						tagValue, _ = sample.Tags.Get("method")
+						assert.Equal(t, "GET", tagValue)
+					}
+				}
+			})
+
+			t.Run("metadata", func(t *testing.T) {
+				_, err := common.RunString(rt, sr(`
+				let res = http.request("GET", "HTTPBIN_URL/headers", null, { metadata: { trace_id: "abc" } });
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				`))
+				assert.NoError(t, err)
+				bufSamples := stats.GetBufferedSamples(samples)
+				assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/headers"), "", 200, "")
+				for _, sampleC := range bufSamples {
+					for _, sample := range sampleC.GetSamples() {
+						assert.Equal(t, map[string]string{"trace_id": "abc"}, sample.Metadata)
+						_, ok := sample.Tags.Get("trace_id")
+						assert.False(t, ok)
+					}
+				}
+			})
+
 			t.Run("tags-precedence", func(t *testing.T) {
 				oldOpts := state.Options
 				defer func() { state.Options = oldOpts }()
@@ -1461,3 +1866,138 @@ func TestErrorCodes(t *testing.T) {
 		})
 	}
 }
+
+func TestServerTiming(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	tb.Mux.HandleFunc("/server-timing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Server-Timing", `db;dur=53.5, cache;desc="Cache Read";dur=23.2`)
+		w.Header().Add("Server-Timing", "miss")
+	})
+
+	_, err := common.RunString(rt, sr(`
+	let res = http.get("HTTPBIN_URL/server-timing");
+	let st = res.timings.server_timing;
+	if (st.length != 3) { throw new Error("wrong server timings: " + JSON.stringify(st)); }
+	if (st[0].name != "db" || st[0].duration != 53.5) { throw new Error("wrong db timing: " + JSON.stringify(st[0])); }
+	if (st[1].description != "Cache Read") { throw new Error("wrong cache timing: " + JSON.stringify(st[1])); }
+	if (st[2].name != "miss" || st[2].duration != 0) { throw new Error("wrong miss timing: " + JSON.stringify(st[2])); }
+	if (http.get("HTTPBIN_URL/get").timings.server_timing.length !== 0) { throw new Error("unexpected server timings"); }
+	`))
+	require.NoError(t, err)
+
+	seen := map[string]float64{}
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric != metrics.HTTPReqServerTiming {
+				continue
+			}
+			name, _ := sample.Tags.Get("server_timing")
+			url, _ := sample.Tags.Get("url")
+			assert.Equal(t, sr("HTTPBIN_URL/server-timing"), url)
+			seen[name] = sample.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{"db": 53.5, "cache": 23.2, "miss": 0}, seen)
+}
+
+func TestLongPoll(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	var polled []string
+	tb.Mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		polled = append(polled, r.URL.Query().Get("cursor"))
+		time.Sleep(100 * time.Millisecond)
+		_, _ = fmt.Fprint(w, len(polled))
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		polled = nil
+		_, err := common.RunString(rt, sr(`
+		let polls = http.longPoll("HTTPBIN_URL/poll?cursor=a", { tags: { name: "poll" } }, function(res) {
+			if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+			if (res.body == "3") { return false; }
+			if (res.body == "2") { return "HTTPBIN_URL/poll?cursor=b"; }
+		});
+		if (polls != 3) { throw new Error("wrong number of polls: " + polls); }
+		`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "a", "b"}, polled)
+
+		seen := map[string]int{}
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sc.GetSamples() {
+				seen[sample.Metric.Name]++
+				if sample.Metric == metrics.HTTPLongPollWaiting {
+					assert.True(t, sample.Value >= 100, "waiting %f", sample.Value)
+				}
+			}
+		}
+		assert.Equal(t, 3, seen[metrics.HTTPReqs.Name])
+		assert.Equal(t, 3, seen[metrics.HTTPLongPollDuration.Name])
+		assert.Equal(t, 3, seen[metrics.HTTPLongPollWaiting.Name])
+		assert.Equal(t, 3, seen[metrics.HTTPLongPollReceiving.Name])
+		assert.Zero(t, seen[metrics.HTTPReqDuration.Name])
+		assert.Zero(t, seen[metrics.HTTPReqWaiting.Name])
+	})
+
+	t.Run("param", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`http.get("HTTPBIN_URL/poll", { longPoll: true });`))
+		require.NoError(t, err)
+		var names []string
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			_, isTrail := sc.(*httpext.Trail)
+			assert.False(t, isTrail)
+			for _, sample := range sc.GetSamples() {
+				names = append(names, sample.Metric.Name)
+			}
+		}
+		assert.Contains(t, names, metrics.HTTPLongPollDuration.Name)
+		assert.NotContains(t, names, metrics.HTTPReqDuration.Name)
+	})
+
+	t.Run("no callback", func(t *testing.T) {
+		_, err := common.RunString(rt, sr(`http.longPoll("HTTPBIN_URL/poll");`))
+		assert.Error(t, err)
+	})
+}
+
+func TestDiscardResponseBodiesDataReceived(t *testing.T) {
+	t.Parallel()
+	tb, state, _, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	state.Options.DiscardResponseBodies = null.BoolFrom(true)
+
+	_ = tb.Dialer.GetTrail(time.Now(), time.Now(), false, nil)
+	_, err := common.RunString(rt, tb.Replacer.Replace(`
+		let res = http.get("HTTPBIN_URL/bytes/100000");
+		if (res.body !== null) { throw new Error("the body wasn't discarded"); }
+	`))
+	require.NoError(t, err)
+
+	// The discarded body is still read from the connection, so it's counted in data_received.
+	trail := tb.Dialer.GetTrail(time.Now(), time.Now(), false, nil)
+	assert.True(t, trail.BytesRead >= 100000, "read %d bytes", trail.BytesRead)
+}
+
+func TestRPSLimiters(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, ctx := newRuntime(t)
+	defer tb.Cleanup()
+
+	// The first request uses up the burst of both limiters and the slower one paces the rest.
+	*ctx = lib.WithRPSLimiter(*ctx, rate.NewLimiter(100, 1))
+	*ctx = lib.WithRPSLimiter(*ctx, rate.NewLimiter(10, 1))
+	start := time.Now()
+	_, err := common.RunString(rt, tb.Replacer.Replace(`
+		for (let i = 0; i < 4; i++) { http.get("HTTPBIN_URL/get"); }
+	`))
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 300*time.Millisecond, "took %s", time.Since(start))
+}
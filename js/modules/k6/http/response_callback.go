@@ -0,0 +1,140 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// expectedStatuses is the response callback that http.expectedStatuses() returns: a status is
+// expected if it's one of the exact ones or in one of the ranges.
+type expectedStatuses struct {
+	exact  []int
+	ranges []statusRange
+}
+
+type statusRange struct {
+	min, max int
+}
+
+func (e *expectedStatuses) match(status int) bool {
+	for _, s := range e.exact {
+		if s == status {
+			return true
+		}
+	}
+	for _, r := range e.ranges {
+		if status >= r.min && status <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectedStatuses returns a response callback for http.setResponseCallback() and the
+// responseCallback param, which expects the given statuses. Each argument is either a status or
+// an object with the min and max statuses of a range, e.g. `{ min: 200, max: 299 }`.
+func (*HTTP) ExpectedStatuses(args ...goja.Value) (*expectedStatuses, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no expected statuses were given")
+	}
+
+	result := &expectedStatuses{}
+	for i, arg := range args {
+		if arg == nil || goja.IsUndefined(arg) || goja.IsNull(arg) {
+			return nil, fmt.Errorf("argument %d is not a status or a range of statuses", i+1)
+		}
+		switch v := arg.Export().(type) {
+		case int64:
+			result.exact = append(result.exact, int(v))
+		case float64:
+			if v != float64(int(v)) {
+				return nil, fmt.Errorf("argument %d: %v is not a valid status", i+1, v)
+			}
+			result.exact = append(result.exact, int(v))
+		case map[string]interface{}:
+			r, err := parseStatusRange(v)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %s", i+1, err)
+			}
+			result.ranges = append(result.ranges, r)
+		default:
+			return nil, fmt.Errorf("argument %d is not a status or a range of statuses", i+1)
+		}
+	}
+	return result, nil
+}
+
+func parseStatusRange(obj map[string]interface{}) (statusRange, error) {
+	var r statusRange
+	for key, dst := range map[string]*int{"min": &r.min, "max": &r.max} {
+		switch v := obj[key].(type) {
+		case int64:
+			*dst = int(v)
+		case float64:
+			if v != float64(int(v)) {
+				return r, fmt.Errorf("%s: %v is not a valid status", key, v)
+			}
+			*dst = int(v)
+		default:
+			return r, fmt.Errorf("a range of statuses needs a numeric %s", key)
+		}
+	}
+	if r.min > r.max {
+		return r, fmt.Errorf("the min status %d is bigger than the max status %d", r.min, r.max)
+	}
+	return r, nil
+}
+
+// SetResponseCallback changes the response callback of the VU, which decides whether responses
+// are expected ones for the expected_response tag and the http_req_failed metric. Null disables
+// both of them. When it's called in an iteration, it applies to all of the later ones as well.
+func (*HTTP) SetResponseCallback(ctx context.Context, v goja.Value) {
+	callback, err := parseResponseCallback(v)
+	if err != nil {
+		common.Throw(common.GetRuntime(ctx), err)
+	}
+	if holder := lib.GetResponseCallback(ctx); holder != nil {
+		*holder = callback
+	}
+	if state := lib.GetState(ctx); state != nil {
+		state.ResponseCallback = callback
+	}
+}
+
+// parseResponseCallback returns the response callback of a value that http.expectedStatuses()
+// returned, or nil for null. JS functions aren't supported, because they would have to be called
+// from the goroutines of http.batch().
+func parseResponseCallback(v goja.Value) (lib.ResponseCallback, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, nil
+	}
+	if e, ok := v.Export().(*expectedStatuses); ok {
+		return e.match, nil
+	}
+	return nil, errors.New("the response callback must be the result of http.expectedStatuses() or null")
+}
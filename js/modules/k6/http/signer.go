@@ -0,0 +1,113 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/netext/httpext"
+	"github.com/pkg/errors"
+)
+
+// parseSigner returns the request signer of the signer param: either the name of a signer that
+// was registered with httpext.RegisterRequestSigner, or a JS function.
+func parseSigner(ctx context.Context, v goja.Value) (httpext.RequestSigner, error) {
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, nil
+	}
+	if fn, ok := goja.AssertFunction(v); ok {
+		return &jsRequestSigner{ctx: ctx, fn: fn}, nil
+	}
+	return httpext.GetRequestSigner(v.String())
+}
+
+// jsRequestSigner calls a JS function with an object with the method, url, headers and body of
+// the request, which the function can change. As it uses the VU's runtime, it can only be called
+// from the VU's goroutine.
+type jsRequestSigner struct {
+	ctx context.Context
+	fn  goja.Callable
+}
+
+func (s *jsRequestSigner) SignRequest(req *httpext.SignableRequest) error {
+	rt := common.GetRuntime(s.ctx)
+
+	headers := rt.NewObject()
+	for k, values := range req.Header {
+		if len(values) == 1 {
+			_ = headers.Set(k, values[0])
+		} else {
+			_ = headers.Set(k, values)
+		}
+	}
+	obj := rt.NewObject()
+	_ = obj.Set("method", req.Method)
+	_ = obj.Set("url", req.URL.String())
+	_ = obj.Set("headers", headers)
+	if req.Body != nil {
+		_ = obj.Set("body", string(req.Body))
+	} else {
+		_ = obj.Set("body", goja.Null())
+	}
+
+	if _, err := s.fn(goja.Undefined(), obj); err != nil {
+		return err
+	}
+
+	req.Method = obj.Get("method").String()
+	u, err := url.Parse(obj.Get("url").String())
+	if err != nil {
+		return errors.Wrap(err, "invalid url")
+	}
+	req.URL = u
+
+	for k := range req.Header {
+		delete(req.Header, k)
+	}
+	if headersV := obj.Get("headers"); headersV != nil && !goja.IsUndefined(headersV) && !goja.IsNull(headersV) {
+		headersObj := headersV.ToObject(rt)
+		for _, key := range headersObj.Keys() {
+			valueV := headersObj.Get(key)
+			if items, ok := valueV.Export().([]interface{}); ok {
+				for _, item := range items {
+					req.Header.Add(key, rt.ToValue(item).String())
+				}
+				continue
+			}
+			req.Header.Set(key, valueV.String())
+		}
+	}
+
+	switch body := obj.Get("body"); {
+	case body == nil || goja.IsUndefined(body) || goja.IsNull(body):
+		req.Body = nil
+	default:
+		if data, ok := body.Export().([]byte); ok {
+			req.Body = data
+		} else {
+			req.Body = []byte(body.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ids
+
+import (
+	"bufio"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+)
+
+// IDs generates UUIDs and ULIDs natively.
+type IDs struct {
+	// Buffered, since reading a few bytes at a time from crypto/rand is slow.
+	randMutex sync.Mutex
+	rand      io.Reader
+
+	now func() time.Time
+}
+
+func New() *IDs {
+	return &IDs{rand: bufio.NewReaderSize(crand.Reader, 4096), now: time.Now}
+}
+
+// readRandom fills b with the random bits of an ID. With the seed option, the VU has its own
+// reproducible source of them, see lib.State.IDsRand; otherwise they come from crypto/rand.
+func (i *IDs) readRandom(ctxPtr *context.Context, b []byte) {
+	if ctxPtr != nil && *ctxPtr != nil {
+		if state := lib.GetState(*ctxPtr); state != nil && state.IDsRand != nil {
+			_, _ = state.IDsRand.Read(b) // math/rand never fails
+			return
+		}
+	}
+
+	i.randMutex.Lock()
+	defer i.randMutex.Unlock()
+	if _, err := io.ReadFull(i.rand, b); err != nil {
+		panic(err) // crypto/rand doesn't fail on supported platforms
+	}
+}
+
+// An id is the 128 bits shared by UUIDs and ULIDs.
+type id [16]byte
+
+func unixMillis(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// setTime sets the 48-bit big-endian millisecond timestamp of UUIDv7s and ULIDs.
+func (u *id) setTime(ms uint64) {
+	var tmp [8]byte
+	binary.BigEndian.PutUint64(tmp[:], ms)
+	copy(u[:6], tmp[2:])
+}
+
+func (u *id) uuid(version byte) string {
+	u[6] = (u[6] & 0x0f) | version<<4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulid encodes the 128 bits with Crockford's base32, 5 bits per character,
+// with the first character only holding the 3 leftover high bits.
+func (u *id) ulid() string {
+	var buf [26]byte
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// incrementULID adds one to the random bits, returning false on overflow.
+func (u *id) incrementULID() bool {
+	for i := 15; i >= 6; i-- {
+		if u[i]++; u[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// incrementUUID adds one to the random bits of a UUIDv7, skipping over the version
+// and variant bits, returning false on overflow.
+func (u *id) incrementUUID() bool {
+	for i := 15; i >= 9; i-- {
+		if u[i]++; u[i] != 0 {
+			return true
+		}
+	}
+	if u[8]&0x3f != 0x3f {
+		u[8]++
+		return true
+	}
+	u[8] &^= 0x3f
+	if u[7]++; u[7] != 0 {
+		return true
+	}
+	if u[6]&0x0f != 0x0f {
+		u[6]++
+		return true
+	}
+	u[6] &^= 0x0f
+	return false
+}
+
+// UUIDv4 returns a random UUID.
+func (i *IDs) UUIDv4(ctxPtr *context.Context) string {
+	var u id
+	i.readRandom(ctxPtr, u[:])
+	return u.uuid(4)
+}
+
+// UUIDv7 returns a time-ordered UUID, with a millisecond timestamp followed by random bits.
+func (i *IDs) UUIDv7(ctxPtr *context.Context) string {
+	var u id
+	u.setTime(unixMillis(i.now()))
+	i.readRandom(ctxPtr, u[6:])
+	return u.uuid(7)
+}
+
+// ULID returns a lexicographically sortable identifier, with a millisecond timestamp
+// followed by random bits.
+func (i *IDs) ULID(ctxPtr *context.Context) string {
+	var u id
+	u.setTime(unixMillis(i.now()))
+	i.readRandom(ctxPtr, u[6:])
+	return u.ulid()
+}
+
+// XMonotonic creates a generator whose UUIDv7s and ULIDs are strictly increasing, even
+// within the same millisecond. Created in the init context, there's one for each VU.
+func (i *IDs) XMonotonic(ctxPtr *context.Context) *Monotonic {
+	return &Monotonic{ids: i, ctxPtr: ctxPtr}
+}
+
+// Monotonic generates strictly increasing UUIDv7s and ULIDs: within the same millisecond,
+// or if the clock goes backwards, the previous ID is incremented instead of being
+// randomized again, like the ULID spec's monotonicity and RFC 9562's method 3.
+type Monotonic struct {
+	ids    *IDs
+	ctxPtr *context.Context
+
+	mutex      sync.Mutex
+	uuid, ulid monotonicState
+}
+
+type monotonicState struct {
+	ms   uint64
+	last id
+}
+
+// next returns the ID following the previous one; fresh IDs get the top random bit
+// cleared (given by headroom), so there's plenty of room for incrementing them.
+func (m *Monotonic) next(state *monotonicState, increment func(*id) bool, headroom byte) id {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ms := unixMillis(m.ids.now())
+	if ms <= state.ms && increment(&state.last) {
+		return state.last
+	}
+	if ms <= state.ms {
+		// Practically impossible, but just move on to the next millisecond
+		ms = state.ms + 1
+	}
+	state.ms = ms
+	state.last.setTime(ms)
+	m.ids.readRandom(m.ctxPtr, state.last[6:])
+	state.last[6] &^= headroom
+	return state.last
+}
+
+// UUIDv7 returns a time-ordered UUID that's greater than the previous one.
+func (m *Monotonic) UUIDv7() string {
+	u := m.next(&m.uuid, (*id).incrementUUID, 0x08)
+	return u.uuid(7)
+}
+
+// ULID returns a ULID that's greater than the previous one.
+func (m *Monotonic) ULID() string {
+	u := m.next(&m.ulid, (*id).incrementULID, 0x80)
+	return u.ulid()
+}
@@ -0,0 +1,124 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ids
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidRegex = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestIDs(t *testing.T) {
+	i := New()
+
+	t.Run("UUIDv4", func(t *testing.T) {
+		u := i.UUIDv4(nil)
+		assert.Equal(t, "4", uuidRegex.FindStringSubmatch(u)[1], u)
+		assert.NotEqual(t, u, i.UUIDv4(nil))
+	})
+
+	t.Run("UUIDv7", func(t *testing.T) {
+		i := New()
+		i.now = func() time.Time { return time.Unix(0, 1469918176385*int64(time.Millisecond)) }
+		u := i.UUIDv7(nil)
+		assert.Equal(t, "7", uuidRegex.FindStringSubmatch(u)[1], u)
+		assert.Equal(t, "01563df3-6481-7", u[:15])
+	})
+
+	t.Run("ULID", func(t *testing.T) {
+		var zero, max id
+		for j := range max {
+			max[j] = 0xff
+		}
+		assert.Equal(t, "00000000000000000000000000", zero.ulid())
+		assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", max.ulid())
+
+		i := New()
+		i.now = func() time.Time { return time.Unix(0, 1469918176385*int64(time.Millisecond)) }
+		u := i.ULID(nil)
+		assert.Regexp(t, ulidRegex, u)
+		assert.Equal(t, "01ARYZ6S41", u[:10])
+	})
+
+	t.Run("Monotonic", func(t *testing.T) {
+		i := New()
+		now := time.Unix(1000, 0)
+		i.now = func() time.Time { return now }
+		m := i.XMonotonic(nil)
+
+		prevUUID, prevULID := m.UUIDv7(), m.ULID()
+		for j := 0; j < 1000; j++ {
+			if j%100 == 0 {
+				// Going backwards in time mustn't matter either
+				now = now.Add(time.Duration(j%300-100) * time.Millisecond)
+			}
+			u, l := m.UUIDv7(), m.ULID()
+			assert.Regexp(t, uuidRegex, u)
+			assert.Regexp(t, ulidRegex, l)
+			assert.True(t, u > prevUUID, "%s <= %s", u, prevUUID)
+			assert.True(t, l > prevULID, "%s <= %s", l, prevULID)
+			prevUUID, prevULID = u, l
+		}
+	})
+
+	t.Run("IncrementOverflow", func(t *testing.T) {
+		var u id
+		for j := 6; j < 16; j++ {
+			u[j] = 0xff
+		}
+		u[6], u[8] = 0x7f, 0xbf
+		before := u
+		assert.False(t, u.incrementUUID())
+		assert.Equal(t, byte(0x70), u[6])
+		assert.Equal(t, byte(0x80), u[8])
+		assert.True(t, bytes.Equal(before[:6], u[:6]))
+
+		u = id{15: 0xff}
+		assert.True(t, u.incrementULID())
+		assert.Equal(t, id{14: 1}, u)
+	})
+}
+
+func TestIDsModule(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("ids", common.Bind(rt, New(), &ctx))
+
+	_, err := common.RunString(rt, `
+	let m = new ids.Monotonic();
+	let values = [ids.uuidv4(), ids.uuidv7(), ids.ulid(), m.uuidv7(), m.ulid()];
+	if (values.some(v => typeof v !== "string") || m.ulid() <= values[4]) {
+		throw new Error("unexpected values: " + values);
+	}`)
+	assert.NoError(t, err)
+}
@@ -52,7 +52,13 @@ func (*K6) Fail(msg string) (goja.Value, error) {
 }
 
 func (*K6) Sleep(ctx context.Context, secs float64) {
-	timer := time.NewTimer(time.Duration(secs * float64(time.Second)))
+	d := time.Duration(secs * float64(time.Second))
+	if state := lib.GetState(ctx); state != nil && state.SleepWithJobs != nil {
+		state.SleepWithJobs(ctx, d)
+		return
+	}
+
+	timer := time.NewTimer(d)
 	select {
 	case <-timer.C:
 	case <-ctx.Done():
@@ -67,6 +73,17 @@ func (*K6) RandomSeed(ctx context.Context, seed int64) {
 	rt.SetRandSource(randSource)
 }
 
+// Variant returns the experiment variant of the current iteration, or undefined if the test has
+// no variants, so scripts can exercise a different version of the system for each of them.
+func (*K6) Variant(ctx context.Context) goja.Value {
+	if state := lib.GetState(ctx); state != nil {
+		if variant, ok := state.Tags["variant"]; ok {
+			return common.GetRuntime(ctx).ToValue(variant)
+		}
+	}
+	return goja.Undefined()
+}
+
 func (*K6) Group(ctx context.Context, name string, fn goja.Callable) (goja.Value, error) {
 	state := lib.GetState(ctx)
 	if state == nil {
@@ -90,10 +107,10 @@ func (*K6) Group(ctx context.Context, name string, fn goja.Callable) (goja.Value
 	ret, err := fn(goja.Undefined())
 	t := time.Now()
 
-	tags := state.Options.RunTags.CloneTags()
-	if state.Options.SystemTags["group"] {
-		tags["group"] = g.Path
-	}
+	// The group tag is always set, even if it's disabled for the other metrics, since the
+	// durations are only useful per group.
+	tags := state.CloneTags()
+	tags["group"] = g.Path
 	if state.Options.SystemTags["vu"] {
 		tags["vu"] = strconv.FormatInt(state.Vu, 10)
 	}
@@ -120,7 +137,7 @@ func (*K6) Check(ctx context.Context, arg0, checks goja.Value, extras ...goja.Va
 	t := time.Now()
 
 	// Prepare tags, make sure the `group` tag can't be overwritten.
-	commonTags := state.Options.RunTags.CloneTags()
+	commonTags := state.CloneTags()
 	if state.Options.SystemTags["group"] {
 		commonTags["group"] = state.Group.Path
 	}
@@ -107,12 +107,29 @@ func TestRandSeed(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestVariant(t *testing.T) {
+	rt := goja.New()
+	state := &lib.State{}
+	ctx := context.Background()
+	ctx = common.WithRuntime(ctx, rt)
+	ctx = lib.WithState(ctx, state)
+	rt.Set("k6", common.Bind(rt, New(), &ctx))
+
+	_, err := common.RunString(rt, `if (k6.variant() !== undefined) { throw new Error("unexpected variant"); }`)
+	assert.NoError(t, err)
+
+	state.Tags = map[string]string{"variant": "new"}
+	_, err = common.RunString(rt, `if (k6.variant() !== "new") { throw new Error("wrong variant: " + k6.variant()); }`)
+	assert.NoError(t, err)
+}
+
 func TestGroup(t *testing.T) {
 	root, err := lib.NewGroup("", nil)
 	assert.NoError(t, err)
 
 	rt := goja.New()
-	state := &lib.State{Group: root, Samples: make(chan stats.SampleContainer, 1000)}
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{Group: root, Samples: samples}
 
 	ctx := context.Background()
 	ctx = lib.WithState(ctx, state)
@@ -128,6 +145,25 @@ func TestGroup(t *testing.T) {
 		_, err = common.RunString(rt, `k6.group("my group", fn)`)
 		assert.NoError(t, err)
 		assert.Equal(t, state.Group, root)
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		require.Len(t, bufSamples, 1)
+		sample := bufSamples[0].(stats.Sample)
+		assert.Equal(t, metrics.GroupDuration, sample.Metric)
+		group, ok := sample.Tags.Get("group")
+		assert.True(t, ok)
+		assert.Equal(t, "::my group", group)
+	})
+	t.Run("Nested", func(t *testing.T) {
+		_, err = common.RunString(rt, `k6.group("outer", function() { k6.group("inner", function() {}) })`)
+		assert.NoError(t, err)
+
+		var groups []string
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			group, _ := sc.(stats.Sample).Tags.Get("group")
+			groups = append(groups, group)
+		}
+		assert.Equal(t, []string{"::outer::inner", "::outer"}, groups)
 	})
 
 	t.Run("Invalid", func(t *testing.T) {
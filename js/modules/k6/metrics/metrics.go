@@ -24,7 +24,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"regexp"
 	"time"
 
 	"github.com/dop251/goja"
@@ -33,12 +32,8 @@ import (
 	"github.com/loadimpact/k6/stats"
 )
 
-var nameRegexString = "^[\\p{L}\\p{N}\\._ !\\?/&#\\(\\)<>%-]{1,128}$"
-
-var compileNameRegex = regexp.MustCompile(nameRegexString)
-
 func checkName(name string) bool {
-	return compileNameRegex.Match([]byte(name))
+	return stats.ValidateMetricName(name) == nil
 }
 
 type Metric struct {
@@ -48,40 +43,77 @@ type Metric struct {
 // ErrMetricsAddInInitContext is error returned when adding to metric is done in the init context
 var ErrMetricsAddInInitContext = common.NewInitContextError("Adding to metrics in the init context is not supported")
 
-func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, isTime []bool) (interface{}, error) {
+func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, contains []goja.Value) (interface{}, error) {
 	if lib.GetState(*ctxPtr) != nil {
 		return nil, errors.New("metrics must be declared in the init context")
 	}
 
-	//TODO: move verification outside the JS
 	if !checkName(name) {
 		return nil, common.NewInitContextError(fmt.Sprintf("Invalid metric name: '%s'", name))
 	}
 
-	valueType := stats.Default
-	if len(isTime) > 0 && isTime[0] {
-		valueType = stats.Time
+	valueType, err := parseContains(contains)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every VU declares the same metrics, so they all get the ones that the first VU registered.
+	var m *stats.Metric
+	if registry := lib.GetMetricRegistry(*ctxPtr); registry != nil {
+		if m, err = registry.NewMetric(name, t, valueType); err != nil {
+			return nil, common.NewInitContextError(err.Error())
+		}
+	} else {
+		m = stats.New(name, t, valueType)
 	}
 
 	rt := common.GetRuntime(*ctxPtr)
-	return common.Bind(rt, Metric{stats.New(name, t, valueType)}, ctxPtr), nil
+	return common.Bind(rt, Metric{m}, ctxPtr), nil
 }
 
-func (m Metric) Add(ctx context.Context, v goja.Value, addTags ...map[string]string) (bool, error) {
+// parseContains returns what the values of a metric are, from the optional second argument of
+// the constructors. That's either the name of a value type, like "time" or "data", or a boolean
+// for whether the values are times.
+func parseContains(contains []goja.Value) (stats.ValueType, error) {
+	if len(contains) == 0 || goja.IsUndefined(contains[0]) || goja.IsNull(contains[0]) {
+		return stats.Default, nil
+	}
+	v := contains[0]
+	if _, ok := v.Export().(bool); ok {
+		if v.ToBoolean() {
+			return stats.Time, nil
+		}
+		return stats.Default, nil
+	}
+	var valueType stats.ValueType
+	if err := valueType.UnmarshalText([]byte(v.String())); err != nil {
+		return stats.Default, common.NewInitContextError(fmt.Sprintf(
+			"Invalid metric value type: '%s', it must be 'default', 'time' or 'data'", v.String()))
+	}
+	return valueType, nil
+}
+
+// Add adds a sample to the metric, with the tags of the optional second argument on top of the
+// VU's ones. The optional third argument are the sample's metadata.
+func (m Metric) Add(ctx context.Context, v goja.Value, args ...goja.Value) (bool, error) {
 	state := lib.GetState(ctx)
 	if state == nil {
 		return false, ErrMetricsAddInInitContext
 	}
 
-	tags := state.Options.RunTags.CloneTags()
+	tags := state.CloneTags()
 	if state.Options.SystemTags["group"] {
 		tags["group"] = state.Group.Path
 	}
 
-	for _, ts := range addTags {
-		for k, v := range ts {
-			tags[k] = v
-		}
+	rt := common.GetRuntime(ctx)
+	var multiTags map[string][]string
+	if len(args) > 0 {
+		multiTags = common.ParseTags(rt, args[0], tags)
+	}
+	var metadata map[string]string
+	if len(args) > 1 {
+		metadata = common.ParseMetadata(rt, args[1])
 	}
 
 	vfloat := v.ToFloat()
@@ -89,7 +121,10 @@ func (m Metric) Add(ctx context.Context, v goja.Value, addTags ...map[string]str
 		vfloat = 1.0
 	}
 
-	stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{Time: time.Now(), Metric: m.metric, Value: vfloat, Tags: stats.IntoSampleTags(&tags)})
+	stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+		Time: time.Now(), Metric: m.metric, Value: vfloat,
+		Tags: stats.IntoSampleTags(&tags).WithMultiTags(multiTags), Metadata: metadata,
+	})
 	return true, nil
 }
 
@@ -99,18 +134,18 @@ func New() *Metrics {
 	return &Metrics{}
 }
 
-func (*Metrics) XCounter(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Counter, isTime)
+func (*Metrics) XCounter(ctx *context.Context, name string, contains ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Counter, contains)
 }
 
-func (*Metrics) XGauge(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Gauge, isTime)
+func (*Metrics) XGauge(ctx *context.Context, name string, contains ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Gauge, contains)
 }
 
-func (*Metrics) XTrend(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Trend, isTime)
+func (*Metrics) XTrend(ctx *context.Context, name string, contains ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Trend, contains)
 }
 
-func (*Metrics) XRate(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Rate, isTime)
+func (*Metrics) XRate(ctx *context.Context, name string, contains ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Rate, contains)
 }
@@ -28,6 +28,7 @@ import (
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
+	k6metrics "github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,9 +55,17 @@ func TestMetrics(t *testing.T) {
 		fn, mtyp := fn, mtyp
 		t.Run(fn, func(t *testing.T) {
 			t.Parallel()
-			for isTime, valueType := range map[bool]stats.ValueType{false: stats.Default, true: stats.Time} {
-				isTime, valueType := isTime, valueType
-				t.Run(fmt.Sprintf("isTime=%v", isTime), func(t *testing.T) {
+			containsArgs := map[string]stats.ValueType{
+				``:            stats.Default,
+				`, false`:     stats.Default,
+				`, true`:      stats.Time,
+				`, "time"`:    stats.Time,
+				`, "data"`:    stats.Data,
+				`, "default"`: stats.Default,
+			}
+			for containsArg, valueType := range containsArgs {
+				containsArg, valueType := containsArg, valueType
+				t.Run(fmt.Sprintf("contains=%s", valueType), func(t *testing.T) {
 					t.Parallel()
 					rt := goja.New()
 					rt.SetFieldNameMapper(common.FieldNameMapper{})
@@ -74,12 +83,8 @@ func TestMetrics(t *testing.T) {
 						Samples: samples,
 					}
 
-					isTimeString := ""
-					if isTime {
-						isTimeString = `, true`
-					}
 					_, err := common.RunString(rt,
-						fmt.Sprintf(`let m = new metrics.%s("my_metric"%s)`, fn, isTimeString),
+						fmt.Sprintf(`let m = new metrics.%s("my_metric"%s)`, fn, containsArg),
 					)
 					if !assert.NoError(t, err) {
 						return
@@ -137,6 +142,34 @@ func TestMetrics(t *testing.T) {
 											assert.Equal(t, valueType, sample.Metric.Contains)
 										}
 									})
+									t.Run("MultiTags", func(t *testing.T) {
+										_, err := common.RunString(rt, fmt.Sprintf(`m.add(%v, {a:1, flags: ["y", "x"]})`, val.JS))
+										assert.NoError(t, err)
+										bufSamples := stats.GetBufferedSamples(samples)
+										if assert.Len(t, bufSamples, 1) {
+											sample, ok := bufSamples[0].(stats.Sample)
+											require.True(t, ok)
+
+											assert.Equal(t, map[string][]string{
+												"flags": {"x", "y"},
+											}, sample.Tags.CloneMultiTags())
+											a, _ := sample.Tags.Get("a")
+											assert.Equal(t, "1", a)
+										}
+									})
+									t.Run("Metadata", func(t *testing.T) {
+										_, err := common.RunString(rt, fmt.Sprintf(`m.add(%v, {a:1}, {trace_id: "abc"})`, val.JS))
+										assert.NoError(t, err)
+										bufSamples := stats.GetBufferedSamples(samples)
+										if assert.Len(t, bufSamples, 1) {
+											sample, ok := bufSamples[0].(stats.Sample)
+											require.True(t, ok)
+
+											assert.Equal(t, map[string]string{"trace_id": "abc"}, sample.Metadata)
+											_, ok = sample.Tags.Get("trace_id")
+											assert.False(t, ok)
+										}
+									})
 								})
 							}
 						})
@@ -168,3 +201,54 @@ func TestMetricNames(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricInvalidContains(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctxPtr := new(context.Context)
+	*ctxPtr = common.WithRuntime(context.Background(), rt)
+	rt.Set("metrics", common.Bind(rt, New(), ctxPtr))
+
+	_, err := common.RunString(rt, `new metrics.Trend("my_metric", "bytes")`)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Invalid metric value type: 'bytes', it must be 'default', 'time' or 'data'")
+	}
+}
+
+func TestMetricRegistry(t *testing.T) {
+	t.Parallel()
+	registry := k6metrics.NewRegistry()
+	newRuntime := func() *goja.Runtime {
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctxPtr := new(context.Context)
+		*ctxPtr = lib.WithMetricRegistry(common.WithRuntime(context.Background(), rt), registry)
+		rt.Set("metrics", common.Bind(rt, New(), ctxPtr))
+		return rt
+	}
+
+	rt1, rt2 := newRuntime(), newRuntime()
+	_, err := common.RunString(rt1, `var myTrend = new metrics.Trend("my_trend", true)`)
+	require.NoError(t, err)
+	_, err = common.RunString(rt2, `var myTrend = new metrics.Trend("my_trend", true)`)
+	require.NoError(t, err)
+	m := registry.Get("my_trend")
+	require.NotNil(t, m)
+	assert.Equal(t, stats.Time, m.Contains)
+
+	testdata := map[string]string{
+		`new metrics.Counter("my_trend")`:       "metric 'my_trend' is already registered as a \"trend\", it can't be a \"counter\"",
+		`new metrics.Trend("my_trend")`:         "metric 'my_trend' is already registered with \"time\" values, it can't have \"default\" values",
+		`new metrics.Rate("http_req_duration")`: "metric 'http_req_duration' is already registered as a \"trend\", it can't be a \"rate\"",
+		`new metrics.Gauge("vus")`:              "",
+	}
+	for script, errMsg := range testdata {
+		_, err := common.RunString(rt1, script)
+		if errMsg == "" {
+			assert.NoError(t, err, script)
+		} else if assert.Error(t, err, script) {
+			assert.Contains(t, err.Error(), errMsg)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package protobuf
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Encode encodes a value, as exported from JS, as the named message type.
+// Fields may be keyed by either their proto or their JSON name.
+func (s *Schema) Encode(name string, value map[string]interface{}) ([]byte, error) {
+	msg, err := s.message(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := proto.NewBuffer(nil)
+	if err := encodeMessage(buf, msg, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes data as the named message type. Fields are keyed by their
+// proto names; fields absent from the payload are absent from the result.
+func (s *Schema) Decode(name string, data []byte) (map[string]interface{}, error) {
+	msg, err := s.message(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMessage(msg, data)
+}
+
+func encodeMessage(buf *proto.Buffer, msg *Message, obj map[string]interface{}) error {
+	for _, field := range msg.Fields {
+		v, ok := obj[field.Name]
+		if !ok {
+			v, ok = obj[field.JSONName]
+		}
+		if !ok || v == nil {
+			continue
+		}
+
+		var err error
+		switch {
+		case field.isMap():
+			err = encodeMap(buf, field, v)
+		case field.Repeated:
+			err = encodeRepeated(buf, field, v)
+		default:
+			err = encodeValue(buf, field, v)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s.%s", msg.Name, field.Name)
+		}
+	}
+	return nil
+}
+
+func encodeMap(buf *proto.Buffer, field *Field, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("expected an object, got %T", v)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := encodeValue(buf, field, map[string]interface{}{"key": k, "value": m[k]}); err != nil {
+			return errors.Wrapf(err, "key %q", k)
+		}
+	}
+	return nil
+}
+
+func encodeRepeated(buf *proto.Buffer, field *Field, v interface{}) error {
+	items, ok := v.([]interface{})
+	if !ok {
+		return errors.Errorf("expected an array, got %T", v)
+	}
+	if !field.Packed {
+		for i, item := range items {
+			if err := encodeValue(buf, field, item); err != nil {
+				return errors.Wrapf(err, "index %d", i)
+			}
+		}
+		return nil
+	}
+
+	packed := proto.NewBuffer(nil)
+	for i, item := range items {
+		if err := encodeScalar(packed, field, item); err != nil {
+			return errors.Wrapf(err, "index %d", i)
+		}
+	}
+	_ = buf.EncodeVarint(uint64(field.Number)<<3 | wireBytes)
+	return buf.EncodeRawBytes(packed.Bytes())
+}
+
+func encodeValue(buf *proto.Buffer, field *Field, v interface{}) error {
+	if field.Type != typeMessage {
+		_ = buf.EncodeVarint(uint64(field.Number)<<3 | uint64(wireTypeOf(field.Type)))
+		return encodeScalar(buf, field, v)
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("expected an object, got %T", v)
+	}
+	sub := proto.NewBuffer(nil)
+	if err := encodeMessage(sub, field.message, obj); err != nil {
+		return err
+	}
+	_ = buf.EncodeVarint(uint64(field.Number)<<3 | wireBytes)
+	return buf.EncodeRawBytes(sub.Bytes())
+}
+
+// encodeScalar writes a non-message value, without its key.
+func encodeScalar(buf *proto.Buffer, field *Field, v interface{}) error {
+	switch field.Type {
+	case typeString:
+		s, ok := v.(string)
+		if !ok {
+			return errors.Errorf("expected a string, got %T", v)
+		}
+		return buf.EncodeStringBytes(s)
+	case typeBytes:
+		b, err := toBytes(v)
+		if err != nil {
+			return err
+		}
+		return buf.EncodeRawBytes(b)
+	case typeBool:
+		b, ok := v.(bool)
+		if s, isString := v.(string); isString {
+			// Map keys are always strings in JS
+			b, ok = s == "true", s == "true" || s == "false"
+		}
+		if !ok {
+			return errors.Errorf("expected a boolean, got %T", v)
+		}
+		if b {
+			return buf.EncodeVarint(1)
+		}
+		return buf.EncodeVarint(0)
+	case typeDouble:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		return buf.EncodeFixed64(math.Float64bits(f))
+	case typeFloat:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		return buf.EncodeFixed32(uint64(math.Float32bits(float32(f))))
+	case typeEnum:
+		if name, ok := v.(string); ok {
+			n, ok := field.enum.Values[name]
+			if !ok {
+				return errors.Errorf("unknown %s value %q", field.enum.Name, name)
+			}
+			return buf.EncodeVarint(uint64(int64(n)))
+		}
+	}
+
+	i, err := toInt(v)
+	if err != nil {
+		return err
+	}
+	switch field.Type {
+	case typeFixed64, typeSfixed64:
+		return buf.EncodeFixed64(i)
+	case typeFixed32, typeSfixed32:
+		return buf.EncodeFixed32(uint64(uint32(i)))
+	case typeSint32:
+		return buf.EncodeZigzag32(i)
+	case typeSint64:
+		return buf.EncodeZigzag64(i)
+	case typeInt32, typeEnum:
+		// Negative int32s are sign-extended to 64 bits on the wire
+		return buf.EncodeVarint(uint64(int64(int32(i))))
+	case typeUint32:
+		return buf.EncodeVarint(uint64(uint32(i)))
+	default:
+		return buf.EncodeVarint(i)
+	}
+}
+
+// toInt converts an integer to its two's complement representation. Strings
+// are accepted, since JS numbers can't represent every 64-bit integer.
+func toInt(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case int64:
+		return uint64(n), nil
+	case int:
+		return uint64(n), nil
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, errors.Errorf("expected an integer, got %v", n)
+		}
+		return uint64(int64(n)), nil
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return uint64(i), nil
+		}
+		u, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("expected an integer, got %q", n)
+		}
+		return u, nil
+	default:
+		return 0, errors.Errorf("expected an integer, got %T", v)
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, errors.Errorf("expected a number, got %q", n)
+		}
+		return f, nil
+	default:
+		return 0, errors.Errorf("expected a number, got %T", v)
+	}
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	case []interface{}:
+		out := make([]byte, len(b))
+		for i, item := range b {
+			n, err := toInt(item)
+			if err != nil || n > 255 {
+				return nil, errors.Errorf("index %d: expected a byte, got %v", i, item)
+			}
+			out[i] = byte(n)
+		}
+		return out, nil
+	default:
+		return nil, errors.Errorf("expected bytes, got %T", v)
+	}
+}
+
+func decodeMessage(msg *Message, data []byte) (map[string]interface{}, error) {
+	fields, err := parseWire(data)
+	if err != nil {
+		return nil, errors.Wrap(err, msg.Name)
+	}
+
+	obj := make(map[string]interface{})
+	for _, f := range fields {
+		field, ok := msg.byNumber[f.num]
+		if !ok {
+			continue
+		}
+		if err := decodeField(obj, field, f); err != nil {
+			return nil, errors.Wrapf(err, "%s.%s", msg.Name, field.Name)
+		}
+	}
+	return obj, nil
+}
+
+func decodeField(obj map[string]interface{}, field *Field, f wireField) error {
+	switch {
+	case field.isMap():
+		entry, err := decodeMessage(field.message, f.b)
+		if err != nil {
+			return err
+		}
+		m, _ := obj[field.Name].(map[string]interface{})
+		if m == nil {
+			m = make(map[string]interface{})
+			obj[field.Name] = m
+		}
+		// Zero keys and values are omitted from the entry on the wire
+		key, ok := entry["key"]
+		if !ok {
+			key = zeroValue(field.message.byNumber[1])
+		}
+		value, ok := entry["value"]
+		if !ok {
+			value = zeroValue(field.message.byNumber[2])
+		}
+		m[toKey(key)] = value
+		return nil
+	case field.Repeated:
+		items, _ := obj[field.Name].([]interface{})
+		if f.wire == wireBytes && field.packable() {
+			values, err := decodePacked(field, f.b)
+			if err != nil {
+				return err
+			}
+			obj[field.Name] = append(items, values...)
+			return nil
+		}
+		v, err := decodeValue(field, f)
+		if err != nil {
+			return err
+		}
+		obj[field.Name] = append(items, v)
+		return nil
+	default:
+		v, err := decodeValue(field, f)
+		if err != nil {
+			return err
+		}
+		obj[field.Name] = v
+		return nil
+	}
+}
+
+func decodePacked(field *Field, data []byte) ([]interface{}, error) {
+	var values []interface{}
+	wire := wireTypeOf(field.Type)
+	for len(data) > 0 {
+		f := wireField{wire: wire}
+		switch wire {
+		case wireVarint:
+			var n int
+			if f.x, n = proto.DecodeVarint(data); n == 0 {
+				return nil, errors.New("truncated packed varint")
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errors.New("truncated packed fixed64")
+			}
+			f.x, _ = proto.NewBuffer(data[:8]).DecodeFixed64()
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errors.New("truncated packed fixed32")
+			}
+			f.x, _ = proto.NewBuffer(data[:4]).DecodeFixed32()
+			data = data[4:]
+		}
+		v, err := decodeValue(field, f)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func decodeValue(field *Field, f wireField) (interface{}, error) {
+	if expected := wireTypeOf(field.Type); f.wire != expected {
+		return nil, errors.Errorf("wire type %d doesn't match field type, expected %d", f.wire, expected)
+	}
+
+	switch field.Type {
+	case typeMessage:
+		return decodeMessage(field.message, f.b)
+	case typeString:
+		return string(f.b), nil
+	case typeBytes:
+		return append([]byte{}, f.b...), nil
+	case typeBool:
+		return f.x != 0, nil
+	case typeDouble:
+		return math.Float64frombits(f.x), nil
+	case typeFloat:
+		return float64(math.Float32frombits(uint32(f.x))), nil
+	case typeEnum:
+		if name, ok := field.enum.byValue[int32(f.x)]; ok {
+			return name, nil
+		}
+		return int64(int32(f.x)), nil
+	case typeInt32, typeSfixed32:
+		return int64(int32(f.x)), nil
+	case typeUint32, typeFixed32:
+		return int64(uint32(f.x)), nil
+	case typeSint32:
+		return int64(int32(uint32(f.x)>>1) ^ -int32(f.x&1)), nil
+	case typeSint64:
+		return int64(f.x>>1) ^ -int64(f.x&1), nil
+	case typeUint64, typeFixed64:
+		return f.x, nil
+	default:
+		return int64(f.x), nil
+	}
+}
+
+func zeroValue(field *Field) interface{} {
+	if field == nil {
+		return nil
+	}
+	switch field.Type {
+	case typeMessage:
+		return map[string]interface{}{}
+	case typeString:
+		return ""
+	case typeBytes:
+		return []byte{}
+	case typeBool:
+		return false
+	case typeDouble, typeFloat:
+		return 0.0
+	case typeEnum:
+		if name, ok := field.enum.byValue[0]; ok {
+			return name
+		}
+	}
+	return int64(0)
+}
+
+func toKey(v interface{}) string {
+	switch k := v.(type) {
+	case string:
+		return k
+	case bool:
+		return strconv.FormatBool(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	default:
+		return ""
+	}
+}
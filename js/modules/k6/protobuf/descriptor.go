@@ -0,0 +1,396 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package protobuf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Wire types, as defined by the protobuf encoding spec.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field types and labels, as defined in google/protobuf/descriptor.proto.
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+
+	labelRepeated = 3
+)
+
+type wireField struct {
+	num  int32
+	wire int
+	x    uint64
+	b    []byte
+}
+
+// parseWire splits a serialized message into its raw fields.
+func parseWire(data []byte) ([]wireField, error) {
+	var fields []wireField
+	buf := proto.NewBuffer(data)
+	for i := 0; i < len(data); {
+		key, n := proto.DecodeVarint(data[i:])
+		if n == 0 {
+			return nil, errors.New("truncated field key")
+		}
+		i += n
+		f := wireField{num: int32(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.x, n = proto.DecodeVarint(data[i:])
+			if n == 0 {
+				return nil, errors.Errorf("truncated varint in field %d", f.num)
+			}
+		case wireFixed64:
+			if len(data[i:]) < 8 {
+				return nil, errors.Errorf("truncated fixed64 in field %d", f.num)
+			}
+			buf.SetBuf(data[i : i+8])
+			f.x, _ = buf.DecodeFixed64()
+			n = 8
+		case wireFixed32:
+			if len(data[i:]) < 4 {
+				return nil, errors.Errorf("truncated fixed32 in field %d", f.num)
+			}
+			buf.SetBuf(data[i : i+4])
+			f.x, _ = buf.DecodeFixed32()
+			n = 4
+		case wireBytes:
+			l, ln := proto.DecodeVarint(data[i:])
+			if ln == 0 || uint64(len(data[i+ln:])) < l {
+				return nil, errors.Errorf("truncated bytes in field %d", f.num)
+			}
+			f.b = data[i+ln : i+ln+int(l)]
+			n = ln + int(l)
+		default:
+			return nil, errors.Errorf("unsupported wire type %d in field %d", f.wire, f.num)
+		}
+		i += n
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// A Field describes a single field of a message type.
+type Field struct {
+	Name     string
+	JSONName string
+	Number   int32
+	Type     int
+	TypeName string
+	Repeated bool
+	Packed   bool
+
+	message *Message
+	enum    *Enum
+}
+
+// A Message describes a message type.
+type Message struct {
+	Name     string
+	Fields   []*Field
+	MapEntry bool
+
+	byNumber map[int32]*Field
+	byName   map[string]*Field
+}
+
+// An Enum describes an enum type.
+type Enum struct {
+	Name    string
+	Values  map[string]int32
+	byValue map[int32]string
+}
+
+func (f *Field) isMap() bool {
+	return f.Repeated && f.message != nil && f.message.MapEntry
+}
+
+// packable reports whether the field's values may use the packed encoding.
+func (f *Field) packable() bool {
+	return f.Repeated && wireTypeOf(f.Type) != wireBytes
+}
+
+func wireTypeOf(typ int) int {
+	switch typ {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	default:
+		return wireVarint
+	}
+}
+
+// A Schema is a set of message and enum types, loaded from a serialized
+// google.protobuf.FileDescriptorSet, as produced by:
+//
+//	protoc --include_imports --descriptor_set_out=schema.pb *.proto
+type Schema struct {
+	messages map[string]*Message
+	enums    map[string]*Enum
+}
+
+// ParseSchema parses a serialized FileDescriptorSet.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := &Schema{messages: make(map[string]*Message), enums: make(map[string]*Enum)}
+
+	files, err := parseWire(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid descriptor set")
+	}
+	for _, file := range files {
+		if file.num != 1 || file.wire != wireBytes {
+			continue
+		}
+		if err := s.parseFile(file.b); err != nil {
+			return nil, errors.Wrap(err, "invalid file descriptor")
+		}
+	}
+	if len(s.messages) == 0 {
+		return nil, errors.New("descriptor set contains no message types")
+	}
+	return s, s.link()
+}
+
+func (s *Schema) parseFile(data []byte) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+
+	var pkg string
+	proto3 := false
+	for _, f := range fields {
+		switch f.num {
+		case 2:
+			pkg = string(f.b)
+		case 12:
+			proto3 = string(f.b) == "proto3"
+		}
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 4:
+			err = s.parseMessage(pkg, proto3, f.b)
+		case 5:
+			err = s.parseEnum(pkg, f.b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) parseMessage(scope string, proto3 bool, data []byte) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+
+	msg := &Message{byNumber: make(map[int32]*Field), byName: make(map[string]*Field)}
+	for _, f := range fields {
+		if f.num == 1 {
+			msg.Name = qualify(scope, string(f.b))
+		}
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 2:
+			var field *Field
+			if field, err = parseField(proto3, f.b); err != nil {
+				return err
+			}
+			msg.Fields = append(msg.Fields, field)
+			msg.byNumber[field.Number] = field
+			msg.byName[field.Name] = field
+			msg.byName[field.JSONName] = field
+		case 3:
+			err = s.parseMessage(msg.Name, proto3, f.b)
+		case 4:
+			err = s.parseEnum(msg.Name, f.b)
+		case 7:
+			msg.MapEntry, _, err = parseBoolOption(f.b, 7)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(msg.Fields, func(i, j int) bool { return msg.Fields[i].Number < msg.Fields[j].Number })
+	s.messages[msg.Name] = msg
+	return nil
+}
+
+func parseField(proto3 bool, data []byte) (*Field, error) {
+	fields, err := parseWire(data)
+	if err != nil {
+		return nil, err
+	}
+
+	field := &Field{}
+	explicitPacked := false
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			field.Name = string(f.b)
+		case 3:
+			field.Number = int32(f.x)
+		case 4:
+			field.Repeated = f.x == labelRepeated
+		case 5:
+			field.Type = int(f.x)
+		case 6:
+			field.TypeName = strings.TrimPrefix(string(f.b), ".")
+		case 8:
+			if field.Packed, explicitPacked, err = parseBoolOption(f.b, 2); err != nil {
+				return nil, err
+			}
+		case 10:
+			field.JSONName = string(f.b)
+		}
+	}
+	if field.Type == typeGroup {
+		return nil, errors.Errorf("field %s: groups are not supported", field.Name)
+	}
+	if field.JSONName == "" {
+		field.JSONName = field.Name
+	}
+	// Repeated scalars are packed by default in proto3
+	if proto3 && !explicitPacked {
+		field.Packed = true
+	}
+	field.Packed = field.Packed && field.packable()
+	return field, nil
+}
+
+func (s *Schema) parseEnum(scope string, data []byte) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+
+	enum := &Enum{Values: make(map[string]int32), byValue: make(map[int32]string)}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			enum.Name = qualify(scope, string(f.b))
+		case 2:
+			var name string
+			var number int32
+			var values []wireField
+			if values, err = parseWire(f.b); err != nil {
+				return err
+			}
+			for _, v := range values {
+				switch v.num {
+				case 1:
+					name = string(v.b)
+				case 2:
+					number = int32(v.x)
+				}
+			}
+			enum.Values[name] = number
+			if _, ok := enum.byValue[number]; !ok {
+				enum.byValue[number] = name
+			}
+		}
+	}
+	s.enums[enum.Name] = enum
+	return nil
+}
+
+// link resolves the message and enum types referenced by fields.
+func (s *Schema) link() error {
+	for _, msg := range s.messages {
+		for _, field := range msg.Fields {
+			switch field.Type {
+			case typeMessage:
+				if field.message = s.messages[field.TypeName]; field.message == nil {
+					return errors.Errorf("%s.%s: unknown message type %s", msg.Name, field.Name, field.TypeName)
+				}
+			case typeEnum:
+				if field.enum = s.enums[field.TypeName]; field.enum == nil {
+					return errors.Errorf("%s.%s: unknown enum type %s", msg.Name, field.Name, field.TypeName)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) message(name string) (*Message, error) {
+	msg, ok := s.messages[strings.TrimPrefix(name, ".")]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %s", name)
+	}
+	return msg, nil
+}
+
+// parseBoolOption returns the value of a bool field in an options message,
+// and whether it was set at all.
+func parseBoolOption(data []byte, num int32) (value, set bool, err error) {
+	fields, err := parseWire(data)
+	if err != nil {
+		return false, false, err
+	}
+	for _, f := range fields {
+		if f.num == num && f.wire == wireVarint {
+			value, set = f.x != 0, true
+		}
+	}
+	return value, set, nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
@@ -0,0 +1,35 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package protobuf
+
+// Protobuf encodes and decodes raw protobuf payloads, without any generated
+// code, using message types from a descriptor set loaded at runtime.
+type Protobuf struct{}
+
+func New() *Protobuf {
+	return &Protobuf{}
+}
+
+// Load parses a serialized FileDescriptorSet, usually open()ed in the init
+// context, into a schema that can encode and decode its messages.
+func (*Protobuf) Load(data []byte) (*Schema, error) {
+	return ParseSchema(data)
+}
@@ -0,0 +1,234 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package protobuf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/golang/protobuf/proto"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helpers to hand-assemble a FileDescriptorSet, since there's no protoc here.
+func pbBytes(num int, parts ...[]byte) []byte {
+	var data []byte
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+	buf := proto.NewBuffer(nil)
+	_ = buf.EncodeVarint(uint64(num)<<3 | wireBytes)
+	_ = buf.EncodeRawBytes(data)
+	return buf.Bytes()
+}
+
+func pbString(num int, s string) []byte {
+	return pbBytes(num, []byte(s))
+}
+
+func pbVarint(num int, x uint64) []byte {
+	buf := proto.NewBuffer(nil)
+	_ = buf.EncodeVarint(uint64(num)<<3 | wireVarint)
+	_ = buf.EncodeVarint(x)
+	return buf.Bytes()
+}
+
+func pbField(name string, number, label, typ int, extra ...[]byte) []byte {
+	parts := [][]byte{pbString(1, name), pbVarint(3, uint64(number)), pbVarint(4, uint64(label)), pbVarint(5, uint64(typ))}
+	return pbBytes(2, append(parts, extra...)...)
+}
+
+// testSchema is the equivalent of:
+//
+//	syntax = "proto3";
+//	package test;
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Inner { string name = 1; }
+//	message Outer {
+//	  int32 id = 1;
+//	  string title = 2;
+//	  repeated int64 values = 3;
+//	  Inner inner = 4;
+//	  Color color = 5;
+//	  map<string, int32> counts = 6;
+//	  bytes data = 7;
+//	  sint32 delta = 8;
+//	  double ratio = 9;
+//	  repeated Inner items = 10;
+//	  int32 json_field = 11;
+//	}
+func testSchema() []byte {
+	const opt, rep = 1, labelRepeated
+	return pbBytes(1,
+		pbString(1, "test.proto"),
+		pbString(2, "test"),
+		pbString(12, "proto3"),
+		pbBytes(5, pbString(1, "Color"),
+			pbBytes(2, pbString(1, "RED"), pbVarint(2, 0)),
+			pbBytes(2, pbString(1, "GREEN"), pbVarint(2, 1)),
+		),
+		pbBytes(4, pbString(1, "Inner"),
+			pbField("name", 1, opt, typeString, pbString(10, "name")),
+		),
+		pbBytes(4, pbString(1, "Outer"),
+			pbField("id", 1, opt, typeInt32),
+			pbField("title", 2, opt, typeString),
+			pbField("values", 3, rep, typeInt64),
+			pbField("inner", 4, opt, typeMessage, pbString(6, ".test.Inner")),
+			pbField("color", 5, opt, typeEnum, pbString(6, ".test.Color")),
+			pbField("counts", 6, rep, typeMessage, pbString(6, ".test.Outer.CountsEntry")),
+			pbField("data", 7, opt, typeBytes),
+			pbField("delta", 8, opt, typeSint32),
+			pbField("ratio", 9, opt, typeDouble),
+			pbField("items", 10, rep, typeMessage, pbString(6, ".test.Inner")),
+			pbField("json_field", 11, opt, typeInt32, pbString(10, "jsonField")),
+			pbBytes(3, pbString(1, "CountsEntry"),
+				pbField("key", 1, opt, typeString),
+				pbField("value", 2, opt, typeInt32),
+				pbBytes(7, pbVarint(7, 1)),
+			),
+		),
+	)
+}
+
+// Structs in the style of protoc-gen-go, to check the wire format against the
+// reference implementation.
+type innerPB struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3"`
+}
+
+func (m *innerPB) Reset()         { *m = innerPB{} }
+func (m *innerPB) String() string { return proto.CompactTextString(m) }
+func (*innerPB) ProtoMessage()    {}
+
+type outerPB struct {
+	Id        int32            `protobuf:"varint,1,opt,name=id,proto3"`
+	Title     string           `protobuf:"bytes,2,opt,name=title,proto3"`
+	Values    []int64          `protobuf:"varint,3,rep,packed,name=values,proto3"`
+	Inner     *innerPB         `protobuf:"bytes,4,opt,name=inner,proto3"`
+	Color     int32            `protobuf:"varint,5,opt,name=color,proto3"`
+	Counts    map[string]int32 `protobuf:"bytes,6,rep,name=counts,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	Data      []byte           `protobuf:"bytes,7,opt,name=data,proto3"`
+	Delta     int32            `protobuf:"zigzag32,8,opt,name=delta,proto3"`
+	Ratio     float64          `protobuf:"fixed64,9,opt,name=ratio,proto3"`
+	Items     []*innerPB       `protobuf:"bytes,10,rep,name=items,proto3"`
+	JsonField int32            `protobuf:"varint,11,opt,name=json_field,json=jsonField,proto3"`
+}
+
+func (m *outerPB) Reset()         { *m = outerPB{} }
+func (m *outerPB) String() string { return proto.CompactTextString(m) }
+func (*outerPB) ProtoMessage()    {}
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema(testSchema())
+	require.NoError(t, err)
+
+	ref := &outerPB{
+		Id:        -42,
+		Title:     "hello",
+		Values:    []int64{1, 300, -1},
+		Inner:     &innerPB{Name: "inner"},
+		Color:     1,
+		Counts:    map[string]int32{"a": 1, "b": 0},
+		Data:      []byte{0, 1, 255},
+		Delta:     -3,
+		Ratio:     0.5,
+		Items:     []*innerPB{{Name: "x"}, {Name: "y"}},
+		JsonField: 7,
+	}
+	refData, err := proto.Marshal(ref)
+	require.NoError(t, err)
+
+	t.Run("Encode", func(t *testing.T) {
+		data, err := schema.Encode("test.Outer", map[string]interface{}{
+			"id":        int64(-42),
+			"title":     "hello",
+			"values":    []interface{}{int64(1), "300", int64(-1)},
+			"inner":     map[string]interface{}{"name": "inner"},
+			"color":     "GREEN",
+			"counts":    map[string]interface{}{"a": int64(1), "b": int64(0)},
+			"data":      []interface{}{int64(0), int64(1), int64(255)},
+			"delta":     int64(-3),
+			"ratio":     0.5,
+			"items":     []interface{}{map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "y"}},
+			"jsonField": int64(7),
+		})
+		require.NoError(t, err)
+
+		var decoded outerPB
+		require.NoError(t, proto.Unmarshal(data, &decoded))
+		assert.Equal(t, ref, &decoded)
+	})
+	t.Run("Decode", func(t *testing.T) {
+		obj, err := schema.Decode(".test.Outer", refData)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"id":         int64(-42),
+			"title":      "hello",
+			"values":     []interface{}{int64(1), int64(300), int64(-1)},
+			"inner":      map[string]interface{}{"name": "inner"},
+			"color":      "GREEN",
+			"counts":     map[string]interface{}{"a": int64(1), "b": int64(0)},
+			"data":       []byte{0, 1, 255},
+			"delta":      int64(-3),
+			"ratio":      0.5,
+			"items":      []interface{}{map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "y"}},
+			"json_field": int64(7),
+		}, obj)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := schema.Encode("test.Missing", nil)
+		assert.EqualError(t, err, "unknown message type test.Missing")
+		_, err = schema.Encode("test.Outer", map[string]interface{}{"color": "BLUE"})
+		assert.EqualError(t, err, `test.Outer.color: unknown test.Color value "BLUE"`)
+		_, err = schema.Encode("test.Outer", map[string]interface{}{"values": int64(1)})
+		assert.EqualError(t, err, "test.Outer.values: expected an array, got int64")
+		_, err = schema.Decode("test.Outer", []byte{0x0a, 0x05})
+		assert.EqualError(t, err, "test.Outer: truncated bytes in field 1")
+		_, err = schema.Decode("test.Outer", []byte{0x08, 0x01, 0x0b})
+		assert.EqualError(t, err, "test.Outer: unsupported wire type 3 in field 1")
+		_, err = ParseSchema([]byte{})
+		assert.EqualError(t, err, "descriptor set contains no message types")
+	})
+}
+
+func TestProtobufModule(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("protobuf", common.Bind(rt, New(), &ctx))
+	rt.Set("descriptors", testSchema())
+
+	_, err := common.RunString(rt, `
+	const schema = protobuf.load(descriptors);
+	let data = schema.encode("test.Outer", { id: 1, title: "hi", values: [2, 3], inner: { name: "n" } });
+	let msg = schema.decode("test.Outer", data);
+	if (msg.id !== 1 || msg.title !== "hi" || msg.inner.name !== "n" || msg.values.length !== 2 || "color" in msg) {
+		throw new Error("unexpected message: " + JSON.stringify(msg));
+	}`)
+	assert.NoError(t, err)
+
+	_, err = common.RunString(rt, `protobuf.load(descriptors).encode("test.Outer", { id: "x" })`)
+	assert.Contains(t, err.Error(), `test.Outer.id: expected an integer, got "x"`)
+}
@@ -0,0 +1,51 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+
+	"github.com/loadimpact/k6/lib/secrets"
+	"github.com/pkg/errors"
+)
+
+// Secrets is the k6/secrets module, which gives scripts access to the secrets that are
+// resolved by k6 at run time, without storing them in the scripts or the archives.
+type Secrets struct{}
+
+// New returns a new k6/secrets module.
+func New() *Secrets {
+	return &Secrets{}
+}
+
+// Get returns the secret with the given key, from the optional source or from the default
+// one, which is set with --secret-source.
+func (*Secrets) Get(ctx context.Context, key string, source ...string) (string, error) {
+	store := secrets.GetStore(ctx)
+	if store == nil {
+		return "", errors.New("secrets aren't available in this context")
+	}
+	var src string
+	if len(source) > 0 {
+		src = source[0]
+	}
+	return store.Get(key, src)
+}
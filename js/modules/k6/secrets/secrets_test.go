@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	secrets.RegisterSource("jstest", secrets.SourceFunc(func(key string) (string, error) {
+		return "secret-" + key, nil
+	}))
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("secrets", common.Bind(rt, New(), &ctx))
+
+	t.Run("NoStore", func(t *testing.T) {
+		_, err := common.RunString(rt, `secrets.get("db-password")`)
+		assert.Contains(t, err.Error(), "secrets aren't available in this context")
+	})
+
+	ctx = secrets.WithStore(ctx, secrets.NewStore("jstest"))
+	t.Run("DefaultSource", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let value = secrets.get("db-password");
+		if (value !== "secret-db-password") {
+			throw new Error("Unexpected secret: " + value);
+		}`)
+		assert.NoError(t, err)
+	})
+	t.Run("Source", func(t *testing.T) {
+		_, err := common.RunString(rt, `secrets.get("db-password", "nope")`)
+		assert.Contains(t, err.Error(), "unknown secret source 'nope'")
+	})
+}
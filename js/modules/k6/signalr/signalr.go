@@ -0,0 +1,614 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signalr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// ErrSignalRInInitContext is returned when SignalR connections are made in the init context.
+var ErrSignalRInInitContext = common.NewInitContextError("using SignalR in the init context is not supported")
+
+// The hub protocol message types, see
+// https://github.com/dotnet/aspnetcore/blob/master/src/SignalR/docs/specs/HubProtocol.md
+const (
+	messageInvocation = 1
+	messageStreamItem = 2
+	messageCompletion = 3
+	messagePing       = 6
+	messageClose      = 7
+)
+
+// Every message of the JSON hub protocol ends with this record separator.
+const recordSeparator = '\x1e'
+
+const (
+	transportWebSockets       = "WebSockets"
+	transportServerSentEvents = "ServerSentEvents"
+)
+
+const (
+	// The clients and the servers ping each other at this interval by default...
+	keepAliveInterval = 15 * time.Second
+	// ...and the connection is considered to be lost if nothing is received for this long.
+	serverTimeout = 30 * time.Second
+)
+
+// SignalR is a client for ASP.NET Core SignalR hubs, with the JSON hub protocol over WebSockets
+// or, if the server doesn't support them, Server-Sent Events.
+type SignalR struct{}
+
+func New() *SignalR {
+	return &SignalR{}
+}
+
+// Result describes the connection that was made by signalr.connect().
+type Result struct {
+	URL          string `js:"url"`
+	Transport    string `js:"transport"`
+	ConnectionID string `js:"connectionId"`
+}
+
+// Connection is a connection to a hub.
+type Connection struct {
+	ctx       context.Context
+	transport transport
+	tags      map[string]string
+
+	handlers          map[string][]goja.Callable
+	invocations       map[string]invocation
+	invocationCounter int
+	timings           []invocationTiming
+
+	handshakeDone bool
+	lastReceived  time.Time
+
+	scheduled chan goja.Callable
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type invocation struct {
+	target   string
+	callback goja.Callable
+	start    time.Time
+}
+
+type invocationTiming struct {
+	target     string
+	start, end time.Time
+}
+
+type hubMessage struct {
+	Type         int               `json:"type"`
+	InvocationID string            `json:"invocationId,omitempty"`
+	Target       string            `json:"target,omitempty"`
+	Arguments    []json.RawMessage `json:"arguments,omitempty"`
+	Result       json.RawMessage   `json:"result,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+type negotiation struct {
+	URL                 string `json:"url"`
+	AccessToken         string `json:"accessToken"`
+	ConnectionID        string `json:"connectionId"`
+	ConnectionToken     string `json:"connectionToken"`
+	NegotiateVersion    int    `json:"negotiateVersion"`
+	Error               string `json:"error"`
+	AvailableTransports []struct {
+		Transport       string   `json:"transport"`
+		TransferFormats []string `json:"transferFormats"`
+	} `json:"availableTransports"`
+}
+
+type connectParams struct {
+	header    http.Header
+	transport string
+	tags      map[string]string
+}
+
+// Connect negotiates a connection with the hub at the given URL and calls the function with it.
+// It returns once the connection is closed.
+func (s *SignalR) Connect(ctx context.Context, url string, args ...goja.Value) (*Result, error) {
+	rt := common.GetRuntime(ctx)
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil, ErrSignalRInInitContext
+	}
+
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV = args[0]
+		callableV = args[1]
+	case 1:
+		paramsV = goja.Undefined()
+		callableV = args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to signalr.connect")
+	}
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to signalr.connect must be a function")
+	}
+
+	params, err := parseConnectParams(rt, state, paramsV)
+	if err != nil {
+		return nil, err
+	}
+	if state.Options.SystemTags["url"] {
+		params.tags["url"] = url
+	}
+	if state.Options.SystemTags["group"] {
+		params.tags["group"] = state.Group.Path
+	}
+
+	hubURL, nego, err := negotiate(ctx, state, url, params.header)
+	if err != nil {
+		return nil, err
+	}
+	transportName, err := pickTransport(nego, params.transport)
+	if err != nil {
+		return nil, err
+	}
+
+	connURL, err := neturl.Parse(hubURL)
+	if err != nil {
+		return nil, err
+	}
+	query := connURL.Query()
+	if nego.NegotiateVersion >= 1 && nego.ConnectionToken != "" {
+		query.Set("id", nego.ConnectionToken)
+	} else {
+		query.Set("id", nego.ConnectionID)
+	}
+	connURL.RawQuery = query.Encode()
+
+	var t transport
+	if transportName == transportWebSockets {
+		t, err = dialWebSocket(ctx, state, connURL, params.header)
+	} else {
+		t, err = openServerSentEvents(ctx, state, connURL, params.header)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &Connection{
+		ctx:          ctx,
+		transport:    t,
+		tags:         params.tags,
+		handlers:     make(map[string][]goja.Callable),
+		invocations:  make(map[string]invocation),
+		lastReceived: time.Now(),
+		scheduled:    make(chan goja.Callable),
+		done:         make(chan struct{}),
+	}
+	defer func() { _ = t.close() }()
+
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(conn)); err != nil {
+		return nil, err
+	}
+	if err := t.send([]byte(`{"protocol":"json","version":1}` + string(recordSeparator))); err != nil {
+		return nil, err
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case data := <-t.received():
+			conn.lastReceived = time.Now()
+			for _, record := range bytes.Split(data, []byte{recordSeparator}) {
+				if len(record) > 0 {
+					conn.handleRecord(record)
+				}
+			}
+
+		case err := <-t.errors():
+			conn.handleEvent("error", rt.ToValue(err))
+			conn.closeConnection(false)
+
+		case <-t.closed():
+			conn.closeConnection(false)
+
+		case scheduledFn := <-conn.scheduled:
+			if _, err := scheduledFn(goja.Undefined()); err != nil {
+				return nil, err
+			}
+
+		case <-keepAlive.C:
+			if time.Since(conn.lastReceived) > serverTimeout {
+				conn.handleEvent("error", rt.ToValue(errors.New("the SignalR server didn't respond in time")))
+				conn.closeConnection(false)
+				continue
+			}
+			conn.sendMessage(hubMessage{Type: messagePing})
+
+		case <-ctx.Done():
+			conn.closeConnection(true)
+
+		case <-conn.done:
+			for _, timing := range conn.timings {
+				tags := make(map[string]string, len(conn.tags)+1)
+				for k, v := range conn.tags {
+					tags[k] = v
+				}
+				tags["target"] = timing.target
+				stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+					Metric: metrics.SignalRInvocationDuration,
+					Time:   timing.end,
+					Tags:   stats.IntoSampleTags(&tags),
+					Value:  stats.D(timing.end.Sub(timing.start)),
+				})
+			}
+			return &Result{URL: hubURL, Transport: transportName, ConnectionID: nego.ConnectionID}, nil
+		}
+	}
+}
+
+func parseConnectParams(rt *goja.Runtime, state *lib.State, paramsV goja.Value) (connectParams, error) {
+	params := connectParams{header: http.Header{}, tags: state.CloneTags()}
+	if goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return params, nil
+	}
+	obj := paramsV.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			continue
+		}
+		switch k {
+		case "headers":
+			headers := v.ToObject(rt)
+			for _, key := range headers.Keys() {
+				params.header.Set(key, headers.Get(key).String())
+			}
+		case "transport":
+			switch strings.ToLower(v.String()) {
+			case "websockets":
+				params.transport = transportWebSockets
+			case "serversentevents":
+				params.transport = transportServerSentEvents
+			default:
+				return params, fmt.Errorf("unsupported signalr.connect transport '%s', only '%s' and '%s' are supported",
+					v.String(), transportWebSockets, transportServerSentEvents)
+			}
+		case "tags":
+			tags := v.ToObject(rt)
+			for _, key := range tags.Keys() {
+				params.tags[key] = tags.Get(key).String()
+			}
+		}
+	}
+	return params, nil
+}
+
+// negotiate makes the negotiate request, following the redirects to other servers, and returns
+// the hub URL that the connection has to be made to.
+func negotiate(ctx context.Context, state *lib.State, url string, header http.Header) (string, *negotiation, error) {
+	for redirects := 0; redirects < 10; redirects++ {
+		negotiateURL, err := neturl.Parse(url)
+		if err != nil {
+			return "", nil, err
+		}
+		negotiateURL.Path = strings.TrimSuffix(negotiateURL.Path, "/") + "/negotiate"
+		query := negotiateURL.Query()
+		query.Set("negotiateVersion", "1")
+		negotiateURL.RawQuery = query.Encode()
+
+		req, err := http.NewRequest("POST", negotiateURL.String(), nil)
+		if err != nil {
+			return "", nil, err
+		}
+		req = req.WithContext(ctx)
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		res, err := (&http.Client{Transport: state.Transport}).Do(req)
+		if err != nil {
+			return "", nil, fmt.Errorf("SignalR negotiation failed: %s", err)
+		}
+		var nego negotiation
+		err = json.NewDecoder(res.Body).Decode(&nego)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", nil, fmt.Errorf("SignalR negotiation failed with status %s", res.Status)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid SignalR negotiation response: %s", err)
+		}
+		if nego.Error != "" {
+			return "", nil, fmt.Errorf("SignalR negotiation failed: %s", nego.Error)
+		}
+		if nego.URL == "" {
+			return url, &nego, nil
+		}
+
+		url = nego.URL
+		if nego.AccessToken != "" {
+			header = cloneHeader(header)
+			header.Set("Authorization", "Bearer "+nego.AccessToken)
+		}
+	}
+	return "", nil, errors.New("SignalR negotiation failed: too many redirects")
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, vs := range header {
+		clone[k] = append([]string(nil), vs...)
+	}
+	return clone
+}
+
+// pickTransport returns the preferred transport, or the first of the supported ones that the
+// server offers with the text transfer format, WebSockets before Server-Sent Events.
+func pickTransport(nego *negotiation, preferred string) (string, error) {
+	offered := make(map[string]bool)
+	for _, t := range nego.AvailableTransports {
+		for _, format := range t.TransferFormats {
+			if format == "Text" {
+				offered[t.Transport] = true
+			}
+		}
+	}
+	candidates := []string{transportWebSockets, transportServerSentEvents}
+	if preferred != "" {
+		candidates = []string{preferred}
+	}
+	for _, candidate := range candidates {
+		if offered[candidate] {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("the SignalR server doesn't offer any of the supported transports")
+}
+
+func (c *Connection) handleRecord(record []byte) {
+	rt := common.GetRuntime(c.ctx)
+	if !c.handshakeDone {
+		c.handshakeDone = true
+		var handshake struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(record, &handshake); err != nil || handshake.Error != "" {
+			if err == nil {
+				err = errors.New(handshake.Error)
+			}
+			c.handleEvent("error", rt.ToValue(fmt.Errorf("SignalR handshake failed: %s", err)))
+			c.closeConnection(false)
+			return
+		}
+		c.handleEvent("open")
+		return
+	}
+
+	var msg hubMessage
+	if err := json.Unmarshal(record, &msg); err != nil {
+		c.handleEvent("error", rt.ToValue(fmt.Errorf("invalid SignalR message: %s", err)))
+		return
+	}
+	switch msg.Type {
+	case messageInvocation:
+		args, err := decodeArgs(rt, msg.Arguments)
+		if err != nil {
+			c.handleEvent("error", rt.ToValue(fmt.Errorf("invalid arguments for '%s': %s", msg.Target, err)))
+			return
+		}
+		result := c.handleEvent(msg.Target, args...)
+		if msg.InvocationID != "" {
+			// The server expects a result from the client
+			data, err := json.Marshal(result.Export())
+			if err != nil {
+				c.sendMessage(hubMessage{Type: messageCompletion, InvocationID: msg.InvocationID, Error: err.Error()})
+				return
+			}
+			c.sendMessage(hubMessage{Type: messageCompletion, InvocationID: msg.InvocationID, Result: data})
+		}
+
+	case messageCompletion:
+		inv, ok := c.invocations[msg.InvocationID]
+		if !ok {
+			return
+		}
+		delete(c.invocations, msg.InvocationID)
+		c.timings = append(c.timings, invocationTiming{target: inv.target, start: inv.start, end: time.Now()})
+		if msg.Error != "" {
+			c.handleEvent("error", rt.ToValue(fmt.Errorf("invocation of '%s' failed: %s", inv.target, msg.Error)))
+			return
+		}
+		if inv.callback == nil {
+			return
+		}
+		result := goja.Undefined()
+		if len(msg.Result) > 0 {
+			args, err := decodeArgs(rt, []json.RawMessage{msg.Result})
+			if err != nil {
+				c.handleEvent("error", rt.ToValue(fmt.Errorf("invalid result of '%s': %s", inv.target, err)))
+				return
+			}
+			result = args[0]
+		}
+		if _, err := inv.callback(goja.Undefined(), result); err != nil {
+			common.Throw(rt, err)
+		}
+
+	case messageClose:
+		if msg.Error != "" {
+			c.handleEvent("error", rt.ToValue(fmt.Errorf("the SignalR server closed the connection: %s", msg.Error)))
+		}
+		c.closeConnection(false)
+
+	case messagePing, messageStreamItem:
+		// Streaming isn't supported, and pings only keep the connection alive
+	}
+}
+
+func decodeArgs(rt *goja.Runtime, raw []json.RawMessage) ([]goja.Value, error) {
+	args := make([]goja.Value, len(raw))
+	for i, data := range raw {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		args[i] = rt.ToValue(v)
+	}
+	return args, nil
+}
+
+func encodeArgs(args []goja.Value) ([]json.RawMessage, error) {
+	raw := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		data, err := json.Marshal(arg.Export())
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = data
+	}
+	return raw, nil
+}
+
+func (c *Connection) sendMessage(msg hubMessage) {
+	data, err := json.Marshal(msg)
+	if err == nil {
+		err = c.transport.send(append(data, recordSeparator))
+	}
+	if err != nil {
+		c.handleEvent("error", common.GetRuntime(c.ctx).ToValue(err))
+	}
+}
+
+// handleEvent calls the handlers for the event and returns the result of the last one.
+func (c *Connection) handleEvent(event string, args ...goja.Value) goja.Value {
+	result := goja.Undefined()
+	for _, handler := range c.handlers[event] {
+		var err error
+		if result, err = handler(goja.Undefined(), args...); err != nil {
+			common.Throw(common.GetRuntime(c.ctx), err)
+		}
+	}
+	return result
+}
+
+// On registers a handler for the invocations of a client method by the hub, or for the "open",
+// "error" and "close" events of the connection.
+func (c *Connection) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		c.handlers[event] = append(c.handlers[event], handler)
+	}
+}
+
+// Invoke invokes a hub method with the given arguments. If the last argument is a function, it's
+// called with the result once the invocation completes. The time until then is measured in the
+// signalr_invocation_duration metric.
+func (c *Connection) Invoke(target string, args ...goja.Value) {
+	var callback goja.Callable
+	if n := len(args); n > 0 {
+		if fn, ok := goja.AssertFunction(args[n-1]); ok {
+			callback, args = fn, args[:n-1]
+		}
+	}
+	arguments, err := encodeArgs(args)
+	if err != nil {
+		common.Throw(common.GetRuntime(c.ctx), err)
+	}
+
+	c.invocationCounter++
+	id := fmt.Sprintf("%d", c.invocationCounter)
+	c.invocations[id] = invocation{target: target, callback: callback, start: time.Now()}
+	c.sendMessage(hubMessage{Type: messageInvocation, InvocationID: id, Target: target, Arguments: arguments})
+}
+
+// Send invokes a hub method without waiting for it to complete.
+func (c *Connection) Send(target string, args ...goja.Value) {
+	arguments, err := encodeArgs(args)
+	if err != nil {
+		common.Throw(common.GetRuntime(c.ctx), err)
+	}
+	c.sendMessage(hubMessage{Type: messageInvocation, Target: target, Arguments: arguments})
+}
+
+// SetTimeout calls the function after the given number of milliseconds.
+func (c *Connection) SetTimeout(fn goja.Callable, timeoutMs int) {
+	go func() {
+		select {
+		case <-time.After(time.Duration(timeoutMs) * time.Millisecond):
+			select {
+			case c.scheduled <- fn:
+			case <-c.done:
+			}
+		case <-c.done:
+		}
+	}()
+}
+
+// SetInterval calls the function every given number of milliseconds.
+func (c *Connection) SetInterval(fn goja.Callable, intervalMs int) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case c.scheduled <- fn:
+				case <-c.done:
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close closes the connection.
+func (c *Connection) Close() {
+	c.closeConnection(true)
+}
+
+func (c *Connection) closeConnection(notifyServer bool) {
+	c.closeOnce.Do(func() {
+		if notifyServer {
+			data, _ := json.Marshal(hubMessage{Type: messageClose})
+			_ = c.transport.send(append(data, recordSeparator))
+		}
+		_ = c.transport.close()
+		c.handleEvent("close")
+		close(c.done)
+	})
+}
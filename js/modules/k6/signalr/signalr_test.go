@@ -0,0 +1,272 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signalr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHub answers the hub protocol messages of a client, the same way for all transports.
+func testHub(t *testing.T, record []byte, send func(msg interface{})) {
+	if bytes.HasPrefix(record, []byte(`{"protocol"`)) {
+		assert.JSONEq(t, `{"protocol":"json","version":1}`, string(record))
+		send(map[string]interface{}{})
+		send(map[string]interface{}{
+			"type": messageInvocation, "invocationId": "s1", "target": "GetName", "arguments": []interface{}{},
+		})
+		return
+	}
+	var msg hubMessage
+	require.NoError(t, json.Unmarshal(record, &msg))
+	switch {
+	case msg.Type == messageInvocation && msg.Target == "Echo":
+		time.Sleep(10 * time.Millisecond)
+		send(hubMessage{Type: messageCompletion, InvocationID: msg.InvocationID, Result: msg.Arguments[0]})
+	case msg.Type == messageInvocation && msg.Target == "Fail":
+		send(hubMessage{Type: messageCompletion, InvocationID: msg.InvocationID, Error: "nope"})
+	case msg.Type == messageInvocation && msg.Target == "Broadcast":
+		send(hubMessage{Type: messageInvocation, Target: "ReceiveMessage", Arguments: msg.Arguments})
+	case msg.Type == messageCompletion && msg.InvocationID == "s1":
+		send(hubMessage{Type: messageInvocation, Target: "Name", Arguments: []json.RawMessage{msg.Result}})
+	}
+}
+
+func encodeRecord(t *testing.T, msg interface{}) string {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	return string(data) + string(recordSeparator)
+}
+
+func splitRecords(data []byte) [][]byte {
+	var records [][]byte
+	for _, record := range bytes.Split(data, []byte{recordSeparator}) {
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func newTestHubServer(t *testing.T, tb *testutils.HTTPMultiBin) {
+	negotiate := func(transports ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			assert.Equal(t, "POST", req.Method)
+			assert.Equal(t, "1", req.URL.Query().Get("negotiateVersion"))
+			assert.Equal(t, "secret", req.Header.Get("X-Token"))
+			available := []map[string]interface{}{}
+			for _, transport := range transports {
+				available = append(available, map[string]interface{}{
+					"transport": transport, "transferFormats": []string{"Text", "Binary"},
+				})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"connectionId": "c1", "connectionToken": "t1", "negotiateVersion": 1, "availableTransports": available,
+			})
+		}
+	}
+	tb.Mux.HandleFunc("/hub/negotiate", negotiate(transportWebSockets, transportServerSentEvents))
+	tb.Mux.HandleFunc("/ssehub/negotiate", negotiate(transportServerSentEvents))
+	tb.Mux.HandleFunc("/redirect/negotiate", func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"url": tb.ServerHTTP.URL + "/hub", "accessToken": "token",
+		})
+	})
+
+	var mutex sync.Mutex
+	events := make(chan string, 100)
+	var streamDone chan struct{}
+	serverSentEvents := func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "t1", req.URL.Query().Get("id"))
+		switch req.Method {
+		case "GET":
+			assert.Equal(t, "text/event-stream", req.Header.Get("Accept"))
+			mutex.Lock()
+			streamDone = make(chan struct{})
+			done := streamDone
+			mutex.Unlock()
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					_, _ = fmt.Fprintf(w, "data: %s\n\n", event)
+					w.(http.Flusher).Flush()
+				case <-done:
+					return
+				case <-req.Context().Done():
+					return
+				}
+			}
+		case "POST":
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			for _, record := range splitRecords(body) {
+				testHub(t, record, func(msg interface{}) { events <- encodeRecord(t, msg) })
+			}
+		case "DELETE":
+			mutex.Lock()
+			close(streamDone)
+			mutex.Unlock()
+		}
+	}
+	tb.Mux.HandleFunc("/ssehub", serverSentEvents)
+
+	tb.Mux.HandleFunc("/hub", func(w http.ResponseWriter, req *http.Request) {
+		if !websocket.IsWebSocketUpgrade(req) {
+			serverSentEvents(w, req)
+			return
+		}
+		assert.Equal(t, "t1", req.URL.Query().Get("id"))
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		send := func(msg interface{}) {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(encodeRecord(t, msg)))
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			for _, record := range splitRecords(data) {
+				testHub(t, record, send)
+			}
+		}
+	})
+
+}
+
+func TestConnect(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+	newTestHubServer(t, tb)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:     root,
+		Dialer:    tb.Dialer,
+		Transport: tb.HTTPTransport,
+		Options:   lib.Options{SystemTags: lib.GetTagSet("url")},
+		Samples:   samples,
+	}
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("signalr", common.Bind(rt, New(), &ctx))
+
+	script := `
+	let received = {};
+	let res = signalr.connect("%s", { headers: { "X-Token": "secret" }, %s }, function(conn) {
+		conn.on("open", function() {
+			conn.invoke("Echo", { a: 1 }, function(result) {
+				if (result.a !== 1) { throw new Error("wrong result: " + JSON.stringify(result)); }
+				received.echo = true;
+			});
+			conn.invoke("Fail");
+			conn.send("Broadcast", "hi", 2);
+		});
+		conn.on("GetName", function() { return "k6"; });
+		conn.on("Name", function(name) { received.name = name; });
+		conn.on("ReceiveMessage", function(msg, n) { received.broadcast = msg + n; });
+		conn.on("error", function(err) { received.error = err.error(); });
+		conn.setInterval(function() {
+			if (received.echo && received.name && received.broadcast && received.error) { conn.close(); }
+		}, 5);
+		conn.setTimeout(function() { throw new Error("timed out: " + JSON.stringify(received)); }, 5000);
+	});
+	if (received.name !== "k6") { throw new Error("wrong name: " + received.name); }
+	if (received.broadcast !== "hi2") { throw new Error("wrong broadcast: " + received.broadcast); }
+	if (received.error.indexOf("invocation of 'Fail' failed: nope") < 0) { throw new Error(received.error); }
+	res;
+	`
+
+	testdata := map[string]struct {
+		path, params, transport string
+	}{
+		"WebSockets":            {"/hub", "", transportWebSockets},
+		"ServerSentEvents":      {"/hub", `transport: "serverSentEvents"`, transportServerSentEvents},
+		"ServerSentEventsOnly":  {"/ssehub", "", transportServerSentEvents},
+		"NegotiationRedirected": {"/redirect", "", transportWebSockets},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			url := tb.ServerHTTP.URL + data.path
+			v, err := common.RunString(rt, fmt.Sprintf(script, url, data.params))
+			require.NoError(t, err)
+			result, ok := v.Export().(*Result)
+			require.True(t, ok)
+			assert.Equal(t, data.transport, result.Transport)
+			assert.Equal(t, "c1", result.ConnectionID)
+
+			targets := map[string]float64{}
+			for _, sc := range stats.GetBufferedSamples(samples) {
+				for _, sample := range sc.GetSamples() {
+					if sample.Metric == metrics.SignalRInvocationDuration {
+						target, _ := sample.Tags.Get("target")
+						targets[target] = sample.Value
+					}
+				}
+			}
+			assert.Len(t, targets, 2)
+			assert.True(t, targets["Echo"] >= 10, "Echo took %f", targets["Echo"])
+			assert.Contains(t, targets, "Fail")
+		})
+	}
+
+	t.Run("invalid transport", func(t *testing.T) {
+		_, err := common.RunString(rt, fmt.Sprintf(`
+		signalr.connect("%s/ssehub", { headers: { "X-Token": "secret" }, transport: "webSockets" }, function(conn) {});
+		`, tb.ServerHTTP.URL))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the SignalR server doesn't offer any of the supported transports")
+
+		_, err = common.RunString(rt, fmt.Sprintf(`
+		signalr.connect("%s/hub", { transport: "longPolling" }, function(conn) {});
+		`, tb.ServerHTTP.URL))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported signalr.connect transport 'longPolling'")
+	})
+}
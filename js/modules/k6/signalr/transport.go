@@ -0,0 +1,291 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signalr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/lib"
+)
+
+const writeWait = 10 * time.Second
+
+// transport sends and receives the hub protocol messages over a connection.
+type transport interface {
+	send(data []byte) error
+	received() <-chan []byte
+	errors() <-chan error
+	// closed is closed when the server closes the connection.
+	closed() <-chan struct{}
+	close() error
+}
+
+// pump has the channels that the transports pass what they read from the connections through.
+type pump struct {
+	data      chan []byte
+	errs      chan error
+	done      chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+	doneOnce  sync.Once
+}
+
+func newPump() pump {
+	return pump{
+		data: make(chan []byte),
+		errs: make(chan error),
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+}
+
+func (p *pump) received() <-chan []byte { return p.data }
+func (p *pump) errors() <-chan error    { return p.errs }
+func (p *pump) closed() <-chan struct{} { return p.done }
+
+func (p *pump) deliver(data []byte) bool {
+	select {
+	case p.data <- data:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+func (p *pump) fail(err error) {
+	select {
+	case p.errs <- err:
+	case <-p.stop:
+	}
+}
+
+func (p *pump) finish() {
+	p.doneOnce.Do(func() { close(p.done) })
+}
+
+// stopped reports whether the connection is being closed by the client.
+func (p *pump) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+type webSocketTransport struct {
+	pump
+	conn *websocket.Conn
+}
+
+func dialWebSocket(ctx context.Context, state *lib.State, u *neturl.URL, header http.Header) (transport, error) {
+	wsURL := *u
+	switch wsURL.Scheme {
+	case "http":
+		wsURL.Scheme = "ws"
+	case "https":
+		wsURL.Scheme = "wss"
+	}
+
+	tlsConfig := state.TLSConfig
+	if state.HostTLSConfig != nil {
+		tlsConfig = state.HostTLSConfig(wsURL.Hostname())
+	}
+	if tlsConfig != nil {
+		// Overriding the NextProtos to avoid talking http2
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	dialer := websocket.Dialer{
+		NetDial: func(network, address string) (net.Conn, error) {
+			return state.Dialer.DialContext(ctx, network, address)
+		},
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	conn, res, err := dialer.Dial(wsURL.String(), header)
+	if err != nil {
+		if res != nil {
+			return nil, fmt.Errorf("SignalR WebSocket connection failed with status %s", res.Status)
+		}
+		return nil, fmt.Errorf("SignalR WebSocket connection failed: %s", err)
+	}
+
+	t := &webSocketTransport{pump: newPump(), conn: conn}
+	go func() {
+		defer t.finish()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if !t.stopped() && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					t.fail(err)
+				}
+				return
+			}
+			if !t.deliver(data) {
+				return
+			}
+		}
+	}()
+	return t, nil
+}
+
+func (t *webSocketTransport) send(data []byte) error {
+	_ = t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *webSocketTransport) close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		_ = t.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(writeWait),
+		)
+		err = t.conn.Close()
+	})
+	return err
+}
+
+// serverSentEventsTransport receives the messages as a stream of events, and sends them with
+// separate POST requests.
+type serverSentEventsTransport struct {
+	pump
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *http.Client
+	url    string
+	header http.Header
+}
+
+func openServerSentEvents(ctx context.Context, state *lib.State, u *neturl.URL, header http.Header) (transport, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	t := &serverSentEventsTransport{
+		pump:   newPump(),
+		ctx:    streamCtx,
+		cancel: cancel,
+		client: &http.Client{Transport: state.Transport},
+		url:    u.String(),
+		header: header,
+	}
+
+	req, err := t.newRequest("GET", nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("SignalR Server-Sent Events connection failed: %s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("SignalR Server-Sent Events connection failed with status %s", res.Status)
+	}
+
+	go func() {
+		defer t.finish()
+		defer func() { _ = res.Body.Close() }()
+		if err := t.readEvents(res.Body); err != nil && !t.stopped() {
+			t.fail(err)
+		}
+	}()
+	return t, nil
+}
+
+func (t *serverSentEventsTransport) newRequest(method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range t.header {
+		req.Header[k] = vs
+	}
+	return req.WithContext(t.ctx), nil
+}
+
+// readEvents passes the data of every event in the stream to the pump.
+func (t *serverSentEventsTransport) readEvents(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event [][]byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(event) > 0 && !t.deliver(bytes.Join(event, []byte("\n"))) {
+				return nil
+			}
+			event = nil
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("data:")) {
+			data := bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))
+			event = append(event, append([]byte(nil), data...))
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *serverSentEventsTransport) send(data []byte) error {
+	req, err := t.newRequest("POST", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("sending a SignalR message failed with status %s", res.Status)
+	}
+	return nil
+}
+
+func (t *serverSentEventsTransport) close() error {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		// The server closes the stream once the connection is deleted
+		if req, err := t.newRequest("DELETE", nil); err == nil {
+			req = req.WithContext(context.Background())
+			if res, err := t.client.Do(req); err == nil {
+				_ = res.Body.Close()
+			}
+		}
+		t.cancel()
+	})
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stomp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Frame is a STOMP frame, see https://stomp.github.io/stomp-specification-1.2.html#STOMP_Frames
+type Frame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+var (
+	headerEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	headerUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+// The values of the CONNECT and CONNECTED frames' headers aren't escaped, for compatibility with
+// STOMP 1.0.
+func escapesHeaders(command string) bool {
+	return command != "CONNECT" && command != "CONNECTED" && command != "STOMP"
+}
+
+// Encode returns the frame in the wire format, with a content-length header if it has a body.
+func (f *Frame) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteString(f.Command)
+	b.WriteByte('\n')
+
+	names := make([]string, 0, len(f.Headers))
+	for name := range f.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := f.Headers[name]
+		if escapesHeaders(f.Command) {
+			name, value = headerEscaper.Replace(name), headerEscaper.Replace(value)
+		}
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	if _, ok := f.Headers["content-length"]; !ok && len(f.Body) > 0 {
+		b.WriteString("content-length:" + strconv.Itoa(len(f.Body)) + "\n")
+	}
+	b.WriteByte('\n')
+	b.Write(f.Body)
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// ParseFrame parses the first frame in data, skipping the heart-beats before it. It returns the
+// number of bytes that were consumed, and a nil frame if data doesn't contain a whole frame yet.
+func ParseFrame(data []byte) (*Frame, int, error) {
+	start := 0
+	for start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+	rest := data[start:]
+	if len(rest) == 0 {
+		return nil, start, nil
+	}
+
+	headerEnd := bytes.Index(rest, []byte("\n\n"))
+	bodyStart := headerEnd + 2
+	if crlf := bytes.Index(rest, []byte("\r\n\r\n")); crlf >= 0 && (headerEnd < 0 || crlf < headerEnd) {
+		headerEnd, bodyStart = crlf, crlf+4
+	}
+	if headerEnd < 0 {
+		return nil, 0, nil
+	}
+
+	lines := strings.Split(strings.Replace(string(rest[:headerEnd]), "\r\n", "\n", -1), "\n")
+	f := &Frame{Command: lines[0], Headers: make(map[string]string, len(lines)-1)}
+	if f.Command == "" {
+		return nil, 0, errors.New("invalid STOMP frame without a command")
+	}
+	for _, line := range lines[1:] {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, 0, fmt.Errorf("invalid STOMP header '%s'", line)
+		}
+		name, value := line[:i], line[i+1:]
+		if escapesHeaders(f.Command) {
+			name, value = headerUnescaper.Replace(name), headerUnescaper.Replace(value)
+		}
+		// Only the first of the repeated headers is used
+		if _, ok := f.Headers[name]; !ok {
+			f.Headers[name] = value
+		}
+	}
+
+	body := rest[bodyStart:]
+	bodyEnd := bytes.IndexByte(body, 0)
+	if lengthStr, ok := f.Headers["content-length"]; ok {
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil || length < 0 {
+			return nil, 0, fmt.Errorf("invalid STOMP content-length '%s'", lengthStr)
+		}
+		if len(body) <= length {
+			return nil, 0, nil
+		}
+		if body[length] != 0 {
+			return nil, 0, errors.New("invalid STOMP frame, the body is longer than its content-length")
+		}
+		bodyEnd = length
+	}
+	if bodyEnd < 0 {
+		return nil, 0, nil
+	}
+	f.Body = append([]byte(nil), body[:bodyEnd]...)
+	return f, start + bodyStart + bodyEnd + 1, nil
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stomp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameEncode(t *testing.T) {
+	f := &Frame{
+		Command: "SEND",
+		Headers: map[string]string{"destination": "/queue/a", "x-colon": "a:b\nc"},
+		Body:    []byte("hello"),
+	}
+	assert.Equal(t, "SEND\ndestination:/queue/a\nx-colon:a\\cb\\nc\ncontent-length:5\n\nhello\x00", string(f.Encode()))
+
+	f = &Frame{Command: "CONNECT", Headers: map[string]string{"passcode": "a:b"}}
+	assert.Equal(t, "CONNECT\npasscode:a:b\n\n\x00", string(f.Encode()))
+}
+
+func TestParseFrame(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		f := &Frame{
+			Command: "MESSAGE",
+			Headers: map[string]string{"destination": "/queue/a", "x-escaped": "a:b\\c\r\n"},
+			Body:    []byte("with a \x00 NUL"),
+		}
+		data := f.Encode()
+		parsed, n, err := ParseFrame(append(data, "\nMESSAGE"...))
+		require.NoError(t, err)
+		assert.Equal(t, len(data), n)
+		assert.Equal(t, f.Body, parsed.Body)
+		assert.Equal(t, "a:b\\c\r\n", parsed.Headers["x-escaped"])
+	})
+	t.Run("heart-beats and CRLF", func(t *testing.T) {
+		data := "\n\r\nCONNECTED\r\nversion:1.2\r\nversion:1.1\r\n\r\n\x00"
+		f, n, err := ParseFrame([]byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, len(data), n)
+		assert.Equal(t, &Frame{Command: "CONNECTED", Headers: map[string]string{"version": "1.2"}, Body: nil}, f)
+	})
+	t.Run("incomplete", func(t *testing.T) {
+		for _, data := range []string{"", "\n\n", "MESSAGE\ndestination:/a", "MESSAGE\n\nbody", "MESSAGE\ncontent-length:10\n\nshort\x00"} {
+			f, _, err := ParseFrame([]byte(data))
+			assert.NoError(t, err, data)
+			assert.Nil(t, f, data)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"MESSAGE\nno colon\n\n\x00",
+			"MESSAGE\ncontent-length:x\n\n\x00",
+			"MESSAGE\ncontent-length:1\n\nab\x00",
+		} {
+			_, _, err := ParseFrame([]byte(data))
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,565 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stomp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// ErrSTOMPInInitContext is returned when STOMP connections are made in the init context.
+var ErrSTOMPInInitContext = common.NewInitContextError("using STOMP in the init context is not supported")
+
+// SentTimestampHeader is set on the sent messages to the time they were sent, in nanoseconds
+// since the Unix epoch. It's used to measure the delivery time of the messages that are received
+// by any VU, which assumes that the clocks of the senders and the receivers are in sync.
+const SentTimestampHeader = "k6-sent-timestamp"
+
+// STOMP is a client for STOMP 1.0-1.2 brokers, over WebSockets or plain TCP.
+type STOMP struct{}
+
+func New() *STOMP {
+	return &STOMP{}
+}
+
+// Client is a STOMP connection.
+type Client struct {
+	ctx       context.Context
+	transport *transport
+	buffer    []byte
+
+	handlers          map[string][]goja.Callable
+	subscriptions     map[string]*Subscription
+	subscriptionCount int
+	receipts          map[string]goja.Callable
+	receiptCount      int
+	connected         bool
+	version           string
+
+	heartbeatMs     int64 // the heart-beat interval that the client asks for
+	sendInterval    time.Duration
+	receiveInterval time.Duration
+	lastSent        time.Time
+	lastReceived    time.Time
+
+	sent      []time.Time
+	received  []time.Time
+	delivered []delivery
+
+	scheduled chan goja.Callable
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type delivery struct {
+	sent, received time.Time
+}
+
+// Subscription is a subscription to a destination.
+type Subscription struct {
+	client  *Client
+	ID      string `js:"id"`
+	handler goja.Callable
+	ack     string
+}
+
+// Message is a message that's received by a subscription.
+type Message struct {
+	client  *Client
+	Headers map[string]string `js:"headers"`
+	Body    string            `js:"body"`
+	ack     string
+	acked   bool
+}
+
+type connectParams struct {
+	header    http.Header
+	headers   map[string]string // of the CONNECT frame
+	heartbeat int64
+	tags      map[string]string
+}
+
+// Result is returned by stomp.connect once the connection is closed.
+type Result struct {
+	URL     string `js:"url"`
+	Version string `js:"version"` // the negotiated protocol version
+}
+
+// Connect connects to the broker at the given URL and calls the function with the client. It
+// returns once the connection is closed.
+func (s *STOMP) Connect(ctx context.Context, url string, args ...goja.Value) (*Result, error) {
+	rt := common.GetRuntime(ctx)
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil, ErrSTOMPInInitContext
+	}
+
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV = args[0]
+		callableV = args[1]
+	case 1:
+		paramsV = goja.Undefined()
+		callableV = args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to stomp.connect")
+	}
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to stomp.connect must be a function")
+	}
+
+	params, err := parseConnectParams(rt, state, paramsV)
+	if err != nil {
+		return nil, err
+	}
+	if state.Options.SystemTags["url"] {
+		params.tags["url"] = url
+	}
+	if state.Options.SystemTags["group"] {
+		params.tags["group"] = state.Group.Path
+	}
+
+	t, err := dial(ctx, state, url, params.header)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = t.close() }()
+
+	client := &Client{
+		ctx:           ctx,
+		transport:     t,
+		handlers:      make(map[string][]goja.Callable),
+		subscriptions: make(map[string]*Subscription),
+		receipts:      make(map[string]goja.Callable),
+		heartbeatMs:   params.heartbeat,
+		lastReceived:  time.Now(),
+		scheduled:     make(chan goja.Callable),
+		done:          make(chan struct{}),
+	}
+	connectHeaders := map[string]string{"accept-version": "1.0,1.1,1.2"}
+	if u, err := neturl.Parse(url); err == nil {
+		connectHeaders["host"] = u.Hostname()
+	}
+	for k, v := range params.headers {
+		connectHeaders[k] = v
+	}
+	heartbeat := strconv.FormatInt(params.heartbeat, 10)
+	connectHeaders["heart-beat"] = heartbeat + "," + heartbeat
+	client.sendFrame(&Frame{Command: "CONNECT", Headers: connectHeaders})
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(client)); err != nil {
+		return nil, err
+	}
+
+	heartbeats := time.NewTicker(time.Second)
+	if params.heartbeat > 0 {
+		heartbeats.Stop()
+		heartbeats = time.NewTicker(time.Duration(params.heartbeat) * time.Millisecond / 2)
+	}
+	defer heartbeats.Stop()
+
+	for {
+		select {
+		case data := <-t.data:
+			client.lastReceived = time.Now()
+			client.buffer = append(client.buffer, data...)
+			for {
+				frame, n, err := ParseFrame(client.buffer)
+				if err != nil {
+					client.handleEvent("error", rt.ToValue(err))
+					client.closeConnection(false)
+					break
+				}
+				client.buffer = client.buffer[n:]
+				if frame == nil {
+					break
+				}
+				client.handleFrame(frame)
+			}
+
+		case err := <-t.errs:
+			client.handleEvent("error", rt.ToValue(err))
+			client.closeConnection(false)
+
+		case <-t.done:
+			client.closeConnection(false)
+
+		case scheduledFn := <-client.scheduled:
+			if _, err := scheduledFn(goja.Undefined()); err != nil {
+				return nil, err
+			}
+
+		case <-heartbeats.C:
+			client.heartbeat()
+
+		case <-ctx.Done():
+			client.closeConnection(true)
+
+		case <-client.done:
+			sampleTags := stats.IntoSampleTags(&params.tags)
+			for _, sent := range client.sent {
+				stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+					Metric: metrics.STOMPMessagesSent, Time: sent, Tags: sampleTags, Value: 1,
+				})
+			}
+			for _, received := range client.received {
+				stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+					Metric: metrics.STOMPMessagesReceived, Time: received, Tags: sampleTags, Value: 1,
+				})
+			}
+			for _, d := range client.delivered {
+				stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+					Metric: metrics.STOMPDeliveryDuration,
+					Time:   d.received,
+					Tags:   sampleTags,
+					Value:  stats.D(d.received.Sub(d.sent)),
+				})
+			}
+			return &Result{URL: url, Version: client.version}, nil
+		}
+	}
+}
+
+func parseConnectParams(rt *goja.Runtime, state *lib.State, paramsV goja.Value) (connectParams, error) {
+	params := connectParams{headers: make(map[string]string), tags: state.CloneTags()}
+	if goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return params, nil
+	}
+	obj := paramsV.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			continue
+		}
+		switch k {
+		case "login", "passcode", "host":
+			params.headers[k] = v.String()
+		case "headers":
+			params.header = http.Header{}
+			headers := v.ToObject(rt)
+			for _, key := range headers.Keys() {
+				params.header.Set(key, headers.Get(key).String())
+			}
+		case "heartbeat":
+			params.heartbeat = v.ToInteger()
+			if params.heartbeat < 0 {
+				return params, fmt.Errorf("the stomp.connect heartbeat must be positive, not %d", params.heartbeat)
+			}
+		case "tags":
+			tags := v.ToObject(rt)
+			for _, key := range tags.Keys() {
+				params.tags[key] = tags.Get(key).String()
+			}
+		}
+	}
+	return params, nil
+}
+
+// heartbeat sends a heart-beat if nothing else was sent in the negotiated interval, and closes
+// the connection if nothing was received from the broker for twice its interval.
+func (c *Client) heartbeat() {
+	if !c.connected {
+		return
+	}
+	if c.receiveInterval > 0 && time.Since(c.lastReceived) > 2*c.receiveInterval {
+		c.handleEvent("error", common.GetRuntime(c.ctx).ToValue(errors.New("the STOMP broker didn't send a heart-beat in time")))
+		c.closeConnection(false)
+		return
+	}
+	if c.sendInterval > 0 && time.Since(c.lastSent) >= c.sendInterval/2 {
+		c.write([]byte("\n"))
+	}
+}
+
+// negotiateHeartbeats sets the heart-beat intervals from the client's interval and the broker's
+// heart-beat header, see https://stomp.github.io/stomp-specification-1.2.html#Heart-beating
+func (c *Client) negotiateHeartbeats(serverHeader string) {
+	var sx, sy int64
+	if parts := strings.SplitN(serverHeader, ",", 2); len(parts) == 2 {
+		sx, _ = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		sy, _ = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	}
+	cx, cy := c.heartbeatMs, c.heartbeatMs
+	if cx > 0 && sy > 0 {
+		c.sendInterval = time.Duration(max(cx, sy)) * time.Millisecond
+	}
+	if sx > 0 && cy > 0 {
+		c.receiveInterval = time.Duration(max(sx, cy)) * time.Millisecond
+	}
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (c *Client) handleFrame(f *Frame) {
+	rt := common.GetRuntime(c.ctx)
+	switch f.Command {
+	case "CONNECTED":
+		c.connected = true
+		c.version = f.Headers["version"]
+		if c.version == "" {
+			c.version = "1.0"
+		}
+		c.negotiateHeartbeats(f.Headers["heart-beat"])
+		c.handleEvent("connect", rt.ToValue(f.Headers))
+
+	case "MESSAGE":
+		now := time.Now()
+		c.received = append(c.received, now)
+		if sentStr, ok := f.Headers[SentTimestampHeader]; ok {
+			if sent, err := strconv.ParseInt(sentStr, 10, 64); err == nil {
+				c.delivered = append(c.delivered, delivery{sent: time.Unix(0, sent), received: now})
+			}
+		}
+		sub, ok := c.subscriptions[f.Headers["subscription"]]
+		if !ok {
+			return
+		}
+		msg := &Message{client: c, Headers: f.Headers, Body: string(f.Body), ack: f.Headers["ack"]}
+		if msg.ack == "" {
+			msg.ack = f.Headers["message-id"]
+		}
+		if _, err := sub.handler(goja.Undefined(), rt.ToValue(msg)); err != nil {
+			common.Throw(rt, err)
+		}
+
+	case "RECEIPT":
+		id := f.Headers["receipt-id"]
+		if callback, ok := c.receipts[id]; ok {
+			delete(c.receipts, id)
+			if _, err := callback(goja.Undefined()); err != nil {
+				common.Throw(rt, err)
+			}
+		}
+
+	case "ERROR":
+		message := f.Headers["message"]
+		if len(f.Body) > 0 {
+			message = strings.TrimSpace(message + ": " + string(f.Body))
+		}
+		c.handleEvent("error", rt.ToValue(fmt.Errorf("STOMP error: %s", message)))
+		// The broker closes the connection after an ERROR frame
+		c.closeConnection(false)
+	}
+}
+
+func (c *Client) write(data []byte) {
+	c.lastSent = time.Now()
+	if err := c.transport.write(data); err != nil {
+		c.handleEvent("error", common.GetRuntime(c.ctx).ToValue(err))
+	}
+}
+
+func (c *Client) sendFrame(f *Frame) {
+	c.write(f.Encode())
+}
+
+func (c *Client) handleEvent(event string, args ...goja.Value) {
+	for _, handler := range c.handlers[event] {
+		if _, err := handler(goja.Undefined(), args...); err != nil {
+			common.Throw(common.GetRuntime(c.ctx), err)
+		}
+	}
+}
+
+// On registers a handler for the "connect", "error" and "close" events.
+func (c *Client) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		c.handlers[event] = append(c.handlers[event], handler)
+	}
+}
+
+// frameHeaders exports the optional headers argument of the client methods.
+func (c *Client) frameHeaders(headersV goja.Value) map[string]string {
+	headers := make(map[string]string)
+	if headersV == nil || goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+		return headers
+	}
+	obj := headersV.ToObject(common.GetRuntime(c.ctx))
+	for _, key := range obj.Keys() {
+		headers[key] = obj.Get(key).String()
+	}
+	return headers
+}
+
+// withReceipt adds a receipt header to the frame if a callback is given, which is called once the
+// broker confirms that it has processed the frame.
+func (c *Client) withReceipt(f *Frame, callbackV goja.Value) {
+	if callbackV == nil {
+		return
+	}
+	if callback, ok := goja.AssertFunction(callbackV); ok {
+		c.receiptCount++
+		id := "receipt-" + strconv.Itoa(c.receiptCount)
+		c.receipts[id] = callback
+		f.Headers["receipt"] = id
+	}
+}
+
+// Send sends a message to the destination, with the optional headers. If a function is given
+// as the last argument, it's called once the broker has received the message.
+func (c *Client) Send(destination string, body string, args ...goja.Value) {
+	var headersV, receiptV goja.Value
+	if len(args) > 0 {
+		headersV = args[0]
+	}
+	if len(args) > 1 {
+		receiptV = args[1]
+	}
+	headers := c.frameHeaders(headersV)
+	headers["destination"] = destination
+	headers[SentTimestampHeader] = strconv.FormatInt(time.Now().UnixNano(), 10)
+	f := &Frame{Command: "SEND", Headers: headers, Body: []byte(body)}
+	c.withReceipt(f, receiptV)
+	c.sendFrame(f)
+	c.sent = append(c.sent, time.Now())
+}
+
+// Subscribe subscribes to the destination, calling the handler with every message. The optional
+// headers can set the ack mode to "client" or "client-individual", in which case the messages
+// have to be acknowledged with message.ack().
+func (c *Client) Subscribe(destination string, args ...goja.Value) (*Subscription, error) {
+	var headersV, handlerV goja.Value
+	switch len(args) {
+	case 2:
+		headersV, handlerV = args[0], args[1]
+	case 1:
+		handlerV = args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to client.subscribe")
+	}
+	handler, ok := goja.AssertFunction(handlerV)
+	if !ok {
+		return nil, errors.New("last argument to client.subscribe must be a function")
+	}
+
+	headers := c.frameHeaders(headersV)
+	if headers["id"] == "" {
+		c.subscriptionCount++
+		headers["id"] = "sub-" + strconv.Itoa(c.subscriptionCount)
+	}
+	if headers["ack"] == "" {
+		headers["ack"] = "auto"
+	}
+	headers["destination"] = destination
+	sub := &Subscription{client: c, ID: headers["id"], handler: handler, ack: headers["ack"]}
+	c.subscriptions[sub.ID] = sub
+	c.sendFrame(&Frame{Command: "SUBSCRIBE", Headers: headers})
+	return sub, nil
+}
+
+// Unsubscribe stops the subscription.
+func (s *Subscription) Unsubscribe() {
+	delete(s.client.subscriptions, s.ID)
+	s.client.sendFrame(&Frame{Command: "UNSUBSCRIBE", Headers: map[string]string{"id": s.ID}})
+}
+
+// Ack acknowledges the message, for subscriptions with the client ack modes.
+func (m *Message) Ack() {
+	m.acknowledge("ACK")
+}
+
+// Nack tells the broker that the message wasn't consumed.
+func (m *Message) Nack() {
+	m.acknowledge("NACK")
+}
+
+func (m *Message) acknowledge(command string) {
+	if m.acked {
+		return
+	}
+	m.acked = true
+	headers := map[string]string{"id": m.ack}
+	// STOMP 1.0 and 1.1 identify the messages by their subscription and ID instead
+	if _, ok := m.Headers["ack"]; !ok {
+		headers["subscription"] = m.Headers["subscription"]
+		headers["message-id"] = m.Headers["message-id"]
+	}
+	m.client.sendFrame(&Frame{Command: command, Headers: headers})
+}
+
+// SetTimeout calls the function after the given number of milliseconds.
+func (c *Client) SetTimeout(fn goja.Callable, timeoutMs int) {
+	go func() {
+		select {
+		case <-time.After(time.Duration(timeoutMs) * time.Millisecond):
+			select {
+			case c.scheduled <- fn:
+			case <-c.done:
+			}
+		case <-c.done:
+		}
+	}()
+}
+
+// SetInterval calls the function every given number of milliseconds.
+func (c *Client) SetInterval(fn goja.Callable, intervalMs int) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case c.scheduled <- fn:
+				case <-c.done:
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Disconnect disconnects from the broker gracefully and closes the connection.
+func (c *Client) Disconnect() {
+	c.closeConnection(true)
+}
+
+func (c *Client) closeConnection(disconnect bool) {
+	c.closeOnce.Do(func() {
+		if disconnect && c.connected {
+			c.sendFrame(&Frame{Command: "DISCONNECT", Headers: map[string]string{}})
+		}
+		_ = c.transport.close()
+		c.handleEvent("close")
+		close(c.done)
+	})
+}
@@ -0,0 +1,255 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stomp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBroker is a minimal STOMP 1.2 broker that delivers the sent messages to the subscriptions
+// of the same connection.
+type testBroker struct {
+	t     *testing.T
+	mutex sync.Mutex
+	acks  []string
+	done  chan struct{} // receives when a connection is closed
+}
+
+func (b *testBroker) serve(read func() ([]byte, error), write func([]byte) error) {
+	subscriptions := map[string]string{} // destination -> subscription ID
+	messageCount := 0
+	var buffer []byte
+	defer func() { b.done <- struct{}{} }()
+	send := func(f *Frame) {
+		_ = write(f.Encode())
+	}
+	for {
+		data, err := read()
+		if err != nil {
+			return
+		}
+		buffer = append(buffer, data...)
+		for {
+			f, n, err := ParseFrame(buffer)
+			require.NoError(b.t, err)
+			buffer = buffer[n:]
+			if f == nil {
+				break
+			}
+			switch f.Command {
+			case "CONNECT", "STOMP":
+				if f.Headers["passcode"] != "secret" {
+					send(&Frame{Command: "ERROR", Headers: map[string]string{"message": "access refused"}})
+					return
+				}
+				assert.Equal(b.t, "1.0,1.1,1.2", f.Headers["accept-version"])
+				send(&Frame{Command: "CONNECTED", Headers: map[string]string{"version": "1.2", "heart-beat": "0,0"}})
+			case "SUBSCRIBE":
+				subscriptions[f.Headers["destination"]] = f.Headers["id"]
+			case "UNSUBSCRIBE":
+				for destination, id := range subscriptions {
+					if id == f.Headers["id"] {
+						delete(subscriptions, destination)
+					}
+				}
+			case "SEND":
+				time.Sleep(10 * time.Millisecond)
+				if id, ok := subscriptions[f.Headers["destination"]]; ok {
+					messageCount++
+					headers := map[string]string{
+						"subscription": id,
+						"message-id":   strconv.Itoa(messageCount),
+						"ack":          "a" + strconv.Itoa(messageCount),
+					}
+					for k, v := range f.Headers {
+						if k != "receipt" {
+							headers[k] = v
+						}
+					}
+					send(&Frame{Command: "MESSAGE", Headers: headers, Body: f.Body})
+				}
+			case "ACK", "NACK":
+				b.mutex.Lock()
+				b.acks = append(b.acks, f.Command+" "+f.Headers["id"])
+				b.mutex.Unlock()
+			}
+			if receipt, ok := f.Headers["receipt"]; ok {
+				send(&Frame{Command: "RECEIPT", Headers: map[string]string{"receipt-id": receipt}})
+			}
+			if f.Command == "DISCONNECT" {
+				return
+			}
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	broker := &testBroker{t: t, done: make(chan struct{}, 10)}
+	tb.Mux.HandleFunc("/stomp", func(w http.ResponseWriter, req *http.Request) {
+		upgrader := websocket.Upgrader{Subprotocols: []string{"v12.stomp"}}
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		assert.Equal(t, "v12.stomp", conn.Subprotocol())
+		broker.serve(
+			func() ([]byte, error) {
+				_, data, err := conn.ReadMessage()
+				return data, err
+			},
+			func(data []byte) error { return conn.WriteMessage(websocket.TextMessage, data) },
+		)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				broker.serve(
+					func() ([]byte, error) {
+						buf := make([]byte, 1024)
+						n, err := conn.Read(buf)
+						return buf[:n], err
+					},
+					func(data []byte) error { _, err := conn.Write(data); return err },
+				)
+			}()
+		}
+	}()
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:     root,
+		Dialer:    tb.Dialer,
+		Transport: tb.HTTPTransport,
+		Options:   lib.Options{SystemTags: lib.GetTagSet("url")},
+		Samples:   samples,
+	}
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("stomp", common.Bind(rt, New(), &ctx))
+
+	script := `
+	let received = [];
+	let receipt = false;
+	let res = stomp.connect("%s", { login: "k6", passcode: "secret" }, function(client) {
+		client.on("connect", function(headers) {
+			if (headers.version !== "1.2") { throw new Error("wrong version: " + headers.version); }
+			let auto = client.subscribe("/queue/auto", function(msg) {
+				received.push(msg.body);
+				auto.unsubscribe();
+				client.send("/queue/auto", "ignored");
+			});
+			client.subscribe("/queue/acked", { ack: "client-individual" }, function(msg) {
+				received.push(msg.body + ":" + msg.headers["x-priority"]);
+				if (msg.body === "first") { msg.ack(); } else { msg.nack(); }
+			});
+			client.send("/queue/auto", "hello");
+			client.send("/queue/acked", "first", { "x-priority": "1" });
+			client.send("/queue/acked", "second", { "x-priority": "2" }, function() { receipt = true; });
+		});
+		client.on("error", function(err) { throw new Error(err.error()); });
+		client.setInterval(function() {
+			if (received.length === 3 && receipt) { client.disconnect(); }
+		}, 5);
+		client.setTimeout(function() { throw new Error("timed out: " + JSON.stringify(received)); }, 5000);
+	});
+	if (received.join(",") !== "hello,first:1,second:2") { throw new Error("wrong messages: " + received); }
+	if (res.version !== "1.2") { throw new Error("wrong version: " + res.version); }
+	`
+
+	listenerURL := "tcp://" + listener.Addr().String()
+	for name, url := range map[string]string{"WebSocket": tb.Replacer.Replace("ws://HTTPBIN_DOMAIN:HTTPBIN_PORT/stomp"), "TCP": listenerURL} {
+		t.Run(name, func(t *testing.T) {
+			broker.acks = nil
+			_, err := common.RunString(rt, fmt.Sprintf(script, url))
+			require.NoError(t, err)
+			<-broker.done
+			assert.Equal(t, []string{"ACK a2", "NACK a3"}, broker.acks)
+
+			counts := map[*stats.Metric]int{}
+			for _, sc := range stats.GetBufferedSamples(samples) {
+				for _, sample := range sc.GetSamples() {
+					counts[sample.Metric]++
+					if sample.Metric == metrics.STOMPDeliveryDuration {
+						assert.True(t, sample.Value >= 10, "delivery took %f", sample.Value)
+					}
+					tagURL, _ := sample.Tags.Get("url")
+					assert.Equal(t, url, tagURL)
+				}
+			}
+			assert.Equal(t, 4, counts[metrics.STOMPMessagesSent])
+			assert.Equal(t, 3, counts[metrics.STOMPMessagesReceived])
+			assert.Equal(t, 3, counts[metrics.STOMPDeliveryDuration])
+		})
+	}
+
+	t.Run("error frame", func(t *testing.T) {
+		_, err := common.RunString(rt, fmt.Sprintf(`
+		let error;
+		stomp.connect("%s", { passcode: "wrong" }, function(client) {
+			client.on("error", function(err) { error = err.error(); });
+		});
+		if (error !== "STOMP error: access refused") { throw new Error("wrong error: " + error); }
+		`, listenerURL))
+		assert.NoError(t, err)
+		<-broker.done
+	})
+
+	t.Run("invalid scheme", func(t *testing.T) {
+		_, err := common.RunString(rt, `stomp.connect("http://example.com/", function(client) {});`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported STOMP URL scheme 'http'")
+	})
+}
@@ -0,0 +1,179 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stomp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/lib"
+)
+
+const writeWait = 10 * time.Second
+
+// transport sends and receives the raw STOMP frames over a WebSocket or TCP connection.
+type transport struct {
+	write func(data []byte) error
+	conn  io.Closer
+
+	data      chan []byte
+	errs      chan error
+	done      chan struct{} // closed when the connection is closed by the server or fails
+	stop      chan struct{} // closed when the connection is closed by the client
+	closeOnce sync.Once
+}
+
+// dial connects to a ws:// or wss:// URL with the STOMP subprotocols, or a tcp:// or tls:// URL.
+func dial(ctx context.Context, state *lib.State, rawurl string, header http.Header) (*transport, error) {
+	u, err := neturl.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := state.TLSConfig
+	if state.HostTLSConfig != nil {
+		tlsConfig = state.HostTLSConfig(u.Hostname())
+	}
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = nil
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+
+	t := &transport{
+		data: make(chan []byte),
+		errs: make(chan error),
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		dialer := websocket.Dialer{
+			NetDial: func(network, address string) (net.Conn, error) {
+				return state.Dialer.DialContext(ctx, network, address)
+			},
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+			Subprotocols:    []string{"v12.stomp", "v11.stomp", "v10.stomp"},
+		}
+		conn, res, err := dialer.Dial(rawurl, header)
+		if err != nil {
+			if res != nil {
+				return nil, fmt.Errorf("STOMP WebSocket connection failed with status %s", res.Status)
+			}
+			return nil, fmt.Errorf("STOMP WebSocket connection failed: %s", err)
+		}
+		t.conn = conn
+		t.write = func(data []byte) error {
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			return conn.WriteMessage(websocket.TextMessage, data)
+		}
+		go t.pump(func() ([]byte, error) {
+			_, data, err := conn.ReadMessage()
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				err = io.EOF
+			}
+			return data, err
+		})
+
+	case "tcp", "tls":
+		conn, err := state.Dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("STOMP connection failed: %s", err)
+		}
+		if u.Scheme == "tls" {
+			if tlsConfig.ServerName == "" {
+				tlsConfig.ServerName = u.Hostname()
+			}
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("STOMP TLS handshake failed: %s", err)
+			}
+			conn = tlsConn
+		}
+		t.conn = conn
+		t.write = func(data []byte) error {
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_, err := conn.Write(data)
+			return err
+		}
+		go t.pump(func() ([]byte, error) {
+			buf := make([]byte, 32*1024)
+			n, err := conn.Read(buf)
+			if n > 0 {
+				return buf[:n], nil
+			}
+			return nil, err
+		})
+
+	default:
+		return nil, fmt.Errorf("unsupported STOMP URL scheme '%s', only ws, wss, tcp and tls are supported", u.Scheme)
+	}
+	return t, nil
+}
+
+// pump passes everything that's read from the connection to the data channel.
+func (t *transport) pump(read func() ([]byte, error)) {
+	defer close(t.done)
+	for {
+		data, err := read()
+		if err != nil {
+			if err != io.EOF {
+				select {
+				case t.errs <- err:
+				case <-t.stop:
+				}
+			}
+			return
+		}
+		select {
+		case t.data <- data:
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *transport) close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		if conn, ok := t.conn.(*websocket.Conn); ok {
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(writeWait),
+			)
+		}
+		err = t.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,505 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+)
+
+// The Engine.IO packet types, see https://github.com/socketio/engine.io-protocol
+const (
+	eioOpen    = '0'
+	eioClose   = '1'
+	eioPing    = '2'
+	eioPong    = '3'
+	eioMessage = '4'
+)
+
+// The Socket.IO packet types, which are sent in Engine.IO messages, see
+// https://github.com/socketio/socket.io-protocol
+const (
+	sioConnect      = '0'
+	sioDisconnect   = '1'
+	sioEvent        = '2'
+	sioAck          = '3'
+	sioConnectError = '4'
+)
+
+const socketIODefaultNamespace = "/"
+
+// SocketIO is a Socket.IO client on top of a WebSocket connection. It handles the Engine.IO
+// handshake and heartbeats, and has the API of the default namespace.
+type SocketIO struct {
+	ctx    context.Context
+	socket *Socket
+	eio    int
+
+	namespaces map[string]*SocketIONamespace
+	root       *SocketIONamespace
+
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	lastSeen     time.Time
+	opened       bool
+}
+
+// SocketIONamespace is a Socket.IO namespace that's multiplexed over the connection.
+type SocketIONamespace struct {
+	io        *SocketIO
+	name      string
+	handlers  map[string][]goja.Callable
+	connected bool
+	queue     []string // packets that are emitted before the namespace is connected
+
+	ackCounter int
+	acks       map[int]socketIOAck
+}
+
+type socketIOAck struct {
+	callback goja.Callable
+	sent     time.Time
+}
+
+type socketIOPacket struct {
+	typ       byte
+	namespace string
+	ackID     int // -1 if there isn't one
+	data      string
+}
+
+// SocketIO connects to a Socket.IO server over WebSockets. The params are the same as the ones
+// of ws.connect(), and the function is called with a Socket.IO socket instead of a WebSocket.
+func (w *WS) SocketIO(ctx context.Context, rawurl string, args ...goja.Value) (*WSHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV = args[0]
+		callableV = args[1]
+	case 1:
+		paramsV = goja.Undefined()
+		callableV = args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to ws.socketIO")
+	}
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to ws.socketIO must be a function")
+	}
+
+	wsURL, eio, err := socketIOURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	setupSocket := func(call goja.FunctionCall) goja.Value {
+		socket, ok := call.Argument(0).Export().(*Socket)
+		if !ok {
+			common.Throw(rt, errors.New("ws.socketIO couldn't set up the socket"))
+		}
+		io := newSocketIO(ctx, socket, eio)
+		socket.On("message", rt.ToValue(io.handleMessage))
+		socket.On("error", rt.ToValue(func(call goja.FunctionCall) goja.Value {
+			io.root.handleEvent("error", call.Arguments...)
+			return goja.Undefined()
+		}))
+		socket.On("close", rt.ToValue(func(call goja.FunctionCall) goja.Value {
+			io.root.handleEvent("close", call.Arguments...)
+			return goja.Undefined()
+		}))
+		if _, err := setupFn(goja.Undefined(), rt.ToValue(io)); err != nil {
+			common.Throw(rt, err)
+		}
+		return goja.Undefined()
+	}
+	return w.Connect(ctx, wsURL, paramsV, rt.ToValue(setupSocket))
+}
+
+// socketIOURL returns the WebSocket URL of the Socket.IO server at rawurl, which gets the
+// default "/socket.io/" path if it has none, and the Engine.IO protocol version, which is 4 by
+// default and can be set to 3 for older servers with an EIO=3 query parameter.
+func socketIOURL(rawurl string) (string, int, error) {
+	u, err := neturl.Parse(rawurl)
+	if err != nil {
+		return "", 0, err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/socket.io/"
+	}
+
+	query := u.Query()
+	if query.Get("EIO") == "" {
+		query.Set("EIO", "4")
+	}
+	eio, err := strconv.Atoi(query.Get("EIO"))
+	if err != nil || (eio != 3 && eio != 4) {
+		return "", 0, fmt.Errorf("unsupported Engine.IO protocol version '%s', only 3 and 4 are supported", query.Get("EIO"))
+	}
+	query.Set("transport", "websocket")
+	u.RawQuery = query.Encode()
+	return u.String(), eio, nil
+}
+
+func newSocketIO(ctx context.Context, socket *Socket, eio int) *SocketIO {
+	io := &SocketIO{
+		ctx:        ctx,
+		socket:     socket,
+		eio:        eio,
+		namespaces: make(map[string]*SocketIONamespace),
+		lastSeen:   time.Now(),
+	}
+	io.root = io.Of(socketIODefaultNamespace)
+	return io
+}
+
+func parseSocketIOPacket(msg string) (socketIOPacket, error) {
+	if msg == "" {
+		return socketIOPacket{}, errors.New("empty Socket.IO packet")
+	}
+	p := socketIOPacket{typ: msg[0], namespace: socketIODefaultNamespace, ackID: -1}
+	rest := msg[1:]
+	if strings.HasPrefix(rest, "/") {
+		if i := strings.IndexByte(rest, ','); i >= 0 {
+			p.namespace, rest = rest[:i], rest[i+1:]
+		} else {
+			p.namespace, rest = rest, ""
+		}
+	}
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		ackID, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return socketIOPacket{}, err
+		}
+		p.ackID, rest = ackID, rest[i:]
+	}
+	p.data = rest
+	return p, nil
+}
+
+// Of returns the namespace with the given name, connecting to it if it's a new one.
+func (io *SocketIO) Of(name string) *SocketIONamespace {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	if ns, ok := io.namespaces[name]; ok {
+		return ns
+	}
+	ns := &SocketIONamespace{
+		io:       io,
+		name:     name,
+		handlers: make(map[string][]goja.Callable),
+		acks:     make(map[int]socketIOAck),
+	}
+	io.namespaces[name] = ns
+	if io.opened {
+		ns.connect()
+	}
+	return ns
+}
+
+// On registers a handler for an event of the default namespace.
+func (io *SocketIO) On(event string, handler goja.Value) {
+	io.root.On(event, handler)
+}
+
+// Emit emits an event on the default namespace.
+func (io *SocketIO) Emit(event string, args ...goja.Value) {
+	io.root.Emit(event, args...)
+}
+
+// Close disconnects from all of the namespaces and closes the connection.
+func (io *SocketIO) Close(args ...goja.Value) {
+	for _, ns := range io.namespaces {
+		if ns.connected {
+			io.socket.Send(ns.encode(sioDisconnect, -1, ""))
+			ns.connected = false
+		}
+	}
+	io.socket.Close(args...)
+}
+
+// SetTimeout is the same as the one of WebSockets.
+func (io *SocketIO) SetTimeout(fn goja.Callable, timeoutMs int) {
+	io.socket.SetTimeout(fn, timeoutMs)
+}
+
+// SetInterval is the same as the one of WebSockets.
+func (io *SocketIO) SetInterval(fn goja.Callable, intervalMs int) {
+	io.socket.SetInterval(fn, intervalMs)
+}
+
+func (io *SocketIO) handleMessage(call goja.FunctionCall) goja.Value {
+	msg := call.Argument(0).String()
+	io.lastSeen = time.Now()
+	if msg == "" {
+		return goja.Undefined()
+	}
+
+	switch msg[0] {
+	case eioOpen:
+		io.handleOpen(msg[1:])
+	case eioPing:
+		// Engine.IO v4 servers ping the clients, v3 clients ping the server instead
+		io.socket.Send(string(eioPong) + msg[1:])
+	case eioPong:
+	case eioClose:
+		io.socket.Close()
+	case eioMessage:
+		packet, err := parseSocketIOPacket(msg[1:])
+		if err != nil {
+			io.emitError(err)
+			return goja.Undefined()
+		}
+		if ns, ok := io.namespaces[packet.namespace]; ok {
+			ns.handlePacket(packet)
+		}
+	default:
+		io.emitError(fmt.Errorf("unsupported Engine.IO packet '%s'", msg))
+	}
+	return goja.Undefined()
+}
+
+func (io *SocketIO) handleOpen(data string) {
+	var handshake struct {
+		PingInterval int64 `json:"pingInterval"`
+		PingTimeout  int64 `json:"pingTimeout"`
+	}
+	if err := json.Unmarshal([]byte(data), &handshake); err != nil {
+		io.emitError(fmt.Errorf("invalid Engine.IO handshake: %s", err))
+		return
+	}
+	io.opened = true
+	io.pingInterval = time.Duration(handshake.PingInterval) * time.Millisecond
+	io.pingTimeout = time.Duration(handshake.PingTimeout) * time.Millisecond
+	if io.pingInterval > 0 {
+		io.socket.SetInterval(io.heartbeat, int(handshake.PingInterval))
+	}
+
+	for _, ns := range io.namespaces {
+		// Engine.IO v3 servers connect the clients to the default namespace automatically
+		if io.eio >= 4 || ns.name != socketIODefaultNamespace {
+			ns.connect()
+		}
+	}
+}
+
+func (io *SocketIO) heartbeat(goja.Value, ...goja.Value) (goja.Value, error) {
+	if time.Since(io.lastSeen) > io.pingInterval+io.pingTimeout {
+		io.emitError(errors.New("the Socket.IO server didn't respond in time"))
+		io.socket.Close()
+		return goja.Undefined(), nil
+	}
+	if io.eio < 4 {
+		io.socket.Send(string(eioPing))
+	}
+	return goja.Undefined(), nil
+}
+
+func (io *SocketIO) emitError(err error) {
+	io.root.handleEvent("error", common.GetRuntime(io.ctx).ToValue(err))
+}
+
+// On registers a handler for an event, which is either one of the events that the server emits,
+// or "connect", "disconnect", "connect_error" and, on the default namespace, "error" and "close".
+func (ns *SocketIONamespace) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		ns.handlers[event] = append(ns.handlers[event], handler)
+	}
+}
+
+// Emit sends an event with the given arguments to the server. If the last argument is a function,
+// it's called with the arguments of the server's acknowledgement.
+func (ns *SocketIONamespace) Emit(event string, args ...goja.Value) {
+	ackID := -1
+	if n := len(args); n > 0 {
+		if callback, ok := goja.AssertFunction(args[n-1]); ok {
+			ackID = ns.ackCounter
+			ns.ackCounter++
+			ns.acks[ackID] = socketIOAck{callback: callback}
+			args = args[:n-1]
+		}
+	}
+
+	data, err := encodeSocketIOArgs(append([]goja.Value{ns.rt().ToValue(event)}, args...))
+	if err != nil {
+		common.Throw(ns.rt(), err)
+	}
+	packet := ns.encode(sioEvent, ackID, data)
+	if !ns.connected {
+		ns.queue = append(ns.queue, packet)
+		return
+	}
+	ns.send(packet, ackID)
+}
+
+func (ns *SocketIONamespace) rt() *goja.Runtime {
+	return common.GetRuntime(ns.io.ctx)
+}
+
+func (ns *SocketIONamespace) connect() {
+	ns.io.socket.Send(ns.encode(sioConnect, -1, ""))
+}
+
+func (ns *SocketIONamespace) send(packet string, ackID int) {
+	if ack, ok := ns.acks[ackID]; ok {
+		ack.sent = time.Now()
+		ns.acks[ackID] = ack
+	}
+	ns.io.socket.Send(packet)
+}
+
+func (ns *SocketIONamespace) encode(typ byte, ackID int, data string) string {
+	var b strings.Builder
+	b.WriteByte(eioMessage)
+	b.WriteByte(typ)
+	if ns.name != socketIODefaultNamespace {
+		b.WriteString(ns.name)
+		b.WriteByte(',')
+	}
+	if ackID >= 0 {
+		b.WriteString(strconv.Itoa(ackID))
+	}
+	b.WriteString(data)
+	return b.String()
+}
+
+func (ns *SocketIONamespace) handlePacket(packet socketIOPacket) {
+	rt := ns.rt()
+	switch packet.typ {
+	case sioConnect:
+		ns.connected = true
+		queue := ns.queue
+		ns.queue = nil
+		for _, queued := range queue {
+			queuedPacket, err := parseSocketIOPacket(queued[1:])
+			if err != nil {
+				continue
+			}
+			ns.send(queued, queuedPacket.ackID)
+		}
+		ns.handleEvent("connect")
+
+	case sioDisconnect:
+		ns.connected = false
+		ns.handleEvent("disconnect")
+
+	case sioConnectError:
+		var data interface{}
+		if err := json.Unmarshal([]byte(packet.data), &data); err != nil {
+			data = packet.data
+		}
+		ns.handleEvent("connect_error", rt.ToValue(data))
+
+	case sioEvent:
+		args, err := decodeSocketIOArgs(rt, packet.data)
+		if err != nil || len(args) == 0 {
+			ns.io.emitError(fmt.Errorf("invalid Socket.IO event '%s'", packet.data))
+			return
+		}
+		if packet.ackID >= 0 {
+			ackID := packet.ackID
+			args = append(args, rt.ToValue(func(call goja.FunctionCall) goja.Value {
+				data, err := encodeSocketIOArgs(call.Arguments)
+				if err != nil {
+					common.Throw(rt, err)
+				}
+				ns.io.socket.Send(ns.encode(sioAck, ackID, data))
+				return goja.Undefined()
+			}))
+		}
+		ns.handleEvent(args[0].String(), args[1:]...)
+
+	case sioAck:
+		ack, ok := ns.acks[packet.ackID]
+		if !ok {
+			return
+		}
+		delete(ns.acks, packet.ackID)
+		ns.io.socket.timings = append(ns.io.socket.timings, socketTiming{
+			metric: metrics.WSSocketIOAck, start: ack.sent, end: time.Now(),
+		})
+		args, err := decodeSocketIOArgs(rt, packet.data)
+		if err != nil {
+			ns.io.emitError(fmt.Errorf("invalid Socket.IO ack '%s'", packet.data))
+			return
+		}
+		if _, err := ack.callback(goja.Undefined(), args...); err != nil {
+			common.Throw(rt, err)
+		}
+
+	default:
+		ns.io.emitError(fmt.Errorf("unsupported Socket.IO packet type '%c', binary packets aren't supported", packet.typ))
+	}
+}
+
+func (ns *SocketIONamespace) handleEvent(event string, args ...goja.Value) {
+	for _, handler := range ns.handlers[event] {
+		if _, err := handler(goja.Undefined(), args...); err != nil {
+			common.Throw(ns.rt(), err)
+		}
+	}
+}
+
+func encodeSocketIOArgs(args []goja.Value) (string, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Export()
+	}
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+func decodeSocketIOArgs(rt *goja.Runtime, data string) ([]goja.Value, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var values []interface{}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return nil, err
+	}
+	args := make([]goja.Value, len(values))
+	for i, value := range values {
+		args[i] = rt.ToValue(value)
+	}
+	return args, nil
+}
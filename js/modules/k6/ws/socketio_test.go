@@ -0,0 +1,203 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketIOURL(t *testing.T) {
+	testdata := map[string]struct {
+		url string
+		eio int
+	}{
+		"http://example.com":                 {"ws://example.com/socket.io/?EIO=4&transport=websocket", 4},
+		"https://example.com/":               {"wss://example.com/socket.io/?EIO=4&transport=websocket", 4},
+		"ws://example.com/custom/?token=abc": {"ws://example.com/custom/?EIO=4&token=abc&transport=websocket", 4},
+		"wss://example.com/?EIO=3":           {"wss://example.com/socket.io/?EIO=3&transport=websocket", 3},
+	}
+	for rawurl, expected := range testdata {
+		url, eio, err := socketIOURL(rawurl)
+		require.NoError(t, err, rawurl)
+		assert.Equal(t, expected.url, url)
+		assert.Equal(t, expected.eio, eio)
+	}
+
+	_, _, err := socketIOURL("ws://example.com/?EIO=2")
+	assert.EqualError(t, err, "unsupported Engine.IO protocol version '2', only 3 and 4 are supported")
+}
+
+func TestParseSocketIOPacket(t *testing.T) {
+	testdata := map[string]socketIOPacket{
+		"0":                    {sioConnect, "/", -1, ""},
+		`0/admin,{"sid":"a"}`:  {sioConnect, "/admin", -1, `{"sid":"a"}`},
+		"1/admin":              {sioDisconnect, "/admin", -1, ""},
+		`2["msg",1]`:           {sioEvent, "/", -1, `["msg",1]`},
+		`212["msg"]`:           {sioEvent, "/", 12, `["msg"]`},
+		`3/admin,7["ok"]`:      {sioAck, "/admin", 7, `["ok"]`},
+		`4{"message":"nope"}`:  {sioConnectError, "/", -1, `{"message":"nope"}`},
+		`2/chat?x=1,3["m",{}]`: {sioEvent, "/chat?x=1", 3, `["m",{}]`},
+	}
+	for msg, expected := range testdata {
+		packet, err := parseSocketIOPacket(msg)
+		require.NoError(t, err, msg)
+		assert.Equal(t, expected, packet, msg)
+	}
+
+	_, err := parseSocketIOPacket("")
+	assert.Error(t, err)
+}
+
+func TestSocketIO(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	var mutex sync.Mutex
+	var received []string
+	serverDone := make(chan struct{})
+	tb.Mux.HandleFunc("/socket.io/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("EIO") != "4" || req.URL.Query().Get("transport") != "websocket" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close(); close(serverDone) }()
+
+		send := func(msg string) { _ = conn.WriteMessage(websocket.TextMessage, []byte(msg)) }
+		send(`0{"sid":"s1","upgrades":[],"pingInterval":50,"pingTimeout":1000}`)
+		send("2")
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg := string(data)
+			mutex.Lock()
+			received = append(received, msg)
+			mutex.Unlock()
+
+			switch msg {
+			case "40":
+				send(`40{"sid":"a"}`)
+			case "40/admin,":
+				send(`40/admin,{"sid":"b"}`)
+			case `42["hello","world"]`:
+				send(`42["hello back",{"to":"world"}]`)
+			case `420["ping me",1]`:
+				time.Sleep(10 * time.Millisecond)
+				send(`430[2]`)
+			case `42/admin,["ask"]`:
+				send(`42/admin,5["question","why?"]`)
+			case `43/admin,5["because"]`:
+				send(`42/admin,["thanks"]`)
+			}
+		}
+	})
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:   root,
+		Dialer:  tb.Dialer,
+		Options: lib.Options{SystemTags: lib.GetTagSet("url")},
+		Samples: samples,
+	}
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("ws", common.Bind(rt, New(), &ctx))
+
+	_, err = common.RunString(rt, fmt.Sprintf(`
+	let gotHello = false, acked = false, thanked = false;
+	let res = ws.socketIO("%s", function(socket) {
+		let admin = socket.of("admin");
+		socket.emit("early");
+		socket.on("connect", function() {
+			socket.emit("hello", "world");
+			socket.emit("ping me", 1, function(v) {
+				if (v !== 2) { throw new Error("wrong ack: " + v); }
+				acked = true;
+			});
+		});
+		socket.on("hello back", function(data) {
+			if (data.to !== "world") { throw new Error("wrong data: " + JSON.stringify(data)); }
+			gotHello = true;
+		});
+		socket.on("error", function(e) { throw new Error("unexpected error: " + e); });
+		admin.on("connect", function() { admin.emit("ask"); });
+		admin.on("question", function(q, ack) {
+			if (q !== "why?") { throw new Error("wrong question: " + q); }
+			ack("because");
+		});
+		admin.on("thanks", function() { thanked = true; });
+		socket.setInterval(function() {
+			if (gotHello && acked && thanked) { socket.close(); }
+		}, 10);
+		socket.setTimeout(function() { throw new Error("timed out"); }, 5000);
+	});
+	if (res.status != 101) { throw new Error("wrong status: " + res.status); }
+	`, tb.ServerHTTP.URL))
+	require.NoError(t, err)
+
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't see the connection getting closed")
+	}
+	mutex.Lock()
+	assert.Contains(t, received, "3")
+	assert.Contains(t, received, `42["early"]`)
+	assert.Contains(t, received, "41")
+	assert.Contains(t, received, "41/admin,")
+	mutex.Unlock()
+
+	var seenAck bool
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric == metrics.WSSocketIOAck {
+				seenAck = true
+				assert.True(t, sample.Value >= 10, "ack duration %f", sample.Value)
+			}
+		}
+	}
+	assert.True(t, seenAck)
+}
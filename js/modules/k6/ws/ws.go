@@ -24,9 +24,12 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -45,11 +48,44 @@ var ErrWSInInitContext = common.NewInitContextError("using websockets in the ini
 
 type WS struct{}
 
+// The WebSocket connections that a VU has kept open for reuse in its later iterations, by URL.
+// They're kept in the resources of the VU, so they're closed when the VU is discarded.
+type reusableConns struct {
+	mutex sync.Mutex
+	conns map[string]*wsConn
+}
+
+// getReusableConns returns the reusable connections of the VU, or nil if it can't keep any.
+func getReusableConns(state *lib.State) *reusableConns {
+	if state.Resources == nil {
+		return nil
+	}
+	return state.Resources.Get("k6/ws", func() io.Closer {
+		return &reusableConns{conns: make(map[string]*wsConn)}
+	}).(*reusableConns)
+}
+
 type pingDelta struct {
 	ping time.Time
 	pong time.Time
 }
 
+// wsConn is an established WebSocket connection, along with everything that's needed to
+// continue using it in a later ws.connect() call, if it's reused.
+type wsConn struct {
+	conn     *websocket.Conn
+	response *WSHTTPResponse
+	tags     map[string]string // connection-specific system tags, e.g. status and ip
+	broken   bool              // closed by the server or failed, can't be reused
+
+	pingChan      chan string
+	pongChan      chan string
+	readDataChan  chan []byte
+	readCloseChan chan int
+	readErrChan   chan error
+	readDone      chan struct{}
+}
+
 type Socket struct {
 	ctx           context.Context
 	conn          *websocket.Conn
@@ -57,6 +93,8 @@ type Socket struct {
 	scheduled     chan goja.Callable
 	done          chan struct{}
 	shutdownOnce  sync.Once
+	reusable      bool
+	released      bool
 
 	msgSentTimestamps     []time.Time
 	msgReceivedTimestamps []time.Time
@@ -64,6 +102,14 @@ type Socket struct {
 	pingSendTimestamps map[string]time.Time
 	pingSendCounter    int
 	pingTimestamps     []pingDelta
+
+	// Timings that are measured by the protocol helpers, e.g. the Socket.IO acks
+	timings []socketTiming
+}
+
+type socketTiming struct {
+	metric     *stats.Metric
+	start, end time.Time
 }
 
 type WSHTTPResponse struct {
@@ -76,11 +122,15 @@ type WSHTTPResponse struct {
 
 const writeWait = 10 * time.Second
 
+// compressionDeflate is the value of the compression param and system tag for connections
+// with the permessage-deflate extension, which is the only one that's supported.
+const compressionDeflate = "deflate"
+
 func New() *WS {
 	return &WS{}
 }
 
-func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTPResponse, error) {
+func (w *WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTPResponse, error) {
 	rt := common.GetRuntime(ctx)
 	state := lib.GetState(ctx)
 	if state == nil {
@@ -108,8 +158,11 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 
 	// Leave header to nil by default so we can pass it directly to the Dialer
 	var header http.Header
+	var reuse bool
+	var subprotocols []string
+	var compression string
 
-	tags := state.Options.RunTags.CloneTags()
+	tags := state.CloneTags()
 
 	// Parse the optional second argument (params)
 	if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
@@ -127,7 +180,29 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 					continue
 				}
 				for _, key := range headersObj.Keys() {
-					header.Set(key, headersObj.Get(key).String())
+					// Arrays are sent as repeated headers, e.g. for multiple cookies
+					switch v := headersObj.Get(key).Export().(type) {
+					case []interface{}:
+						for _, item := range v {
+							header.Add(key, fmt.Sprint(item))
+						}
+					default:
+						header.Set(key, headersObj.Get(key).String())
+					}
+				}
+			case "subprotocols":
+				subprotocolsV := params.Get(k)
+				if goja.IsUndefined(subprotocolsV) || goja.IsNull(subprotocolsV) {
+					continue
+				}
+				if err := rt.ExportTo(subprotocolsV, &subprotocols); err != nil {
+					return nil, fmt.Errorf("invalid ws.connect subprotocols: %s", err)
+				}
+			case "compression":
+				compression = params.Get(k).String()
+				if compression != compressionDeflate && compression != "" {
+					return nil, fmt.Errorf("unsupported ws.connect compression '%s', only '%s' is supported",
+						compression, compressionDeflate)
 				}
 			case "tags":
 				tagsV := params.Get(k)
@@ -141,6 +216,8 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 				for _, key := range tagObj.Keys() {
 					tags[key] = tagObj.Get(key).String()
 				}
+			case "reuse":
+				reuse = params.Get(k).ToBoolean()
 			}
 		}
 
@@ -161,21 +238,46 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 
 	// Overriding the NextProtos to avoid talking http2
 	var tlsConfig *tls.Config
-	if state.TLSConfig != nil {
-		tlsConfig = state.TLSConfig.Clone()
+	baseTLSConfig := state.TLSConfig
+	if state.HostTLSConfig != nil {
+		if u, err := neturl.Parse(url); err == nil {
+			baseTLSConfig = state.HostTLSConfig(u.Hostname())
+		}
+	}
+	if baseTLSConfig != nil {
+		tlsConfig = baseTLSConfig.Clone()
 		tlsConfig.NextProtos = []string{"http/1.1"}
 	}
 
 	wsd := websocket.Dialer{
-		NetDial:         netDial,
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: tlsConfig,
+		NetDial:           netDial,
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig,
+		Subprotocols:      subprotocols,
+		EnableCompression: compression == compressionDeflate,
 	}
 
+	// Only dial a new connection if there isn't one left open by a previous iteration
 	start := time.Now()
-	conn, httpResponse, connErr := wsd.Dial(url, header)
-	connectionEnd := time.Now()
-	connectionDuration := stats.D(connectionEnd.Sub(start))
+	var wc *wsConn
+	reusable := getReusableConns(state)
+	if reusable == nil {
+		reuse = false
+	}
+	if reuse {
+		wc = reusable.take(url)
+	}
+	isNewConn := wc == nil
+	var conn *websocket.Conn
+	var httpResponse *http.Response
+	var connErr error
+	var connectionDuration float64
+	if isNewConn {
+		conn, httpResponse, connErr = wsd.Dial(url, header)
+		connectionDuration = stats.D(time.Since(start))
+	} else {
+		conn = wc.conn
+	}
 
 	socket := Socket{
 		ctx:                ctx,
@@ -184,16 +286,14 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 		pingSendTimestamps: make(map[string]time.Time),
 		scheduled:          make(chan goja.Callable),
 		done:               make(chan struct{}),
-	}
-
-	if state.Options.SystemTags["ip"] && conn.RemoteAddr() != nil {
-		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
-			tags["ip"] = ip
-		}
+		reusable:           reuse,
 	}
 
 	// Run the user-provided set up function
 	if _, err := setupFn(goja.Undefined(), rt.ToValue(&socket)); err != nil {
+		if !isNewConn {
+			_ = conn.Close()
+		}
 		return nil, err
 	}
 
@@ -204,42 +304,34 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 		return nil, connErr
 	}
 
-	wsResponse, wsRespErr := wrapHTTPResponse(httpResponse)
-	if wsRespErr != nil {
-		return nil, wsRespErr
-	}
-	wsResponse.URL = url
-
-	defer func() { _ = conn.Close() }()
-
-	if state.Options.SystemTags["status"] {
-		tags["status"] = strconv.Itoa(httpResponse.StatusCode)
+	if isNewConn {
+		var err error
+		if wc, err = newWSConn(conn, httpResponse, url, state.Options.SystemTags); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
 	}
-	if state.Options.SystemTags["subproto"] {
-		tags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
+	for k, v := range wc.tags {
+		tags[k] = v
 	}
 
+	// Keep the connection open for the next iterations if the socket was released
+	defer func() {
+		if socket.released && !wc.broken {
+			reusable.put(url, wc)
+		} else {
+			_ = conn.Close()
+		}
+	}()
+
 	// The connection is now open, emit the event
 	socket.handleEvent("open")
 
-	// Pass ping/pong events through the main control loop
-	pingChan := make(chan string)
-	pongChan := make(chan string)
-	conn.SetPingHandler(func(msg string) error { pingChan <- msg; return nil })
-	conn.SetPongHandler(func(pingID string) error { pongChan <- pingID; return nil })
-
-	readDataChan := make(chan []byte)
-	readCloseChan := make(chan int)
-	readErrChan := make(chan error)
-
-	// Wraps a couple of channels around conn.ReadMessage
-	go readPump(conn, readDataChan, readErrChan, readCloseChan)
-
 	// This is the main control loop. All JS code (including error handlers)
 	// should only be executed by this thread to avoid race conditions
 	for {
 		select {
-		case pingData := <-pingChan:
+		case pingData := <-wc.pingChan:
 			// Handle pings received from the server
 			// - trigger the `ping` event
 			// - reply with pong (needed when `SetPingHandler` is overwritten)
@@ -249,20 +341,22 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 			}
 			socket.handleEvent("ping")
 
-		case pingID := <-pongChan:
+		case pingID := <-wc.pongChan:
 			// Handle pong responses to our pings
 			socket.trackPong(pingID)
 			socket.handleEvent("pong")
 
-		case readData := <-readDataChan:
+		case readData := <-wc.readDataChan:
 			socket.msgReceivedTimestamps = append(socket.msgReceivedTimestamps, time.Now())
 			socket.handleEvent("message", rt.ToValue(string(readData)))
 
-		case readErr := <-readErrChan:
+		case readErr := <-wc.readErrChan:
+			wc.broken = true
 			socket.handleEvent("error", rt.ToValue(readErr))
 
-		case readClose := <-readCloseChan:
+		case readClose := <-wc.readCloseChan:
 			// handle server close
+			wc.broken = true
 			socket.handleEvent("close", rt.ToValue(readClose))
 
 		case scheduledFn := <-socket.scheduled:
@@ -282,14 +376,21 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 
 			sampleTags := stats.IntoSampleTags(&tags)
 
+			sessionSamples := []stats.Sample{
+				{Metric: metrics.WSSessions, Time: start, Tags: sampleTags, Value: 1},
+			}
+			if isNewConn {
+				sessionSamples = append(sessionSamples,
+					stats.Sample{Metric: metrics.WSConnecting, Time: start, Tags: sampleTags, Value: connectionDuration},
+				)
+			}
+			sessionSamples = append(sessionSamples,
+				stats.Sample{Metric: metrics.WSSessionDuration, Time: start, Tags: sampleTags, Value: sessionDuration},
+			)
 			stats.PushIfNotCancelled(ctx, state.Samples, stats.ConnectedSamples{
-				Samples: []stats.Sample{
-					{Metric: metrics.WSSessions, Time: start, Tags: sampleTags, Value: 1},
-					{Metric: metrics.WSConnecting, Time: start, Tags: sampleTags, Value: connectionDuration},
-					{Metric: metrics.WSSessionDuration, Time: start, Tags: sampleTags, Value: sessionDuration},
-				},
-				Tags: sampleTags,
-				Time: start,
+				Samples: sessionSamples,
+				Tags:    sampleTags,
+				Time:    start,
 			})
 
 			for _, msgSentTimestamp := range socket.msgSentTimestamps {
@@ -319,11 +420,140 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 				})
 			}
 
-			return wsResponse, nil
+			for _, timing := range socket.timings {
+				stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+					Metric: timing.metric,
+					Time:   timing.end,
+					Tags:   sampleTags,
+					Value:  stats.D(timing.end.Sub(timing.start)),
+				})
+			}
+
+			return wc.response, nil
+		}
+	}
+}
+
+// Reset closes all of the WebSocket connections that the current VU has kept open for reuse.
+func (w *WS) Reset(ctx context.Context) {
+	if state := lib.GetState(ctx); state != nil {
+		if reusable := getReusableConns(state); reusable != nil {
+			_ = reusable.Close()
 		}
 	}
 }
 
+// Close closes all of the connections, which is done when the VU is discarded or ws.reset() is called.
+func (rc *reusableConns) Close() error {
+	rc.mutex.Lock()
+	conns := rc.conns
+	rc.conns = make(map[string]*wsConn)
+	rc.mutex.Unlock()
+
+	for _, wc := range conns {
+		_ = wc.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+			time.Now().Add(writeWait),
+		)
+		_ = wc.conn.Close()
+	}
+	return nil
+}
+
+// Returns the connection to the specified URL that was left open by a previous iteration of the
+// VU, if there is one that's still usable.
+func (rc *reusableConns) take(url string) *wsConn {
+	rc.mutex.Lock()
+	wc := rc.conns[url]
+	delete(rc.conns, url)
+	rc.mutex.Unlock()
+
+	if wc == nil {
+		return nil
+	}
+	select {
+	case <-wc.readDone:
+		// The connection was silently closed in the meantime
+		_ = wc.conn.Close()
+		return nil
+	default:
+		return wc
+	}
+}
+
+func (rc *reusableConns) put(url string, wc *wsConn) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if old := rc.conns[url]; old != nil {
+		// Only a single connection per URL is kept, so close any extra ones
+		_ = old.conn.Close()
+	}
+	rc.conns[url] = wc
+}
+
+// Wraps a newly established connection and starts reading from it
+func newWSConn(conn *websocket.Conn, httpResponse *http.Response, url string, systemTags lib.TagSet) (*wsConn, error) {
+	wsResponse, err := wrapHTTPResponse(httpResponse)
+	if err != nil {
+		return nil, err
+	}
+	wsResponse.URL = url
+
+	wc := &wsConn{
+		conn:     conn,
+		response: wsResponse,
+		tags:     make(map[string]string),
+
+		pingChan:      make(chan string),
+		pongChan:      make(chan string),
+		readDataChan:  make(chan []byte),
+		readCloseChan: make(chan int),
+		readErrChan:   make(chan error),
+		readDone:      make(chan struct{}),
+	}
+
+	if systemTags["ip"] && conn.RemoteAddr() != nil {
+		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			wc.tags["ip"] = ip
+		}
+	}
+	if systemTags["status"] {
+		wc.tags["status"] = strconv.Itoa(httpResponse.StatusCode)
+	}
+	if systemTags["subproto"] {
+		wc.tags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
+	}
+	if systemTags["compression"] {
+		wc.tags["compression"] = negotiatedCompression(httpResponse.Header)
+	}
+
+	// Pass ping/pong events through the main control loop
+	conn.SetPingHandler(func(msg string) error { wc.pingChan <- msg; return nil })
+	conn.SetPongHandler(func(pingID string) error { wc.pongChan <- pingID; return nil })
+
+	// Wraps a couple of channels around conn.ReadMessage
+	go func() {
+		defer close(wc.readDone)
+		readPump(conn, wc.readDataChan, wc.readErrChan, wc.readCloseChan)
+	}()
+
+	return wc, nil
+}
+
+// negotiatedCompression returns compressionDeflate if the server accepted the permessage-deflate
+// extension in the handshake response headers h, or an empty string otherwise.
+func negotiatedCompression(h http.Header) string {
+	for _, value := range h["Sec-Websocket-Extensions"] {
+		for _, ext := range strings.Split(value, ",") {
+			if strings.TrimSpace(strings.SplitN(ext, ";", 2)[0]) == "permessage-deflate" {
+				return compressionDeflate
+			}
+		}
+	}
+	return ""
+}
+
 func (s *Socket) On(event string, handler goja.Value) {
 	if handler, ok := goja.AssertFunction(handler); ok {
 		s.eventHandlers[event] = append(s.eventHandlers[event], handler)
@@ -415,6 +645,21 @@ func (s *Socket) SetInterval(fn goja.Callable, intervalMs int) {
 	}()
 }
 
+// Release ends the current session, but keeps the connection open, so it can be reused by the
+// next ws.connect() call to the same URL with `reuse: true`, e.g. in the next VU iteration.
+// It's the same as Close() for connections that weren't opened with `reuse: true`.
+func (s *Socket) Release() {
+	if !s.reusable {
+		_ = s.closeConnection(websocket.CloseGoingAway)
+		return
+	}
+	s.shutdownOnce.Do(func() {
+		s.released = true
+		// Stops the main control loop
+		close(s.done)
+	})
+}
+
 func (s *Socket) Close(args ...goja.Value) {
 	code := websocket.CloseGoingAway
 	if len(args) > 0 {
@@ -24,12 +24,15 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
@@ -467,3 +470,203 @@ func TestTLSConfig(t *testing.T) {
 	})
 	assertSessionMetricsEmitted(t, stats.GetBufferedSamples(samples), "", url, 101, "")
 }
+
+func TestReuse(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	var connections, closed int64
+	tb.Mux.HandleFunc("/ws-echo-all", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, w.Header())
+		if !assert.NoError(t, err) {
+			return
+		}
+		atomic.AddInt64(&connections, 1)
+		for {
+			mt, message, err := conn.ReadMessage()
+			if err != nil {
+				atomic.AddInt64(&closed, 1)
+				return
+			}
+			if err := conn.WriteMessage(mt, message); err != nil {
+				return
+			}
+		}
+	})
+	url := makeWsProto(tb.ServerHTTP.URL) + "/ws-echo-all"
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:     root,
+		Dialer:    tb.Dialer,
+		Options:   lib.Options{SystemTags: lib.GetTagSet("url", "status")},
+		Samples:   samples,
+		Resources: lib.NewVUResources(),
+	}
+
+	ctx := context.Background()
+	ctx = lib.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+
+	rt.Set("ws", common.Bind(rt, New(), &ctx))
+
+	script := fmt.Sprintf(`
+	let res = ws.connect("%s", { reuse: true }, function(socket){
+		socket.on("open", function() {
+			socket.send("test")
+		});
+		socket.on("message", function (data){
+			if (data != "test") {
+				throw new Error ("echo'd data doesn't match our message!");
+			}
+			socket.release()
+		});
+	});
+	if (res.status != 101) { throw new Error("connection failed with status: " + res.status); }
+	`, url)
+
+	countConnecting := func() (connecting int) {
+		for _, sampleContainer := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sampleContainer.GetSamples() {
+				if sample.Metric == metrics.WSConnecting {
+					connecting++
+				}
+			}
+		}
+		return connecting
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = common.RunString(rt, script)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&connections))
+	assert.Equal(t, 1, countConnecting())
+
+	_, err = common.RunString(rt, `ws.reset()`)
+	assert.NoError(t, err)
+	_, err = common.RunString(rt, script)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&connections))
+	assertSessionMetricsEmitted(t, stats.GetBufferedSamples(samples), "", url, 101, "")
+
+	// Without reuse, release() just closes the connection
+	_, err = common.RunString(rt, strings.Replace(script, "{ reuse: true }", "{}", 1))
+	assert.NoError(t, err)
+	_, err = common.RunString(rt, script)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&connections))
+	stats.GetBufferedSamples(samples)
+
+	// Discarding the VU closes the connection that it has kept open
+	assert.NoError(t, state.Resources.Close())
+	waitForClosed := func(expected int64) {
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt64(&closed) < expected && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, expected, atomic.LoadInt64(&closed))
+	}
+	waitForClosed(3)
+
+	// The VU can't keep any connections without resources, so each connection is closed
+	state.Resources = nil
+	for i := 0; i < 2; i++ {
+		_, err = common.RunString(rt, script)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(5), atomic.LoadInt64(&connections))
+	waitForClosed(5)
+	stats.GetBufferedSamples(samples)
+}
+
+func TestSubprotocolsAndCompression(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	var multiHeader []string
+	tb.Mux.HandleFunc("/ws-negotiate", func(w http.ResponseWriter, req *http.Request) {
+		multiHeader = req.Header["X-Multi"]
+		upgrader := websocket.Upgrader{Subprotocols: []string{"stomp", "mqtt"}, EnableCompression: true}
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		_, msg, err := conn.ReadMessage()
+		if err == nil {
+			_ = conn.WriteMessage(websocket.TextMessage, msg)
+		}
+		_ = conn.Close()
+	})
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:   root,
+		Dialer:  tb.Dialer,
+		Options: lib.Options{SystemTags: lib.GetTagSet("subproto", "compression")},
+		Samples: samples,
+	}
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("ws", common.Bind(rt, New(), &ctx))
+
+	url := makeWsProto(tb.ServerHTTP.URL) + "/ws-negotiate"
+	t.Run("negotiated", func(t *testing.T) {
+		_, err := common.RunString(rt, fmt.Sprintf(`
+		let params = { subprotocols: ["mqtt", "wamp"], compression: "deflate", headers: { "X-Multi": ["a", "b"] } };
+		let res = ws.connect("%s", params, function(socket) {
+			socket.on("open", function() { socket.send("hello"); });
+			socket.on("message", function(data) {
+				if (data !== "hello") { throw new Error("unexpected message: " + data); }
+				socket.close();
+			});
+		});
+		if (res.status != 101) { throw new Error("wrong status: " + res.status); }
+		`, url))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, multiHeader)
+
+		var seen bool
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sc.GetSamples() {
+				if sample.Metric != metrics.WSSessions {
+					continue
+				}
+				seen = true
+				assert.Equal(t, map[string]string{"subproto": "mqtt", "compression": "deflate"}, sample.Tags.CloneTags())
+			}
+		}
+		assert.True(t, seen)
+	})
+	t.Run("not negotiated", func(t *testing.T) {
+		_, err := common.RunString(rt, fmt.Sprintf(`
+		ws.connect("%s", function(socket) {
+			socket.on("open", function() { socket.close(); });
+		});
+		`, url))
+		assert.NoError(t, err)
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, sample := range sc.GetSamples() {
+				if sample.Metric == metrics.WSSessions {
+					assert.Equal(t, map[string]string{"subproto": "", "compression": ""}, sample.Tags.CloneTags())
+				}
+			}
+		}
+	})
+	t.Run("invalid compression", func(t *testing.T) {
+		_, err := common.RunString(rt, fmt.Sprintf(`
+		ws.connect("%s", { compression: "brotli" }, function(socket) {});
+		`, url))
+		assert.Contains(t, err.Error(), "unsupported ws.connect compression 'brotli'")
+	})
+}
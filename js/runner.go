@@ -24,28 +24,38 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/stats"
 	"github.com/oxtoacart/bpool"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
-	"github.com/viki-org/dnscache"
 	"golang.org/x/net/http2"
-	"golang.org/x/time/rate"
 )
 
 var errInterrupt = errors.New("context cancelled")
 
+// expectContinueTimeout is how long requests with an "Expect: 100-continue" header wait for the
+// server's 100 Continue response, the same as in Go's default HTTP transport.
+const expectContinueTimeout = time.Second
+
 // Ensure Runner implements the lib.Runner interface
 var _ lib.Runner = &Runner{}
 
@@ -55,13 +65,21 @@ type Runner struct {
 	defaultGroup *lib.Group
 
 	BaseDialer net.Dialer
-	Resolver   *dnscache.Resolver
-	RPSLimit   *rate.Limiter
+	Resolver   netext.Resolver
 
 	console   *console
 	setupData []byte
+	hostStats *lib.HostStats
+
+	// When the background jobs with the test scope are due next, by name.
+	testJobs   map[string]time.Time
+	testJobsMu sync.Mutex
 }
 
+// Ensure Runner implements the lib.HostStatsRunner and lib.MetricRegistryRunner interfaces
+var _ lib.HostStatsRunner = &Runner{}
+var _ lib.MetricRegistryRunner = &Runner{}
+
 func New(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Runner, error) {
 	bundle, err := NewBundle(src, fs, rtOpts)
 	if err != nil {
@@ -93,14 +111,24 @@ func NewFromBundle(b *Bundle) (*Runner, error) {
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		},
-		console:  newConsole(),
-		Resolver: dnscache.New(0),
+		console:   newConsole(),
+		hostStats: lib.NewHostStats(),
 	}
 
 	err = r.SetOptions(r.Bundle.Options)
 	return r, err
 }
 
+// GetHostStats returns the live connection and request counts per host of all VUs.
+func (r *Runner) GetHostStats() *lib.HostStats {
+	return r.hostStats
+}
+
+// GetMetricRegistry returns the registry of the builtin metrics and the custom ones of the script.
+func (r *Runner) GetMetricRegistry() *stats.Registry {
+	return r.Bundle.Registry
+}
+
 func (r *Runner) MakeArchive() *lib.Archive {
 	return r.Bundle.makeArchive()
 }
@@ -130,45 +158,46 @@ func (r *Runner) newVU(samplesOut chan<- stats.SampleContainer) (*VU, error) {
 		tlsVersions = *r.Bundle.Options.TLSVersion
 	}
 
-	tlsAuth := r.Bundle.Options.TLSAuth
-	certs := make([]tls.Certificate, len(tlsAuth))
-	nameToCert := make(map[string]*tls.Certificate)
-	for i, auth := range tlsAuth {
-		for _, name := range auth.Domains {
-			cert, err := auth.Certificate()
-			if err != nil {
-				return nil, err
-			}
-			certs[i] = *cert
-			nameToCert[name] = &certs[i]
-		}
-	}
-
 	dialer := &netext.Dialer{
-		Dialer:    r.BaseDialer,
-		Resolver:  r.Resolver,
-		Blacklist: r.Bundle.Options.BlacklistIPs,
-		Hosts:     r.Bundle.Options.Hosts,
+		Dialer:           r.BaseDialer,
+		Resolver:         r.Resolver,
+		Blacklist:        r.Bundle.Options.BlacklistIPs,
+		BlockedHostnames: r.Bundle.Options.BlockHostnames,
+		Hosts:            r.Bundle.Options.Hosts,
+		LocalIPs:         r.Bundle.Options.LocalIPs,
+		HostStats:        r.hostStats,
+
+		HappyEyeballsDelay: time.Duration(r.Bundle.Options.HappyEyeballs.Duration),
 	}
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: r.Bundle.Options.InsecureSkipTLSVerify.Bool,
 		CipherSuites:       cipherSuites,
 		MinVersion:         uint16(tlsVersions.Min),
 		MaxVersion:         uint16(tlsVersions.Max),
-		Certificates:       certs,
-		NameToCertificate:  nameToCert,
 		Renegotiation:      tls.RenegotiateFreelyAsClient,
 	}
-	transport := &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
-		TLSClientConfig:     tlsConfig,
-		DialContext:         dialer.DialContext,
-		DisableCompression:  true,
-		DisableKeepAlives:   r.Bundle.Options.NoConnectionReuse.Bool,
-		MaxIdleConns:        int(r.Bundle.Options.Batch.Int64),
-		MaxIdleConnsPerHost: int(r.Bundle.Options.BatchPerHost.Int64),
+	if r.Bundle.Options.TLSCACerts != nil {
+		if tlsConfig.RootCAs, err = r.Bundle.Options.TLSCACerts.CertPool(); err != nil {
+			return nil, err
+		}
+	}
+	tlsConfigs, err := r.tlsConfigs(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := r.newTransport(dialer, tlsConfigs, lib.ConnectionPool{})
+	if err != nil {
+		return nil, err
+	}
+	var pools map[string]http.RoundTripper
+	for name, pool := range r.Bundle.Options.ConnectionPools {
+		if pools == nil {
+			pools = make(map[string]http.RoundTripper, len(r.Bundle.Options.ConnectionPools))
+		}
+		if pools[name], err = r.newTransport(dialer, tlsConfigs, *pool); err != nil {
+			return nil, errors.Wrapf(err, "connection pool '%s'", name)
+		}
 	}
-	_ = http2.ConfigureTransport(transport)
 
 	cookieJar, err := cookiejar.New(nil)
 	if err != nil {
@@ -179,12 +208,17 @@ func (r *Runner) newVU(samplesOut chan<- stats.SampleContainer) (*VU, error) {
 		BundleInstance: *bi,
 		Runner:         r,
 		Transport:      transport,
+		Pools:          pools,
 		Dialer:         dialer,
 		CookieJar:      cookieJar,
 		TLSConfig:      tlsConfig,
+		TLSConfigs:     tlsConfigs,
 		Console:        r.console,
 		BPool:          bpool.NewBufferPool(100),
 		Samples:        samplesOut,
+		Resources:      lib.NewVUResources(),
+		chaosRand:      r.Bundle.newChaosRandSource(0),
+		idsRand:        r.Bundle.newIDsRand(0),
 	}
 	vu.Runtime.Set("console", common.Bind(vu.Runtime, vu.Console, vu.Context))
 	common.BindToGlobal(vu.Runtime, map[string]interface{}{
@@ -201,6 +235,182 @@ func (r *Runner) newVU(samplesOut chan<- stats.SampleContainer) (*VU, error) {
 	return vu, nil
 }
 
+// newTransport makes the transport of a VU, or of one of its connection pools, with the pool's
+// settings on top of the global options.
+func (r *Runner) newTransport(
+	dialer *netext.Dialer, tlsConfigs *netext.TLSConfigs, pool lib.ConnectionPool,
+) (http.RoundTripper, error) {
+	proxy := http.ProxyFromEnvironment
+	if pool.Proxy.Valid {
+		proxy = nil
+		if pool.Proxy.String != "" {
+			proxyURL, err := url.Parse(pool.Proxy.String)
+			if err != nil {
+				return nil, err
+			}
+			proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	if pool.InsecureSkipTLSVerify.Valid || pool.TLSVersion != nil {
+		tlsConfig := tlsConfigs.Default.Clone()
+		if pool.InsecureSkipTLSVerify.Valid {
+			tlsConfig.InsecureSkipVerify = pool.InsecureSkipTLSVerify.Bool
+		}
+		if pool.TLSVersion != nil {
+			tlsConfig.MinVersion = uint16(pool.TLSVersion.Min)
+			tlsConfig.MaxVersion = uint16(pool.TLSVersion.Max)
+		}
+		// The per-host overrides still apply on top of the pool's TLS config.
+		tlsConfigs = &netext.TLSConfigs{Default: tlsConfig, Overrides: tlsConfigs.Overrides}
+	}
+	noConnectionReuse := r.Bundle.Options.NoConnectionReuse.Bool
+	if pool.NoConnectionReuse.Valid {
+		noConnectionReuse = pool.NoConnectionReuse.Bool
+	}
+
+	newTransport := func(tlsConfig *tls.Config) *http.Transport {
+		transport := &http.Transport{
+			Proxy:                 proxy,
+			TLSClientConfig:       tlsConfig,
+			DialContext:           dialer.DialContext,
+			DisableCompression:    true,
+			DisableKeepAlives:     noConnectionReuse,
+			MaxIdleConns:          int(r.Bundle.Options.Batch.Int64),
+			MaxIdleConnsPerHost:   int(r.Bundle.Options.BatchPerHost.Int64),
+			IdleConnTimeout:       time.Duration(pool.IdleTimeout.Duration),
+			ExpectContinueTimeout: expectContinueTimeout,
+		}
+		_ = http2.ConfigureTransport(transport)
+		return transport
+	}
+
+	var transport http.RoundTripper = newTransport(tlsConfigs.Default)
+	if len(tlsConfigs.Overrides) > 0 {
+		transport = &netext.HostsTransport{
+			Default:      transport.(*http.Transport),
+			TLSConfigs:   tlsConfigs,
+			NewTransport: newTransport,
+		}
+	}
+	return &netext.HostStatsTransport{Transport: transport, Stats: r.hostStats}, nil
+}
+
+// tlsConfigs returns the per-host TLS configs, which override the TLS versions and cipher suites
+// of the hosts in the tlsHosts option and present the client certificates in tlsAuth only to the
+// hosts they're configured for.
+func (r *Runner) tlsConfigs(tlsConfig *tls.Config) (*netext.TLSConfigs, error) {
+	configs := &netext.TLSConfigs{Default: tlsConfig}
+	for _, host := range r.Bundle.Options.TLSHosts {
+		host := host
+		configs.Overrides = append(configs.Overrides, netext.TLSOverride{
+			Patterns: host.Domains,
+			Apply: func(config *tls.Config) {
+				if host.TLSVersion != nil {
+					config.MinVersion = uint16(host.TLSVersion.Min)
+					config.MaxVersion = uint16(host.TLSVersion.Max)
+				}
+				if host.TLSCipherSuites != nil {
+					config.CipherSuites = *host.TLSCipherSuites
+				}
+			},
+		})
+	}
+	for _, auth := range r.Bundle.Options.TLSAuth {
+		cert, err := auth.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		configs.Overrides = append(configs.Overrides, netext.TLSOverride{
+			Patterns: auth.Domains,
+			Apply: func(config *tls.Config) {
+				config.Certificates = append(config.Certificates, *cert)
+			},
+		})
+	}
+	return configs, nil
+}
+
+// HealthCheck checks that the system under test is ready according to the healthCheck option,
+// retrying until the checks pass or the timeout is reached. The checks run in a VU of their own,
+// and their samples are discarded, since they aren't a part of the test.
+func (r *Runner) HealthCheck(ctx context.Context) error {
+	cfg := r.Bundle.Options.HealthCheck
+	if !cfg.IsEnabled() {
+		return nil
+	}
+
+	samples := make(chan stats.SampleContainer, 100)
+	defer close(samples)
+	go func() {
+		for range samples {
+		}
+	}()
+	vu, err := r.newVU(samples)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = vu.Close() }()
+
+	var fn goja.Callable
+	if name := cfg.Exec.String; name != "" {
+		var ok bool
+		if fn, ok = goja.AssertFunction(vu.Runtime.Get("exports").ToObject(vu.Runtime).Get(name)); !ok {
+			return errors.Errorf("the health check function '%s' isn't exported", name)
+		}
+	}
+	group, err := lib.NewGroup("healthCheck", r.GetDefaultGroup())
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Transport: vu.Transport}
+	var interruptOnce sync.Once
+	return cfg.Wait(ctx, func(ctx context.Context) error {
+		for _, u := range cfg.URLs {
+			if err := probeURL(ctx, client, u); err != nil {
+				return err
+			}
+		}
+		if fn == nil {
+			return nil
+		}
+
+		// The context is the same for all attempts, so a hanging check is interrupted at the timeout.
+		interruptOnce.Do(func() {
+			go func() {
+				<-ctx.Done()
+				vu.Runtime.Interrupt(errInterrupt)
+			}()
+		})
+		v, _, err := vu.runFn(ctx, group, fn)
+		if err != nil {
+			return err
+		}
+		if ready, ok := v.Export().(bool); ok && !ready {
+			return errors.Errorf("the health check function '%s' returned false", cfg.Exec.String)
+		}
+		return nil
+	})
+}
+
+// probeURL checks that a GET request to the URL gets a response with a status below 400.
+func probeURL(ctx context.Context, client *http.Client, u string) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("%s responded with the status %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
 func (r *Runner) Setup(ctx context.Context, out chan<- stats.SampleContainer) error {
 	setupCtx, setupCancel := context.WithTimeout(
 		ctx,
@@ -266,10 +476,7 @@ func (r *Runner) GetOptions() lib.Options {
 func (r *Runner) SetOptions(opts lib.Options) error {
 	r.Bundle.Options = opts
 
-	r.RPSLimit = nil
-	if rps := opts.RPS; rps.Valid {
-		r.RPSLimit = rate.NewLimiter(rate.Limit(rps.Int64), 1)
-	}
+	r.Resolver = netext.NewResolver(opts.DNS)
 
 	if opts.ConsoleOutput.Valid {
 		c, err := newFileConsole(opts.ConsoleOutput.String)
@@ -280,6 +487,46 @@ func (r *Runner) SetOptions(opts lib.Options) error {
 		r.console = c
 	}
 
+	return r.checkExecFunctions(opts)
+}
+
+// checkExecFunctions makes sure that the exec functions of all scenarios and jobs are exported, so a typo
+// fails the test before it starts instead of every iteration.
+func (r *Runner) checkExecFunctions(opts lib.Options) error {
+	var missing []string
+	var exports *goja.Object
+	for name, scenario := range opts.Execution {
+		exec := scenario.GetBaseConfig().Exec
+		if !exec.Valid {
+			continue
+		}
+		if exports == nil {
+			bi, err := r.Bundle.Instantiate()
+			if err != nil {
+				return err
+			}
+			exports = bi.Runtime.Get("exports").ToObject(bi.Runtime)
+		}
+		if _, ok := goja.AssertFunction(exports.Get(exec.String)); !ok {
+			missing = append(missing, fmt.Sprintf("'%s' (scenario '%s')", exec.String, name))
+		}
+	}
+	for name, job := range opts.Jobs {
+		if exports == nil {
+			bi, err := r.Bundle.Instantiate()
+			if err != nil {
+				return err
+			}
+			exports = bi.Runtime.Get("exports").ToObject(bi.Runtime)
+		}
+		if _, ok := goja.AssertFunction(exports.Get(job.GetExec(name))); !ok {
+			missing = append(missing, fmt.Sprintf("'%s' (job '%s')", job.GetExec(name), name))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("the script doesn't export the exec functions %s", strings.Join(missing, ", "))
+	}
 	return nil
 }
 
@@ -290,6 +537,7 @@ func (r *Runner) runPart(ctx context.Context, out chan<- stats.SampleContainer,
 	if err != nil {
 		return goja.Undefined(), err
 	}
+	defer func() { _ = vu.Close() }()
 	exp := vu.Runtime.Get("exports").ToObject(vu.Runtime)
 	if exp == nil {
 		return goja.Undefined(), nil
@@ -311,6 +559,7 @@ func (r *Runner) runPart(ctx context.Context, out chan<- stats.SampleContainer,
 		return goja.Undefined(), err
 	}
 
+	vu.stage = name
 	v, _, err := vu.runFn(ctx, group, fn, vu.Runtime.ToValue(arg))
 
 	// deadline is reached so we have timeouted but this might've not been registered correctly
@@ -329,20 +578,42 @@ type VU struct {
 	BundleInstance
 
 	Runner    *Runner
-	Transport *http.Transport
+	Transport http.RoundTripper
+	Pools     map[string]http.RoundTripper
 	Dialer    *netext.Dialer
 	CookieJar *cookiejar.Jar
 	TLSConfig *tls.Config
 	ID        int64
 	Iteration int64
 
+	// The per-host TLS configs, with the tlsHosts and tlsAuth options applied to TLSConfig.
+	TLSConfigs *netext.TLSConfigs
+
 	Console *console
 	BPool   *bpool.BufferPool
 
 	Samples chan<- stats.SampleContainer
 
+	// What the modules keep for the VU across its iterations, see lib.State.Resources.
+	Resources *lib.VUResources
+
+	// Picks the requests that faults are injected into, see lib.State.ChaosRand.
+	chaosRand goja.RandSource
+	// Generates the random bits of the k6/ids IDs with the seed option, see lib.State.IDsRand.
+	idsRand io.Reader
+
 	setupData goja.Value
 
+	// The scenario whose env variables are currently set in __ENV, if any.
+	envScenario string
+
+	// The lifecycle stage that the VU was created for, see lib.State.Stage.
+	stage string
+
+	// The background jobs of the jobs option, loaded before the first iteration.
+	jobs       []*vuJob
+	jobsLoaded bool
+
 	// A VU will track the last context it was called with for cancellation.
 	// Note that interruptTrackedCtx is the context that is currently being tracked, while
 	// interruptCancel cancels an unrelated context that terminates the tracking goroutine
@@ -354,13 +625,25 @@ type VU struct {
 	interruptCancel     context.CancelFunc
 }
 
-// Verify that VU implements lib.VU
+// Verify that VU implements lib.VU and lib.ClosableVU
 var _ lib.VU = &VU{}
+var _ lib.ClosableVU = &VU{}
+
+// Close releases what the modules kept for the VU across its iterations, e.g. the WebSocket
+// connections that were kept open for reuse.
+func (u *VU) Close() error {
+	return u.Resources.Close()
+}
 
 func (u *VU) Reconfigure(id int64) error {
 	u.ID = id
 	u.Iteration = 0
 	u.Runtime.Set("__VU", u.ID)
+	if u.Runner.Bundle.Options.Seed.Valid {
+		u.Runtime.SetRandSource(u.Runner.Bundle.newRandSource(id))
+		u.chaosRand = u.Runner.Bundle.newChaosRandSource(id)
+		u.idsRand = u.Runner.Bundle.newIDsRand(id)
+	}
 	return nil
 }
 
@@ -397,11 +680,104 @@ func (u *VU) RunOnce(ctx context.Context) error {
 		}
 	}
 
-	// Call the default function.
-	_, _, err := u.runFn(ctx, u.Runner.defaultGroup, u.Default, u.setupData)
+	// Run the background jobs that are due before the iteration.
+	if !u.jobsLoaded {
+		if err := u.loadJobs(); err != nil {
+			return err
+		}
+	}
+	if err := u.runDueJobs(ctx); err != nil {
+		return err
+	}
+
+	// Call the exec function of the scenario, or the default function.
+	fn, err := u.scenarioFn(ctx)
+	if err != nil {
+		return err
+	}
+	_, _, err = u.runFn(ctx, u.Runner.defaultGroup, fn, u.setupData)
 	return err
 }
 
+// scenarioFn returns the exported function that the iterations of the scenario in ctx should
+// run, and sets the env variables of the scenario in __ENV, on top of the global ones.
+func (u *VU) scenarioFn(ctx context.Context) (goja.Callable, error) {
+	scenario := lib.GetScenario(ctx)
+	if scenario == nil {
+		return u.Default, nil
+	}
+	config := scenario.GetBaseConfig()
+
+	if u.envScenario != config.Name {
+		u.envScenario = config.Name
+		env := u.Runner.Bundle.runtimeEnv()
+		if len(config.Env) > 0 {
+			scenarioEnv := make(map[string]string, len(env)+len(config.Env))
+			for k, v := range env {
+				scenarioEnv[k] = v
+			}
+			for k, v := range config.Env {
+				if _, ok := u.Runner.Bundle.Secrets[k]; !ok {
+					scenarioEnv[k] = v
+				}
+			}
+			env = scenarioEnv
+		}
+		u.Runtime.Set("__ENV", env)
+	}
+
+	if !config.Exec.Valid {
+		return u.Default, nil
+	}
+	fn, ok := goja.AssertFunction(u.Runtime.Get("exports").ToObject(u.Runtime).Get(config.Exec.String))
+	if !ok {
+		return nil, errors.Errorf("the exec function '%s' of the scenario '%s' isn't exported", config.Exec.String, config.Name)
+	}
+	return fn, nil
+}
+
+// newState returns the state of an iteration, or of a background job, of the VU.
+func (u *VU) newState(ctx context.Context, group *lib.Group, cookieJar *cookiejar.Jar) *lib.State {
+	state := &lib.State{
+		Logger:        u.Runner.Logger,
+		Options:       u.Runner.Bundle.Options,
+		Group:         group,
+		Transport:     u.Transport,
+		Pools:         u.Pools,
+		Dialer:        u.Dialer,
+		TLSConfig:     u.TLSConfig,
+		HostTLSConfig: u.TLSConfigs.For,
+		CookieJar:     cookieJar,
+		BPool:         u.BPool,
+		Vu:            u.ID,
+		Samples:       u.Samples,
+		Iteration:     u.Iteration,
+		Stage:         u.stage,
+		Resources:     u.Resources,
+		ChaosRand:     u.chaosRand,
+		IDsRand:       u.idsRand,
+		ExecAllow:     u.Runner.Bundle.ExecAllow,
+		ArtifactsDir:  u.Runner.Bundle.ArtifactsDir,
+
+		ResponseCallback: u.ResponseCallback,
+	}
+	if execTags := lib.GetExecutionTags(ctx); len(execTags) > 0 {
+		state.Tags = make(map[string]string, len(execTags))
+		for k, v := range execTags {
+			state.Tags[k] = v
+		}
+	}
+	return state
+}
+
+// newContext returns the context that the JS code runs with, for the given state.
+func (u *VU) newContext(ctx context.Context, state *lib.State) context.Context {
+	newctx := common.WithRuntime(ctx, u.Runtime)
+	newctx = lib.WithState(newctx, state)
+	newctx = lib.WithResponseCallback(newctx, &u.ResponseCallback)
+	return secrets.WithStore(newctx, u.Runner.Bundle.SecretStore)
+}
+
 func (u *VU) runFn(
 	ctx context.Context, group *lib.Group, fn goja.Callable, args ...goja.Value,
 ) (goja.Value, *lib.State, error) {
@@ -414,24 +790,11 @@ func (u *VU) runFn(
 		cookieJar = u.CookieJar
 	}
 
-	state := &lib.State{
-		Logger:    u.Runner.Logger,
-		Options:   u.Runner.Bundle.Options,
-		Group:     group,
-		Transport: u.Transport,
-		Dialer:    u.Dialer,
-		TLSConfig: u.TLSConfig,
-		CookieJar: cookieJar,
-		RPSLimit:  u.Runner.RPSLimit,
-		BPool:     u.BPool,
-		Vu:        u.ID,
-		Samples:   u.Samples,
-		Iteration: u.Iteration,
+	state := u.newState(ctx, group, cookieJar)
+	if len(u.jobs) > 0 {
+		state.SleepWithJobs = u.sleepWithJobs
 	}
-
-	newctx := common.WithRuntime(ctx, u.Runtime)
-	newctx = lib.WithState(newctx, state)
-	*u.Context = newctx
+	*u.Context = u.newContext(ctx, state)
 
 	u.Runtime.Set("__ITER", u.Iteration)
 	iter := u.Iteration
@@ -449,7 +812,7 @@ func (u *VU) runFn(
 		isFullIteration = true
 	}
 
-	tags := state.Options.RunTags.CloneTags()
+	tags := state.CloneTags()
 	if state.Options.SystemTags["vu"] {
 		tags["vu"] = strconv.FormatInt(u.ID, 10)
 	}
@@ -461,7 +824,14 @@ func (u *VU) runFn(
 	}
 
 	if u.Runner.Bundle.Options.NoVUConnectionReuse.Bool {
-		u.Transport.CloseIdleConnections()
+		if t, ok := u.Transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+		for _, pool := range u.Pools {
+			if t, ok := pool.(interface{ CloseIdleConnections() }); ok {
+				t.CloseIdleConnections()
+			}
+		}
 	}
 
 	state.Samples <- u.Dialer.GetTrail(startTime, endTime, isFullIteration, stats.IntoSampleTags(&tags))
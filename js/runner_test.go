@@ -23,20 +23,31 @@ package js
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"go/build"
 	"io/ioutil"
 	stdlog "log"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/loadimpact/k6/core"
 	"github.com/loadimpact/k6/core/local"
 	"github.com/loadimpact/k6/js/common"
@@ -46,6 +57,7 @@ import (
 	"github.com/loadimpact/k6/js/modules/k6/ws"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/scheduler"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
@@ -786,6 +798,35 @@ func TestVUIntegrationBlacklist(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationBlockHostnames(t *testing.T) {
+	r1, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+					import http from "k6/http";
+					export default function() { http.get("http://ads.doubleclick.net/"); }
+				`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, r1.SetOptions(lib.Options{
+		Throw:          null.BoolFrom(true),
+		BlockHostnames: []string{"*.doubleclick.net"},
+	}))
+
+	r2, err := NewFromArchive(r1.MakeArchive(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	runners := map[string]*Runner{"Source": r1, "Archive": r2}
+	for name, r := range runners {
+		t.Run(name, func(t *testing.T) {
+			vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+			require.NoError(t, err)
+			err = vu.RunOnce(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "hostname (ads.doubleclick.net) is in a blocked pattern (*.doubleclick.net)")
+		})
+	}
+}
+
 func TestVUIntegrationHosts(t *testing.T) {
 	tb := testutils.NewHTTPMultiBin(t)
 	defer tb.Cleanup()
@@ -809,8 +850,8 @@ func TestVUIntegrationHosts(t *testing.T) {
 
 	r1.SetOptions(lib.Options{
 		Throw: null.BoolFrom(true),
-		Hosts: map[string]net.IP{
-			"test.loadimpact.com": net.ParseIP("127.0.0.1"),
+		Hosts: map[string]types.HostAddresses{
+			"test.loadimpact.com": {{IP: net.ParseIP("127.0.0.1")}},
 		},
 	})
 
@@ -835,6 +876,392 @@ func TestVUIntegrationHosts(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationNoVUConnectionReuse(t *testing.T) {
+	var newConns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&newConns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+			import http from "k6/http";
+			export default function() {
+				http.get("%[1]s/a");
+				http.get("%[1]s/b");
+			}
+		`, srv.URL)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	for name, noVUConnReuse := range map[string]bool{"reuse": false, "no reuse": true} {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt64(&newConns, 0)
+			r.SetOptions(lib.Options{Throw: null.BoolFrom(true), NoVUConnectionReuse: null.BoolFrom(noVUConnReuse)})
+			vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+			require.NoError(t, err)
+			for i := 0; i < 3; i++ {
+				require.NoError(t, vu.RunOnce(context.Background()))
+			}
+
+			// The connection is always reused within an iteration, hence the 3 instead of 6.
+			expected := int64(1)
+			if noVUConnReuse {
+				expected = 3
+			}
+			assert.Equal(t, expected, atomic.LoadInt64(&newConns))
+		})
+	}
+}
+
+func TestVUIntegrationTLSHosts(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+			import http from "k6/http";
+			export default function() {
+				let legacy = http.get("https://legacy.k6.test:%[1]d/");
+				if (legacy.status !== 0 || !legacy.error) {
+					throw new Error("legacy request succeeded: " + legacy.status);
+				}
+				let modern = http.get("https://modern.k6.test:%[1]d/");
+				if (modern.status !== 200) {
+					throw new Error("modern request failed: " + modern.error);
+				}
+			}
+		`, port)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	legacyVersion := lib.TLSVersions{Min: tls.VersionTLS10, Max: tls.VersionTLS11}
+	r.SetOptions(lib.Options{
+		InsecureSkipTLSVerify: null.BoolFrom(true),
+		Hosts: map[string]types.HostAddresses{
+			"legacy.k6.test": {{IP: net.ParseIP("127.0.0.1")}},
+			"modern.k6.test": {{IP: net.ParseIP("127.0.0.1")}},
+		},
+		TLSHosts: []*lib.TLSHost{{Domains: []string{"legacy.k6.test"}, TLSVersion: &legacyVersion}},
+	})
+
+	vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	assert.NoError(t, vu.RunOnce(context.Background()))
+}
+
+func TestVUIntegrationConnectionPools(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	var proxiedURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+			import http from "k6/http";
+			export default function() {
+				let verified = http.get("%[1]s/");
+				if (verified.status !== 0 || !verified.error) {
+					throw new Error("verified request succeeded: " + verified.status);
+				}
+				let insecure = http.get("%[1]s/", { pool: "insecure" });
+				if (insecure.status !== 200) {
+					throw new Error("insecure request failed: " + insecure.error);
+				}
+				let proxied = http.get("http://origin.k6.test/path", { pool: "cdn" });
+				if (proxied.status !== 200) {
+					throw new Error("proxied request failed: " + proxied.error);
+				}
+			}
+		`, srv.URL)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	r.SetOptions(lib.Options{
+		ConnectionPools: map[string]*lib.ConnectionPool{
+			"insecure": {InsecureSkipTLSVerify: null.BoolFrom(true)},
+			"cdn":      {Proxy: null.StringFrom(proxy.URL), NoConnectionReuse: null.BoolFrom(true)},
+		},
+	})
+
+	samples := make(chan stats.SampleContainer, 100)
+	vu, err := r.NewVU(samples)
+	require.NoError(t, err)
+	assert.Len(t, vu.(*VU).Pools, 2)
+	require.NoError(t, vu.RunOnce(context.Background()))
+	assert.Equal(t, "http://origin.k6.test/path", proxiedURL)
+
+	var pools []string
+	for _, sample := range stats.GetBufferedSamples(samples) {
+		for _, s := range sample.GetSamples() {
+			if s.Metric == metrics.HTTPReqs {
+				pool, _ := s.Tags.Get("pool")
+				pools = append(pools, pool)
+			}
+		}
+	}
+	assert.Equal(t, []string{"", "insecure", "cdn"}, pools)
+}
+
+func TestRunnerMetricRegistry(t *testing.T) {
+	r1, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import { Trend } from "k6/metrics";
+			let myTrend = new Trend("my_trend", true);
+			export default function() { myTrend.add(1); }
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	r2, err := NewFromArchive(r1.MakeArchive(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	for name, r := range map[string]*Runner{"Source": r1, "Archive": r2} {
+		t.Run(name, func(t *testing.T) {
+			var myTrend *stats.Metric
+			for i := 0; i < 2; i++ {
+				samples := make(chan stats.SampleContainer, 100)
+				vu, err := r.NewVU(samples)
+				require.NoError(t, err)
+				require.NoError(t, vu.RunOnce(context.Background()))
+				close(samples)
+				var found bool
+				for container := range samples {
+					for _, sample := range container.GetSamples() {
+						if sample.Metric.Name != "my_trend" {
+							continue
+						}
+						if myTrend == nil {
+							myTrend = sample.Metric
+						}
+						found = true
+						assert.True(t, sample.Metric == myTrend)
+					}
+				}
+				assert.True(t, found)
+			}
+
+			registry := r.GetMetricRegistry()
+			assert.True(t, registry.Get("my_trend") == myTrend)
+			assert.Equal(t, stats.Time, myTrend.Contains)
+			assert.Equal(t, metrics.HTTPReqs, registry.Get("http_reqs"))
+		})
+	}
+
+	t.Run("Shadowing", func(t *testing.T) {
+		_, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import { Trend } from "k6/metrics";
+				let myTrend = new Trend("http_reqs");
+				export default function() {}
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `metric 'http_reqs' is already registered as a "counter", it can't be a "trend"`)
+		}
+	})
+}
+
+func TestRunnerHealthCheck(t *testing.T) {
+	var probes int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&probes, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import http from "k6/http";
+			let attempts = 0;
+			export function ready() {
+				attempts++;
+				return attempts >= 2;
+			}
+			export function broken() {
+				throw new Error("still starting");
+			}
+			export default function() {}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	interval := types.NullDurationFrom(10 * time.Millisecond)
+
+	t.Run("Disabled", func(t *testing.T) {
+		require.NoError(t, r.SetOptions(lib.Options{}))
+		assert.NoError(t, r.HealthCheck(context.Background()))
+	})
+	t.Run("Ready", func(t *testing.T) {
+		require.NoError(t, r.SetOptions(lib.Options{HealthCheck: lib.HealthCheckConfig{
+			URLs: []string{srv.URL}, Exec: null.StringFrom("ready"), Interval: interval,
+		}}))
+		assert.NoError(t, r.HealthCheck(context.Background()))
+		assert.Equal(t, int64(4), atomic.LoadInt64(&probes), "the URL is probed again for the retried function")
+	})
+	t.Run("NotReady", func(t *testing.T) {
+		require.NoError(t, r.SetOptions(lib.Options{HealthCheck: lib.HealthCheckConfig{
+			Exec: null.StringFrom("broken"), Interval: interval, Timeout: types.NullDurationFrom(100 * time.Millisecond),
+		}}))
+		err := r.HealthCheck(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the system under test isn't ready, the health check didn't pass within 100ms")
+		assert.Contains(t, err.Error(), "still starting")
+	})
+	t.Run("NotExported", func(t *testing.T) {
+		require.NoError(t, r.SetOptions(lib.Options{HealthCheck: lib.HealthCheckConfig{Exec: null.StringFrom("nope")}}))
+		assert.EqualError(t, r.HealthCheck(context.Background()), "the health check function 'nope' isn't exported")
+	})
+}
+
+func generateClientCert(t *testing.T) (caPool *x509.CertPool, certPEM, keyPEM string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "k6 test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caPool = x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "k6 test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return caPool, certPEM, keyPEM
+}
+
+func TestVUIntegrationClientCertsPerDomain(t *testing.T) {
+	caPool, certPEM, keyPEM := generateClientCert(t)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err == nil {
+				_ = conn.Close()
+			}
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: caPool}
+	srv.StartTLS()
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+			import http from "k6/http";
+			import ws from "k6/ws";
+			export default function() {
+				let res = http.get("https://mtls.k6.test:%[1]d/");
+				if (res.status !== 200) {
+					throw new Error("mTLS request failed: " + res.error);
+				}
+				res = ws.connect("wss://mtls.k6.test:%[1]d/ws", function(socket) { socket.close(); });
+				if (res.status !== 101) {
+					throw new Error("mTLS ws connection failed: " + res.status);
+				}
+				res = http.get("https://other.k6.test:%[1]d/");
+				if (res.status !== 0 || !res.error) {
+					throw new Error("the client certificate was sent to another host");
+				}
+			}
+		`, port)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	var tlsAuth []*lib.TLSAuth
+	require.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(
+		`[{"domains": ["mtls.k6.test"], "cert": %q, "key": %q}]`, certPEM, keyPEM,
+	)), &tlsAuth))
+	r.SetOptions(lib.Options{
+		InsecureSkipTLSVerify: null.BoolFrom(true),
+		Hosts: map[string]types.HostAddresses{
+			"mtls.k6.test":  {{IP: net.ParseIP("127.0.0.1")}},
+			"other.k6.test": {{IP: net.ParseIP("127.0.0.1")}},
+		},
+		TLSAuth: tlsAuth,
+	})
+
+	vu, err := r.NewVU(make(chan stats.SampleContainer, 1000))
+	require.NoError(t, err)
+	assert.NoError(t, vu.RunOnce(context.Background()))
+}
+
+func TestVUIntegrationTLSCACerts(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+			import http from "k6/http";
+			export default function() {
+				let res = http.get("%s");
+				if (res.status !== 200) {
+					throw new Error("request failed: " + res.error);
+				}
+			}
+		`, srv.URL)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	t.Run("untrusted", func(t *testing.T) {
+		r.SetOptions(lib.Options{})
+		vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		err = vu.RunOnce(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "request failed")
+	})
+	t.Run("trusted", func(t *testing.T) {
+		caCerts, err := lib.NewTLSCACerts([]string{caPEM}, false)
+		require.NoError(t, err)
+		r.SetOptions(lib.Options{TLSCACerts: caCerts})
+		vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		assert.NoError(t, vu.RunOnce(context.Background()))
+	})
+}
+
 func TestVUIntegrationTLSConfig(t *testing.T) {
 	var unsupportedVersionErrorMsg = "remote error: tls: handshake failure"
 	for _, tag := range build.Default.ReleaseTags {
@@ -1124,6 +1551,70 @@ func TestVUIntegrationVUID(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationSeed(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data:     []byte(`export let initRandom = Math.random(); export default function() {};`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, r.SetOptions(r.GetOptions().Apply(lib.Options{Seed: null.IntFrom(42)})))
+
+	randoms := func(id int64) (float64, []float64, []float64) {
+		vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		require.NoError(t, vu.Reconfigure(id))
+		v, err := vu.Runtime.RunString(`[Math.random(), Math.random()]`)
+		require.NoError(t, err)
+		var values []float64
+		require.NoError(t, vu.Runtime.ExportTo(v, &values))
+		initRandom := vu.Runtime.Get("exports").ToObject(vu.Runtime).Get("initRandom").ToFloat()
+		state := vu.newState(context.Background(), r.defaultGroup, nil)
+		return initRandom, values, []float64{state.ChaosRand(), state.ChaosRand()}
+	}
+
+	init1, vu1, chaos1 := randoms(1)
+	init1Again, vu1Again, chaos1Again := randoms(1)
+	init2, vu2, chaos2 := randoms(2)
+	assert.Equal(t, init1, init1Again)
+	assert.Equal(t, init1, init2)
+	assert.Equal(t, vu1, vu1Again)
+	assert.NotEqual(t, vu1, vu2)
+	assert.Equal(t, chaos1, chaos1Again)
+	assert.NotEqual(t, chaos1, chaos2)
+	assert.NotEqual(t, vu1, chaos1)
+}
+
+func TestVUIntegrationSeedIDs(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import { uuidv4, ulid, Monotonic } from "k6/ids";
+			let m = new Monotonic();
+			export let ids = [];
+			export default function() { ids.push(uuidv4(), ulid().slice(10), m.ulid().slice(10)); };
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, r.SetOptions(r.GetOptions().Apply(lib.Options{Seed: null.IntFrom(42)})))
+
+	ids := func(id int64) []string {
+		vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		require.NoError(t, vu.Reconfigure(id))
+		require.NoError(t, vu.RunOnce(context.Background()))
+		var values []string
+		exports := vu.Runtime.Get("exports").ToObject(vu.Runtime)
+		require.NoError(t, vu.Runtime.ExportTo(exports.Get("ids"), &values))
+		return values
+	}
+
+	// Only the random bits are compared, the timestamps of the ULIDs may differ
+	vu1, vu1Again, vu2 := ids(1), ids(1), ids(2)
+	assert.Len(t, vu1, 3)
+	assert.Equal(t, vu1, vu1Again)
+	assert.NotEqual(t, vu1, vu2)
+}
+
 func TestVUIntegrationClientCerts(t *testing.T) {
 	clientCAPool := x509.NewCertPool()
 	assert.True(t, clientCAPool.AppendCertsFromPEM(
@@ -1414,6 +1905,195 @@ func TestArchiveRunningIntegraty(t *testing.T) {
 	}
 }
 
+func TestNewVUConcurrently(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/data.json", []byte(`42`), os.ModePerm))
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			let data = JSON.parse(open("/data.json"));
+			export default function() {
+				if (data != 42) {
+					throw new Error("incorrect answer " + data);
+				}
+			}
+		`),
+	}, fs, lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+			if assert.NoError(t, err) {
+				assert.NoError(t, vu.RunOnce(context.Background()))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVUSecrets(t *testing.T) {
+	require.NoError(t, os.Setenv("K6_TEST_VU_SECRET", "hunter2"))
+	defer func() { _ = os.Unsetenv("K6_TEST_VU_SECRET") }()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import secrets from "k6/secrets";
+			export default function() {
+				let secret = secrets.get("K6_TEST_VU_SECRET");
+				if (secret !== "hunter2") {
+					throw new Error("Invalid secret: " + secret);
+				}
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{SecretSource: null.StringFrom("env")})
+	require.NoError(t, err)
+
+	vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	assert.NoError(t, vu.RunOnce(context.Background()))
+}
+
+func TestVUExec(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import exec from "k6/exec";
+			export function setup() {
+				return exec.command("sh", ["-c", "echo seeded"]).stdout;
+			}
+			export default function(data) {
+				if (data !== "seeded\n") {
+					throw new Error("Unexpected setup data: " + data);
+				}
+				exec.command("sh", ["-c", "true"]);
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{ExecAllow: []string{"sh"}})
+	require.NoError(t, err)
+	r.SetOptions(lib.Options{SetupTimeout: types.NullDurationFrom(10 * time.Second)})
+
+	require.NoError(t, r.Setup(context.Background(), make(chan stats.SampleContainer, 100)))
+	vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	err = vu.RunOnce(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "external commands can only be run in setup() and teardown()")
+
+	t.Run("SetupGroup", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import exec from "k6/exec";
+				import { group } from "k6";
+				export default function() {
+					group("setup", function() { exec.command("sh", ["-c", "true"]); });
+				}
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{ExecAllow: []string{"sh"}})
+		require.NoError(t, err)
+
+		vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		err = vu.RunOnce(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "external commands can only be run in setup() and teardown()")
+	})
+}
+
+func TestVUScenarioExecAndEnv(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			export default function() {
+				throw new Error("the default function shouldn't run");
+			}
+			export function browse() {
+				if (__ENV.PAGE !== "home") {
+					throw new Error("Unexpected PAGE: " + __ENV.PAGE);
+				}
+				if (__ENV.GLOBAL !== "yes") {
+					throw new Error("Unexpected GLOBAL: " + __ENV.GLOBAL);
+				}
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{Env: map[string]string{"GLOBAL": "yes", "PAGE": "none"}})
+	require.NoError(t, err)
+
+	scenario := scheduler.NewPerVUIterationsConfig(lib.DefaultSchedulerName)
+	scenario.Exec = null.StringFrom("browse")
+	scenario.Env = map[string]string{"PAGE": "home"}
+	require.NoError(t, r.SetOptions(lib.Options{Execution: scheduler.ConfigMap{lib.DefaultSchedulerName: scenario}}))
+
+	vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	ctx := lib.WithScenario(context.Background(), scenario)
+	assert.NoError(t, vu.RunOnce(ctx))
+	assert.NoError(t, vu.RunOnce(ctx))
+
+	t.Run("MissingExec", func(t *testing.T) {
+		missing := scheduler.NewPerVUIterationsConfig(lib.DefaultSchedulerName)
+		missing.Exec = null.StringFrom("nope")
+		err := r.SetOptions(lib.Options{Execution: scheduler.ConfigMap{lib.DefaultSchedulerName: missing}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "'nope' (scenario 'default')")
+
+		err = vu.RunOnce(lib.WithScenario(context.Background(), missing))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the exec function 'nope' of the scenario 'default' isn't exported")
+	})
+}
+
+func TestVUArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k6-artifacts")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import artifacts from "k6/artifacts";
+			export default function() {}
+			export function teardown() {
+				artifacts.write("summary.txt", "done");
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{ArtifactsDir: null.StringFrom(dir)})
+	require.NoError(t, err)
+	r.SetOptions(lib.Options{TeardownTimeout: types.NullDurationFrom(10 * time.Second)})
+
+	require.NoError(t, r.Teardown(context.Background(), make(chan stats.SampleContainer, 100)))
+	data, err := ioutil.ReadFile(dir + "/summary.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(data))
+
+	t.Run("TeardownGroup", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import artifacts from "k6/artifacts";
+				import { group } from "k6";
+				export default function() {
+					group("teardown", function() { artifacts.write("sneaky.txt", "nope"); });
+				}
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{ArtifactsDir: null.StringFrom(dir)})
+		require.NoError(t, err)
+
+		vu, err := r.NewVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		err = vu.RunOnce(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "artifacts can only be written in teardown()")
+		_, err = os.Stat(dir + "/sneaky.txt")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
 func TestArchiveNotPanicking(t *testing.T) {
 	tb := testutils.NewHTTPMultiBin(t)
 	defer tb.Cleanup()
@@ -1514,3 +2194,131 @@ func TestStuffNotPanicking(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestVUJobs(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import { Counter } from "k6/metrics";
+			import { sleep } from "k6";
+			let runs = new Counter("runs");
+			export let options = {
+				jobs: {
+					tick: { interval: "100ms" },
+					health: { exec: "poll", interval: "1h", scope: "test", tags: { kind: "health" } },
+					failing: { interval: "1h" },
+				},
+			};
+			export function tick() { runs.add(1); }
+			export function poll() { runs.add(1); }
+			export function failing() { throw new Error("oops"); }
+			export default function() {
+				runs.add(1);
+				sleep(0.35);
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, r.SetOptions(r.GetOptions().Apply(lib.Options{
+		SystemTags: lib.GetTagSet(lib.DefaultSystemTagList...),
+	})))
+
+	runs := func(vu lib.VU, samples chan stats.SampleContainer) map[string]int {
+		require.NoError(t, vu.RunOnce(context.Background()))
+		counts := map[string]int{}
+		for {
+			select {
+			case sc := <-samples:
+				for _, s := range sc.GetSamples() {
+					if s.Metric.Name != "runs" {
+						continue
+					}
+					job, _ := s.Tags.Get("job")
+					if job == "health" {
+						kind, _ := s.Tags.Get("kind")
+						assert.Equal(t, "health", kind)
+					}
+					counts[job]++
+				}
+			default:
+				return counts
+			}
+		}
+	}
+
+	samples := make(chan stats.SampleContainer, 100)
+	vu, err := r.NewVU(samples)
+	require.NoError(t, err)
+	counts := runs(vu, samples)
+	// The tick job runs before the iteration, and 3 times while it sleeps.
+	assert.Equal(t, map[string]int{"": 1, "tick": 4, "health": 1}, counts)
+
+	// Jobs with the test scope only run once per interval for all VUs.
+	samples2 := make(chan stats.SampleContainer, 100)
+	vu2, err := r.NewVU(samples2)
+	require.NoError(t, err)
+	counts = runs(vu2, samples2)
+	assert.Equal(t, 0, counts["health"])
+	assert.Equal(t, 4, counts["tick"])
+
+	t.Run("MissingExec", func(t *testing.T) {
+		err := r.SetOptions(r.GetOptions().Apply(lib.Options{
+			Jobs: map[string]lib.JobConfig{"nope": {Interval: types.NullDurationFrom(time.Second)}},
+		}))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "'nope' (job 'nope')")
+	})
+}
+
+func TestVUIntegrationResponseCallback(t *testing.T) {
+	tb := testutils.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(tb.Replacer.Replace(`
+			import http from "k6/http";
+			http.setResponseCallback(http.expectedStatuses(404));
+			export default function() {
+				http.get("HTTPBIN_URL/status/404");
+				if (__ITER == 0) {
+					http.setResponseCallback(null);
+				}
+			}
+		`)),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, r.SetOptions(lib.Options{
+		Throw:      null.BoolFrom(false),
+		SystemTags: lib.GetTagSet(lib.DefaultSystemTagList...),
+		Hosts:      tb.Dialer.Hosts,
+	}))
+
+	samples := make(chan stats.SampleContainer, 100)
+	vu, err := r.newVU(samples)
+	require.NoError(t, err)
+
+	// The callback of the init context applies to the first iteration, which disables it.
+	for i, expected := range []struct {
+		tag    string
+		failed int
+	}{{"true", 1}, {"", 0}} {
+		require.NoError(t, vu.RunOnce(context.Background()))
+		var tags []string
+		failed := 0
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, s := range sc.GetSamples() {
+				switch s.Metric {
+				case metrics.HTTPReqs:
+					tag, _ := s.Tags.Get("expected_response")
+					tags = append(tags, tag)
+				case metrics.HTTPReqFailed:
+					assert.Equal(t, 0.0, s.Value)
+					failed++
+				}
+			}
+		}
+		assert.Equal(t, []string{expected.tag}, tags, "iteration %d", i)
+		assert.Equal(t, expected.failed, failed, "iteration %d", i)
+	}
+}
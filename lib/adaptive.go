@@ -0,0 +1,128 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+)
+
+// The defaults of the adaptive load mode.
+const (
+	DefaultAdaptiveMetric    = "http_req_duration"
+	DefaultAdaptiveStartRate = 10
+	DefaultAdaptiveWindow    = 10 * time.Second
+	DefaultAdaptivePrecision = 0.05
+)
+
+// AdaptiveLoadConfig configures the adaptive load mode, which limits the requests per second
+// with a rate that's searched for while the test runs: it's raised while the threshold holds
+// for the samples of the last window, and lowered when it fails, until the maximum rate at
+// which the threshold still holds is known within the precision.
+type AdaptiveLoadConfig struct {
+	// The metric that the threshold is evaluated on, http_req_duration by default.
+	Metric null.String `json:"metric"`
+	// The threshold that has to hold, e.g. "p(95)<300".
+	Threshold string `json:"threshold"`
+
+	// The rate to start the search at, and the one it never goes above (unlimited by default).
+	StartRate null.Int `json:"startRate"`
+	MaxRate   null.Int `json:"maxRate"`
+
+	// How long every rate is kept before the threshold is evaluated for it.
+	Window types.NullDuration `json:"window"`
+	// How close, relative to the lowest failing rate, the highest passing rate has to be for the
+	// search to stop.
+	Precision null.Float `json:"precision"`
+}
+
+// GetMetric returns the name of the metric that the threshold is evaluated on.
+func (c AdaptiveLoadConfig) GetMetric() string {
+	if c.Metric.Valid {
+		return c.Metric.String
+	}
+	return DefaultAdaptiveMetric
+}
+
+// GetStartRate returns the rate that the search starts at.
+func (c AdaptiveLoadConfig) GetStartRate() float64 {
+	if c.StartRate.Valid {
+		return float64(c.StartRate.Int64)
+	}
+	return DefaultAdaptiveStartRate
+}
+
+// GetMaxRate returns the rate that the search never goes above, or 0 if there's no such rate.
+func (c AdaptiveLoadConfig) GetMaxRate() float64 {
+	if c.MaxRate.Valid {
+		return float64(c.MaxRate.Int64)
+	}
+	return 0
+}
+
+// GetWindow returns how long every rate is kept before the threshold is evaluated for it.
+func (c AdaptiveLoadConfig) GetWindow() time.Duration {
+	if c.Window.Valid {
+		return time.Duration(c.Window.Duration)
+	}
+	return DefaultAdaptiveWindow
+}
+
+// GetPrecision returns the relative precision at which the search stops.
+func (c AdaptiveLoadConfig) GetPrecision() float64 {
+	if c.Precision.Valid {
+		return c.Precision.Float64
+	}
+	return DefaultAdaptivePrecision
+}
+
+// Validate checks that the threshold can be evaluated and that the rates, the window and the
+// precision make sense.
+func (c AdaptiveLoadConfig) Validate() (errs []error) {
+	if c.Threshold == "" {
+		errs = append(errs, errors.New("the adaptive load mode needs a threshold"))
+	} else if _, err := stats.NewThresholds([]string{c.Threshold}); err != nil {
+		errs = append(errs, fmt.Errorf("the adaptive load threshold '%s' is invalid: %s", c.Threshold, err))
+	}
+	if c.Metric.Valid && c.Metric.String == "" {
+		errs = append(errs, errors.New("the adaptive load metric can't be empty"))
+	}
+	if c.StartRate.Valid && c.StartRate.Int64 <= 0 {
+		errs = append(errs, fmt.Errorf("the adaptive load start rate must be positive, not %d", c.StartRate.Int64))
+	}
+	if c.MaxRate.Valid && float64(c.MaxRate.Int64) < c.GetStartRate() {
+		errs = append(errs, fmt.Errorf(
+			"the adaptive load max rate (%d) can't be less than the start rate (%.0f)", c.MaxRate.Int64, c.GetStartRate(),
+		))
+	}
+	if c.Window.Valid && c.Window.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the adaptive load window must be positive, not %s", c.Window.Duration))
+	}
+	if p := c.Precision; p.Valid && (p.Float64 <= 0 || p.Float64 >= 1) {
+		errs = append(errs, fmt.Errorf("the adaptive load precision must be between 0 and 1, not %g", p.Float64))
+	}
+	return errs
+}
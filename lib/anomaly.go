@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// The defaults of the anomaly detection.
+const (
+	DefaultAnomalyWindow            = time.Minute
+	DefaultAnomalyWindows           = 5
+	DefaultAnomalyLatencyIncrease   = 0.2
+	DefaultAnomalyErrorRateIncrease = 0.01
+)
+
+// AnomalyDetectionConfig configures the detection of a steady degradation during long tests,
+// e.g. soak tests: the p(95) of http_req_duration and the rate of failed HTTP requests are
+// computed for consecutive windows, and an anomaly is reported when one of them didn't go down
+// for the given number of windows in a row and increased by at least the given amount overall.
+type AnomalyDetectionConfig struct {
+	// How long every window is, and how many windows in a row have to degrade.
+	Window  types.NullDuration `json:"window"`
+	Windows null.Int           `json:"windows"`
+
+	// The minimum increase of the p(95) of http_req_duration over those windows, relative to
+	// its value in the first one, e.g. 0.2 for 20%.
+	LatencyIncrease null.Float `json:"latencyIncrease"`
+	// The minimum increase of the rate of failed HTTP requests over those windows, e.g. 0.01 if
+	// it has to rise by at least one percentage point.
+	ErrorRateIncrease null.Float `json:"errorRateIncrease"`
+
+	// Whether the test is aborted once an anomaly is detected.
+	AbortOnAnomaly null.Bool `json:"abortOnAnomaly"`
+}
+
+// GetWindow returns how long every window is.
+func (c AnomalyDetectionConfig) GetWindow() time.Duration {
+	if c.Window.Valid {
+		return time.Duration(c.Window.Duration)
+	}
+	return DefaultAnomalyWindow
+}
+
+// GetWindows returns how many windows in a row have to degrade for an anomaly to be detected.
+func (c AnomalyDetectionConfig) GetWindows() int {
+	if c.Windows.Valid {
+		return int(c.Windows.Int64)
+	}
+	return DefaultAnomalyWindows
+}
+
+// GetLatencyIncrease returns the minimum relative increase of the p(95) of http_req_duration.
+func (c AnomalyDetectionConfig) GetLatencyIncrease() float64 {
+	if c.LatencyIncrease.Valid {
+		return c.LatencyIncrease.Float64
+	}
+	return DefaultAnomalyLatencyIncrease
+}
+
+// GetErrorRateIncrease returns the minimum increase of the rate of failed HTTP requests.
+func (c AnomalyDetectionConfig) GetErrorRateIncrease() float64 {
+	if c.ErrorRateIncrease.Valid {
+		return c.ErrorRateIncrease.Float64
+	}
+	return DefaultAnomalyErrorRateIncrease
+}
+
+// Validate checks that the windows and the increases make sense.
+func (c AnomalyDetectionConfig) Validate() (errs []error) {
+	if c.Window.Valid && c.Window.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the anomaly detection window must be positive, not %s", c.Window.Duration))
+	}
+	if c.Windows.Valid && c.Windows.Int64 < 2 {
+		errs = append(errs, fmt.Errorf("the anomaly detection needs at least 2 windows, not %d", c.Windows.Int64))
+	}
+	if c.LatencyIncrease.Valid && c.LatencyIncrease.Float64 <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"the anomaly detection latency increase must be positive, not %g", c.LatencyIncrease.Float64,
+		))
+	}
+	if r := c.ErrorRateIncrease; r.Valid && (r.Float64 <= 0 || r.Float64 > 1) {
+		errs = append(errs, fmt.Errorf("the anomaly detection error rate increase must be between 0 and 1, not %g", r.Float64))
+	}
+	return errs
+}
@@ -34,6 +34,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
@@ -90,11 +91,24 @@ type Archive struct {
 
 	// Environment variables
 	Env map[string]string `json:"env"`
+
+	// The cipher used to encrypt the contents of the archive, if any. The options stay readable,
+	// everything else - the scripts, files and environment variables - needs the archive key.
+	Encryption string `json:"encryption,omitempty"`
 }
 
 // Reads an archive created by Archive.Write from a reader.
 func ReadArchive(in io.Reader) (*Archive, error) {
+	return ReadEncryptedArchive(in, nil)
+}
+
+// ReadEncryptedArchive reads an archive created by Archive.WriteEncrypted from a reader, using
+// the given key to decrypt its contents. Archives that aren't encrypted are read as they are,
+// unless a key is given, since then they were expected to be encrypted. The metadata.json entry
+// must come first, so it decides whether every other entry has to be decrypted.
+func ReadEncryptedArchive(in io.Reader, key []byte) (*Archive, error) {
 	r := tar.NewReader(in)
+	var metadata []byte
 	arc := &Archive{
 		Scripts: make(map[string][]byte),
 		Files:   make(map[string][]byte),
@@ -118,17 +132,45 @@ func ReadArchive(in io.Reader) (*Archive, error) {
 			return nil, err
 		}
 
-		switch hdr.Name {
-		case "metadata.json":
+		if hdr.Name == "metadata.json" {
+			if metadata != nil {
+				return nil, errors.New("the archive has more than one metadata.json")
+			}
+			metadata = data
 			if err := json.Unmarshal(data, &arc); err != nil {
 				return nil, err
 			}
 			// Path separator normalization for older archives (<=0.20.0)
 			arc.Filename = NormalizeAndAnonymizePath(arc.Filename)
 			arc.Pwd = NormalizeAndAnonymizePath(arc.Pwd)
+			if arc.Encryption != "" {
+				if err := checkArchiveEncryption(arc.Encryption, key); err != nil {
+					return nil, err
+				}
+			} else if key != nil {
+				return nil, errors.New("the archive isn't encrypted, but an archive key was given")
+			}
 			continue
+		}
+		if metadata == nil {
+			return nil, errors.Errorf("the archive entry '%s' comes before metadata.json", hdr.Name)
+		}
+
+		if arc.Encryption != "" {
+			if data, err = decryptArchiveData(key, archiveEntryAAD(hdr.Name, metadata), data); err != nil {
+				return nil, errors.Wrapf(err,
+					"couldn't decrypt '%s', the archive key is probably wrong or the archive was modified", hdr.Name)
+			}
+		}
+
+		switch hdr.Name {
 		case "data":
 			arc.Data = data
+		case "env.json":
+			if err := json.Unmarshal(data, &arc.Env); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		// Path separator normalization for older archives (<=0.20.0)
@@ -170,16 +212,38 @@ func ReadArchive(in io.Reader) (*Archive, error) {
 // change. If it does change, ReadArchive must be able to handle all previous formats as well as
 // the current one.
 func (arc *Archive) Write(out io.Writer) error {
+	return arc.WriteEncrypted(out, nil)
+}
+
+// WriteEncrypted serialises the archive to a writer like Write, but if a key is given, the
+// scripts, files and environment variables are encrypted with it.
+func (arc *Archive) WriteEncrypted(out io.Writer, key []byte) error {
 	w := tar.NewWriter(out)
 	t := time.Now()
 
+	// encrypt is a no-op for unencrypted archives
+	encrypt := func(name string, data []byte) ([]byte, error) { return data, nil }
+
 	metaArc := *arc
 	metaArc.Filename = NormalizeAndAnonymizePath(metaArc.Filename)
 	metaArc.Pwd = NormalizeAndAnonymizePath(metaArc.Pwd)
+	metaArc.Encryption = ""
+	if key != nil {
+		if err := checkArchiveEncryption(archiveCipher, key); err != nil {
+			return err
+		}
+		metaArc.Encryption = archiveCipher
+		metaArc.Env = nil
+	}
 	metadata, err := metaArc.json()
 	if err != nil {
 		return err
 	}
+	if key != nil {
+		encrypt = func(name string, data []byte) ([]byte, error) {
+			return encryptArchiveData(key, archiveEntryAAD(name, metadata), data)
+		}
+	}
 	_ = w.WriteHeader(&tar.Header{
 		Name:     "metadata.json",
 		Mode:     0644,
@@ -191,14 +255,38 @@ func (arc *Archive) Write(out io.Writer) error {
 		return err
 	}
 
+	if key != nil {
+		env, err := json.Marshal(arc.Env)
+		if err != nil {
+			return err
+		}
+		if env, err = encrypt("env.json", env); err != nil {
+			return err
+		}
+		_ = w.WriteHeader(&tar.Header{
+			Name:     "env.json",
+			Mode:     0644,
+			Size:     int64(len(env)),
+			ModTime:  t,
+			Typeflag: tar.TypeReg,
+		})
+		if _, err := w.Write(env); err != nil {
+			return err
+		}
+	}
+
+	mainData, err := encrypt("data", arc.Data)
+	if err != nil {
+		return err
+	}
 	_ = w.WriteHeader(&tar.Header{
 		Name:     "data",
 		Mode:     0644,
-		Size:     int64(len(arc.Data)),
+		Size:     int64(len(mainData)),
 		ModTime:  t,
 		Typeflag: tar.TypeReg,
 	})
-	if _, err := w.Write(arc.Data); err != nil {
+	if _, err := w.Write(mainData); err != nil {
 		return err
 	}
 
@@ -265,8 +353,13 @@ func (arc *Archive) Write(out io.Writer) error {
 			if filePath[0] == '/' {
 				filePath = "_" + filePath
 			}
+			name := path.Clean(entry.name + "/" + filePath)
+			data, err := encrypt(name, data)
+			if err != nil {
+				return err
+			}
 			_ = w.WriteHeader(&tar.Header{
-				Name:     path.Clean(entry.name + "/" + filePath),
+				Name:     name,
 				Mode:     0644,
 				Size:     int64(len(data)),
 				ModTime:  t,
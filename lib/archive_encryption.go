@@ -0,0 +1,107 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// archiveCipher is the only cipher that's currently used for encrypted archives.
+const archiveCipher = "aes-256-gcm"
+
+// archiveKeySize is the size of the archive keys, in bytes.
+const archiveKeySize = 32
+
+// ParseArchiveKey decodes an archive key, which is a 256-bit key in either hex or base64.
+func ParseArchiveKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, errors.New("the archive key must be either hex or base64 encoded")
+		}
+	}
+	if len(key) != archiveKeySize {
+		return nil, errors.Errorf("the archive key must be %d bytes long, not %d", archiveKeySize, len(key))
+	}
+	return key, nil
+}
+
+func checkArchiveEncryption(encryption string, key []byte) error {
+	if encryption != archiveCipher {
+		return errors.Errorf("unsupported archive encryption '%s'", encryption)
+	}
+	if key == nil {
+		return errors.New("the archive is encrypted, an archive key is needed to read it")
+	}
+	if len(key) != archiveKeySize {
+		return errors.Errorf("the archive key must be %d bytes long, not %d", archiveKeySize, len(key))
+	}
+	return nil
+}
+
+func newArchiveAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// archiveEntryAAD returns the additional data that an encrypted entry is authenticated with: its
+// name and a hash of the metadata.json of the archive. That way, the entries can't be swapped
+// around or moved to another archive, and the unencrypted metadata can't be tampered with.
+func archiveEntryAAD(name string, metadata []byte) []byte {
+	hash := sha256.Sum256(metadata)
+	return append(append([]byte(name), 0), hash[:]...)
+}
+
+// encryptArchiveData seals the data with a random nonce, which is prepended to the result.
+func encryptArchiveData(key, aad, data []byte) ([]byte, error) {
+	aead, err := newArchiveAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, aad), nil
+}
+
+func decryptArchiveData(key, aad, data []byte) ([]byte, error) {
+	aead, err := newArchiveAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("the encrypted data is too short")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, aad)
+}
@@ -21,12 +21,16 @@
 package lib
 
 import (
+	"archive/tar"
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -150,6 +154,163 @@ func TestArchiveReadWrite(t *testing.T) {
 	})
 }
 
+func TestArchiveEncryption(t *testing.T) {
+	key, err := ParseArchiveKey("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	require.NoError(t, err)
+
+	arc1 := &Archive{
+		Type:     "js",
+		Options:  Options{VUs: null.IntFrom(10)},
+		Filename: "/path/to/script.js",
+		Data:     []byte(`// contents...`),
+		Pwd:      "/path/to",
+		Scripts:  map[string][]byte{"/path/to/a.js": []byte(`// a contents`)},
+		Files:    map[string][]byte{"/path/to/secret.txt": []byte(`password`)},
+		Env:      map[string]string{"TOKEN": "s3cr3t"},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, arc1.WriteEncrypted(buf, key))
+	data := buf.Bytes()
+	for _, plain := range []string{"// contents...", "// a contents", "password", "s3cr3t"} {
+		assert.NotContains(t, string(data), plain)
+	}
+	assert.Contains(t, string(data), `"vus": 10`)
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		arc2, err := ReadEncryptedArchive(bytes.NewReader(data), key)
+		require.NoError(t, err)
+		arc2.FS = nil
+		assert.Equal(t, archiveCipher, arc2.Encryption)
+		arc2.Encryption = ""
+		assert.Equal(t, arc1, arc2)
+	})
+	t.Run("NoKey", func(t *testing.T) {
+		_, err := ReadArchive(bytes.NewReader(data))
+		assert.EqualError(t, err, "the archive is encrypted, an archive key is needed to read it")
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		wrongKey := make([]byte, len(key))
+		_, err := ReadEncryptedArchive(bytes.NewReader(data), wrongKey)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the archive key is probably wrong")
+	})
+	t.Run("SwappedEntries", func(t *testing.T) {
+		tampered := rewriteArchive(t, data, func(entries map[string][]byte) {
+			secret, script := "files/_/path/to/secret.txt", "scripts/_/path/to/a.js"
+			require.Contains(t, entries, secret)
+			require.Contains(t, entries, script)
+			entries[secret], entries[script] = entries[script], entries[secret]
+		})
+		_, err := ReadEncryptedArchive(bytes.NewReader(tampered), key)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the archive was modified")
+	})
+	t.Run("TamperedMetadata", func(t *testing.T) {
+		tampered := rewriteArchive(t, data, func(entries map[string][]byte) {
+			entries["metadata.json"] = bytes.Replace(entries["metadata.json"], []byte(`"vus": 10`), []byte(`"vus": 99`), 1)
+		})
+		_, err := ReadEncryptedArchive(bytes.NewReader(tampered), key)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the archive was modified")
+	})
+	t.Run("NotEncrypted", func(t *testing.T) {
+		plain := bytes.NewBuffer(nil)
+		require.NoError(t, arc1.Write(plain))
+		_, err := ReadEncryptedArchive(bytes.NewReader(plain.Bytes()), key)
+		assert.EqualError(t, err, "the archive isn't encrypted, but an archive key was given")
+	})
+	t.Run("EntryBeforeMetadata", func(t *testing.T) {
+		for _, name := range []string{"data", "scripts/_/path/to/evil.js", "files/_/path/to/evil.txt"} {
+			tampered := prependArchiveEntry(t, data, name, []byte(`// plaintext`))
+			_, err := ReadEncryptedArchive(bytes.NewReader(tampered), key)
+			assert.EqualError(t, err, "the archive entry '"+name+"' comes before metadata.json")
+		}
+	})
+	t.Run("DuplicateMetadata", func(t *testing.T) {
+		tampered := appendArchiveEntry(t, data, "metadata.json", []byte(`{"type": "js"}`))
+		_, err := ReadEncryptedArchive(bytes.NewReader(tampered), key)
+		assert.EqualError(t, err, "the archive has more than one metadata.json")
+	})
+	t.Run("ParseArchiveKey", func(t *testing.T) {
+		b64Key, err := ParseArchiveKey("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")
+		require.NoError(t, err)
+		assert.Equal(t, key, b64Key)
+
+		_, err = ParseArchiveKey("0001")
+		assert.EqualError(t, err, "the archive key must be 32 bytes long, not 2")
+		_, err = ParseArchiveKey("not a key!")
+		assert.EqualError(t, err, "the archive key must be either hex or base64 encoded")
+	})
+}
+
+// rewriteArchive copies an archive, letting modify change the contents of its regular files.
+func rewriteArchive(t *testing.T, data []byte, modify func(entries map[string][]byte)) []byte {
+	var headers []*tar.Header
+	entries := make(map[string][]byte)
+	r := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		headers = append(headers, hdr)
+		entries[hdr.Name], err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+	}
+	modify(entries)
+
+	buf := bytes.NewBuffer(nil)
+	w := tar.NewWriter(buf)
+	for _, hdr := range headers {
+		hdr.Size = int64(len(entries[hdr.Name]))
+		require.NoError(t, w.WriteHeader(hdr))
+		_, err := w.Write(entries[hdr.Name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// prependArchiveEntry copies an archive with an extra regular file at its start.
+func prependArchiveEntry(t *testing.T, data []byte, name string, contents []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := tar.NewWriter(buf)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+	_, err := w.Write(contents)
+	require.NoError(t, err)
+	copyArchiveEntries(t, w, data)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// appendArchiveEntry copies an archive with an extra regular file at its end.
+func appendArchiveEntry(t *testing.T, data []byte, name string, contents []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := tar.NewWriter(buf)
+	copyArchiveEntries(t, w, data)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+	_, err := w.Write(contents)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func copyArchiveEntries(t *testing.T, w *tar.Writer, data []byte) {
+	r := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		require.NoError(t, w.WriteHeader(hdr))
+		_, err = io.Copy(w, r)
+		require.NoError(t, err)
+	}
+}
+
 func TestArchiveJSONEscape(t *testing.T) {
 	t.Parallel()
 
@@ -70,3 +70,13 @@ type Collector interface {
 	// Set run status
 	SetRunStatus(status RunStatus)
 }
+
+// A PendingCollector is a Collector that can tell how many samples it hasn't committed to its
+// backend yet, so the samples that are dropped when the final flush times out can be reported.
+type PendingCollector interface {
+	Collector
+
+	// PendingSamples returns the number of collected samples that aren't committed yet,
+	// including the ones that are being committed right now.
+	PendingSamples() int
+}
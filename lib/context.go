@@ -1,11 +1,22 @@
 package lib
 
-import "context"
+import (
+	"context"
+
+	"github.com/loadimpact/k6/lib/scheduler"
+	"github.com/loadimpact/k6/stats"
+	"golang.org/x/time/rate"
+)
 
 type ctxKey int
 
 const (
 	ctxKeyState ctxKey = iota
+	ctxKeyExecutionTags
+	ctxKeyRPSLimiters
+	ctxKeyScenario
+	ctxKeyResponseCallback
+	ctxKeyMetricRegistry
 )
 
 func WithState(ctx context.Context, state *State) context.Context {
@@ -19,3 +30,82 @@ func GetState(ctx context.Context) *State {
 	}
 	return v.(*State)
 }
+
+// WithExecutionTags attaches tags that the executor wants applied to all metrics emitted by
+// the VU iterations running with the returned context. The executor may change the map in
+// between iterations, but never while one is running.
+func WithExecutionTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, ctxKeyExecutionTags, tags)
+}
+
+func GetExecutionTags(ctx context.Context) map[string]string {
+	v := ctx.Value(ctxKeyExecutionTags)
+	if v == nil {
+		return nil
+	}
+	return v.(map[string]string)
+}
+
+// WithRPSLimiter adds a requests-per-second limiter to the ones of ctx. Every request that's
+// made with the returned context waits for all of them, e.g. both the global one of the rps
+// option and the one of the scenario that the iteration is running in.
+func WithRPSLimiter(ctx context.Context, limiter *rate.Limiter) context.Context {
+	parent := GetRPSLimiters(ctx)
+	limiters := make([]*rate.Limiter, len(parent), len(parent)+1)
+	copy(limiters, parent)
+	return context.WithValue(ctx, ctxKeyRPSLimiters, append(limiters, limiter))
+}
+
+// GetRPSLimiters returns the requests-per-second limiters that were added to ctx.
+func GetRPSLimiters(ctx context.Context) []*rate.Limiter {
+	v := ctx.Value(ctxKeyRPSLimiters)
+	if v == nil {
+		return nil
+	}
+	return v.([]*rate.Limiter)
+}
+
+// WithScenario attaches the config of the scenario that the VU iterations running with the
+// returned context belong to, so the VUs can use its exec function and env variables.
+func WithScenario(ctx context.Context, config scheduler.Config) context.Context {
+	return context.WithValue(ctx, ctxKeyScenario, config)
+}
+
+// GetScenario returns the config of the scenario that was attached to ctx, if any.
+func GetScenario(ctx context.Context) scheduler.Config {
+	v := ctx.Value(ctxKeyScenario)
+	if v == nil {
+		return nil
+	}
+	return v.(scheduler.Config)
+}
+
+// WithResponseCallback attaches the response callback of a VU, which is kept for all of its
+// iterations, so http.setResponseCallback() can change it.
+func WithResponseCallback(ctx context.Context, callback *ResponseCallback) context.Context {
+	return context.WithValue(ctx, ctxKeyResponseCallback, callback)
+}
+
+// GetResponseCallback returns the response callback of the VU that was attached to ctx, if any.
+func GetResponseCallback(ctx context.Context) *ResponseCallback {
+	v := ctx.Value(ctxKeyResponseCallback)
+	if v == nil {
+		return nil
+	}
+	return v.(*ResponseCallback)
+}
+
+// WithMetricRegistry attaches the registry that the custom metrics of the script are
+// registered in, so they can't shadow the builtin ones or each other.
+func WithMetricRegistry(ctx context.Context, registry *stats.Registry) context.Context {
+	return context.WithValue(ctx, ctxKeyMetricRegistry, registry)
+}
+
+// GetMetricRegistry returns the metric registry that was attached to ctx, if any.
+func GetMetricRegistry(ctx context.Context) *stats.Registry {
+	v := ctx.Value(ctxKeyMetricRegistry)
+	if v == nil {
+		return nil
+	}
+	return v.(*stats.Registry)
+}
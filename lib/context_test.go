@@ -4,7 +4,10 @@ import (
 	"context"
 	"testing"
 
+	"github.com/loadimpact/k6/lib/scheduler"
+	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
 )
 
 func TestContextState(t *testing.T) {
@@ -15,3 +18,33 @@ func TestContextState(t *testing.T) {
 func TestContextStateNil(t *testing.T) {
 	assert.Nil(t, GetState(context.Background()))
 }
+
+func TestContextExecutionTags(t *testing.T) {
+	tags := map[string]string{"scenario": "default"}
+	assert.Equal(t, tags, GetExecutionTags(WithExecutionTags(context.Background(), tags)))
+	assert.Nil(t, GetExecutionTags(context.Background()))
+}
+
+func TestContextRPSLimiters(t *testing.T) {
+	assert.Nil(t, GetRPSLimiters(context.Background()))
+
+	global, scenario := rate.NewLimiter(10, 1), rate.NewLimiter(5, 1)
+	ctx := WithRPSLimiter(context.Background(), global)
+	assert.Equal(t, []*rate.Limiter{global}, GetRPSLimiters(ctx))
+	assert.Equal(t, []*rate.Limiter{global, scenario}, GetRPSLimiters(WithRPSLimiter(ctx, scenario)))
+	assert.Equal(t, []*rate.Limiter{global}, GetRPSLimiters(ctx))
+}
+
+func TestContextScenario(t *testing.T) {
+	assert.Nil(t, GetScenario(context.Background()))
+
+	config := scheduler.NewPerVUIterationsConfig(DefaultSchedulerName)
+	assert.Equal(t, config, GetScenario(WithScenario(context.Background(), config)))
+}
+
+func TestContextMetricRegistry(t *testing.T) {
+	assert.Nil(t, GetMetricRegistry(context.Background()))
+
+	registry := stats.NewRegistry()
+	assert.Equal(t, registry, GetMetricRegistry(WithMetricRegistry(context.Background(), registry)))
+}
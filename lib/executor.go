@@ -22,6 +22,9 @@ package lib
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/loadimpact/k6/lib/types"
@@ -85,3 +88,57 @@ type Executor interface {
 	SetRunSetup(r bool)
 	SetRunTeardown(r bool)
 }
+
+// DefaultExecutorName is the name of the executor that's used if no other one is configured.
+const DefaultExecutorName = "local"
+
+// ExecutorConstructor returns a new Executor that schedules VUs created by the supplied Runner.
+type ExecutorConstructor func(r Runner) (Executor, error)
+
+//nolint:gochecknoglobals
+var (
+	executorsMutex       sync.RWMutex
+	executorConstructors = make(map[string]ExecutorConstructor)
+)
+
+// RegisterExecutor adds the supplied ExecutorConstructor as the constructor for executors
+// with the given name, in a thread-safe manner. It's meant to be called from init() functions,
+// so custom scheduling strategies can be plugged in without changes to k6 itself.
+func RegisterExecutor(name string, constructor ExecutorConstructor) {
+	executorsMutex.Lock()
+	defer executorsMutex.Unlock()
+
+	if constructor == nil {
+		panic("executors: constructor is nil")
+	}
+	if _, exists := executorConstructors[name]; exists {
+		panic("executors: RegisterExecutor called twice for " + name)
+	}
+
+	executorConstructors[name] = constructor
+}
+
+// NewExecutor creates a new executor of the registered type with the given name.
+func NewExecutor(name string, r Runner) (Executor, error) {
+	executorsMutex.RLock()
+	constructor, exists := executorConstructors[name]
+	executorsMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown executor '%s'", name)
+	}
+	return constructor(r)
+}
+
+// GetExecutorNames returns the sorted names of all registered executors.
+func GetExecutorNames() []string {
+	executorsMutex.RLock()
+	defer executorsMutex.RUnlock()
+
+	names := make([]string, 0, len(executorConstructors))
+	for name := range executorConstructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
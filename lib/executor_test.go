@@ -0,0 +1,64 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testExecutor struct {
+	Executor
+	runner Runner
+}
+
+func TestRegisterExecutor(t *testing.T) {
+	runner := &MiniRunner{}
+	RegisterExecutor("test-executor", func(r Runner) (Executor, error) {
+		return testExecutor{runner: r}, nil
+	})
+	RegisterExecutor("test-executor-broken", func(r Runner) (Executor, error) {
+		return nil, errors.New("broken")
+	})
+
+	assert.Panics(t, func() {
+		RegisterExecutor("test-executor", func(r Runner) (Executor, error) { return nil, nil })
+	})
+	assert.Panics(t, func() { RegisterExecutor("test-executor-nil", nil) })
+
+	ex, err := NewExecutor("test-executor", runner)
+	require.NoError(t, err)
+	assert.Equal(t, testExecutor{runner: runner}, ex)
+
+	_, err = NewExecutor("test-executor-broken", runner)
+	assert.EqualError(t, err, "broken")
+
+	_, err = NewExecutor("test-executor-missing", runner)
+	assert.EqualError(t, err, "unknown executor 'test-executor-missing'")
+
+	names := GetExecutorNames()
+	assert.Contains(t, names, "test-executor")
+	assert.Contains(t, names, "test-executor-broken")
+	assert.NotContains(t, names, "test-executor-nil")
+}
@@ -0,0 +1,156 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+)
+
+// The defaults of the health check gate.
+const (
+	DefaultHealthCheckTimeout  = 1 * time.Minute
+	DefaultHealthCheckInterval = 1 * time.Second
+)
+
+// HealthCheckConfig configures the health check gate, which makes sure that the system under
+// test is ready before any load is started. All of the URLs have to respond with a status below
+// 400 and the exec function, if there is one, must neither throw nor return false. The checks
+// are retried on an interval until they pass, or the test is aborted after the timeout.
+type HealthCheckConfig struct {
+	URLs []string `json:"urls"`
+	// The exported function that checks whether the system is ready.
+	Exec     null.String        `json:"exec"`
+	Timeout  types.NullDuration `json:"timeout"`
+	Interval types.NullDuration `json:"interval"`
+	// Whether any of the fields were set.
+	Valid bool `json:"-"`
+}
+
+// UnmarshalJSON reads the config and marks it as set if any of its fields are.
+func (c *HealthCheckConfig) UnmarshalJSON(data []byte) error {
+	type healthCheckConfig HealthCheckConfig
+	if err := json.Unmarshal(data, (*healthCheckConfig)(c)); err != nil {
+		return err
+	}
+	c.Valid = c.URLs != nil || c.Exec.Valid || c.Timeout.Valid || c.Interval.Valid
+	return nil
+}
+
+// IsEnabled returns whether there's anything to check.
+func (c HealthCheckConfig) IsEnabled() bool {
+	return len(c.URLs) > 0 || c.Exec.String != ""
+}
+
+// Apply overwrites the fields of the config with the ones that are set in the argument.
+func (c HealthCheckConfig) Apply(cfg HealthCheckConfig) HealthCheckConfig {
+	if cfg.URLs != nil {
+		c.URLs = cfg.URLs
+	}
+	if cfg.Exec.Valid {
+		c.Exec = cfg.Exec
+	}
+	if cfg.Timeout.Valid {
+		c.Timeout = cfg.Timeout
+	}
+	if cfg.Interval.Valid {
+		c.Interval = cfg.Interval
+	}
+	c.Valid = c.Valid || cfg.Valid
+	return c
+}
+
+// GetTimeout returns how long the checks are retried for before the test is aborted.
+func (c HealthCheckConfig) GetTimeout() time.Duration {
+	if c.Timeout.Valid {
+		return time.Duration(c.Timeout.Duration)
+	}
+	return DefaultHealthCheckTimeout
+}
+
+// GetInterval returns how long to wait after a failed check before retrying it.
+func (c HealthCheckConfig) GetInterval() time.Duration {
+	if c.Interval.Valid {
+		return time.Duration(c.Interval.Duration)
+	}
+	return DefaultHealthCheckInterval
+}
+
+// Validate checks that the URLs are absolute HTTP(S) URLs and that the durations are positive.
+func (c HealthCheckConfig) Validate() (errs []error) {
+	for _, u := range c.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("'%s' isn't a valid health check URL, it must be an absolute http or https URL", u))
+		}
+	}
+	if c.Exec.Valid && c.Exec.String == "" {
+		errs = append(errs, errors.New("the exec function of the health check can't be empty"))
+	}
+	if c.Timeout.Valid && c.Timeout.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the health check timeout must be positive, not %s", c.Timeout.Duration))
+	}
+	if c.Interval.Valid && c.Interval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the health check interval must be positive, not %s", c.Interval.Duration))
+	}
+	return errs
+}
+
+// Wait calls check until it passes, waiting for the interval in between, and returns the last
+// error if it doesn't pass within the timeout. The attempts get a context that's done when the
+// timeout is reached.
+func (c HealthCheckConfig) Wait(ctx context.Context, check func(context.Context) error) error {
+	timeout := c.GetTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := check(ctx)
+		if err == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(c.GetInterval())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if ctx.Err() == context.Canceled {
+				return ctx.Err()
+			}
+			return errors.Errorf(
+				"the system under test isn't ready, the health check didn't pass within %s (%d attempts): %s",
+				timeout, attempt, err,
+			)
+		}
+	}
+}
+
+// HealthCheckRunner is implemented by the runners that can check whether the system under test
+// is ready, according to the healthCheck option, before the test is started.
+type HealthCheckRunner interface {
+	HealthCheck(ctx context.Context) error
+}
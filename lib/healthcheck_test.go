@@ -0,0 +1,103 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHealthCheckConfig(t *testing.T) {
+	cfg := HealthCheckConfig{URLs: []string{"https://example.com/health"}}.Apply(HealthCheckConfig{
+		Exec:    null.StringFrom("ready"),
+		Timeout: types.NullDurationFrom(10 * time.Second),
+	})
+	assert.Equal(t, []string{"https://example.com/health"}, cfg.URLs)
+	assert.Equal(t, null.StringFrom("ready"), cfg.Exec)
+	assert.Equal(t, 10*time.Second, cfg.GetTimeout())
+	assert.Equal(t, DefaultHealthCheckInterval, cfg.GetInterval())
+	assert.False(t, cfg.Valid)
+	assert.True(t, cfg.IsEnabled())
+	assert.Empty(t, cfg.Validate())
+	assert.False(t, HealthCheckConfig{Timeout: types.NullDurationFrom(time.Second)}.IsEnabled())
+
+	var fromJSON HealthCheckConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"urls": ["http://localhost/ready"], "interval": "5s"}`), &fromJSON))
+	assert.Equal(t, HealthCheckConfig{
+		URLs:     []string{"http://localhost/ready"},
+		Interval: types.NullDurationFrom(5 * time.Second),
+		Valid:    true,
+	}, fromJSON)
+	assert.True(t, HealthCheckConfig{}.Apply(fromJSON).Valid)
+
+	invalid := HealthCheckConfig{
+		URLs:     []string{"example.com/health", "ftp://example.com/", "http://"},
+		Exec:     null.StringFrom(""),
+		Timeout:  types.NullDurationFrom(0),
+		Interval: types.NullDurationFrom(-time.Second),
+	}
+	assert.Len(t, invalid.Validate(), 6)
+}
+
+func TestHealthCheckConfigWait(t *testing.T) {
+	t.Parallel()
+	cfg := HealthCheckConfig{
+		Timeout:  types.NullDurationFrom(200 * time.Millisecond),
+		Interval: types.NullDurationFrom(10 * time.Millisecond),
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		attempts := 0
+		err := cfg.Wait(context.Background(), func(ctx context.Context) error {
+			if attempts++; attempts < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		err := cfg.Wait(context.Background(), func(ctx context.Context) error {
+			return errors.New("503 Service Unavailable")
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the system under test isn't ready, the health check didn't pass within 200ms")
+		assert.Contains(t, err.Error(), ": 503 Service Unavailable")
+		assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := cfg.Wait(ctx, func(ctx context.Context) error {
+			return errors.New("not yet")
+		})
+		assert.Equal(t, context.Canceled, err)
+	})
+}
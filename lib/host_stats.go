@@ -0,0 +1,93 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// HostStats keeps the live connection and request counts of every target host, as "host:port".
+// It's shared between all of the VUs of a runner and safe for concurrent use.
+type HostStats struct {
+	mutex sync.RWMutex
+	hosts map[string]*HostCounters
+}
+
+// HostCounters are the counts of a single host. They have to be accessed atomically.
+type HostCounters struct {
+	OpenConnections  int64
+	InFlightRequests int64
+	Requests         int64
+	Errors           int64 // failed connections and requests, and 5xx responses
+}
+
+// HostStatsSnapshot is a copy of the counts of a host at some point in time.
+type HostStatsSnapshot struct {
+	Host string
+	HostCounters
+}
+
+// HostStatsRunner is implemented by the runners that keep per-host stats.
+type HostStatsRunner interface {
+	GetHostStats() *HostStats
+}
+
+// NewHostStats returns an empty HostStats.
+func NewHostStats() *HostStats {
+	return &HostStats{hosts: make(map[string]*HostCounters)}
+}
+
+// Host returns the counters of the host, creating them if needed.
+func (hs *HostStats) Host(host string) *HostCounters {
+	hs.mutex.RLock()
+	counters, ok := hs.hosts[host]
+	hs.mutex.RUnlock()
+	if ok {
+		return counters
+	}
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	if counters, ok = hs.hosts[host]; !ok {
+		counters = &HostCounters{}
+		hs.hosts[host] = counters
+	}
+	return counters
+}
+
+// Snapshot returns the current counts of all hosts, sorted by host.
+func (hs *HostStats) Snapshot() []HostStatsSnapshot {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+	snapshots := make([]HostStatsSnapshot, 0, len(hs.hosts))
+	for host, counters := range hs.hosts {
+		snapshots = append(snapshots, HostStatsSnapshot{Host: host, HostCounters: HostCounters{
+			OpenConnections:  atomic.LoadInt64(&counters.OpenConnections),
+			InFlightRequests: atomic.LoadInt64(&counters.InFlightRequests),
+			Requests:         atomic.LoadInt64(&counters.Requests),
+			Errors:           atomic.LoadInt64(&counters.Errors),
+		}})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Host < snapshots[j].Host })
+	return snapshots
+}
@@ -0,0 +1,87 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// The scopes of background jobs.
+const (
+	// JobScopeVU jobs run in every VU, once per interval each, e.g. to refresh a VU's token.
+	JobScopeVU = "vu"
+	// JobScopeTest jobs run once per interval for the whole test, in whichever VU gets to them
+	// first, e.g. to poll a health endpoint.
+	JobScopeTest = "test"
+)
+
+// JobConfig configures a background job, an exported function of the script that's run on an
+// interval in between and during the iterations of the VUs. The samples it emits are tagged
+// with the job's name in addition to its tags.
+type JobConfig struct {
+	// The exported function to run, the name of the job by default.
+	Exec     null.String        `json:"exec"`
+	Interval types.NullDuration `json:"interval"`
+	// JobScopeVU (the default) or JobScopeTest.
+	Scope null.String       `json:"scope"`
+	Tags  map[string]string `json:"tags"`
+}
+
+// GetExec returns the name of the exported function that the job with the given name runs.
+func (c JobConfig) GetExec(name string) string {
+	if c.Exec.Valid {
+		return c.Exec.String
+	}
+	return name
+}
+
+// GetScope returns whether the job runs in every VU or once for the whole test.
+func (c JobConfig) GetScope() string {
+	if c.Scope.Valid {
+		return c.Scope.String
+	}
+	return JobScopeVU
+}
+
+// GetInterval returns how often the job runs.
+func (c JobConfig) GetInterval() time.Duration {
+	return time.Duration(c.Interval.Duration)
+}
+
+// Validate checks that the job with the given name has a positive interval and a valid scope.
+func (c JobConfig) Validate(name string) (errs []error) {
+	if !c.Interval.Valid || c.Interval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the interval of the job '%s' must be positive, not %s", name, c.Interval.Duration))
+	}
+	if scope := c.GetScope(); scope != JobScopeVU && scope != JobScopeTest {
+		errs = append(errs, fmt.Errorf(
+			"the scope of the job '%s' must be '%s' or '%s', not '%s'", name, JobScopeVU, JobScopeTest, scope,
+		))
+	}
+	if c.Exec.Valid && c.Exec.String == "" {
+		errs = append(errs, fmt.Errorf("the exec function of the job '%s' can't be empty", name))
+	}
+	return errs
+}
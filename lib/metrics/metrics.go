@@ -33,6 +33,10 @@ var (
 	Iterations        = stats.New("iterations", stats.Counter)
 	IterationDuration = stats.New("iteration_duration", stats.Trend, stats.Time)
 	Errors            = stats.New("errors", stats.Counter)
+	VURecycles        = stats.New("vu_recycles", stats.Counter)
+
+	// The requests per second that the adaptive load mode currently limits the test to.
+	AdaptiveRate = stats.New("adaptive_rate", stats.Gauge)
 
 	// Runner-emitted.
 	Checks        = stats.New("checks", stats.Rate)
@@ -45,8 +49,19 @@ var (
 	HTTPReqConnecting     = stats.New("http_req_connecting", stats.Trend, stats.Time)
 	HTTPReqTLSHandshaking = stats.New("http_req_tls_handshaking", stats.Trend, stats.Time)
 	HTTPReqSending        = stats.New("http_req_sending", stats.Trend, stats.Time)
+	HTTPReqExpectContinue = stats.New("http_req_expect_continue", stats.Trend, stats.Time)
 	HTTPReqWaiting        = stats.New("http_req_waiting", stats.Trend, stats.Time)
 	HTTPReqReceiving      = stats.New("http_req_receiving", stats.Trend, stats.Time)
+	HTTPReqFailed         = stats.New("http_req_failed", stats.Rate)
+
+	// Long-polling requests, which are kept out of http_req_duration, http_req_waiting and
+	// http_req_receiving since most of their duration is spent waiting for the server to have data.
+	HTTPLongPollDuration  = stats.New("http_longpoll_duration", stats.Trend, stats.Time)
+	HTTPLongPollWaiting   = stats.New("http_longpoll_waiting", stats.Trend, stats.Time)
+	HTTPLongPollReceiving = stats.New("http_longpoll_receiving", stats.Trend, stats.Time)
+
+	// Timings reported by the server in Server-Timing response headers.
+	HTTPReqServerTiming = stats.New("http_req_server_timing", stats.Trend, stats.Time)
 
 	// Websocket-related
 	WSSessions         = stats.New("ws_sessions", stats.Counter)
@@ -55,8 +70,112 @@ var (
 	WSPing             = stats.New("ws_ping", stats.Trend)
 	WSSessionDuration  = stats.New("ws_session_duration", stats.Trend, stats.Time)
 	WSConnecting       = stats.New("ws_connecting", stats.Trend, stats.Time)
+	WSSocketIOAck      = stats.New("ws_socketio_ack_duration", stats.Trend, stats.Time)
+
+	// The time until the completion of SignalR hub method invocations
+	SignalRInvocationDuration = stats.New("signalr_invocation_duration", stats.Trend, stats.Time)
+
+	// STOMP-related
+	STOMPMessagesSent     = stats.New("stomp_msgs_sent", stats.Counter)
+	STOMPMessagesReceived = stats.New("stomp_msgs_received", stats.Counter)
+	STOMPDeliveryDuration = stats.New("stomp_delivery_duration", stats.Trend, stats.Time)
 
 	// Network-related; used for future protocols as well.
 	DataSent     = stats.New("data_sent", stats.Counter, stats.Data)
 	DataReceived = stats.New("data_received", stats.Counter, stats.Data)
+
+	// Connections refused because of the blacklistIPs or blockHostnames options.
+	BlockedRequests = stats.New("blocked_requests", stats.Counter)
+
+	// The queries to the DNS server of the dns option, if it has one.
+	DNSLookupDuration = stats.New("dns_lookup_duration", stats.Trend, stats.Time)
+
+	// The connections won by each IP version, in an ip_family tag, with the happyEyeballs option.
+	HappyEyeballsConnections = stats.New("happy_eyeballs_connections", stats.Counter)
+
+	// The state changes of the k6/circuitbreaker circuit breakers, and the calls they rejected.
+	CircuitBreakerStateChanges = stats.New("circuit_breaker_state_changes", stats.Counter)
+	CircuitBreakerRejections   = stats.New("circuit_breaker_rejections", stats.Counter)
+
+	// Per-host stats, only emitted with the hostMetrics option.
+	HostOpenConnections  = stats.New("host_open_connections", stats.Gauge)
+	HostInFlightRequests = stats.New("host_inflight_requests", stats.Gauge)
+	HostErrors           = stats.New("host_errors", stats.Counter)
 )
+
+// Builtin returns all of the metrics above, e.g. for validating the metric names in thresholds.
+func Builtin() []*stats.Metric {
+	return []*stats.Metric{
+		VUs, VUsMax, Iterations, IterationDuration, Errors, VURecycles,
+		Checks, GroupDuration,
+		HTTPReqs, HTTPReqDuration, HTTPReqBlocked, HTTPReqConnecting, HTTPReqTLSHandshaking,
+		HTTPReqSending, HTTPReqExpectContinue, HTTPReqWaiting, HTTPReqReceiving, HTTPReqFailed,
+		HTTPLongPollDuration, HTTPLongPollWaiting, HTTPLongPollReceiving,
+		HTTPReqServerTiming,
+		WSSessions, WSMessagesSent, WSMessagesReceived, WSPing, WSSessionDuration, WSConnecting, WSSocketIOAck,
+		SignalRInvocationDuration,
+		STOMPMessagesSent, STOMPMessagesReceived, STOMPDeliveryDuration,
+		DataSent, DataReceived,
+		BlockedRequests, DNSLookupDuration, HappyEyeballsConnections,
+		CircuitBreakerStateChanges, CircuitBreakerRejections,
+		HostOpenConnections, HostInFlightRequests, HostErrors,
+	}
+}
+
+// NewRegistry returns a metric registry with all of the builtin metrics, so that custom metrics
+// can't be registered with their names and different types.
+func NewRegistry() *stats.Registry {
+	registry := stats.NewRegistry()
+	for _, m := range Builtin() {
+		if err := registry.Register(m); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
+// SuggestBuiltin returns the name of the built-in metric that the given name is most likely a
+// typo of, or an empty string if it's the name of a built-in metric or isn't close to any.
+func SuggestBuiltin(name string) string {
+	suggestion, bestDistance := "", 3 // only suggest names that are at most 2 edits away
+	for _, m := range Builtin() {
+		if m.Name == name {
+			return ""
+		}
+		if d := editDistance(name, m.Name); d < bestDistance {
+			suggestion, bestDistance = m.Name, d
+		}
+	}
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
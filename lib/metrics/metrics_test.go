@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltin(t *testing.T) {
+	names := map[string]bool{}
+	for _, m := range Builtin() {
+		assert.False(t, names[m.Name], "duplicate metric %s", m.Name)
+		names[m.Name] = true
+	}
+	assert.True(t, names["http_req_duration"])
+}
+
+func TestSuggestBuiltin(t *testing.T) {
+	testdata := map[string]string{
+		"http_req_duration":  "",
+		"http_req_duraton":   "http_req_duration",
+		"http_reqs_duration": "http_req_duration",
+		"iteration":          "iterations",
+		"checkss":            "checks",
+		"my_custom_trend":    "",
+		"":                   "",
+	}
+	for name, suggestion := range testdata {
+		assert.Equal(t, suggestion, SuggestBuiltin(name), name)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.Len(t, registry.All(), len(Builtin()))
+	assert.Equal(t, HTTPReqDuration, registry.Get("http_req_duration"))
+
+	_, err := registry.NewMetric("http_req_duration", stats.Counter)
+	assert.EqualError(t, err, "metric 'http_req_duration' is already registered as a \"trend\", it can't be a \"counter\"")
+}
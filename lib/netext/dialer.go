@@ -24,14 +24,16 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
-
-	"github.com/viki-org/dnscache"
 )
 
 // Dialer wraps net.Dialer and provides k6 specific functionality -
@@ -39,19 +41,41 @@ import (
 type Dialer struct {
 	net.Dialer
 
-	Resolver  *dnscache.Resolver
-	Blacklist []*net.IPNet
-	Hosts     map[string]net.IP
+	Resolver         Resolver
+	Blacklist        []*net.IPNet
+	BlockedHostnames []string
+	Hosts            map[string]types.HostAddresses
+	LocalIPs         types.IPPool
+	HostStats        *lib.HostStats // optional, counts the open connections and errors per host
+
+	// The delay between the raced connection attempts to the IPs of a host, 0 disables racing
+	HappyEyeballsDelay time.Duration
+
+	BytesRead       int64
+	BytesWritten    int64
+	BlockedRequests int64
 
-	BytesRead    int64
-	BytesWritten int64
+	// The queries to the DNS server of the resolver since the last trail, if it has one
+	dnsQueriesMu sync.Mutex
+	dnsQueries   []DNSQuery
+
+	// The connections that were won by each IP version since the last trail, when racing
+	happyEyeballsIPv4, happyEyeballsIPv6 int64
 }
 
+// hostsNext is used to pick the next address of the hosts that have several ones. It's shared
+// between all dialers, i.e. VUs, so that their connections are spread over all of the addresses.
+var hostsNext uint32 //nolint:gochecknoglobals
+
+// localIPsNext is used to pick the source address of the next connection from the LocalIPs, it's
+// shared between all dialers for the same reason as hostsNext.
+var localIPsNext uint64 //nolint:gochecknoglobals
+
 // NewDialer constructs a new Dialer and initializes its cache.
 func NewDialer(dialer net.Dialer) *Dialer {
 	return &Dialer{
 		Dialer:   dialer,
-		Resolver: dnscache.New(0),
+		Resolver: NewResolver(types.DNSConfig{}),
 	}
 }
 
@@ -65,31 +89,98 @@ func (b BlackListedIPError) Error() string {
 	return fmt.Sprintf("IP (%s) is in a blacklisted range (%s)", b.ip, b.net)
 }
 
+// BlockedHostnameError is an error that is returned when a given hostname is blocked
+type BlockedHostnameError struct {
+	hostname string
+	pattern  string
+}
+
+func (b BlockedHostnameError) Error() string {
+	return fmt.Sprintf("hostname (%s) is in a blocked pattern (%s)", b.hostname, b.pattern)
+}
+
+// MatchHostname reports whether the hostname matches the pattern, which is either a hostname or
+// a "*." wildcard that matches all of the subdomains of the rest of the pattern. The comparison
+// is case-insensitive.
+func MatchHostname(pattern, hostname string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(hostname, pattern[1:])
+	}
+	return hostname == pattern
+}
+
 // DialContext wraps the net.Dialer.DialContext and handles the k6 specifics
 func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
+	conn, err := d.dialContext(ctx, proto, addr)
+	if d.HostStats == nil {
+		return conn, err
+	}
+	counters := d.HostStats.Host(addr)
+	if err != nil {
+		atomic.AddInt64(&counters.Errors, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&counters.OpenConnections, 1)
+	return &hostStatsConn{Conn: conn, counters: counters}, nil
+}
+
+func (d *Dialer) dialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
 	delimiter := strings.LastIndex(addr, ":")
 	host := addr[:delimiter]
 
+	for _, pattern := range d.BlockedHostnames {
+		if MatchHostname(pattern, host) {
+			atomic.AddInt64(&d.BlockedRequests, 1)
+			return nil, BlockedHostnameError{hostname: host, pattern: pattern}
+		}
+	}
+
+	port := addr[delimiter+1:]
+
 	// lookup for domain defined in Hosts option before trying to resolve DNS.
-	ip, ok := d.Hosts[host]
-	if !ok {
+	var ips []net.IP
+	racing := false
+	if addrs := d.Hosts[host]; len(addrs) > 0 {
+		hostAddr := addrs[0]
+		if len(addrs) > 1 {
+			hostAddr = addrs[(atomic.AddUint32(&hostsNext, 1)-1)%uint32(len(addrs))]
+		}
+		ips = []net.IP{hostAddr.IP}
+		if hostAddr.Port != 0 {
+			port = strconv.Itoa(hostAddr.Port)
+		}
+	} else {
 		var err error
-		ip, err = d.Resolver.FetchOne(host)
+		ips, racing, err = d.lookupIPs(host)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	for _, net := range d.Blacklist {
-		if net.Contains(ip) {
-			return nil, BlackListedIPError{ip: ip, net: net}
-		}
+	ips, err := d.filterBlacklisted(ips)
+	if err != nil {
+		return nil, err
 	}
-	ipStr := ip.String()
-	if strings.ContainsRune(ipStr, ':') {
-		ipStr = "[" + ipStr + "]"
+	dialer := d.Dialer
+	if len(d.LocalIPs) > 0 {
+		dialer.LocalAddr = &net.TCPAddr{IP: d.LocalIPs.Get(atomic.AddUint64(&localIPsNext, 1) - 1)}
+	}
+	var conn net.Conn
+	if !racing {
+		conn, err = dialer.DialContext(ctx, proto, net.JoinHostPort(ips[0].String(), port))
+	} else {
+		var ip net.IP
+		conn, ip, err = d.raceDial(ctx, &dialer, proto, ips, port)
+		if err == nil {
+			if ip.To4() != nil {
+				atomic.AddInt64(&d.happyEyeballsIPv4, 1)
+			} else {
+				atomic.AddInt64(&d.happyEyeballsIPv6, 1)
+			}
+		}
 	}
-	conn, err := d.Dialer.DialContext(ctx, proto, ipStr+":"+addr[delimiter+1:])
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +188,140 @@ func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn,
 	return conn, err
 }
 
+// lookupIPs resolves the host to the IP to connect to, or, when the connections are raced and the
+// resolver supports it, to all of the IPs in the order to attempt them in. The returned bool
+// reports whether the connections should be raced.
+func (d *Dialer) lookupIPs(host string) ([]net.IP, bool, error) {
+	r, ok := d.Resolver.(*resolver)
+	if d.HappyEyeballsDelay <= 0 || !ok {
+		ip, err := d.lookupIP(host)
+		return []net.IP{ip}, false, err
+	}
+	ips, queries, err := r.lookupIPsQueries(host)
+	d.addDNSQueries(queries)
+	return ips, true, err
+}
+
+// filterBlacklisted removes the blacklisted IPs, and returns an error for the first one of them
+// if none are left.
+func (d *Dialer) filterBlacklisted(ips []net.IP) ([]net.IP, error) {
+	allowed := ips[:0:0]
+	var blacklistErr error
+	for _, ip := range ips {
+		blacklisted := false
+		for _, net := range d.Blacklist {
+			if net.Contains(ip) {
+				if blacklistErr == nil {
+					blacklistErr = BlackListedIPError{ip: ip, net: net}
+				}
+				blacklisted = true
+				break
+			}
+		}
+		if !blacklisted {
+			allowed = append(allowed, ip)
+		}
+	}
+	if len(allowed) == 0 {
+		atomic.AddInt64(&d.BlockedRequests, 1)
+		return nil, blacklistErr
+	}
+	return allowed, nil
+}
+
+type raceResult struct {
+	conn net.Conn
+	ip   net.IP
+	err  error
+}
+
+// raceDial connects to the first IP, and starts a new attempt with the next one whenever the
+// previous attempt fails or HappyEyeballsDelay passes without any of them connecting. The first
+// established connection is returned with its IP, and the rest are canceled or closed.
+func (d *Dialer) raceDial(
+	ctx context.Context, dialer *net.Dialer, proto string, ips []net.IP, port string,
+) (net.Conn, net.IP, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan raceResult, len(ips))
+	next, pending := 0, 0
+	attempt := func() {
+		ip := ips[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, proto, net.JoinHostPort(ip.String(), port))
+			results <- raceResult{conn: conn, ip: ip, err: err}
+		}()
+	}
+
+	var firstErr error
+	attempt()
+	for {
+		var delay <-chan time.Time
+		var timer *time.Timer
+		if next < len(ips) {
+			timer = time.NewTimer(d.HappyEyeballsDelay)
+			delay = timer.C
+		}
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				go closeRaceLosers(results, pending)
+				if timer != nil {
+					timer.Stop()
+				}
+				return result.conn, result.ip, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if next < len(ips) {
+				attempt()
+			} else if pending == 0 {
+				return nil, nil, firstErr
+			}
+		case <-delay:
+			attempt()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// closeRaceLosers closes the connections of the attempts that were still pending when the race
+// was won, in case they connected before they were canceled.
+func closeRaceLosers(results <-chan raceResult, pending int) {
+	for ; pending > 0; pending-- {
+		if result := <-results; result.err == nil {
+			_ = result.conn.Close()
+		}
+	}
+}
+
+// lookupIP resolves the host with the resolver, and keeps the queries that it made to its DNS
+// server, if it reports them, for the next trail.
+func (d *Dialer) lookupIP(host string) (net.IP, error) {
+	r, ok := d.Resolver.(*resolver)
+	if !ok {
+		return d.Resolver.LookupIP(host)
+	}
+	ip, queries, err := r.lookupIPQueries(host)
+	d.addDNSQueries(queries)
+	return ip, err
+}
+
+func (d *Dialer) addDNSQueries(queries []DNSQuery) {
+	if len(queries) > 0 {
+		d.dnsQueriesMu.Lock()
+		d.dnsQueries = append(d.dnsQueries, queries...)
+		d.dnsQueriesMu.Unlock()
+	}
+}
+
 // GetTrail creates a new NetTrail instance with the Dialer
 // sent and received data metrics and the supplied times and tags.
 func (d *Dialer) GetTrail(startTime, endTime time.Time, fullIteration bool, tags *stats.SampleTags) *NetTrail {
@@ -116,6 +341,43 @@ func (d *Dialer) GetTrail(startTime, endTime time.Time, fullIteration bool, tags
 			Tags:   tags,
 		},
 	}
+	if blocked := atomic.SwapInt64(&d.BlockedRequests, 0); blocked > 0 {
+		samples = append(samples, stats.Sample{
+			Time:   endTime,
+			Metric: metrics.BlockedRequests,
+			Value:  float64(blocked),
+			Tags:   tags,
+		})
+	}
+	d.dnsQueriesMu.Lock()
+	queries := d.dnsQueries
+	d.dnsQueries = nil
+	d.dnsQueriesMu.Unlock()
+	for _, q := range queries {
+		queryTags := tags.CloneTags()
+		queryTags["dns_server"], queryTags["dns_type"], queryTags["dns_result"] = q.Server, q.Type, q.Result
+		samples = append(samples, stats.Sample{
+			Time:   q.Time,
+			Metric: metrics.DNSLookupDuration,
+			Value:  stats.D(q.Duration),
+			Tags:   stats.IntoSampleTags(&queryTags),
+		})
+	}
+	for _, won := range []struct {
+		family string
+		count  *int64
+	}{{"ipv4", &d.happyEyeballsIPv4}, {"ipv6", &d.happyEyeballsIPv6}} {
+		if count := atomic.SwapInt64(won.count, 0); count > 0 {
+			wonTags := tags.CloneTags()
+			wonTags["ip_family"] = won.family
+			samples = append(samples, stats.Sample{
+				Time:   endTime,
+				Metric: metrics.HappyEyeballsConnections,
+				Value:  float64(count),
+				Tags:   stats.IntoSampleTags(&wonTags),
+			})
+		}
+	}
 	if fullIteration {
 		samples = append(samples, stats.Sample{
 			Time:   endTime,
@@ -0,0 +1,217 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestMatchHostname(t *testing.T) {
+	testdata := []struct {
+		pattern, hostname string
+		match             bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com.", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	}
+	for _, data := range testdata {
+		assert.Equal(t, data.match, MatchHostname(data.pattern, data.hostname), "%s %s", data.pattern, data.hostname)
+	}
+}
+
+func TestDialerBlockedHostnames(t *testing.T) {
+	dialer := NewDialer(net.Dialer{})
+	dialer.BlockedHostnames = []string{"*.example.com"}
+	_, err := dialer.DialContext(context.Background(), "tcp", "www.example.com:80")
+	assert.Equal(t, BlockedHostnameError{hostname: "www.example.com", pattern: "*.example.com"}, err)
+}
+
+func TestDialerBlockedRequests(t *testing.T) {
+	_, cidr, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	dialer := NewDialer(net.Dialer{})
+	dialer.Blacklist = []*net.IPNet{cidr}
+	dialer.BlockedHostnames = []string{"blocked.example.com"}
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "10.1.2.3:80")
+	assert.EqualError(t, err, "IP (10.1.2.3) is in a blacklisted range (10.0.0.0/8)")
+	_, err = dialer.DialContext(context.Background(), "tcp", "blocked.example.com:443")
+	assert.Error(t, err)
+
+	trail := dialer.GetTrail(time.Now(), time.Now(), false, stats.IntoSampleTags(&map[string]string{}))
+	require.Len(t, trail.Samples, 3)
+	assert.Equal(t, metrics.BlockedRequests, trail.Samples[2].Metric)
+	assert.Equal(t, float64(2), trail.Samples[2].Value)
+
+	trail = dialer.GetTrail(time.Now(), time.Now(), false, stats.IntoSampleTags(&map[string]string{}))
+	assert.Len(t, trail.Samples, 2)
+}
+
+func TestDialerHosts(t *testing.T) {
+	var listeners [2]net.Listener
+	var ports [2]int
+	for i := range listeners {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { _ = l.Close() }()
+		listeners[i] = l
+		ports[i] = l.Addr().(*net.TCPAddr).Port
+	}
+
+	dialer := NewDialer(net.Dialer{})
+	dialer.Hosts = map[string]types.HostAddresses{
+		"single.example.com": {{IP: net.ParseIP("127.0.0.1"), Port: ports[1]}},
+		"multi.example.com": {
+			{IP: net.ParseIP("127.0.0.1"), Port: ports[0]},
+			{IP: net.ParseIP("127.0.0.1"), Port: ports[1]},
+		},
+	}
+
+	dial := func(addr string) int {
+		conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		return conn.RemoteAddr().(*net.TCPAddr).Port
+	}
+
+	assert.Equal(t, ports[1], dial("single.example.com:80"))
+
+	first := dial("multi.example.com:80")
+	second := dial("multi.example.com:80")
+	assert.ElementsMatch(t, ports[:], []int{first, second})
+	assert.Equal(t, first, dial("multi.example.com:80"))
+}
+
+func TestDialerLocalIPs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+
+	pool, err := types.ParseIPPool("127.0.0.2-127.0.0.3")
+	require.NoError(t, err)
+	dialer := NewDialer(net.Dialer{})
+	dialer.LocalIPs = pool
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", l.Addr().String())
+		require.NoError(t, err)
+		seen[conn.LocalAddr().(*net.TCPAddr).IP.String()] = true
+		_ = conn.Close()
+	}
+	assert.Equal(t, map[string]bool{"127.0.0.2": true, "127.0.0.3": true}, seen)
+}
+
+func TestDialerHappyEyeballs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	mock := &mockLookup{ips: map[string][]net.IP{
+		"both.example.com": {net.ParseIP("::1"), net.ParseIP("127.0.0.1")},
+	}}
+	newRacingDialer := func(delay time.Duration) *Dialer {
+		dialer := NewDialer(net.Dialer{})
+		dialer.Resolver = newResolver(mock.lookup, types.DNSConfig{
+			Select: null.StringFrom(types.DNSFirst),
+			Policy: null.StringFrom(types.DNSAny),
+		})
+		dialer.HappyEyeballsDelay = delay
+		return dialer
+	}
+	wonSamples := func(dialer *Dialer) []stats.Sample {
+		var samples []stats.Sample
+		trail := dialer.GetTrail(time.Now(), time.Now(), false, stats.IntoSampleTags(&map[string]string{}))
+		for _, sample := range trail.Samples {
+			if sample.Metric == metrics.HappyEyeballsConnections {
+				samples = append(samples, sample)
+			}
+		}
+		return samples
+	}
+
+	t.Run("Failed", func(t *testing.T) {
+		// Nothing listens on the port on ::1, so the IPv4 attempt starts right away.
+		dialer := newRacingDialer(time.Hour)
+		conn, err := dialer.DialContext(context.Background(), "tcp", "both.example.com:"+port)
+		require.NoError(t, err)
+		_ = conn.Close()
+		assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+
+		samples := wonSamples(dialer)
+		require.Len(t, samples, 1)
+		assert.Equal(t, float64(1), samples[0].Value)
+		assert.Equal(t, map[string]string{"ip_family": "ipv4"}, samples[0].Tags.CloneTags())
+		assert.Empty(t, wonSamples(dialer))
+	})
+
+	t.Run("Delayed", func(t *testing.T) {
+		dialer := newRacingDialer(10 * time.Millisecond)
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			if strings.HasPrefix(address, "[::1]") {
+				time.Sleep(time.Second)
+			}
+			return nil
+		}
+		start := time.Now()
+		conn, err := dialer.DialContext(context.Background(), "tcp", "both.example.com:"+port)
+		require.NoError(t, err)
+		_ = conn.Close()
+		assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		dialer := newRacingDialer(0)
+		_, err := dialer.DialContext(context.Background(), "tcp", "both.example.com:"+port)
+		assert.Error(t, err)
+		assert.Empty(t, wonSamples(dialer))
+	})
+
+	t.Run("Blacklisted", func(t *testing.T) {
+		_, cidr, err := net.ParseCIDR("127.0.0.0/8")
+		require.NoError(t, err)
+		dialer := newRacingDialer(time.Hour)
+		dialer.Blacklist = []*net.IPNet{cidr}
+		_, err = dialer.DialContext(context.Background(), "tcp", "both.example.com:"+port)
+		assert.Error(t, err)
+		assert.Zero(t, dialer.BlockedRequests)
+	})
+}
@@ -0,0 +1,255 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// DNSQuery is one of the queries that a resolver with a custom DNS server made to it.
+type DNSQuery struct {
+	Server   string // The URL of the server
+	Type     string // The type of the query, e.g. "A" or "AAAA"
+	Result   string // The response code, e.g. "NOERROR" or "NXDOMAIN", or "error" without a response
+	Time     time.Time
+	Duration time.Duration
+}
+
+// The names of the query types and response codes of DNSQuery.
+var (
+	dnsTypeNames  = map[uint16]string{1: "A", 5: "CNAME", 28: "AAAA"}
+	dnsRcodeNames = map[byte]string{
+		0: "NOERROR", 1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+	}
+)
+
+// The longest DNS-over-HTTPS response that's read, which is the longest possible DNS message.
+const maxDNSMessageSize = 65535
+
+// dnsServer resolves hostnames with a DNS-over-HTTPS or DNS-over-TLS server. The queries are made
+// by the pure Go resolver of the standard library, with connections to the server that look like
+// plain DNS over TCP to it: DNS-over-TLS uses the same framing, and DNS-over-HTTPS requests are
+// sent for the messages that are written to the connections.
+type dnsServer struct {
+	url       *url.URL
+	client    *http.Client
+	tlsConfig *tls.Config
+}
+
+func newDNSServer(u *url.URL) *dnsServer {
+	return &dnsServer{
+		url:       u,
+		client:    &http.Client{},
+		tlsConfig: &tls.Config{ServerName: u.Hostname()},
+	}
+}
+
+// lookup resolves the host with the server, and returns the queries that it took.
+func (s *dnsServer) lookup(host string) ([]net.IP, []DNSQuery, error) {
+	rec := &dnsQueryRecorder{}
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.dial(ctx, rec)
+		},
+	}
+	addrs, err := r.LookupIPAddr(context.Background(), host)
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, rec.get(), err
+}
+
+func (s *dnsServer) dial(ctx context.Context, rec *dnsQueryRecorder) (net.Conn, error) {
+	query := DNSQuery{Server: s.url.String(), Result: "error", Time: time.Now()}
+	var conn net.Conn
+	if s.url.Scheme == types.DNSOverHTTPS {
+		conn = &dohConn{ctx: ctx, server: s}
+	} else {
+		var dialer net.Dialer
+		raw, err := dialer.DialContext(ctx, "tcp", s.url.Host)
+		if err != nil {
+			query.Duration = time.Since(query.Time)
+			rec.add(query)
+			return nil, err
+		}
+		tlsConn := tls.Client(raw, s.tlsConfig)
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = tlsConn.SetDeadline(deadline)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			_ = raw.Close()
+			query.Duration = time.Since(query.Time)
+			rec.add(query)
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return &dnsQueryConn{Conn: conn, rec: rec, query: query}, nil
+}
+
+// dnsQueryRecorder collects the queries of a lookup, which the Go resolver makes concurrently.
+type dnsQueryRecorder struct {
+	mu      sync.Mutex
+	queries []DNSQuery
+}
+
+func (r *dnsQueryRecorder) add(q DNSQuery) {
+	r.mu.Lock()
+	r.queries = append(r.queries, q)
+	r.mu.Unlock()
+}
+
+func (r *dnsQueryRecorder) get() []DNSQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queries
+}
+
+// dnsQueryConn is a connection for a single query, which is recorded once it's closed. The
+// messages on it are prefixed with their 2-byte length, as for DNS over TCP.
+type dnsQueryConn struct {
+	net.Conn
+	rec    *dnsQueryRecorder
+	query  DNSQuery
+	header []byte // The start of the response, up to its response code
+	once   sync.Once
+}
+
+func (c *dnsQueryConn) Write(b []byte) (int, error) {
+	// The question follows the length and the 12-byte header: the name, then the type.
+	if c.query.Type == "" && len(b) > 14 {
+		question, i := b[14:], 0
+		for i < len(question) && question[i] != 0 {
+			i += 1 + int(question[i])
+		}
+		if i+2 < len(question) {
+			qtype := binary.BigEndian.Uint16(question[i+1 : i+3])
+			if c.query.Type = dnsTypeNames[qtype]; c.query.Type == "" {
+				c.query.Type = fmt.Sprintf("TYPE%d", qtype)
+			}
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *dnsQueryConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if missing := 6 - len(c.header); missing > 0 {
+		if missing > n {
+			missing = n
+		}
+		c.header = append(c.header, b[:missing]...)
+	}
+	return n, err
+}
+
+func (c *dnsQueryConn) Close() error {
+	c.once.Do(func() {
+		c.query.Duration = time.Since(c.query.Time)
+		if len(c.header) == 6 {
+			rcode := c.header[5] & 0x0F
+			if c.query.Result = dnsRcodeNames[rcode]; c.query.Result == "" {
+				c.query.Result = fmt.Sprintf("RCODE%d", rcode)
+			}
+		}
+		c.rec.add(c.query)
+	})
+	return c.Conn.Close()
+}
+
+// dohConn sends the DNS messages that are written to it to a DNS-over-HTTPS server, and returns
+// the responses when it's read from, with the framing of DNS over TCP.
+type dohConn struct {
+	ctx    context.Context
+	server *dnsServer
+
+	wbuf []byte
+	rbuf bytes.Buffer
+}
+
+var _ net.Conn = &dohConn{}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.wbuf = append(c.wbuf, b...)
+	for len(c.wbuf) >= 2 {
+		size := int(binary.BigEndian.Uint16(c.wbuf))
+		if len(c.wbuf) < 2+size {
+			break
+		}
+		resp, err := c.roundTrip(c.wbuf[2 : 2+size])
+		if err != nil {
+			return 0, err
+		}
+		c.wbuf = c.wbuf[2+size:]
+		_ = binary.Write(&c.rbuf, binary.BigEndian, uint16(len(resp)))
+		_, _ = c.rbuf.Write(resp)
+	}
+	return len(b), nil
+}
+
+func (c *dohConn) roundTrip(msg []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", c.server.url.String(), bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c.ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	res, err := c.server.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the DNS-over-HTTPS server responded with %s", res.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, maxDNSMessageSize))
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.rbuf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.rbuf.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,190 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// dnsTestResponse answers a DNS query with the IPs of the host, or NXDOMAIN if there aren't any.
+func dnsTestResponse(query []byte, hosts map[string][]net.IP) []byte {
+	end := 12
+	var labels []string
+	for query[end] != 0 {
+		labels = append(labels, string(query[end+1:end+1+int(query[end])]))
+		end += 1 + int(query[end])
+	}
+	end += 5
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	var answers [][]byte
+	for _, ip := range hosts[strings.Join(labels, ".")] {
+		if ip4 := ip.To4(); ip4 != nil && qtype == 1 {
+			answers = append(answers, ip4)
+		} else if ip4 == nil && qtype == 28 {
+			answers = append(answers, ip.To16())
+		}
+	}
+
+	resp := append([]byte{}, query[:12]...)
+	binary.BigEndian.PutUint16(resp[2:], 0x8180) // A recursive response
+	if _, ok := hosts[strings.Join(labels, ".")]; !ok {
+		resp[3] |= 3
+	}
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	binary.BigEndian.PutUint32(resp[8:], 0)
+	resp = append(resp, query[12:end]...)
+	for _, rdata := range answers {
+		answer := []byte{0xC0, 12, 0, 0, 0, 1, 0, 0, 0, 60, 0, 0}
+		binary.BigEndian.PutUint16(answer[2:], qtype)
+		binary.BigEndian.PutUint16(answer[10:], uint16(len(rdata)))
+		resp = append(resp, append(answer, rdata...)...)
+	}
+	return resp
+}
+
+func serveDoT(l net.Listener, hosts map[string][]net.IP) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			for {
+				var size uint16
+				if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+					return
+				}
+				query := make([]byte, size)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := dnsTestResponse(query, hosts)
+				_ = binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+				_, _ = conn.Write(resp)
+			}
+		}()
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+	hosts := map[string][]net.IP{
+		"test.k6.io":  {net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+		"other.k6.io": {net.ParseIP("10.0.0.2")},
+	}
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		query, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(dnsTestResponse(query, hosts))
+	}))
+	defer doh.Close()
+	rootCAs := doh.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	dotListener, err := tls.Listen("tcp", "127.0.0.1:0", doh.TLS)
+	require.NoError(t, err)
+	defer func() { _ = dotListener.Close() }()
+	go serveDoT(dotListener, hosts)
+
+	servers := map[string]string{
+		"DoH": doh.URL + "/dns-query",
+		"DoT": "tls://" + dotListener.Addr().String(),
+	}
+	for name, server := range servers {
+		server := server
+		t.Run(name, func(t *testing.T) {
+			u, err := types.DNSConfig{Server: null.StringFrom(server)}.ParseServer()
+			require.NoError(t, err)
+			s := newDNSServer(u)
+			s.client = doh.Client()
+			s.tlsConfig.RootCAs = rootCAs
+
+			ips, queries, err := s.lookup("test.k6.io")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"10.0.0.1", "2001:db8::1"}, []string{ips[0].String(), ips[1].String()})
+			require.Len(t, queries, 2)
+			assert.ElementsMatch(t, []string{"A", "AAAA"}, []string{queries[0].Type, queries[1].Type})
+			for _, q := range queries {
+				assert.Equal(t, u.String(), q.Server)
+				assert.Equal(t, "NOERROR", q.Result)
+				assert.True(t, q.Duration > 0)
+			}
+
+			_, queries, err = s.lookup("missing.k6.io")
+			assert.Error(t, err)
+			require.NotEmpty(t, queries)
+			assert.Equal(t, "NXDOMAIN", queries[0].Result)
+
+			t.Run("dialer", func(t *testing.T) {
+				r := newResolver(s.lookup, types.DNSConfig{Policy: null.StringFrom(types.DNSOnlyIPv4)})
+				d := NewDialer(net.Dialer{Timeout: 100 * time.Millisecond})
+				d.Resolver = r
+				d.Blacklist = []*net.IPNet{{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}}
+
+				for i := 0; i < 2; i++ {
+					_, err := d.DialContext(context.Background(), "tcp", "other.k6.io:80")
+					assert.IsType(t, BlackListedIPError{}, err)
+				}
+				trail := d.GetTrail(time.Now(), time.Now(), false, nil)
+				var lookups []string
+				for _, sample := range trail.Samples {
+					if sample.Metric == metrics.DNSLookupDuration {
+						dnsType, _ := sample.Tags.Get("dns_type")
+						result, _ := sample.Tags.Get("dns_result")
+						lookups = append(lookups, dnsType+" "+result)
+					}
+				}
+				// The second lookup is cached
+				assert.ElementsMatch(t, []string{"A NOERROR", "AAAA NOERROR"}, lookups)
+			})
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		u, _ := url.Parse("tls://127.0.0.1:1")
+		_, queries, err := newDNSServer(u).lookup("test.k6.io")
+		assert.Error(t, err)
+		require.NotEmpty(t, queries)
+		assert.Equal(t, "error", queries[0].Result)
+	})
+}
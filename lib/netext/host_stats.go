@@ -0,0 +1,99 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/loadimpact/k6/lib"
+)
+
+// hostStatsConn decrements the open connections of its host when it's closed.
+type hostStatsConn struct {
+	net.Conn
+	counters  *lib.HostCounters
+	closeOnce sync.Once
+}
+
+func (c *hostStatsConn) Close() error {
+	c.closeOnce.Do(func() { atomic.AddInt64(&c.counters.OpenConnections, -1) })
+	return c.Conn.Close()
+}
+
+// HostStatsTransport counts the in-flight, total and failed requests of every host. A request is
+// in flight until its response body is closed.
+type HostStatsTransport struct {
+	Transport http.RoundTripper
+	Stats     *lib.HostStats
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HostStatsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	counters := t.Stats.Host(hostPort(req))
+	atomic.AddInt64(&counters.Requests, 1)
+	atomic.AddInt64(&counters.InFlightRequests, 1)
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		atomic.AddInt64(&counters.Errors, 1)
+		atomic.AddInt64(&counters.InFlightRequests, -1)
+		return res, err
+	}
+	if res.StatusCode >= 500 {
+		atomic.AddInt64(&counters.Errors, 1)
+	}
+	res.Body = &hostStatsBody{ReadCloser: res.Body, counters: counters}
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (t *HostStatsTransport) CloseIdleConnections() {
+	if transport, ok := t.Transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+type hostStatsBody struct {
+	io.ReadCloser
+	counters  *lib.HostCounters
+	closeOnce sync.Once
+}
+
+func (b *hostStatsBody) Close() error {
+	b.closeOnce.Do(func() { atomic.AddInt64(&b.counters.InFlightRequests, -1) })
+	return b.ReadCloser.Close()
+}
+
+// hostPort returns the "host:port" of the request's URL, with the default port of the scheme if
+// it doesn't have one, which is the same address that the dialer gets.
+func hostPort(req *http.Request) string {
+	if port := req.URL.Port(); port != "" {
+		return req.URL.Host
+	}
+	port := "80"
+	if req.URL.Scheme == "https" || req.URL.Scheme == "wss" {
+		port = "443"
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
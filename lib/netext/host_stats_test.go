@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	hostStats := lib.NewHostStats()
+	dialer := NewDialer(net.Dialer{})
+	dialer.HostStats = hostStats
+	transport := &HostStatsTransport{
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		Stats:     hostStats,
+	}
+	counters := hostStats.Host(u.Host)
+
+	res, err := transport.RoundTrip(httptest.NewRequest("GET", srv.URL+"/ok", nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&counters.InFlightRequests))
+	_, err = ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&counters.InFlightRequests))
+
+	res, err = transport.RoundTrip(httptest.NewRequest("GET", srv.URL+"/fail", nil))
+	require.NoError(t, err)
+	_, _ = ioutil.ReadAll(res.Body)
+	require.NoError(t, res.Body.Close())
+
+	assert.Equal(t, []lib.HostStatsSnapshot{{Host: u.Host, HostCounters: lib.HostCounters{
+		OpenConnections: 1, InFlightRequests: 0, Requests: 2, Errors: 1,
+	}}}, hostStats.Snapshot())
+
+	transport.CloseIdleConnections()
+	assert.Equal(t, int64(0), atomic.LoadInt64(&counters.OpenConnections))
+
+	t.Run("failed connection", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		_, err = dialer.DialContext(context.Background(), "tcp", addr)
+		require.Error(t, err)
+		assert.Equal(t, int64(1), atomic.LoadInt64(&hostStats.Host(addr).Errors))
+		assert.Equal(t, int64(0), atomic.LoadInt64(&hostStats.Host(addr).OpenConnections))
+	})
+}
+
+func TestHostPort(t *testing.T) {
+	testdata := map[string]string{
+		"http://example.com/":       "example.com:80",
+		"https://example.com/":      "example.com:443",
+		"https://example.com:8443/": "example.com:8443",
+		"http://[::1]/":             "[::1]:80",
+	}
+	for rawurl, expected := range testdata {
+		assert.Equal(t, expected, hostPort(httptest.NewRequest("GET", rawurl, nil)), rawurl)
+	}
+}
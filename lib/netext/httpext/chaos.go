@@ -0,0 +1,68 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package httpext
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// InjectedFaultError is the error of the requests that fail because of an injected fault, see
+// the chaos option.
+type InjectedFaultError struct{}
+
+func (InjectedFaultError) Error() string {
+	return injectedFaultErrorMsg
+}
+
+// truncatedBody cuts off a response body after the given number of bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// truncateBody returns a body that only has the first half of the given one, or nothing if the
+// length of the body isn't known in advance.
+func truncateBody(body io.ReadCloser, length int64) io.ReadCloser {
+	return &truncatedBody{ReadCloser: body, left: length / 2}
+}
+
+// injectDelay waits for the given delay, unless the context is done first.
+func injectDelay(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
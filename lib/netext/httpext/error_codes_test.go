@@ -86,6 +86,14 @@ func TestBlackListedIPError(t *testing.T) {
 	require.Equal(t, blackListedIPErrorCode, errorCode)
 }
 
+func TestBlockedHostnameError(t *testing.T) {
+	var err = netext.BlockedHostnameError{}
+	testErrorCode(t, blockedHostnameErrorCode, err)
+	var errorCode, errorMsg = errorCodeForError(err)
+	require.NotEqual(t, err.Error(), errorMsg)
+	require.Equal(t, blockedHostnameErrorCode, errorCode)
+}
+
 type timeoutError bool
 
 func (t timeoutError) Timeout() bool {
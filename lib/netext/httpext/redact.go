@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// nameMatches checks if the supplied header or cookie name matches any of the patterns. The
+// comparison is case-insensitive and the patterns can contain wildcards (see path.Match).
+func nameMatches(name string, patterns []string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redactCookies replaces the values of the matching cookies in a list of name=value pairs,
+// like the ones in the Cookie header or in the beginning of a Set-Cookie header.
+func redactCookies(cookies string, patterns []string) string {
+	pairs := strings.Split(cookies, ";")
+	for i, pair := range pairs {
+		eq := strings.IndexByte(pair, '=')
+		if eq > 0 && nameMatches(pair[:eq], patterns) {
+			pairs[i] = pair[:eq+1] + redactedValue
+		}
+	}
+	return strings.Join(pairs, ";")
+}
+
+// redactDump replaces the values of the matching headers and cookies in a raw HTTP request or
+// response dump. The body, if present, is left as it is.
+func redactDump(dump []byte, headerPatterns, cookiePatterns []string) []byte {
+	if len(headerPatterns) == 0 && len(cookiePatterns) == 0 {
+		return dump
+	}
+
+	head, body := dump, []byte(nil)
+	if idx := bytes.Index(dump, []byte("\r\n\r\n")); idx >= 0 {
+		head, body = dump[:idx], dump[idx:]
+	}
+
+	lines := strings.Split(string(head), "\r\n")
+	for i := 1; i < len(lines); i++ { // The first line is the request or status line
+		colon := strings.IndexByte(lines[i], ':')
+		if colon <= 0 {
+			continue
+		}
+		name, value := lines[i][:colon], lines[i][colon+1:]
+		switch {
+		case nameMatches(name, headerPatterns):
+			value = " " + redactedValue
+		case len(cookiePatterns) == 0:
+			continue
+		case strings.EqualFold(name, "Cookie"):
+			value = redactCookies(value, cookiePatterns)
+		case strings.EqualFold(name, "Set-Cookie"):
+			// Only the first pair is the actual cookie, the rest are its attributes
+			if semicolon := strings.IndexByte(value, ';'); semicolon >= 0 {
+				value = redactCookies(value[:semicolon], cookiePatterns) + value[semicolon:]
+			} else {
+				value = redactCookies(value, cookiePatterns)
+			}
+		}
+		lines[i] = name + ":" + value
+	}
+
+	return append([]byte(strings.Join(lines, "\r\n")), body...)
+}
@@ -0,0 +1,100 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactDump(t *testing.T) {
+	t.Parallel()
+	const reqDump = "GET /get HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Authorization: Bearer secret\r\n" +
+		"X-Api-Token: secret\r\n" +
+		"Cookie: session_id=secret; theme=dark\r\n" +
+		"\r\n" +
+		"Authorization: body is not touched"
+	const resDump = "HTTP/1.1 200 OK\r\n" +
+		"Content-Length: 0\r\n" +
+		"Set-Cookie: session_id=secret; Path=/; HttpOnly\r\n" +
+		"Set-Cookie: theme=dark\r\n" +
+		"\r\n"
+
+	testdata := map[string]struct {
+		dump, expected          string
+		headerPatterns, cookies []string
+	}{
+		"nothing": {reqDump, reqDump, nil, nil},
+		"headers": {
+			reqDump,
+			"GET /get HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Authorization: [REDACTED]\r\n" +
+				"X-Api-Token: [REDACTED]\r\n" +
+				"Cookie: session_id=secret; theme=dark\r\n" +
+				"\r\n" +
+				"Authorization: body is not touched",
+			[]string{"authorization", "X-*-Token"}, nil,
+		},
+		"cookies": {
+			reqDump,
+			"GET /get HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Authorization: Bearer secret\r\n" +
+				"X-Api-Token: secret\r\n" +
+				"Cookie: session_id=[REDACTED]; theme=dark\r\n" +
+				"\r\n" +
+				"Authorization: body is not touched",
+			nil, []string{"session*"},
+		},
+		"cookie header": {
+			reqDump,
+			"GET /get HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Authorization: Bearer secret\r\n" +
+				"X-Api-Token: secret\r\n" +
+				"Cookie: [REDACTED]\r\n" +
+				"\r\n" +
+				"Authorization: body is not touched",
+			[]string{"Cookie"}, []string{"theme"},
+		},
+		"set-cookie": {
+			resDump,
+			"HTTP/1.1 200 OK\r\n" +
+				"Content-Length: 0\r\n" +
+				"Set-Cookie: session_id=[REDACTED]; Path=/; HttpOnly\r\n" +
+				"Set-Cookie: theme=dark\r\n" +
+				"\r\n",
+			nil, []string{"SESSION_ID", "path"},
+		},
+	}
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			result := redactDump([]byte(data.dump), data.headerPatterns, data.cookies)
+			assert.Equal(t, data.expected, string(result))
+		})
+	}
+}
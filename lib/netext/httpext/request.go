@@ -41,6 +41,7 @@ import (
 	digest "github.com/Soontao/goHttpDigestClient"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	null "gopkg.in/guregu/null.v3"
 )
@@ -92,6 +93,14 @@ type ParsedHTTPRequest struct {
 	ActiveJar    *cookiejar.Jar
 	Cookies      map[string]*HTTPRequestCookie
 	Tags         map[string]string
+	MultiTags    map[string][]string
+	Metadata     map[string]string
+	LongPoll     bool
+	Pool         string
+	Signer       RequestSigner
+	BodyStream   BodyStream
+
+	ResponseCallback lib.ResponseCallback
 }
 
 func stdCookiesToHTTPRequestCookies(cookies []*http.Cookie) map[string][]*HTTPRequestCookie {
@@ -109,6 +118,16 @@ func stdCookiesToHTTPRequestCookies(cookies []*http.Cookie) map[string][]*HTTPRe
 func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error) {
 	state := lib.GetState(ctx)
 
+	// Streamed bodies can only be sent once, and they're never all in memory.
+	if preq.BodyStream != nil {
+		if preq.Auth == "digest" {
+			return nil, errors.New("streamed request bodies can't be used with digest authentication")
+		}
+		if preq.Signer != nil {
+			return nil, errors.New("streamed request bodies can't be signed")
+		}
+	}
+
 	respReq := &Request{
 		Method:  preq.Req.Method,
 		URL:     preq.Req.URL.String(),
@@ -119,7 +138,7 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		respReq.Body = preq.Body.String()
 	}
 
-	tags := state.Options.RunTags.CloneTags()
+	tags := state.CloneTags()
 	for k, v := range preq.Tags {
 		tags[k] = v
 	}
@@ -145,14 +164,39 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		tags["iter"] = strconv.FormatInt(state.Iteration, 10)
 	}
 
+	// The enabled system tags (except for name) take precedence over multi-value tags, as they
+	// do over the normal tags.
+	var multiTags map[string][]string
+	for k, values := range preq.MultiTags {
+		if k != "name" && state.Options.SystemTags[k] {
+			continue
+		}
+		if multiTags == nil {
+			multiTags = make(map[string][]string, len(preq.MultiTags))
+		}
+		multiTags[k] = values
+	}
+
 	// Check rate limit *after* we've prepared a request; no need to wait with that part.
-	if rpsLimit := state.RPSLimit; rpsLimit != nil {
+	for _, rpsLimit := range lib.GetRPSLimiters(ctx) {
 		if err := rpsLimit.Wait(ctx); err != nil {
 			return nil, err
 		}
 	}
 
-	tracerTransport := newTransport(state.Transport, state.Samples, &state.Options, tags)
+	roundTripper := state.Transport
+	if preq.Pool != "" {
+		pool, ok := state.Pools[preq.Pool]
+		if !ok {
+			return nil, fmt.Errorf("unknown connection pool '%s'", preq.Pool)
+		}
+		roundTripper = pool
+	}
+	tracerTransport := newTransport(roundTripper, state.Samples, &state.Options, tags, multiTags)
+	tracerTransport.longPoll = preq.LongPoll
+	tracerTransport.metadata = preq.Metadata
+	tracerTransport.responseCallback = preq.ResponseCallback
+	tracerTransport.chaosRand = state.ChaosRand
 	var transport http.RoundTripper = tracerTransport
 	if preq.Auth == "ntlm" {
 		transport = ntlmssp.Negotiator{
@@ -237,8 +281,41 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		}
 	}
 
-	debugRequest(state, preq.Req, "Request")
-	res, resErr := client.Do(preq.Req.WithContext(ctx))
+	if preq.Signer != nil {
+		if err := preq.Sign(); err != nil {
+			return nil, err
+		}
+		resp.Request.Method = preq.Req.Method
+		resp.Request.URL = preq.Req.URL.String()
+		resp.Request.Headers = preq.Req.Header
+		if preq.Body != nil {
+			resp.Request.Body = preq.Body.String()
+		}
+	}
+
+	// Trailers are only sent after a chunked body, so requests with trailers get an empty one if
+	// they don't have a body. GET and HEAD requests are still sent without it.
+	if len(preq.Req.Trailer) > 0 && preq.BodyStream == nil {
+		if preq.Req.Body == nil {
+			preq.Req.Body = ioutil.NopCloser(bytes.NewReader(nil))
+		}
+		preq.Req.ContentLength = -1
+	}
+
+	var (
+		res    *http.Response
+		resErr error
+	)
+	do := func() { res, resErr = client.Do(preq.Req.WithContext(ctx)) }
+	if preq.BodyStream != nil {
+		body := newStreamedBody(preq.BodyStream)
+		preq.Req.Body, preq.Req.ContentLength = body, -1
+		debugRequest(state, preq.Req, "Request")
+		body.serve(do)
+	} else {
+		debugRequest(state, preq.Req, "Request")
+		do()
+	}
 	debugResponse(state, res, "Response")
 	resp.Error = tracerTransport.errorMsg
 	resp.ErrorCode = int(tracerTransport.errorCode)
@@ -293,6 +370,7 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		Connecting:     stats.D(trail.Connecting),
 		TLSHandshaking: stats.D(trail.TLSHandshaking),
 		Sending:        stats.D(trail.Sending),
+		ExpectContinue: stats.D(trail.ExpectContinue),
 		Waiting:        stats.D(trail.Waiting),
 		Receiving:      stats.D(trail.Receiving),
 	}
@@ -312,11 +390,22 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 			resp.setTLSInfo(res.TLS)
 		}
 
+		resp.Timings.ServerTiming = ParseServerTiming(res.Header)
+
 		resp.Headers = make(map[string]string, len(res.Header))
 		for k, vs := range res.Header {
 			resp.Headers[k] = strings.Join(vs, ", ")
 		}
 
+		// The body was read, so the trailers that the server sent are known. The ones that it
+		// only announced in the Trailer header don't have any values.
+		resp.Trailers = make(map[string]string, len(res.Trailer))
+		for k, vs := range res.Trailer {
+			if len(vs) > 0 {
+				resp.Trailers[k] = strings.Join(vs, ", ")
+			}
+		}
+
 		resCookies := res.Cookies()
 		resp.Cookies = make(map[string][]*HTTPCookie, len(resCookies))
 		for _, c := range resCookies {
@@ -370,11 +459,13 @@ func SetRequestCookies(req *http.Request, jar *cookiejar.Jar, reqCookies map[str
 
 func debugRequest(state *lib.State, req *http.Request, description string) {
 	if state.Options.HttpDebug.String != "" {
-		dump, err := httputil.DumpRequestOut(req, state.Options.HttpDebug.String == "full")
+		// Dumping a streamed body would consume it before the request is sent.
+		_, streamed := req.Body.(*streamedBody)
+		dump, err := httputil.DumpRequestOut(req, state.Options.HttpDebug.String == "full" && !streamed)
 		if err != nil {
 			log.Fatal(err)
 		}
-		logDump(description, dump)
+		logDump(description, redactDump(dump, state.Options.RedactHeaders, state.Options.RedactCookies))
 	}
 }
 func logDump(description string, dump []byte) {
@@ -67,8 +67,11 @@ type ResponseTimings struct {
 	Connecting     float64 `json:"connecting"`
 	TLSHandshaking float64 `json:"tls_handshaking"`
 	Sending        float64 `json:"sending"`
+	ExpectContinue float64 `json:"expect_continue"`
 	Waiting        float64 `json:"waiting"`
 	Receiving      float64 `json:"receiving"`
+
+	ServerTiming []ServerTiming `json:"server_timing"`
 }
 
 // HTTPCookie is a representation of an http cookies used in the Response object
@@ -89,6 +92,7 @@ type Response struct {
 	Status         int                      `json:"status"`
 	Proto          string                   `json:"proto"`
 	Headers        map[string]string        `json:"headers"`
+	Trailers       map[string]string        `json:"trailers"`
 	Cookies        map[string][]*HTTPCookie `json:"cookies"`
 	Body           interface{}              `json:"body"`
 	Timings        ResponseTimings          `json:"timings"`
@@ -121,7 +125,7 @@ func debugResponse(state *lib.State, res *http.Response, description string) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		logDump(description, dump)
+		logDump(description, redactDump(dump, state.Options.RedactHeaders, state.Options.RedactCookies))
 	}
 }
 
@@ -0,0 +1,137 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// ServerTiming is a single metric reported by the server in a Server-Timing response header,
+// see https://www.w3.org/TR/server-timing/
+type ServerTiming struct {
+	Name        string  `json:"name"`
+	Duration    float64 `json:"duration"`
+	Description string  `json:"description"`
+}
+
+// ParseServerTiming parses the values of all Server-Timing headers in h. Malformed entries
+// (i.e. ones without a name) are skipped, and a missing or invalid dur parameter results in a
+// 0 duration, as the spec requires. The result is never nil, so scripts always get an array.
+func ParseServerTiming(h http.Header) []ServerTiming {
+	timings := []ServerTiming{}
+	for _, value := range h["Server-Timing"] {
+		for _, entry := range splitQuoted(value, ',') {
+			params := splitQuoted(entry, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+			timing := ServerTiming{Name: name}
+			for _, param := range params[1:] {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				val := unquote(strings.TrimSpace(kv[1]))
+				switch strings.ToLower(strings.TrimSpace(kv[0])) {
+				case "dur":
+					if d, err := strconv.ParseFloat(val, 64); err == nil {
+						timing.Duration = d
+					}
+				case "desc":
+					timing.Description = val
+				}
+			}
+			timings = append(timings, timing)
+		}
+	}
+	return timings
+}
+
+// serverTimingSamples returns a http_req_server_timing sample for every entry, tagged with
+// the request tags and the metric name as the server_timing tag.
+func serverTimingSamples(timings []ServerTiming, t time.Time, tags *stats.SampleTags) stats.Samples {
+	if len(timings) == 0 {
+		return nil
+	}
+	base, multiTags := tags.CloneTags(), tags.CloneMultiTags()
+	samples := make(stats.Samples, 0, len(timings))
+	for _, timing := range timings {
+		sampleTags := make(map[string]string, len(base)+1)
+		for k, v := range base {
+			sampleTags[k] = v
+		}
+		sampleTags["server_timing"] = timing.Name
+		samples = append(samples, stats.Sample{
+			Metric: metrics.HTTPReqServerTiming,
+			Time:   t,
+			Tags:   stats.IntoSampleTags(&sampleTags).WithMultiTags(multiTags),
+			Value:  timing.Duration,
+		})
+	}
+	return samples
+}
+
+// splitQuoted splits s on sep, ignoring separators inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts   []string
+		start   int
+		inQuote bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case sep:
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	t.Parallel()
+	testdata := map[string]struct {
+		headers  []string
+		expected []ServerTiming
+	}{
+		"none": {nil, []ServerTiming{}},
+		"simple": {
+			[]string{"db;dur=53"},
+			[]ServerTiming{{Name: "db", Duration: 53}},
+		},
+		"multiple": {
+			[]string{`cache;desc="Cache Read";dur=23.2, app;dur=47.2`, "miss"},
+			[]ServerTiming{
+				{Name: "cache", Duration: 23.2, Description: "Cache Read"},
+				{Name: "app", Duration: 47.2},
+				{Name: "miss"},
+			},
+		},
+		"quoted separators": {
+			[]string{`total;desc="a, b; \"c\"";dur=1`},
+			[]ServerTiming{{Name: "total", Duration: 1, Description: `a, b; "c"`}},
+		},
+		"case and whitespace": {
+			[]string{` edge ; DUR = 2 ; Desc=cdn `},
+			[]ServerTiming{{Name: "edge", Duration: 2, Description: "cdn"}},
+		},
+		"invalid": {
+			[]string{";dur=1, ,x;dur=abc;foo"},
+			[]ServerTiming{{Name: "x"}},
+		},
+	}
+
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h := http.Header{}
+			for _, v := range data.headers {
+				h.Add("Server-Timing", v)
+			}
+			assert.Equal(t, data.expected, ParseServerTiming(h))
+		})
+	}
+}
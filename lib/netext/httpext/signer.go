@@ -0,0 +1,119 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SignableRequest is what a RequestSigner gets to sign, and to change, just before the request
+// is sent.
+type SignableRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// A RequestSigner signs requests, e.g. with an HMAC of their method, URL, headers and body in a
+// header. It can change all of them. The signers registered with RegisterRequestSigner are shared
+// between all VUs, so they have to be safe for concurrent use.
+type RequestSigner interface {
+	SignRequest(req *SignableRequest) error
+}
+
+// RequestSignerFunc is an adapter that allows using ordinary functions as request signers.
+type RequestSignerFunc func(req *SignableRequest) error
+
+// SignRequest calls f(req).
+func (f RequestSignerFunc) SignRequest(req *SignableRequest) error {
+	return f(req)
+}
+
+//nolint:gochecknoglobals
+var (
+	signersMutex sync.RWMutex
+	signers      = map[string]RequestSigner{}
+)
+
+// RegisterRequestSigner makes a request signer available to scripts under the given name, which
+// they pass in the signer param of the requests. It panics if a signer with the same name is
+// already registered.
+func RegisterRequestSigner(name string, signer RequestSigner) {
+	signersMutex.Lock()
+	defer signersMutex.Unlock()
+	if _, ok := signers[name]; ok {
+		panic("request signer '" + name + "' is already registered")
+	}
+	signers[name] = signer
+}
+
+// GetRequestSigner returns the request signer registered under the given name.
+func GetRequestSigner(name string) (RequestSigner, error) {
+	signersMutex.RLock()
+	defer signersMutex.RUnlock()
+	signer, ok := signers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown request signer '%s'", name)
+	}
+	return signer, nil
+}
+
+// Sign signs the request with its signer, if it has one, and applies the signer's changes to
+// it. The signer is removed afterwards, so requests are only signed once.
+func (preq *ParsedHTTPRequest) Sign() error {
+	if preq.Signer == nil {
+		return nil
+	}
+	signer := preq.Signer
+	preq.Signer = nil
+
+	sreq := &SignableRequest{Method: preq.Req.Method, URL: preq.Req.URL, Header: preq.Req.Header}
+	if preq.Body != nil {
+		sreq.Body = preq.Body.Bytes()
+	}
+	if err := signer.SignRequest(sreq); err != nil {
+		return errors.Wrap(err, "couldn't sign the request")
+	}
+	if sreq.URL == nil {
+		return errors.New("couldn't sign the request: the signer removed its URL")
+	}
+
+	preq.Req.Method = sreq.Method
+	preq.Req.URL = sreq.URL
+	preq.Req.Header = sreq.Header
+	if preq.Req.Header == nil {
+		preq.Req.Header = make(http.Header)
+	}
+	if sreq.Body == nil && preq.Body == nil {
+		return nil
+	}
+	preq.Body = bytes.NewBuffer(sreq.Body)
+	preq.Req.Body = ioutil.NopCloser(preq.Body)
+	preq.Req.ContentLength = int64(len(sreq.Body))
+	return nil
+}
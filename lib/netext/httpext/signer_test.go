@@ -0,0 +1,67 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestSigner(t *testing.T) {
+	signer := RequestSignerFunc(func(req *SignableRequest) error {
+		req.Header.Set("X-Signature", string(req.Body))
+		req.Body = append(req.Body, '!')
+		return nil
+	})
+	RegisterRequestSigner("httpext-test", signer)
+	assert.Panics(t, func() { RegisterRequestSigner("httpext-test", signer) })
+	_, err := GetRequestSigner("httpext-test")
+	assert.NoError(t, err)
+	_, err = GetRequestSigner("httpext-missing")
+	assert.EqualError(t, err, "unknown request signer 'httpext-missing'")
+
+	u, err := url.Parse("http://example.com/")
+	require.NoError(t, err)
+	preq := &ParsedHTTPRequest{
+		Req:    &http.Request{Method: "POST", URL: u, Header: make(http.Header)},
+		Body:   bytes.NewBufferString("body"),
+		Signer: signer,
+	}
+	require.NoError(t, preq.Sign())
+	assert.Nil(t, preq.Signer)
+	assert.Equal(t, "body", preq.Req.Header.Get("X-Signature"))
+	assert.Equal(t, int64(5), preq.Req.ContentLength)
+	body, err := ioutil.ReadAll(preq.Req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body!", string(body))
+
+	preq.Signer = RequestSignerFunc(func(req *SignableRequest) error {
+		req.URL = nil
+		return nil
+	})
+	assert.EqualError(t, preq.Sign(), "couldn't sign the request: the signer removed its URL")
+}
@@ -0,0 +1,110 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// BodyStream returns the next chunk of a streamed request body with every call, and io.EOF after
+// the last one. The chunks are sent with chunked transfer encoding as the transport asks for
+// them, so the body doesn't have to be in memory all at once. It's only called from the
+// goroutine that called MakeRequest(), even though the transport reads the body in another one.
+type BodyStream func() ([]byte, error)
+
+var errBodyStreamStopped = errors.New("the request body stream was stopped")
+
+type streamedChunk struct {
+	data []byte
+	err  error
+}
+
+// streamedBody is the io.ReadCloser of a streamed request body. Reads from the transport's
+// goroutine ask the goroutine that runs serve() for the next chunk of the body stream.
+type streamedBody struct {
+	next    BodyStream
+	reqs    chan struct{}
+	chunks  chan streamedChunk
+	stopped chan struct{}
+
+	// Only used by Read().
+	buf []byte
+	err error
+}
+
+func newStreamedBody(next BodyStream) *streamedBody {
+	return &streamedBody{
+		next:    next,
+		reqs:    make(chan struct{}),
+		chunks:  make(chan streamedChunk),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Read implements io.Reader.
+func (b *streamedBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		select {
+		case b.reqs <- struct{}{}:
+		case <-b.stopped:
+			b.err = errBodyStreamStopped
+			return 0, b.err
+		}
+		chunk := <-b.chunks
+		b.buf, b.err = chunk.data, chunk.err
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (b *streamedBody) Close() error {
+	return nil
+}
+
+// serve runs do, which sends the request, in another goroutine and calls the body stream on the
+// current one whenever the transport asks for a chunk, until do returns. It must only be called
+// once; reads after it returned fail.
+func (b *streamedBody) serve(do func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		do()
+	}()
+	for {
+		select {
+		case <-b.reqs:
+			data, err := b.next()
+			b.chunks <- streamedChunk{data: data, err: err}
+		case <-done:
+			close(b.stopped)
+			return
+		}
+	}
+}
+
+var _ io.ReadCloser = &streamedBody{}
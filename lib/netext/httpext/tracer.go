@@ -30,6 +30,7 @@ import (
 
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // A Trail represents detailed information about an HTTP request.
@@ -48,9 +49,17 @@ type Trail struct {
 	Connecting     time.Duration // Connecting to remote host.
 	TLSHandshaking time.Duration // Executing TLS handshake.
 	Sending        time.Duration // Writing request.
+	ExpectContinue time.Duration // Waiting for a 100 Continue response before sending the body.
 	Waiting        time.Duration // Waiting for first byte.
 	Receiving      time.Duration // Receiving response.
 
+	// Whether the request had an "Expect: 100-continue" header and waited for the server.
+	ExpectedContinue bool
+
+	// Whether the response wasn't an expected one, according to the response callback of the
+	// request. Invalid if there was no response callback.
+	Failed null.Bool
+
 	// Detailed connection information.
 	ConnReused     bool
 	ConnRemoteAddr net.Addr
@@ -75,6 +84,61 @@ func (tr *Trail) SaveSamples(tags *stats.SampleTags) {
 		{Metric: metrics.HTTPReqWaiting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Waiting)},
 		{Metric: metrics.HTTPReqReceiving, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Receiving)},
 	}
+	tr.addExpectContinueSample()
+	tr.addFailedSample()
+}
+
+// addExpectContinueSample adds the http_req_expect_continue sample, if the request waited for a
+// 100 Continue response.
+func (tr *Trail) addExpectContinueSample() {
+	if tr.ExpectedContinue {
+		tr.Samples = append(tr.Samples, stats.Sample{
+			Metric: metrics.HTTPReqExpectContinue, Time: tr.EndTime, Tags: tr.Tags, Value: stats.D(tr.ExpectContinue),
+		})
+	}
+}
+
+// addFailedSample adds the http_req_failed sample, if the request had a response callback.
+func (tr *Trail) addFailedSample() {
+	if !tr.Failed.Valid {
+		return
+	}
+	value := 0.0
+	if tr.Failed.Bool {
+		value = 1
+	}
+	tr.Samples = append(tr.Samples, stats.Sample{
+		Metric: metrics.HTTPReqFailed, Time: tr.EndTime, Tags: tr.Tags, Value: value,
+	})
+}
+
+// SaveLongPollSamples is like SaveSamples, but for long-polling requests: their duration, waiting
+// and receiving times go to the http_longpoll_* metrics instead of the http_req_* ones.
+func (tr *Trail) SaveLongPollSamples(tags *stats.SampleTags) {
+	tr.Tags = tags
+	tr.Samples = []stats.Sample{
+		{Metric: metrics.HTTPReqs, Time: tr.EndTime, Tags: tags, Value: 1},
+		{Metric: metrics.HTTPLongPollDuration, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Duration)},
+
+		{Metric: metrics.HTTPReqBlocked, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Blocked)},
+		{Metric: metrics.HTTPReqConnecting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Connecting)},
+		{Metric: metrics.HTTPReqTLSHandshaking, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.TLSHandshaking)},
+		{Metric: metrics.HTTPReqSending, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Sending)},
+		{Metric: metrics.HTTPLongPollWaiting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Waiting)},
+		{Metric: metrics.HTTPLongPollReceiving, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Receiving)},
+	}
+	tr.addExpectContinueSample()
+	tr.addFailedSample()
+}
+
+// setMetadata sets the metadata of all of the saved samples.
+func (tr *Trail) setMetadata(metadata map[string]string) {
+	if metadata == nil {
+		return
+	}
+	for i := range tr.Samples {
+		tr.Samples[i].Metadata = metadata
+	}
 }
 
 // GetSamples implements the stats.SampleContainer interface.
@@ -109,6 +173,8 @@ type Tracer struct {
 	gotConn              int64
 	wroteRequest         int64
 	gotFirstResponseByte int64
+	wait100Continue      int64
+	got100Continue       int64
 
 	connReused     bool
 	connRemoteAddr net.Addr
@@ -128,6 +194,8 @@ func (t *Tracer) Trace() *httptrace.ClientTrace {
 		GotConn:              t.GotConn,
 		WroteRequest:         t.WroteRequest,
 		GotFirstResponseByte: t.GotFirstResponseByte,
+		Wait100Continue:      t.Wait100Continue,
+		Got100Continue:       t.Got100Continue,
 	}
 }
 
@@ -279,6 +347,20 @@ func (t *Tracer) GotFirstResponseByte() {
 	atomic.CompareAndSwapInt64(&t.gotFirstResponseByte, 0, now())
 }
 
+// Wait100Continue is called when the request has an "Expect: 100-continue" header and its headers
+// were written, so the transport waits for a 100 Continue response before it sends the body.
+func (t *Tracer) Wait100Continue() {
+	atomic.CompareAndSwapInt64(&t.wait100Continue, 0, now())
+}
+
+// Got100Continue is called when the server replied with a 100 Continue response. As
+// GotFirstResponseByte() was called for it, that time is reset, so the waiting time isn't
+// measured from the interim response.
+func (t *Tracer) Got100Continue() {
+	atomic.CompareAndSwapInt64(&t.got100Continue, 0, now())
+	atomic.StoreInt64(&t.gotFirstResponseByte, 0)
+}
+
 // Done calculates all metrics and should be called when the request is finished.
 func (t *Tracer) Done() *Trail {
 	done := time.Now()
@@ -304,6 +386,8 @@ func (t *Tracer) Done() *Trail {
 	gotConn := atomic.LoadInt64(&t.gotConn)
 	wroteRequest := atomic.LoadInt64(&t.wroteRequest)
 	gotFirstResponseByte := atomic.LoadInt64(&t.gotFirstResponseByte)
+	wait100Continue := atomic.LoadInt64(&t.wait100Continue)
+	got100Continue := atomic.LoadInt64(&t.got100Continue)
 
 	if connectDone != 0 && connectStart != 0 {
 		trail.Connecting = time.Duration(connectDone - connectStart)
@@ -329,16 +413,38 @@ func (t *Tracer) Done() *Trail {
 			// For some requests, especially HTTP/2, the server starts responding before the
 			// client has finished sending the full request
 			trail.Waiting = time.Duration(gotFirstResponseByte - wroteRequest)
+		} else if gotFirstResponseByte == 0 && got100Continue != 0 && done.UnixNano() > wroteRequest {
+			// There's no hook for the first byte of the final response after a 100 Continue
+			trail.Waiting = done.Sub(time.Unix(0, wroteRequest))
 		}
 	}
 	if gotFirstResponseByte != 0 {
 		trail.Receiving = done.Sub(time.Unix(0, gotFirstResponseByte))
 	}
 
+	// The wait for a 100 Continue response lasts until it arrives, or until the final response
+	// if the server skips it, or until the body was sent after the transport gave up waiting.
+	if wait100Continue != 0 {
+		trail.ExpectedContinue = true
+		waitEnd := got100Continue
+		if waitEnd == 0 {
+			waitEnd = gotFirstResponseByte
+		}
+		if waitEnd == 0 || (wroteRequest != 0 && wroteRequest < waitEnd) {
+			waitEnd = wroteRequest
+		}
+		if waitEnd > wait100Continue {
+			trail.ExpectContinue = time.Duration(waitEnd - wait100Continue)
+			if trail.Sending > trail.ExpectContinue {
+				trail.Sending -= trail.ExpectContinue
+			}
+		}
+	}
+
 	// Calculate total times using adjusted values.
 	trail.EndTime = done
 	trail.ConnDuration = trail.Connecting + trail.TLSHandshaking
-	trail.Duration = trail.Sending + trail.Waiting + trail.Receiving
+	trail.Duration = trail.Sending + trail.ExpectContinue + trail.Waiting + trail.Receiving
 	trail.StartTime = trail.EndTime.Add(-trail.Duration)
 
 	t.protoErrorsMutex.Lock()
@@ -244,3 +244,61 @@ func TestCancelledRequest(t *testing.T) {
 		}
 	})
 }
+
+func TestTracerExpectContinue(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		// The server sends the 100 Continue response when the body is first read.
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer srv.Close()
+	transport := &http.Transport{ExpectContinueTimeout: 5 * time.Second}
+
+	roundTrip := func(path string) (*http.Response, *Trail) {
+		tracer := &Tracer{}
+		req, err := http.NewRequest("POST", srv.URL+path, strings.NewReader("body"))
+		require.NoError(t, err)
+		req.Header.Set("Expect", "100-continue")
+		res, err := transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(context.Background(), tracer.Trace())))
+		require.NoError(t, err)
+		assert.NoError(t, res.Body.Close())
+		return res, tracer.Done()
+	}
+
+	t.Run("Continue", func(t *testing.T) {
+		res, trail := roundTrip("/")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, trail.ExpectedContinue)
+		assert.True(t, trail.ExpectContinue >= 100*time.Millisecond, "%s", trail.ExpectContinue)
+		assert.True(t, trail.Sending < 100*time.Millisecond, "%s", trail.Sending)
+		assert.Equal(t, trail.Sending+trail.ExpectContinue+trail.Waiting+trail.Receiving, trail.Duration)
+
+		trail.SaveSamples(nil)
+		last := trail.Samples[len(trail.Samples)-1]
+		assert.Equal(t, metrics.HTTPReqExpectContinue, last.Metric)
+		assert.Equal(t, stats.D(trail.ExpectContinue), last.Value)
+	})
+	t.Run("Rejected", func(t *testing.T) {
+		res, trail := roundTrip("/reject")
+		assert.Equal(t, http.StatusExpectationFailed, res.StatusCode)
+		assert.True(t, trail.ExpectedContinue)
+		assert.True(t, trail.ExpectContinue < time.Second, "%s", trail.ExpectContinue)
+	})
+	t.Run("None", func(t *testing.T) {
+		tracer := &Tracer{}
+		req, err := http.NewRequest("POST", srv.URL, strings.NewReader("body"))
+		require.NoError(t, err)
+		res, err := transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(context.Background(), tracer.Trace())))
+		require.NoError(t, err)
+		assert.NoError(t, res.Body.Close())
+		trail := tracer.Done()
+		assert.False(t, trail.ExpectedContinue)
+		trail.SaveSamples(nil)
+		assert.Len(t, trail.Samples, 8)
+	})
+}
@@ -21,6 +21,7 @@
 package httpext
 
 import (
+	"math/rand"
 	"net"
 	"net/http"
 	"net/http/httptrace"
@@ -28,8 +29,10 @@ import (
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/pkg/errors"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // transport is an implemenation of http.RoundTripper that will measure different metrics for each
@@ -39,11 +42,23 @@ type transport struct {
 	// TODO: maybe just take the SystemTags field as it is the only thing used
 	options   *lib.Options
 	tags      map[string]string
+	multiTags map[string][]string
 	trail     *Trail
 	errorMsg  string
 	errorCode errCode
 	tlsInfo   netext.TLSInfo
 	samplesCh chan<- stats.SampleContainer
+	longPoll  bool
+	metadata  map[string]string
+	chaosRand func() float64
+
+	responseCallback lib.ResponseCallback
+}
+
+// DefaultResponseCallback is the response callback of the VUs until the script sets another one
+// with http.setResponseCallback(): only responses with a 2xx or 3xx status are expected ones.
+func DefaultResponseCallback(status int) bool {
+	return status >= 200 && status < 400
 }
 
 var _ http.RoundTripper = &transport{}
@@ -55,10 +70,12 @@ func newTransport(
 	samplesCh chan<- stats.SampleContainer,
 	options *lib.Options,
 	tags map[string]string,
+	multiTags map[string][]string,
 ) *transport {
 	return &transport{
 		roundTripper: roundTripper,
 		tags:         tags,
+		multiTags:    multiTags,
 		options:      options,
 		samplesCh:    samplesCh,
 	}
@@ -95,8 +112,31 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 	tracer := Tracer{}
 	reqWithTracer := req.WithContext(httptrace.WithClientTrace(ctx, tracer.Trace()))
 
-	resp, err := t.roundTripper.RoundTrip(reqWithTracer)
+	var fault string
+	if t.options.Chaos.Valid {
+		random := rand.Float64
+		if t.chaosRand != nil {
+			random = t.chaosRand
+		}
+		fault = t.options.Chaos.Pick(random())
+	}
+	var resp *http.Response
+	if fault == types.ChaosFail {
+		err = InjectedFaultError{}
+	} else {
+		resp, err = t.roundTripper.RoundTrip(reqWithTracer)
+	}
+	if fault == types.ChaosDelay && err == nil {
+		// The delay is part of the receiving time, as if the response was slow to arrive.
+		injectDelay(ctx, t.options.Chaos.GetDelay())
+	}
 	trail := tracer.Done()
+	if fault != "" {
+		tags["injected"] = fault
+	}
+	if fault == types.ChaosTruncate && resp != nil {
+		resp.Body = truncateBody(resp.Body, resp.ContentLength)
+	}
 	if err != nil {
 		t.errorCode, t.errorMsg = errorCodeForError(err)
 		if t.options.SystemTags["error"] {
@@ -139,6 +179,16 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 			t.tlsInfo = tlsInfo
 		}
 	}
+	if t.responseCallback != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		trail.Failed = null.BoolFrom(!t.responseCallback(status))
+		if t.options.SystemTags["expected_response"] {
+			tags["expected_response"] = strconv.FormatBool(!trail.Failed.Bool)
+		}
+	}
 	if t.options.SystemTags["ip"] && trail.ConnRemoteAddr != nil {
 		var ip string
 		if ip, _, err = net.SplitHostPort(trail.ConnRemoteAddr.String()); err == nil {
@@ -147,8 +197,26 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 	}
 
 	t.trail = trail
-	trail.SaveSamples(stats.IntoSampleTags(&tags))
-	stats.PushIfNotCancelled(ctx, t.samplesCh, trail)
+	if t.longPoll {
+		// The trail isn't pushed itself, so outputs that aggregate trails into the http_req_*
+		// metrics (i.e. the cloud one) don't pick it up.
+		trail.SaveLongPollSamples(stats.IntoSampleTags(&tags).WithMultiTags(t.multiTags))
+		trail.setMetadata(t.metadata)
+		stats.PushIfNotCancelled(ctx, t.samplesCh, stats.ConnectedSamples{
+			Samples: trail.Samples,
+			Tags:    trail.Tags,
+			Time:    trail.EndTime,
+		})
+	} else {
+		trail.SaveSamples(stats.IntoSampleTags(&tags).WithMultiTags(t.multiTags))
+		trail.setMetadata(t.metadata)
+		stats.PushIfNotCancelled(ctx, t.samplesCh, trail)
+	}
+	if resp != nil {
+		if samples := serverTimingSamples(ParseServerTiming(resp.Header), trail.EndTime, trail.Tags); samples != nil {
+			stats.PushIfNotCancelled(ctx, t.samplesCh, samples)
+		}
+	}
 
 	return resp, err
 }
@@ -0,0 +1,219 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// Resolver is the interface the dialers use to resolve hostnames to a single IP.
+type Resolver interface {
+	LookupIP(host string) (net.IP, error)
+}
+
+type cacheRecord struct {
+	ips        []net.IP
+	lastLookup time.Time
+}
+
+// resolver caches the lookups for the configured TTL and picks one of the IPs according to
+// the configured policy and selection strategy. It's safe for concurrent use, and it's shared
+// between all of the VUs, so the round-robin selection spreads their connections over all IPs.
+type resolver struct {
+	lookup func(host string) ([]net.IP, []DNSQuery, error)
+	ttl    time.Duration
+	sel    string
+	policy string
+
+	mu    sync.Mutex
+	cache map[string]cacheRecord
+	next  map[string]int
+	rand  *rand.Rand
+}
+
+// NewResolver returns a resolver with the given DNS config, where the unset fields are filled
+// from types.DefaultDNSConfig(). The config should have already been validated.
+func NewResolver(cfg types.DNSConfig) Resolver {
+	if u, err := cfg.ParseServer(); err == nil && u != nil {
+		return newResolver(newDNSServer(u).lookup, cfg)
+	}
+	return newResolver(systemLookup, cfg)
+}
+
+func systemLookup(host string) ([]net.IP, []DNSQuery, error) {
+	ips, err := net.LookupIP(host)
+	return ips, nil, err
+}
+
+func newResolver(lookup func(host string) ([]net.IP, []DNSQuery, error), cfg types.DNSConfig) *resolver {
+	cfg = types.DefaultDNSConfig().Apply(cfg)
+	ttl, err := cfg.ParseTTL()
+	if err != nil {
+		ttl, _ = types.DefaultDNSConfig().ParseTTL()
+	}
+	return &resolver{
+		lookup: lookup,
+		ttl:    ttl,
+		sel:    cfg.Select.String,
+		policy: cfg.Policy.String,
+		cache:  make(map[string]cacheRecord),
+		next:   make(map[string]int),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+}
+
+// LookupIP returns a single IP for the host.
+func (r *resolver) LookupIP(host string) (net.IP, error) {
+	ip, _, err := r.lookupIPQueries(host)
+	return ip, err
+}
+
+// lookupIPQueries is like LookupIP, but also returns the queries to the DNS server that it took,
+// if there is one. They're only made when the IPs of the host aren't cached.
+func (r *resolver) lookupIPQueries(host string) (net.IP, []DNSQuery, error) {
+	ips, queries, err := r.fetch(host)
+	if err != nil {
+		return nil, queries, err
+	}
+	ips = filterIPs(ips, r.policy)
+	if len(ips) == 0 {
+		return nil, queries, fmt.Errorf("no IPs for the host '%s' match the '%s' DNS policy", host, r.policy)
+	}
+	return r.selectIP(host, ips), queries, nil
+}
+
+// lookupIPsQueries is like lookupIPQueries, but returns all of the IPs of the host that match the
+// policy, in the order in which the connections to them should be attempted when they're raced.
+// The selected IP is the first one, and the rest alternate between the IP versions, starting with
+// the other one, like RFC 8305 recommends.
+func (r *resolver) lookupIPsQueries(host string) ([]net.IP, []DNSQuery, error) {
+	ips, queries, err := r.fetch(host)
+	if err != nil {
+		return nil, queries, err
+	}
+	ips = filterIPs(ips, r.policy)
+	if len(ips) == 0 {
+		return nil, queries, fmt.Errorf("no IPs for the host '%s' match the '%s' DNS policy", host, r.policy)
+	}
+	first := r.selectIP(host, ips)
+	var same, other []net.IP
+	for _, ip := range ips {
+		switch {
+		case ip.Equal(first):
+		case (ip.To4() != nil) == (first.To4() != nil):
+			same = append(same, ip)
+		default:
+			other = append(other, ip)
+		}
+	}
+	sorted := make([]net.IP, 1, len(ips))
+	sorted[0] = first
+	for len(same) > 0 || len(other) > 0 {
+		if len(other) > 0 {
+			sorted = append(sorted, other[0])
+			other = other[1:]
+		}
+		if len(same) > 0 {
+			sorted = append(sorted, same[0])
+			same = same[1:]
+		}
+	}
+	return sorted, queries, nil
+}
+
+func (r *resolver) fetch(host string) ([]net.IP, []DNSQuery, error) {
+	if r.ttl != 0 {
+		r.mu.Lock()
+		record, ok := r.cache[host]
+		r.mu.Unlock()
+		if ok && (r.ttl < 0 || time.Since(record.lastLookup) < r.ttl) {
+			return record.ips, nil, nil
+		}
+	}
+
+	ips, queries, err := r.lookup(host)
+	if err != nil {
+		return nil, queries, err
+	}
+	if r.ttl != 0 {
+		r.mu.Lock()
+		r.cache[host] = cacheRecord{ips: ips, lastLookup: time.Now()}
+		r.mu.Unlock()
+	}
+	return ips, queries, nil
+}
+
+func (r *resolver) selectIP(host string, ips []net.IP) net.IP {
+	if len(ips) == 1 {
+		return ips[0]
+	}
+	switch r.sel {
+	case types.DNSRandom:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return ips[r.rand.Intn(len(ips))]
+	case types.DNSRoundRobin:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		i := r.next[host] % len(ips)
+		r.next[host] = i + 1
+		return ips[i]
+	default:
+		return ips[0]
+	}
+}
+
+// filterIPs returns the IPs that match the policy; the preferences return all IPs when none of
+// them are of the preferred version.
+func filterIPs(ips []net.IP, policy string) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch policy {
+	case types.DNSPreferIPv4:
+		if len(v4) > 0 {
+			return v4
+		}
+		return v6
+	case types.DNSPreferIPv6:
+		if len(v6) > 0 {
+			return v6
+		}
+		return v4
+	case types.DNSOnlyIPv4:
+		return v4
+	case types.DNSOnlyIPv6:
+		return v6
+	default:
+		return ips
+	}
+}
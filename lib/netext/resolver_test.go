@@ -0,0 +1,153 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+type mockLookup struct {
+	ips     map[string][]net.IP
+	lookups int
+}
+
+func (m *mockLookup) lookup(host string) ([]net.IP, []DNSQuery, error) {
+	m.lookups++
+	ips, ok := m.ips[host]
+	if !ok {
+		return nil, nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return ips, nil, nil
+}
+
+func TestResolver(t *testing.T) {
+	v4a, v4b, v6 := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1")
+	newMock := func() *mockLookup {
+		return &mockLookup{ips: map[string][]net.IP{
+			"both.example.com": {v6, v4a, v4b},
+			"v6.example.com":   {v6},
+		}}
+	}
+
+	t.Run("Policy", func(t *testing.T) {
+		testdata := map[string]struct {
+			host     string
+			expected []net.IP
+		}{
+			types.DNSPreferIPv4: {"both.example.com", []net.IP{v4a}},
+			types.DNSPreferIPv6: {"both.example.com", []net.IP{v6}},
+			types.DNSOnlyIPv6:   {"v6.example.com", []net.IP{v6}},
+			types.DNSAny:        {"both.example.com", []net.IP{v6}},
+		}
+		for policy, data := range testdata {
+			r := newResolver(newMock().lookup, types.DNSConfig{
+				Select: null.StringFrom(types.DNSFirst),
+				Policy: null.StringFrom(policy),
+			})
+			ip, err := r.LookupIP(data.host)
+			require.NoError(t, err, policy)
+			assert.Equal(t, data.expected[0], ip, policy)
+		}
+
+		r := newResolver(newMock().lookup, types.DNSConfig{Policy: null.StringFrom(types.DNSOnlyIPv4)})
+		_, err := r.LookupIP("v6.example.com")
+		assert.EqualError(t, err, "no IPs for the host 'v6.example.com' match the 'onlyIPv4' DNS policy")
+		_, err = r.LookupIP("missing.example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("Select", func(t *testing.T) {
+		r := newResolver(newMock().lookup, types.DNSConfig{Select: null.StringFrom(types.DNSRoundRobin)})
+		var ips []net.IP
+		for i := 0; i < 4; i++ {
+			ip, err := r.LookupIP("both.example.com")
+			require.NoError(t, err)
+			ips = append(ips, ip)
+		}
+		assert.Equal(t, []net.IP{v4a, v4b, v4a, v4b}, ips)
+
+		r = newResolver(newMock().lookup, types.DNSConfig{})
+		seen := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			ip, err := r.LookupIP("both.example.com")
+			require.NoError(t, err)
+			seen[ip.String()] = true
+		}
+		assert.Equal(t, map[string]bool{v4a.String(): true, v4b.String(): true}, seen)
+	})
+
+	t.Run("Racing", func(t *testing.T) {
+		v6b := net.ParseIP("2001:db8::2")
+		mock := &mockLookup{ips: map[string][]net.IP{"both.example.com": {v6, v6b, v4a, v4b}}}
+		testdata := map[string][]net.IP{
+			types.DNSAny:        {v6, v4a, v6b, v4b},
+			types.DNSPreferIPv4: {v4a, v4b},
+			types.DNSOnlyIPv6:   {v6, v6b},
+		}
+		for policy, expected := range testdata {
+			r := newResolver(mock.lookup, types.DNSConfig{
+				Select: null.StringFrom(types.DNSFirst),
+				Policy: null.StringFrom(policy),
+			})
+			ips, _, err := r.lookupIPsQueries("both.example.com")
+			require.NoError(t, err, policy)
+			assert.Equal(t, expected, ips, policy)
+		}
+
+		r := newResolver(mock.lookup, types.DNSConfig{
+			Select: null.StringFrom(types.DNSRoundRobin),
+			Policy: null.StringFrom(types.DNSAny),
+		})
+		_, _, err := r.lookupIPsQueries("both.example.com")
+		require.NoError(t, err)
+		ips, _, err := r.lookupIPsQueries("both.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, []net.IP{v6b, v4a, v6, v4b}, ips)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		for ttl, expectedLookups := range map[string]int{"inf": 1, "0": 3, "1h": 1} {
+			mock := newMock()
+			r := newResolver(mock.lookup, types.DNSConfig{TTL: null.StringFrom(ttl)})
+			for i := 0; i < 3; i++ {
+				_, err := r.LookupIP("both.example.com")
+				require.NoError(t, err)
+			}
+			assert.Equal(t, expectedLookups, mock.lookups, ttl)
+		}
+
+		mock := newMock()
+		r := newResolver(mock.lookup, types.DNSConfig{TTL: null.StringFrom("1ms")})
+		_, err := r.LookupIP("both.example.com")
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = r.LookupIP("both.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, 2, mock.lookups)
+	})
+}
@@ -0,0 +1,122 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TLSOverride changes the TLS config for the hosts that match any of its patterns, see
+// MatchHostname.
+type TLSOverride struct {
+	Patterns []string
+	Apply    func(*tls.Config)
+}
+
+// TLSConfigs picks the TLS config for each hostname: the default one, with all of the matching
+// overrides applied on top of a clone of it, in order. The configs are cached per hostname, so
+// the same *tls.Config is returned for the same hostname.
+type TLSConfigs struct {
+	Default   *tls.Config
+	Overrides []TLSOverride
+
+	mutex sync.Mutex
+	cache map[string]*tls.Config
+}
+
+// For returns the TLS config for the given hostname.
+func (c *TLSConfigs) For(hostname string) *tls.Config {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if config, ok := c.cache[hostname]; ok {
+		return config
+	}
+
+	config := c.Default
+	for _, override := range c.Overrides {
+		for _, pattern := range override.Patterns {
+			if MatchHostname(pattern, hostname) {
+				if config == c.Default {
+					config = c.Default.Clone()
+				}
+				override.Apply(config)
+				break
+			}
+		}
+	}
+	if c.cache == nil {
+		c.cache = make(map[string]*tls.Config)
+	}
+	c.cache[hostname] = config
+	return config
+}
+
+// HostsTransport is a http.RoundTripper that sends the requests to the hosts with an overridden
+// TLS config through separate transports, since a single http.Transport can only have one.
+type HostsTransport struct {
+	Default    *http.Transport
+	TLSConfigs *TLSConfigs
+
+	// NewTransport makes a transport like the default one, but with the given TLS config.
+	NewTransport func(*tls.Config) *http.Transport
+
+	mutex      sync.Mutex
+	transports map[*tls.Config]*http.Transport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HostsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transportFor(req.URL.Hostname()).RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of all of the underlying transports.
+func (t *HostsTransport) CloseIdleConnections() {
+	t.Default.CloseIdleConnections()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+func (t *HostsTransport) transportFor(hostname string) *http.Transport {
+	config := t.TLSConfigs.For(hostname)
+	if config == t.TLSConfigs.Default {
+		return t.Default
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if transport, ok := t.transports[config]; ok {
+		return transport
+	}
+	if t.transports == nil {
+		t.transports = make(map[*tls.Config]*http.Transport)
+	}
+	transport := t.NewTransport(config)
+	t.transports[config] = transport
+	return transport
+}
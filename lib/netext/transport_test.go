@@ -0,0 +1,97 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfigs(t *testing.T) {
+	configs := &TLSConfigs{
+		Default: &tls.Config{MinVersion: tls.VersionTLS12},
+		Overrides: []TLSOverride{
+			{
+				Patterns: []string{"legacy.example.com", "*.old.example.com"},
+				Apply:    func(c *tls.Config) { c.MinVersion = tls.VersionTLS10 },
+			},
+			{
+				Patterns: []string{"*.example.com"},
+				Apply:    func(c *tls.Config) { c.ServerName = "override" },
+			},
+		},
+	}
+
+	assert.True(t, configs.Default == configs.For("example.com"))
+	assert.True(t, configs.Default == configs.For("legacy.example.com.evil"))
+
+	legacy := configs.For("legacy.example.com")
+	assert.Equal(t, uint16(tls.VersionTLS10), legacy.MinVersion)
+	assert.Equal(t, "override", legacy.ServerName)
+	assert.True(t, legacy == configs.For("LEGACY.example.com."), "configs should be cached")
+
+	other := configs.For("new.example.com")
+	assert.Equal(t, uint16(tls.VersionTLS12), other.MinVersion)
+	assert.Equal(t, "override", other.ServerName)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), configs.Default.MinVersion)
+	assert.Equal(t, "", configs.Default.ServerName)
+}
+
+func TestHostsTransport(t *testing.T) {
+	def := &http.Transport{}
+	transport := &HostsTransport{
+		Default: def,
+		TLSConfigs: &TLSConfigs{
+			Default: &tls.Config{},
+			Overrides: []TLSOverride{
+				{Patterns: []string{"*.example.com"}, Apply: func(c *tls.Config) {}},
+			},
+		},
+		NewTransport: func(c *tls.Config) *http.Transport {
+			return &http.Transport{TLSClientConfig: c}
+		},
+	}
+
+	transportFor := func(rawurl string) *http.Transport {
+		u, err := url.Parse(rawurl)
+		require.NoError(t, err)
+		return transport.transportFor(u.Hostname())
+	}
+
+	assert.True(t, def == transportFor("https://example.com/"))
+	assert.True(t, def == transportFor("http://127.0.0.1:8080/"))
+
+	a := transportFor("https://a.example.com/")
+	assert.False(t, def == a)
+	assert.True(t, a == transportFor("https://a.example.com:443/path"))
+	assert.True(t, transport.TLSConfigs.For("a.example.com") == a.TLSClientConfig)
+
+	b := transportFor("https://b.example.com/")
+	assert.False(t, a == b)
+
+	transport.CloseIdleConnections()
+}
@@ -23,9 +23,14 @@ package lib
 import (
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net"
+	"net/url"
+	"path"
 	"reflect"
 	"strings"
 
@@ -42,12 +47,15 @@ import (
 const DefaultSchedulerName = "default"
 
 // DefaultSystemTagList includes all of the system tags emitted with metrics by default.
-// Other tags that are not enabled by default include: iter, vu, ocsp_status, ip
 var DefaultSystemTagList = []string{
-
-	"proto", "subproto", "status", "method", "url", "name", "group", "check", "error", "error_code", "tls_version",
+	"proto", "subproto", "status", "method", "url", "name", "group", "check", "error", "error_code",
+	"tls_version", "expected_response", "scenario", "stage", "region", "zone", "job",
 }
 
+// OptionalSystemTagList includes the system tags that aren't emitted by default, but can be
+// enabled with the systemTags option.
+var OptionalSystemTagList = []string{"iter", "vu", "ocsp_status", "ip", "compression"}
+
 // TagSet is a string to bool map (for lookup efficiency) that is used to keep track
 // which system tags should be included with with metrics.
 type TagSet map[string]bool
@@ -61,6 +69,37 @@ func GetTagSet(tags ...string) TagSet {
 	return result
 }
 
+// ParseTagSet converts the passed tag names into a tag set. Names prefixed with
+// "+" or "-" add or remove tags; if all of the names have such a prefix, they
+// modify the default system tags instead of an empty set, so that "-url,+ip"
+// means "the default tags, without url and with ip".
+func ParseTagSet(tags ...string) TagSet {
+	result := TagSet{}
+	relative := len(tags) > 0
+	for _, tag := range tags {
+		if tag == "" || (tag[0] != '+' && tag[0] != '-') {
+			relative = false
+			break
+		}
+	}
+	if relative {
+		result = GetTagSet(DefaultSystemTagList...)
+	}
+	for _, tag := range tags {
+		switch {
+		case tag == "":
+			continue
+		case tag[0] == '-':
+			delete(result, tag[1:])
+		case tag[0] == '+':
+			result[tag[1:]] = true
+		default:
+			result[tag] = true
+		}
+	}
+	return result
+}
+
 // MarshalJSON converts the tags map to a list (JS array).
 func (t TagSet) MarshalJSON() ([]byte, error) {
 	var tags []string
@@ -77,7 +116,7 @@ func (t *TagSet) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	if len(tags) != 0 {
-		*t = GetTagSet(tags...)
+		*t = ParseTagSet(tags...)
 	}
 	return nil
 }
@@ -85,14 +124,15 @@ func (t *TagSet) UnmarshalJSON(data []byte) error {
 // UnmarshalText converts the tag list to tagset.
 func (t *TagSet) UnmarshalText(data []byte) error {
 	var list = bytes.Split(data, []byte(","))
-	*t = make(map[string]bool, len(list))
+	var tags = make([]string, 0, len(list))
 	for _, key := range list {
 		key := strings.TrimSpace(string(key))
 		if key == "" {
 			continue
 		}
-		(*t)[key] = true
+		tags = append(tags, key)
 	}
+	*t = ParseTagSet(tags...)
 	return nil
 }
 
@@ -170,7 +210,8 @@ func (s *TLSCipherSuites) UnmarshalJSON(data []byte) error {
 
 // Fields for TLSAuth. Unmarshalling hack.
 type TLSAuthFields struct {
-	// Certificate and key as a PEM-encoded string, including "-----BEGIN CERTIFICATE-----".
+	// Certificate and key as a PEM-encoded string, including "-----BEGIN CERTIFICATE-----", or
+	// as paths to PEM files, which are read when the options are loaded.
 	Cert string `json:"cert"`
 	Key  string `json:"key"`
 
@@ -188,6 +229,16 @@ func (c *TLSAuth) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &c.TLSAuthFields); err != nil {
 		return err
 	}
+	for _, pem := range []*string{&c.Cert, &c.Key} {
+		if *pem == "" || strings.Contains(*pem, "-----BEGIN") {
+			continue
+		}
+		data, err := ioutil.ReadFile(*pem)
+		if err != nil {
+			return errors.Wrap(err, "couldn't read the tlsAuth cert or key file")
+		}
+		*pem = string(data)
+	}
 	if _, err := c.Certificate(); err != nil {
 		return err
 	}
@@ -205,6 +256,105 @@ func (c *TLSAuth) Certificate() (*tls.Certificate, error) {
 	return c.certificate, nil
 }
 
+// Fields for TLSCACerts. Unmarshalling hack.
+type TLSCACertsFields struct {
+	// CA certificates as PEM-encoded strings, or as paths to PEM files, which are read when the
+	// options are loaded.
+	Certs []string `json:"certs"`
+
+	// Whether the system's root CAs are trusted as well, true by default.
+	System null.Bool `json:"system"`
+}
+
+// The CA certificates to trust for TLS connections. Unmarshals from either a list of certificates,
+// which are trusted in addition to the system ones, or an object with the certs and system fields.
+type TLSCACerts struct {
+	TLSCACertsFields
+	pool *x509.CertPool
+}
+
+// NewTLSCACerts reads the certs that are paths to PEM files, and checks that they're all valid.
+func NewTLSCACerts(certs []string, system bool) (*TLSCACerts, error) {
+	c := &TLSCACerts{TLSCACertsFields: TLSCACertsFields{Certs: certs, System: null.BoolFrom(system)}}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *TLSCACerts) UnmarshalJSON(data []byte) error {
+	var fields TLSCACertsFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		if err2 := json.Unmarshal(data, &fields.Certs); err2 != nil {
+			return err
+		}
+	}
+	c.TLSCACertsFields = fields
+	c.pool = nil
+	return c.load()
+}
+
+func (c *TLSCACerts) load() error {
+	for i, cert := range c.Certs {
+		if strings.Contains(cert, "-----BEGIN") {
+			continue
+		}
+		data, err := ioutil.ReadFile(cert)
+		if err != nil {
+			return errors.Wrap(err, "couldn't read the tlsCACerts file")
+		}
+		c.Certs[i] = string(data)
+	}
+	_, err := c.CertPool()
+	return err
+}
+
+// CertPool returns the pool with the CA certificates, and the system ones unless disabled.
+func (c *TLSCACerts) CertPool() (*x509.CertPool, error) {
+	if c.pool != nil {
+		return c.pool, nil
+	}
+	pool := x509.NewCertPool()
+	if c.System.Bool || !c.System.Valid {
+		if systemPool, err := x509.SystemCertPool(); err == nil {
+			pool = systemPool
+		}
+	}
+	for _, cert := range c.Certs {
+		if !pool.AppendCertsFromPEM([]byte(cert)) {
+			return nil, errors.New("tlsCACerts contains invalid PEM-encoded certificates")
+		}
+	}
+	c.pool = pool
+	return pool, nil
+}
+
+// Overrides the TLS versions and/or cipher suites for certain hosts.
+type TLSHost struct {
+	// Hosts to apply the overrides to. May contain wildcards, eg. "*.example.com".
+	Domains []string `json:"domains"`
+
+	// If nil, the global tlsVersion and tlsCipherSuites options are used.
+	TLSVersion      *TLSVersions     `json:"tlsVersion"`
+	TLSCipherSuites *TLSCipherSuites `json:"tlsCipherSuites"`
+}
+
+// A ConnectionPool is a separate set of connections for the requests that select it with the
+// pool param, with its own TLS, proxy and keep-alive settings. The unset fields fall back to the
+// global options.
+type ConnectionPool struct {
+	InsecureSkipTLSVerify null.Bool    `json:"insecureSkipTLSVerify"`
+	TLSVersion            *TLSVersions `json:"tlsVersion"`
+
+	// The URL of the proxy the requests go through, or an empty string for connecting directly.
+	// If unset, the proxy is picked from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars.
+	Proxy null.String `json:"proxy"`
+
+	// Don't keep the connections alive between the requests, and how long the idle ones are kept.
+	NoConnectionReuse null.Bool          `json:"noConnectionReuse"`
+	IdleTimeout       types.NullDuration `json:"idleTimeout"`
+}
+
 type Options struct {
 	// Should the test start in a paused state?
 	Paused null.Bool `json:"paused" envconfig:"paused"`
@@ -221,11 +371,37 @@ type Options struct {
 
 	Execution scheduler.ConfigMap `json:"execution,omitempty" envconfig:"-"`
 
+	// Exported functions that are run in the background on an interval, keyed by the job name.
+	Jobs map[string]JobConfig `json:"jobs" ignored:"true"`
+
 	// Timeouts for the setup() and teardown() functions
 	SetupTimeout    types.NullDuration `json:"setupTimeout" envconfig:"setup_timeout"`
 	TeardownTimeout types.NullDuration `json:"teardownTimeout" envconfig:"teardown_timeout"`
 
-	// Limit HTTP requests per second.
+	// A safety cap on the wall-clock duration of the whole k6 run, regardless of stages and
+	// iterations. The test is stopped gracefully before it's reached, and k6 is terminated
+	// if it's still running once it's reached.
+	MaxDuration types.NullDuration `json:"maxDuration" envconfig:"max_duration"`
+
+	// Re-initialize VUs, i.e. re-run the init context, after this many iterations and/or
+	// after a failed iteration, discarding any accumulated JS state.
+	VURecycleIterations null.Int  `json:"vuRecycleIterations" envconfig:"vu_recycle_iterations"`
+	VURecycleOnError    null.Bool `json:"vuRecycleOnError" envconfig:"vu_recycle_on_error"`
+
+	// Re-initialize all VUs when the heap of the whole k6 process exceeds this many bytes, so long
+	// soak tests survive slow memory leaks in scripts. The heap of a single VU can't be measured.
+	VURecycleHeapLimit null.Int `json:"vuRecycleHeapLimit" envconfig:"vu_recycle_heap_limit"`
+
+	// The registered executor that schedules the VUs, see RegisterExecutor().
+	Executor null.String `json:"executor" envconfig:"executor"`
+
+	// The trace file with the iteration start offsets replayed by the "trace" executor.
+	TraceFile null.String `json:"traceFile" envconfig:"trace_file"`
+
+	// Seed for Math.random() in all VUs, for reproducible runs.
+	Seed null.Int `json:"seed" envconfig:"seed"`
+
+	// Limit HTTP requests per second, for all VUs together. Schedulers can have their own limit.
 	RPS null.Int `json:"rps" envconfig:"rps"`
 
 	// How many HTTP redirects do we follow?
@@ -241,13 +417,36 @@ type Options struct {
 	// Should all HTTP requests and responses be logged (excluding body)?
 	HttpDebug null.String `json:"httpDebug" envconfig:"http_debug"`
 
+	// Header and cookie name patterns (case-insensitive, with * wildcards), whose values
+	// should be redacted from the HTTP debug output, e.g. to keep auth tokens out of CI logs.
+	RedactHeaders []string `json:"redactHeaders" envconfig:"redact_headers"`
+	RedactCookies []string `json:"redactCookies" envconfig:"redact_cookies"`
+
 	// Accept invalid or untrusted TLS certificates.
 	InsecureSkipTLSVerify null.Bool `json:"insecureSkipTLSVerify" envconfig:"insecure_skip_tls_verify"`
 
 	// Specify TLS versions and cipher suites, and present client certificates.
-	TLSCipherSuites *TLSCipherSuites `json:"tlsCipherSuites" envconfig:"tls_cipher_suites"`
-	TLSVersion      *TLSVersions     `json:"tlsVersion" envconfig:"tls_version"`
-	TLSAuth         []*TLSAuth       `json:"tlsAuth" envconfig:"tlsauth"`
+	// These (and the other options that are ignored by envconfig, except for ext) are read from
+	// the K6_TLS_CIPHER_SUITES, K6_TLS_VERSION, K6_TLSAUTH etc. environment variables by the
+	// cmd package, since envconfig can't decode them.
+	TLSCipherSuites *TLSCipherSuites `json:"tlsCipherSuites" ignored:"true"`
+	TLSVersion      *TLSVersions     `json:"tlsVersion" ignored:"true"`
+	TLSAuth         []*TLSAuth       `json:"tlsAuth" ignored:"true"`
+
+	// Trust these CA certificates, in addition to or instead of the system ones, read from
+	// K6_TLS_CA_CERTS.
+	TLSCACerts *TLSCACerts `json:"tlsCACerts" ignored:"true"`
+
+	// Override the TLS versions and cipher suites for certain hosts, read from K6_TLS_HOSTS.
+	TLSHosts []*TLSHost `json:"tlsHosts" ignored:"true"`
+
+	// Checks that the system under test is ready before the test is started, see HealthCheckConfig.
+	HealthCheck HealthCheckConfig `json:"healthCheck" ignored:"true"`
+
+	// Named connection pools, which the requests can select with the pool param, e.g. for
+	// comparing the requests through a CDN to the ones that go directly to the origin. Read from
+	// K6_CONNECTION_POOLS.
+	ConnectionPools map[string]*ConnectionPool `json:"connectionPools" ignored:"true"`
 
 	// Throw warnings (eg. failed HTTP requests) as errors instead of simply logging them.
 	Throw null.Bool `json:"throw" envconfig:"throw"`
@@ -255,13 +454,64 @@ type Options struct {
 	// Define thresholds; these take the form of 'metric=["snippet1", "snippet2"]'.
 	// To create a threshold on a derived metric based on tag queries ("submetrics"), create a
 	// metric on a nonexistent metric named 'real_metric{tagA:valueA,tagB:valueB}'.
-	Thresholds map[string]stats.Thresholds `json:"thresholds" envconfig:"thresholds"`
+	Thresholds map[string]stats.Thresholds `json:"thresholds" ignored:"true"`
+
+	// How often thresholds are evaluated, unless they specify their own interval.
+	ThresholdsInterval types.NullDuration `json:"thresholdsInterval" envconfig:"thresholds_interval"`
+
+	// Searches for the maximum requests per second at which a threshold still holds, if set.
+	AdaptiveLoad *AdaptiveLoadConfig `json:"adaptiveLoad" ignored:"true"`
+
+	// Warns about, or aborts the test on, a steady degradation of the latency or the error rate.
+	AnomalyDetection *AnomalyDetectionConfig `json:"anomalyDetection" ignored:"true"`
+
+	// How often the engine hands the collected metric samples to the outputs. Outputs can have
+	// their own period in CollectorPeriods, keyed by the output type (e.g. "json" or "influxdb").
+	CollectorPeriod  types.NullDuration            `json:"collectorPeriod" envconfig:"collector_period"`
+	CollectorPeriods map[string]types.NullDuration `json:"collectorPeriods" envconfig:"collector_periods"`
+
+	// If set, the outputs only get aggregated samples: the samples of every series, i.e. of the
+	// same metric with the same tags, are summarized for every aggregation period, e.g. 1s, and
+	// tagged with the kind of aggregated value, see stats.Aggregator. Like the collector period, it
+	// can be set for all outputs or only for some types of outputs in AggregationPeriods.
+	AggregationPeriod  types.NullDuration            `json:"aggregationPeriod" envconfig:"aggregation_period"`
+	AggregationPeriods map[string]types.NullDuration `json:"aggregationPeriods" envconfig:"aggregation_periods"`
+
+	// Rules that rename or drop the tags, or map their values, of the samples that the outputs of
+	// a type get, keyed by the output type, e.g. so that InfluxDB and StatsD each get the names
+	// their dashboards expect. The summary and the thresholds still see the original tags.
+	Relabel map[string][]stats.RelabelRule `json:"relabel" ignored:"true"`
+
+	// How long the outputs get to commit their remaining samples to their backends once the test
+	// is over, before k6 exits anyway and reports how many samples were dropped.
+	FinalFlushTimeout types.NullDuration `json:"finalFlushTimeout" envconfig:"final_flush_timeout"`
 
 	// Blacklist IP ranges that tests may not contact. Mainly useful in hosted setups.
-	BlacklistIPs []*net.IPNet `json:"blacklistIPs" envconfig:"blacklist_ips"`
+	BlacklistIPs []*net.IPNet `json:"blacklistIPs" ignored:"true"`
+
+	// Hostnames that tests may not contact, either exact ones or wildcards like "*.example.com".
+	BlockHostnames []string `json:"blockHostnames" envconfig:"block_hostnames"`
+
+	// Controls the caching, the IP version preference and the selection of the resolved IPs, and
+	// the DNS-over-HTTPS or DNS-over-TLS server that resolves the hostnames, if there is one.
+	DNS types.DNSConfig `json:"dns" envconfig:"dns"`
+
+	// Client-side faults that are injected into a share of the HTTP requests, to check that the
+	// dashboards and alerts catch them. The affected requests are tagged with the "injected" tag.
+	Chaos types.ChaosConfig `json:"chaos" envconfig:"chaos"`
+
+	// Races the connections to the IPv6 and IPv4 addresses of dual-stack hosts like the Happy
+	// Eyeballs (RFC 8305) clients do, starting a new attempt with the next address after this delay
+	// until one of them connects. Disabled when unset or 0.
+	HappyEyeballs types.NullDuration `json:"happyEyeballs" envconfig:"happy_eyeballs"`
+
+	// Hosts overrides dns entries for given hosts, with an IP, an IP and a port, or a list of
+	// those that connections are distributed between in a round-robin fashion.
+	Hosts map[string]types.HostAddresses `json:"hosts" ignored:"true"`
 
-	// Hosts overrides dns entries for given hosts
-	Hosts map[string]net.IP `json:"hosts" envconfig:"hosts"`
+	// Local source IPs that the connections are spread over, so that machines with several
+	// addresses can open more connections to the same destination than the ephemeral ports allow.
+	LocalIPs types.IPPool `json:"localIPs" envconfig:"local_ips"`
 
 	// Disable keep-alive connections
 	NoConnectionReuse null.Bool `json:"noConnectionReuse" envconfig:"no_connection_reuse"`
@@ -275,6 +525,9 @@ type Options struct {
 	// iteration is shorter than the specified value.
 	MinIterationDuration types.NullDuration `json:"minIterationDuration" envconfig:"min_iteration_duration"`
 
+	// Emit the open connections, in-flight requests and errors of every target host as metrics
+	HostMetrics null.Bool `json:"hostMetrics" envconfig:"host_metrics"`
+
 	// These values are for third party collectors' benefit.
 	// Can't be set through env vars.
 	External map[string]json.RawMessage `json:"ext" ignored:"true"`
@@ -285,11 +538,48 @@ type Options struct {
 	// Summary time unit for summary metrics (response times) in CLI output
 	SummaryTimeUnit null.String `json:"summaryTimeUnit" envconfig:"summary_time_unit"`
 
+	// Show a histogram of the value distribution for trend metrics in CLI output
+	SummaryHistogram null.Bool `json:"summaryHistogram" envconfig:"summary_histogram"`
+
+	// Only summarize the samples with these tags, e.g. "scenario:checkout,status:200"
+	SummaryFilter null.String `json:"summaryFilter" envconfig:"summary_filter"`
+
+	// Compare the metrics of these two scenarios side by side in the summary, e.g. for A/B tests
+	SummaryCompare []string `json:"summaryCompare" envconfig:"summary_compare"`
+
+	// The number of significant decimal digits that trend metrics keep for the summary and the
+	// thresholds (stats.DefaultTrendPrecision by default), or 0 to keep all of their values.
+	TrendPrecision null.Int `json:"trendPrecision" envconfig:"trend_precision"`
+
+	// Metric name patterns (with * wildcards), mapped to how the values of the matching trend
+	// metrics are kept: "histogram" (the default) uses the trend precision, and "tdigest" keeps a
+	// t-digest of them, which needs less memory and can be merged with the ones of other instances.
+	// An exact name takes precedence over the patterns, e.g. {"*": "tdigest", "my_trend": "histogram"}.
+	TrendSinks map[string]string `json:"trendSinks" envconfig:"trend_sinks"`
+
 	// Which system tags to include with metrics ("method", "vu" etc.)
 	SystemTags TagSet `json:"systemTags" envconfig:"system_tags"`
 
 	// Tags to be applied to all samples for this running
-	RunTags *stats.SampleTags `json:"tags" envconfig:"tags"`
+	RunTags *stats.SampleTags `json:"tags" ignored:"true"`
+
+	// Experiment variants mapped to their weights, e.g. {"control": 1, "new": 1} for an even A/B
+	// split of the VUs. The variant of every VU or iteration (see VariantsPer) is added to all of
+	// its samples as the "variant" tag, and the summary shows a breakdown of the metrics by it.
+	Variants map[string]float64 `json:"variants" envconfig:"variants"`
+
+	// Whether the variants are assigned to whole VUs ("vu", the default) or to single iterations ("iteration").
+	VariantsPer null.String `json:"variantsPer" envconfig:"variants_per"`
+
+	// Tag name patterns (with * wildcards), mapped to how the values of the matching tags are
+	// redacted before the samples reach the outputs: "strip" removes the tag, "hash" replaces
+	// its value with a short hash of it.
+	RedactTags map[string]string `json:"redactTags" envconfig:"redact_tags"`
+
+	// The region and zone that this instance runs in, for geo-distributed tests. They are added
+	// to all samples as the "region" and "zone" system tags.
+	Region null.String `json:"region" envconfig:"region"`
+	Zone   null.String `json:"zone" envconfig:"zone"`
 
 	// Buffer size of the channel for metric samples; 0 means unbuffered
 	MetricSamplesBufferSize null.Int `json:"metricSamplesBufferSize" envconfig:"metric_samples_buffer_size"`
@@ -364,6 +654,27 @@ func (o Options) Apply(opts Options) Options {
 	if opts.TeardownTimeout.Valid {
 		o.TeardownTimeout = opts.TeardownTimeout
 	}
+	if opts.MaxDuration.Valid {
+		o.MaxDuration = opts.MaxDuration
+	}
+	if opts.VURecycleIterations.Valid {
+		o.VURecycleIterations = opts.VURecycleIterations
+	}
+	if opts.VURecycleOnError.Valid {
+		o.VURecycleOnError = opts.VURecycleOnError
+	}
+	if opts.VURecycleHeapLimit.Valid {
+		o.VURecycleHeapLimit = opts.VURecycleHeapLimit
+	}
+	if opts.Executor.Valid {
+		o.Executor = opts.Executor
+	}
+	if opts.TraceFile.Valid {
+		o.TraceFile = opts.TraceFile
+	}
+	if opts.Seed.Valid {
+		o.Seed = opts.Seed
+	}
 	if opts.RPS.Valid {
 		o.RPS = opts.RPS
 	}
@@ -382,6 +693,12 @@ func (o Options) Apply(opts Options) Options {
 	if opts.HttpDebug.Valid {
 		o.HttpDebug = opts.HttpDebug
 	}
+	if opts.RedactHeaders != nil {
+		o.RedactHeaders = opts.RedactHeaders
+	}
+	if opts.RedactCookies != nil {
+		o.RedactCookies = opts.RedactCookies
+	}
 	if opts.InsecureSkipTLSVerify.Valid {
 		o.InsecureSkipTLSVerify = opts.InsecureSkipTLSVerify
 	}
@@ -394,24 +711,78 @@ func (o Options) Apply(opts Options) Options {
 	if opts.TLSAuth != nil {
 		o.TLSAuth = opts.TLSAuth
 	}
+	if opts.TLSCACerts != nil {
+		o.TLSCACerts = opts.TLSCACerts
+	}
+	if opts.TLSHosts != nil {
+		o.TLSHosts = opts.TLSHosts
+	}
+	if opts.ConnectionPools != nil {
+		o.ConnectionPools = opts.ConnectionPools
+	}
+	o.HealthCheck = o.HealthCheck.Apply(opts.HealthCheck)
 	if opts.Throw.Valid {
 		o.Throw = opts.Throw
 	}
 	if opts.Thresholds != nil {
 		o.Thresholds = opts.Thresholds
 	}
+	if opts.ThresholdsInterval.Valid {
+		o.ThresholdsInterval = opts.ThresholdsInterval
+	}
+	if opts.Jobs != nil {
+		o.Jobs = opts.Jobs
+	}
+	if opts.AdaptiveLoad != nil {
+		o.AdaptiveLoad = opts.AdaptiveLoad
+	}
+	if opts.AnomalyDetection != nil {
+		o.AnomalyDetection = opts.AnomalyDetection
+	}
+	if opts.CollectorPeriod.Valid {
+		o.CollectorPeriod = opts.CollectorPeriod
+	}
+	if opts.CollectorPeriods != nil {
+		o.CollectorPeriods = opts.CollectorPeriods
+	}
+	if opts.AggregationPeriod.Valid {
+		o.AggregationPeriod = opts.AggregationPeriod
+	}
+	if opts.AggregationPeriods != nil {
+		o.AggregationPeriods = opts.AggregationPeriods
+	}
+	if opts.Relabel != nil {
+		o.Relabel = opts.Relabel
+	}
+	if opts.FinalFlushTimeout.Valid {
+		o.FinalFlushTimeout = opts.FinalFlushTimeout
+	}
 	if opts.BlacklistIPs != nil {
 		o.BlacklistIPs = opts.BlacklistIPs
 	}
+	if opts.BlockHostnames != nil {
+		o.BlockHostnames = opts.BlockHostnames
+	}
+	o.DNS = o.DNS.Apply(opts.DNS)
+	o.Chaos = o.Chaos.Apply(opts.Chaos)
+	if opts.HappyEyeballs.Valid {
+		o.HappyEyeballs = opts.HappyEyeballs
+	}
 	if opts.Hosts != nil {
 		o.Hosts = opts.Hosts
 	}
+	if opts.LocalIPs != nil {
+		o.LocalIPs = opts.LocalIPs
+	}
 	if opts.NoConnectionReuse.Valid {
 		o.NoConnectionReuse = opts.NoConnectionReuse
 	}
 	if opts.NoVUConnectionReuse.Valid {
 		o.NoVUConnectionReuse = opts.NoVUConnectionReuse
 	}
+	if opts.HostMetrics.Valid {
+		o.HostMetrics = opts.HostMetrics
+	}
 	if opts.MinIterationDuration.Valid {
 		o.MinIterationDuration = opts.MinIterationDuration
 	}
@@ -427,12 +798,42 @@ func (o Options) Apply(opts Options) Options {
 	if opts.SummaryTimeUnit.Valid {
 		o.SummaryTimeUnit = opts.SummaryTimeUnit
 	}
+	if opts.SummaryHistogram.Valid {
+		o.SummaryHistogram = opts.SummaryHistogram
+	}
+	if opts.SummaryFilter.Valid {
+		o.SummaryFilter = opts.SummaryFilter
+	}
+	if opts.SummaryCompare != nil {
+		o.SummaryCompare = opts.SummaryCompare
+	}
+	if opts.TrendPrecision.Valid {
+		o.TrendPrecision = opts.TrendPrecision
+	}
+	if opts.TrendSinks != nil {
+		o.TrendSinks = opts.TrendSinks
+	}
 	if opts.SystemTags != nil {
 		o.SystemTags = opts.SystemTags
 	}
 	if !opts.RunTags.IsEmpty() {
 		o.RunTags = opts.RunTags
 	}
+	if opts.Variants != nil {
+		o.Variants = opts.Variants
+	}
+	if opts.VariantsPer.Valid {
+		o.VariantsPer = opts.VariantsPer
+	}
+	if opts.RedactTags != nil {
+		o.RedactTags = opts.RedactTags
+	}
+	if opts.Region.Valid {
+		o.Region = opts.Region
+	}
+	if opts.Zone.Valid {
+		o.Zone = opts.Zone
+	}
 	if opts.MetricSamplesBufferSize.Valid {
 		o.MetricSamplesBufferSize = opts.MetricSamplesBufferSize
 	}
@@ -446,11 +847,222 @@ func (o Options) Apply(opts Options) Options {
 	return o
 }
 
+// WithInstanceTags returns a copy of the options whose run tags include the region and zone of
+// this instance, if they are set and enabled as system tags. Explicitly set run tags win.
+func (o Options) WithInstanceTags() Options {
+	tags := o.RunTags.CloneTags()
+	changed := false
+	for _, tag := range []struct {
+		name  string
+		value null.String
+	}{{"region", o.Region}, {"zone", o.Zone}} {
+		if !tag.value.Valid || tag.value.String == "" || !o.SystemTags[tag.name] {
+			continue
+		}
+		if _, ok := tags[tag.name]; !ok {
+			tags[tag.name] = tag.value.String
+			changed = true
+		}
+	}
+	if changed {
+		o.RunTags = stats.IntoSampleTags(&tags)
+	}
+	return o
+}
+
 // Validate checks if all of the specified options make sense
 func (o Options) Validate() []error {
 	//TODO: validate all of the other options... that we should have already been validating...
 	//TODO: maybe integrate an external validation lib: https://github.com/avelino/awesome-go#validation
-	return o.Execution.Validate()
+	errs := o.Execution.Validate()
+	errs = append(errs, o.validateLoad()...)
+	if o.ThresholdsInterval.Valid && o.ThresholdsInterval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the thresholds interval must be positive, not %s", o.ThresholdsInterval.Duration))
+	}
+	for name, job := range o.Jobs {
+		errs = append(errs, job.Validate(name)...)
+	}
+	if o.AdaptiveLoad != nil {
+		errs = append(errs, o.AdaptiveLoad.Validate()...)
+	}
+	if o.AnomalyDetection != nil {
+		errs = append(errs, o.AnomalyDetection.Validate()...)
+	}
+	if o.VURecycleHeapLimit.Valid && o.VURecycleHeapLimit.Int64 <= 0 {
+		errs = append(errs, fmt.Errorf("the VU recycle heap limit must be positive, not %d", o.VURecycleHeapLimit.Int64))
+	}
+	for tag := range o.SystemTags {
+		if !isKnownSystemTag(tag) {
+			errs = append(errs, fmt.Errorf("'%s' isn't a valid system tag", tag))
+		}
+	}
+	for pattern, action := range o.RedactTags {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("'%s' isn't a valid tag name pattern: %s", pattern, err))
+		}
+		if action != stats.RedactStrip && action != stats.RedactHash {
+			errs = append(errs, fmt.Errorf(
+				"the tag redaction for '%s' must be '%s' or '%s', not '%s'", pattern, stats.RedactStrip, stats.RedactHash, action,
+			))
+		}
+	}
+	for name, weight := range o.Variants {
+		if !(weight > 0) || math.IsInf(weight, 0) {
+			errs = append(errs, fmt.Errorf("the weight of the variant '%s' must be a positive number, not %v", name, weight))
+		}
+	}
+	if p := o.VariantsPer; p.Valid && p.String != VariantsPerVU && p.String != VariantsPerIteration {
+		errs = append(errs, fmt.Errorf("variants must be assigned per '%s' or '%s', not '%s'", VariantsPerVU, VariantsPerIteration, p.String))
+	}
+	errs = append(errs, o.DNS.Validate()...)
+	errs = append(errs, o.Chaos.Validate()...)
+	for _, pattern := range o.BlockHostnames {
+		if pattern == "" || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+			errs = append(errs, fmt.Errorf("'%s' isn't a valid hostname pattern, only a leading '*.' wildcard is supported", pattern))
+		}
+	}
+	for _, host := range o.TLSHosts {
+		if len(host.Domains) == 0 {
+			errs = append(errs, errors.New("every tlsHosts entry needs at least one domain"))
+		}
+		for _, pattern := range host.Domains {
+			if pattern == "" || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+				errs = append(errs, fmt.Errorf("'%s' isn't a valid tlsHosts domain, only a leading '*.' wildcard is supported", pattern))
+			}
+		}
+	}
+	errs = append(errs, o.HealthCheck.Validate()...)
+	for name, pool := range o.ConnectionPools {
+		if name == "" {
+			errs = append(errs, errors.New("the connection pools need a name"))
+		}
+		if pool == nil {
+			errs = append(errs, fmt.Errorf("the connection pool '%s' has no settings", name))
+			continue
+		}
+		if pool.Proxy.String != "" {
+			if u, err := url.Parse(pool.Proxy.String); err != nil || u.Host == "" {
+				errs = append(errs, fmt.Errorf("'%s' isn't a valid proxy URL for the connection pool '%s'", pool.Proxy.String, name))
+			}
+		}
+		if pool.IdleTimeout.Duration < 0 {
+			errs = append(errs, fmt.Errorf("the idle timeout of the connection pool '%s' can't be negative", name))
+		}
+	}
+	for name := range o.RunTags.CloneMultiTags() {
+		errs = append(errs, fmt.Errorf("the '%s' tag has multiple values, which isn't supported in the tags option", name))
+	}
+	if o.CollectorPeriod.Valid && o.CollectorPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the collector period must be positive, not %s", o.CollectorPeriod.Duration))
+	}
+	for name, period := range o.CollectorPeriods {
+		if period.Valid && period.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("the collector period for '%s' must be positive, not %s", name, period.Duration))
+		}
+	}
+	if o.AggregationPeriod.Valid && o.AggregationPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("the aggregation period must be positive, not %s", o.AggregationPeriod.Duration))
+	}
+	for name, period := range o.AggregationPeriods {
+		if period.Valid && period.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("the aggregation period for '%s' must be positive, not %s", name, period.Duration))
+		}
+	}
+	for name, rules := range o.Relabel {
+		for _, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("relabeling for '%s': %s", name, err))
+			}
+		}
+	}
+	switch o.SummaryTimeUnit.String {
+	case "", "s", "ms", "us":
+	default:
+		errs = append(errs, fmt.Errorf("'%s' isn't a valid summary time unit, use 's', 'ms' or 'us'", o.SummaryTimeUnit.String))
+	}
+	if c := o.SummaryCompare; c != nil && (len(c) != 2 || c[0] == c[1]) {
+		errs = append(errs, fmt.Errorf("the summary can only compare two different scenarios, not %q", c))
+	}
+	if p := o.TrendPrecision; p.Valid && (p.Int64 < 0 || p.Int64 > stats.MaxTrendPrecision) {
+		errs = append(errs, fmt.Errorf("the trend precision must be between 0 and %d, not %d", stats.MaxTrendPrecision, p.Int64))
+	}
+	for pattern, kind := range o.TrendSinks {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("'%s' isn't a valid metric name pattern: %s", pattern, err))
+		}
+		if kind != stats.TrendSinkHistogram && kind != stats.TrendSinkTDigest {
+			errs = append(errs, fmt.Errorf(
+				"the trend sink for '%s' must be '%s' or '%s', not '%s'", pattern, stats.TrendSinkHistogram, stats.TrendSinkTDigest, kind,
+			))
+		}
+	}
+	return errs
+}
+
+// validateLoad checks the VUs, duration, iterations, stages and timeouts, with hints for the
+// options that have to be changed.
+func (o Options) validateLoad() (errs []error) {
+	for _, opt := range []struct {
+		name  string
+		value null.Int
+	}{
+		{"vus", o.VUs}, {"vusMax", o.VUsMax}, {"iterations", o.Iterations}, {"rps", o.RPS},
+		{"maxRedirects", o.MaxRedirects}, {"batch", o.Batch}, {"batchPerHost", o.BatchPerHost},
+	} {
+		if opt.value.Valid && opt.value.Int64 < 0 {
+			errs = append(errs, fmt.Errorf("the %s option can't be negative, but is %d", opt.name, opt.value.Int64))
+		}
+	}
+	for _, opt := range []struct {
+		name  string
+		value types.NullDuration
+	}{
+		{"duration", o.Duration}, {"setupTimeout", o.SetupTimeout}, {"teardownTimeout", o.TeardownTimeout},
+		{"minIterationDuration", o.MinIterationDuration}, {"finalFlushTimeout", o.FinalFlushTimeout},
+		{"happyEyeballs", o.HappyEyeballs},
+	} {
+		if opt.value.Valid && opt.value.Duration < 0 {
+			errs = append(errs, fmt.Errorf("the %s option can't be negative, but is %s", opt.name, opt.value.Duration))
+		}
+	}
+
+	if o.VUs.Valid && o.VUsMax.Valid && o.VUs.Int64 > o.VUsMax.Int64 {
+		errs = append(errs, fmt.Errorf(
+			"the number of VUs (%d) can't be more than the max VUs (%d), raise vusMax (--max) or lower vus (--vus)",
+			o.VUs.Int64, o.VUsMax.Int64,
+		))
+	}
+	for i, stage := range o.Stages {
+		if stage.Duration.Valid && stage.Duration.Duration < 0 {
+			errs = append(errs, fmt.Errorf("the duration of stage %d can't be negative, but is %s", i+1, stage.Duration.Duration))
+		}
+		if !stage.Target.Valid {
+			continue
+		}
+		if stage.Target.Int64 < 0 {
+			errs = append(errs, fmt.Errorf("the target of stage %d can't be negative, but is %d", i+1, stage.Target.Int64))
+		} else if o.VUsMax.Valid && stage.Target.Int64 > o.VUsMax.Int64 {
+			errs = append(errs, fmt.Errorf(
+				"the target of stage %d (%d VUs) is more than the max VUs (%d), raise vusMax (--max) to at least %d",
+				i+1, stage.Target.Int64, o.VUsMax.Int64, stage.Target.Int64,
+			))
+		}
+	}
+	return errs
+}
+
+func isKnownSystemTag(tag string) bool {
+	for _, known := range DefaultSystemTagList {
+		if tag == known {
+			return true
+		}
+	}
+	for _, known := range OptionalSystemTagList {
+		if tag == known {
+			return true
+		}
+	}
+	return false
 }
 
 // ForEachSpecified enumerates all struct fields and calls the supplied function with each
@@ -23,8 +23,11 @@ package lib
 import (
 	"crypto/tls"
 	"encoding/json"
+	"io/ioutil"
+	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -99,6 +102,44 @@ func TestOptions(t *testing.T) {
 		assert.Equal(t, "3m0s", cs.Duration.String())
 	})
 	//TODO: test that any execution option overwrites any other lower-level options
+	t.Run("MaxDuration", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxDuration: types.NullDurationFrom(10 * time.Minute)})
+		assert.True(t, opts.MaxDuration.Valid)
+		assert.Equal(t, "10m0s", opts.MaxDuration.String())
+	})
+	t.Run("VURecycleIterations", func(t *testing.T) {
+		opts := Options{}.Apply(Options{VURecycleIterations: null.IntFrom(100)})
+		assert.True(t, opts.VURecycleIterations.Valid)
+		assert.Equal(t, int64(100), opts.VURecycleIterations.Int64)
+	})
+	t.Run("VURecycleOnError", func(t *testing.T) {
+		opts := Options{}.Apply(Options{VURecycleOnError: null.BoolFrom(true)})
+		assert.True(t, opts.VURecycleOnError.Valid)
+		assert.True(t, opts.VURecycleOnError.Bool)
+	})
+	t.Run("VURecycleHeapLimit", func(t *testing.T) {
+		opts := Options{}.Apply(Options{VURecycleHeapLimit: null.IntFrom(64 << 20)})
+		assert.Equal(t, null.IntFrom(64<<20), opts.VURecycleHeapLimit)
+		assert.Empty(t, opts.Validate())
+
+		opts.VURecycleHeapLimit = null.IntFrom(0)
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("Executor", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Executor: null.StringFrom("trace")})
+		assert.True(t, opts.Executor.Valid)
+		assert.Equal(t, "trace", opts.Executor.String)
+	})
+	t.Run("TraceFile", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TraceFile: null.StringFrom("trace.har")})
+		assert.True(t, opts.TraceFile.Valid)
+		assert.Equal(t, "trace.har", opts.TraceFile.String)
+	})
+	t.Run("Seed", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Seed: null.IntFrom(42)})
+		assert.True(t, opts.Seed.Valid)
+		assert.Equal(t, int64(42), opts.Seed.Int64)
+	})
 	t.Run("RPS", func(t *testing.T) {
 		opts := Options{}.Apply(Options{RPS: null.IntFrom(12345)})
 		assert.True(t, opts.RPS.Valid)
@@ -124,6 +165,14 @@ func TestOptions(t *testing.T) {
 		assert.True(t, opts.BatchPerHost.Valid)
 		assert.Equal(t, int64(12345), opts.BatchPerHost.Int64)
 	})
+	t.Run("RedactHeaders", func(t *testing.T) {
+		opts := Options{}.Apply(Options{RedactHeaders: []string{"Authorization", "X-*-Token"}})
+		assert.Equal(t, []string{"Authorization", "X-*-Token"}, opts.RedactHeaders)
+	})
+	t.Run("RedactCookies", func(t *testing.T) {
+		opts := Options{}.Apply(Options{RedactCookies: []string{"session*"}})
+		assert.Equal(t, []string{"session*"}, opts.RedactCookies)
+	})
 	t.Run("HttpDebug", func(t *testing.T) {
 		opts := Options{}.Apply(Options{HttpDebug: null.StringFrom("foo")})
 		assert.True(t, opts.HttpDebug.Valid)
@@ -279,6 +328,27 @@ func TestOptions(t *testing.T) {
 			}
 		})
 
+		t.Run("Files", func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "k6-tlsauth")
+			require.NoError(t, err)
+			defer func() { _ = os.RemoveAll(dir) }()
+			certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			require.NoError(t, ioutil.WriteFile(certPath, []byte(tlsAuth[1].Cert), 0644))
+			require.NoError(t, ioutil.WriteFile(keyPath, []byte(tlsAuth[1].Key), 0600))
+
+			data, err := json.Marshal(map[string]interface{}{"tlsAuth": []map[string]interface{}{
+				{"domains": []string{"sub.example.com"}, "cert": certPath, "key": keyPath},
+			}})
+			require.NoError(t, err)
+			var opts Options
+			require.NoError(t, json.Unmarshal(data, &opts))
+			require.Len(t, opts.TLSAuth, 1)
+			assert.Equal(t, tlsAuth[1].TLSAuthFields, opts.TLSAuth[0].TLSAuthFields)
+
+			jsonStr := `{"tlsAuth":[{"domains":["example.com"],"cert":"/nonexistent/cert.pem","key":"k"}]}`
+			assert.Error(t, json.Unmarshal([]byte(jsonStr), &opts))
+		})
+
 		t.Run("Invalid JSON", func(t *testing.T) {
 			var opts Options
 			jsonStr := `{"tlsAuth":["invalid"]}`
@@ -296,6 +366,11 @@ func TestOptions(t *testing.T) {
 		assert.True(t, opts.NoConnectionReuse.Valid)
 		assert.True(t, opts.NoConnectionReuse.Bool)
 	})
+	t.Run("HostMetrics", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HostMetrics: null.BoolFrom(true)})
+		assert.True(t, opts.HostMetrics.Valid)
+		assert.True(t, opts.HostMetrics.Bool)
+	})
 	t.Run("NoVUConnectionReuse", func(t *testing.T) {
 		opts := Options{}.Apply(Options{NoVUConnectionReuse: null.BoolFrom(true)})
 		assert.True(t, opts.NoVUConnectionReuse.Valid)
@@ -318,14 +393,163 @@ func TestOptions(t *testing.T) {
 		assert.Equal(t, net.IPv4zero, opts.BlacklistIPs[0].IP)
 		assert.Equal(t, net.CIDRMask(1, 1), opts.BlacklistIPs[0].Mask)
 	})
+	t.Run("DNS", func(t *testing.T) {
+		opts := Options{DNS: types.DNSConfig{TTL: null.StringFrom("1m"), Valid: true}}.Apply(Options{
+			DNS: types.DNSConfig{Select: null.StringFrom(types.DNSRoundRobin), Valid: true},
+		})
+		assert.Equal(t, types.DNSConfig{
+			TTL:    null.StringFrom("1m"),
+			Select: null.StringFrom(types.DNSRoundRobin),
+			Valid:  true,
+		}, opts.DNS)
+		assert.Empty(t, opts.Validate())
+
+		opts.DNS.Policy = null.StringFrom("ipv5")
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("Chaos", func(t *testing.T) {
+		opts := Options{Chaos: types.ChaosConfig{Fail: null.FloatFrom(0.01), Valid: true}}.Apply(Options{
+			Chaos: types.ChaosConfig{Truncate: null.FloatFrom(0.02), Valid: true},
+		})
+		assert.Equal(t, types.ChaosConfig{
+			Fail:     null.FloatFrom(0.01),
+			Truncate: null.FloatFrom(0.02),
+			Valid:    true,
+		}, opts.Chaos)
+		assert.Empty(t, opts.Validate())
+
+		opts.Chaos.Delay = null.FloatFrom(1)
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("BlockHostnames", func(t *testing.T) {
+		opts := Options{}.Apply(Options{BlockHostnames: []string{"*.example.com", "test.k6.io"}})
+		assert.Equal(t, []string{"*.example.com", "test.k6.io"}, opts.BlockHostnames)
+		assert.Empty(t, opts.Validate())
+
+		opts.BlockHostnames = []string{"", "ex*mple.com", "*example.com"}
+		assert.Len(t, opts.Validate(), 3)
+	})
+	t.Run("TLSCACerts", func(t *testing.T) {
+		const caCert = "-----BEGIN CERTIFICATE-----\n" +
+			"MIIBYzCCAQqgAwIBAgIUMYw1pqZ1XhXdFG0S2ITXhfHBsWgwCgYIKoZIzj0EAwIw\n" +
+			"EDEOMAwGA1UEAxMFTXkgQ0EwHhcNMTcwODE1MTYxODAwWhcNMjIwODE0MTYxODAw\n" +
+			"WjAQMQ4wDAYDVQQDEwVNeSBDQTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABFWO\n" +
+			"fg4dgL8cdvjoSWDQFLBJxlbQFlZfOSyUR277a4g91BD07KWX+9ny+Q8WuUODog06\n" +
+			"xH1g8fc6zuaejllfzM6jQjBAMA4GA1UdDwEB/wQEAwIBBjAPBgNVHRMBAf8EBTAD\n" +
+			"AQH/MB0GA1UdDgQWBBTeoSFylGCmyqj1X4sWez1r6hkhjDAKBggqhkjOPQQDAgNH\n" +
+			"ADBEAiAfuKi6u/BVXenCkgnU2sfXsYjel6rACuXEcx01yaaWuQIgXAtjrDisdlf4\n" +
+			"0ZdoIoYjNhDAXUtnyRBt+V6+rIklv/8=\n" +
+			"-----END CERTIFICATE-----\n"
+
+		dir, err := ioutil.TempDir("", "k6-tlscacerts")
+		require.NoError(t, err)
+		defer func() { _ = os.RemoveAll(dir) }()
+		caPath := filepath.Join(dir, "ca.pem")
+		require.NoError(t, ioutil.WriteFile(caPath, []byte(caCert), 0644))
+
+		t.Run("List", func(t *testing.T) {
+			var opts Options
+			data, err := json.Marshal(map[string]interface{}{"tlsCACerts": []string{caPath, caCert}})
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(data, &opts))
+			opts = Options{}.Apply(opts)
+			require.NotNil(t, opts.TLSCACerts)
+			assert.Equal(t, []string{caCert, caCert}, opts.TLSCACerts.Certs)
+			assert.False(t, opts.TLSCACerts.System.Valid)
+
+			pool, err := opts.TLSCACerts.CertPool()
+			require.NoError(t, err)
+			assert.NotNil(t, pool)
+
+			t.Run("Roundtrip", func(t *testing.T) {
+				data, err := json.Marshal(opts.TLSCACerts)
+				require.NoError(t, err)
+				var caCerts TLSCACerts
+				require.NoError(t, json.Unmarshal(data, &caCerts))
+				assert.Equal(t, opts.TLSCACerts.TLSCACertsFields, caCerts.TLSCACertsFields)
+			})
+		})
+		t.Run("Object", func(t *testing.T) {
+			var opts Options
+			data, err := json.Marshal(map[string]interface{}{
+				"tlsCACerts": map[string]interface{}{"certs": []string{caPath}, "system": false},
+			})
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(data, &opts))
+			assert.Equal(t, TLSCACertsFields{Certs: []string{caCert}, System: null.BoolFrom(false)},
+				opts.TLSCACerts.TLSCACertsFields)
+
+			pool, err := opts.TLSCACerts.CertPool()
+			require.NoError(t, err)
+			assert.Len(t, pool.Subjects(), 1)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			for _, jsonStr := range []string{
+				`{"tlsCACerts":["/nonexistent/ca.pem"]}`,
+				`{"tlsCACerts":["-----BEGIN CERTIFICATE-----\nnope\n-----END CERTIFICATE-----"]}`,
+				`{"tlsCACerts":"ca.pem"}`,
+			} {
+				assert.Error(t, json.Unmarshal([]byte(jsonStr), &Options{}), jsonStr)
+			}
+		})
+	})
+	t.Run("TLSHosts", func(t *testing.T) {
+		var opts Options
+		jsonStr := `{"tlsHosts":[{"domains":["legacy.example.com","*.old.example.com"],` +
+			`"tlsVersion":{"min":"tls1.0","max":"tls1.1"},"tlsCipherSuites":["TLS_RSA_WITH_AES_128_CBC_SHA"]}]}`
+		require.NoError(t, json.Unmarshal([]byte(jsonStr), &opts))
+		opts = Options{}.Apply(opts)
+		require.Len(t, opts.TLSHosts, 1)
+		assert.Equal(t, []string{"legacy.example.com", "*.old.example.com"}, opts.TLSHosts[0].Domains)
+		assert.Equal(t, &TLSVersions{Min: tls.VersionTLS10, Max: tls.VersionTLS11}, opts.TLSHosts[0].TLSVersion)
+		assert.Equal(t, &TLSCipherSuites{tls.TLS_RSA_WITH_AES_128_CBC_SHA}, opts.TLSHosts[0].TLSCipherSuites)
+		assert.Empty(t, opts.Validate())
+
+		opts.TLSHosts = []*TLSHost{{}, {Domains: []string{"ex*mple.com"}}}
+		assert.Len(t, opts.Validate(), 2)
+
+		t.Run("Bad cipher suite", func(t *testing.T) {
+			jsonStr := `{"tlsHosts":[{"domains":["example.com"],"tlsCipherSuites":["TLS_NOPE"]}]}`
+			assert.Error(t, json.Unmarshal([]byte(jsonStr), &Options{}))
+		})
+	})
+	t.Run("ConnectionPools", func(t *testing.T) {
+		var opts Options
+		jsonStr := `{"connectionPools":{"direct":{"proxy":"","idleTimeout":"30s"},"cdn":{"proxy":"http://cdn.example.com:3128","tlsVersion":"tls1.2","noConnectionReuse":true}}}`
+		require.NoError(t, json.Unmarshal([]byte(jsonStr), &opts))
+		opts = Options{}.Apply(opts)
+		require.Len(t, opts.ConnectionPools, 2)
+		assert.Equal(t, null.StringFrom(""), opts.ConnectionPools["direct"].Proxy)
+		assert.Equal(t, types.NullDurationFrom(30*time.Second), opts.ConnectionPools["direct"].IdleTimeout)
+		assert.Equal(t, null.StringFrom("http://cdn.example.com:3128"), opts.ConnectionPools["cdn"].Proxy)
+		assert.Equal(t, &TLSVersions{Min: tls.VersionTLS12, Max: tls.VersionTLS12}, opts.ConnectionPools["cdn"].TLSVersion)
+		assert.Equal(t, null.BoolFrom(true), opts.ConnectionPools["cdn"].NoConnectionReuse)
+		assert.Empty(t, opts.Validate())
+
+		opts.ConnectionPools = map[string]*ConnectionPool{
+			"":        {},
+			"proxied": {Proxy: null.StringFrom("cdn.example.com")},
+			"idle":    {IdleTimeout: types.NullDurationFrom(-time.Second)},
+			"empty":   nil,
+		}
+		assert.Len(t, opts.Validate(), 4)
+	})
+	t.Run("LocalIPs", func(t *testing.T) {
+		pool, err := types.ParseIPPool("10.0.0.1-10.0.0.5,192.168.0.0/24")
+		require.NoError(t, err)
+		opts := Options{}.Apply(Options{LocalIPs: pool})
+		assert.Equal(t, pool, opts.LocalIPs)
+		opts = opts.Apply(Options{})
+		assert.Equal(t, pool, opts.LocalIPs)
+	})
 
 	t.Run("Hosts", func(t *testing.T) {
-		opts := Options{}.Apply(Options{Hosts: map[string]net.IP{
-			"test.loadimpact.com": net.ParseIP("192.0.2.1"),
+		opts := Options{}.Apply(Options{Hosts: map[string]types.HostAddresses{
+			"test.loadimpact.com": {{IP: net.ParseIP("192.0.2.1")}},
 		}})
 		assert.NotNil(t, opts.Hosts)
 		assert.NotEmpty(t, opts.Hosts)
-		assert.Equal(t, "192.0.2.1", opts.Hosts["test.loadimpact.com"].String())
+		assert.Equal(t, "192.0.2.1", opts.Hosts["test.loadimpact.com"][0].String())
 	})
 
 	t.Run("Throws", func(t *testing.T) {
@@ -343,6 +567,133 @@ func TestOptions(t *testing.T) {
 		assert.NotNil(t, opts.Thresholds)
 		assert.NotEmpty(t, opts.Thresholds)
 	})
+	t.Run("SummaryTimeUnit", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SummaryTimeUnit: null.StringFrom("ms")})
+		assert.Equal(t, null.StringFrom("ms"), opts.SummaryTimeUnit)
+		assert.Empty(t, opts.Validate())
+
+		opts.SummaryTimeUnit = null.StringFrom("minutes")
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("ThresholdsInterval", func(t *testing.T) {
+		opts := Options{}.Apply(Options{ThresholdsInterval: types.NullDurationFrom(10 * time.Second)})
+		assert.Equal(t, types.NullDurationFrom(10*time.Second), opts.ThresholdsInterval)
+		assert.Empty(t, opts.Validate())
+
+		opts.ThresholdsInterval = types.NullDurationFrom(0)
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("Jobs", func(t *testing.T) {
+		jobs := map[string]JobConfig{
+			"refresh": {Interval: types.NullDurationFrom(5 * time.Minute)},
+			"health":  {Exec: null.StringFrom("poll"), Interval: types.NullDurationFrom(time.Second), Scope: null.StringFrom(JobScopeTest)},
+		}
+		opts := Options{}.Apply(Options{Jobs: jobs})
+		assert.Equal(t, jobs, opts.Jobs)
+		assert.Empty(t, opts.Validate())
+		assert.Equal(t, "refresh", jobs["refresh"].GetExec("refresh"))
+		assert.Equal(t, JobScopeVU, jobs["refresh"].GetScope())
+		assert.Equal(t, "poll", jobs["health"].GetExec("health"))
+
+		opts.Jobs = map[string]JobConfig{"bad": {Exec: null.StringFrom(""), Scope: null.StringFrom("global")}}
+		assert.Len(t, opts.Validate(), 3)
+	})
+	t.Run("AdaptiveLoad", func(t *testing.T) {
+		config := &AdaptiveLoadConfig{Threshold: "p(95)<300", StartRate: null.IntFrom(50)}
+		opts := Options{}.Apply(Options{AdaptiveLoad: config})
+		assert.Equal(t, config, opts.AdaptiveLoad)
+		assert.Empty(t, opts.Validate())
+		assert.Equal(t, "http_req_duration", config.GetMetric())
+		assert.Equal(t, 50.0, config.GetStartRate())
+		assert.Equal(t, 10*time.Second, config.GetWindow())
+
+		opts.AdaptiveLoad = &AdaptiveLoadConfig{
+			Threshold: "p(95)<",
+			StartRate: null.IntFrom(100),
+			MaxRate:   null.IntFrom(50),
+			Window:    types.NullDurationFrom(0),
+			Precision: null.FloatFrom(1),
+		}
+		assert.Len(t, opts.Validate(), 4)
+
+		opts.AdaptiveLoad = &AdaptiveLoadConfig{}
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("AnomalyDetection", func(t *testing.T) {
+		config := &AnomalyDetectionConfig{Windows: null.IntFrom(3), AbortOnAnomaly: null.BoolFrom(true)}
+		opts := Options{}.Apply(Options{AnomalyDetection: config})
+		assert.Equal(t, config, opts.AnomalyDetection)
+		assert.Empty(t, opts.Validate())
+		assert.Equal(t, time.Minute, config.GetWindow())
+		assert.Equal(t, 3, config.GetWindows())
+
+		opts.AnomalyDetection = &AnomalyDetectionConfig{
+			Window:            types.NullDurationFrom(-time.Second),
+			Windows:           null.IntFrom(1),
+			LatencyIncrease:   null.FloatFrom(0),
+			ErrorRateIncrease: null.FloatFrom(2),
+		}
+		assert.Len(t, opts.Validate(), 4)
+	})
+	t.Run("CollectorPeriod", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			CollectorPeriod:  types.NullDurationFrom(1 * time.Second),
+			CollectorPeriods: map[string]types.NullDuration{"json": types.NullDurationFrom(time.Minute)},
+		})
+		assert.Equal(t, types.NullDurationFrom(1*time.Second), opts.CollectorPeriod)
+		assert.Equal(t, types.NullDurationFrom(time.Minute), opts.CollectorPeriods["json"])
+		assert.Empty(t, opts.Validate())
+
+		opts.CollectorPeriod = types.NullDurationFrom(-1 * time.Second)
+		opts.CollectorPeriods["influxdb"] = types.NullDurationFrom(0)
+		assert.Len(t, opts.Validate(), 2)
+	})
+	t.Run("AggregationPeriod", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			AggregationPeriod:  types.NullDurationFrom(1 * time.Second),
+			AggregationPeriods: map[string]types.NullDuration{"json": types.NullDurationFrom(time.Minute)},
+		})
+		assert.Equal(t, types.NullDurationFrom(1*time.Second), opts.AggregationPeriod)
+		assert.Equal(t, types.NullDurationFrom(time.Minute), opts.AggregationPeriods["json"])
+		assert.Empty(t, opts.Validate())
+
+		opts.AggregationPeriod = types.NullDurationFrom(0)
+		opts.AggregationPeriods["influxdb"] = types.NullDurationFrom(-1 * time.Second)
+		assert.Len(t, opts.Validate(), 2)
+	})
+	t.Run("Relabel", func(t *testing.T) {
+		var opts Options
+		jsonStr := `{"relabel":{"statsd":[{"action":"rename","tag":"status","to":"code"},{"action":"drop","tag":"*_id"}],"influxdb":[{"action":"map","tag":"method","values":{"GET":"get"}}]}}`
+		require.NoError(t, json.Unmarshal([]byte(jsonStr), &opts))
+		opts = Options{}.Apply(opts)
+		assert.Equal(t, []stats.RelabelRule{
+			{Action: stats.RelabelRename, Tag: "status", To: "code"},
+			{Action: stats.RelabelDrop, Tag: "*_id"},
+		}, opts.Relabel["statsd"])
+		assert.Equal(t, map[string]string{"GET": "get"}, opts.Relabel["influxdb"][0].Values)
+		assert.Empty(t, opts.Validate())
+
+		opts.Relabel["json"] = []stats.RelabelRule{{Action: "hash", Tag: "url"}, {Action: stats.RelabelRename, Tag: "url"}}
+		errs := opts.Validate()
+		require.Len(t, errs, 2)
+		assert.EqualError(t, errs[0], "relabeling for 'json': the relabeling action for the tag 'url' must be 'rename', 'drop' or 'map', not 'hash'")
+	})
+	t.Run("FinalFlushTimeout", func(t *testing.T) {
+		opts := Options{}.Apply(Options{FinalFlushTimeout: types.NullDurationFrom(30 * time.Second)})
+		assert.Equal(t, types.NullDurationFrom(30*time.Second), opts.FinalFlushTimeout)
+		assert.Empty(t, opts.Validate())
+
+		opts.FinalFlushTimeout = types.NullDurationFrom(-1 * time.Second)
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("HappyEyeballs", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HappyEyeballs: types.NullDurationFrom(250 * time.Millisecond)})
+		assert.Equal(t, types.NullDurationFrom(250*time.Millisecond), opts.HappyEyeballs)
+		assert.Empty(t, opts.Validate())
+
+		opts.HappyEyeballs = types.NullDurationFrom(-1 * time.Second)
+		assert.Len(t, opts.Validate(), 1)
+	})
 	t.Run("External", func(t *testing.T) {
 		ext := map[string]json.RawMessage{"a": json.RawMessage("1")}
 		opts := Options{}.Apply(Options{External: ext})
@@ -384,7 +735,57 @@ func TestOptions(t *testing.T) {
 				assert.NoError(t, json.Unmarshal([]byte(jsonStr), &opts))
 				assert.Nil(t, opts.SystemTags)
 			})
+			t.Run("Relative", func(t *testing.T) {
+				var opts Options
+				jsonStr := `{"systemTags":["-url","-name","+ip"]}`
+				assert.NoError(t, json.Unmarshal([]byte(jsonStr), &opts))
+				assert.False(t, opts.SystemTags["url"])
+				assert.False(t, opts.SystemTags["name"])
+				assert.True(t, opts.SystemTags["ip"])
+				assert.True(t, opts.SystemTags["status"])
+				assert.Len(t, opts.SystemTags, len(DefaultSystemTagList)-1)
+			})
+		})
+		t.Run("Text", func(t *testing.T) {
+			var tags TagSet
+			assert.NoError(t, tags.UnmarshalText([]byte("url, +ip,-url")))
+			assert.Equal(t, GetTagSet("ip"), tags)
+
+			assert.NoError(t, tags.UnmarshalText([]byte("+vu, -error_code")))
+			assert.True(t, tags["vu"])
+			assert.True(t, tags["proto"])
+			assert.False(t, tags["error_code"])
 		})
+		t.Run("Validate", func(t *testing.T) {
+			opts := Options{SystemTags: ParseTagSet("+ip", "+ocsp_status", "-url")}
+			assert.Empty(t, opts.Validate())
+
+			opts.SystemTags = ParseTagSet("url", "urls")
+			errs := opts.Validate()
+			if assert.Len(t, errs, 1) {
+				assert.Contains(t, errs[0].Error(), "urls")
+			}
+		})
+	})
+	t.Run("SummaryHistogram", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SummaryHistogram: null.BoolFrom(true)})
+		assert.True(t, opts.SummaryHistogram.Valid)
+		assert.True(t, opts.SummaryHistogram.Bool)
+	})
+	t.Run("SummaryFilter", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SummaryFilter: null.StringFrom("scenario:checkout")})
+		assert.True(t, opts.SummaryFilter.Valid)
+		assert.Equal(t, "scenario:checkout", opts.SummaryFilter.String)
+	})
+	t.Run("SummaryCompare", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SummaryCompare: []string{"a", "b"}})
+		assert.Equal(t, []string{"a", "b"}, opts.SummaryCompare)
+		assert.Empty(t, opts.Validate())
+
+		for _, c := range [][]string{{"a"}, {"a", "a"}, {"a", "b", "c"}} {
+			opts.SummaryCompare = c
+			assert.Len(t, opts.Validate(), 1, c)
+		}
 	})
 	t.Run("SummaryTrendStats", func(t *testing.T) {
 		stats := []string{"myStat1", "myStat2"}
@@ -395,6 +796,67 @@ func TestOptions(t *testing.T) {
 		tags := stats.IntoSampleTags(&map[string]string{"myTag": "hello"})
 		opts := Options{}.Apply(Options{RunTags: tags})
 		assert.Equal(t, tags, opts.RunTags)
+		assert.Empty(t, opts.Validate())
+
+		opts.RunTags = tags.WithMultiTags(map[string][]string{"flags": {"a", "b"}})
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("TrendPrecision", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TrendPrecision: null.IntFrom(0)})
+		assert.Equal(t, null.IntFrom(0), opts.TrendPrecision)
+		assert.Empty(t, opts.Validate())
+
+		opts.TrendPrecision = null.IntFrom(6)
+		assert.Len(t, opts.Validate(), 1)
+	})
+	t.Run("TrendSinks", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TrendSinks: map[string]string{"*": "tdigest", "my_trend": "histogram"}})
+		assert.Equal(t, map[string]string{"*": "tdigest", "my_trend": "histogram"}, opts.TrendSinks)
+		assert.Empty(t, opts.Validate())
+
+		opts.TrendSinks = map[string]string{"my_trend": "exact", "[": "tdigest"}
+		assert.Len(t, opts.Validate(), 2)
+	})
+	t.Run("Variants", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			Variants: map[string]float64{"a": 1, "b": 0.5}, VariantsPer: null.StringFrom("iteration"),
+		})
+		assert.Equal(t, map[string]float64{"a": 1, "b": 0.5}, opts.Variants)
+		assert.Equal(t, null.StringFrom("iteration"), opts.VariantsPer)
+		assert.Empty(t, opts.Validate())
+
+		opts.Variants = map[string]float64{"a": 0, "b": -1, "c": math.Inf(1), "d": math.NaN()}
+		opts.VariantsPer = null.StringFrom("group")
+		assert.Len(t, opts.Validate(), 5)
+	})
+	t.Run("RedactTags", func(t *testing.T) {
+		opts := Options{}.Apply(Options{RedactTags: map[string]string{"url": "hash", "*token*": "strip"}})
+		assert.Equal(t, map[string]string{"url": "hash", "*token*": "strip"}, opts.RedactTags)
+		assert.Empty(t, opts.Validate())
+
+		opts.RedactTags = map[string]string{"url": "encrypt", "[": "strip"}
+		assert.Len(t, opts.Validate(), 2)
+	})
+	t.Run("RegionAndZone", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Region: null.StringFrom("eu-west"), Zone: null.StringFrom("b")})
+		assert.Equal(t, null.StringFrom("eu-west"), opts.Region)
+		assert.Equal(t, null.StringFrom("b"), opts.Zone)
+
+		opts.SystemTags = GetTagSet(DefaultSystemTagList...)
+		tags := opts.WithInstanceTags().RunTags
+		assert.Equal(t, map[string]string{"region": "eu-west", "zone": "b"}, tags.CloneTags())
+
+		opts.RunTags = stats.IntoSampleTags(&map[string]string{"region": "custom", "myTag": "hello"})
+		tags = opts.WithInstanceTags().RunTags
+		assert.Equal(t, map[string]string{"region": "custom", "zone": "b", "myTag": "hello"}, tags.CloneTags())
+
+		opts.SystemTags = GetTagSet("region")
+		opts.RunTags = nil
+		tags = opts.WithInstanceTags().RunTags
+		assert.Equal(t, map[string]string{"region": "eu-west"}, tags.CloneTags())
+
+		opts.SystemTags = GetTagSet("url")
+		assert.Nil(t, opts.WithInstanceTags().RunTags)
 	})
 	t.Run("DiscardResponseBodies", func(t *testing.T) {
 		opts := Options{}.Apply(Options{DiscardResponseBodies: null.BoolFrom(true)})
@@ -462,6 +924,19 @@ func TestOptionsEnv(t *testing.T) {
 			"true":  null.BoolFrom(true),
 			"false": null.BoolFrom(false),
 		},
+		{"HostMetrics", "K6_HOST_METRICS"}: {
+			"":      null.Bool{},
+			"true":  null.BoolFrom(true),
+			"false": null.BoolFrom(false),
+		},
+		{"Region", "K6_REGION"}: {
+			"":        null.String{},
+			"eu-west": null.StringFrom("eu-west"),
+		},
+		{"Zone", "K6_ZONE"}: {
+			"":  null.String{},
+			"b": null.StringFrom("b"),
+		},
 		{"UserAgent", "K6_USER_AGENT"}: {
 			"":    null.String{},
 			"Hi!": null.StringFrom("Hi!"),
@@ -476,6 +951,16 @@ func TestOptionsEnv(t *testing.T) {
 			"true":  null.BoolFrom(true),
 			"false": null.BoolFrom(false),
 		},
+		{"CollectorPeriod", "K6_COLLECTOR_PERIOD"}: {
+			"":   types.NullDuration{},
+			"1s": types.NullDurationFrom(1 * time.Second),
+		},
+		{"CollectorPeriods", "K6_COLLECTOR_PERIODS"}: {
+			"json:1m,influxdb:1s": map[string]types.NullDuration{
+				"json":     types.NullDurationFrom(time.Minute),
+				"influxdb": types.NullDurationFrom(1 * time.Second),
+			},
+		},
 		// Thresholds
 		// External
 	}
@@ -29,6 +29,7 @@ import (
 // Ensure mock implementations conform to the interfaces.
 var _ Runner = &MiniRunner{}
 var _ VU = &MiniRunnerVU{}
+var _ HealthCheckRunner = &MiniRunner{}
 
 // A Runner is a factory for VUs. It should precompute as much as possible upon creation (parse
 // ASTs, load files into memory, etc.), so that spawning VUs becomes as fast as possible.
@@ -68,6 +69,12 @@ type Runner interface {
 	SetOptions(opts Options) error
 }
 
+// MetricRegistryRunner is implemented by the runners that register the custom metrics of their
+// scripts, so the engine can check that the samples it gets don't shadow them.
+type MetricRegistryRunner interface {
+	GetMetricRegistry() *stats.Registry
+}
+
 // A VU is a Virtual User, that can be scheduled by an Executor.
 type VU interface {
 	// Runs the VU once. The VU is responsible for handling the Halting Problem, eg. making sure
@@ -79,12 +86,22 @@ type VU interface {
 	Reconfigure(id int64) error
 }
 
+// A ClosableVU is a VU that keeps resources across its iterations, like the connections that are
+// kept open for reuse. The executor closes it once the VU is discarded, which releases them.
+type ClosableVU interface {
+	VU
+	Close() error
+}
+
 // MiniRunner wraps a function in a runner whose VUs will simply call that function.
 type MiniRunner struct {
 	Fn         func(ctx context.Context, out chan<- stats.SampleContainer) error
 	SetupFn    func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error)
 	TeardownFn func(ctx context.Context, out chan<- stats.SampleContainer) error
 
+	// Called as the health check before the test, if set.
+	HealthCheckFn func(ctx context.Context) error
+
 	setupData []byte
 
 	Group   *Group
@@ -110,6 +127,14 @@ func (r *MiniRunner) Setup(ctx context.Context, out chan<- stats.SampleContainer
 	return
 }
 
+// HealthCheck calls HealthCheckFn, if there is one.
+func (r MiniRunner) HealthCheck(ctx context.Context) error {
+	if fn := r.HealthCheckFn; fn != nil {
+		return fn(ctx)
+	}
+	return nil
+}
+
 // GetSetupData returns json representation of the setup data if setup() is specified and run, nil otherwise
 func (r MiniRunner) GetSetupData() []byte {
 	return r.setupData
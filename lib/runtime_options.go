@@ -29,6 +29,25 @@ type RuntimeOptions struct {
 
 	// Environment variables passed onto the runner
 	Env map[string]string `json:"env" envconfig:"env"`
+
+	// Secrets resolved at run time; they are passed onto the runner like Env, but they are
+	// never saved in archives.
+	Secrets map[string]string `json:"-" ignored:"true"`
+
+	// The source that the secrets requested by scripts with the k6/secrets module are read
+	// from by default, e.g. "vault" or "aws".
+	SecretSource null.String `json:"-" ignored:"true"`
+
+	// The key used to encrypt and decrypt archives, see ParseArchiveKey.
+	ArchiveKey []byte `json:"-" ignored:"true"`
+
+	// The external commands that setup() and teardown() may run with the k6/exec module. It's
+	// only settable from the command line, so that scripts can't allow themselves to run anything.
+	ExecAllow []string `json:"-" ignored:"true"`
+
+	// The directory that teardown() can write files to with the k6/artifacts module. Like
+	// ExecAllow, it's only settable from the command line.
+	ArtifactsDir null.String `json:"-" ignored:"true"`
 }
 
 // Apply overwrites the receiver RuntimeOptions' fields with any that are set
@@ -40,5 +59,20 @@ func (o RuntimeOptions) Apply(opts RuntimeOptions) RuntimeOptions {
 	if opts.Env != nil {
 		o.Env = opts.Env
 	}
+	if opts.Secrets != nil {
+		o.Secrets = opts.Secrets
+	}
+	if opts.SecretSource.Valid {
+		o.SecretSource = opts.SecretSource
+	}
+	if opts.ArchiveKey != nil {
+		o.ArchiveKey = opts.ArchiveKey
+	}
+	if opts.ExecAllow != nil {
+		o.ExecAllow = opts.ExecAllow
+	}
+	if opts.ArtifactsDir.Valid {
+		o.ArtifactsDir = opts.ArtifactsDir
+	}
 	return o
 }
@@ -42,6 +42,7 @@ type BaseConfig struct {
 	IterationTimeout types.NullDuration `json:"iterationTimeout"`
 	Env              map[string]string  `json:"env"`
 	Exec             null.String        `json:"exec"` // function name, externally validated
+	RPS              null.Int           `json:"rps"`  // on top of the global rps option
 	Percentage       float64            `json:"-"`    // 100, unless Split() was called
 
 	//TODO: future extensions like tags, distribution, others?
@@ -76,6 +77,9 @@ func (bc BaseConfig) Validate() (errors []error) {
 	if bc.Exec.Valid && bc.Exec.String == "" {
 		errors = append(errors, fmt.Errorf("exec value cannot be empty"))
 	}
+	if bc.RPS.Valid && bc.RPS.Int64 <= 0 {
+		errors = append(errors, fmt.Errorf("the rps limit should be positive, but is %d", bc.RPS.Int64))
+	}
 	// The actually reasonable checks:
 	if bc.StartTime.Duration < 0 {
 		errors = append(errors, fmt.Errorf("scheduler start time can't be negative"))
@@ -87,6 +87,11 @@ var configMapTestCases = []configMapTestCase{
 	{`{"aname": {"type": "constant-looping-vus", "vus": 10, "duration": "10s", "startTime": "-10s"}}`, false, true, nil},
 	{`{"aname": {"type": "constant-looping-vus", "vus": 10, "duration": "10s", "exec": ""}}`, false, true, nil},
 	{`{"aname": {"type": "constant-looping-vus", "vus": 10, "duration": "10s", "iterationTimeout": "-2s"}}`, false, true, nil},
+	{`{"aname": {"type": "constant-looping-vus", "vus": 10, "duration": "10s", "rps": 0}}`, false, true, nil},
+	{`{"aname": {"type": "constant-looping-vus", "vus": 10, "duration": "10s", "rps": 50}}`,
+		false, false, func(t *testing.T, cm ConfigMap) {
+			assert.Equal(t, null.IntFrom(50), cm["aname"].GetBaseConfig().RPS)
+		}},
 
 	// variable-looping-vus
 	{`{"varloops": {"type": "variable-looping-vus", "startVUs": 20, "iterationTimeout": "15s",
@@ -0,0 +1,152 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "t0ken" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			_, _ = w.Write([]byte(`{"data": {"data": {"password": "hunter2", "port": 5432}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/api":
+			_, _ = w.Write([]byte(`{"data": {"value": "s3cr3t"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	vault := &VaultSource{Address: srv.URL, Token: "t0ken"}
+	for key, expected := range map[string]string{
+		"secret/data/db#password": "hunter2",
+		"secret/data/db#port":     "5432",
+		"/kv/api":                 "s3cr3t",
+	} {
+		value, err := vault.Get(key)
+		if assert.NoError(t, err, key) {
+			assert.Equal(t, expected, value, key)
+		}
+	}
+
+	_, err := vault.Get("secret/data/db#user")
+	assert.EqualError(t, err, "the secret doesn't have a 'user' field")
+	_, err = vault.Get("secret/data/missing")
+	assert.Error(t, err)
+	_, err = (&VaultSource{Address: srv.URL}).Get("kv/api")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unexpected response status 403")
+	}
+	_, err = (&VaultSource{}).Get("kv/api")
+	assert.EqualError(t, err, "the Vault address isn't configured, set VAULT_ADDR")
+}
+
+func TestAWSSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request")
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var input struct{ SecretId string } //nolint:golint
+		require.NoError(t, json.Unmarshal(body, &input))
+		switch input.SecretId {
+		case "prod/db":
+			_, _ = w.Write([]byte(`{"Name": "prod/db", "SecretString": "{\"password\": \"hunter2\"}"}`))
+		case "arn:aws:secretsmanager:eu-west-1:123456789012:secret:token":
+			_, _ = w.Write([]byte(`{"SecretString": "s3cr3t"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+		}
+	}))
+	defer srv.Close()
+
+	aws := &AWSSource{Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "SECRET", Endpoint: srv.URL}
+	for key, expected := range map[string]string{
+		"prod/db":          `{"password": "hunter2"}`,
+		"prod/db#password": "hunter2",
+		"arn:aws:secretsmanager:eu-west-1:123456789012:secret:token": "s3cr3t",
+	} {
+		value, err := aws.Get(key)
+		if assert.NoError(t, err, key) {
+			assert.Equal(t, expected, value, key)
+		}
+	}
+
+	_, err := aws.Get("missing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ResourceNotFoundException")
+	}
+	_, err = (&AWSSource{Region: "eu-west-1"}).Get("prod/db")
+	assert.Error(t, err)
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// The "get-vanilla" case from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	now, err := time.Parse("20060102T150405Z", "20150830T123600Z")
+	require.NoError(t, err)
+	signAWSRequest(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestStore(t *testing.T) {
+	calls := 0
+	RegisterSource("counting", SourceFunc(func(key string) (string, error) {
+		calls++
+		return "value-" + key, nil
+	}))
+
+	store := NewStore("counting")
+	for i := 0; i < 3; i++ {
+		value, err := store.Get("a", "")
+		require.NoError(t, err)
+		assert.Equal(t, "value-a", value)
+	}
+	assert.Equal(t, 1, calls)
+
+	_, err := store.Get("K6_TEST_MISSING_SECRET", "env")
+	assert.Error(t, err)
+
+	_, err = NewStore("").Get("a", "")
+	assert.EqualError(t, err, "no secret source is configured, use the --secret-source flag")
+}
@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package secrets resolves sensitive values, like passwords and API tokens, at run time from
+// pluggable sources, so they don't have to be stored in scripts, archives or the CLI history.
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Source resolves secrets by their key. What the key means is up to the source, e.g. the name
+// of an environment variable or the path of a file.
+type Source interface {
+	Get(key string) (string, error)
+}
+
+// SourceFunc is an adapter that allows using ordinary functions as secret sources.
+type SourceFunc func(key string) (string, error)
+
+// Get calls f(key).
+func (f SourceFunc) Get(key string) (string, error) {
+	return f(key)
+}
+
+//nolint:gochecknoglobals
+var (
+	sourcesMutex sync.RWMutex
+	sources      = map[string]Source{
+		"env":   SourceFunc(getEnv),
+		"file":  SourceFunc(getFile),
+		"vault": SourceFunc(func(key string) (string, error) { return NewVaultSourceFromEnv().Get(key) }),
+		"aws":   SourceFunc(func(key string) (string, error) { return NewAWSSourceFromEnv().Get(key) }),
+	}
+)
+
+// RegisterSource makes a secret source available under the given name. It panics if a source
+// with the same name is already registered.
+func RegisterSource(name string, src Source) {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+	if _, ok := sources[name]; ok {
+		panic("secret source '" + name + "' is already registered")
+	}
+	sources[name] = src
+}
+
+// Resolve returns the secret for a spec in the "source:key" format, e.g. "env:DB_PASSWORD" or
+// "file:/run/secrets/token".
+func Resolve(spec string) (string, error) {
+	idx := strings.IndexRune(spec, ':')
+	if idx <= 0 {
+		return "", errors.Errorf("invalid secret '%s', expected the 'source:key' format", spec)
+	}
+	name, key := spec[:idx], spec[idx+1:]
+
+	sourcesMutex.RLock()
+	src, ok := sources[name]
+	sourcesMutex.RUnlock()
+	if !ok {
+		return "", errors.Errorf("unknown secret source '%s'", name)
+	}
+
+	value, err := src.Get(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't get the '%s' secret from '%s'", key, name)
+	}
+	return value, nil
+}
+
+func getEnv(key string) (string, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", errors.Errorf("the environment variable '%s' isn't set", key)
+	}
+	return value, nil
+}
+
+// getFile returns the contents of a file, without a trailing newline, as most tools that write
+// secrets to files add one.
+func getFile(key string) (string, error) {
+	data, err := ioutil.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,78 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	require.NoError(t, os.Setenv("K6_TEST_SECRET", "hunter2"))
+	defer func() { _ = os.Unsetenv("K6_TEST_SECRET") }()
+
+	dir, err := ioutil.TempDir("", "k6-secrets")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	secretFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("s3cr3t\n"), 0600))
+
+	RegisterSource("test", SourceFunc(func(key string) (string, error) {
+		if key == "missing" {
+			return "", errors.New("no such secret")
+		}
+		return "test-" + key, nil
+	}))
+	assert.Panics(t, func() { RegisterSource("test", SourceFunc(nil)) })
+
+	testdata := map[string]string{
+		"env:K6_TEST_SECRET": "hunter2",
+		"file:" + secretFile: "s3cr3t",
+		"test:foo":           "test-foo",
+		"test:a:b":           "test-a:b",
+	}
+	for spec, expected := range testdata {
+		value, err := Resolve(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, expected, value, spec)
+		}
+	}
+
+	invalid := map[string]string{
+		"nope":                  "invalid secret 'nope'",
+		":key":                  "invalid secret ':key'",
+		"unknown:key":           "unknown secret source 'unknown'",
+		"env:K6_MISSING_SECRET": "couldn't get the 'K6_MISSING_SECRET' secret from 'env'",
+		"test:missing":          "couldn't get the 'missing' secret from 'test': no such secret",
+	}
+	for spec, msg := range invalid {
+		_, err := Resolve(spec)
+		if assert.Error(t, err, spec) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Store resolves the secrets that scripts request from a default source, and caches them for
+// the whole test, so that every VU doesn't hit the source again.
+type Store struct {
+	source string
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewStore returns a store that resolves secrets from the given default source; with an empty
+// source, only the secrets that explicitly specify their source can be resolved.
+func NewStore(source string) *Store {
+	return &Store{source: source, cache: make(map[string]string)}
+}
+
+// Get returns the secret with the given key from the source, or from the default one if the
+// source is empty.
+func (s *Store) Get(key, source string) (string, error) {
+	if source == "" {
+		source = s.source
+	}
+	if source == "" {
+		return "", errors.New("no secret source is configured, use the --secret-source flag")
+	}
+	spec := source + ":" + key
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.cache[spec]; ok {
+		return value, nil
+	}
+	value, err := Resolve(spec)
+	if err != nil {
+		return "", err
+	}
+	s.cache[spec] = value
+	return value, nil
+}
+
+type ctxKey int
+
+const ctxKeyStore ctxKey = iota
+
+// WithStore attaches a secret store to a context.
+func WithStore(ctx context.Context, store *Store) context.Context {
+	return context.WithValue(ctx, ctxKeyStore, store)
+}
+
+// GetStore returns the secret store attached to a context, or nil if there's none.
+func GetStore(ctx context.Context) *Store {
+	v := ctx.Value(ctxKeyStore)
+	if v == nil {
+		return nil
+	}
+	return v.(*Store)
+}
@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//nolint:gochecknoglobals
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// VaultSource reads secrets from the HashiCorp Vault HTTP API. The keys are in the "path#field"
+// format, e.g. "secret/data/db#password"; the field defaults to "value". Both the v1 and v2 KV
+// secret engines are supported.
+type VaultSource struct {
+	// The address of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+	// The token used to authenticate with Vault.
+	Token string
+	// The Vault Enterprise namespace, if any.
+	Namespace string
+}
+
+// NewVaultSourceFromEnv configures a VaultSource from the VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE environment variables, like the Vault CLI.
+func NewVaultSourceFromEnv() *VaultSource {
+	return &VaultSource{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+// Get implements the Source interface.
+func (v *VaultSource) Get(key string) (string, error) {
+	if v.Address == "" {
+		return "", errors.New("the Vault address isn't configured, set VAULT_ADDR")
+	}
+	path, field := splitSecretField(key, "value")
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(v.Address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	body, err := doSecretRequest(req)
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// The v2 KV engine nests the secret data together with its metadata
+	if nested, ok := data["data"]; ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", err
+			}
+		}
+	}
+	return secretField(data, field)
+}
+
+// splitSecretField splits a "name#field" key.
+func splitSecretField(key, defaultField string) (string, string) {
+	if idx := strings.LastIndex(key, "#"); idx != -1 {
+		return key[:idx], key[idx+1:]
+	}
+	return key, defaultField
+}
+
+func secretField(data map[string]json.RawMessage, field string) (string, error) {
+	raw, ok := data[field]
+	if !ok {
+		return "", errors.Errorf("the secret doesn't have a '%s' field", field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		// Not a string, so return the JSON representation of the value
+		return string(raw), nil
+	}
+	return value, nil
+}
+
+func doSecretRequest(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
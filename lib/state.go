@@ -23,14 +23,15 @@ package lib
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"time"
 
 	"github.com/loadimpact/k6/stats"
 	"github.com/oxtoacart/bpool"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
 )
 
 // DialContexter is an interface that can dial with a context
@@ -38,6 +39,12 @@ type DialContexter interface {
 	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
 }
 
+// The lifecycle stages that a VU can run the script in, apart from the iterations, see State.Stage.
+const (
+	StageSetup    = "setup"
+	StageTeardown = "teardown"
+)
+
 // State provides the volatile state for a VU.
 type State struct {
 	// Global options.
@@ -55,8 +62,13 @@ type State struct {
 	CookieJar *cookiejar.Jar
 	TLSConfig *tls.Config
 
-	// Rate limits.
-	RPSLimit *rate.Limiter
+	// Returns the TLS config for a hostname, which may differ from TLSConfig because of the
+	// tlsHosts and tlsAuth options. May be nil, in which case TLSConfig is used for all hosts.
+	HostTLSConfig func(hostname string) *tls.Config
+
+	// The transports of the connection pools in the connectionPools option, by name, for the
+	// requests that select one of them instead of Transport.
+	Pools map[string]http.RoundTripper
 
 	// Sample channel, possibly buffered
 	Samples chan<- stats.SampleContainer
@@ -66,4 +78,53 @@ type State struct {
 	BPool *bpool.BufferPool
 
 	Vu, Iteration int64
+
+	// Picks the requests that the chaos option injects faults into. It's per VU, so with the seed
+	// option the faults are reproducible for each VU. May be nil, in which case math/rand is used.
+	ChaosRand func() float64
+
+	// The random bits of the IDs that the k6/ids module generates. It's only set with the seed
+	// option, and like ChaosRand it's per VU, so the IDs are reproducible for each VU. May be nil,
+	// in which case crypto/rand is used.
+	IDsRand io.Reader
+
+	// What the modules keep for the VU across its iterations, like the connections that are kept
+	// open for reuse. May be nil, in which case nothing is kept.
+	Resources *VUResources
+
+	// The lifecycle stage that the VU runs the script in, StageSetup or StageTeardown, or empty
+	// for iterations. Unlike the group, the script can't change it.
+	Stage string
+
+	// Tags applied to all metrics emitted in the current iteration, on top of the global
+	// run tags, e.g. the scenario and stage the iteration was started in.
+	Tags map[string]string
+
+	// Sleeps like sleep(), but runs the background jobs of the jobs option that are due in the
+	// meantime. Nil if the VU doesn't have any jobs.
+	SleepWithJobs func(ctx context.Context, d time.Duration)
+
+	// The external commands that can be run with the k6/exec module, see RuntimeOptions.
+	ExecAllow []string
+
+	// The directory that files can be written to with the k6/artifacts module, see RuntimeOptions.
+	ArtifactsDir string
+
+	// Decides whether the responses of the HTTP requests are expected ones, for the
+	// expected_response tag and the http_req_failed metric. Nil disables both.
+	ResponseCallback ResponseCallback
+}
+
+// ResponseCallback returns whether an HTTP response with the given status is an expected one.
+// The status is 0 if the request failed without a response. It's called from the goroutines
+// of http.batch(), so it must be safe for concurrent use.
+type ResponseCallback func(status int) bool
+
+// CloneTags returns a copy of the global run tags, merged with the tags of the current iteration.
+func (s *State) CloneTags() map[string]string {
+	tags := s.Options.RunTags.CloneTags()
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	return tags
 }
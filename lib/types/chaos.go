@@ -0,0 +1,182 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// The kinds of client-side faults that can be injected into requests, which they're tagged with.
+const (
+	ChaosFail     = "fail"
+	ChaosDelay    = "delay"
+	ChaosTruncate = "truncate"
+)
+
+// DefaultChaosDelay is how long the delayed requests are delayed by, unless it's configured.
+const DefaultChaosDelay = 1 * time.Second
+
+// ChaosConfig controls the client-side faults that are injected into a share of the HTTP
+// requests, so dashboards and alerts can be checked without breaking the system under test.
+// Every request gets at most one fault, so the shares can't add up to more than 1.
+type ChaosConfig struct {
+	// The share of requests, between 0 and 1, that fail without being sent.
+	Fail null.Float `json:"fail"`
+	// The share of requests whose response arrives later, by DelayBy.
+	Delay   null.Float   `json:"delay"`
+	DelayBy NullDuration `json:"delayBy"`
+	// The share of requests whose response body is cut off after half of it.
+	Truncate null.Float `json:"truncate"`
+	// Whether any of the fields were set.
+	Valid bool `json:"-"`
+}
+
+// Apply overwrites the fields of the config with the ones that are set in the argument.
+func (c ChaosConfig) Apply(cfg ChaosConfig) ChaosConfig {
+	if cfg.Fail.Valid {
+		c.Fail = cfg.Fail
+	}
+	if cfg.Delay.Valid {
+		c.Delay = cfg.Delay
+	}
+	if cfg.DelayBy.Valid {
+		c.DelayBy = cfg.DelayBy
+	}
+	if cfg.Truncate.Valid {
+		c.Truncate = cfg.Truncate
+	}
+	c.Valid = c.Valid || cfg.Valid
+	return c
+}
+
+// Pick returns which fault should be injected into a request, for a random number in [0, 1), or
+// an empty string if the request shouldn't get any.
+func (c ChaosConfig) Pick(r float64) string {
+	switch {
+	case r < c.Fail.Float64:
+		return ChaosFail
+	case r < c.Fail.Float64+c.Delay.Float64:
+		return ChaosDelay
+	case r < c.Fail.Float64+c.Delay.Float64+c.Truncate.Float64:
+		return ChaosTruncate
+	default:
+		return ""
+	}
+}
+
+// GetDelay returns how long the delayed requests are delayed by.
+func (c ChaosConfig) GetDelay() time.Duration {
+	if c.DelayBy.Valid {
+		return time.Duration(c.DelayBy.Duration)
+	}
+	return DefaultChaosDelay
+}
+
+// Validate checks that all of the shares are between 0 and 1, and that they add up to at most 1.
+func (c ChaosConfig) Validate() []error {
+	var errs []error
+	names := []string{ChaosFail, ChaosDelay, ChaosTruncate}
+	for i, share := range []null.Float{c.Fail, c.Delay, c.Truncate} {
+		if share.Float64 < 0 || share.Float64 > 1 {
+			errs = append(errs, fmt.Errorf("the chaos %s share must be between 0 and 1, not %v", names[i], share.Float64))
+		}
+	}
+	if sum := c.Fail.Float64 + c.Delay.Float64 + c.Truncate.Float64; sum > 1 {
+		errs = append(errs, fmt.Errorf("the chaos shares can't add up to more than 1, not %v", sum))
+	}
+	if c.DelayBy.Valid && c.DelayBy.Duration < 0 {
+		errs = append(errs, fmt.Errorf("the chaos delay can't be negative, not %s", c.DelayBy.Duration))
+	}
+	return errs
+}
+
+// UnmarshalText parses the config from a "fail=0.01,delay=5%,delayBy=500ms,truncate=0.01"
+// string. The shares can be fractions or percentages.
+func (c *ChaosConfig) UnmarshalText(text []byte) error {
+	var cfg ChaosConfig
+	for _, pair := range strings.Split(string(text), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idx := strings.IndexRune(pair, '=')
+		if idx == -1 {
+			return fmt.Errorf("invalid chaos setting '%s', expected 'key=value'", pair)
+		}
+		key, value := pair[:idx], pair[idx+1:]
+		if key == "delayBy" {
+			if err := cfg.DelayBy.UnmarshalText([]byte(value)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		share, err := parseShare(value)
+		if err != nil {
+			return fmt.Errorf("invalid chaos %s share '%s'", key, value)
+		}
+		switch key {
+		case ChaosFail:
+			cfg.Fail = null.FloatFrom(share)
+		case ChaosDelay:
+			cfg.Delay = null.FloatFrom(share)
+		case ChaosTruncate:
+			cfg.Truncate = null.FloatFrom(share)
+		default:
+			return fmt.Errorf("unknown chaos setting '%s'", key)
+		}
+	}
+	cfg.Valid = true
+	*c = cfg
+	return nil
+}
+
+// UnmarshalJSON accepts either a JSON object or a string in the UnmarshalText format.
+func (c *ChaosConfig) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return c.UnmarshalText([]byte(text))
+	}
+	type chaosConfig ChaosConfig
+	if err := json.Unmarshal(data, (*chaosConfig)(c)); err != nil {
+		return err
+	}
+	c.Valid = c.Fail.Valid || c.Delay.Valid || c.DelayBy.Valid || c.Truncate.Valid
+	return nil
+}
+
+// parseShare parses a fraction like "0.05" or a percentage like "5%".
+func parseShare(s string) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		return percent / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
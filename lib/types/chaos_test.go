@@ -0,0 +1,93 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestChaosConfigUnmarshal(t *testing.T) {
+	expected := ChaosConfig{
+		Fail:     null.FloatFrom(0.01),
+		Delay:    null.FloatFrom(0.05),
+		DelayBy:  NullDurationFrom(500 * time.Millisecond),
+		Truncate: null.FloatFrom(0.02),
+		Valid:    true,
+	}
+
+	var fromText ChaosConfig
+	require.NoError(t, fromText.UnmarshalText([]byte("fail=1%, delay=0.05, delayBy=500ms, truncate=2%")))
+	assert.Equal(t, expected, fromText)
+
+	var fromObject, fromString ChaosConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"fail": 0.01, "delay": 0.05, "delayBy": "500ms", "truncate": 0.02}`), &fromObject))
+	assert.Equal(t, expected, fromObject)
+	require.NoError(t, json.Unmarshal([]byte(`"fail=1%,delay=5%,delayBy=500ms,truncate=0.02"`), &fromString))
+	assert.Equal(t, expected, fromString)
+
+	var invalid ChaosConfig
+	assert.EqualError(t, invalid.UnmarshalText([]byte("fail")), "invalid chaos setting 'fail', expected 'key=value'")
+	assert.EqualError(t, invalid.UnmarshalText([]byte("fail=lots")), "invalid chaos fail share 'lots'")
+	assert.EqualError(t, invalid.UnmarshalText([]byte("drop=1%")), "unknown chaos setting 'drop'")
+}
+
+func TestChaosConfigPick(t *testing.T) {
+	cfg := ChaosConfig{Fail: null.FloatFrom(0.1), Delay: null.FloatFrom(0.2), Truncate: null.FloatFrom(0.3)}
+	picks := map[float64]string{
+		0:    ChaosFail,
+		0.05: ChaosFail,
+		0.1:  ChaosDelay,
+		0.29: ChaosDelay,
+		0.31: ChaosTruncate,
+		0.59: ChaosTruncate,
+		0.61: "",
+		0.99: "",
+	}
+	for r, expected := range picks {
+		assert.Equal(t, expected, cfg.Pick(r), "%v", r)
+	}
+	assert.Equal(t, "", ChaosConfig{}.Pick(0))
+}
+
+func TestChaosConfigApplyAndValidate(t *testing.T) {
+	cfg := ChaosConfig{Fail: null.FloatFrom(0.1), Valid: true}.Apply(ChaosConfig{Delay: null.FloatFrom(0.2), Valid: true})
+	assert.Equal(t, null.FloatFrom(0.1), cfg.Fail)
+	assert.Equal(t, null.FloatFrom(0.2), cfg.Delay)
+	assert.True(t, cfg.Valid)
+	assert.Equal(t, DefaultChaosDelay, cfg.GetDelay())
+	assert.Empty(t, cfg.Validate())
+
+	cfg.DelayBy = NullDurationFrom(2 * time.Second)
+	assert.Equal(t, 2*time.Second, cfg.GetDelay())
+
+	invalid := ChaosConfig{
+		Fail:     null.FloatFrom(-0.1),
+		Delay:    null.FloatFrom(0.9),
+		Truncate: null.FloatFrom(1.5),
+		DelayBy:  NullDurationFrom(-time.Second),
+	}
+	assert.Len(t, invalid.Validate(), 4)
+}
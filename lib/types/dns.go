@@ -0,0 +1,209 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// The DNS selection strategies, i.e. which of the resolved IPs is used for a connection.
+const (
+	DNSFirst      = "first"
+	DNSRandom     = "random"
+	DNSRoundRobin = "roundRobin"
+)
+
+// The schemes of the URLs of the DNS servers, i.e. the protocols they're queried with.
+const (
+	DNSOverHTTPS = "https"
+	DNSOverTLS   = "tls"
+)
+
+// The DNS policies, i.e. which IP versions are used.
+const (
+	DNSPreferIPv4 = "preferIPv4"
+	DNSPreferIPv6 = "preferIPv6"
+	DNSOnlyIPv4   = "onlyIPv4"
+	DNSOnlyIPv6   = "onlyIPv6"
+	DNSAny        = "any"
+)
+
+// DNSConfig controls how hostnames are resolved.
+type DNSConfig struct {
+	// How long the resolved IPs are cached: a duration like "5m", "0" to disable the caching,
+	// or "inf" to cache them for the whole test.
+	TTL null.String `json:"ttl"`
+	// Which of the resolved IPs is used: "first", "random" or "roundRobin".
+	Select null.String `json:"select"`
+	// Which IP versions are used: "preferIPv4", "preferIPv6", "onlyIPv4", "onlyIPv6" or "any".
+	Policy null.String `json:"policy"`
+	// The server that resolves the hostnames instead of the system's resolver: a DNS-over-HTTPS
+	// URL like "https://1.1.1.1/dns-query", or a DNS-over-TLS one like "tls://1.1.1.1:853".
+	Server null.String `json:"server"`
+	// Whether any of the fields were set.
+	Valid bool `json:"-"`
+}
+
+// DefaultDNSConfig returns the settings that are used for the unset fields of a DNSConfig.
+func DefaultDNSConfig() DNSConfig {
+	return DNSConfig{
+		TTL:    null.NewString("5m", false),
+		Select: null.NewString(DNSRandom, false),
+		Policy: null.NewString(DNSPreferIPv4, false),
+	}
+}
+
+// Apply overwrites the fields of the config with the ones that are set in the argument.
+func (c DNSConfig) Apply(cfg DNSConfig) DNSConfig {
+	if cfg.TTL.Valid {
+		c.TTL = cfg.TTL
+	}
+	if cfg.Select.Valid {
+		c.Select = cfg.Select
+	}
+	if cfg.Policy.Valid {
+		c.Policy = cfg.Policy
+	}
+	if cfg.Server.Valid {
+		c.Server = cfg.Server
+	}
+	c.Valid = c.Valid || cfg.Valid
+	return c
+}
+
+// ParseTTL returns the caching duration; it's negative for an infinite one.
+func (c DNSConfig) ParseTTL() (time.Duration, error) {
+	switch c.TTL.String {
+	case "inf":
+		return -1, nil
+	case "0":
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(c.TTL.String)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid DNS TTL '%s', expected a duration, '0' or 'inf'", c.TTL.String)
+	}
+	return ttl, nil
+}
+
+// ParseServer returns the URL of the DNS server, or nil if the system's resolver is used. The
+// port of DNS-over-TLS servers defaults to 853.
+func (c DNSConfig) ParseServer() (*url.URL, error) {
+	if c.Server.String == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.Server.String)
+	if err != nil || u.Host == "" || (u.Scheme != DNSOverHTTPS && u.Scheme != DNSOverTLS) {
+		return nil, fmt.Errorf("invalid DNS server '%s', expected an %s:// or %s:// URL",
+			c.Server.String, DNSOverHTTPS, DNSOverTLS)
+	}
+	if u.Scheme == DNSOverTLS && u.Port() == "" {
+		u.Host += ":853"
+	}
+	return u, nil
+}
+
+// Validate checks that all of the set fields have valid values.
+func (c DNSConfig) Validate() []error {
+	var errs []error
+	if c.TTL.Valid {
+		if _, err := c.ParseTTL(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Select.Valid && !isOneOf(c.Select.String, DNSFirst, DNSRandom, DNSRoundRobin) {
+		errs = append(errs, fmt.Errorf("invalid DNS selection '%s', expected one of: %s, %s, %s",
+			c.Select.String, DNSFirst, DNSRandom, DNSRoundRobin))
+	}
+	if c.Policy.Valid && !isOneOf(c.Policy.String, DNSPreferIPv4, DNSPreferIPv6, DNSOnlyIPv4, DNSOnlyIPv6, DNSAny) {
+		errs = append(errs, fmt.Errorf("invalid DNS policy '%s', expected one of: %s, %s, %s, %s, %s",
+			c.Policy.String, DNSPreferIPv4, DNSPreferIPv6, DNSOnlyIPv4, DNSOnlyIPv6, DNSAny))
+	}
+	if _, err := c.ParseServer(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// UnmarshalText parses the config from a "ttl=5m,select=roundRobin,policy=any" string, which can
+// also have a server, e.g. "server=tls://1.1.1.1".
+func (c *DNSConfig) UnmarshalText(text []byte) error {
+	var cfg DNSConfig
+	for _, pair := range strings.Split(string(text), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idx := strings.IndexRune(pair, '=')
+		if idx == -1 {
+			return fmt.Errorf("invalid DNS setting '%s', expected 'key=value'", pair)
+		}
+		key, value := pair[:idx], pair[idx+1:]
+		switch key {
+		case "ttl":
+			cfg.TTL = null.StringFrom(value)
+		case "select":
+			cfg.Select = null.StringFrom(value)
+		case "policy":
+			cfg.Policy = null.StringFrom(value)
+		case "server":
+			cfg.Server = null.StringFrom(value)
+		default:
+			return fmt.Errorf("unknown DNS setting '%s'", key)
+		}
+	}
+	cfg.Valid = true
+	*c = cfg
+	return nil
+}
+
+// UnmarshalJSON accepts either a JSON object or a string in the UnmarshalText format.
+func (c *DNSConfig) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return c.UnmarshalText([]byte(text))
+	}
+	type dnsConfig DNSConfig
+	if err := json.Unmarshal(data, (*dnsConfig)(c)); err != nil {
+		return err
+	}
+	c.Valid = c.TTL.Valid || c.Select.Valid || c.Policy.Valid || c.Server.Valid
+	return nil
+}
+
+func isOneOf(s string, values ...string) bool {
+	for _, value := range values {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
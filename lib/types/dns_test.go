@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestDNSConfigUnmarshal(t *testing.T) {
+	expected := DNSConfig{
+		TTL:    null.StringFrom("1m"),
+		Select: null.StringFrom(DNSRoundRobin),
+		Valid:  true,
+	}
+
+	var fromText DNSConfig
+	require.NoError(t, fromText.UnmarshalText([]byte("ttl=1m, select=roundRobin")))
+	assert.Equal(t, expected, fromText)
+
+	var fromObject, fromString DNSConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"ttl": "1m", "select": "roundRobin"}`), &fromObject))
+	assert.Equal(t, expected, fromObject)
+	require.NoError(t, json.Unmarshal([]byte(`"ttl=1m,select=roundRobin"`), &fromString))
+	assert.Equal(t, expected, fromString)
+
+	var invalid DNSConfig
+	assert.EqualError(t, invalid.UnmarshalText([]byte("ttl")), "invalid DNS setting 'ttl', expected 'key=value'")
+	assert.EqualError(t, invalid.UnmarshalText([]byte("cache=1m")), "unknown DNS setting 'cache'")
+}
+
+func TestDNSConfigApplyAndValidate(t *testing.T) {
+	cfg := DefaultDNSConfig().Apply(DNSConfig{Policy: null.StringFrom(DNSOnlyIPv6), Valid: true})
+	assert.Equal(t, "5m", cfg.TTL.String)
+	assert.Equal(t, DNSRandom, cfg.Select.String)
+	assert.Equal(t, null.StringFrom(DNSOnlyIPv6), cfg.Policy)
+	assert.True(t, cfg.Valid)
+	assert.Empty(t, cfg.Validate())
+
+	ttls := map[string]time.Duration{"inf": -1, "0": 0, "5m": 5 * time.Minute, "1.5s": 1500 * time.Millisecond}
+	for s, expected := range ttls {
+		ttl, err := DNSConfig{TTL: null.StringFrom(s)}.ParseTTL()
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, ttl, s)
+		}
+	}
+
+	invalid := DNSConfig{
+		TTL:    null.StringFrom("-1s"),
+		Select: null.StringFrom("last"),
+		Policy: null.StringFrom("ipv4"),
+		Server: null.StringFrom("udp://8.8.8.8"),
+	}
+	assert.Len(t, invalid.Validate(), 4)
+}
+
+func TestDNSConfigServer(t *testing.T) {
+	testdata := map[string]string{
+		"":                                       "",
+		"https://1.1.1.1/dns-query":              "https://1.1.1.1/dns-query",
+		"https://dns.example.com:8443/dns-query": "https://dns.example.com:8443/dns-query",
+		"tls://1.1.1.1":                          "tls://1.1.1.1:853",
+		"tls://dns.example.com:8853":             "tls://dns.example.com:8853",
+	}
+	for server, expected := range testdata {
+		u, err := DNSConfig{Server: null.StringFrom(server)}.ParseServer()
+		require.NoError(t, err, server)
+		if expected == "" {
+			assert.Nil(t, u)
+		} else {
+			assert.Equal(t, expected, u.String())
+		}
+	}
+
+	for _, server := range []string{"8.8.8.8", "udp://8.8.8.8:53", "https:///dns-query", "://"} {
+		_, err := DNSConfig{Server: null.StringFrom(server)}.ParseServer()
+		assert.Error(t, err, server)
+	}
+
+	var cfg DNSConfig
+	require.NoError(t, cfg.UnmarshalText([]byte("ttl=0,server=tls://1.1.1.1")))
+	assert.Equal(t, null.StringFrom("tls://1.1.1.1"), cfg.Server)
+	require.NoError(t, json.Unmarshal([]byte(`{"server": "https://1.1.1.1/dns-query"}`), &cfg))
+	assert.True(t, cfg.Valid)
+	assert.Equal(t, null.StringFrom("https://1.1.1.1/dns-query"), cfg.Server)
+}
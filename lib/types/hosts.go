@@ -0,0 +1,113 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// HostAddress is an IP address with an optional port, used to override the DNS resolution of a
+// host. A zero port means that the port of the request is used.
+type HostAddress struct {
+	IP   net.IP
+	Port int
+}
+
+// ParseHostAddress parses an "ip" or an "ip:port" string, like "10.0.0.1:8080" or "[::1]:80".
+func ParseHostAddress(s string) (HostAddress, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return HostAddress{IP: ip}, nil
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return HostAddress{}, fmt.Errorf("invalid host address '%s', expected 'ip' or 'ip:port'", s)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return HostAddress{}, fmt.Errorf("invalid IP '%s' in the host address '%s'", host, s)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return HostAddress{}, fmt.Errorf("invalid port '%s' in the host address '%s'", portStr, s)
+	}
+	return HostAddress{IP: ip, Port: port}, nil
+}
+
+// String returns the address in the format accepted by ParseHostAddress.
+func (h HostAddress) String() string {
+	if h.Port == 0 {
+		return h.IP.String()
+	}
+	return net.JoinHostPort(h.IP.String(), strconv.Itoa(h.Port))
+}
+
+// MarshalJSON converts the address to a JSON string.
+func (h HostAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+// UnmarshalJSON parses the address from a JSON string.
+func (h *HostAddress) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	addr, err := ParseHostAddress(s)
+	if err != nil {
+		return err
+	}
+	*h = addr
+	return nil
+}
+
+// HostAddresses are all of the addresses for a host; connections to the host are distributed
+// between them in a round-robin fashion.
+type HostAddresses []HostAddress
+
+// MarshalJSON converts a single address to a JSON string and multiple ones to an array.
+func (h HostAddresses) MarshalJSON() ([]byte, error) {
+	if len(h) == 1 {
+		return json.Marshal(h[0])
+	}
+	return json.Marshal([]HostAddress(h))
+}
+
+// UnmarshalJSON accepts either a single address string or an array of them.
+func (h *HostAddresses) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var addrs []HostAddress
+		if err := json.Unmarshal(data, &addrs); err != nil {
+			return err
+		}
+		*h = addrs
+		return nil
+	}
+	var addr HostAddress
+	if err := json.Unmarshal(data, &addr); err != nil {
+		return err
+	}
+	*h = HostAddresses{addr}
+	return nil
+}
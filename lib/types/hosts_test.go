@@ -0,0 +1,78 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostAddress(t *testing.T) {
+	valid := map[string]HostAddress{
+		"10.0.0.1":          {IP: net.ParseIP("10.0.0.1")},
+		"10.0.0.1:8080":     {IP: net.ParseIP("10.0.0.1"), Port: 8080},
+		"::1":               {IP: net.ParseIP("::1")},
+		"[2001:db8::1]:443": {IP: net.ParseIP("2001:db8::1"), Port: 443},
+	}
+	for s, expected := range valid {
+		addr, err := ParseHostAddress(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, addr, s)
+			assert.Equal(t, s, addr.String())
+		}
+	}
+
+	invalid := []string{"", "example.com", "example.com:80", "10.0.0.1:0", "10.0.0.1:65536", "10.0.0.1:http"}
+	for _, s := range invalid {
+		_, err := ParseHostAddress(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHostAddressesJSON(t *testing.T) {
+	var hosts map[string]HostAddresses
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"a.example.com": "10.0.0.1",
+		"b.example.com": "10.0.0.2:8080",
+		"c.example.com": ["10.0.0.3", "10.0.0.4:8443"]
+	}`), &hosts))
+	assert.Equal(t, map[string]HostAddresses{
+		"a.example.com": {{IP: net.ParseIP("10.0.0.1")}},
+		"b.example.com": {{IP: net.ParseIP("10.0.0.2"), Port: 8080}},
+		"c.example.com": {{IP: net.ParseIP("10.0.0.3")}, {IP: net.ParseIP("10.0.0.4"), Port: 8443}},
+	}, hosts)
+
+	data, err := json.Marshal(hosts)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"a.example.com": "10.0.0.1",
+		"b.example.com": "10.0.0.2:8080",
+		"c.example.com": ["10.0.0.3", "10.0.0.4:8443"]
+	}`, string(data))
+
+	var addrs HostAddresses
+	assert.Error(t, json.Unmarshal([]byte(`"nope"`), &addrs))
+	assert.Error(t, json.Unmarshal([]byte(`["10.0.0.1", 5]`), &addrs))
+}
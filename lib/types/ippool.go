@@ -0,0 +1,187 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// IPRange is an inclusive range of IP addresses of the same family.
+type IPRange struct {
+	First, Last net.IP
+}
+
+// ParseIPRange parses a single IP ("10.0.0.1"), a range of IPs ("10.0.0.1-10.0.0.20") or a
+// CIDR block ("10.0.0.0/24").
+func ParseIPRange(s string) (IPRange, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		ip, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return IPRange{}, fmt.Errorf("invalid CIDR block '%s'", s)
+		}
+		first := normalizeIP(ip.Mask(ipnet.Mask))
+		last := make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^ipnet.Mask[len(ipnet.Mask)-len(first)+i]
+		}
+		return IPRange{First: first, Last: last}, nil
+	}
+
+	parts := strings.SplitN(s, "-", 2)
+	first := normalizeIP(net.ParseIP(strings.TrimSpace(parts[0])))
+	last := first
+	if len(parts) == 2 {
+		last = normalizeIP(net.ParseIP(strings.TrimSpace(parts[1])))
+	}
+	if first == nil || last == nil {
+		return IPRange{}, fmt.Errorf("invalid IP range '%s', expected 'ip', 'ip-ip' or a CIDR block", s)
+	}
+	if len(first) != len(last) {
+		return IPRange{}, fmt.Errorf("the IPs in the range '%s' are not of the same family", s)
+	}
+	if bytes.Compare(first, last) > 0 {
+		return IPRange{}, fmt.Errorf("the first IP in the range '%s' is after the last one", s)
+	}
+	return IPRange{First: first, Last: last}, nil
+}
+
+// Size returns the number of addresses in the range.
+func (r IPRange) Size() *big.Int {
+	size := new(big.Int).Sub(new(big.Int).SetBytes(r.Last), new(big.Int).SetBytes(r.First))
+	return size.Add(size, big.NewInt(1))
+}
+
+// String returns the range in the format accepted by ParseIPRange.
+func (r IPRange) String() string {
+	if r.First.Equal(r.Last) {
+		return r.First.String()
+	}
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// normalizeIP returns the 4-byte form of IPv4 addresses, so they can be compared byte-wise.
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// IPPool is a list of IP ranges that can be indexed as a single sequence of addresses.
+type IPPool []IPRange
+
+// ParseIPPool parses a comma-separated list of the ranges accepted by ParseIPRange.
+func ParseIPPool(s string) (IPPool, error) {
+	var pool IPPool
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		r, err := ParseIPRange(part)
+		if err != nil {
+			return nil, err
+		}
+		pool = append(pool, r)
+	}
+	return pool, nil
+}
+
+// Size returns the total number of addresses in the pool.
+func (p IPPool) Size() *big.Int {
+	size := new(big.Int)
+	for _, r := range p {
+		size.Add(size, r.Size())
+	}
+	return size
+}
+
+// Get returns the n-th address of the pool, wrapping around when n is bigger than its size.
+// It returns nil for an empty pool.
+func (p IPPool) Get(n uint64) net.IP {
+	size := p.Size()
+	if size.Sign() == 0 {
+		return nil
+	}
+	offset := new(big.Int).Mod(new(big.Int).SetUint64(n), size)
+	for _, r := range p {
+		rSize := r.Size()
+		if offset.Cmp(rSize) < 0 {
+			ip := offset.Add(offset, new(big.Int).SetBytes(r.First)).Bytes()
+			res := make(net.IP, len(r.First))
+			copy(res[len(res)-len(ip):], ip)
+			return res
+		}
+		offset.Sub(offset, rSize)
+	}
+	return nil
+}
+
+// String returns the pool in the format accepted by ParseIPPool.
+func (p IPPool) String() string {
+	parts := make([]string, len(p))
+	for i, r := range p {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalJSON converts the pool to a JSON string.
+func (p IPPool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON parses the pool from a comma-separated JSON string or an array of strings.
+func (p *IPPool) UnmarshalJSON(data []byte) error {
+	var list []string
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+	} else {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		list = []string{s}
+	}
+	pool, err := ParseIPPool(strings.Join(list, ","))
+	if err != nil {
+		return err
+	}
+	*p = pool
+	return nil
+}
+
+// UnmarshalText parses the pool from a comma-separated list, like the K6_LOCAL_IPS variable.
+func (p *IPPool) UnmarshalText(data []byte) error {
+	pool, err := ParseIPPool(string(data))
+	if err != nil {
+		return err
+	}
+	*p = pool
+	return nil
+}
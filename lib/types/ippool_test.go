@@ -0,0 +1,87 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPRange(t *testing.T) {
+	testdata := map[string]IPRange{
+		"10.0.0.1":             {net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.1").To4()},
+		" 10.0.0.1 - 10.0.1.1": {net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.1.1").To4()},
+		"10.0.0.0/30":          {net.ParseIP("10.0.0.0").To4(), net.ParseIP("10.0.0.3").To4()},
+		"10.0.0.7/30":          {net.ParseIP("10.0.0.4").To4(), net.ParseIP("10.0.0.7").To4()},
+		"fd00::1-fd00::ff":     {net.ParseIP("fd00::1"), net.ParseIP("fd00::ff")},
+		"fd00::/120":           {net.ParseIP("fd00::"), net.ParseIP("fd00::ff")},
+	}
+	for s, expected := range testdata {
+		r, err := ParseIPRange(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, r, s)
+	}
+
+	for _, s := range []string{"", "10.0.0", "10.0.0.1-", "10.0.0.2-10.0.0.1", "10.0.0.1-fd00::1", "10.0.0.0/33"} {
+		_, err := ParseIPRange(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestIPPool(t *testing.T) {
+	pool, err := ParseIPPool("10.0.0.1-10.0.0.2, 192.168.0.0/31,fd00::1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), pool.Size().Int64())
+	assert.Equal(t, "10.0.0.1-10.0.0.2,192.168.0.0-192.168.0.1,fd00::1", pool.String())
+
+	expected := []string{"10.0.0.1", "10.0.0.2", "192.168.0.0", "192.168.0.1", "fd00::1", "10.0.0.1"}
+	for i, ip := range expected {
+		assert.Equal(t, ip, pool.Get(uint64(i)).String())
+	}
+	assert.Nil(t, IPPool{}.Get(0))
+
+	big, err := ParseIPPool("fd00::/64")
+	require.NoError(t, err)
+	assert.Equal(t, "fd00::ffff:ffff:ffff:ffff", big.Get(1<<64-1).String())
+
+	_, err = ParseIPPool("10.0.0.1,nope")
+	assert.Error(t, err)
+}
+
+func TestIPPoolJSON(t *testing.T) {
+	var pool IPPool
+	require.NoError(t, json.Unmarshal([]byte(`"10.0.0.1-10.0.0.2"`), &pool))
+	assert.Equal(t, int64(2), pool.Size().Int64())
+
+	require.NoError(t, json.Unmarshal([]byte(`["10.0.0.1", "10.0.1.0/24"]`), &pool))
+	assert.Equal(t, int64(257), pool.Size().Int64())
+
+	data, err := json.Marshal(pool)
+	require.NoError(t, err)
+	assert.Equal(t, `"10.0.0.1,10.0.1.0-10.0.1.255"`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`"nope"`), &pool))
+	assert.Error(t, json.Unmarshal([]byte(`1`), &pool))
+}
@@ -0,0 +1,77 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"math"
+	"sort"
+)
+
+// The ways experiment variants can be assigned, see the variantsPer option.
+const (
+	// VariantsPerVU keeps every VU in the same variant for the whole test.
+	VariantsPerVU = "vu"
+	// VariantsPerIteration assigns a variant to every single iteration.
+	VariantsPerIteration = "iteration"
+)
+
+// The fractional part of the golden ratio. The fractional parts of its multiples are spread out
+// evenly over [0, 1), whatever their number.
+const goldenRatioFrac = 0.6180339887498949
+
+// A VariantAssigner splits VUs or iterations between experiment variants in the proportions of
+// their weights, e.g. for A/B tests of two versions of a system.
+type VariantAssigner struct {
+	names  []string
+	bounds []float64 // The upper bounds of the variants in [0, 1), in the order of names.
+}
+
+// NewVariantAssigner returns an assigner for the given variant weights, or nil if there are none.
+func NewVariantAssigner(weights map[string]float64) *VariantAssigner {
+	if len(weights) == 0 {
+		return nil
+	}
+	a := &VariantAssigner{}
+	var total float64
+	for name, weight := range weights {
+		a.names = append(a.names, name)
+		total += weight
+	}
+	sort.Strings(a.names)
+	var sum float64
+	for _, name := range a.names {
+		sum += weights[name]
+		a.bounds = append(a.bounds, sum/total)
+	}
+	return a
+}
+
+// Assign returns the variant of the nth VU or iteration, counting from 0. The assignment is the
+// same in every test run, and any number of consecutive VUs or iterations is split close to the
+// proportions of the weights, not just a large number of them.
+func (a *VariantAssigner) Assign(n int64) string {
+	_, f := math.Modf(float64(n) * goldenRatioFrac)
+	for i, bound := range a.bounds {
+		if f < bound {
+			return a.names[i]
+		}
+	}
+	return a.names[len(a.names)-1]
+}
@@ -0,0 +1,46 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantAssigner(t *testing.T) {
+	assert.Nil(t, NewVariantAssigner(nil))
+
+	a := NewVariantAssigner(map[string]float64{"control": 3, "new": 1})
+	for _, n := range []int{4, 20, 100, 1000} {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			counts[a.Assign(int64(i))]++
+		}
+		assert.InDelta(t, float64(n)*0.75, counts["control"], 1+float64(n)*0.02, "%d assignments", n)
+		assert.Equal(t, n, counts["control"]+counts["new"])
+	}
+
+	b := NewVariantAssigner(map[string]float64{"new": 1, "control": 3})
+	for i := int64(0); i < 100; i++ {
+		assert.Equal(t, a.Assign(i), b.Assign(i))
+	}
+	assert.Equal(t, "only", NewVariantAssigner(map[string]float64{"only": 1}).Assign(7))
+}
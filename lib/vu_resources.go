@@ -0,0 +1,74 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// VUResources are what the modules keep for a VU across its iterations, like the connections that
+// are kept open for reuse, by the name of the module. The VU closes them once it's discarded.
+type VUResources struct {
+	mutex     sync.Mutex
+	resources map[string]io.Closer
+}
+
+// NewVUResources returns an empty VUResources.
+func NewVUResources() *VUResources {
+	return &VUResources{resources: make(map[string]io.Closer)}
+}
+
+// Get returns the resource of the module, creating it with newResource if there's none.
+func (r *VUResources) Get(module string, newResource func() io.Closer) io.Closer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	res, ok := r.resources[module]
+	if !ok {
+		res = newResource()
+		r.resources[module] = res
+	}
+	return res
+}
+
+// Close closes and forgets all of the resources, in the order of the module names, and returns
+// the first error. The modules can create them again afterwards.
+func (r *VUResources) Close() error {
+	r.mutex.Lock()
+	resources := r.resources
+	r.resources = make(map[string]io.Closer)
+	r.mutex.Unlock()
+
+	modules := make([]string, 0, len(resources))
+	for module := range resources {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	var firstErr error
+	for _, module := range modules {
+		if err := resources[module].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
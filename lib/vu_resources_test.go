@@ -0,0 +1,65 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestVUResources(t *testing.T) {
+	r := NewVUResources()
+	var closed []string
+	newResource := func(name string, err error) func() io.Closer {
+		return func() io.Closer {
+			return closerFunc(func() error {
+				closed = append(closed, name)
+				return err
+			})
+		}
+	}
+
+	a := r.Get("a", newResource("a", nil))
+	assert.NotNil(t, a)
+	r.Get("a", func() io.Closer {
+		t.Error("the resource shouldn't be created again")
+		return nil
+	})
+	r.Get("c", newResource("c", errors.New("c failed")))
+	r.Get("b", newResource("b", errors.New("b failed")))
+
+	assert.EqualError(t, r.Close(), "b failed")
+	assert.Equal(t, []string{"a", "b", "c"}, closed)
+
+	assert.NoError(t, r.Close())
+	assert.Len(t, closed, 3)
+
+	r.Get("a", newResource("a2", nil))
+	assert.NoError(t, r.Close())
+	assert.Equal(t, []string{"a", "b", "c", "a2"}, closed)
+}
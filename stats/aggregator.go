@@ -0,0 +1,156 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package stats
+
+import (
+	"sort"
+	"time"
+)
+
+// AggregationTag is added to the aggregated samples of an Aggregator, with the name of the value
+// that the sample holds: "sum" for counters, "last" for gauges, "rate" for rates, and "count",
+// "min", "max", "avg", "med", "p(90)", "p(95)" or "p(99)" for trends.
+const AggregationTag = "aggregation"
+
+// The aggregated values of trend metrics, in the order they're emitted in.
+var aggregatedTrendStats = []struct {
+	name string
+	get  func(t *TrendSink) float64
+}{
+	{"count", func(t *TrendSink) float64 { return float64(t.Count) }},
+	{"min", func(t *TrendSink) float64 { return t.Min }},
+	{"max", func(t *TrendSink) float64 { return t.Max }},
+	{"avg", func(t *TrendSink) float64 { return t.Avg }},
+	{"med", func(t *TrendSink) float64 { return t.Med }},
+	{"p(90)", func(t *TrendSink) float64 { return t.P(0.90) }},
+	{"p(95)", func(t *TrendSink) float64 { return t.P(0.95) }},
+	{"p(99)", func(t *TrendSink) float64 { return t.P(0.99) }},
+}
+
+// An Aggregator buckets samples into fixed time intervals, and summarizes every series in a
+// bucket, i.e. the samples of the same metric with the same tags, in one aggregated sample, or a
+// few for trends. That way the outputs only have to handle a handful of samples per series and
+// interval, no matter how many requests a test makes. Sample metadata isn't aggregated.
+type Aggregator struct {
+	Period time.Duration
+
+	buckets map[int64]map[aggregatedKey]*aggregatedSeries
+}
+
+type aggregatedKey struct {
+	metric *Metric
+	tags   string
+}
+
+type aggregatedSeries struct {
+	metric *Metric
+	tags   *SampleTags
+	sink   Sink
+}
+
+// NewAggregator returns an aggregator with buckets of the given period.
+func NewAggregator(period time.Duration) *Aggregator {
+	return &Aggregator{Period: period, buckets: make(map[int64]map[aggregatedKey]*aggregatedSeries)}
+}
+
+// Add adds the samples of the sample containers to their buckets.
+func (a *Aggregator) Add(sampleContainers []SampleContainer) {
+	for _, sc := range sampleContainers {
+		for _, s := range sc.GetSamples() {
+			a.add(s)
+		}
+	}
+}
+
+func (a *Aggregator) add(s Sample) {
+	start := s.Time.UnixNano() - s.Time.UnixNano()%int64(a.Period)
+	bucket := a.buckets[start]
+	if bucket == nil {
+		bucket = make(map[aggregatedKey]*aggregatedSeries)
+		a.buckets[start] = bucket
+	}
+	key := aggregatedKey{metric: s.Metric}
+	if s.Tags != nil {
+		key.tags = s.Tags.key
+	}
+	series := bucket[key]
+	if series == nil {
+		series = &aggregatedSeries{metric: s.Metric, tags: s.Tags, sink: New("", s.Metric.Type).Sink}
+		bucket[key] = series
+	}
+	series.sink.Add(s)
+}
+
+// Flush removes the buckets that end before the given time, or all of them if it's zero, and
+// returns their aggregated samples, timestamped with the start of their buckets. The buckets are
+// flushed in order, but the order of the series in a bucket isn't defined.
+func (a *Aggregator) Flush(before time.Time) []SampleContainer {
+	var starts []int64
+	for start := range a.buckets {
+		if before.IsZero() || start+int64(a.Period) <= before.UnixNano() {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var samples Samples
+	for _, start := range starts {
+		t := time.Unix(0, start)
+		for _, series := range a.buckets[start] {
+			samples = series.aggregate(t, samples)
+		}
+		delete(a.buckets, start)
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	return []SampleContainer{samples}
+}
+
+// aggregate appends the aggregated samples of the series to samples.
+func (s *aggregatedSeries) aggregate(t time.Time, samples Samples) Samples {
+	// CloneTags() would join the values of the multi-value tags, so only the normal tags are
+	// copied, and the multi-value ones are added back as they are.
+	multi := s.tags.CloneMultiTags()
+	sample := func(aggregation string, value float64) Sample {
+		tags := map[string]string{AggregationTag: aggregation}
+		if s.tags != nil {
+			for k, v := range s.tags.tags {
+				tags[k] = v
+			}
+		}
+		return Sample{Metric: s.metric, Time: t, Tags: IntoSampleTags(&tags).WithMultiTags(multi), Value: value}
+	}
+
+	switch sink := s.sink.(type) {
+	case *CounterSink:
+		return append(samples, sample("sum", sink.Value))
+	case *GaugeSink:
+		return append(samples, sample("last", sink.Value))
+	case *RateSink:
+		return append(samples, sample("rate", float64(sink.Trues)/float64(sink.Total)))
+	case *TrendSink:
+		sink.Calc()
+		for _, stat := range aggregatedTrendStats {
+			samples = append(samples, sample(stat.name, stat.get(sink)))
+		}
+	}
+	return samples
+}
@@ -0,0 +1,104 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	counter, gauge := New("my_counter", Counter), New("my_gauge", Gauge)
+	rate, trend := New("my_rate", Rate), New("my_trend", Trend, Time)
+	tagsA := IntoSampleTags(&map[string]string{"name": "a"})
+	tagsB := IntoSampleTags(&map[string]string{"name": "b"})
+	start := time.Unix(100, 0)
+
+	a := NewAggregator(time.Second)
+	var samples Samples
+	for i := 0; i < 20; i++ {
+		// 16 samples in the first second and 4 in the next one.
+		at := start.Add(time.Duration(i) * 66 * time.Millisecond)
+		samples = append(samples,
+			Sample{Metric: counter, Time: at, Tags: tagsA, Value: 2},
+			Sample{Metric: counter, Time: at, Tags: IntoSampleTags(&map[string]string{"name": "b"}), Value: 1},
+			Sample{Metric: gauge, Time: at, Value: float64(i)},
+			Sample{Metric: rate, Time: at, Tags: tagsA, Value: float64(i % 3)},
+			Sample{Metric: trend, Time: at, Tags: tagsB, Value: float64(i + 1)},
+		)
+	}
+	a.Add([]SampleContainer{samples})
+
+	assert.Nil(t, a.Flush(start.Add(999*time.Millisecond)))
+	flushed := a.Flush(start.Add(time.Second))
+	require.Len(t, flushed, 1)
+	first := map[string]float64{}
+	for _, s := range flushed[0].GetSamples() {
+		assert.Equal(t, start, s.Time)
+		tags := s.Tags.CloneTags()
+		first[s.Metric.Name+"/"+tags["name"]+"/"+tags[AggregationTag]] = s.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"my_counter/a/sum": 32, "my_counter/b/sum": 16,
+		"my_gauge//last":   15,
+		"my_rate/a/rate":   0.625,
+		"my_trend/b/count": 16, "my_trend/b/min": 1, "my_trend/b/max": 16, "my_trend/b/avg": 8.5,
+		"my_trend/b/med": 8.5, "my_trend/b/p(90)": 14.5, "my_trend/b/p(95)": 15.25, "my_trend/b/p(99)": 15.85,
+	}, roundValues(first))
+
+	rest := a.Flush(time.Time{})
+	require.Len(t, rest, 1)
+	assert.Len(t, rest[0].GetSamples(), 1+1+1+1+len(aggregatedTrendStats))
+	for _, s := range rest[0].GetSamples() {
+		assert.Equal(t, start.Add(time.Second), s.Time)
+	}
+	assert.Nil(t, a.Flush(time.Time{}))
+}
+
+func TestAggregatorMultiTags(t *testing.T) {
+	counter := New("my_counter", Counter)
+	tags := IntoSampleTags(&map[string]string{"name": "a"}).WithMultiTags(map[string][]string{"flags": {"y", "x"}})
+	start := time.Unix(100, 0)
+
+	a := NewAggregator(time.Second)
+	a.Add([]SampleContainer{Samples{
+		Sample{Metric: counter, Time: start, Tags: tags, Value: 1},
+		Sample{Metric: counter, Time: start.Add(time.Millisecond), Tags: tags, Value: 2},
+	}})
+	flushed := a.Flush(time.Time{})
+	require.Len(t, flushed, 1)
+	samples := flushed[0].GetSamples()
+	require.Len(t, samples, 1)
+	assert.Equal(t, float64(3), samples[0].Value)
+	assert.Equal(t, map[string][]string{"flags": {"x", "y"}}, samples[0].Tags.CloneMultiTags())
+	assert.Equal(t, map[string]string{"name": "a", AggregationTag: "sum", "flags": "x" + MultiTagSeparator + "y"},
+		samples[0].Tags.CloneTags())
+	assert.True(t, samples[0].Tags.Contains(IntoSampleTags(&map[string]string{"flags": "x"})))
+}
+
+func roundValues(values map[string]float64) map[string]float64 {
+	for k, v := range values {
+		values[k] = float64(int64(v*1e6+0.5)) / 1e6
+	}
+	return values
+}
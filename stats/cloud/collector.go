@@ -326,6 +326,7 @@ func (c *Collector) aggregateHTTPTrails(waitPeriod time.Duration) {
 				if trailTags.IsEqual(sbTags) {
 					subBucketKey = sbTags
 					subBucket = sb
+					break
 				}
 			}
 		}
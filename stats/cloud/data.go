@@ -127,23 +127,31 @@ type SampleDataMap struct {
 // NewSampleFromTrail just creates a ready-to-send Sample instance
 // directly from a httpext.Trail.
 func NewSampleFromTrail(trail *httpext.Trail) *Sample {
+	values := map[string]float64{
+		metrics.HTTPReqs.Name:        1,
+		metrics.HTTPReqDuration.Name: stats.D(trail.Duration),
+
+		metrics.HTTPReqBlocked.Name:        stats.D(trail.Blocked),
+		metrics.HTTPReqConnecting.Name:     stats.D(trail.Connecting),
+		metrics.HTTPReqTLSHandshaking.Name: stats.D(trail.TLSHandshaking),
+		metrics.HTTPReqSending.Name:        stats.D(trail.Sending),
+		metrics.HTTPReqWaiting.Name:        stats.D(trail.Waiting),
+		metrics.HTTPReqReceiving.Name:      stats.D(trail.Receiving),
+	}
+	if trail.Failed.Valid {
+		values[metrics.HTTPReqFailed.Name] = 0
+		if trail.Failed.Bool {
+			values[metrics.HTTPReqFailed.Name] = 1
+		}
+	}
+
 	return &Sample{
 		Type:   DataTypeMap,
 		Metric: "http_req_li_all",
 		Data: &SampleDataMap{
-			Time: Timestamp(trail.GetTime()),
-			Tags: trail.GetTags(),
-			Values: map[string]float64{
-				metrics.HTTPReqs.Name:        1,
-				metrics.HTTPReqDuration.Name: stats.D(trail.Duration),
-
-				metrics.HTTPReqBlocked.Name:        stats.D(trail.Blocked),
-				metrics.HTTPReqConnecting.Name:     stats.D(trail.Connecting),
-				metrics.HTTPReqTLSHandshaking.Name: stats.D(trail.TLSHandshaking),
-				metrics.HTTPReqSending.Name:        stats.D(trail.Sending),
-				metrics.HTTPReqWaiting.Name:        stats.D(trail.Waiting),
-				metrics.HTTPReqReceiving.Name:      stats.D(trail.Receiving),
-			},
+			Time:   Timestamp(trail.GetTime()),
+			Tags:   trail.GetTags(),
+			Values: values,
 		},
 	}
 }
@@ -162,6 +170,7 @@ type SampleDataAggregatedHTTPReqs struct {
 		Sending        AggregatedMetric `json:"http_req_sending"`
 		Waiting        AggregatedMetric `json:"http_req_waiting"`
 		Receiving      AggregatedMetric `json:"http_req_receiving"`
+		Failed         *AggregatedRate  `json:"http_req_failed,omitempty"`
 	} `json:"values"`
 }
 
@@ -175,6 +184,12 @@ func (sdagg *SampleDataAggregatedHTTPReqs) Add(trail *httpext.Trail) {
 	sdagg.Values.Sending.Add(trail.Sending)
 	sdagg.Values.Waiting.Add(trail.Waiting)
 	sdagg.Values.Receiving.Add(trail.Receiving)
+	if trail.Failed.Valid {
+		if sdagg.Values.Failed == nil {
+			sdagg.Values.Failed = &AggregatedRate{}
+		}
+		sdagg.Values.Failed.Add(trail.Failed.Bool)
+	}
 }
 
 // CalcAverages calculates and sets all `Avg` properties in the `Values` struct
@@ -189,6 +204,21 @@ func (sdagg *SampleDataAggregatedHTTPReqs) CalcAverages() {
 	sdagg.Values.Receiving.Calc(count)
 }
 
+// AggregatedRate is used to store the aggregated values of a rate metric, i.e. how many values
+// there were and how many of them were non-zero.
+type AggregatedRate struct {
+	Count   float64 `json:"count"`
+	NzCount float64 `json:"nz_count"`
+}
+
+// Add adds a value to the rate.
+func (ar *AggregatedRate) Add(nonZero bool) {
+	ar.Count++
+	if nonZero {
+		ar.NzCount++
+	}
+}
+
 // AggregatedMetric is used to store aggregated information for a
 // particular metric in an SampleDataAggregatedMap.
 type AggregatedMetric struct {
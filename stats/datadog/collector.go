@@ -27,11 +27,22 @@ import (
 
 type tagHandler lib.TagSet
 
-func (t tagHandler) processTags(tags map[string]string) []string {
+// processTags converts the tags that aren't blacklisted to the DogStatsD format. Multi-value tags
+// are sent as one "key:value" pair per value, since DogStatsD allows repeating tag keys.
+func (t tagHandler) processTags(tags map[string]string, multiTags map[string][]string) []string {
 	var res []string
 
 	for key, value := range tags {
-		if value != "" && !t[key] {
+		if t[key] {
+			continue
+		}
+		if values, ok := multiTags[key]; ok {
+			for _, value := range values {
+				res = append(res, key+":"+value)
+			}
+			continue
+		}
+		if value != "" {
 			res = append(res, key+":"+value)
 		}
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/statsd/common"
 	"github.com/loadimpact/k6/stats/statsd/common/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,7 +26,7 @@ func TestCollector(t *testing.T) {
 		for i, container := range containers {
 			for j, sample := range container.GetSamples() {
 				var (
-					expectedTagList    = handler.processTags(sample.GetTags().CloneTags())
+					expectedTagList    = handler.processTags(sample.GetTags().CloneTags(), sample.GetTags().CloneMultiTags())
 					expectedOutputLine = expectedOutputLines[i*j+i]
 					outputLine         = outputLines[i*j+i]
 					outputWithoutTags  = outputLine
@@ -43,3 +44,13 @@ func TestCollector(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessTags(t *testing.T) {
+	handler := tagHandler(lib.GetTagSet("vu"))
+	tags := stats.IntoSampleTags(&map[string]string{"vu": "1", "url": "http://example.com", "empty": ""}).
+		WithMultiTags(map[string][]string{"flags": {"b", "a"}})
+	assert.ElementsMatch(t,
+		[]string{"url:http://example.com", "flags:a", "flags:b"},
+		handler.processTags(tags.CloneTags(), tags.CloneMultiTags()),
+	)
+}
@@ -0,0 +1,177 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// DefaultTrendPrecision is the number of significant decimal digits that the trend metrics of a
+// test keep by default, see HDRHistogram.
+const DefaultTrendPrecision = 3
+
+// MaxTrendPrecision is the highest supported precision of an HDRHistogram.
+const MaxTrendPrecision = 5
+
+// The offset that keeps the bucket indexes of all positive float64 exponents above zero.
+const hdrExponentOffset = 1100
+
+// An HDRHistogram is a high dynamic range histogram of float64 values. Every power of two is split
+// into enough linear sub-buckets to keep the configured number of significant decimal digits, so
+// its size only depends on the range of the values and not on their number, and the percentiles
+// computed from it are within half a unit of the last significant digit of the exact ones.
+type HDRHistogram struct {
+	Precision int              `json:"precision"`
+	Buckets   map[int64]uint64 `json:"buckets"`
+
+	subBuckets int64
+	keys       []int64 // The bucket keys, sorted by the values of the buckets.
+}
+
+// NewHDRHistogram returns an empty histogram with the given number of significant decimal digits,
+// which is clamped between 1 and MaxTrendPrecision.
+func NewHDRHistogram(precision int) *HDRHistogram {
+	h := &HDRHistogram{Precision: precision, Buckets: make(map[int64]uint64)}
+	h.init()
+	return h
+}
+
+func (h *HDRHistogram) init() {
+	if h.Precision < 1 {
+		h.Precision = 1
+	} else if h.Precision > MaxTrendPrecision {
+		h.Precision = MaxTrendPrecision
+	}
+	// Enough sub-buckets to tell apart all values with Precision significant digits.
+	h.subBuckets = 1
+	for limit := math.Pow10(h.Precision); float64(h.subBuckets) < limit; {
+		h.subBuckets *= 2
+	}
+
+	if h.Buckets == nil {
+		h.Buckets = make(map[int64]uint64)
+	}
+	h.keys = make([]int64, 0, len(h.Buckets))
+	for key := range h.Buckets {
+		h.keys = append(h.keys, key)
+	}
+	sort.Slice(h.keys, func(i, j int) bool { return h.keys[i] < h.keys[j] })
+}
+
+// UnmarshalJSON restores a histogram that was serialized with json.Marshal().
+func (h *HDRHistogram) UnmarshalJSON(data []byte) error {
+	type plain HDRHistogram
+	if err := json.Unmarshal(data, (*plain)(h)); err != nil {
+		return err
+	}
+	h.init()
+	return nil
+}
+
+// key returns the key of the bucket for v. Keys are ordered the same way as the values of their
+// buckets: zero has the key 0, and positive and negative values have positive and negative keys.
+func (h *HDRHistogram) key(v float64) int64 {
+	if v == 0 || math.IsNaN(v) {
+		return 0
+	}
+	frac, exp := math.Frexp(math.Abs(v)) // frac is in [0.5, 1)
+	sub := int64((frac - 0.5) * 2 * float64(h.subBuckets))
+	if sub >= h.subBuckets {
+		sub = h.subBuckets - 1
+	}
+	key := (int64(exp)+hdrExponentOffset)*h.subBuckets + sub + 1
+	if v < 0 {
+		return -key
+	}
+	return key
+}
+
+// value returns the value in the middle of the bucket with the given key.
+func (h *HDRHistogram) value(key int64) float64 {
+	if key == 0 {
+		return 0
+	}
+	abs := key
+	if abs < 0 {
+		abs = -abs
+	}
+	exp := (abs-1)/h.subBuckets - hdrExponentOffset
+	sub := (abs - 1) % h.subBuckets
+	frac := 0.5 + (float64(sub)+0.5)/(2*float64(h.subBuckets))
+	v := math.Ldexp(frac, int(exp))
+	if key < 0 {
+		return -v
+	}
+	return v
+}
+
+// Add records a single value.
+func (h *HDRHistogram) Add(v float64) {
+	if h.subBuckets == 0 {
+		h.init()
+	}
+	h.addCount(h.key(v), 1)
+}
+
+// Merge adds all of the values recorded by another histogram with the same precision.
+func (h *HDRHistogram) Merge(other *HDRHistogram) {
+	if h.subBuckets == 0 {
+		h.init()
+	}
+	for key, count := range other.Buckets {
+		h.addCount(key, count)
+	}
+}
+
+func (h *HDRHistogram) addCount(key int64, count uint64) {
+	if _, ok := h.Buckets[key]; !ok {
+		i := sort.Search(len(h.keys), func(i int) bool { return h.keys[i] >= key })
+		h.keys = append(h.keys, 0)
+		copy(h.keys[i+1:], h.keys[i:])
+		h.keys[i] = key
+	}
+	h.Buckets[key] += count
+}
+
+// ValueAt returns the value of the element with the given 0-based rank, when all recorded values
+// are sorted. The last value is returned if the rank is past the end.
+func (h *HDRHistogram) ValueAt(rank uint64) float64 {
+	var seen uint64
+	for _, key := range h.keys {
+		seen += h.Buckets[key]
+		if rank < seen {
+			return h.value(key)
+		}
+	}
+	if len(h.keys) == 0 {
+		return 0
+	}
+	return h.value(h.keys[len(h.keys)-1])
+}
+
+// ForEach calls fn with the value and the number of values of every non-empty bucket, in order.
+func (h *HDRHistogram) ForEach(fn func(value float64, count uint64)) {
+	for _, key := range h.keys {
+		fn(h.value(key), h.Buckets[key])
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHDRHistogram(t *testing.T) {
+	values := []float64{0, -1.5, 3, 1000, 0.00123, 3, 1e9, -250}
+	for precision := 1; precision <= MaxTrendPrecision; precision++ {
+		h := NewHDRHistogram(precision)
+		for _, v := range values {
+			h.Add(v)
+		}
+
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+		maxErr := 0.5 * math.Pow10(-precision)
+		for i, v := range sorted {
+			got := h.ValueAt(uint64(i))
+			assert.InDelta(t, v, got, math.Abs(v)*maxErr, "precision %d, rank %d", precision, i)
+		}
+		assert.Equal(t, h.ValueAt(uint64(len(values)-1)), h.ValueAt(100))
+
+		var total uint64
+		h.ForEach(func(value float64, count uint64) { total += count })
+		assert.Equal(t, uint64(len(values)), total)
+	}
+
+	assert.Equal(t, 1, NewHDRHistogram(-1).Precision)
+	assert.Equal(t, MaxTrendPrecision, NewHDRHistogram(10).Precision)
+	assert.Equal(t, 0.0, NewHDRHistogram(3).ValueAt(0))
+}
+
+func TestHDRHistogramJSON(t *testing.T) {
+	h := NewHDRHistogram(2)
+	for _, v := range []float64{5, 1, 3} {
+		h.Add(v)
+	}
+	data, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	var restored HDRHistogram
+	require.NoError(t, json.Unmarshal(data, &restored))
+	restored.Add(2)
+	for rank, expected := range []float64{1, 2, 3, 5} {
+		assert.InDelta(t, expected, restored.ValueAt(uint64(rank)), expected*0.005)
+	}
+}
+
+func TestTrendSinkHistogram(t *testing.T) {
+	assert.Nil(t, NewTrendSink(0).Histogram)
+
+	exact, hdr := NewTrendSink(0), NewTrendSink(DefaultTrendPrecision)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		s := Sample{Value: r.ExpFloat64() * 200}
+		exact.Add(s)
+		hdr.Add(s)
+	}
+	assert.Nil(t, hdr.Values)
+	assert.True(t, len(hdr.Histogram.Buckets) < 10000)
+
+	exactStats, hdrStats := exact.Format(0), hdr.Format(0)
+	for _, stat := range []string{"min", "max", "avg"} {
+		assert.Equal(t, exactStats[stat], hdrStats[stat], stat)
+	}
+	for _, stat := range []string{"med", "p(90)", "p(95)"} {
+		assert.InEpsilon(t, exactStats[stat], hdrStats[stat], 0.001, stat)
+	}
+	assert.Equal(t, exact.Max, hdr.P(1))
+	assert.Equal(t, exact.Min, hdr.P(0))
+
+	one := NewTrendSink(DefaultTrendPrecision)
+	one.Add(Sample{Value: 7.123456})
+	assert.Equal(t, 7.123456, one.P(0.5))
+	one.Calc()
+	assert.Equal(t, 7.123456, one.Med)
+}
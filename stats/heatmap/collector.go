@@ -0,0 +1,247 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package heatmap writes a time vs. value heatmap of a trend metric (http_req_duration by
+// default) at the end of the test, which reveals patterns like queueing that the percentiles
+// of the whole test hide.
+package heatmap
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// The supported output formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+	FormatPNG  = "png"
+)
+
+// The precision of the histograms that keep the values of every time column.
+const columnPrecision = 3
+
+// Heatmap is a bucketed matrix of the number of values of a metric per time column and value row.
+type Heatmap struct {
+	Metric   string         `json:"metric"`
+	Start    time.Time      `json:"start"`
+	Interval types.Duration `json:"interval"`
+	// The upper bounds of the value rows, in ascending order.
+	Buckets []float64 `json:"buckets"`
+	// The number of values in every row of every column, as Counts[column][row].
+	Counts [][]uint64 `json:"counts"`
+}
+
+// Collector implements the lib.Collector interface and writes the heatmap of the configured
+// metric to a file once the test is done.
+type Collector struct {
+	fs     afero.Fs
+	fname  string
+	format string
+	config Config
+
+	mu       sync.Mutex
+	start    time.Time
+	columns  map[int64]*stats.HDRHistogram
+	min, max float64
+	count    uint64
+}
+
+// Verify that Collector implements lib.Collector
+var _ lib.Collector = &Collector{}
+
+// New returns a collector that writes the heatmap to the given file.
+func New(fs afero.Fs, fname string, config Config) (*Collector, error) {
+	if fname == "" {
+		return nil, errors.New("the heatmap output needs a file name, e.g. heatmap=latency.html")
+	}
+	format := strings.ToLower(config.Format.String)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fname)), ".")
+	}
+	switch format {
+	case FormatJSON, FormatCSV, FormatHTML, FormatPNG:
+	default:
+		return nil, errors.Errorf("unsupported heatmap format '%s', use json, csv, html or png", format)
+	}
+	if config.Interval.Duration <= 0 {
+		return nil, errors.Errorf("the heatmap interval must be positive, not %s", config.Interval.Duration)
+	}
+	if config.Buckets.Int64 < 1 {
+		return nil, errors.Errorf("the heatmap needs at least 1 bucket, not %d", config.Buckets.Int64)
+	}
+
+	return &Collector{
+		fs:      fs,
+		fname:   fname,
+		format:  format,
+		config:  config,
+		columns: make(map[int64]*stats.HDRHistogram),
+	}, nil
+}
+
+// Init does nothing, it's only included to satisfy the lib.Collector interface
+func (c *Collector) Init() error { return nil }
+
+// Run waits until the test is done and writes the heatmap.
+func (c *Collector) Run(ctx context.Context) {
+	<-ctx.Done()
+	if err := c.write(); err != nil {
+		log.WithError(err).WithField("filename", c.fname).Error("Heatmap: Couldn't write the heatmap")
+	}
+}
+
+// Collect adds the values of the configured metric to their time columns.
+func (c *Collector) Collect(scs []stats.SampleContainer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interval := time.Duration(c.config.Interval.Duration)
+	for _, sc := range scs {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric.Name != c.config.Metric.String {
+				continue
+			}
+			if c.start.IsZero() {
+				c.start = sample.Time.Truncate(interval)
+			}
+			column := int64(math.Floor(float64(sample.Time.Sub(c.start)) / float64(interval)))
+			h := c.columns[column]
+			if h == nil {
+				h = stats.NewHDRHistogram(columnPrecision)
+				c.columns[column] = h
+			}
+			h.Add(sample.Value)
+
+			c.count++
+			if sample.Value < c.min || c.count == 1 {
+				c.min = sample.Value
+			}
+			if sample.Value > c.max || c.count == 1 {
+				c.max = sample.Value
+			}
+		}
+	}
+}
+
+// Heatmap returns the heatmap of the values collected so far.
+func (c *Collector) Heatmap() *Heatmap {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interval := time.Duration(c.config.Interval.Duration)
+	hm := &Heatmap{
+		Metric:   c.config.Metric.String,
+		Interval: types.Duration(interval),
+		Buckets:  bucketBounds(c.min, c.max, int(c.config.Buckets.Int64)),
+	}
+	if len(c.columns) == 0 {
+		return hm
+	}
+
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	for column := range c.columns {
+		if column < first {
+			first = column
+		}
+		if column > last {
+			last = column
+		}
+	}
+	hm.Start = c.start.Add(time.Duration(first) * interval)
+	hm.Counts = make([][]uint64, last-first+1)
+	for i := range hm.Counts {
+		counts := make([]uint64, len(hm.Buckets))
+		if h := c.columns[first+int64(i)]; h != nil {
+			h.ForEach(func(value float64, count uint64) {
+				row := sort.SearchFloat64s(hm.Buckets, value)
+				if row >= len(counts) {
+					row = len(counts) - 1
+				}
+				counts[row] += count
+			})
+		}
+		hm.Counts[i] = counts
+	}
+	return hm
+}
+
+// bucketBounds returns the upper bounds of n value rows between min and max. They are spread
+// logarithmically if all values are positive, since latencies usually have a long tail.
+func bucketBounds(min, max float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		f := float64(i+1) / float64(n)
+		if min > 0 {
+			bounds[i] = min * math.Pow(max/min, f)
+		} else {
+			bounds[i] = min + (max-min)*f
+		}
+	}
+	// Don't let rounding errors push the max value out of the last row.
+	bounds[n-1] = max
+	return bounds
+}
+
+func (c *Collector) write() error {
+	f, err := c.fs.Create(c.fname)
+	if err != nil {
+		return err
+	}
+	hm := c.Heatmap()
+	switch c.format {
+	case FormatJSON:
+		err = writeJSON(f, hm)
+	case FormatCSV:
+		err = writeCSV(f, hm)
+	case FormatHTML:
+		err = writeHTML(f, hm)
+	case FormatPNG:
+		err = writePNG(f, hm)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Link returns an empty string, as there's nothing to link to
+func (c *Collector) Link() string { return "" }
+
+// GetRequiredSystemTags returns which sample tags are needed by this collector
+func (c *Collector) GetRequiredSystemTags() lib.TagSet {
+	return lib.TagSet{} // There are no required tags for this collector
+}
+
+// SetRunStatus does nothing, it's only included to satisfy the lib.Collector interface
+func (c *Collector) SetRunStatus(status lib.RunStatus) {}
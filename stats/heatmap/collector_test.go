@@ -0,0 +1,138 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package heatmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func newTestCollector(t *testing.T, fs afero.Fs, fname string) *Collector {
+	config := NewConfig().Apply(Config{Buckets: null.IntFrom(3)})
+	c, err := New(fs, fname, config)
+	require.NoError(t, err)
+	start := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	other := stats.New("other", stats.Trend)
+	c.Collect([]stats.SampleContainer{
+		stats.Sample{Metric: metrics.HTTPReqDuration, Time: start.Add(100 * time.Millisecond), Value: 1},
+		stats.Sample{Metric: metrics.HTTPReqDuration, Time: start.Add(200 * time.Millisecond), Value: 100},
+		stats.Samples{
+			{Metric: metrics.HTTPReqDuration, Time: start.Add(2500 * time.Millisecond), Value: 10},
+			{Metric: metrics.HTTPReqDuration, Time: start.Add(2600 * time.Millisecond), Value: 11},
+			{Metric: other, Time: start.Add(5 * time.Second), Value: 1000},
+		},
+	})
+	return c
+}
+
+func TestNew(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, fname := range []string{"a.json", "a.CSV", "a.html", "a.png"} {
+		_, err := New(fs, fname, NewConfig())
+		assert.NoError(t, err, fname)
+	}
+	_, err := New(fs, "a.txt", NewConfig().Apply(Config{Format: null.StringFrom("json")}))
+	assert.NoError(t, err)
+
+	for name, data := range map[string]struct {
+		fname  string
+		config Config
+	}{
+		"no file":     {"", NewConfig()},
+		"bad format":  {"a.txt", NewConfig()},
+		"no buckets":  {"a.json", NewConfig().Apply(Config{Buckets: null.IntFrom(0)})},
+		"no interval": {"a.json", NewConfig().Apply(Config{Interval: types.NullDurationFrom(0)})},
+	} {
+		_, err := New(fs, data.fname, data.config)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	hm := newTestCollector(t, afero.NewMemMapFs(), "a.json").Heatmap()
+	assert.Equal(t, metrics.HTTPReqDuration.Name, hm.Metric)
+	assert.Equal(t, time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC), hm.Start)
+	assert.Equal(t, types.Duration(time.Second), hm.Interval)
+	require.Len(t, hm.Buckets, 3)
+	assert.InDelta(t, 4.642, hm.Buckets[0], 0.001)
+	assert.InDelta(t, 21.544, hm.Buckets[1], 0.001)
+	assert.Equal(t, 100.0, hm.Buckets[2])
+	assert.Equal(t, [][]uint64{{1, 0, 1}, {0, 0, 0}, {0, 2, 0}}, hm.Counts)
+
+	empty, err := New(afero.NewMemMapFs(), "a.json", NewConfig())
+	require.NoError(t, err)
+	assert.Empty(t, empty.Heatmap().Counts)
+}
+
+func TestWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, fname := range []string{"/a.json", "/a.csv", "/a.html", "/a.png"} {
+		c := newTestCollector(t, fs, fname)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c.Run(ctx)
+	}
+
+	data, err := afero.ReadFile(fs, "/a.json")
+	require.NoError(t, err)
+	var hm Heatmap
+	require.NoError(t, json.Unmarshal(data, &hm))
+	assert.Equal(t, [][]uint64{{1, 0, 1}, {0, 0, 0}, {0, 2, 0}}, hm.Counts)
+
+	data, err = afero.ReadFile(fs, "/a.csv")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "time,le_4.642,le_21.54,le_100", lines[0])
+	assert.Equal(t, "2019-01-01T10:00:00Z,1,0,1", lines[1])
+	assert.Equal(t, "2019-01-01T10:00:02Z,0,2,0", lines[3])
+
+	data, err = afero.ReadFile(fs, "/a.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<h1>http_req_duration</h1>")
+	assert.Equal(t, 3, strings.Count(string(data), "<tr>"))
+	assert.Contains(t, string(data), `title="2019-01-01T10:00:02Z: 2"`)
+
+	data, err = afero.ReadFile(fs, "/a.png")
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 3*pngCellSize, img.Bounds().Dx())
+	assert.Equal(t, 3*pngCellSize, img.Bounds().Dy())
+	// The fullest cell is in the middle row of the last column.
+	r, g, b, _ := img.At(2*pngCellSize, pngCellSize).RGBA()
+	assert.Equal(t, []uint32{128, 0, 0}, []uint32{r >> 8, g >> 8, b >> 8})
+	r, g, b, _ = img.At(pngCellSize, pngCellSize).RGBA()
+	assert.Equal(t, []uint32{255, 255, 255}, []uint32{r >> 8, g >> 8, b >> 8})
+}
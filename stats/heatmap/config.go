@@ -0,0 +1,68 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package heatmap
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Config is the config for the heatmap collector.
+type Config struct {
+	// The trend metric that the heatmap is drawn for.
+	Metric null.String `json:"metric" envconfig:"HEATMAP_METRIC"`
+	// The width of the time columns of the heatmap.
+	Interval types.NullDuration `json:"interval" envconfig:"HEATMAP_INTERVAL"`
+	// The number of value rows of the heatmap, which are spread logarithmically between the
+	// smallest and the largest value.
+	Buckets null.Int `json:"buckets" envconfig:"HEATMAP_BUCKETS"`
+	// One of json, csv, html or png. By default, it's picked from the extension of the file.
+	Format null.String `json:"format" envconfig:"HEATMAP_FORMAT"`
+}
+
+// NewConfig creates a new Config instance with default values for some fields.
+func NewConfig() Config {
+	return Config{
+		Metric:   null.NewString(metrics.HTTPReqDuration.Name, false),
+		Interval: types.NewNullDuration(1*time.Second, false),
+		Buckets:  null.NewInt(20, false),
+	}
+}
+
+// Apply saves config non-zero config values from the passed config in the receiver.
+func (c Config) Apply(cfg Config) Config {
+	if cfg.Metric.Valid {
+		c.Metric = cfg.Metric
+	}
+	if cfg.Interval.Valid {
+		c.Interval = cfg.Interval
+	}
+	if cfg.Buckets.Valid {
+		c.Buckets = cfg.Buckets
+	}
+	if cfg.Format.Valid {
+		c.Format = cfg.Format
+	}
+	return c
+}
@@ -0,0 +1,183 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package heatmap
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"time"
+)
+
+// The size of a single cell of the PNG heatmap, in pixels.
+const pngCellSize = 8
+
+func writeJSON(w io.Writer, hm *Heatmap) error {
+	return json.NewEncoder(w).Encode(hm)
+}
+
+// writeCSV writes a row for every time column, with the start time of the column and its counts.
+// The header has the upper bounds of the value rows.
+func writeCSV(w io.Writer, hm *Heatmap) error {
+	cw := csv.NewWriter(w)
+	header := []string{"time"}
+	for _, bound := range hm.Buckets {
+		header = append(header, "le_"+formatValue(bound))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, counts := range hm.Counts {
+		row := []string{hm.columnTime(i).Format(time.RFC3339Nano)}
+		for _, count := range counts {
+			row = append(row, strconv.FormatUint(count, 10))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var htmlTemplate = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Metric}} heatmap</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-size: 10px; }
+td { width: 8px; height: 12px; padding: 0; }
+th { font-weight: normal; text-align: right; padding-right: 4px; white-space: nowrap; }
+</style>
+</head>
+<body>
+<h1>{{.Metric}}</h1>
+<p>{{.Columns}} columns of {{.Interval}} from {{.Start}}</p>
+<table>
+{{range .Rows}}<tr><th>&le; {{.Bound}}</th>{{range .Cells}}<td style="background: {{.Color}}" title="{{.Time}}: {{.Count}}"></td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type htmlCell struct {
+	Color template.CSS
+	Time  string
+	Count uint64
+}
+
+type htmlRow struct {
+	Bound string
+	Cells []htmlCell
+}
+
+// writeHTML writes a self-contained page with the heatmap as a table, the largest values on top.
+func writeHTML(w io.Writer, hm *Heatmap) error {
+	maxCount := hm.maxCount()
+	rows := make([]htmlRow, 0, len(hm.Buckets))
+	for b := len(hm.Buckets) - 1; b >= 0; b-- {
+		row := htmlRow{Bound: formatValue(hm.Buckets[b])}
+		for i, counts := range hm.Counts {
+			c := heatColor(counts[b], maxCount)
+			row.Cells = append(row.Cells, htmlCell{
+				Color: template.CSS("rgb(" + strconv.Itoa(int(c.R)) + "," + strconv.Itoa(int(c.G)) + "," + strconv.Itoa(int(c.B)) + ")"),
+				Time:  hm.columnTime(i).Format(time.RFC3339),
+				Count: counts[b],
+			})
+		}
+		rows = append(rows, row)
+	}
+	return htmlTemplate.Execute(w, map[string]interface{}{
+		"Metric":   hm.Metric,
+		"Columns":  len(hm.Counts),
+		"Interval": time.Duration(hm.Interval),
+		"Start":    hm.Start.Format(time.RFC3339),
+		"Rows":     rows,
+	})
+}
+
+// writePNG draws every time column from left to right, with the largest values on top.
+func writePNG(w io.Writer, hm *Heatmap) error {
+	columns, rows := len(hm.Counts), len(hm.Buckets)
+	if columns == 0 {
+		columns = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, columns*pngCellSize, rows*pngCellSize))
+	maxCount := hm.maxCount()
+	for x := 0; x < columns; x++ {
+		for b := 0; b < rows; b++ {
+			var count uint64
+			if x < len(hm.Counts) {
+				count = hm.Counts[x][b]
+			}
+			c := heatColor(count, maxCount)
+			top := (rows - 1 - b) * pngCellSize
+			for py := top; py < top+pngCellSize; py++ {
+				for px := x * pngCellSize; px < (x+1)*pngCellSize; px++ {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+func (hm *Heatmap) columnTime(i int) time.Time {
+	return hm.Start.Add(time.Duration(i) * time.Duration(hm.Interval))
+}
+
+func (hm *Heatmap) maxCount() uint64 {
+	var max uint64
+	for _, counts := range hm.Counts {
+		for _, count := range counts {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	return max
+}
+
+// heatColor returns white for empty cells, and a color from light yellow to dark red for the
+// others, depending on how full they are compared to the fullest cell.
+func heatColor(count, maxCount uint64) color.RGBA {
+	if count == 0 || maxCount == 0 {
+		return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	f := float64(count) / float64(maxCount)
+	return color.RGBA{
+		R: uint8(255 - 127*f),
+		G: uint8(237 * (1 - f)),
+		B: uint8(160 * (1 - f)),
+		A: 255,
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
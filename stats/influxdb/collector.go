@@ -37,6 +37,7 @@ const (
 
 // Verify that Collector implements lib.Collector
 var _ lib.Collector = &Collector{}
+var _ lib.PendingCollector = &Collector{}
 
 type Collector struct {
 	Client    client.Client
@@ -44,6 +45,7 @@ type Collector struct {
 	BatchConf client.BatchPointsConfig
 
 	buffer     []stats.Sample
+	committing int
 	bufferLock sync.Mutex
 }
 
@@ -97,11 +99,24 @@ func (c *Collector) Link() string {
 	return c.Config.Addr.String
 }
 
+// PendingSamples returns the number of samples that aren't written to InfluxDB yet.
+func (c *Collector) PendingSamples() int {
+	c.bufferLock.Lock()
+	defer c.bufferLock.Unlock()
+	return len(c.buffer) + c.committing
+}
+
 func (c *Collector) commit() {
 	c.bufferLock.Lock()
 	samples := c.buffer
 	c.buffer = nil
+	c.committing = len(samples)
 	c.bufferLock.Unlock()
+	defer func() {
+		c.bufferLock.Lock()
+		c.committing = 0
+		c.bufferLock.Unlock()
+	}()
 
 	log.Debug("InfluxDB: Committing...")
 
@@ -154,6 +169,10 @@ func (c *Collector) batchFromSamples(samples []stats.Sample) (client.BatchPoints
 			c.extractTagsToValues(tags, values)
 			cache[sample.Tags] = cacheItem{tags, values}
 		}
+		// The metadata are written as fields, which unlike tags aren't indexed by InfluxDB.
+		for k, v := range sample.Metadata {
+			values[k] = v
+		}
 		values["value"] = sample.Value
 		p, err := client.NewPoint(
 			sample.Metric.Name,
@@ -0,0 +1,151 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxInternedTagSets caps the number of distinct tag sets that are interned, so tags with unique
+// values (e.g. full URLs with IDs in them) can't make the pool grow without bounds. Once the pool
+// is full, the least recently used tag sets are evicted from it. They stay valid, and they still
+// compare cheaply by their key, they just aren't shared by the tag sets created after that.
+const MaxInternedTagSets = 100000
+
+//nolint:gochecknoglobals
+var internedTagSets = newTagSetPool(MaxInternedTagSets)
+
+// tagSetPool holds the interned tag sets, evicting the least recently used ones once it's full.
+type tagSetPool struct {
+	mutex sync.Mutex
+	max   int
+	sets  map[string]*list.Element // The values are *SampleTags.
+	lru   *list.List               // The most recently used tag sets are at the front.
+}
+
+func newTagSetPool(max int) *tagSetPool {
+	return &tagSetPool{max: max, sets: make(map[string]*list.Element), lru: list.New()}
+}
+
+// intern returns the tag set in the pool that is equal to st, after adding st if there was none.
+func (p *tagSetPool) intern(st *SampleTags) *SampleTags {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if el, ok := p.sets[st.key]; ok {
+		p.lru.MoveToFront(el)
+		return el.Value.(*SampleTags)
+	}
+	st.interned = true
+	p.sets[st.key] = p.lru.PushFront(st)
+	if p.lru.Len() > p.max {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.sets, oldest.Value.(*SampleTags).key)
+	}
+	return st
+}
+
+func (p *tagSetPool) len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.lru.Len()
+}
+
+// newSampleTags returns the interned tag set with the supplied tags and (normalized) multi-value
+// tags, which must not be modified afterwards, or nil if there are none.
+func newSampleTags(tags map[string]string, multi map[string][]string) *SampleTags {
+	if len(tags) == 0 && len(multi) == 0 {
+		return nil
+	}
+	st := &SampleTags{}
+	st.setTags(tags, multi)
+	return st.Intern()
+}
+
+// setTags sets the tags of a tag set that is being created, along with its key and hash.
+func (st *SampleTags) setTags(tags map[string]string, multi map[string][]string) {
+	if len(multi) == 0 {
+		multi = nil
+	}
+	st.tags, st.multi = tags, multi
+	st.key = tagSetKey(tags, multi)
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(st.key))
+	st.hash = h.Sum64()
+	st.json = atomic.Value{}
+}
+
+// Intern returns the interned tag set that is equal to this one, after interning this one if
+// there was none.
+func (st *SampleTags) Intern() *SampleTags {
+	if st.IsEmpty() {
+		return nil
+	}
+	return internedTagSets.intern(st)
+}
+
+// isInterned returns whether the tag set was ever interned, since it may still be shared after
+// it's evicted from the pool.
+func (st *SampleTags) isInterned() bool {
+	return !st.IsEmpty() && st.interned
+}
+
+// tagSetKey returns a canonical representation of the tags, which is the same for equal tag sets
+// and different for all others. Every key and value is prefixed with its length, so they can
+// contain any characters, and multi-value tags are marked with the number of their values.
+func tagSetKey(tags map[string]string, multi map[string][]string) string {
+	keys := make([]string, 0, len(tags)+len(multi))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	for k := range multi {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	writeString := func(s string) {
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteByte(':')
+		b.WriteString(s)
+	}
+	for _, k := range keys {
+		writeString(k)
+		if values, ok := multi[k]; ok {
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(len(values)))
+			for _, v := range values {
+				writeString(v)
+			}
+			continue
+		}
+		b.WriteByte('=')
+		writeString(tags[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagSetPoolEviction(t *testing.T) {
+	t.Parallel()
+
+	newTags := func(v string) *SampleTags {
+		st := &SampleTags{}
+		st.setTags(map[string]string{"evict": v}, nil)
+		return st
+	}
+	p := newTagSetPool(2)
+	a, b := p.intern(newTags("a")), p.intern(newTags("b"))
+	assert.True(t, p.intern(newTags("a")) == a)
+
+	// b is the least recently used one, so it's evicted when c is added
+	c := p.intern(newTags("c"))
+	assert.Equal(t, 2, p.len())
+	assert.True(t, p.intern(newTags("a")) == a)
+	assert.True(t, p.intern(newTags("c")) == c)
+	newB := p.intern(newTags("b"))
+	assert.False(t, newB == b)
+	assert.True(t, newB.IsEqual(b))
+
+	// The evicted tag set may still be shared, so it stays immutable
+	assert.True(t, b.isInterned())
+	assert.EqualError(t, json.Unmarshal([]byte(`{"evict":"x"}`), b), "can't unmarshal into an interned tag set")
+}
+
+// The pool keeps a single copy of equal tag sets, so samples with the same tags only retain that
+// one, while the tag sets that aren't interned are retained once per sample.
+func BenchmarkSampleTagsRetained(b *testing.B) {
+	const samples = 1000
+	newTags := func(intern bool) *SampleTags {
+		tags := map[string]string{"method": "GET", "status": "200", "url": "https://example.com/", "name": "home"}
+		if intern {
+			return IntoSampleTags(&tags)
+		}
+		st := &SampleTags{}
+		st.setTags(tags, nil)
+		return st
+	}
+	for _, intern := range []bool{true, false} {
+		intern := intern
+		b.Run("interned="+strconv.FormatBool(intern), func(b *testing.B) {
+			b.ReportAllocs()
+			retained := make([]*SampleTags, samples)
+			var before, after runtime.MemStats
+			var total uint64
+			for i := 0; i < b.N; i++ {
+				for j := range retained {
+					retained[j] = nil
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				for j := range retained {
+					retained[j] = newTags(intern)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				if after.HeapAlloc > before.HeapAlloc {
+					total += after.HeapAlloc - before.HeapAlloc
+				}
+			}
+			b.ReportMetric(float64(total)/float64(b.N)/samples, "retained-B/sample")
+			runtime.KeepAlive(retained)
+		})
+	}
+}
+
+func BenchmarkSampleTagsIntern(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			tags := map[string]string{"bench": strconv.Itoa(i % 100)}
+			_ = IntoSampleTags(&tags)
+			i++
+		}
+	})
+}
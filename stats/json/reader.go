@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package json
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// Reader parses the newline-delimited JSON written by the Collector back into samples.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+	metrics map[string]*stats.Metric
+}
+
+// NewReader returns a Reader that reads the JSON output from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner, metrics: make(map[string]*stats.Metric)}
+}
+
+type rawEnvelope struct {
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+	Metric string          `json:"metric"`
+}
+
+type rawMetric struct {
+	Name     string           `json:"name"`
+	Type     stats.MetricType `json:"type"`
+	Contains stats.ValueType  `json:"contains"`
+}
+
+// Metrics returns all metrics seen so far, keyed by name.
+func (r *Reader) Metrics() map[string]*stats.Metric {
+	return r.metrics
+}
+
+// Next returns the next sample in the stream, or io.EOF when there are no more.
+// Metric definitions are consumed as they appear; points that reference an unknown metric are an error.
+func (r *Reader) Next() (*stats.Sample, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var env rawEnvelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			return nil, errors.Wrapf(err, "line %d", r.line)
+		}
+
+		switch env.Type {
+		case "Metric":
+			var m rawMetric
+			if err := json.Unmarshal(env.Data, &m); err != nil {
+				return nil, errors.Wrapf(err, "line %d", r.line)
+			}
+			if m.Name == "" {
+				m.Name = env.Metric
+			}
+			if _, ok := r.metrics[m.Name]; !ok {
+				r.metrics[m.Name] = stats.New(m.Name, m.Type, m.Contains)
+			}
+		case "Point":
+			m, ok := r.metrics[env.Metric]
+			if !ok {
+				return nil, errors.Errorf("line %d: point for undeclared metric '%s'", r.line, env.Metric)
+			}
+			var s JSONSample
+			if err := json.Unmarshal(env.Data, &s); err != nil {
+				return nil, errors.Wrapf(err, "line %d", r.line)
+			}
+			return &stats.Sample{Metric: m, Time: s.Time, Value: s.Value, Tags: s.Tags.Intern(), Metadata: s.Metadata}, nil
+		default:
+			return nil, errors.Errorf("line %d: unknown envelope type '%s'", r.line, env.Type)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,73 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package json
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	t.Run("Samples", func(t *testing.T) {
+		r := NewReader(strings.NewReader(`{"type":"Metric","data":{"name":"http_req_duration","type":"trend","contains":"time","tainted":null,"thresholds":[],"submetrics":null},"metric":"http_req_duration"}
+
+{"type":"Point","data":{"time":"2019-01-01T10:00:00Z","value":123.5,"tags":{"status":"200"},"metadata":{"trace_id":"abc"}},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2019-01-01T10:00:01Z","value":10,"tags":null},"metric":"http_req_duration"}
+`))
+		s, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "http_req_duration", s.Metric.Name)
+		assert.Equal(t, stats.Trend, s.Metric.Type)
+		assert.Equal(t, stats.Time, s.Metric.Contains)
+		assert.Equal(t, time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC), s.Time.UTC())
+		assert.Equal(t, 123.5, s.Value)
+		assert.True(t, s.Tags.IsEqual(stats.NewSampleTags(map[string]string{"status": "200"})))
+		assert.Equal(t, map[string]string{"trace_id": "abc"}, s.Metadata)
+
+		s2, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, s.Metric, s2.Metric)
+		assert.Equal(t, 10.0, s2.Value)
+		assert.True(t, s2.Tags.IsEmpty())
+		assert.Nil(t, s2.Metadata)
+
+		_, err = r.Next()
+		assert.Equal(t, io.EOF, err)
+		assert.Len(t, r.Metrics(), 1)
+	})
+	t.Run("UndeclaredMetric", func(t *testing.T) {
+		r := NewReader(strings.NewReader(`{"type":"Point","data":{"time":"2019-01-01T10:00:00Z","value":1},"metric":"vus"}`))
+		_, err := r.Next()
+		assert.EqualError(t, err, "line 1: point for undeclared metric 'vus'")
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		r := NewReader(strings.NewReader("{\"type\":\"Metric\",\"data\":{\"name\":\"vus\",\"type\":\"gauge\"}}\nnope\n"))
+		_, err := r.Next()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+	})
+}
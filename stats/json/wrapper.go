@@ -36,6 +36,8 @@ type JSONSample struct {
 	Time  time.Time         `json:"time"`
 	Value float64           `json:"value"`
 	Tags  *stats.SampleTags `json:"tags"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func NewJSONSample(sample *stats.Sample) *JSONSample {
@@ -43,6 +45,8 @@ func NewJSONSample(sample *stats.Sample) *JSONSample {
 		Time:  sample.Time,
 		Value: sample.Value,
 		Tags:  sample.Tags,
+
+		Metadata: sample.Metadata,
 	}
 }
 
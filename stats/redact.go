@@ -0,0 +1,200 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"sort"
+)
+
+// The ways the values of sensitive tags can be redacted.
+const (
+	// RedactStrip removes the tag altogether.
+	RedactStrip = "strip"
+	// RedactHash replaces the value of the tag with a short hash of it, so samples with the
+	// same value can still be grouped together, without revealing the value itself.
+	RedactHash = "hash"
+)
+
+// A TagRedactor strips or hashes the values of the tags whose names match its rules, e.g. to keep
+// tokens embedded in URLs from leaving the machine that runs the test.
+type TagRedactor struct {
+	patterns []string
+	actions  []string
+}
+
+// NewTagRedactor returns a redactor for the supplied rules, which map tag name patterns to one of
+// the redaction actions. Patterns can contain wildcards (see path.Match), and when several of
+// them match a tag, the one that sorts first wins. Nil is returned if there are no rules.
+func NewTagRedactor(rules map[string]string) *TagRedactor {
+	if len(rules) == 0 {
+		return nil
+	}
+	r := &TagRedactor{}
+	for pattern := range rules {
+		r.patterns = append(r.patterns, pattern)
+	}
+	sort.Strings(r.patterns)
+	for _, pattern := range r.patterns {
+		r.actions = append(r.actions, rules[pattern])
+	}
+	return r
+}
+
+// action returns the redaction action for the tag with the given name, or an empty string.
+func (r *TagRedactor) action(name string) string {
+	for i, pattern := range r.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return r.actions[i]
+		}
+	}
+	return ""
+}
+
+// Redact returns a copy of the tag set with the matching tags redacted. The tag set is returned
+// as it is if none of its tags match.
+func (r *TagRedactor) Redact(st *SampleTags) *SampleTags {
+	if r == nil || st == nil {
+		return st
+	}
+
+	var res *SampleTags
+	clone := func() {
+		if res != nil {
+			return
+		}
+		res = &SampleTags{tags: make(map[string]string, len(st.tags))}
+		for k, v := range st.tags {
+			res.tags[k] = v
+		}
+		if len(st.multi) > 0 {
+			res.multi = make(map[string][]string, len(st.multi))
+			for k, values := range st.multi {
+				res.multi[k] = values
+			}
+		}
+	}
+
+	for k, v := range st.tags {
+		switch r.action(k) {
+		case RedactStrip:
+			clone()
+			delete(res.tags, k)
+		case RedactHash:
+			clone()
+			res.tags[k] = hashTagValue(v)
+		}
+	}
+	for k, values := range st.multi {
+		switch r.action(k) {
+		case RedactStrip:
+			clone()
+			delete(res.multi, k)
+		case RedactHash:
+			clone()
+			hashed := make([]string, len(values))
+			for i, v := range values {
+				hashed[i] = hashTagValue(v)
+			}
+			res.multi[k] = normalizeMultiTags(map[string][]string{k: hashed})[k]
+		}
+	}
+
+	if res == nil {
+		return st
+	}
+	return newSampleTags(res.tags, res.multi)
+}
+
+// RedactMetadata returns a copy of the sample metadata with the same rules applied to their keys
+// as to the tag names, or the metadata itself if none of them match.
+func (r *TagRedactor) RedactMetadata(metadata map[string]string) map[string]string {
+	if r == nil || len(metadata) == 0 {
+		return metadata
+	}
+	var res map[string]string
+	for k, v := range metadata {
+		action := r.action(k)
+		if action == "" {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string, len(metadata))
+			for k, v := range metadata {
+				res[k] = v
+			}
+		}
+		if action == RedactHash {
+			res[k] = hashTagValue(v)
+		} else {
+			delete(res, k)
+		}
+	}
+	if res == nil {
+		return metadata
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// RedactSamples returns a copy of the samples with their tags and metadata redacted. Samples that share a tag
+// set keep sharing the redacted one.
+func (r *TagRedactor) RedactSamples(samples []Sample) []Sample {
+	if r == nil {
+		return samples
+	}
+	return r.redactSamples(samples, make(map[*SampleTags]*SampleTags))
+}
+
+// RedactConnected redacts the tags of a connected sample container and of its samples, which
+// keep sharing the redacted tag set with the container if they shared the original one.
+func (r *TagRedactor) RedactConnected(tags *SampleTags, samples []Sample) (*SampleTags, []Sample) {
+	if r == nil {
+		return tags, samples
+	}
+	redactedTags := r.Redact(tags)
+	return redactedTags, r.redactSamples(samples, map[*SampleTags]*SampleTags{tags: redactedTags})
+}
+
+func (r *TagRedactor) redactSamples(samples []Sample, redacted map[*SampleTags]*SampleTags) []Sample {
+	res := make([]Sample, len(samples))
+	for i, s := range samples {
+		tags, ok := redacted[s.Tags]
+		if !ok {
+			tags = r.Redact(s.Tags)
+			redacted[s.Tags] = tags
+		}
+		s.Tags = tags
+		s.Metadata = r.RedactMetadata(s.Metadata)
+		res[i] = s
+	}
+	return res
+}
+
+// hashTagValue returns the first 16 hex digits of the SHA-256 hash of the value.
+func hashTagValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,97 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagRedactor(t *testing.T) {
+	assert.Nil(t, NewTagRedactor(nil))
+	var nilRedactor *TagRedactor
+	tags := IntoSampleTags(&map[string]string{"url": "http://example.com/?token=secret", "method": "GET"})
+	assert.Equal(t, tags, nilRedactor.Redact(tags))
+
+	r := NewTagRedactor(map[string]string{"url": RedactHash, "*token*": RedactStrip, "name": RedactStrip})
+	assert.Nil(t, r.Redact(nil))
+
+	untouched := IntoSampleTags(&map[string]string{"method": "GET"})
+	assert.True(t, untouched == r.Redact(untouched))
+
+	redacted := r.Redact(IntoSampleTags(&map[string]string{
+		"url": "http://example.com/?token=secret", "method": "GET", "auth_token": "hunter2",
+	}))
+	assert.Equal(t, map[string]string{"url": "ae015e3c2b4435df", "method": "GET"}, redacted.CloneTags())
+	assert.Equal(t, redacted.CloneTags(), r.Redact(tags).CloneTags(), "hashes should be stable")
+
+	assert.Nil(t, r.Redact(IntoSampleTags(&map[string]string{"name": "secret"})))
+
+	multi := IntoSampleTags(&map[string]string{"method": "GET"}).WithMultiTags(map[string][]string{
+		"url": {"http://b", "http://a"}, "my_token": {"x"},
+	})
+	redacted = r.Redact(multi)
+	values, ok := redacted.GetMulti("url")
+	assert.True(t, ok)
+	assert.Len(t, values, 2)
+	assert.NotContains(t, values, "http://a")
+	_, ok = redacted.Get("my_token")
+	assert.False(t, ok)
+	method, _ := redacted.Get("method")
+	assert.Equal(t, "GET", method)
+}
+
+func TestTagRedactorSamples(t *testing.T) {
+	r := NewTagRedactor(map[string]string{"url": RedactStrip})
+	tags := IntoSampleTags(&map[string]string{"url": "http://example.com/", "method": "GET"})
+	other := IntoSampleTags(&map[string]string{"method": "POST"})
+	samples := []Sample{{Tags: tags, Value: 1}, {Tags: tags, Value: 2}, {Tags: other, Value: 3}}
+
+	redacted := r.RedactSamples(samples)
+	assert.Len(t, redacted, 3)
+	assert.True(t, redacted[0].Tags == redacted[1].Tags)
+	assert.True(t, redacted[2].Tags == other)
+	assert.Equal(t, map[string]string{"method": "GET"}, redacted[0].Tags.CloneTags())
+	assert.Equal(t, 2.0, redacted[1].Value)
+	assert.True(t, samples[0].Tags == tags, "the original samples shouldn't be modified")
+
+	connTags, connSamples := r.RedactConnected(tags, samples)
+	assert.True(t, connTags == connSamples[0].Tags)
+	assert.True(t, connTags == connSamples[1].Tags)
+}
+
+func TestTagRedactorMetadata(t *testing.T) {
+	var nilRedactor *TagRedactor
+	metadata := map[string]string{"url": "http://example.com/?token=secret", "trace_id": "abc"}
+	assert.Equal(t, metadata, nilRedactor.RedactMetadata(metadata))
+
+	r := NewTagRedactor(map[string]string{"url": RedactStrip, "trace_*": RedactHash})
+	assert.Equal(t, map[string]string{"trace_id": hashTagValue("abc")}, r.RedactMetadata(metadata))
+	assert.Len(t, metadata, 2, "the original metadata shouldn't be modified")
+	assert.Nil(t, r.RedactMetadata(map[string]string{"url": "http://example.com/"}))
+
+	untouched := map[string]string{"id": "1"}
+	assert.Equal(t, untouched, r.RedactMetadata(untouched))
+
+	redacted := r.RedactSamples([]Sample{{Metadata: metadata}})
+	assert.Equal(t, map[string]string{"trace_id": hashTagValue("abc")}, redacted[0].Metadata)
+}
@@ -0,0 +1,119 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var metricNameRegex = regexp.MustCompile(`^[\p{L}\p{N}\._ !\?/&#\(\)<>%-]{1,128}$`)
+
+// ValidateMetricName returns an error if the name is empty, longer than 128 characters or has
+// characters other than letters, numbers, spaces and ._!?/&#()<>%-.
+func ValidateMetricName(name string) error {
+	if !metricNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid metric name '%s', it must be 1 to 128 letters, numbers, "+
+			"spaces or any of ._!?/&#()<>%%-", name)
+	}
+	return nil
+}
+
+// A Registry keeps every metric of a test by its name, so that the same name can't be used
+// for two metrics of different types, e.g. for a custom metric named like a builtin one.
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]*Metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*Metric)}
+}
+
+// NewMetric returns the registered metric with the name, or registers a new one if there's
+// none. It's an error if the registered metric has a different type or value type.
+func (r *Registry) NewMetric(name string, typ MetricType, t ...ValueType) (*Metric, error) {
+	if err := ValidateMetricName(name); err != nil {
+		return nil, err
+	}
+	m := New(name, typ, t...)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if existing, ok := r.metrics[name]; ok {
+		if err := checkSameMetric(existing, m); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	r.metrics[name] = m
+	return m, nil
+}
+
+// Register adds an existing metric, e.g. a builtin one. Registering a metric with the same
+// name, type and value type as a registered one is a no-op.
+func (r *Registry) Register(m *Metric) error {
+	if err := ValidateMetricName(m.Name); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if existing, ok := r.metrics[m.Name]; ok {
+		return checkSameMetric(existing, m)
+	}
+	r.metrics[m.Name] = m
+	return nil
+}
+
+// Get returns the registered metric with the name, or nil if there's none.
+func (r *Registry) Get(name string) *Metric {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.metrics[name]
+}
+
+// All returns the registered metrics, sorted by their names.
+func (r *Registry) All() []*Metric {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	all := make([]*Metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+func checkSameMetric(existing, m *Metric) error {
+	if existing.Type != m.Type {
+		return fmt.Errorf("metric '%s' is already registered as a %s, it can't be a %s",
+			m.Name, existing.Type, m.Type)
+	}
+	if existing.Contains != m.Contains {
+		return fmt.Errorf("metric '%s' is already registered with %s values, it can't have %s values",
+			m.Name, existing.Contains, m.Contains)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMetricName(t *testing.T) {
+	valid := []string{"a", "my_metric", "Just a Metric", "ünicode", "a.b-c/d?e!f&g#h(i)<j>k%", strings.Repeat("a", 128)}
+	for _, name := range valid {
+		assert.NoError(t, ValidateMetricName(name), name)
+	}
+	invalid := []string{"", strings.Repeat("a", 129), "my:metric", "my\"metric", "my{tag}", "new\nline"}
+	for _, name := range invalid {
+		assert.Error(t, ValidateMetricName(name), name)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("NewMetric", func(t *testing.T) {
+		r := NewRegistry()
+		m, err := r.NewMetric("my_trend", Trend, Time)
+		require.NoError(t, err)
+		assert.Equal(t, Trend, m.Type)
+		assert.Equal(t, Time, m.Contains)
+		assert.Equal(t, m, r.Get("my_trend"))
+
+		same, err := r.NewMetric("my_trend", Trend, Time)
+		require.NoError(t, err)
+		assert.True(t, m == same)
+
+		_, err = r.NewMetric("my_trend", Counter)
+		assert.EqualError(t, err, "metric 'my_trend' is already registered as a \"trend\", it can't be a \"counter\"")
+		_, err = r.NewMetric("my_trend", Trend)
+		assert.EqualError(t, err, "metric 'my_trend' is already registered with \"time\" values, it can't have \"default\" values")
+		_, err = r.NewMetric("my:trend", Trend)
+		assert.Error(t, err)
+		assert.Nil(t, r.Get("my:trend"))
+	})
+	t.Run("Register", func(t *testing.T) {
+		r := NewRegistry()
+		m := New("my_counter", Counter)
+		require.NoError(t, r.Register(m))
+		assert.NoError(t, r.Register(m))
+		assert.NoError(t, r.Register(New("my_counter", Counter)))
+		assert.True(t, m == r.Get("my_counter"))
+		assert.Error(t, r.Register(New("my_counter", Rate)))
+		assert.Error(t, r.Register(New("", Rate)))
+	})
+	t.Run("All", func(t *testing.T) {
+		r := NewRegistry()
+		assert.Empty(t, r.All())
+		_, _ = r.NewMetric("b", Gauge)
+		_, _ = r.NewMetric("a", Rate)
+		all := r.All()
+		require.Len(t, all, 2)
+		assert.Equal(t, "a", all[0].Name)
+		assert.Equal(t, "b", all[1].Name)
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		r := NewRegistry()
+		metrics := make([]*Metric, 10)
+		var wg sync.WaitGroup
+		for i := range metrics {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m, err := r.NewMetric("shared", Counter)
+				assert.NoError(t, err)
+				metrics[i] = m
+			}(i)
+		}
+		wg.Wait()
+		for _, m := range metrics {
+			assert.True(t, metrics[0] == m)
+		}
+	})
+}
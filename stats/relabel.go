@@ -0,0 +1,186 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"fmt"
+	"path"
+)
+
+// The actions of the relabeling rules.
+const (
+	// RelabelRename renames a tag, replacing the tag with the new name if there already is one.
+	RelabelRename = "rename"
+	// RelabelDrop removes the tags whose names match a pattern.
+	RelabelDrop = "drop"
+	// RelabelMap replaces the values of a tag, e.g. "OK" with "200". The values that aren't in
+	// the mapping are kept as they are.
+	RelabelMap = "map"
+)
+
+// A RelabelRule changes the tags of the samples that an output gets, e.g. to follow the naming
+// conventions of its backend, like Prometheus' relabel_configs do.
+type RelabelRule struct {
+	Action string            `json:"action"`
+	Tag    string            `json:"tag"`
+	To     string            `json:"to,omitempty"`
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// Validate returns an error if the rule has an unknown action or lacks what its action needs.
+func (r RelabelRule) Validate() error {
+	if r.Tag == "" {
+		return fmt.Errorf("the '%s' relabeling rule needs a tag", r.Action)
+	}
+	switch r.Action {
+	case RelabelRename:
+		if r.To == "" {
+			return fmt.Errorf("the rule to rename the tag '%s' needs a new name in 'to'", r.Tag)
+		}
+	case RelabelDrop:
+		if _, err := path.Match(r.Tag, ""); err != nil {
+			return fmt.Errorf("'%s' isn't a valid tag name pattern: %s", r.Tag, err)
+		}
+	case RelabelMap:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("the rule to map the values of the tag '%s' needs some values", r.Tag)
+		}
+	default:
+		return fmt.Errorf("the relabeling action for the tag '%s' must be '%s', '%s' or '%s', not '%s'",
+			r.Tag, RelabelRename, RelabelDrop, RelabelMap, r.Action)
+	}
+	return nil
+}
+
+// A Relabeler applies relabeling rules to tag sets, in order, so a rule sees the tags as the
+// previous rules left them.
+type Relabeler struct {
+	rules []RelabelRule
+}
+
+// NewRelabeler returns a relabeler for the supplied rules, which should have been validated.
+// Nil is returned if there are no rules.
+func NewRelabeler(rules []RelabelRule) *Relabeler {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &Relabeler{rules: rules}
+}
+
+// Relabel returns a copy of the tag set with the rules applied, or the tag set as it is if none
+// of them change it.
+func (r *Relabeler) Relabel(st *SampleTags) *SampleTags {
+	if r == nil || st == nil {
+		return st
+	}
+
+	tags := make(map[string]string, len(st.tags))
+	for k, v := range st.tags {
+		tags[k] = v
+	}
+	multi := st.CloneMultiTags()
+	changed := false
+	for _, rule := range r.rules {
+		switch rule.Action {
+		case RelabelRename:
+			if v, ok := tags[rule.Tag]; ok {
+				delete(tags, rule.Tag)
+				delete(multi, rule.To)
+				tags[rule.To] = v
+				changed = true
+			} else if values, ok := multi[rule.Tag]; ok {
+				delete(multi, rule.Tag)
+				delete(tags, rule.To)
+				multi[rule.To] = values
+				changed = true
+			}
+		case RelabelDrop:
+			for k := range tags {
+				if ok, _ := path.Match(rule.Tag, k); ok {
+					delete(tags, k)
+					changed = true
+				}
+			}
+			for k := range multi {
+				if ok, _ := path.Match(rule.Tag, k); ok {
+					delete(multi, k)
+					changed = true
+				}
+			}
+		case RelabelMap:
+			if v, ok := tags[rule.Tag]; ok {
+				if mapped, ok := rule.Values[v]; ok {
+					tags[rule.Tag] = mapped
+					changed = true
+				}
+			}
+			if values, ok := multi[rule.Tag]; ok {
+				mappedValues := make([]string, len(values))
+				for i, v := range values {
+					if mapped, ok := rule.Values[v]; ok {
+						v = mapped
+						changed = true
+					}
+					mappedValues[i] = v
+				}
+				multi[rule.Tag] = mappedValues
+			}
+		}
+	}
+
+	if !changed {
+		return st
+	}
+	return newSampleTags(tags, normalizeMultiTags(multi))
+}
+
+// RelabelSamples returns a copy of the samples with their tags relabeled. Samples that share a
+// tag set keep sharing the relabeled one.
+func (r *Relabeler) RelabelSamples(samples []Sample) []Sample {
+	if r == nil {
+		return samples
+	}
+	return r.relabelSamples(samples, make(map[*SampleTags]*SampleTags))
+}
+
+// RelabelConnected relabels the tags of a connected sample container and of its samples, which
+// keep sharing the relabeled tag set with the container if they shared the original one.
+func (r *Relabeler) RelabelConnected(tags *SampleTags, samples []Sample) (*SampleTags, []Sample) {
+	if r == nil {
+		return tags, samples
+	}
+	relabeledTags := r.Relabel(tags)
+	return relabeledTags, r.relabelSamples(samples, map[*SampleTags]*SampleTags{tags: relabeledTags})
+}
+
+func (r *Relabeler) relabelSamples(samples []Sample, relabeled map[*SampleTags]*SampleTags) []Sample {
+	res := make([]Sample, len(samples))
+	for i, s := range samples {
+		tags, ok := relabeled[s.Tags]
+		if !ok {
+			tags = r.Relabel(s.Tags)
+			relabeled[s.Tags] = tags
+		}
+		s.Tags = tags
+		res[i] = s
+	}
+	return res
+}
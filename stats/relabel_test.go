@@ -0,0 +1,110 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelabelRuleValidate(t *testing.T) {
+	valid := []RelabelRule{
+		{Action: RelabelRename, Tag: "status", To: "code"},
+		{Action: RelabelDrop, Tag: "*_id"},
+		{Action: RelabelMap, Tag: "method", Values: map[string]string{"GET": "get"}},
+	}
+	for _, rule := range valid {
+		assert.NoError(t, rule.Validate(), "%v", rule)
+	}
+
+	invalid := map[string]RelabelRule{
+		"the 'drop' relabeling rule needs a tag":                                                {Action: RelabelDrop},
+		"the rule to rename the tag 'status' needs a new name in 'to'":                          {Action: RelabelRename, Tag: "status"},
+		"'[' isn't a valid tag name pattern: syntax error in pattern":                           {Action: RelabelDrop, Tag: "["},
+		"the rule to map the values of the tag 'method' needs some values":                      {Action: RelabelMap, Tag: "method"},
+		"the relabeling action for the tag 'url' must be 'rename', 'drop' or 'map', not 'hash'": {Action: "hash", Tag: "url"},
+	}
+	for msg, rule := range invalid {
+		assert.EqualError(t, rule.Validate(), msg)
+	}
+}
+
+func TestRelabeler(t *testing.T) {
+	assert.Nil(t, NewRelabeler(nil))
+	var nilRelabeler *Relabeler
+	tags := IntoSampleTags(&map[string]string{"status": "200", "method": "GET"})
+	assert.True(t, tags == nilRelabeler.Relabel(tags))
+
+	r := NewRelabeler([]RelabelRule{
+		{Action: RelabelRename, Tag: "status", To: "http_status"},
+		{Action: RelabelMap, Tag: "http_status", Values: map[string]string{"200": "OK", "404": "Not Found"}},
+		{Action: RelabelDrop, Tag: "*_id"},
+		{Action: RelabelMap, Tag: "method", Values: map[string]string{"GET": "get", "POST": "post"}},
+	})
+	assert.Nil(t, r.Relabel(nil))
+
+	untouched := IntoSampleTags(&map[string]string{"name": "x", "method": "PUT"})
+	assert.True(t, untouched == r.Relabel(untouched))
+
+	relabeled := r.Relabel(IntoSampleTags(&map[string]string{
+		"status": "200", "method": "GET", "vu_id": "1", "iter_id": "2", "url": "http://example.com/",
+	}))
+	assert.Equal(t, map[string]string{
+		"http_status": "OK", "method": "get", "url": "http://example.com/",
+	}, relabeled.CloneTags())
+
+	assert.Nil(t, r.Relabel(IntoSampleTags(&map[string]string{"vu_id": "1"})))
+
+	renamed := NewRelabeler([]RelabelRule{{Action: RelabelRename, Tag: "a", To: "b"}}).Relabel(
+		IntoSampleTags(&map[string]string{"a": "1", "b": "2"}))
+	assert.Equal(t, map[string]string{"b": "1"}, renamed.CloneTags())
+
+	multi := IntoSampleTags(&map[string]string{"status": "404"}).WithMultiTags(map[string][]string{
+		"method": {"POST", "GET", "put"}, "session_id": {"x", "y"},
+	})
+	relabeled = r.Relabel(multi)
+	values, ok := relabeled.GetMulti("method")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"get", "post", "put"}, values)
+	_, ok = relabeled.Get("session_id")
+	assert.False(t, ok)
+	status, _ := relabeled.Get("http_status")
+	assert.Equal(t, "Not Found", status)
+}
+
+func TestRelabelerSamples(t *testing.T) {
+	r := NewRelabeler([]RelabelRule{{Action: RelabelDrop, Tag: "url"}})
+	tags := IntoSampleTags(&map[string]string{"url": "http://example.com/", "method": "GET"})
+	other := IntoSampleTags(&map[string]string{"method": "POST"})
+	samples := []Sample{{Tags: tags, Value: 1}, {Tags: tags, Value: 2}, {Tags: other, Value: 3}}
+
+	relabeled := r.RelabelSamples(samples)
+	assert.Len(t, relabeled, 3)
+	assert.True(t, relabeled[0].Tags == relabeled[1].Tags)
+	assert.True(t, relabeled[2].Tags == other)
+	assert.Equal(t, map[string]string{"method": "GET"}, relabeled[0].Tags.CloneTags())
+	assert.True(t, samples[0].Tags == tags, "the original samples shouldn't be modified")
+
+	connTags, connSamples := r.RelabelConnected(tags, samples)
+	assert.True(t, connTags == connSamples[0].Tags)
+	assert.True(t, connTags == connSamples[1].Tags)
+}
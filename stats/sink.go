@@ -21,6 +21,7 @@
 package stats
 
 import (
+	"encoding/json"
 	"errors"
 	"math"
 	"sort"
@@ -55,10 +56,19 @@ func (c *CounterSink) Add(s Sample) {
 
 func (c *CounterSink) Calc() {}
 
+// Rate returns the per-second rate of the count over the given duration of the test, or 0 if
+// the test hasn't started yet.
+func (c *CounterSink) Rate(t time.Duration) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return c.Value / t.Seconds()
+}
+
 func (c *CounterSink) Format(t time.Duration) map[string]float64 {
 	return map[string]float64{
 		"count": c.Value,
-		"rate":  c.Value / (float64(t) / float64(time.Second)),
+		"rate":  c.Rate(t),
 	}
 }
 
@@ -85,9 +95,23 @@ func (g *GaugeSink) Format(t time.Duration) map[string]float64 {
 	return map[string]float64{"value": g.Value}
 }
 
+// The ways trend sinks can keep their values.
+const (
+	// TrendSinkHistogram keeps the values in an HDRHistogram, or all of them exactly with a 0 precision.
+	TrendSinkHistogram = "histogram"
+	// TrendSinkTDigest summarizes the values in a TDigest.
+	TrendSinkTDigest = "tdigest"
+)
+
+// A TrendSink keeps the statistics of a trend metric. By default all values are kept, so the
+// percentiles are exact. Sinks created with NewTrendSink and a non-zero precision record them in
+// an HDRHistogram instead, so their memory usage doesn't grow with the number of samples, and the
+// ones created with NewTDigestTrendSink summarize them in a TDigest.
 type TrendSink struct {
-	Values  []float64
-	jumbled bool
+	Values    []float64     `json:",omitempty"`
+	Histogram *HDRHistogram `json:",omitempty"`
+	Digest    *TDigest      `json:",omitempty"`
+	jumbled   bool
 
 	Count    uint64
 	Min, Max float64
@@ -95,8 +119,30 @@ type TrendSink struct {
 	Med      float64
 }
 
+// NewTrendSink returns a trend sink that keeps the given number of significant decimal digits of
+// its values, or all of its values exactly if the precision is 0.
+func NewTrendSink(precision int) *TrendSink {
+	if precision == 0 {
+		return &TrendSink{}
+	}
+	return &TrendSink{Histogram: NewHDRHistogram(precision)}
+}
+
+// NewTDigestTrendSink returns a trend sink that summarizes its values in a t-digest with the given
+// compression, or DefaultTDigestCompression if it's 0.
+func NewTDigestTrendSink(compression float64) *TrendSink {
+	return &TrendSink{Digest: NewTDigest(compression)}
+}
+
 func (t *TrendSink) Add(s Sample) {
-	t.Values = append(t.Values, s.Value)
+	switch {
+	case t.Digest != nil:
+		t.Digest.Add(s.Value)
+	case t.Histogram != nil:
+		t.Histogram.Add(s.Value)
+	default:
+		t.Values = append(t.Values, s.Value)
+	}
 	t.jumbled = true
 	t.Count += 1
 	t.Sum += s.Value
@@ -110,19 +156,57 @@ func (t *TrendSink) Add(s Sample) {
 	}
 }
 
+// Merge adds all of the values of another trend sink, e.g. the one of the same metric in another
+// k6 instance. Both sinks have to keep their values the same way, and histograms need the same
+// precision.
+func (t *TrendSink) Merge(other *TrendSink) error {
+	switch {
+	case (t.Digest != nil) != (other.Digest != nil) || (t.Histogram != nil) != (other.Histogram != nil):
+		return errors.New("trend sinks that keep their values differently can't be merged")
+	case t.Histogram != nil && t.Histogram.Precision != other.Histogram.Precision:
+		return errors.New("trend sink histograms with different precisions can't be merged")
+	case other.Count == 0:
+		return nil
+	case t.Digest != nil:
+		t.Digest.Merge(other.Digest)
+	case t.Histogram != nil:
+		t.Histogram.Merge(other.Histogram)
+	default:
+		t.Values = append(t.Values, other.Values...)
+	}
+
+	if t.Count == 0 || other.Min < t.Min {
+		t.Min = other.Min
+	}
+	if t.Count == 0 || other.Max > t.Max {
+		t.Max = other.Max
+	}
+	t.Count += other.Count
+	t.Sum += other.Sum
+	t.Avg = t.Sum / float64(t.Count)
+	t.jumbled = true
+	return nil
+}
+
 // P calculates the given percentile from sink values.
 func (t *TrendSink) P(pct float64) float64 {
 	switch t.Count {
 	case 0:
 		return 0
 	case 1:
-		return t.Values[0]
+		return t.Min
 	default:
+		if t.Digest != nil {
+			return math.Min(math.Max(t.Digest.Quantile(pct), t.Min), t.Max)
+		}
+		if t.Histogram != nil {
+			return t.histogramP(pct)
+		}
 		// If percentile falls on a value in Values slice, we return that value.
 		// If percentile does not fall on a value in Values slice, we calculate (linear interpolation)
 		// the value that would fall at percentile, given the values above and below that percentile.
 		t.Calc()
-		i := pct * (float64(t.Count) - 1.0)
+		i := math.Max(0, math.Min(1, pct)) * (float64(t.Count) - 1.0)
 		j := t.Values[int(math.Floor(i))]
 		k := t.Values[int(math.Ceil(i))]
 		f := i - math.Floor(i)
@@ -130,13 +214,49 @@ func (t *TrendSink) P(pct float64) float64 {
 	}
 }
 
+// histogramP calculates the given percentile from the histogram, the same way P does from the
+// sorted values. The result is clamped between the exact min and max values.
+func (t *TrendSink) histogramP(pct float64) float64 {
+	if pct <= 0 {
+		return t.Min
+	} else if pct >= 1 {
+		return t.Max
+	}
+	i := pct * (float64(t.Count) - 1.0)
+	j := t.Histogram.ValueAt(uint64(math.Floor(i)))
+	k := t.Histogram.ValueAt(uint64(math.Ceil(i)))
+	f := i - math.Floor(i)
+	return math.Min(math.Max(j+(k-j)*f, t.Min), t.Max)
+}
+
+// ForEachValue calls fn with all of the values in the sink and how many times each of them was
+// added. For sinks backed by a histogram, the values are those in the middle of its buckets, and
+// for the ones backed by a t-digest, the means of its centroids.
+func (t *TrendSink) ForEachValue(fn func(value float64, count uint64)) {
+	if t.Digest != nil {
+		t.Digest.ForEach(fn)
+		return
+	}
+	if t.Histogram != nil {
+		t.Histogram.ForEach(fn)
+		return
+	}
+	for _, v := range t.Values {
+		fn(v, 1)
+	}
+}
+
 func (t *TrendSink) Calc() {
 	if !t.jumbled {
 		return
 	}
+	t.jumbled = false
 
+	if t.Digest != nil || t.Histogram != nil {
+		t.Med = t.P(0.5)
+		return
+	}
 	sort.Float64s(t.Values)
-	t.jumbled = false
 
 	// The median of an even number of values is the average of the middle two.
 	if (t.Count & 0x01) == 0 {
@@ -187,3 +307,34 @@ func (d DummySink) Calc() {}
 func (d DummySink) Format(t time.Duration) map[string]float64 {
 	return map[string]float64(d)
 }
+
+// UnmarshalSink restores a sink of the supplied metric type from its JSON representation, e.g.
+// one that was previously saved with json.Marshal(). It takes care of the unexported bookkeeping
+// fields, so the returned sink can continue receiving samples as if it was never serialized.
+func UnmarshalSink(typ MetricType, data []byte) (Sink, error) {
+	switch typ {
+	case Counter:
+		sink := &CounterSink{}
+		return sink, json.Unmarshal(data, sink)
+	case Gauge:
+		sink := &GaugeSink{}
+		if err := json.Unmarshal(data, sink); err != nil {
+			return nil, err
+		}
+		// Serialized gauges are expected to have received at least one sample already
+		sink.minSet = true
+		return sink, nil
+	case Trend:
+		sink := &TrendSink{}
+		if err := json.Unmarshal(data, sink); err != nil {
+			return nil, err
+		}
+		sink.jumbled = true
+		return sink, nil
+	case Rate:
+		sink := &RateSink{}
+		return sink, json.Unmarshal(data, sink)
+	default:
+		return nil, ErrInvalidMetricType
+	}
+}
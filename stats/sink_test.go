@@ -21,10 +21,12 @@
 package stats
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCounterSink(t *testing.T) {
@@ -59,6 +61,8 @@ func TestCounterSink(t *testing.T) {
 			sink.Add(Sample{Metric: &Metric{}, Value: s, Time: now})
 		}
 		assert.Equal(t, map[string]float64{"count": 145, "rate": 145.0}, sink.Format(1*time.Second))
+		assert.Equal(t, map[string]float64{"count": 145, "rate": 14.5}, sink.Format(10*time.Second))
+		assert.Equal(t, map[string]float64{"count": 145, "rate": 0}, sink.Format(0))
 	})
 }
 
@@ -269,3 +273,35 @@ func TestDummySinkCalcDoesNothing(t *testing.T) {
 func TestDummySinkFormatReturnsItself(t *testing.T) {
 	assert.Equal(t, map[string]float64{"a": 1}, DummySink{"a": 1}.Format(0))
 }
+
+func TestUnmarshalSink(t *testing.T) {
+	now := time.Now()
+	for typ, values := range map[MetricType][]float64{
+		Counter: {1, 2, 3},
+		Gauge:   {5, 1, 10},
+		Trend:   {3, 1, 2, 7},
+		Rate:    {0, 1, 1},
+	} {
+		typ, values := typ, values
+		t.Run(typ.String(), func(t *testing.T) {
+			sink := New("test", typ).Sink
+			for _, v := range values {
+				sink.Add(Sample{Metric: &Metric{}, Value: v, Time: now})
+			}
+			sink.Calc()
+			data, err := json.Marshal(sink)
+			require.NoError(t, err)
+
+			restored, err := UnmarshalSink(typ, data)
+			require.NoError(t, err)
+			assert.Equal(t, sink.Format(time.Second), restored.Format(time.Second))
+
+			sink.Add(Sample{Metric: &Metric{}, Value: 4, Time: now})
+			restored.Add(Sample{Metric: &Metric{}, Value: 4, Time: now})
+			assert.Equal(t, sink.Format(time.Second), restored.Format(time.Second))
+		})
+	}
+
+	_, err := UnmarshalSink(MetricType(-1), []byte("{}"))
+	assert.Equal(t, ErrInvalidMetricType, err)
+}
@@ -25,8 +25,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -163,30 +167,73 @@ func (t ValueType) String() string {
 	}
 }
 
+// UnmarshalText deserializes a ValueType from its name, like "time" in `new Trend("x", "time")`.
+func (t *ValueType) UnmarshalText(text []byte) error {
+	return t.UnmarshalJSON([]byte(strconv.Quote(string(text))))
+}
+
+// MultiTagSeparator joins the values of multi-value tags for the outputs (and the other
+// consumers of SampleTags) that only support a single string value per tag.
+const MultiTagSeparator = ","
+
 // SampleTags is an immutable string[string] map for tags. Once a tag
 // set is created, direct modification is prohibited. It has
 // copy-on-write semantics and uses pointers for faster comparison
 // between maps, since the same tag set is often used for multiple samples.
-// All methods should not panic, even if they are called on a nil pointer.
+// All methods should not panic, even if they are called on a nil pointer,
+// and they're safe for concurrent use.
+//
+// Tag sets are interned (see intern.go), so equal tag sets created anywhere are usually the same
+// pointer, and the ones that aren't are still compared by their canonical key, without going
+// over their maps.
+//
+// Besides the normal tags, a tag set can also have multi-value tags (e.g. the feature flags or
+// experiment cohorts that were active during a request), which are kept sorted and deduplicated,
+// and whose keys never overlap with the normal tags.
 type SampleTags struct {
-	tags map[string]string
-	json []byte
+	tags  map[string]string
+	multi map[string][]string
+	key   string
+	hash  uint64
+	json  atomic.Value // []byte
+
+	// Set once the tag set is interned, after which it's shared and may not be modified.
+	interned bool
 }
 
 // Get returns an empty string and false if the the requested key is not
-// present or its value and true if it is.
+// present or its value and true if it is. The values of multi-value tags
+// are joined with MultiTagSeparator.
 func (st *SampleTags) Get(key string) (string, bool) {
 	if st == nil {
 		return "", false
 	}
+	if values, ok := st.multi[key]; ok {
+		return strings.Join(values, MultiTagSeparator), true
+	}
 	val, ok := st.tags[key]
 	return val, ok
 }
 
+// GetMulti returns the values of the requested tag and true if it's present,
+// or nil and false if it isn't. Normal tags are returned as a single value.
+func (st *SampleTags) GetMulti(key string) ([]string, bool) {
+	if st == nil {
+		return nil, false
+	}
+	if values, ok := st.multi[key]; ok {
+		return append([]string{}, values...), true
+	}
+	if val, ok := st.tags[key]; ok {
+		return []string{val}, true
+	}
+	return nil, false
+}
+
 // IsEmpty checks for a nil pointer or zero tags.
 // It's necessary because of this envconfig issue: https://github.com/kelseyhightower/envconfig/issues/113
 func (st *SampleTags) IsEmpty() bool {
-	return st == nil || len(st.tags) == 0
+	return st == nil || (len(st.tags) == 0 && len(st.multi) == 0)
 }
 
 // IsEqual tries to compare two tag sets with maximum efficiency.
@@ -194,69 +241,187 @@ func (st *SampleTags) IsEqual(other *SampleTags) bool {
 	if st == other {
 		return true
 	}
-	if st == nil || other == nil || len(st.tags) != len(other.tags) {
-		return false
+	if st.IsEmpty() || other.IsEmpty() {
+		return st.IsEmpty() && other.IsEmpty()
 	}
-	for k, v := range st.tags {
-		if otherv, ok := other.tags[k]; !ok || v != otherv {
-			return false
-		}
+	return st.hash == other.hash && st.key == other.key
+}
+
+// Hash returns a hash of the tag set, which is the same for equal tag sets, or 0 for empty ones.
+func (st *SampleTags) Hash() uint64 {
+	if st == nil {
+		return 0
 	}
-	return true
+	return st.hash
 }
 
+// Contains checks if all of the other tags are present in this tag set. A normal tag in the other
+// set also matches a multi-value tag with the same key here, if it's one of the values.
 func (st *SampleTags) Contains(other *SampleTags) bool {
 	if st == other || other == nil {
 		return true
 	}
-	if st == nil || len(st.tags) < len(other.tags) {
+	if st == nil || len(st.tags)+len(st.multi) < len(other.tags)+len(other.multi) {
 		return false
 	}
 
 	for k, v := range other.tags {
-		if st.tags[k] != v {
+		if st.tags[k] != v && !containsString(st.multi[k], v) {
 			return false
 		}
 	}
+	for k, values := range other.multi {
+		for _, v := range values {
+			if !containsString(st.multi[k], v) {
+				return false
+			}
+		}
+	}
 
 	return true
 }
 
+func containsString(sorted []string, s string) bool {
+	i := sort.SearchStrings(sorted, s)
+	return i < len(sorted) && sorted[i] == s
+}
+
 // MarshalJSON serializes SampleTags to a JSON string and caches
-// the result. It is not thread safe in the sense that the Go race
-// detector will complain if it's used concurrently, but no data
-// should be corrupted.
+// the result. Multi-value tags are serialized as arrays.
 func (st *SampleTags) MarshalJSON() ([]byte, error) {
 	if st.IsEmpty() {
 		return []byte("null"), nil
 	}
-	if st.json != nil {
-		return st.json, nil
+	if cached, ok := st.json.Load().([]byte); ok {
+		return cached, nil
 	}
-	res, err := json.Marshal(st.tags)
+	var data interface{} = st.tags
+	if len(st.multi) > 0 {
+		all := make(map[string]interface{}, len(st.tags)+len(st.multi))
+		for k, v := range st.tags {
+			all[k] = v
+		}
+		for k, values := range st.multi {
+			all[k] = values
+		}
+		data = all
+	}
+	res, err := json.Marshal(data)
 	if err != nil {
 		return res, err
 	}
-	st.json = res
+	st.json.Store(res)
 	return res, nil
 }
 
-// UnmarshalJSON deserializes SampleTags from a JSON string.
+// UnmarshalJSON deserializes SampleTags from a JSON string, where
+// arrays of strings are multi-value tags. As it fills in the receiver, the
+// result isn't interned; use Intern() for that. Interned tag sets can't be
+// unmarshaled into, since they're shared.
 func (st *SampleTags) UnmarshalJSON(data []byte) error {
-	if st == nil {
-		*st = SampleTags{}
+	if st.isInterned() {
+		return errors.New("can't unmarshal into an interned tag set")
 	}
-	return json.Unmarshal(data, &st.tags)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		st.setTags(nil, nil)
+		return nil
+	}
+
+	tags := make(map[string]string, len(raw))
+	multi := make(map[string][]string)
+	for k, v := range raw {
+		if len(v) > 0 && v[0] == '[' {
+			var values []string
+			if err := json.Unmarshal(v, &values); err != nil {
+				return err
+			}
+			multi[k] = values
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(v, &value); err != nil {
+			return err
+		}
+		tags[k] = value
+	}
+	if len(multi) > 0 {
+		multi = normalizeMultiTags(multi)
+	} else {
+		multi = nil
+	}
+	st.setTags(tags, multi)
+	return nil
 }
 
 // CloneTags copies the underlying set of a sample tags and
 // returns it. If the receiver is nil, it returns an empty non-nil map.
+// The values of multi-value tags are joined with MultiTagSeparator.
 func (st *SampleTags) CloneTags() map[string]string {
 	res := map[string]string{}
 	if st != nil {
 		for k, v := range st.tags {
 			res[k] = v
 		}
+		for k, values := range st.multi {
+			res[k] = strings.Join(values, MultiTagSeparator)
+		}
+	}
+	return res
+}
+
+// CloneMultiTags copies the multi-value tags of the tag set and returns them,
+// or nil if there aren't any.
+func (st *SampleTags) CloneMultiTags() map[string][]string {
+	if st == nil || len(st.multi) == 0 {
+		return nil
+	}
+	res := make(map[string][]string, len(st.multi))
+	for k, values := range st.multi {
+		res[k] = append([]string{}, values...)
+	}
+	return res
+}
+
+// WithMultiTags returns a new tag set with the tags of this one and the supplied multi-value
+// tags, which replace any normal tags with the same keys. The receiver is returned as it is
+// if there are no multi-value tags to add.
+func (st *SampleTags) WithMultiTags(multi map[string][]string) *SampleTags {
+	if len(multi) == 0 {
+		return st
+	}
+	tags, resMulti := map[string]string{}, map[string][]string{}
+	if st != nil {
+		for k, v := range st.tags {
+			tags[k] = v
+		}
+		for k, values := range st.multi {
+			resMulti[k] = values
+		}
+	}
+	for k, values := range normalizeMultiTags(multi) {
+		delete(tags, k)
+		resMulti[k] = values
+	}
+	return newSampleTags(tags, resMulti)
+}
+
+// normalizeMultiTags returns a copy of the multi-value tags with sorted and deduplicated values.
+func normalizeMultiTags(multi map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(multi))
+	for k, values := range multi {
+		sorted := append([]string{}, values...)
+		sort.Strings(sorted)
+		deduped := sorted[:0]
+		for i, v := range sorted {
+			if i == 0 || v != sorted[i-1] {
+				deduped = append(deduped, v)
+			}
+		}
+		res[k] = deduped
 	}
 	return res
 }
@@ -272,7 +437,7 @@ func NewSampleTags(data map[string]string) *SampleTags {
 	for k, v := range data {
 		tags[k] = v
 	}
-	return &SampleTags{tags: tags}
+	return newSampleTags(tags, nil)
 }
 
 // IntoSampleTags "consumes" the passed map and creates a new SampleTags
@@ -284,9 +449,9 @@ func IntoSampleTags(data *map[string]string) *SampleTags {
 		return nil
 	}
 
-	res := SampleTags{tags: *data}
+	res := newSampleTags(*data, nil)
 	*data = nil
-	return &res
+	return res
 }
 
 // A Sample is a single measurement.
@@ -295,6 +460,11 @@ type Sample struct {
 	Time   time.Time
 	Tags   *SampleTags
 	Value  float64
+
+	// Metadata are extra values of the sample, like trace IDs or full URLs, that are passed to the
+	// outputs along with it. Unlike the tags they aren't indexed: thresholds, submetrics and the
+	// outputs that aggregate the samples ignore them, so they can be unique to every sample.
+	Metadata map[string]string
 }
 
 // SampleContainer is a simple abstraction that allows sample
@@ -471,40 +641,169 @@ func (m *Metric) HumanizeValue(v float64, timeUnit string) string {
 	}
 }
 
+// HumanizeRate formats a per-second rate of the values of the metric, like the ones of counters.
+// Plain numbers are rounded to two decimal places, e.g. "41.13/s".
+func (m *Metric) HumanizeRate(rate float64, timeUnit string) string {
+	if m.Contains == Default {
+		return humanize.Ftoa(math.Round(rate*100)/100) + "/s"
+	}
+	return m.HumanizeValue(rate, timeUnit) + "/s"
+}
+
 // A Submetric represents a filtered dataset based on a parent metric.
 type Submetric struct {
-	Name   string      `json:"name"`
-	Parent string      `json:"parent"`
-	Suffix string      `json:"suffix"`
-	Tags   *SampleTags `json:"tags"`
-	Metric *Metric     `json:"-"`
+	Name     string       `json:"name"`
+	Parent   string       `json:"parent"`
+	Suffix   string       `json:"suffix"`
+	Tags     *SampleTags  `json:"tags"`
+	Matchers []TagMatcher `json:"matchers,omitempty"`
+	Metric   *Metric      `json:"-"`
 }
 
-// Creates a submetric from a name.
-func NewSubmetric(name string) (parentName string, sm *Submetric) {
+// A TagMatcher matches the values of a tag against a regular expression, for the conditions like
+// `status:~"5.."` in submetric names. The expression has to match the whole value.
+type TagMatcher struct {
+	Key     string
+	Pattern *regexp.Regexp
+}
+
+// MarshalJSON writes the matcher with the expression as it was given.
+func (tm TagMatcher) MarshalJSON() ([]byte, error) {
+	pattern := strings.TrimSuffix(strings.TrimPrefix(tm.Pattern.String(), "^(?:"), ")$")
+	return json.Marshal(map[string]string{"key": tm.Key, "pattern": pattern})
+}
+
+// Match returns whether any of the values of the tag in the given tags matches.
+func (tm TagMatcher) Match(tags *SampleTags) bool {
+	if tags == nil {
+		return false
+	}
+	// The values are read directly, since GetMulti() would copy them for every sample.
+	if value, ok := tags.tags[tm.Key]; ok {
+		return tm.Pattern.MatchString(value)
+	}
+	for _, value := range tags.multi[tm.Key] {
+		if tm.Pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns whether a sample with the given tags belongs to the submetric, i.e. whether it
+// has all of its tags and matches all of its matchers.
+func (sm *Submetric) Match(tags *SampleTags) bool {
+	if !tags.Contains(sm.Tags) {
+		return false
+	}
+	for _, tm := range sm.Matchers {
+		if !tm.Match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// Creates a submetric from a name, like `http_req_duration{status:~"5..",group:"::checkout"}`.
+func NewSubmetric(name string) (parentName string, sm *Submetric, err error) {
 	parts := strings.SplitN(strings.TrimSuffix(name, "}"), "{", 2)
 	if len(parts) == 1 {
-		return parts[0], &Submetric{Name: name}
+		return parts[0], &Submetric{Name: name}, nil
 	}
 
-	kvs := strings.Split(parts[1], ",")
-	tags := make(map[string]string, len(kvs))
-	for _, kv := range kvs {
-		if kv == "" {
-			continue
+	tags, matchers, err := ParseTagMatchers(parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return parts[0], &Submetric{
+		Name: name, Parent: parts[0], Suffix: parts[1], Tags: tags, Matchers: matchers,
+	}, nil
+}
+
+// ParseTagFilter parses a comma-separated list of tags in the format used by submetric names,
+// e.g. `status:200,method:"GET"`. Only the exact tag values are kept, see ParseTagMatchers.
+func ParseTagFilter(filter string) *SampleTags {
+	tags := make(map[string]string)
+	for _, cond := range parseTagConditions(filter) {
+		if !cond.regexp {
+			tags[cond.key] = cond.value
 		}
-		parts := strings.SplitN(kv, ":", 2)
+	}
+	return IntoSampleTags(&tags)
+}
 
-		key := strings.TrimSpace(strings.Trim(parts[0], `"'`))
-		if len(parts) != 2 {
-			tags[key] = ""
+// ParseTagMatchers parses a tag filter like ParseTagFilter, but also supports regular
+// expressions for the values with `~`, e.g. `status:~"5..",method:GET`.
+func ParseTagMatchers(filter string) (*SampleTags, []TagMatcher, error) {
+	tags := make(map[string]string)
+	var matchers []TagMatcher
+	for _, cond := range parseTagConditions(filter) {
+		if !cond.regexp {
+			tags[cond.key] = cond.value
 			continue
 		}
+		pattern, err := regexp.Compile("^(?:" + cond.value + ")$")
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid regular expression for the tag '%s': %s", cond.key, err)
+		}
+		matchers = append(matchers, TagMatcher{Key: cond.key, Pattern: pattern})
+	}
+	return IntoSampleTags(&tags), matchers, nil
+}
+
+// tagCondition is one of the comma-separated conditions of a tag filter.
+type tagCondition struct {
+	key, value string
+	regexp     bool
+}
 
-		value := strings.TrimSpace(strings.Trim(parts[1], `"'`))
-		tags[key] = value
+// parseTagConditions splits a tag filter into its conditions. Commas and colons in quoted keys
+// and values don't split them, so values can contain them, e.g. `group:"::a,b"`.
+func parseTagConditions(filter string) []tagCondition {
+	var conds []tagCondition
+	for _, kv := range splitUnquoted(filter, ',', -1) {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		parts := splitUnquoted(kv, ':', 2)
+		cond := tagCondition{key: unquoteTagFilter(parts[0])}
+		if len(parts) == 2 {
+			value := strings.TrimSpace(parts[1])
+			if strings.HasPrefix(value, "~") {
+				cond.regexp = true
+				value = value[1:]
+			}
+			cond.value = unquoteTagFilter(value)
+		}
+		conds = append(conds, cond)
+	}
+	return conds
+}
+
+// splitUnquoted works like strings.SplitN with a single separator, but ignores the separators
+// inside of single or double quotes.
+func splitUnquoted(s string, sep byte, n int) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s) && n != len(parts)+1; i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
 	}
-	return parts[0], &Submetric{Name: name, Parent: parts[0], Suffix: parts[1], Tags: IntoSampleTags(&tags)}
+	return append(parts, s[start:])
+}
+
+func unquoteTagFilter(s string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(s), `"'`))
 }
 
 func (m *Metric) Summary(t time.Duration) *Summary {
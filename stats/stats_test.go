@@ -23,10 +23,12 @@ package stats
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetricHumanizeValue(t *testing.T) {
@@ -166,35 +168,123 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestMetricHumanizeRate(t *testing.T) {
+	t.Parallel()
+	counter := &Metric{Type: Counter, Contains: Default}
+	assert.Equal(t, "41.13/s", counter.HumanizeRate(1234.0/30, ""))
+	assert.Equal(t, "1234/s", counter.HumanizeRate(1234, ""))
+	assert.Equal(t, "0.05/s", counter.HumanizeRate(0.049, ""))
+	assert.Equal(t, "0/s", counter.HumanizeRate(0, ""))
+
+	data := &Metric{Type: Counter, Contains: Data}
+	assert.Equal(t, "1.5 kB/s", data.HumanizeRate(1500, ""))
+}
+
+func TestValueTypeUnmarshalText(t *testing.T) {
+	t.Parallel()
+	for text, expected := range map[string]ValueType{"default": Default, "time": Time, "data": Data} {
+		var vt ValueType
+		if assert.NoError(t, vt.UnmarshalText([]byte(text)), text) {
+			assert.Equal(t, expected, vt, text)
+		}
+	}
+	var vt ValueType
+	assert.Equal(t, ErrInvalidValueType, vt.UnmarshalText([]byte("bytes")))
+}
+
 func TestNewSubmetric(t *testing.T) {
 	t.Parallel()
 	testdata := map[string]struct {
-		parent string
-		tags   map[string]string
+		parent   string
+		tags     map[string]string
+		matchers map[string]string
 	}{
-		"my_metric":                 {"my_metric", nil},
-		"my_metric{}":               {"my_metric", nil},
-		"my_metric{a}":              {"my_metric", map[string]string{"a": ""}},
-		"my_metric{a:1}":            {"my_metric", map[string]string{"a": "1"}},
-		"my_metric{ a : 1 }":        {"my_metric", map[string]string{"a": "1"}},
-		"my_metric{a,b}":            {"my_metric", map[string]string{"a": "", "b": ""}},
-		"my_metric{a:1,b:2}":        {"my_metric", map[string]string{"a": "1", "b": "2"}},
-		"my_metric{ a : 1, b : 2 }": {"my_metric", map[string]string{"a": "1", "b": "2"}},
+		"my_metric":                 {"my_metric", nil, nil},
+		"my_metric{}":               {"my_metric", nil, nil},
+		"my_metric{a}":              {"my_metric", map[string]string{"a": ""}, nil},
+		"my_metric{a:1}":            {"my_metric", map[string]string{"a": "1"}, nil},
+		"my_metric{ a : 1 }":        {"my_metric", map[string]string{"a": "1"}, nil},
+		"my_metric{a,b}":            {"my_metric", map[string]string{"a": "", "b": ""}, nil},
+		"my_metric{a:1,b:2}":        {"my_metric", map[string]string{"a": "1", "b": "2"}, nil},
+		"my_metric{ a : 1, b : 2 }": {"my_metric", map[string]string{"a": "1", "b": "2"}, nil},
+		`my_metric{a:"x,y:z"}`:      {"my_metric", map[string]string{"a": "x,y:z"}, nil},
+		`my_metric{group:"::checkout"}`: {
+			"my_metric", map[string]string{"group": "::checkout"}, nil,
+		},
+		`my_metric{status:~"5..", group:"::checkout"}`: {
+			"my_metric", map[string]string{"group": "::checkout"}, map[string]string{"status": "5.."},
+		},
+		`my_metric{a:~'x{1,2}', b : ~ y|z }`: {
+			"my_metric", nil, map[string]string{"a": "x{1,2}", "b": "y|z"},
+		},
 	}
 
 	for name, data := range testdata {
 		name, data := name, data
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			parent, sm := NewSubmetric(name)
+			parent, sm, err := NewSubmetric(name)
+			require.NoError(t, err)
 			assert.Equal(t, data.parent, parent)
 			if data.tags != nil {
 				assert.EqualValues(t, data.tags, sm.Tags.tags)
 			} else {
-				assert.Nil(t, sm.Tags)
+				assert.True(t, sm.Tags.IsEmpty())
 			}
+			matchers := map[string]string{}
+			for _, tm := range sm.Matchers {
+				matchers[tm.Key] = tm.Pattern.String()
+			}
+			for key, pattern := range data.matchers {
+				assert.Equal(t, "^(?:"+pattern+")$", matchers[key])
+			}
+			assert.Len(t, matchers, len(data.matchers))
 		})
 	}
+
+	t.Run("invalid regexp", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := NewSubmetric(`my_metric{status:~"5(.."}`)
+		assert.Error(t, err)
+	})
+}
+
+func TestSubmetricMatch(t *testing.T) {
+	t.Parallel()
+	_, sm, err := NewSubmetric(`my_metric{status:~"5..", group:"::checkout"}`)
+	require.NoError(t, err)
+
+	testdata := map[string]struct {
+		tags  map[string]string
+		match bool
+	}{
+		"match":       {map[string]string{"status": "503", "group": "::checkout", "name": "x"}, true},
+		"no group":    {map[string]string{"status": "503"}, false},
+		"other group": {map[string]string{"status": "503", "group": "::browse"}, false},
+		"no status":   {map[string]string{"group": "::checkout"}, false},
+		"partial":     {map[string]string{"status": "5030", "group": "::checkout"}, false},
+		"other":       {map[string]string{"status": "200", "group": "::checkout"}, false},
+	}
+	for name, data := range testdata {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, data.match, sm.Match(IntoSampleTags(&data.tags)))
+		})
+	}
+
+	data, err := json.Marshal(sm.Matchers)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"key":"status","pattern":"5.."}]`, string(data))
+}
+
+func TestParseTagFilter(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, ParseTagFilter(""))
+	assert.EqualValues(t, map[string]string{"scenario": "checkout", "status": "200"},
+		ParseTagFilter(`scenario: checkout,"status":'200'`).tags)
+	assert.EqualValues(t, map[string]string{"a": ""}, ParseTagFilter("a").tags)
+	assert.EqualValues(t, map[string]string{"a": "1"}, ParseTagFilter(`a:1,b:~"2|3"`).tags)
 }
 
 func TestSampleTags(t *testing.T) {
@@ -241,12 +331,12 @@ func TestSampleTags(t *testing.T) {
 	assert.False(t, tags.Contains(IntoSampleTags(&map[string]string{"key3": "val1"})))
 	assert.Equal(t, tagMap, tags.CloneTags())
 
-	assert.Nil(t, tags.json) // No cache
+	assert.Nil(t, tags.json.Load()) // No cache
 	tagsJSON, err := json.Marshal(tags)
 	expJSON := `{"key1":"val1","key2":"val2"}`
 	assert.NoError(t, err)
 	assert.JSONEq(t, expJSON, string(tagsJSON))
-	assert.JSONEq(t, expJSON, string(tags.json)) // Populated cache
+	assert.JSONEq(t, expJSON, string(tags.json.Load().([]byte))) // Populated cache
 
 	var tagsUnmarshaled *SampleTags
 	err = json.Unmarshal(tagsJSON, &tagsUnmarshaled)
@@ -257,6 +347,92 @@ func TestSampleTags(t *testing.T) {
 	assert.Equal(t, tagMap, tagsUnmarshaled.CloneTags())
 }
 
+func TestSampleMultiTags(t *testing.T) {
+	t.Parallel()
+
+	base := IntoSampleTags(&map[string]string{"key1": "val1", "flags": "replaced"})
+	assert.True(t, base.WithMultiTags(nil) == base)
+
+	tags := base.WithMultiTags(map[string][]string{"flags": {"b", "a", "b"}})
+	assert.False(t, tags.IsEqual(base))
+	assert.Equal(t, "replaced", base.CloneTags()["flags"]) // The original isn't changed
+	assert.Equal(t, map[string][]string{"flags": {"a", "b"}}, tags.CloneMultiTags())
+	assert.Equal(t, map[string]string{"key1": "val1", "flags": "a,b"}, tags.CloneTags())
+
+	flags, ok := tags.Get("flags")
+	assert.True(t, ok)
+	assert.Equal(t, "a,b", flags)
+	values, ok := tags.GetMulti("flags")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, values)
+	values, ok = tags.GetMulti("key1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"val1"}, values)
+	_, ok = tags.GetMulti("key2")
+	assert.False(t, ok)
+
+	assert.True(t, tags.IsEqual(IntoSampleTags(&map[string]string{"key1": "val1"}).
+		WithMultiTags(map[string][]string{"flags": {"a", "b"}})))
+	assert.False(t, tags.IsEqual(base.WithMultiTags(map[string][]string{"flags": {"a", "c"}})))
+
+	assert.True(t, tags.Contains(IntoSampleTags(&map[string]string{"flags": "a"})))
+	assert.True(t, tags.Contains(IntoSampleTags(&map[string]string{"flags": "b", "key1": "val1"})))
+	assert.False(t, tags.Contains(IntoSampleTags(&map[string]string{"flags": "c"})))
+	assert.False(t, tags.Contains(IntoSampleTags(&map[string]string{"flags": "a,b"})))
+	assert.True(t, tags.Contains((*SampleTags)(nil).WithMultiTags(map[string][]string{"flags": {"b"}})))
+	assert.False(t, base.Contains((*SampleTags)(nil).WithMultiTags(map[string][]string{"flags": {"b"}})))
+
+	tagsJSON, err := json.Marshal(tags)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"key1":"val1","flags":["a","b"]}`, string(tagsJSON))
+
+	var tagsUnmarshaled *SampleTags
+	require.NoError(t, json.Unmarshal([]byte(`{"key1":"val1","flags":["b","a"]}`), &tagsUnmarshaled))
+	assert.True(t, tagsUnmarshaled.IsEqual(tags))
+	assert.Error(t, json.Unmarshal([]byte(`{"flags":[1]}`), &tagsUnmarshaled))
+}
+
+func TestSampleTagsIntern(t *testing.T) {
+	t.Parallel()
+
+	tags := IntoSampleTags(&map[string]string{"intern": "a", "other": "b"})
+	assert.True(t, tags == NewSampleTags(map[string]string{"other": "b", "intern": "a"}))
+	assert.NotZero(t, tags.Hash())
+	assert.Zero(t, (*SampleTags)(nil).Hash())
+
+	multi := IntoSampleTags(&map[string]string{"intern": "a"}).WithMultiTags(map[string][]string{"flags": {"y", "x"}})
+	assert.True(t, multi == IntoSampleTags(&map[string]string{"intern": "a"}).WithMultiTags(map[string][]string{"flags": {"x", "y", "x"}}))
+	assert.False(t, multi.IsEqual(IntoSampleTags(&map[string]string{"intern": "a", "flags": "x,y"})))
+	assert.NotEqual(t, multi.Hash(), IntoSampleTags(&map[string]string{"intern": "a", "flags": "x,y"}).Hash())
+
+	// The lengths of the keys and values keep them from running into each other.
+	assert.False(t, IntoSampleTags(&map[string]string{"a": "b1:c"}).IsEqual(IntoSampleTags(&map[string]string{"a": "b", "c": ""})))
+
+	var unmarshaled SampleTags
+	require.NoError(t, json.Unmarshal([]byte(`{"other":"b","intern":"a"}`), &unmarshaled))
+	assert.False(t, &unmarshaled == tags)
+	assert.True(t, unmarshaled.IsEqual(tags))
+	assert.Equal(t, tags.Hash(), unmarshaled.Hash())
+	assert.True(t, unmarshaled.Intern() == tags)
+	assert.EqualError(t, json.Unmarshal([]byte(`{"intern":"b"}`), tags), "can't unmarshal into an interned tag set")
+	assert.Equal(t, map[string]string{"intern": "a", "other": "b"}, tags.CloneTags())
+
+	var wg sync.WaitGroup
+	results := make([]*SampleTags, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = IntoSampleTags(&map[string]string{"intern": "concurrent"})
+			_, _ = results[i].MarshalJSON()
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range results {
+		assert.True(t, res == results[0])
+	}
+}
+
 func TestSampleImplementations(t *testing.T) {
 	tagMap := map[string]string{"key1": "val1", "key2": "val2"}
 	now := time.Now()
@@ -28,19 +28,23 @@ import (
 
 // Sample defines a sample type
 type Sample struct {
-	Type   stats.MetricType  `json:"type"`
-	Metric string            `json:"metric"`
-	Time   time.Time         `json:"time"`
-	Value  float64           `json:"value"`
-	Tags   map[string]string `json:"tags,omitempty"`
+	Type      stats.MetricType    `json:"type"`
+	Contains  stats.ValueType     `json:"contains"`
+	Metric    string              `json:"metric"`
+	Time      time.Time           `json:"time"`
+	Value     float64             `json:"value"`
+	Tags      map[string]string   `json:"tags,omitempty"`
+	MultiTags map[string][]string `json:"multiTags,omitempty"`
 }
 
 func generateDataPoint(sample stats.Sample) *Sample {
 	return &Sample{
-		Type:   sample.Metric.Type,
-		Metric: sample.Metric.Name,
-		Time:   sample.Time,
-		Value:  sample.Value,
-		Tags:   sample.Tags.CloneTags(),
+		Type:      sample.Metric.Type,
+		Contains:  sample.Metric.Contains,
+		Metric:    sample.Metric.Name,
+		Time:      sample.Time,
+		Value:     sample.Value,
+		Tags:      sample.Tags.CloneTags(),
+		MultiTags: sample.Tags.CloneMultiTags(),
 	}
 }
@@ -38,9 +38,10 @@ var _ lib.Collector = &Collector{}
 type Collector struct {
 	Config Config
 	Type   string
-	// ProcessTags is called on a map of all tags for each metric and returns a slice representation
-	// of those tags that should be sent. No tags are send in case of ProcessTags being null
-	ProcessTags func(map[string]string) []string
+	// ProcessTags is called on a map of all tags for each metric, along with the values of the
+	// multi-value ones, and returns a slice representation of those tags that should be sent.
+	// No tags are send in case of ProcessTags being null
+	ProcessTags func(tags map[string]string, multiTags map[string][]string) []string
 
 	logger     *log.Entry
 	client     *statsd.Client
@@ -172,14 +173,19 @@ func (c *Collector) commit(data []*Sample) error {
 func (c *Collector) dispatch(entry *Sample) error {
 	var tagList []string
 	if c.ProcessTags != nil {
-		tagList = c.ProcessTags(entry.Tags)
+		tagList = c.ProcessTags(entry.Tags, entry.MultiTags)
 	}
 
 	switch entry.Type {
 	case stats.Counter:
 		return c.client.Count(entry.Metric, int64(entry.Value), tagList, 1)
 	case stats.Trend:
-		return c.client.TimeInMilliseconds(entry.Metric, entry.Value, tagList, 1)
+		// Only the times are sent as timings, in ms, the data amounts and plain numbers would be
+		// shown with the wrong unit otherwise.
+		if entry.Contains == stats.Time {
+			return c.client.TimeInMilliseconds(entry.Metric, entry.Value, tagList, 1)
+		}
+		return c.client.Histogram(entry.Metric, entry.Value, tagList, 1)
 	case stats.Gauge:
 		return c.client.Gauge(entry.Metric, entry.Value, tagList, 1)
 	case stats.Rate:
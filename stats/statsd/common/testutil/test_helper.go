@@ -65,7 +65,8 @@ func BaseTest(t *testing.T,
 
 	myCounter := stats.New("my_counter", stats.Counter)
 	myGauge := stats.New("my_gauge", stats.Gauge)
-	myTrend := stats.New("my_trend", stats.Trend)
+	myTrend := stats.New("my_trend", stats.Trend, stats.Time)
+	mySize := stats.New("my_size", stats.Trend, stats.Data)
 	myRate := stats.New("my_rate", stats.Rate)
 	myCheck := stats.New("my_check", stats.Rate)
 	var testMatrix = []struct {
@@ -99,6 +100,15 @@ func BaseTest(t *testing.T,
 			},
 			output: "testing.things.my_trend:14.000000|ms",
 		},
+		{
+			input: []stats.SampleContainer{
+				newSample(mySize, 1024, map[string]string{
+					"tag1": "value1",
+					"tag3": "value3",
+				}),
+			},
+			output: "testing.things.my_size:1024.000000|h",
+		},
 		{
 			input: []stats.SampleContainer{
 				newSample(myRate, 15, map[string]string{
@@ -0,0 +1,187 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// DefaultTDigestCompression is the compression of the t-digests of trend metrics, see TDigest.
+const DefaultTDigestCompression = 100
+
+// A TDigestCentroid is the mean of a number of adjacent values in a TDigest.
+type TDigestCentroid struct {
+	Mean  float64 `json:"mean"`
+	Count uint64  `json:"count"`
+}
+
+// A TDigest is a merging t-digest of float64 values. Adjacent values are summarized in centroids,
+// which are smaller at the tails of the distribution, so the extreme percentiles stay accurate. It
+// keeps at most a few times Compression centroids no matter how many values it records, and two
+// digests can be merged without losing more accuracy, e.g. the ones of several k6 instances.
+type TDigest struct {
+	Compression float64           `json:"compression"`
+	Centroids   []TDigestCentroid `json:"centroids"`
+	Count       uint64            `json:"count"`
+	Min         float64           `json:"min"`
+	Max         float64           `json:"max"`
+
+	unmerged []TDigestCentroid
+}
+
+// NewTDigest returns an empty t-digest with the given compression, or DefaultTDigestCompression.
+func NewTDigest(compression float64) *TDigest {
+	if compression <= 0 {
+		compression = DefaultTDigestCompression
+	}
+	return &TDigest{Compression: compression}
+}
+
+// MarshalJSON merges the buffered values into the centroids before serializing the digest.
+func (d *TDigest) MarshalJSON() ([]byte, error) {
+	d.compress()
+	type plain TDigest
+	return json.Marshal((*plain)(d))
+}
+
+// Add records a single value.
+func (d *TDigest) Add(v float64) {
+	d.add(TDigestCentroid{Mean: v, Count: 1}, v, v)
+}
+
+// Merge adds all of the values recorded by another digest.
+func (d *TDigest) Merge(other *TDigest) {
+	other.compress()
+	if other.Count == 0 {
+		return
+	}
+	for i, c := range other.Centroids {
+		// The extremes of the other digest only have to be taken into account once.
+		if i == 0 {
+			d.add(c, other.Min, other.Max)
+		} else {
+			d.add(c, c.Mean, c.Mean)
+		}
+	}
+}
+
+func (d *TDigest) add(c TDigestCentroid, min, max float64) {
+	if d.Count == 0 || min < d.Min {
+		d.Min = min
+	}
+	if d.Count == 0 || max > d.Max {
+		d.Max = max
+	}
+	d.Count += c.Count
+	d.unmerged = append(d.unmerged, c)
+	if float64(len(d.unmerged)) >= 5*d.compression() {
+		d.compress()
+	}
+}
+
+func (d *TDigest) compression() float64 {
+	if d.Compression <= 0 {
+		return DefaultTDigestCompression
+	}
+	return d.Compression
+}
+
+// scale is the k1 scale function of the t-digest paper. Neighbouring values can only be merged
+// into a centroid if their quantiles are less than a unit apart on this scale.
+func (d *TDigest) scale(q float64) float64 {
+	return d.compression() / (2 * math.Pi) * math.Asin(2*math.Min(1, q)-1)
+}
+
+// compress merges the buffered values with the centroids.
+func (d *TDigest) compress() {
+	if len(d.unmerged) == 0 {
+		return
+	}
+	all := append(append(make([]TDigestCentroid, 0, len(d.Centroids)+len(d.unmerged)), d.Centroids...), d.unmerged...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	total := float64(d.Count)
+	merged := make([]TDigestCentroid, 0, len(d.Centroids))
+	cur, done := all[0], 0.0
+	low := d.scale(0)
+	for _, c := range all[1:] {
+		if d.scale((done+float64(cur.Count+c.Count))/total)-low <= 1 {
+			cur.Count += c.Count
+			cur.Mean += (c.Mean - cur.Mean) * float64(c.Count) / float64(cur.Count)
+			continue
+		}
+		merged = append(merged, cur)
+		done += float64(cur.Count)
+		low = d.scale(done / total)
+		cur = c
+	}
+	d.Centroids = append(merged, cur)
+	d.unmerged = d.unmerged[:0]
+}
+
+// Quantile estimates the value at the given quantile, the same way TrendSink.P interpolates it
+// between the sorted values. The values of a centroid are assumed to be spread evenly around its
+// mean, so the results are exact as long as all centroids have a single value.
+func (d *TDigest) Quantile(q float64) float64 {
+	d.compress()
+	switch {
+	case d.Count == 0:
+		return 0
+	case q <= 0:
+		return d.Min
+	case q >= 1:
+		return d.Max
+	}
+
+	// The centroids are points at the middle of the ranks that they cover, and the extremes are the
+	// first and last ranks, so a single value centroid at rank i is at i+0.5.
+	rank := q*float64(d.Count-1) + 0.5
+	prevMean, prevCenter := d.Min, 0.5
+	var seen float64
+	for _, c := range d.Centroids {
+		center := seen + float64(c.Count)/2
+		if c.Count == 1 {
+			center = seen + 0.5
+		}
+		if rank <= center {
+			if center == prevCenter {
+				return c.Mean
+			}
+			return prevMean + (c.Mean-prevMean)*(rank-prevCenter)/(center-prevCenter)
+		}
+		prevMean, prevCenter = c.Mean, center
+		seen += float64(c.Count)
+	}
+	end := float64(d.Count) - 0.5
+	if end <= prevCenter {
+		return d.Max
+	}
+	return prevMean + (d.Max-prevMean)*(rank-prevCenter)/(end-prevCenter)
+}
+
+// ForEach calls fn with the mean and the number of values of every centroid, in order.
+func (d *TDigest) ForEach(fn func(value float64, count uint64)) {
+	d.compress()
+	for _, c := range d.Centroids {
+		fn(c.Mean, c.Count)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package stats
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTDigest(t *testing.T) {
+	t.Run("Exact", func(t *testing.T) {
+		d, exact := NewTDigest(0), NewTrendSink(0)
+		for _, v := range []float64{5, 1, 3, 10, -2} {
+			d.Add(v)
+			exact.Add(Sample{Value: v})
+		}
+		assert.Equal(t, float64(DefaultTDigestCompression), d.Compression)
+		for _, q := range []float64{0, 0.1, 0.25, 0.5, 0.9, 0.95, 1} {
+			assert.InDelta(t, exact.P(q), d.Quantile(q), 1e-9, "quantile %v", q)
+		}
+		assert.Equal(t, 0.0, NewTDigest(0).Quantile(0.5))
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		d, exact := NewTDigest(DefaultTDigestCompression), NewTrendSink(0)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100000; i++ {
+			v := r.ExpFloat64() * 200
+			d.Add(v)
+			exact.Add(Sample{Value: v})
+		}
+		d.compress()
+		assert.True(t, len(d.Centroids) < 5*DefaultTDigestCompression, len(d.Centroids))
+		assert.Equal(t, uint64(100000), d.Count)
+		for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+			assert.InEpsilon(t, exact.P(q), d.Quantile(q), 0.01, "quantile %v", q)
+		}
+		assert.Equal(t, exact.Min, d.Quantile(0))
+		assert.Equal(t, exact.Max, d.Quantile(1))
+
+		var total uint64
+		d.ForEach(func(value float64, count uint64) { total += count })
+		assert.Equal(t, d.Count, total)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		whole, parts := NewTDigest(0), []*TDigest{NewTDigest(0), NewTDigest(0), NewTDigest(0)}
+		r := rand.New(rand.NewSource(2))
+		for i := 0; i < 30000; i++ {
+			v := r.NormFloat64()*50 + 500
+			whole.Add(v)
+			parts[i%len(parts)].Add(v)
+		}
+		merged := NewTDigest(0)
+		for _, part := range parts {
+			merged.Merge(part)
+		}
+		merged.Merge(NewTDigest(0))
+		assert.Equal(t, whole.Count, merged.Count)
+		assert.Equal(t, whole.Min, merged.Min)
+		assert.Equal(t, whole.Max, merged.Max)
+		for _, q := range []float64{0.1, 0.5, 0.9, 0.99} {
+			assert.InEpsilon(t, whole.Quantile(q), merged.Quantile(q), 0.005, "quantile %v", q)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		d := NewTDigest(50)
+		for _, v := range []float64{5, 1, 3} {
+			d.Add(v)
+		}
+		data, err := json.Marshal(d)
+		require.NoError(t, err)
+
+		var restored TDigest
+		require.NoError(t, json.Unmarshal(data, &restored))
+		restored.Add(2)
+		assert.Equal(t, 50.0, restored.Compression)
+		assert.Equal(t, uint64(4), restored.Count)
+		assert.Equal(t, 2.5, restored.Quantile(0.5))
+	})
+}
+
+func TestTrendSinkDigest(t *testing.T) {
+	exact, digest := NewTrendSink(0), NewTDigestTrendSink(0)
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 50000; i++ {
+		s := Sample{Value: r.ExpFloat64() * 200}
+		exact.Add(s)
+		digest.Add(s)
+	}
+	assert.Nil(t, digest.Values)
+	assert.Nil(t, digest.Histogram)
+
+	exactStats, digestStats := exact.Format(0), digest.Format(0)
+	for _, stat := range []string{"min", "max", "avg"} {
+		assert.Equal(t, exactStats[stat], digestStats[stat], stat)
+	}
+	for _, stat := range []string{"med", "p(90)", "p(95)"} {
+		assert.InEpsilon(t, exactStats[stat], digestStats[stat], 0.01, stat)
+	}
+
+	data, err := json.Marshal(digest)
+	require.NoError(t, err)
+	restored, err := UnmarshalSink(Trend, data)
+	require.NoError(t, err)
+	assert.Equal(t, digestStats, restored.Format(0))
+}
+
+func TestTrendSinkMerge(t *testing.T) {
+	for name, newSink := range map[string]func() *TrendSink{
+		"exact":     func() *TrendSink { return NewTrendSink(0) },
+		"histogram": func() *TrendSink { return NewTrendSink(DefaultTrendPrecision) },
+		"tdigest":   func() *TrendSink { return NewTDigestTrendSink(0) },
+	} {
+		newSink := newSink
+		t.Run(name, func(t *testing.T) {
+			whole, a, b := newSink(), newSink(), newSink()
+			for i, v := range []float64{4, 8, 1, 2, 9, 3} {
+				whole.Add(Sample{Value: v})
+				if i%2 == 0 {
+					a.Add(Sample{Value: v})
+				} else {
+					b.Add(Sample{Value: v})
+				}
+			}
+			require.NoError(t, a.Merge(b))
+			require.NoError(t, a.Merge(newSink()))
+			assert.Equal(t, whole.Format(0), a.Format(0))
+			assert.Equal(t, whole.Count, a.Count)
+		})
+	}
+
+	assert.Error(t, NewTrendSink(0).Merge(NewTDigestTrendSink(0)))
+	assert.Error(t, NewTrendSink(2).Merge(NewTrendSink(3)))
+	assert.Error(t, NewTDigestTrendSink(0).Merge(NewTrendSink(3)))
+}
@@ -22,6 +22,10 @@ package stats
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dop251/goja"
@@ -29,12 +33,52 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Any percentile can be referenced with p(), including fractional ones like p(99.99), but only
+// for trend metrics. Other metrics can be referenced with metric(name), see SetMetrics().
 const jsEnvSrc = `
 function p(pct) {
+	if (typeof __sink__.P !== "function") {
+		throw new Error("percentiles are only available for trend metrics");
+	}
+	if (!(pct >= 0 && pct <= 100)) {
+		throw new Error("the percentile must be between 0 and 100, not " + pct);
+	}
 	return __sink__.P(pct/100.0);
 };
+
+var __metrics__ = {};
+function metric(name) {
+	var m = __metrics__[name];
+	if (m === undefined) {
+		throw new Error("there are no samples of the metric '" + name + "' yet");
+	}
+	return m;
+};
+
+var __global__ = this;
+function __isGlobal__(name) {
+	return Object.prototype.hasOwnProperty.call(__global__, name);
+};
 `
 
+// Matches the references to other metrics in threshold sources, i.e. a property of an identifier,
+// like checks.rate, or a call of metric().
+var metricReferenceRE = regexp.MustCompile(`(^|[^\w$.])[A-Za-z_$][\w$]*\s*\.\s*[A-Za-z_$]|\bmetric\(`)
+
+// Matches the metric names that can be referenced as global objects in threshold sources.
+var identifierRE = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// The values of the metric that the thresholds are defined for, which are globals as well, so
+// metrics with these names can only be referenced with metric(name).
+var thresholdValueNames = map[string]bool{
+	"count": true, "rate": true, "value": true, "min": true, "max": true, "avg": true, "med": true,
+	"increase": true,
+}
+
+// Matches the percentiles referenced in threshold sources, so the literal ones can be checked
+// before the test starts.
+var percentileRE = regexp.MustCompile(`\bp\(([^()]*)\)`)
+
 var jsEnv *goja.Program
 
 func init() {
@@ -56,13 +100,43 @@ type Threshold struct {
 	// AbortGracePeriod is a the minimum amount of time a test should be running before a failing
 	// this threshold will abort the test
 	AbortGracePeriod types.NullDuration
+	// Interval is how often this threshold is evaluated, if it differs from the test-wide interval
+	Interval types.NullDuration
 
 	pgm *goja.Program
 	rt  *goja.Runtime
+
+	// When the threshold was last evaluated, on the schedule used by RunDue()
+	lastRun time.Duration
+	ran     bool
+
+	// The window that the values are evaluated over, for sources like "rate<100/s over 1m"
+	window time.Duration
+	// Whether the source references increase, the change of the value over the window
+	increase bool
+	// The snapshots of the values that the windows can start at, see windowStart()
+	history []windowSnapshot
 }
 
-func newThreshold(src string, newThreshold *goja.Runtime, abortOnFail bool, gracePeriod types.NullDuration) (*Threshold, error) {
-	pgm, err := goja.Compile("__threshold__", src, true)
+func newThreshold(
+	src string, newThreshold *goja.Runtime, abortOnFail bool, gracePeriod, interval types.NullDuration,
+) (*Threshold, error) {
+	if interval.Valid && interval.Duration <= 0 {
+		return nil, errors.Errorf("the evaluation interval must be positive, not %s", interval.Duration)
+	}
+	if gracePeriod.Valid && gracePeriod.Duration < 0 {
+		return nil, errors.Errorf("delayAbortEval can't be negative, but is %s", gracePeriod.Duration)
+	}
+
+	expr, window, err := parseThresholdSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPercentiles(expr); err != nil {
+		return nil, err
+	}
+
+	pgm, err := goja.Compile("__threshold__", expr, true)
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +145,29 @@ func newThreshold(src string, newThreshold *goja.Runtime, abortOnFail bool, grac
 		Source:           src,
 		AbortOnFail:      abortOnFail,
 		AbortGracePeriod: gracePeriod,
+		Interval:         interval,
 		pgm:              pgm,
 		rt:               newThreshold,
+		window:           window,
+		increase:         increaseRE.MatchString(expr),
 	}, nil
 }
 
+// checkPercentiles returns an error if the source references a literal percentile that isn't
+// between 0 and 100. Percentiles that are computed by the expression are checked when it runs.
+func checkPercentiles(src string) error {
+	for _, match := range percentileRE.FindAllStringSubmatch(src, -1) {
+		pct, err := strconv.ParseFloat(strings.TrimSpace(match[1]), 64)
+		if err != nil {
+			continue
+		}
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("'%s' isn't a valid percentile, it has to be between 0 and 100", match[0])
+		}
+	}
+	return nil
+}
+
 func (t Threshold) runNoTaint() (bool, error) {
 	v, err := t.rt.RunProgram(t.pgm)
 	if err != nil {
@@ -94,6 +186,7 @@ type thresholdConfig struct {
 	Threshold        string             `json:"threshold"`
 	AbortOnFail      bool               `json:"abortOnFail"`
 	AbortGracePeriod types.NullDuration `json:"delayAbortEval"`
+	Interval         *types.Duration    `json:"interval,omitempty"`
 }
 
 //used internally for JSON marshalling
@@ -110,7 +203,7 @@ func (tc *thresholdConfig) UnmarshalJSON(data []byte) error {
 }
 
 func (tc thresholdConfig) MarshalJSON() ([]byte, error) {
-	if tc.AbortOnFail {
+	if tc.AbortOnFail || tc.AbortGracePeriod.Valid || tc.Interval != nil {
 		return json.Marshal(rawThresholdConfig(tc))
 	}
 	return json.Marshal(tc.Threshold)
@@ -121,6 +214,9 @@ type Thresholds struct {
 	Runtime    *goja.Runtime
 	Thresholds []*Threshold
 	Abort      bool
+
+	// The names of the metrics that SetMetrics() has made globals.
+	metricGlobals map[string]bool
 }
 
 // NewThresholds returns Thresholds objects representing the provided source strings
@@ -141,14 +237,18 @@ func newThresholdsWithConfig(configs []thresholdConfig) (Thresholds, error) {
 
 	ts := make([]*Threshold, len(configs))
 	for i, config := range configs {
-		t, err := newThreshold(config.Threshold, rt, config.AbortOnFail, config.AbortGracePeriod)
+		var interval types.NullDuration
+		if config.Interval != nil {
+			interval = types.NullDuration{Duration: *config.Interval, Valid: true}
+		}
+		t, err := newThreshold(config.Threshold, rt, config.AbortOnFail, config.AbortGracePeriod, interval)
 		if err != nil {
 			return Thresholds{}, errors.Wrapf(err, "%d", i)
 		}
 		ts[i] = t
 	}
 
-	return Thresholds{rt, ts, false}, nil
+	return Thresholds{Runtime: rt, Thresholds: ts, metricGlobals: make(map[string]bool)}, nil
 }
 
 func (ts *Thresholds) updateVM(sink Sink, t time.Duration) error {
@@ -160,10 +260,18 @@ func (ts *Thresholds) updateVM(sink Sink, t time.Duration) error {
 	return nil
 }
 
-func (ts *Thresholds) runAll(t time.Duration) (bool, error) {
+func (ts *Thresholds) runAll(sink Sink, t time.Duration) (bool, error) {
+	return ts.runWhere(sink, t, func(*Threshold) bool { return true })
+}
+
+func (ts *Thresholds) runWhere(sink Sink, t time.Duration, due func(th *Threshold) bool) (bool, error) {
 	succ := true
 	for i, th := range ts.Thresholds {
-		b, err := th.run()
+		if !due(th) {
+			succ = succ && !th.LastFailed
+			continue
+		}
+		b, err := ts.runThreshold(th, sink, t)
 		if err != nil {
 			return false, errors.Wrapf(err, "%d", i)
 		}
@@ -181,13 +289,131 @@ func (ts *Thresholds) runAll(t time.Duration) (bool, error) {
 	return succ, nil
 }
 
+// runThreshold runs th with the values over its window, if it has one, and restores the
+// cumulative values for the other thresholds afterwards.
+func (ts *Thresholds) runThreshold(th *Threshold, sink Sink, t time.Duration) (bool, error) {
+	if sink == nil || (th.window == 0 && !th.increase) {
+		return th.run()
+	}
+
+	values := th.windowValues(sink, t)
+	for k, v := range values {
+		ts.Runtime.Set(k, v)
+	}
+	b, err := th.run()
+	f := sink.Format(t)
+	for k := range values {
+		if v, ok := f[k]; ok {
+			ts.Runtime.Set(k, v)
+		}
+	}
+	return b, err
+}
+
+// ReferencesMetrics returns whether any of the thresholds may reference other metrics, which
+// then have to be set with SetMetrics() before the thresholds are run.
+func (ts *Thresholds) ReferencesMetrics() bool {
+	for _, th := range ts.Thresholds {
+		if metricReferenceRE.MatchString(th.Source) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMetrics makes the values of the given metrics available to the threshold expressions, so
+// they can combine several metrics, e.g. "checks.rate > 0.99 && http_req_duration.p(95) < 300".
+// Metrics are objects with the same values as the ones of the metric the thresholds are
+// defined for, and a p() function for trends. They can always be accessed with metric(name),
+// e.g. metric("http_req_duration{status:200}"), and they're also globals if their name is an
+// identifier that isn't taken already, by a JS builtin like Math or by a value like rate.
+func (ts *Thresholds) SetMetrics(sinks map[string]Sink, t time.Duration) {
+	rt := ts.Runtime
+	if ts.metricGlobals == nil {
+		ts.metricGlobals = make(map[string]bool)
+	}
+	all := rt.NewObject()
+	for name, sink := range sinks {
+		obj := rt.NewObject()
+		for k, v := range sink.Format(t) {
+			_ = obj.Set(k, v)
+		}
+		if trend, ok := sink.(*TrendSink); ok {
+			_ = obj.Set("p", func(pct float64) (float64, error) {
+				if !(pct >= 0 && pct <= 100) {
+					return 0, fmt.Errorf("the percentile must be between 0 and 100, not %g", pct)
+				}
+				return trend.P(pct / 100), nil
+			})
+		}
+		_ = all.Set(name, obj)
+
+		if ts.canBeGlobal(name) {
+			rt.Set(name, obj)
+			ts.metricGlobals[name] = true
+		}
+	}
+	rt.Set("__metrics__", all)
+}
+
+// canBeGlobal returns whether the metric with the given name can be a global without replacing
+// anything else that the threshold sources may reference.
+func (ts *Thresholds) canBeGlobal(name string) bool {
+	if !identifierRE.MatchString(name) || thresholdValueNames[name] {
+		return false
+	}
+	if ts.metricGlobals[name] {
+		return true
+	}
+	isGlobal, ok := goja.AssertFunction(ts.Runtime.Get("__isGlobal__"))
+	if !ok {
+		return false
+	}
+	v, err := isGlobal(goja.Undefined(), ts.Runtime.ToValue(name))
+	return err == nil && !v.ToBoolean()
+}
+
 // Run processes all the thresholds with the provided Sink at the provided time and returns if any
 // of them fails
 func (ts *Thresholds) Run(sink Sink, t time.Duration) (bool, error) {
 	if err := ts.updateVM(sink, t); err != nil {
 		return false, err
 	}
-	return ts.runAll(t)
+	return ts.runAll(sink, t)
+}
+
+// RunDue is like Run, but only evaluates the thresholds whose interval (or the supplied default
+// one, if they don't have their own) has passed since they were last evaluated. The at parameter
+// is the current point on the evaluation schedule, not the test time. Thresholds that aren't due
+// keep the result of their last evaluation.
+func (ts *Thresholds) RunDue(sink Sink, t, at, defaultInterval time.Duration) (bool, error) {
+	due := func(th *Threshold) bool {
+		interval := defaultInterval
+		if th.Interval.Valid {
+			interval = time.Duration(th.Interval.Duration)
+		}
+		if th.ran && at-th.lastRun < interval {
+			return false
+		}
+		th.ran, th.lastRun = true, at
+		return true
+	}
+	if err := ts.updateVM(sink, t); err != nil {
+		return false, err
+	}
+	return ts.runWhere(sink, t, due)
+}
+
+// MinInterval returns the shortest evaluation interval of these thresholds, or the supplied
+// default one if none of them is shorter than it.
+func (ts *Thresholds) MinInterval(defaultInterval time.Duration) time.Duration {
+	min := defaultInterval
+	for _, th := range ts.Thresholds {
+		if th.Interval.Valid && time.Duration(th.Interval.Duration) < min {
+			min = time.Duration(th.Interval.Duration)
+		}
+	}
+	return min
 }
 
 // UnmarshalJSON is implementation of json.Unmarshaler
@@ -211,6 +437,10 @@ func (ts Thresholds) MarshalJSON() ([]byte, error) {
 		configs[i].Threshold = t.Source
 		configs[i].AbortOnFail = t.AbortOnFail
 		configs[i].AbortGracePeriod = t.AbortGracePeriod
+		if t.Interval.Valid {
+			interval := t.Interval.Duration
+			configs[i].Interval = &interval
+		}
 	}
 	return json.Marshal(configs)
 }
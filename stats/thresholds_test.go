@@ -28,6 +28,7 @@ import (
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewThreshold(t *testing.T) {
@@ -35,7 +36,7 @@ func TestNewThreshold(t *testing.T) {
 	rt := goja.New()
 	abortOnFail := false
 	gracePeriod := types.NullDurationFrom(2 * time.Second)
-	th, err := newThreshold(src, rt, abortOnFail, gracePeriod)
+	th, err := newThreshold(src, rt, abortOnFail, gracePeriod, types.NullDuration{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, src, th.Source)
@@ -48,7 +49,7 @@ func TestNewThreshold(t *testing.T) {
 
 func TestThresholdRun(t *testing.T) {
 	t.Run("true", func(t *testing.T) {
-		th, err := newThreshold(`1+1==2`, goja.New(), false, types.NullDuration{})
+		th, err := newThreshold(`1+1==2`, goja.New(), false, types.NullDuration{}, types.NullDuration{})
 		assert.NoError(t, err)
 
 		t.Run("no taint", func(t *testing.T) {
@@ -67,7 +68,7 @@ func TestThresholdRun(t *testing.T) {
 	})
 
 	t.Run("false", func(t *testing.T) {
-		th, err := newThreshold(`1+1==4`, goja.New(), false, types.NullDuration{})
+		th, err := newThreshold(`1+1==4`, goja.New(), false, types.NullDuration{}, types.NullDuration{})
 		assert.NoError(t, err)
 
 		t.Run("no taint", func(t *testing.T) {
@@ -115,8 +116,8 @@ func TestNewThresholdsWithConfig(t *testing.T) {
 	})
 	t.Run("two", func(t *testing.T) {
 		configs := []thresholdConfig{
-			{`1+1==2`, false, types.NullDuration{}},
-			{`1+1==4`, true, types.NullDuration{}},
+			{`1+1==2`, false, types.NullDuration{}, nil},
+			{`1+1==4`, true, types.NullDuration{}, nil},
 		}
 		ts, err := newThresholdsWithConfig(configs)
 		assert.NoError(t, err)
@@ -170,7 +171,7 @@ func TestThresholdsRunAll(t *testing.T) {
 
 			assert.NoError(t, err)
 
-			b, err := ts.runAll(runDuration)
+			b, err := ts.runAll(DummySink{}, runDuration)
 
 			if data.err {
 				assert.Error(t, err)
@@ -216,6 +217,203 @@ func TestThresholdsRun(t *testing.T) {
 	})
 }
 
+func TestThresholdsCounterRate(t *testing.T) {
+	ts, err := NewThresholds([]string{"rate>500"})
+	require.NoError(t, err)
+	sink := &CounterSink{Value: 12000}
+
+	b, err := ts.Run(sink, 0)
+	require.NoError(t, err)
+	assert.False(t, b)
+
+	b, err = ts.Run(sink, 20*time.Second)
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	b, err = ts.Run(sink, 30*time.Second)
+	require.NoError(t, err)
+	assert.False(t, b)
+}
+
+func TestThresholdsPercentiles(t *testing.T) {
+	sink := &TrendSink{}
+	for i := 1; i <= 10000; i++ {
+		sink.Add(Sample{Value: float64(i)})
+	}
+
+	testdata := map[string]bool{
+		"p(50)<5001":               true,
+		"p(50)<5000":               false,
+		"p(99.99)<10000":           true,
+		"p(99.99)<9998":            false,
+		"p(0)==1 && p(100)==10000": true,
+		"p( 99.9 )>9990":           true,
+		"p(90+9)<9902":             true,
+	}
+	for src, expected := range testdata {
+		src, expected := src, expected
+		t.Run(src, func(t *testing.T) {
+			ts, err := NewThresholds([]string{src})
+			require.NoError(t, err)
+			b, err := ts.Run(sink, 0)
+			require.NoError(t, err)
+			assert.Equal(t, expected, b)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, src := range []string{"p(150)<1", "p(-1)<1", "avg<1 || p(100.1)<1"} {
+			_, err := NewThresholds([]string{src})
+			assert.Error(t, err, src)
+		}
+	})
+	t.Run("computed out of range", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"p(100*2)<1"})
+		require.NoError(t, err)
+		_, err = ts.Run(sink, 0)
+		assert.Contains(t, err.Error(), "the percentile must be between 0 and 100, not 200")
+	})
+	t.Run("not a trend", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"p(95)<1"})
+		require.NoError(t, err)
+		_, err = ts.Run(&CounterSink{}, 0)
+		assert.Contains(t, err.Error(), "percentiles are only available for trend metrics")
+	})
+}
+
+func TestThresholdsWindow(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		testdata := map[string]struct {
+			expr   string
+			window time.Duration
+		}{
+			"rate<100/s over 1m":      {"rate<(100/1)", time.Minute},
+			"rate < 6000 / m":         {"rate < (6000/60)", 0},
+			"count>0   over 1m30s  ":  {"count>0", 90 * time.Second},
+			"rate<0.5/ms&&increase>0": {"rate<(0.5/0.001)&&increase>0", 0},
+		}
+		for src, data := range testdata {
+			expr, window, err := parseThresholdSource(src)
+			require.NoError(t, err, src)
+			assert.Equal(t, data.expr, expr, src)
+			assert.Equal(t, data.window, window, src)
+		}
+
+		for _, src := range []string{"rate<1 over 1x", "rate<1 over -1m", "p(95)<200 over 1m", "max<1 over 1m"} {
+			_, err := NewThresholds([]string{src})
+			assert.Error(t, err, src)
+		}
+	})
+
+	t.Run("counter", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"rate<10/s over 10s", "increase>0", "rate<=10"})
+		require.NoError(t, err)
+		sink := &CounterSink{}
+
+		testdata := []struct {
+			t       time.Duration
+			count   float64
+			results []bool
+		}{
+			{10 * time.Second, 50, []bool{true, true, true}},    // 5/s over the window
+			{20 * time.Second, 200, []bool{false, true, true}},  // 15/s over the window, 10/s overall
+			{30 * time.Second, 200, []bool{true, false, true}},  // 0/s over the window, no increase
+			{35 * time.Second, 380, []bool{false, true, false}}, // 12/s since 20s
+		}
+		for _, data := range testdata {
+			sink.Value = data.count
+			_, err := ts.Run(sink, data.t)
+			require.NoError(t, err)
+			for i, expected := range data.results {
+				assert.Equal(t, expected, !ts.Thresholds[i].LastFailed, "%s: %s", data.t, ts.Thresholds[i].Source)
+			}
+			assert.InDelta(t, data.count/data.t.Seconds(), ts.Runtime.Get("rate").ToFloat(), 0.001)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"rate<0.1 over 10s"})
+		require.NoError(t, err)
+		sink := &RateSink{}
+
+		for _, data := range []struct {
+			t            time.Duration
+			trues, total int64
+			pass         bool
+		}{
+			{5 * time.Second, 5, 100, true},
+			{10 * time.Second, 15, 200, true},
+			{20 * time.Second, 45, 300, false},
+			{30 * time.Second, 45, 300, true},
+		} {
+			sink.Trues, sink.Total = data.trues, data.total
+			b, err := ts.Run(sink, data.t)
+			require.NoError(t, err)
+			assert.Equal(t, data.pass, b, data.t)
+		}
+	})
+
+	t.Run("trend", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"avg<100 over 10s && count>2 over 10s"})
+		assert.Error(t, err)
+
+		ts, err = NewThresholds([]string{"avg<100 && count>2 over 10s"})
+		require.NoError(t, err)
+		sink := &TrendSink{}
+		for _, v := range []float64{10, 20, 30} {
+			sink.Add(Sample{Value: v})
+		}
+		b, err := ts.Run(sink, 5*time.Second)
+		require.NoError(t, err)
+		assert.True(t, b)
+
+		sink.Add(Sample{Value: 500})
+		b, err = ts.Run(sink, 15*time.Second)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.Equal(t, 140.0, ts.Runtime.Get("avg").ToFloat())
+	})
+}
+
+func TestThresholdsRunDue(t *testing.T) {
+	var ts Thresholds
+	assert.NoError(t, json.Unmarshal([]byte(`["a>0", {"threshold": "a>1", "interval": "5s"}]`), &ts))
+	assert.Equal(t, types.NullDurationFrom(5*time.Second), ts.Thresholds[1].Interval)
+	assert.Equal(t, 2*time.Second, ts.MinInterval(2*time.Second))
+	assert.Equal(t, 5*time.Second, ts.MinInterval(10*time.Second))
+
+	// Both are evaluated for the first time.
+	b, err := ts.RunDue(DummySink{"a": 0}, 0, 0, 2*time.Second)
+	assert.NoError(t, err)
+	assert.False(t, b)
+	assert.True(t, ts.Thresholds[0].LastFailed)
+	assert.True(t, ts.Thresholds[1].LastFailed)
+
+	// Only the first one is due, the second one keeps failing.
+	b, err = ts.RunDue(DummySink{"a": 2}, 0, 2*time.Second, 2*time.Second)
+	assert.NoError(t, err)
+	assert.False(t, b)
+	assert.False(t, ts.Thresholds[0].LastFailed)
+	assert.True(t, ts.Thresholds[1].LastFailed)
+
+	b, err = ts.RunDue(DummySink{"a": 2}, 0, 5*time.Second, 2*time.Second)
+	assert.NoError(t, err)
+	assert.True(t, b)
+	assert.False(t, ts.Thresholds[1].LastFailed)
+
+	// Run() still evaluates everything.
+	b, err = ts.Run(DummySink{"a": 1}, 0)
+	assert.NoError(t, err)
+	assert.False(t, b)
+	assert.True(t, ts.Thresholds[1].LastFailed)
+
+	t.Run("invalid", func(t *testing.T) {
+		var ts Thresholds
+		assert.EqualError(t, json.Unmarshal([]byte(`[{"threshold": "a>1", "interval": "-1s"}]`), &ts),
+			"0: the evaluation interval must be positive, not -1s")
+	})
+}
+
 func TestThresholdsJSON(t *testing.T) {
 	var testdata = []struct {
 		JSON        string
@@ -266,6 +464,20 @@ func TestThresholdsJSON(t *testing.T) {
 			types.NullDurationFrom(2 * time.Second),
 			"",
 		},
+		{
+			`[{"threshold":"1+1==2","abortOnFail":false,"delayAbortEval":null,"interval":"10s"}]`,
+			[]string{"1+1==2"},
+			false,
+			types.NullDuration{},
+			"",
+		},
+		{
+			`[{"threshold":"1+1==2","abortOnFail":false,"delayAbortEval":"30s"}]`,
+			[]string{"1+1==2"},
+			false,
+			types.NullDurationFrom(30 * time.Second),
+			"",
+		},
 		{
 			`[{"threshold":"1+1==2","abortOnFail":false}]`,
 			[]string{"1+1==2"},
@@ -282,6 +494,12 @@ func TestThresholdsJSON(t *testing.T) {
 		},
 	}
 
+	t.Run("negative delayAbortEval", func(t *testing.T) {
+		var ts Thresholds
+		assert.EqualError(t, json.Unmarshal([]byte(`[{"threshold": "a>1", "abortOnFail": true, "delayAbortEval": "-10s"}]`), &ts),
+			"0: delayAbortEval can't be negative, but is -10s")
+	})
+
 	for _, data := range testdata {
 		t.Run(data.JSON, func(t *testing.T) {
 			var ts Thresholds
@@ -321,3 +539,92 @@ func TestThresholdsJSON(t *testing.T) {
 		assert.False(t, ts.Abort)
 	})
 }
+
+func TestThresholdsMultipleMetrics(t *testing.T) {
+	duration := &TrendSink{}
+	for i := 1; i <= 100; i++ {
+		duration.Add(Sample{Value: float64(i)})
+	}
+	checks := &RateSink{Trues: 995, Total: 1000}
+	sinks := map[string]Sink{
+		"checks":                        checks,
+		"http_req_duration":             duration,
+		"http_req_duration{status:200}": duration,
+		"http_reqs":                     &CounterSink{Value: 1000},
+	}
+
+	testdata := map[string]bool{
+		"rate > 0.99 && http_req_duration.p(95) < 100":          true,
+		"rate > 0.99 && http_req_duration.p(95) < 90":           false,
+		"checks.rate > 0.99 && http_reqs.count >= 1000":         true,
+		"metric('http_req_duration{status:200}').avg == 50.5":   true,
+		"metric('http_req_duration{status:200}')['p(90)'] > 95": false,
+	}
+	for src, expected := range testdata {
+		src, expected := src, expected
+		t.Run(src, func(t *testing.T) {
+			ts, err := NewThresholds([]string{src})
+			require.NoError(t, err)
+			assert.True(t, ts.ReferencesMetrics())
+			ts.SetMetrics(sinks, 10*time.Second)
+			b, err := ts.Run(checks, 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, expected, b)
+		})
+	}
+
+	t.Run("no references", func(t *testing.T) {
+		for _, src := range []string{"p(95)<300", "rate>0.99", "avg<1.5 && med<2.0"} {
+			ts, err := NewThresholds([]string{src})
+			require.NoError(t, err)
+			assert.False(t, ts.ReferencesMetrics(), src)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"metric('nope').rate > 0"})
+		require.NoError(t, err)
+		ts.SetMetrics(sinks, 0)
+		_, err = ts.Run(checks, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "there are no samples of the metric 'nope' yet")
+	})
+	t.Run("collisions", func(t *testing.T) {
+		collidingSinks := map[string]Sink{
+			"Math":      &CounterSink{Value: 1},
+			"JSON":      &CounterSink{Value: 2},
+			"rate":      &CounterSink{Value: 3},
+			"count":     &CounterSink{Value: 4},
+			"metric":    &CounterSink{Value: 5},
+			"http_reqs": &CounterSink{Value: 6},
+		}
+		ts, err := NewThresholds([]string{
+			"Math.max(1, 2) == 2 && JSON.stringify([1]) == '[1]'",
+			"rate > 0.99 && metric('rate').count == 3 && metric('count').count == 4",
+			"metric('Math').count == 1 && metric('JSON').count == 2 && metric('metric').count == 5",
+			"http_reqs.count == 6",
+		})
+		require.NoError(t, err)
+		ts.SetMetrics(collidingSinks, 0)
+		b, err := ts.Run(checks, 0)
+		require.NoError(t, err)
+		assert.True(t, b)
+		for _, th := range ts.Thresholds {
+			assert.False(t, th.LastFailed, th.Source)
+		}
+
+		// The metric globals are still updated, while the builtins aren't replaced
+		collidingSinks["http_reqs"] = &CounterSink{Value: 7}
+		ts.SetMetrics(collidingSinks, 0)
+		v, err := ts.Runtime.RunString("http_reqs.count + Math.max(0, 1)")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), v.ToInteger())
+	})
+	t.Run("invalid percentile", func(t *testing.T) {
+		ts, err := NewThresholds([]string{"http_req_duration.p(50*3) < 1"})
+		require.NoError(t, err)
+		ts.SetMetrics(sinks, 0)
+		_, err = ts.Run(checks, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the percentile must be between 0 and 100, not 150")
+	})
+}
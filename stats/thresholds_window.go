@@ -0,0 +1,152 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Matches the window of a threshold, like the " over 1m" in "rate<100/s over 1m".
+var windowRE = regexp.MustCompile(`\s+over\s+(\S+)\s*$`)
+
+// Matches the rates per unit of time, like the "100/s" in "rate<100/s", which are converted to
+// per-second rates, the unit of the rates of counters.
+var perUnitRE = regexp.MustCompile(`(\d+(?:\.\d+)?|\.\d+)\s*/\s*(ms|s|m|h)\b`)
+
+// Matches the references to increase, the change of the value of the metric over the window.
+var increaseRE = regexp.MustCompile(`(^|[^\w$.])increase\b`)
+
+// Matches the values that can't be computed over a window from the cumulative values.
+var unwindowedRE = regexp.MustCompile(`(^|[^\w$.])(min|max|med)\b|\bp\(`)
+
+var perUnitSeconds = map[string]string{"ms": "0.001", "s": "1", "m": "60", "h": "3600"}
+
+// parseThresholdSource splits the source of a threshold into the JS expression to run and the
+// window to evaluate it over, if it has one.
+func parseThresholdSource(src string) (expr string, window time.Duration, err error) {
+	expr = src
+	if m := windowRE.FindStringSubmatchIndex(src); m != nil {
+		window, err = time.ParseDuration(src[m[2]:m[3]])
+		if err != nil || window <= 0 {
+			return "", 0, errors.Errorf(
+				"'%s' isn't a valid window, it has to be a positive duration like 1m", src[m[2]:m[3]],
+			)
+		}
+		expr = src[:m[0]]
+		if unwindowedRE.MatchString(expr) {
+			return "", 0, errors.New("only count, rate, avg, value and increase can be evaluated over a window")
+		}
+	}
+
+	expr = perUnitRE.ReplaceAllStringFunc(expr, func(rate string) string {
+		m := perUnitRE.FindStringSubmatch(rate)
+		return "(" + m[1] + "/" + perUnitSeconds[m[2]] + ")"
+	})
+	return expr, window, nil
+}
+
+// windowSnapshot holds the cumulative values of a sink at a point in time, so the values over a
+// window can be computed from the differences between two snapshots.
+type windowSnapshot struct {
+	t            time.Duration
+	value        float64 // What increase is computed from: the count, value, rate or avg
+	count, sum   float64
+	trues, total float64
+}
+
+func takeWindowSnapshot(sink Sink, t time.Duration) (windowSnapshot, bool) {
+	s := windowSnapshot{t: t}
+	switch sink := sink.(type) {
+	case *CounterSink:
+		s.value, s.count = sink.Value, sink.Value
+	case *GaugeSink:
+		s.value = sink.Value
+	case *RateSink:
+		s.trues, s.total = float64(sink.Trues), float64(sink.Total)
+		if s.total > 0 {
+			s.value = s.trues / s.total
+		}
+	case *TrendSink:
+		s.count, s.sum = float64(sink.Count), sink.Sum
+		if s.count > 0 {
+			s.value = s.sum / s.count
+		}
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+// windowStart returns the snapshot at the start of the window that ends with now, and adds now
+// to the history. Windows that would start before the test did start at its beginning, and
+// without a window, it starts at the last evaluation of the threshold.
+func (th *Threshold) windowStart(now windowSnapshot) windowSnapshot {
+	var start windowSnapshot
+	keep := 0
+	for i, s := range th.history {
+		if th.window > 0 && s.t > now.t-th.window {
+			break
+		}
+		start, keep = s, i
+	}
+	th.history = append(th.history[keep:], now)
+	return start
+}
+
+// windowValues returns the values of the sink over the window of th, which replace the
+// cumulative ones while it runs.
+func (th *Threshold) windowValues(sink Sink, t time.Duration) map[string]float64 {
+	now, ok := takeWindowSnapshot(sink, t)
+	if !ok {
+		return nil
+	}
+	start := th.windowStart(now)
+
+	values := make(map[string]float64)
+	if th.increase {
+		values["increase"] = now.value - start.value
+	}
+	if th.window == 0 {
+		return values
+	}
+
+	switch sink.(type) {
+	case *CounterSink:
+		values["count"], values["rate"] = now.count-start.count, 0
+		if secs := (now.t - start.t).Seconds(); secs > 0 {
+			values["rate"] = values["count"] / secs
+		}
+	case *RateSink:
+		values["rate"] = 0
+		if total := now.total - start.total; total > 0 {
+			values["rate"] = (now.trues - start.trues) / total
+		}
+	case *TrendSink:
+		values["count"], values["avg"] = now.count-start.count, 0
+		if values["count"] > 0 {
+			values["avg"] = (now.sum - start.sum) / values["count"]
+		}
+	}
+	return values
+}
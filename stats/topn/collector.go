@@ -0,0 +1,207 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package topn aggregates HTTP request durations and failures per request name over short
+// windows, for the live panel with the slowest and most failing requests shown during a test,
+// and optionally over the whole test, for the endpoints report.
+package topn
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Entry holds the statistics for a single request name over a window.
+type Entry struct {
+	Name     string
+	Requests int64
+	Failures int64
+	P95      float64 // in milliseconds, like the http_req_duration samples
+}
+
+// ErrorRate returns the fraction of failed requests.
+func (e Entry) ErrorRate() float64 {
+	if e.Requests == 0 {
+		return 0
+	}
+	return float64(e.Failures) / float64(e.Requests)
+}
+
+type window struct {
+	durations map[string]*stats.TrendSink
+	failures  map[string]int64
+}
+
+func newWindow() *window {
+	return &window{durations: make(map[string]*stats.TrendSink), failures: make(map[string]int64)}
+}
+
+// Collector implements the lib.Collector interface. It's fed the samples like any other
+// collector, and Rotate() is called periodically to get the statistics for the last window.
+type Collector struct {
+	mu     sync.Mutex
+	window *window
+	totals *window // nil unless the totals are kept for Report()
+}
+
+// Verify that Collector implements lib.Collector
+var _ lib.Collector = &Collector{}
+
+// New returns a new Collector. If withTotals is true, it also keeps the statistics over the
+// whole test, which needs memory for every request duration, like the summary's trends.
+func New(withTotals bool) *Collector {
+	c := &Collector{window: newWindow()}
+	if withTotals {
+		c.totals = newWindow()
+	}
+	return c
+}
+
+// Init does nothing, it's only included to satisfy the lib.Collector interface
+func (c *Collector) Init() error { return nil }
+
+// Run just blocks until the context is done
+func (c *Collector) Run(ctx context.Context) { <-ctx.Done() }
+
+// Collect adds the http_req_duration samples to the current window.
+func (c *Collector) Collect(scs []stats.SampleContainer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sc := range scs {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric.Name != metrics.HTTPReqDuration.Name {
+				continue
+			}
+			name, ok := sample.Tags.Get("name")
+			if !ok {
+				name, _ = sample.Tags.Get("url")
+			}
+
+			failed := isFailure(sample.Tags)
+			c.window.add(name, sample, failed)
+			if c.totals != nil {
+				c.totals.add(name, sample, failed)
+			}
+		}
+	}
+}
+
+func (w *window) add(name string, sample stats.Sample, failed bool) {
+	sink := w.durations[name]
+	if sink == nil {
+		sink = &stats.TrendSink{}
+		w.durations[name] = sink
+	}
+	sink.Add(sample)
+	if failed {
+		w.failures[name]++
+	}
+}
+
+// A request failed if its response wasn't an expected one, according to the expected_response
+// tag. Without that tag, it failed if it didn't get a response at all, or if the status code
+// signals an error.
+func isFailure(tags *stats.SampleTags) bool {
+	if expected, ok := tags.Get("expected_response"); ok {
+		return expected != "true"
+	}
+	status, ok := tags.Get("status")
+	if !ok {
+		return false
+	}
+	code, err := strconv.Atoi(status)
+	return err != nil || code == 0 || code >= 400
+}
+
+// Rotate starts a new window and returns the entries for the previous one, in no particular order.
+func (c *Collector) Rotate() []Entry {
+	c.mu.Lock()
+	w := c.window
+	c.window = newWindow()
+	c.mu.Unlock()
+
+	entries := make([]Entry, 0, len(w.durations))
+	for name, sink := range w.durations {
+		entries = append(entries, Entry{
+			Name:     name,
+			Requests: int64(sink.Count),
+			Failures: w.failures[name],
+			P95:      sink.P(0.95),
+		})
+	}
+	return entries
+}
+
+// Link returns an empty string, as there's nothing to link to
+func (c *Collector) Link() string { return "" }
+
+// GetRequiredSystemTags returns which sample tags are needed by this collector
+func (c *Collector) GetRequiredSystemTags() lib.TagSet {
+	return lib.GetTagSet("name", "url", "status", "expected_response")
+}
+
+// SetRunStatus does nothing, it's only included to satisfy the lib.Collector interface
+func (c *Collector) SetRunStatus(status lib.RunStatus) {}
+
+// Slowest returns up to n entries with the highest p95, slowest first.
+func Slowest(entries []Entry, n int) []Entry {
+	sorted := append([]Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].P95 != sorted[j].P95 {
+			return sorted[i].P95 > sorted[j].P95
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return limit(sorted, n)
+}
+
+// MostFailing returns up to n entries with any failures, the highest error rate first.
+func MostFailing(entries []Entry, n int) []Entry {
+	var sorted []Entry
+	for _, e := range entries {
+		if e.Failures > 0 {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ri, rj := sorted[i].ErrorRate(), sorted[j].ErrorRate(); ri != rj {
+			return ri > rj
+		}
+		if sorted[i].Failures != sorted[j].Failures {
+			return sorted[i].Failures > sorted[j].Failures
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return limit(sorted, n)
+}
+
+func limit(entries []Entry, n int) []Entry {
+	if len(entries) > n {
+		return entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,85 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package topn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	sample := func(m *stats.Metric, value float64, tags ...string) stats.Sample {
+		tagMap := map[string]string{}
+		for i := 0; i < len(tags); i += 2 {
+			tagMap[tags[i]] = tags[i+1]
+		}
+		return stats.Sample{Metric: m, Time: time.Now(), Value: value, Tags: stats.IntoSampleTags(&tagMap)}
+	}
+
+	c := New(false)
+	c.Collect([]stats.SampleContainer{
+		sample(metrics.HTTPReqDuration, 100, "name", "fast", "status", "200"),
+		sample(metrics.HTTPReqDuration, 200, "name", "fast", "status", "200"),
+		sample(metrics.HTTPReqDuration, 1000, "name", "slow", "status", "500"),
+		sample(metrics.HTTPReqDuration, 50, "url", "http://example.com/", "status", "0"),
+		sample(metrics.HTTPReqs, 1, "name", "fast", "status", "200"),
+	})
+
+	entries := c.Rotate()
+	require.Len(t, entries, 3)
+	byName := map[string]Entry{}
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+	assert.Equal(t, Entry{Name: "fast", Requests: 2, P95: 195}, byName["fast"])
+	assert.Equal(t, Entry{Name: "slow", Requests: 1, Failures: 1, P95: 1000}, byName["slow"])
+	assert.Equal(t, 1.0, byName["http://example.com/"].ErrorRate())
+	assert.Equal(t, 0.0, byName["fast"].ErrorRate())
+
+	assert.Empty(t, c.Rotate(), "the window wasn't reset")
+}
+
+func TestRankings(t *testing.T) {
+	entries := []Entry{
+		{Name: "a", Requests: 10, Failures: 1, P95: 100},
+		{Name: "b", Requests: 10, Failures: 0, P95: 300},
+		{Name: "c", Requests: 2, Failures: 2, P95: 10},
+		{Name: "d", Requests: 20, Failures: 2, P95: 100},
+	}
+
+	names := func(entries []Entry) (res []string) {
+		for _, e := range entries {
+			res = append(res, e.Name)
+		}
+		return res
+	}
+	assert.Equal(t, []string{"b", "a", "d"}, names(Slowest(entries, 3)))
+	assert.Equal(t, []string{"b", "a", "d", "c"}, names(Slowest(entries, 10)))
+	assert.Equal(t, []string{"c", "d", "a"}, names(MostFailing(entries, 5)))
+	assert.Equal(t, []string{"c"}, names(MostFailing(entries, 1)))
+	assert.Empty(t, MostFailing(nil, 5))
+	assert.Equal(t, "a", entries[0].Name, "the input was reordered")
+}
@@ -0,0 +1,123 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package topn
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ReportEntry holds the statistics for a single request name over the whole test, for the
+// endpoints report. The durations are in milliseconds.
+type ReportEntry struct {
+	Name      string  `json:"name"`
+	Requests  int64   `json:"requests"`
+	Failures  int64   `json:"failures"`
+	ErrorRate float64 `json:"error_rate"`
+	Avg       float64 `json:"avg"`
+	Min       float64 `json:"min"`
+	Med       float64 `json:"med"`
+	P90       float64 `json:"p90"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+	Max       float64 `json:"max"`
+
+	// The total time that was spent in the requests, i.e. the number of requests times their
+	// average duration, which the report is sorted by.
+	Impact float64 `json:"impact"`
+}
+
+// Report returns the entries over the whole test, the ones with the highest impact first. It
+// returns nil if the Collector doesn't keep the totals.
+func (c *Collector) Report() []ReportEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.totals == nil {
+		return nil
+	}
+
+	entries := make([]ReportEntry, 0, len(c.totals.durations))
+	for name, sink := range c.totals.durations {
+		sink.Calc()
+		e := ReportEntry{
+			Name:     name,
+			Requests: int64(sink.Count),
+			Failures: c.totals.failures[name],
+			Avg:      sink.Avg,
+			Min:      sink.Min,
+			Med:      sink.Med,
+			P90:      sink.P(0.90),
+			P95:      sink.P(0.95),
+			P99:      sink.P(0.99),
+			Max:      sink.Max,
+			Impact:   sink.Sum,
+		}
+		if e.Requests > 0 {
+			e.ErrorRate = float64(e.Failures) / float64(e.Requests)
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Impact != entries[j].Impact {
+			return entries[i].Impact > entries[j].Impact
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// WriteReportJSON writes the entries as a JSON array.
+func WriteReportJSON(w io.Writer, entries []ReportEntry) error {
+	if entries == nil {
+		entries = []ReportEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(entries), "couldn't write the endpoints report")
+}
+
+// reportCSVHeader are the columns of the CSV report, in the order of the ReportEntry fields.
+var reportCSVHeader = []string{
+	"name", "requests", "failures", "error_rate",
+	"avg", "min", "med", "p90", "p95", "p99", "max", "impact",
+}
+
+// WriteReportCSV writes the entries as CSV, with a header row.
+func WriteReportCSV(w io.Writer, entries []ReportEntry) error {
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(reportCSVHeader)
+	for _, e := range entries {
+		_ = cw.Write([]string{
+			e.Name, strconv.FormatInt(e.Requests, 10), strconv.FormatInt(e.Failures, 10), formatFloat(e.ErrorRate),
+			formatFloat(e.Avg), formatFloat(e.Min), formatFloat(e.Med), formatFloat(e.P90),
+			formatFloat(e.P95), formatFloat(e.P99), formatFloat(e.Max), formatFloat(e.Impact),
+		})
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "couldn't write the endpoints report")
+}
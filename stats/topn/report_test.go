@@ -0,0 +1,86 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package topn
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	sample := func(name string, value float64, expected string) stats.Sample {
+		tags := map[string]string{"name": name, "status": "200", "expected_response": expected}
+		return stats.Sample{Metric: metrics.HTTPReqDuration, Time: time.Now(), Value: value, Tags: stats.IntoSampleTags(&tags)}
+	}
+
+	assert.Nil(t, New(false).Report())
+
+	c := New(true)
+	c.Collect([]stats.SampleContainer{
+		sample("slow", 1000, "true"),
+		sample("frequent", 100, "true"),
+		sample("frequent", 200, "false"),
+	})
+	c.Rotate()
+	c.Collect([]stats.SampleContainer{
+		sample("frequent", 300, "true"),
+		sample("frequent", 400, "true"),
+		sample("frequent", 500, "true"),
+		sample("frequent", 600, "true"),
+	})
+
+	entries := c.Report()
+	require.Len(t, entries, 2)
+	assert.Equal(t, ReportEntry{
+		Name: "frequent", Requests: 6, Failures: 1, ErrorRate: 1.0 / 6,
+		Avg: 350, Min: 100, Med: 350, P90: 550, P95: 575, P99: 595, Max: 600, Impact: 2100,
+	}, entries[0], "the windows don't reset the totals")
+	assert.Equal(t, "slow", entries[1].Name)
+	assert.Equal(t, 1000.0, entries[1].Impact)
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteReportJSON(&buf, entries))
+		var decoded []ReportEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, entries, decoded)
+
+		buf.Reset()
+		require.NoError(t, WriteReportJSON(&buf, nil))
+		assert.Equal(t, "[]\n", buf.String())
+	})
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteReportCSV(&buf, entries))
+		assert.Equal(t, ""+
+			"name,requests,failures,error_rate,avg,min,med,p90,p95,p99,max,impact\n"+
+			"frequent,6,1,0.16666666666666666,350,100,350,550,575,595,600,2100\n"+
+			"slow,1,0,0,1000,1000,1000,1000,1000,1000,1000,1000\n",
+			buf.String())
+	})
+}
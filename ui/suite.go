@@ -0,0 +1,98 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// SuiteResult is the outcome of one of the tests that `k6 run` ran one after the other.
+type SuiteResult struct {
+	Name    string
+	Err     error                    // Why the test failed, nil if it passed
+	Time    time.Duration            // How long the test ran
+	Metrics map[string]*stats.Metric // Nil if the test couldn't be started
+}
+
+// The values that the combined report shows for each test, if it has them.
+var suiteColumns = []struct {
+	label, metric, key string
+}{
+	{"iterations", metrics.Iterations.Name, "count"},
+	{"http_reqs", metrics.HTTPReqs.Name, "count"},
+	{"p(95)", metrics.HTTPReqDuration.Name, "p(95)"},
+	{"checks", metrics.Checks.Name, "rate"},
+}
+
+// SummarizeSuite writes the combined report of several tests, a line with the key values of
+// each, so they can be compared at a glance, and the errors of the ones that failed.
+func SummarizeSuite(w io.Writer, results []SuiteResult) {
+	nameWidth := 0
+	for _, r := range results {
+		if l := StrWidth(r.Name); l > nameWidth {
+			nameWidth = l
+		}
+	}
+
+	passed := 0
+	for _, r := range results {
+		mark, color := SuccMark, SuccColor
+		if r.Err != nil {
+			mark, color = FailMark, FailColor
+		} else {
+			passed++
+		}
+
+		line := color.Sprint(mark) + " " + r.Name
+		if r.Metrics != nil {
+			line += strings.Repeat(" ", nameWidth-StrWidth(r.Name))
+			line += "  " + ValueColor.Sprint(r.Time-r.Time%(10*time.Millisecond))
+			for _, col := range suiteColumns {
+				m, ok := r.Metrics[col.metric]
+				if !ok {
+					continue
+				}
+				value, ok := m.Sink.Format(r.Time)[col.key]
+				if !ok {
+					continue
+				}
+				formatted := m.HumanizeValue(value, "")
+				if m.Type == stats.Counter {
+					formatted = fmt.Sprintf("%.0f", value)
+				}
+				line += "  " + GrayColor.Sprint(col.label+"=") + ValueColor.Sprint(formatted)
+			}
+		}
+		fmt.Fprintf(w, "  %s\n", line)
+		if r.Err != nil {
+			fmt.Fprintf(w, "    %s\n", FailColor.Sprint(r.Err.Error()))
+		}
+	}
+
+	fmt.Fprintf(w, "\n  %d tests, %s, %s\n", len(results),
+		SuccColor.Sprintf("%d passed", passed), FailColor.Sprintf("%d failed", len(results)-passed))
+}
@@ -0,0 +1,62 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeSuite(t *testing.T) {
+	newMetrics := func(iterations int, durations ...float64) map[string]*stats.Metric {
+		iters := stats.New(metrics.Iterations.Name, stats.Counter)
+		iters.Sink.Add(stats.Sample{Value: float64(iterations)})
+		reqs := stats.New(metrics.HTTPReqs.Name, stats.Counter)
+		duration := stats.New(metrics.HTTPReqDuration.Name, stats.Trend, stats.Time)
+		for _, d := range durations {
+			reqs.Sink.Add(stats.Sample{Value: 1})
+			duration.Sink.Add(stats.Sample{Value: d})
+		}
+		return map[string]*stats.Metric{iters.Name: iters, reqs.Name: reqs, duration.Name: duration}
+	}
+
+	var buf bytes.Buffer
+	SummarizeSuite(&buf, []SuiteResult{
+		{Name: "a.js", Time: 1234567 * time.Microsecond, Metrics: newMetrics(10, 100, 200)},
+		{Name: "long.js", Time: time.Second, Metrics: newMetrics(5, 50), Err: errors.New("some thresholds have failed")},
+		{Name: "b.js", Err: errors.New("SyntaxError")},
+	})
+	assert.Equal(t, ""+
+		"  ✓ a.js     1.23s  iterations=10  http_reqs=2  p(95)=195ms\n"+
+		"  ✗ long.js  1s  iterations=5  http_reqs=1  p(95)=50ms\n"+
+		"    some thresholds have failed\n"+
+		"  ✗ b.js\n"+
+		"    SyntaxError\n"+
+		"\n"+
+		"  3 tests, 1 passed, 2 failed\n",
+		buf.String())
+}
@@ -24,12 +24,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/loadimpact/k6/lib"
+	k6metrics "github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"golang.org/x/text/unicode/norm"
 )
@@ -49,17 +51,40 @@ var (
 )
 
 var TrendColumns = []TrendColumn{
-	{"avg", func(s *stats.TrendSink) float64 { return s.Avg }},
-	{"min", func(s *stats.TrendSink) float64 { return s.Min }},
-	{"med", func(s *stats.TrendSink) float64 { return s.Med }},
-	{"max", func(s *stats.TrendSink) float64 { return s.Max }},
-	{"p(90)", func(s *stats.TrendSink) float64 { return s.P(0.90) }},
-	{"p(95)", func(s *stats.TrendSink) float64 { return s.P(0.95) }},
+	{Key: "avg", Get: func(s *stats.TrendSink) float64 { return s.Avg }},
+	{Key: "min", Get: func(s *stats.TrendSink) float64 { return s.Min }},
+	{Key: "med", Get: func(s *stats.TrendSink) float64 { return s.Med }},
+	{Key: "max", Get: func(s *stats.TrendSink) float64 { return s.Max }},
+	{Key: "p(90)", Get: func(s *stats.TrendSink) float64 { return s.P(0.90) }},
+	{Key: "p(95)", Get: func(s *stats.TrendSink) float64 { return s.P(0.95) }},
 }
 
+// trendColumnStats are all of the non-percentile stats that can be shown in the trend columns.
+var trendColumnStats = append([]TrendColumn{
+	{Key: "count", Get: func(s *stats.TrendSink) float64 { return float64(s.Count) }, Unitless: true},
+	{Key: "sum", Get: func(s *stats.TrendSink) float64 { return s.Sum }},
+}, TrendColumns[:4]...)
+
+// HistogramBars are used for drawing the trend histograms in the summary, from lowest to highest.
+var HistogramBars = []rune("▁▂▃▄▅▆▇█")
+
+// HistogramBuckets is the number of equally sized buckets in the trend histograms.
+const HistogramBuckets = 20
+
 type TrendColumn struct {
 	Key string
 	Get func(s *stats.TrendSink) float64
+
+	// Unitless columns are shown as plain numbers, not in the unit of the metric.
+	Unitless bool
+}
+
+// HumanizeValue formats the column's value for the metric.
+func (c TrendColumn) HumanizeValue(m *stats.Metric, sink *stats.TrendSink, timeUnit string) string {
+	if c.Unitless {
+		return strconv.FormatFloat(c.Get(sink), 'f', -1, 64)
+	}
+	return m.HumanizeValue(c.Get(sink), timeUnit)
 }
 
 // VerifyTrendColumnStat checks if stat is a valid trend column
@@ -68,7 +93,7 @@ func VerifyTrendColumnStat(stat string) error {
 		return ErrStatEmptyString
 	}
 
-	for _, col := range TrendColumns {
+	for _, col := range trendColumnStats {
 		if col.Key == stat {
 			return nil
 		}
@@ -86,11 +111,11 @@ func UpdateTrendColumns(stats []string) {
 		percentileTrendColumn, err := generatePercentileTrendColumn(stat)
 
 		if err == nil {
-			newTrendColumns = append(newTrendColumns, TrendColumn{stat, percentileTrendColumn})
+			newTrendColumns = append(newTrendColumns, TrendColumn{Key: stat, Get: percentileTrendColumn})
 			continue
 		}
 
-		for _, col := range TrendColumns {
+		for _, col := range trendColumnStats {
 			if col.Key == stat {
 				newTrendColumns = append(newTrendColumns, col)
 				break
@@ -123,6 +148,42 @@ func generatePercentileTrendColumn(stat string) (func(s *stats.TrendSink) float6
 	return func(s *stats.TrendSink) float64 { return s.P(percentile) }, nil
 }
 
+// Histogram returns a sparkline of the distribution of the trend values, split in the given number
+// of equally sized buckets between the min and max value. Empty buckets are left blank, so gaps in
+// bimodal distributions are easy to spot. It returns an empty string if there's nothing to draw.
+func Histogram(sink *stats.TrendSink, buckets int) string {
+	if buckets < 1 || sink.Count < 2 || sink.Max <= sink.Min {
+		return ""
+	}
+
+	counts := make([]uint64, buckets)
+	var maxCount uint64
+	width := (sink.Max - sink.Min) / float64(buckets)
+	sink.ForEachValue(func(v float64, count uint64) {
+		i := int((v - sink.Min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		} else if i < 0 {
+			i = 0
+		}
+		counts[i] += count
+		if counts[i] > maxCount {
+			maxCount = counts[i]
+		}
+	})
+
+	bars := make([]rune, buckets)
+	for i, count := range counts {
+		if count == 0 {
+			bars[i] = ' '
+			continue
+		}
+		height := int(math.Ceil(float64(count) / float64(maxCount) * float64(len(HistogramBars))))
+		bars[i] = HistogramBars[height-1]
+	}
+	return string(bars)
+}
+
 // Returns the actual width of the string.
 func StrWidth(s string) (n int) {
 	var it norm.Iter
@@ -183,9 +244,19 @@ func SummarizeCheck(w io.Writer, indent string, check *lib.Check) {
 }
 
 func SummarizeGroup(w io.Writer, indent string, group *lib.Group) {
+	summarizeGroup(w, indent, group, nil, "")
+}
+
+// summarizeGroup shows the checks of a group and its subgroups, with the group_duration of every
+// group that has one in durations, by the group's path.
+func summarizeGroup(w io.Writer, indent string, group *lib.Group, durations map[string]*stats.Metric, timeUnit string) {
 	if group.Name != "" {
 		_, _ = fmt.Fprintf(w, "%s%s %s\n\n", indent, GroupPrefix, group.Name)
 		indent = indent + "  "
+		if m, ok := durations[group.Path]; ok {
+			SummarizeMetrics(w, indent, 0, timeUnit, false, map[string]*stats.Metric{m.Name: m})
+			_, _ = fmt.Fprintf(w, "\n")
+		}
 	}
 
 	var checkNames []string
@@ -204,19 +275,36 @@ func SummarizeGroup(w io.Writer, indent string, group *lib.Group) {
 		groupNames = append(groupNames, grp.Name)
 	}
 	for _, name := range groupNames {
-		SummarizeGroup(w, indent, group.Groups[name])
+		summarizeGroup(w, indent, group.Groups[name], durations, timeUnit)
+	}
+}
+
+// splitGroupDurations separates the group_duration submetrics for a single group, which the
+// engine keeps for every group, from the rest, by the group's path. The ones with thresholds are
+// also kept in the rest.
+func splitGroupDurations(
+	metrics map[string]*stats.Metric,
+) (rest map[string]*stats.Metric, durations map[string]*stats.Metric) {
+	rest = make(map[string]*stats.Metric, len(metrics))
+	durations = make(map[string]*stats.Metric)
+	for name, m := range metrics {
+		path, ok := m.Sub.Tags.Get("group")
+		if !ok || m.Sub.Parent != k6metrics.GroupDuration.Name || len(m.Sub.Tags.CloneTags()) != 1 {
+			rest[name] = m
+			continue
+		}
+		durations[path] = asParentMetric(m)
+		if len(m.Thresholds.Thresholds) > 0 {
+			rest[name] = m
+		}
 	}
+	return rest, durations
 }
 
 func NonTrendMetricValueForSum(t time.Duration, timeUnit string, m *stats.Metric) (data string, extra []string) {
 	switch sink := m.Sink.(type) {
 	case *stats.CounterSink:
-		value := sink.Value
-		rate := 0.0
-		if t > 0 {
-			rate = value / (float64(t) / float64(time.Second))
-		}
-		return m.HumanizeValue(value, timeUnit), []string{m.HumanizeValue(rate, timeUnit) + "/s"}
+		return m.HumanizeValue(sink.Value, timeUnit), []string{m.HumanizeRate(sink.Rate(t), timeUnit)}
 	case *stats.GaugeSink:
 		value := sink.Value
 		min := sink.Min
@@ -252,7 +340,9 @@ func IndentForMetric(m *stats.Metric) string {
 	return ""
 }
 
-func SummarizeMetrics(w io.Writer, indent string, t time.Duration, timeUnit string, metrics map[string]*stats.Metric) {
+func SummarizeMetrics(
+	w io.Writer, indent string, t time.Duration, timeUnit string, histogram bool, metrics map[string]*stats.Metric,
+) {
 	names := []string{}
 	nameLenMax := 0
 
@@ -277,7 +367,7 @@ func SummarizeMetrics(w io.Writer, indent string, t time.Duration, timeUnit stri
 		if sink, ok := m.Sink.(*stats.TrendSink); ok {
 			cols := make([]string, len(TrendColumns))
 			for i, col := range TrendColumns {
-				value := m.HumanizeValue(col.Get(sink), timeUnit)
+				value := col.HumanizeValue(m, sink, timeUnit)
 				if l := StrWidth(value); l > trendColMaxLens[i] {
 					trendColMaxLens[i] = l
 				}
@@ -347,13 +437,211 @@ func SummarizeMetrics(w io.Writer, indent string, t time.Duration, timeUnit stri
 			}
 		}
 		_, _ = fmt.Fprint(w, indent+fmtIndent+markColor.Sprint(mark)+" "+fmtName+" "+fmtData+"\n")
+
+		if sink, ok := m.Sink.(*stats.TrendSink); ok && histogram {
+			if bars := Histogram(sink, HistogramBuckets); bars != "" {
+				_, _ = fmt.Fprint(w, indent+strings.Repeat(" ", nameLenMax+7)+
+					ExtraColor.Sprint(m.HumanizeValue(sink.Min, timeUnit))+" "+ValueColor.Sprint(bars)+" "+
+					ExtraColor.Sprint(m.HumanizeValue(sink.Max, timeUnit))+"\n")
+			}
+		}
+	}
+}
+
+// comparedStats returns the stats of a metric that are compared between scenarios, with their values.
+func comparedStats(m *stats.Metric) (cols []TrendColumn, values []float64) {
+	m.Sink.Calc()
+	switch sink := m.Sink.(type) {
+	case *stats.TrendSink:
+		for _, col := range TrendColumns {
+			cols = append(cols, col)
+			values = append(values, col.Get(sink))
+		}
+	case *stats.CounterSink:
+		cols, values = []TrendColumn{{Key: "count"}}, []float64{sink.Value}
+	case *stats.GaugeSink:
+		cols, values = []TrendColumn{{Key: "value"}}, []float64{sink.Value}
+	case *stats.RateSink:
+		rate := 0.0
+		if sink.Total > 0 {
+			rate = float64(sink.Trues) / float64(sink.Total)
+		}
+		cols, values = []TrendColumn{{Key: "rate"}}, []float64{rate}
+	}
+	return cols, values
+}
+
+// humanizeCompared formats a compared value of a metric, with an explicit sign for differences.
+func humanizeCompared(m *stats.Metric, col TrendColumn, v float64, signed bool, timeUnit string) string {
+	sign := ""
+	if signed {
+		sign = "+"
+		if v < 0 {
+			sign = "-"
+		}
+		v = math.Abs(v)
+	}
+	if col.Unitless {
+		return sign + strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return sign + m.HumanizeValue(v, timeUnit)
+}
+
+// CompareMetrics prints the metrics of two scenarios side by side, with the difference of every stat of
+// the second scenario to the first one, both absolute and relative. Only metrics that both scenarios
+// have are compared.
+func CompareMetrics(w io.Writer, indent, timeUnit string, a, b map[string]*stats.Metric) {
+	names := []string{}
+	for name := range a {
+		if _, ok := b[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		_, _ = fmt.Fprint(w, indent+GrayColor.Sprint("no metrics to compare")+"\n")
+		return
+	}
+	sort.Strings(names)
+
+	var rows [][]string
+	for _, name := range names {
+		ma, mb := a[name], b[name]
+		cols, valuesA := comparedStats(ma)
+		_, valuesB := comparedStats(mb)
+		for i, col := range cols {
+			va, vb := valuesA[i], valuesB[i]
+			relative := "-"
+			if va != 0 {
+				relative = fmt.Sprintf("%+.2f%%", (vb-va)/math.Abs(va)*100)
+			}
+			displayName := ""
+			if i == 0 {
+				displayName = name
+			}
+			rows = append(rows, []string{
+				displayName, col.Key, humanizeCompared(ma, col, va, false, timeUnit),
+				humanizeCompared(ma, col, vb, false, timeUnit), humanizeCompared(ma, col, vb-va, true, timeUnit), relative,
+			})
+		}
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, col := range row {
+			if l := StrWidth(col); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+	pad := func(s string, i int) string { return s + strings.Repeat(" ", widths[i]-StrWidth(s)) }
+	for _, row := range rows {
+		_, _ = fmt.Fprint(w, indent+"  "+pad(row[0], 0)+" "+pad(row[1], 1)+" "+
+			ValueColor.Sprint(pad(row[2], 2))+" "+ValueColor.Sprint(pad(row[3], 3))+" "+
+			ExtraColor.Sprint(pad(row[4], 4)+" "+row[5])+"\n")
 	}
 }
 
 // Summarizes a dataset and returns whether the test run was considered a success.
 func Summarize(w io.Writer, indent string, data SummaryData) {
-	if data.Root != nil {
-		SummarizeGroup(w, indent+"    ", data.Root)
+	// Checks can't be filtered after the fact, so the group tree is only shown without a filter.
+	filter := data.Opts.SummaryFilter.String
+	metrics, durations := splitGroupDurations(data.Metrics)
+	if data.Root != nil && filter == "" {
+		summarizeGroup(w, indent+"    ", data.Root, durations, data.Opts.SummaryTimeUnit.String)
+	}
+	if filter != "" {
+		SummarizeMetrics(w, indent+"  ", data.Time, data.Opts.SummaryTimeUnit.String,
+			data.Opts.SummaryHistogram.Bool, filterSummaryMetrics(data.Metrics, stats.ParseTagFilter(filter)))
+		return
+	}
+
+	metrics, scenarios := splitBreakdownMetrics(metrics, "scenario")
+	metrics, variants := splitBreakdownMetrics(metrics, "variant")
+	SummarizeMetrics(w, indent+"  ", data.Time, data.Opts.SummaryTimeUnit.String,
+		data.Opts.SummaryHistogram.Bool, metrics)
+	summarizeBreakdown(w, indent, data, "variant", variants)
+
+	if compare := data.Opts.SummaryCompare; len(compare) == 2 {
+		_, _ = fmt.Fprintf(w, "\n%s%s scenario comparison: %s → %s\n\n", indent+"    ", GroupPrefix, compare[0], compare[1])
+		CompareMetrics(w, indent+"    ", data.Opts.SummaryTimeUnit.String, scenarios[compare[0]], scenarios[compare[1]])
+		return
+	}
+	summarizeBreakdown(w, indent, data, "scenario", scenarios)
+}
+
+// summarizeBreakdown shows the metrics for every value of a breakdown tag, in order. A breakdown
+// is only useful if there's more than one value to compare.
+func summarizeBreakdown(w io.Writer, indent string, data SummaryData, tag string, breakdown map[string]map[string]*stats.Metric) {
+	if len(breakdown) < 2 {
+		return
 	}
-	SummarizeMetrics(w, indent+"  ", data.Time, data.Opts.SummaryTimeUnit.String, data.Metrics)
+	names := make([]string, 0, len(breakdown))
+	for name := range breakdown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "\n%s%s %s: %s\n\n", indent+"    ", GroupPrefix, tag, name)
+		SummarizeMetrics(w, indent+"    ", data.Time, data.Opts.SummaryTimeUnit.String,
+			data.Opts.SummaryHistogram.Bool, breakdown[name])
+	}
+}
+
+// splitBreakdownMetrics separates the submetrics that only filter by the given tag, e.g. the
+// scenario, from the rest, grouping them by the tag's value under their parent metric's name. If
+// there is only a single value, its submetrics stay in the main list if they have thresholds, and
+// are dropped otherwise, since they would just repeat the parent metrics.
+func splitBreakdownMetrics(
+	metrics map[string]*stats.Metric, tag string,
+) (rest map[string]*stats.Metric, breakdown map[string]map[string]*stats.Metric) {
+	rest = make(map[string]*stats.Metric, len(metrics))
+	subs := make(map[string][]*stats.Metric)
+	for name, m := range metrics {
+		value, ok := m.Sub.Tags.Get(tag)
+		if !ok || m.Sub.Parent == "" || len(m.Sub.Tags.CloneTags()) != 1 {
+			rest[name] = m
+			continue
+		}
+		subs[value] = append(subs[value], m)
+	}
+
+	if len(subs) < 2 {
+		for _, ms := range subs {
+			for _, m := range ms {
+				if len(m.Thresholds.Thresholds) > 0 {
+					rest[m.Name] = m
+				}
+			}
+		}
+		return rest, nil
+	}
+
+	breakdown = make(map[string]map[string]*stats.Metric, len(subs))
+	for value, ms := range subs {
+		breakdown[value] = make(map[string]*stats.Metric, len(ms))
+		for _, m := range ms {
+			breakdown[value][m.Sub.Parent] = asParentMetric(m)
+		}
+	}
+	return rest, breakdown
+}
+
+// filterSummaryMetrics returns the submetrics for exactly the given tags, under their parent metric's
+// name. The engine maintains these for every metric when a summary filter is set.
+func filterSummaryMetrics(metrics map[string]*stats.Metric, tags *stats.SampleTags) map[string]*stats.Metric {
+	filtered := make(map[string]*stats.Metric)
+	for _, m := range metrics {
+		if m.Sub.Parent != "" && m.Sub.Tags.IsEqual(tags) {
+			filtered[m.Sub.Parent] = asParentMetric(m)
+		}
+	}
+	return filtered
+}
+
+// asParentMetric returns a copy of a submetric that is displayed as its parent metric.
+func asParentMetric(m *stats.Metric) *stats.Metric {
+	parent := *m
+	parent.Name = m.Sub.Parent
+	parent.Sub = stats.Submetric{}
+	return &parent
 }
@@ -21,10 +21,15 @@
 package ui
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
 )
 
 var verifyTests = []struct {
@@ -35,6 +40,8 @@ var verifyTests = []struct {
 	{"min", nil},
 	{"med", nil},
 	{"max", nil},
+	{"count", nil},
+	{"sum", nil},
 	{"p(0)", nil},
 	{"p(90)", nil},
 	{"p(95)", nil},
@@ -116,6 +123,19 @@ func TestUpdateTrendColumns(t *testing.T) {
 		assert.Exactly(t, 1, len(TrendColumns))
 		assert.Exactly(t, sink.P(0.999999), TrendColumns[0].Get(sink))
 	})
+
+	t.Run("Count and sum stats", func(t *testing.T) {
+		TrendColumns = defaultTrendColumns
+
+		UpdateTrendColumns([]string{"min"})
+		UpdateTrendColumns([]string{"count", "sum", "max"})
+
+		metric := stats.New("t", stats.Trend, stats.Time)
+		assert.Exactly(t, 3, len(TrendColumns))
+		assert.Equal(t, "100", TrendColumns[0].HumanizeValue(metric, sink, ""))
+		assert.Equal(t, "4.95s", TrendColumns[1].HumanizeValue(metric, sink, "s"))
+		assert.Equal(t, "99ms", TrendColumns[2].HumanizeValue(metric, sink, ""))
+	})
 }
 
 func TestGeneratePercentileTrendColumn(t *testing.T) {
@@ -158,3 +178,218 @@ func TestGeneratePercentileTrendColumn(t *testing.T) {
 		assert.Exactly(t, err, ErrPercentileStatInvalidValue)
 	})
 }
+
+func TestHistogram(t *testing.T) {
+	t.Run("Not enough data", func(t *testing.T) {
+		assert.Equal(t, "", Histogram(createTestTrendSink(0), 10))
+		assert.Equal(t, "", Histogram(createTestTrendSink(1), 10))
+		assert.Equal(t, "", Histogram(createTestTrendSink(10), 0))
+
+		sink := &stats.TrendSink{}
+		sink.Add(stats.Sample{Value: 5})
+		sink.Add(stats.Sample{Value: 5})
+		assert.Equal(t, "", Histogram(sink, 10))
+	})
+
+	t.Run("Uniform", func(t *testing.T) {
+		assert.Equal(t, "██████████", Histogram(createTestTrendSink(10), 10))
+		assert.Equal(t, "██▄██", Histogram(createTestTrendSink(9), 5))
+	})
+
+	t.Run("Bimodal", func(t *testing.T) {
+		sink := &stats.TrendSink{}
+		for _, v := range []float64{0, 1, 1, 1, 1, 1, 1, 1, 9, 10, 10, 10} {
+			sink.Add(stats.Sample{Value: v})
+		}
+		assert.Equal(t, "█   ▄", Histogram(sink, 5))
+	})
+
+	t.Run("HDR", func(t *testing.T) {
+		sink := stats.NewTrendSink(stats.DefaultTrendPrecision)
+		for _, v := range []float64{0, 1, 1, 1, 1, 1, 1, 1, 9, 10, 10, 10} {
+			sink.Add(stats.Sample{Value: v})
+		}
+		assert.Equal(t, "█   ▄", Histogram(sink, 5))
+	})
+}
+
+func TestSummarizeScenarios(t *testing.T) {
+	newSub := func(parent *stats.Metric, scenario string, values ...float64) *stats.Metric {
+		_, sub, _ := stats.NewSubmetric(parent.Name + "{scenario:" + scenario + "}")
+		m := stats.New(sub.Name, parent.Type, parent.Contains)
+		m.Sub = *sub
+		for _, v := range values {
+			m.Sink.Add(stats.Sample{Value: v})
+			parent.Sink.Add(stats.Sample{Value: v})
+		}
+		return m
+	}
+
+	t.Run("Multiple", func(t *testing.T) {
+		reqs := stats.New("http_reqs", stats.Counter)
+		metrics := map[string]*stats.Metric{"http_reqs": reqs}
+		for _, m := range []*stats.Metric{newSub(reqs, "browse", 1, 1), newSub(reqs, "checkout", 1)} {
+			metrics[m.Name] = m
+		}
+
+		rest, scenarios := splitBreakdownMetrics(metrics, "scenario")
+		assert.Equal(t, map[string]*stats.Metric{"http_reqs": reqs}, rest)
+		require.Len(t, scenarios, 2)
+		require.Contains(t, scenarios["browse"], "http_reqs")
+		assert.Equal(t, 2.0, scenarios["browse"]["http_reqs"].Sink.(*stats.CounterSink).Value)
+		assert.Equal(t, "", scenarios["browse"]["http_reqs"].Sub.Parent)
+
+		var buf bytes.Buffer
+		Summarize(&buf, "", SummaryData{Metrics: metrics})
+		out := buf.String()
+		assert.Contains(t, out, GroupPrefix+" scenario: browse\n")
+		assert.Contains(t, out, GroupPrefix+" scenario: checkout\n")
+		assert.NotContains(t, out, "{ scenario:")
+		assert.True(t, bytes.Index(buf.Bytes(), []byte("browse")) < bytes.Index(buf.Bytes(), []byte("checkout")))
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		reqs := stats.New("http_reqs", stats.Counter)
+		dur := stats.New("http_req_duration", stats.Trend, stats.Time)
+		withThresholds := newSub(dur, "default", 10)
+		ths, err := stats.NewThresholds([]string{"avg<100"})
+		require.NoError(t, err)
+		withThresholds.Thresholds = ths
+		metrics := map[string]*stats.Metric{
+			"http_reqs":                   reqs,
+			"http_req_duration":           dur,
+			withThresholds.Name:           withThresholds,
+			"http_reqs{scenario:default}": newSub(reqs, "default", 1),
+		}
+
+		rest, scenarios := splitBreakdownMetrics(metrics, "scenario")
+		assert.Nil(t, scenarios)
+		assert.Len(t, rest, 3)
+		assert.Contains(t, rest, "http_req_duration{scenario:default}")
+		assert.NotContains(t, rest, "http_reqs{scenario:default}")
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		reqs := stats.New("http_reqs", stats.Counter)
+		metrics := map[string]*stats.Metric{"http_reqs": reqs}
+		for _, m := range []*stats.Metric{newSub(reqs, "a", 1), newSub(reqs, "b", 1, 1)} {
+			metrics[m.Name] = m
+		}
+		for _, variant := range []string{"control", "new"} {
+			_, sub, _ := stats.NewSubmetric("http_reqs{variant:" + variant + "}")
+			m := stats.New(sub.Name, stats.Counter)
+			m.Sub = *sub
+			m.Sink.Add(stats.Sample{Value: 1})
+			metrics[m.Name] = m
+		}
+
+		rest, variants := splitBreakdownMetrics(metrics, "variant")
+		require.Len(t, variants, 2)
+		assert.Len(t, rest, 3)
+
+		var buf bytes.Buffer
+		Summarize(&buf, "", SummaryData{Metrics: metrics})
+		out := buf.String()
+		assert.Contains(t, out, GroupPrefix+" variant: control\n")
+		assert.Contains(t, out, GroupPrefix+" variant: new\n")
+		assert.Contains(t, out, GroupPrefix+" scenario: a\n")
+		assert.NotContains(t, out, "{variant:")
+	})
+
+	t.Run("Compare", func(t *testing.T) {
+		TrendColumns = defaultTrendColumns
+		reqs := stats.New("http_reqs", stats.Counter)
+		dur := stats.New("http_req_duration", stats.Trend, stats.Time)
+		metrics := map[string]*stats.Metric{"http_reqs": reqs, "http_req_duration": dur}
+		for _, m := range []*stats.Metric{
+			newSub(reqs, "a", 1, 1), newSub(reqs, "b", 1, 1, 1, 1, 1),
+			newSub(dur, "a", 100), newSub(dur, "b", 80), newSub(reqs, "c", 1),
+		} {
+			metrics[m.Name] = m
+		}
+
+		var buf bytes.Buffer
+		CompareMetrics(&buf, "", "", map[string]*stats.Metric{}, map[string]*stats.Metric{})
+		assert.Contains(t, buf.String(), "no metrics to compare")
+
+		buf.Reset()
+		Summarize(&buf, "", SummaryData{Opts: lib.Options{SummaryCompare: []string{"a", "b"}}, Metrics: metrics})
+		out := buf.String()
+		assert.Contains(t, out, GroupPrefix+" scenario comparison: a → b\n")
+		assert.NotContains(t, out, "scenario: a")
+		assert.Regexp(t, `http_reqs +count +2 +5 +\+3 +\+150\.00%`, out)
+		assert.Regexp(t, `http_req_duration +avg +100ms +80ms +-20ms +-20\.00%`, out)
+		assert.Regexp(t, `\n +p\(95\) +100ms +80ms`, out)
+	})
+
+	t.Run("MultipleTags", func(t *testing.T) {
+		reqs := stats.New("http_reqs", stats.Counter)
+		_, sub, _ := stats.NewSubmetric("http_reqs{scenario:browse,status:200}")
+		m := stats.New(sub.Name, stats.Counter)
+		m.Sub = *sub
+
+		rest, scenarios := splitBreakdownMetrics(map[string]*stats.Metric{"http_reqs": reqs, m.Name: m}, "scenario")
+		assert.Nil(t, scenarios)
+		assert.Len(t, rest, 2)
+	})
+}
+
+func TestSummarizeFilter(t *testing.T) {
+	reqs := stats.New("http_reqs", stats.Counter)
+	reqs.Sink.Add(stats.Sample{Value: 1})
+	reqs.Sink.Add(stats.Sample{Value: 1})
+	_, sub, _ := stats.NewSubmetric("http_reqs{status:200}")
+	filtered := stats.New(sub.Name, stats.Counter)
+	filtered.Sub = *sub
+	filtered.Sink.Add(stats.Sample{Value: 1})
+	_, other, _ := stats.NewSubmetric("http_reqs{status:200,method:GET}")
+	otherMetric := stats.New(other.Name, stats.Counter)
+	otherMetric.Sub = *other
+
+	metrics := map[string]*stats.Metric{reqs.Name: reqs, filtered.Name: filtered, otherMetric.Name: otherMetric}
+	result := filterSummaryMetrics(metrics, stats.ParseTagFilter("status: 200"))
+	require.Len(t, result, 1)
+	require.Contains(t, result, "http_reqs")
+	assert.Equal(t, 1.0, result["http_reqs"].Sink.(*stats.CounterSink).Value)
+
+	var buf bytes.Buffer
+	Summarize(&buf, "", SummaryData{Opts: lib.Options{SummaryFilter: null.StringFrom("status:200")}, Metrics: metrics})
+	assert.Contains(t, buf.String(), "http_reqs")
+	assert.NotContains(t, buf.String(), "status")
+}
+
+func TestSummarizeGroupDurations(t *testing.T) {
+	TrendColumns = defaultTrendColumns
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	login, err := root.Group("login")
+	require.NoError(t, err)
+	_, err = root.Group("browse")
+	require.NoError(t, err)
+
+	dur := stats.New("group_duration", stats.Trend, stats.Time)
+	_, sub, err := stats.NewSubmetric(`group_duration{group:"::login"}`)
+	require.NoError(t, err)
+	loginDur := stats.New(sub.Name, stats.Trend, stats.Time)
+	loginDur.Sub = *sub
+	for _, v := range []float64{100, 300} {
+		loginDur.Sink.Add(stats.Sample{Value: v})
+		dur.Sink.Add(stats.Sample{Value: v})
+	}
+	metrics := map[string]*stats.Metric{dur.Name: dur, loginDur.Name: loginDur}
+
+	rest, durations := splitGroupDurations(metrics)
+	assert.Equal(t, map[string]*stats.Metric{dur.Name: dur}, rest)
+	require.Contains(t, durations, login.Path)
+	assert.Equal(t, "group_duration", durations[login.Path].Name)
+
+	var buf bytes.Buffer
+	Summarize(&buf, "", SummaryData{Metrics: metrics, Root: root})
+	out := buf.String()
+	loginAt := strings.Index(out, GroupPrefix+" login\n")
+	browseAt := strings.Index(out, GroupPrefix+" browse\n")
+	require.True(t, loginAt >= 0 && browseAt >= 0, out)
+	assert.Contains(t, out[loginAt:], "group_duration...: avg=200ms")
+	assert.Equal(t, 2, strings.Count(out, "group_duration"), "the login group and the overall metric")
+	assert.NotContains(t, out, "{ group:")
+}
@@ -0,0 +1,77 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats/topn"
+)
+
+// TopNNameWidth is the maximum width of the request names in the live top-N panel.
+const TopNNameWidth = 50
+
+// TopNPanel renders the live panel of the n slowest and the n most failing request names, from
+// the entries for the last window, which was the given duration. It always returns the same
+// number of lines for the same n, so it can be redrawn in place.
+func TopNPanel(entries []topn.Entry, n int, window time.Duration) []string {
+	lines := []string{GrayColor.Sprintf("  slowest requests (p95, last %s)", window)}
+	slowest := topn.Slowest(entries, n)
+	for _, e := range slowest {
+		lines = append(lines, topNLine(e.Name, e.Requests,
+			metrics.HTTPReqDuration.HumanizeValue(e.P95, "")))
+	}
+	lines = padTopN(lines, len(slowest), n)
+
+	lines = append(lines, GrayColor.Sprintf("  most failing requests (last %s)", window))
+	failing := topn.MostFailing(entries, n)
+	for _, e := range failing {
+		lines = append(lines, topNLine(e.Name, e.Requests,
+			strconv.FormatFloat(e.ErrorRate()*100, 'f', 2, 64)+"%"))
+	}
+	return padTopN(lines, len(failing), n)
+}
+
+// padTopN fills up a section of the panel that has fewer than n entries.
+func padTopN(lines []string, entries, n int) []string {
+	for i := entries; i < n; i++ {
+		if i == 0 {
+			lines = append(lines, "    "+GrayColor.Sprint("-"))
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	return lines
+}
+
+func topNLine(name string, requests int64, value string) string {
+	if StrWidth(name) > TopNNameWidth {
+		runes := []rune(name)
+		name = string(runes[:TopNNameWidth-3]) + "..."
+	}
+	return fmt.Sprintf("    %s%s %s %s",
+		name, GrayColor.Sprint(strings.Repeat(".", TopNNameWidth-StrWidth(name)+3)+":"),
+		ValueColor.Sprintf("%8s", value), ExtraColor.Sprintf("%d reqs", requests))
+}
@@ -0,0 +1,56 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats/topn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopNPanel(t *testing.T) {
+	entries := []topn.Entry{
+		{Name: "fast", Requests: 10, P95: 12},
+		{Name: strings.Repeat("x", 60), Requests: 4, Failures: 1, P95: 1500},
+	}
+
+	lines := TopNPanel(entries, 3, 5*time.Second)
+	assert.Len(t, lines, 8)
+	empty := TopNPanel(nil, 3, 5*time.Second)
+	assert.Len(t, empty, 8)
+	assert.Contains(t, empty[1], "-")
+	assert.Contains(t, empty[5], "-")
+
+	assert.Contains(t, lines[0], "slowest requests (p95, last 5s)")
+	assert.Contains(t, lines[1], strings.Repeat("x", TopNNameWidth-3)+"...")
+	assert.Contains(t, lines[1], "1.5s")
+	assert.Contains(t, lines[1], "4 reqs")
+	assert.Contains(t, lines[2], "fast")
+	assert.Contains(t, lines[2], "12ms")
+	assert.Equal(t, "", lines[3])
+	assert.Contains(t, lines[4], "most failing requests (last 5s)")
+	assert.Contains(t, lines[5], "25.00%")
+	assert.Equal(t, "", lines[6])
+	assert.Equal(t, "", lines[7])
+}